@@ -28,10 +28,15 @@ import (
 	"github.com/openshift/library-go/pkg/features"
 	"github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-operator/pkg/metrics"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	actuator "github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators/machine"
 	machinesetcontroller "github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators/machineset"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/virtualmachines"
+	"github.com/openshift/machine-api-provider-azure/pkg/health"
 	"github.com/openshift/machine-api-provider-azure/pkg/record"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apiserver/pkg/util/feature"
 	"k8s.io/component-base/featuregate"
 	"k8s.io/klog/v2"
@@ -94,6 +99,120 @@ func main() {
 		1,
 		"Maximum number of concurrent reconciles per controller instance.",
 	)
+
+	machineSetMaxConcurrentReconciles := flag.Int(
+		"machineset-max-concurrent-reconciles",
+		1,
+		"Maximum number of concurrent reconciles of the MachineSet controller.",
+	)
+
+	machineSetAzureQPS := flag.Float64(
+		"machineset-azure-qps",
+		5,
+		"Maximum number of resource SKUs requests per second to Azure made by the MachineSet controller, not limited when 0 or less.",
+	)
+
+	machineSetAzureBurst := flag.Int(
+		"machineset-azure-burst",
+		10,
+		"Maximum burst of resource SKUs requests to Azure made by the MachineSet controller.",
+	)
+
+	standaloneAvailabilitySet := flag.Bool(
+		"standalone-availability-set",
+		false,
+		"Create an availability set, named after the machine, for machines without a MachineSet label when the region has no availability zones. By default such machines are placed without an availability set.",
+	)
+
+	truncatePublicIPNames := flag.Bool(
+		"truncate-public-ip-names",
+		false,
+		"Truncate generated public IP names longer than 63 characters and suffix them with a hash of the full name. By default machines with such names fail with an invalid configuration error.",
+	)
+
+	suppressAcceleratedNetworkingEvents := flag.Bool(
+		"suppress-accelerated-networking-events",
+		false,
+		"Do not emit an event when a machine is created without accelerated networking on an instance type that supports it.",
+	)
+
+	suppressSpotMaxPriceUncappedCondition := flag.Bool(
+		"suppress-spot-max-price-uncapped-condition",
+		false,
+		"Do not set the SpotMaxPriceUncapped condition on spot machines which set no max price.",
+	)
+
+	defaultDataDiskStorageAccountType := flag.String(
+		"default-data-disk-storage-account-type",
+		"",
+		"Storage account type, e.g. Premium_LRS, used for data disks which do not set one. By default the storage account type is left for Azure to choose.",
+	)
+
+	windowsAdminPasswordSecret := flag.Bool(
+		"windows-admin-password-secret",
+		false,
+		"Store the admin password generated for Windows machines in a secret named <machine>-admin-password in the namespace of the machine.",
+	)
+
+	canceledProvisioningRetries := flag.Int(
+		"canceled-provisioning-retries",
+		3,
+		"Number of times the provisioning of a VM left in the Canceled provisioning state is retried before the machine is failed.",
+	)
+
+	vmInitializationTimeout := flag.Duration(
+		"vm-initialization-timeout",
+		10*time.Minute,
+		"How long after the creation of a machine its VM is considered to be initializing while Azure reports no provisioning state for it. The machine is requeued without an error until then.",
+	)
+
+	preserveExistingNetworkInterfaces := flag.Bool(
+		"preserve-existing-network-interfaces",
+		false,
+		"Do not overwrite an existing network interface whose configuration differs from the machine when creating the machine, set the NetworkInterfaceConfigDrift condition instead. By default the network interface is overwritten.",
+	)
+
+	verifyDeletion := flag.Bool(
+		"verify-deletion",
+		false,
+		"After deleting the resources of a machine, check that they no longer exist and report the remaining ones in the ResourcesOrphaned condition, and in an event when the machine is deleted anyway.",
+	)
+
+	azureCallTimeout := flag.Duration(
+		"azure-call-timeout",
+		2*time.Minute,
+		"How long a single call reading a resource from Azure may take before it is aborted and the machine is requeued. No timeout is applied when zero.",
+	)
+
+	azureLongRunningCallTimeout := flag.Duration(
+		"azure-long-running-call-timeout",
+		20*time.Minute,
+		"How long a single call creating, updating or deleting a resource in Azure, which may wait for a long-running operation to complete, may take before it is aborted and the machine is requeued. No timeout is applied when zero.",
+	)
+
+	resourceSkusCacheTTL := flag.Duration(
+		"resource-skus-cache-ttl",
+		resourceskus.DefaultCacheTTL,
+		"How long the resource SKUs listed from Azure for a location are cached before they are listed again. They never expire when zero.",
+	)
+
+	azureReadinessCheckInterval := flag.Duration(
+		"azure-readiness-check-interval",
+		5*time.Minute,
+		"How often the readiness check calls Azure with the credentials of the cluster to report whether Azure is reachable. The check is disabled when zero.",
+	)
+
+	azureReadinessCredentialsSecret := flag.String(
+		"azure-readiness-credentials-secret",
+		"openshift-machine-api/azure-cloud-credentials",
+		"Secret, as <namespace>/<name>, holding the credentials of the cluster the readiness check calls Azure with.",
+	)
+
+	allowedImagePublishers := flag.String(
+		"allowed-image-publishers",
+		"",
+		"Comma separated list of the publishers of the marketplace images machines can be created from. By default images of any publisher are allowed.",
+	)
 	// Sets up feature gates
 	defaultMutableGate := feature.DefaultMutableFeatureGate
 	gateOpts, err := features.NewFeatureGateOptions(defaultMutableGate, apifeatures.SelfManaged, apifeatures.FeatureGateAzureWorkloadIdentity, apifeatures.FeatureGateMachineAPIMigration)
@@ -108,6 +227,14 @@ func main() {
 	flag.Set("logtostderr", "true")
 	flag.Parse()
 
+	if *machineSetAzureQPS > 0 && *machineSetAzureBurst < 1 {
+		klog.Fatalf("Invalid machineset-azure-burst %d, it must be at least 1 when machineset-azure-qps is set", *machineSetAzureBurst)
+	}
+
+	if *defaultDataDiskStorageAccountType != "" && !virtualmachines.IsKnownStorageAccountType(*defaultDataDiskStorageAccountType) {
+		klog.Fatalf("Invalid default-data-disk-storage-account-type %q, expected a managed disk storage account type such as Premium_LRS", *defaultDataDiskStorageAccountType)
+	}
+
 	cfg := config.GetConfigOrDie()
 	syncPeriod := 10 * time.Minute
 
@@ -157,6 +284,7 @@ func main() {
 
 	// Initialize event recorder.
 	record.InitFromRecorder(mgr.GetEventRecorderFor("azure-controller"))
+	resourceskus.SetCacheTTL(*resourceSkusCacheTTL)
 	stopSignalContext := ctrl.SetupSignalHandler()
 
 	// Initialize machine actuator.
@@ -165,6 +293,22 @@ func main() {
 		ReconcilerBuilder:            actuator.NewReconciler,
 		EventRecorder:                mgr.GetEventRecorderFor("azure-controller"),
 		AzureWorkloadIdentityEnabled: azureWorkloadIdentityEnabled,
+
+		Options: actuators.Options{
+			StandaloneAvailabilitySetEnabled:        *standaloneAvailabilitySet,
+			PublicIPNameTruncationEnabled:           *truncatePublicIPNames,
+			AcceleratedNetworkingEventsSuppressed:   *suppressAcceleratedNetworkingEvents,
+			SpotMaxPriceUncappedConditionSuppressed: *suppressSpotMaxPriceUncappedCondition,
+			DefaultDataDiskStorageAccountType:       *defaultDataDiskStorageAccountType,
+			WindowsAdminPasswordSecretEnabled:       *windowsAdminPasswordSecret,
+			CanceledProvisioningRetries:             *canceledProvisioningRetries,
+			AllowedImagePublishers:                  splitList(*allowedImagePublishers),
+			VMInitializationTimeout:                 *vmInitializationTimeout,
+			ExistingNetworkInterfacesPreserved:      *preserveExistingNetworkInterfaces,
+			AzureCallTimeout:                        *azureCallTimeout,
+			AzureLongRunningCallTimeout:             *azureLongRunningCallTimeout,
+			DeletionVerificationEnabled:             *verifyDeletion,
+		},
 	})
 
 	if err := machinev1.AddToScheme(mgr.GetScheme()); err != nil {
@@ -187,9 +331,12 @@ func main() {
 		Client:                     mgr.GetClient(),
 		Log:                        ctrl.Log.WithName("controllers").WithName("MachineSet"),
 		ResourceSkusServiceBuilder: resourceskus.NewService,
+		ResourceSkusRateLimiter:    newRateLimiter(*machineSetAzureQPS, *machineSetAzureBurst),
 
 		AzureWorkloadIdentityEnabled: azureWorkloadIdentityEnabled,
-	}).SetupWithManager(mgr, controller.Options{}); err != nil {
+	}).SetupWithManager(mgr, controller.Options{
+		MaxConcurrentReconciles: *machineSetMaxConcurrentReconciles,
+	}); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MachineSet")
 		os.Exit(1)
 	}
@@ -198,6 +345,24 @@ func main() {
 		klog.Fatal(err)
 	}
 
+	if *azureReadinessCheckInterval > 0 {
+		namespace, name, ok := strings.Cut(*azureReadinessCredentialsSecret, "/")
+		if !ok || namespace == "" || name == "" {
+			klog.Fatalf("Invalid azure-readiness-credentials-secret %q, expected <namespace>/<name>", *azureReadinessCredentialsSecret)
+		}
+		probe, err := health.NewCredentialsProbe(mgr.GetClient(), corev1.SecretReference{Namespace: namespace, Name: name}, azureWorkloadIdentityEnabled)
+		if err != nil {
+			klog.Fatal(err)
+		}
+		azureChecker := health.NewAzureChecker(probe, *azureReadinessCheckInterval)
+		if err := mgr.Add(azureChecker); err != nil {
+			klog.Fatal(err)
+		}
+		if err := mgr.AddReadyzCheck("azure", azureChecker.Check); err != nil {
+			klog.Fatal(err)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
 		klog.Fatal(err)
 	}
@@ -206,3 +371,23 @@ func main() {
 		klog.Fatalf("Failed to run manager: %v", err)
 	}
 }
+
+// newRateLimiter returns a rate limiter allowing qps requests per second with the burst,
+// or nil when qps is 0 or less so that requests are not limited.
+func newRateLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// splitList returns the non-empty, trimmed items of a comma separated list.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
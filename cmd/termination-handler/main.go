@@ -29,6 +29,9 @@ func main() {
 	logger := klogr.New()
 
 	pollIntervalSeconds := flag.Int64("poll-interval-seconds", 5, "interval in seconds at which termination notice endpoint should be checked (Default: 5)")
+	pollJitterFactor := flag.Float64("poll-jitter-factor", 0.1, "maximum fraction of the poll interval randomly added to it, so that the handlers of different nodes do not poll in lockstep")
+	maxPollErrors := flag.Int("max-poll-errors", 0, "number of consecutive errors polling the termination notice endpoint to back off on before exiting")
+	acknowledgeEvents := flag.Bool("acknowledge-events", false, "acknowledge the scheduled events terminating the instance once the node is marked for deletion, so that Azure starts them sooner")
 	nodeName := flag.String("node-name", "", "name of the node that the termination handler is running on")
 	namespace := flag.String("namespace", "", "namespace that the machine for the node should live in. If unspecified, look for machines across all namespaces.")
 	flag.Set("logtostderr", "true")
@@ -44,7 +47,7 @@ func main() {
 	pollInterval := time.Duration(*pollIntervalSeconds) * time.Second
 
 	// Construct a termination handler
-	handler, err := termination.NewHandler(logger, cfg, pollInterval, *namespace, *nodeName)
+	handler, err := termination.NewHandler(logger, cfg, pollInterval, *pollJitterFactor, *maxPollErrors, *acknowledgeEvents, *namespace, *nodeName)
 	if err != nil {
 		klog.Fatalf("Error constructing termination handler: %v", err)
 	}
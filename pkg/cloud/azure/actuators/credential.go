@@ -0,0 +1,85 @@
+/*
+Copyright The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actuators
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"k8s.io/klog/v2"
+)
+
+// credentialType is the type of credential used to authenticate to Azure.
+type credentialType string
+
+const (
+	// clientSecretCredentialType authenticates with the client secret of a service principal.
+	clientSecretCredentialType credentialType = "ClientSecret"
+	// workloadIdentityCredentialType authenticates with a federated token, using Azure Workload Identity.
+	workloadIdentityCredentialType credentialType = "WorkloadIdentity"
+	// managedIdentityCredentialType authenticates as a user-assigned managed identity of the host.
+	managedIdentityCredentialType credentialType = "ManagedIdentity"
+)
+
+// refreshingCredential is a token credential which is created again when it fails to get a token.
+// The workload identity credential only reads the federated token file every few minutes, so after
+// the token is rotated it may keep exchanging the expired token until then. Creating the credential
+// again reads the rotated token right away, so that a long running reconcile does not fail on it.
+type refreshingCredential struct {
+	newCredential func() (azcore.TokenCredential, error)
+
+	mu         sync.Mutex
+	credential azcore.TokenCredential
+}
+
+// newRefreshingCredential creates a refreshing credential from the function creating the credential.
+func newRefreshingCredential(newCredential func() (azcore.TokenCredential, error)) (*refreshingCredential, error) {
+	credential, err := newCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	return &refreshingCredential{
+		newCredential: newCredential,
+		credential:    credential,
+	}, nil
+}
+
+// GetToken implements azcore.TokenCredential. When getting a token fails, the credential is created
+// again and getting the token is retried once.
+func (c *refreshingCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.Lock()
+	credential := c.credential
+	c.mu.Unlock()
+
+	token, err := credential.GetToken(ctx, options)
+	if err == nil {
+		return token, nil
+	}
+
+	klog.V(2).Infof("Failed to get token, refreshing credential: %v", err)
+	refreshed, refreshErr := c.newCredential()
+	if refreshErr != nil {
+		return azcore.AccessToken{}, fmt.Errorf("%w, failed to refresh credential: %v", err, refreshErr)
+	}
+
+	c.mu.Lock()
+	c.credential = refreshed
+	c.mu.Unlock()
+
+	return refreshed.GetToken(ctx, options)
+}
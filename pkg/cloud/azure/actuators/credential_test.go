@@ -0,0 +1,133 @@
+/*
+Copyright The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actuators
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// fakeCredential returns the token of the federated token it was created with, failing when it expired.
+type fakeCredential struct {
+	federatedToken string
+	gets           int
+}
+
+func (c *fakeCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.gets++
+	if c.federatedToken == "expired" {
+		return azcore.AccessToken{}, errors.New("AADSTS700024: Client assertion is not within its valid time range")
+	}
+	return azcore.AccessToken{Token: "token-for-" + c.federatedToken}, nil
+}
+
+func TestRefreshingCredential(t *testing.T) {
+	testCases := []struct {
+		name            string
+		federatedTokens []string
+		refreshErr      error
+		expectedToken   string
+		expectedErr     string
+		expectedCreated int
+	}{
+		{
+			name:            "Valid token",
+			federatedTokens: []string{"valid"},
+			expectedToken:   "token-for-valid",
+			expectedCreated: 1,
+		},
+		{
+			name:            "Expired then refreshed token",
+			federatedTokens: []string{"expired", "rotated"},
+			expectedToken:   "token-for-rotated",
+			expectedCreated: 2,
+		},
+		{
+			name:            "Expired token not rotated yet",
+			federatedTokens: []string{"expired", "expired"},
+			expectedErr:     "AADSTS700024: Client assertion is not within its valid time range",
+			expectedCreated: 2,
+		},
+		{
+			name:            "Refreshing the credential fails",
+			federatedTokens: []string{"expired"},
+			refreshErr:      errors.New("no such file or directory"),
+			expectedErr:     "AADSTS700024: Client assertion is not within its valid time range, failed to refresh credential: no such file or directory",
+			expectedCreated: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			created := 0
+			credential, err := newRefreshingCredential(func() (azcore.TokenCredential, error) {
+				created++
+				if created > 1 && tc.refreshErr != nil {
+					return nil, tc.refreshErr
+				}
+				return &fakeCredential{federatedToken: tc.federatedTokens[created-1]}, nil
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error creating credential: %v", err)
+			}
+
+			token, err := credential.GetToken(context.Background(), policy.TokenRequestOptions{})
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Errorf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if token.Token != tc.expectedToken {
+				t.Errorf("Expected token %q, got %q", tc.expectedToken, token.Token)
+			}
+			if created != tc.expectedCreated {
+				t.Errorf("Expected the credential to be created %d times, got %d", tc.expectedCreated, created)
+			}
+		})
+	}
+}
+
+func TestRefreshingCredentialKeepsRefreshedCredential(t *testing.T) {
+	federatedTokens := []string{"expired", "rotated"}
+	created := 0
+	credential, err := newRefreshingCredential(func() (azcore.TokenCredential, error) {
+		created++
+		return &fakeCredential{federatedToken: federatedTokens[created-1]}, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error creating credential: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		token, err := credential.GetToken(context.Background(), policy.TokenRequestOptions{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if token.Token != "token-for-rotated" {
+			t.Errorf("Expected token %q, got %q", "token-for-rotated", token.Token)
+		}
+	}
+
+	if created != 2 {
+		t.Errorf("Expected the credential to be created twice, got %d", created)
+	}
+}
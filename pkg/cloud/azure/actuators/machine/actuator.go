@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/Azure/go-autorest/autorest"
@@ -27,10 +28,13 @@ import (
 	machineapierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
 	controllerclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -54,6 +58,20 @@ type Actuator struct {
 	reconcilerBuilder func(scope *actuators.MachineScope) *Reconciler
 
 	azureWorkloadIdentityEnabled bool
+
+	options actuators.Options
+
+	// vms caches the VM of each machine read by Exists, so that the Create or Update which follows
+	// it in the same reconcile of the machine does not read it from Azure again.
+	vmsLock sync.Mutex
+	vms     map[types.UID]cachedVirtualMachine
+}
+
+// cachedVirtualMachine is the VM of a machine read by Exists, which is only valid for the resource
+// version of the machine it was read for.
+type cachedVirtualMachine struct {
+	resourceVersion string
+	vm              interface{}
 }
 
 // ActuatorParams holds parameter information for Actuator.
@@ -62,6 +80,8 @@ type ActuatorParams struct {
 	EventRecorder                record.EventRecorder
 	ReconcilerBuilder            func(scope *actuators.MachineScope) *Reconciler
 	AzureWorkloadIdentityEnabled bool
+	// Options are the settings applied to every machine reconciled by the actuator.
+	Options actuators.Options
 }
 
 // NewActuator returns an actuator.
@@ -71,7 +91,68 @@ func NewActuator(params ActuatorParams) *Actuator {
 		eventRecorder:                params.EventRecorder,
 		reconcilerBuilder:            params.ReconcilerBuilder,
 		azureWorkloadIdentityEnabled: params.AzureWorkloadIdentityEnabled,
+		options:                      params.Options,
+
+		vms: map[types.UID]cachedVirtualMachine{},
+	}
+}
+
+// storeVirtualMachine caches the VM read for the machine, or drops the cached one when no VM was read.
+func (a *Actuator) storeVirtualMachine(machine *machinev1.Machine, vm interface{}) {
+	if machine.UID == "" {
+		return
+	}
+
+	a.vmsLock.Lock()
+	defer a.vmsLock.Unlock()
+
+	if vm == nil {
+		delete(a.vms, machine.UID)
+		return
+	}
+	if a.vms == nil {
+		a.vms = map[types.UID]cachedVirtualMachine{}
+	}
+	a.vms[machine.UID] = cachedVirtualMachine{
+		resourceVersion: machine.ResourceVersion,
+		vm:              vm,
+	}
+}
+
+// takeVirtualMachine returns the VM cached for the machine, or nil when none was cached for its
+// current resource version, and drops it so that it is only used by a single operation.
+func (a *Actuator) takeVirtualMachine(machine *machinev1.Machine) interface{} {
+	a.vmsLock.Lock()
+	defer a.vmsLock.Unlock()
+
+	cached, ok := a.vms[machine.UID]
+	delete(a.vms, machine.UID)
+	if !ok || cached.resourceVersion != machine.ResourceVersion {
+		return nil
 	}
+	return cached.vm
+}
+
+// isInvalidMachineConfiguration returns whether the error is caused by an invalid machine configuration.
+func isInvalidMachineConfiguration(err error) bool {
+	var machineErr *machineapierrors.MachineError
+	return errors.As(err, &machineErr) && machineErr.Reason == machinev1.InvalidConfigurationMachineError
+}
+
+// machineIsProvisioned returns whether an instance was provisioned for the machine.
+func machineIsProvisioned(machine *machinev1.Machine) bool {
+	return len(machine.Status.Addresses) > 0 || ptr.Deref(machine.Spec.ProviderID, "") != ""
+}
+
+// newMachineScope creates a machine scope for the given machine using the actuator configuration.
+func (a *Actuator) newMachineScope(machine *machinev1.Machine) (*actuators.MachineScope, error) {
+	return actuators.NewMachineScope(actuators.MachineScopeParams{
+		Machine:                      machine,
+		CoreClient:                   a.coreClient,
+		EventRecorder:                a.eventRecorder,
+		AzureWorkloadIdentityEnabled: a.azureWorkloadIdentityEnabled,
+		Options:                      a.options,
+	})
 }
 
 // Set corresponding event based on error. It also returns the original error
@@ -85,89 +166,159 @@ func (a *Actuator) handleMachineError(machine *machinev1.Machine, err *machineap
 	return err
 }
 
+// requeueAfter returns how long to wait before retrying an operation which failed, which is longer
+// when Azure asked to wait for longer before retrying.
+func requeueAfter(retryAfter time.Duration) time.Duration {
+	if retryAfter > 20*time.Second {
+		return retryAfter
+	}
+	return 20 * time.Second
+}
+
+// registerReconcileOutcome records the outcome of the operation on the machine. The VMSize of
+// the machine is unknown when its scope could not be created.
+func registerReconcileOutcome(machine *machinev1.Machine, scope *actuators.MachineScope, operation, outcome string) {
+	vmSize := ""
+	if scope != nil && scope.MachineConfig != nil {
+		vmSize = scope.MachineConfig.VMSize
+	}
+
+	azuremetrics.RegisterReconcileOutcome(&azuremetrics.OutcomeLabels{
+		Operation: operation,
+		Role:      machine.Labels[actuators.MachineRoleLabel],
+		VMSize:    vmSize,
+		Outcome:   outcome,
+	})
+}
+
 // Create creates a machine and is invoked by the machine controller.
 func (a *Actuator) Create(ctx context.Context, machine *machinev1.Machine) error {
 	klog.Infof("Creating machine %v", machine.Name)
 
-	scope, err := actuators.NewMachineScope(actuators.MachineScopeParams{
-		Machine:                      machine,
-		CoreClient:                   a.coreClient,
-		AzureWorkloadIdentityEnabled: a.azureWorkloadIdentityEnabled,
-	})
+	scope, err := a.newMachineScope(machine)
 	if err != nil {
+		registerReconcileOutcome(machine, nil, azuremetrics.OperationCreate, azuremetrics.OutcomeInvalidConfiguration)
 		return a.handleMachineError(machine, machineapierrors.InvalidMachineConfiguration("failed to create machine %q scope: %v", machine.Name, err), createEventAction)
 
 	}
 
-	err = a.reconcilerBuilder(scope).Create(context.Background())
+	ctx = klog.NewContext(ctx, scope.Logger())
+	reconciler := a.reconcilerBuilder(scope)
+	reconciler.vm = a.takeVirtualMachine(machine)
+	err = reconciler.Create(ctx)
 	if err != nil {
 		// We still want to persist on failure to update MachineStatus
 		if err := scope.Persist(); err != nil {
 			klog.Errorf("Error storing machine info: %v", err)
 		}
 
+		// The reconciler asks for a requeue when it is waiting on Azure, which is not a failure.
+		var requeueErr *machineapierrors.RequeueAfterError
+		if errors.As(err, &requeueErr) {
+			azuremetrics.RegisterOperationRetry(&azuremetrics.RetryLabels{
+				Name:      machine.Name,
+				Namespace: machine.Namespace,
+				Operation: azuremetrics.OperationCreate,
+			})
+			return requeueErr
+		}
+
+		// Errors Azure returns for requests which can not succeed, such as exceeded quotas, are terminal.
+		// Invalid credentials are not, as the credentials may have expired between the scope creation and
+		// API calls while CCO is refreshing them, in which case the secret is updated with new ones.
+		terminal, retryAfter := azure.ClassifyError(err)
 		var detailedError autorest.DetailedError
-		if errors.As(err, &detailedError) {
-			statusCode, ok := detailedError.StatusCode.(int)
-			// Any 4xx error that isn't invalid credentials should be a terminal failure.
-			// Invalid Credentials implies that the credentials expired between the scope creation and API calls,
-			// this may happen when CCO is refreshing credentials simultaneously.
-			// In this case we should retry as the credentials should be updated in the secret.
-			if ok && statusCode >= 400 && statusCode < 500 && !azure.InvalidCredentials(err) {
-				return a.handleMachineError(machine, machineapierrors.InvalidMachineConfiguration("failed to reconcile machine %q: %v", machine.Name, detailedError), createEventAction)
+		if terminal && errors.As(err, &detailedError) {
+			registerReconcileOutcome(machine, scope, azuremetrics.OperationCreate, azuremetrics.OutcomeInvalidConfiguration)
+			if azure.QuotaExceeded(err) {
+				return a.handleMachineError(machine, machineapierrors.InvalidMachineConfiguration("failed to reconcile machine %q, Azure quota exceeded: %v", machine.Name, detailedError), createEventAction)
 			}
+			return a.handleMachineError(machine, machineapierrors.InvalidMachineConfiguration("failed to reconcile machine %q: %v", machine.Name, detailedError), createEventAction)
 		}
 
 		var machineErr *machineapierrors.MachineError
 		if errors.As(err, &machineErr) {
+			registerReconcileOutcome(machine, scope, azuremetrics.OperationCreate, azuremetrics.OutcomeInvalidConfiguration)
 			return a.handleMachineError(machine, machineapierrors.InvalidMachineConfiguration("failed to reconcile machine %q: %v", machine.Name, err), createEventAction)
 		}
 
 		a.handleMachineError(machine, machineapierrors.CreateMachine("failed to reconcile machine %qs: %v", machine.Name, err), createEventAction)
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationCreate, azuremetrics.OutcomeTransientFailure)
 
+		azuremetrics.RegisterOperationRetry(&azuremetrics.RetryLabels{
+			Name:      machine.Name,
+			Namespace: machine.Namespace,
+			Operation: azuremetrics.OperationCreate,
+		})
 		return &machineapierrors.RequeueAfterError{
-			RequeueAfter: 20 * time.Second,
+			RequeueAfter: requeueAfter(retryAfter),
 		}
 	}
 
 	if err := scope.Persist(); err != nil {
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationCreate, azuremetrics.OutcomeTransientFailure)
 		return fmt.Errorf("error storing machine info: %v", err)
 	}
 
+	registerReconcileOutcome(machine, scope, azuremetrics.OperationCreate, azuremetrics.OutcomeSuccess)
 	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Created", "Created machine %q", machine.Name)
 
 	return nil
 }
 
+// Validate checks the machine provider spec for invalid configuration without creating,
+// updating or deleting any Azure resources. It is meant to be called by webhooks or CLIs.
+func (a *Actuator) Validate(ctx context.Context, machine *machinev1.Machine) error {
+	scope, err := a.newMachineScope(machine)
+	if err != nil {
+		return machineapierrors.InvalidMachineConfiguration("failed to create machine %q scope: %v", machine.Name, err)
+	}
+
+	ctx = klog.NewContext(ctx, scope.Logger())
+	return a.reconcilerBuilder(scope).Validate(ctx)
+}
+
 // Delete deletes a machine and is invoked by the Machine Controller.
 func (a *Actuator) Delete(ctx context.Context, machine *machinev1.Machine) error {
 	klog.Infof("Deleting machine %v", machine.Name)
 
-	scope, err := actuators.NewMachineScope(actuators.MachineScopeParams{
-		Machine:                      machine,
-		CoreClient:                   a.coreClient,
-		AzureWorkloadIdentityEnabled: a.azureWorkloadIdentityEnabled,
-	})
+	scope, err := a.newMachineScope(machine)
 	if err != nil {
+		registerReconcileOutcome(machine, nil, azuremetrics.OperationDelete, azuremetrics.OutcomeTransientFailure)
 		return a.handleMachineError(machine, machineapierrors.DeleteMachine("failed to create machine %q scope: %v", machine.Name, err), deleteEventAction)
 	}
 
-	err = a.reconcilerBuilder(scope).Delete(context.Background())
+	// The machine is deleted, a VM cached for it no longer reflects its VM.
+	a.takeVirtualMachine(machine)
+
+	ctx = klog.NewContext(ctx, scope.Logger())
+	err = a.reconcilerBuilder(scope).Delete(ctx)
 	if err != nil {
 		// We still want to persist on failure to update MachineStatus
 		if err := scope.Persist(); err != nil {
 			klog.Errorf("Error storing machine info: %v", err)
 		}
+		// Failures are retried whatever their class, as the machine still needs to be deleted,
+		// but not before Azure asks to when requests are throttled.
+		_, retryAfter := azure.ClassifyError(err)
 		a.handleMachineError(machine, machineapierrors.DeleteMachine("failed to delete machine %q: %v", machine.Name, err), deleteEventAction)
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationDelete, azuremetrics.OutcomeTransientFailure)
+		azuremetrics.RegisterOperationRetry(&azuremetrics.RetryLabels{
+			Name:      machine.Name,
+			Namespace: machine.Namespace,
+			Operation: azuremetrics.OperationDelete,
+		})
 		return &machineapierrors.RequeueAfterError{
-			RequeueAfter: 20 * time.Second,
+			RequeueAfter: requeueAfter(retryAfter),
 		}
 	}
 
 	if err := scope.Persist(); err != nil {
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationDelete, azuremetrics.OutcomeTransientFailure)
 		return fmt.Errorf("error storing machine info: %v", err)
 	}
 
+	registerReconcileOutcome(machine, scope, azuremetrics.OperationDelete, azuremetrics.OutcomeSuccess)
 	a.eventRecorder.Eventf(machine, corev1.EventTypeNormal, "Deleted", "Deleted machine %q", machine.Name)
 
 	return nil
@@ -179,33 +330,52 @@ func (a *Actuator) Delete(ctx context.Context, machine *machinev1.Machine) error
 func (a *Actuator) Update(ctx context.Context, machine *machinev1.Machine) error {
 	klog.Infof("Updating machine %v", machine.Name)
 
-	scope, err := actuators.NewMachineScope(actuators.MachineScopeParams{
-		Machine:                      machine,
-		CoreClient:                   a.coreClient,
-		AzureWorkloadIdentityEnabled: a.azureWorkloadIdentityEnabled,
-	})
+	scope, err := a.newMachineScope(machine)
 	if err != nil {
+		registerReconcileOutcome(machine, nil, azuremetrics.OperationUpdate, azuremetrics.OutcomeTransientFailure)
 		return a.handleMachineError(machine, machineapierrors.UpdateMachine("failed to create machine %q scope: %v", machine.Name, err), updateEventAction)
 	}
 
-	err = a.reconcilerBuilder(scope).Update(context.Background())
+	ctx = klog.NewContext(ctx, scope.Logger())
+	reconciler := a.reconcilerBuilder(scope)
+	reconciler.vm = a.takeVirtualMachine(machine)
+	err = reconciler.Update(ctx)
 	if err != nil {
 		// We still want to persist on failure to update MachineStatus
 		if err := scope.Persist(); err != nil {
 			klog.Errorf("Error storing machine info: %v", err)
 		}
+
+		// The reconciler asks for a requeue when it is waiting on Azure, which is not a failure.
+		var requeueErr *machineapierrors.RequeueAfterError
+		if errors.As(err, &requeueErr) {
+			return requeueErr
+		}
+
+		// Failures are retried whatever their class, as the machine still needs to be updated,
+		// but not before Azure asks to when requests are throttled.
+		_, retryAfter := azure.ClassifyError(err)
 		a.handleMachineError(machine, machineapierrors.UpdateMachine("failed to update machine %q: %v", machine.Name, err), updateEventAction)
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationUpdate, azuremetrics.OutcomeTransientFailure)
+		azuremetrics.RegisterOperationRetry(&azuremetrics.RetryLabels{
+			Name:      machine.Name,
+			Namespace: machine.Namespace,
+			Operation: azuremetrics.OperationUpdate,
+		})
 		return &machineapierrors.RequeueAfterError{
-			RequeueAfter: 20 * time.Second,
+			RequeueAfter: requeueAfter(retryAfter),
 		}
 	}
 
 	previousResourceVersion := scope.Machine.ResourceVersion
 
 	if err := scope.Persist(); err != nil {
+		registerReconcileOutcome(machine, scope, azuremetrics.OperationUpdate, azuremetrics.OutcomeTransientFailure)
 		return fmt.Errorf("error storing machine info: %v", err)
 	}
 
+	registerReconcileOutcome(machine, scope, azuremetrics.OperationUpdate, azuremetrics.OutcomeSuccess)
+
 	currentResourceVersion := scope.Machine.ResourceVersion
 
 	// Create event only if machine object was modified
@@ -220,16 +390,24 @@ func (a *Actuator) Update(ctx context.Context, machine *machinev1.Machine) error
 func (a *Actuator) Exists(ctx context.Context, machine *machinev1.Machine) (bool, error) {
 	klog.Infof("%s: actuator checking if machine exists", machine.GetName())
 
-	scope, err := actuators.NewMachineScope(actuators.MachineScopeParams{
-		Machine:                      machine,
-		CoreClient:                   a.coreClient,
-		AzureWorkloadIdentityEnabled: a.azureWorkloadIdentityEnabled,
-	})
+	scope, err := a.newMachineScope(machine)
 	if err != nil {
+		// A machine which was never provisioned has no instance yet. Reporting it as not existing lets its
+		// creation fail the machine on an invalid configuration which can not recover, e.g. a malformed
+		// credentials secret, rather than retrying the existence check forever. Other errors, e.g. a missing
+		// or incomplete credentials secret which may be being updated, are retried.
+		if isInvalidMachineConfiguration(err) && !machineIsProvisioned(machine) {
+			klog.Errorf("%s: invalid configuration of machine not provisioned yet: %v", machine.GetName(), err)
+			return false, nil
+		}
 		return false, fmt.Errorf("failed to create scope: %+v", err)
 	}
 
-	isExists, err := a.reconcilerBuilder(scope).Exists(context.Background())
+	ctx = klog.NewContext(ctx, scope.Logger())
+	reconciler := a.reconcilerBuilder(scope)
+	isExists, err := reconciler.Exists(ctx)
+	// The VM read is reused by the Create or Update which follows in the same reconcile of the machine.
+	a.storeVirtualMachine(machine, reconciler.vm)
 	if apierrors.IsUnexpectedObjectError(err) {
 		return isExists, nil
 	}
@@ -27,6 +27,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/ghodss/yaml"
 	"github.com/golang/mock/gomock"
@@ -37,7 +38,10 @@ import (
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	mock_azure "github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/mock"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/virtualmachines"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
+	dto "github.com/prometheus/client_model/go"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -45,6 +49,7 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
+	controllerclient "sigs.k8s.io/controller-runtime/pkg/client"
 	controllerfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
@@ -120,6 +125,8 @@ func newFakeReconciler(t *testing.T) *Reconciler {
 	availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"testzone"}, nil).AnyTimes()
 	availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
 	availabilitySetsSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	resourcesSkus := mock_azure.NewMockService(mockCtrl)
+	resourcesSkus.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).AnyTimes()
 
 	return &Reconciler{
 		scope:                 newFakeScope(t, actuators.ControlPlane),
@@ -130,6 +137,7 @@ func newFakeReconciler(t *testing.T) *Reconciler {
 		publicIPSvc:           fakeSuccessSvc,
 		availabilityZonesSvc:  availabilityZonesSvc,
 		availabilitySetsSvc:   availabilitySetsSvc,
+		resourcesSkus:         resourcesSkus,
 	}
 }
 
@@ -143,12 +151,15 @@ func newFakeReconcilerWithScope(t *testing.T, scope *actuators.MachineScope) *Re
 	mockCtrl := gomock.NewController(t)
 	availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
 	availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"testzone"}, nil).AnyTimes()
+	resourcesSkus := mock_azure.NewMockService(mockCtrl)
+	resourcesSkus.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).AnyTimes()
 	return &Reconciler{
 		scope:                 scope,
 		availabilityZonesSvc:  availabilityZonesSvc,
 		networkInterfacesSvc:  fakeSuccessSvc,
 		virtualMachinesSvc:    fakeVMSuccessSvc,
 		virtualMachinesExtSvc: fakeSuccessSvc,
+		resourcesSkus:         resourcesSkus,
 	}
 }
 
@@ -343,9 +354,9 @@ func TestReconcileVMSuceededState(t *testing.T) {
 		t.Errorf("failed to create machine: %+v", err)
 	}
 
-	if fakeVMService.GetCallCount != 2 {
-		// One call for create, and one for the update that happens when the create is successful.
-		t.Errorf("expected get to be called exactly twice")
+	if fakeVMService.GetCallCount != 1 {
+		// The vm read on create is reused by the update that happens when the create is successful.
+		t.Errorf("expected get to be called just once")
 	}
 
 	if fakeVMService.DeleteCallCount != 0 {
@@ -370,7 +381,9 @@ func (s *FakeVMCheckZonesService) Get(ctx context.Context, spec azure.Spec) (int
 	}
 
 	return &compute.VirtualMachine{
-		VirtualMachineProperties: &compute.VirtualMachineProperties{},
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: ptr.To("Succeeded"),
+		},
 	}, nil
 }
 
@@ -432,6 +445,8 @@ func TestAvailabilityZones(t *testing.T) {
 		t.Errorf("failed to create machine: %+v", err)
 	}
 
+	// A reconciler lives for a single reconcile, start each one with a new reconciler.
+	fakeReconciler = newFakeReconcilerWithScope(t, fakeScope)
 	fakeReconciler.scope.MachineConfig.Zone = ""
 	fakeReconciler.virtualMachinesSvc = &FakeVMCheckZonesService{
 		checkZones: []string{""},
@@ -440,6 +455,7 @@ func TestAvailabilityZones(t *testing.T) {
 		t.Errorf("failed to create machine: %+v", err)
 	}
 
+	fakeReconciler = newFakeReconcilerWithScope(t, fakeScope)
 	fakeReconciler.scope.MachineConfig.Zone = "1"
 	fakeReconciler.virtualMachinesSvc = &FakeVMCheckZonesService{
 		checkZones: []string{"3"},
@@ -504,7 +520,7 @@ func TestCustomUserData(t *testing.T) {
 		t.Errorf("expected create to succeed %v", err)
 	}
 
-	userData, err := fakeReconciler.getCustomUserData()
+	userData, _, err := fakeReconciler.getVMUserData()
 	if err != nil {
 		t.Errorf("expected get custom data to succeed %v", err)
 	}
@@ -535,7 +551,7 @@ func TestCustomDataFailures(t *testing.T) {
 		t.Errorf("expected create to fail")
 	}
 
-	if _, err := fakeReconciler.getCustomUserData(); err == nil {
+	if _, _, err := fakeReconciler.getVMUserData(); err == nil {
 		t.Errorf("expected get custom data to fail")
 	}
 
@@ -543,7 +559,7 @@ func TestCustomDataFailures(t *testing.T) {
 		"notUserData": []byte("test-notuserdata"),
 	}
 	fakeScope.CoreClient = controllerfake.NewClientBuilder().WithObjects(userDataSecret).Build()
-	if _, err := fakeReconciler.getCustomUserData(); err == nil {
+	if _, _, err := fakeReconciler.getVMUserData(); err == nil {
 		t.Errorf("expected get custom data to fail, due to missing userdata")
 	}
 }
@@ -591,6 +607,7 @@ func TestMachineEvents(t *testing.T) {
 		error      string
 		operation  func(actuator *Actuator, machine *machinev1.Machine)
 		event      string
+		outcome    azuremetrics.OutcomeLabels
 	}{
 		{
 			name:       "Create machine event failed (scope)",
@@ -599,7 +616,13 @@ func TestMachineEvents(t *testing.T) {
 			operation: func(actuator *Actuator, machine *machinev1.Machine) {
 				actuator.Create(context.TODO(), machine)
 			},
-			event: "Warning FailedCreate InvalidConfiguration: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: azure client id not found in secret default/azure-credentials-secret (azure_client_id) or environment variable AZURE_CLIENT_ID",
+			event: "Warning FailedCreate InvalidConfiguration: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: incomplete credentials secret default/azure-credentials-secret: azure client id not found (azure_client_id or environment variable AZURE_CLIENT_ID)",
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationCreate,
+				Role:      actuators.Node,
+				VMSize:    "",
+				Outcome:   azuremetrics.OutcomeInvalidConfiguration,
+			},
 		},
 		{
 			name:       "Create machine event failed (reconciler)",
@@ -609,6 +632,12 @@ func TestMachineEvents(t *testing.T) {
 				actuator.Create(context.TODO(), machine)
 			},
 			event: "Warning FailedCreate InvalidConfiguration: failed to reconcile machine \"azure-actuator-testing-machine\": failed to create nic azure-actuator-testing-machine-nic for machine azure-actuator-testing-machine: MachineConfig vnet is missing on machine azure-actuator-testing-machine",
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationCreate,
+				Role:      actuators.Node,
+				VMSize:    "",
+				Outcome:   azuremetrics.OutcomeInvalidConfiguration,
+			},
 		},
 		{
 			name:       "Create machine event succeed",
@@ -618,6 +647,12 @@ func TestMachineEvents(t *testing.T) {
 				actuator.Create(context.TODO(), machine)
 			},
 			event: fmt.Sprintf("Normal Created Created machine %q", machine.Name),
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationCreate,
+				Role:      actuators.Node,
+				VMSize:    "Standard_B2ms",
+				Outcome:   azuremetrics.OutcomeSuccess,
+			},
 		},
 		{
 			name:       "Update machine event failed (scope)",
@@ -626,7 +661,13 @@ func TestMachineEvents(t *testing.T) {
 			operation: func(actuator *Actuator, machine *machinev1.Machine) {
 				actuator.Update(context.TODO(), machine)
 			},
-			event: "Warning FailedUpdate UpdateError: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: azure client id not found in secret default/azure-credentials-secret (azure_client_id) or environment variable AZURE_CLIENT_ID",
+			event: "Warning FailedUpdate UpdateError: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: incomplete credentials secret default/azure-credentials-secret: azure client id not found (azure_client_id or environment variable AZURE_CLIENT_ID)",
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationUpdate,
+				Role:      actuators.Node,
+				VMSize:    "",
+				Outcome:   azuremetrics.OutcomeTransientFailure,
+			},
 		},
 		{
 			name:       "Update machine event succeed",
@@ -636,6 +677,12 @@ func TestMachineEvents(t *testing.T) {
 				actuator.Update(context.TODO(), machine)
 			},
 			event: fmt.Sprintf("Normal Updated Updated machine %q", machine.Name),
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationUpdate,
+				Role:      actuators.Node,
+				VMSize:    "Standard_B2ms",
+				Outcome:   azuremetrics.OutcomeSuccess,
+			},
 		},
 		{
 			name:       "Delete machine event failed (scope)",
@@ -644,7 +691,13 @@ func TestMachineEvents(t *testing.T) {
 			operation: func(actuator *Actuator, machine *machinev1.Machine) {
 				actuator.Delete(context.TODO(), machine)
 			},
-			event: "Warning FailedDelete DeleteError: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: azure client id not found in secret default/azure-credentials-secret (azure_client_id) or environment variable AZURE_CLIENT_ID",
+			event: "Warning FailedDelete DeleteError: failed to create machine \"azure-actuator-testing-machine\" scope: failed to update cluster: incomplete credentials secret default/azure-credentials-secret: azure client id not found (azure_client_id or environment variable AZURE_CLIENT_ID)",
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationDelete,
+				Role:      actuators.Node,
+				VMSize:    "",
+				Outcome:   azuremetrics.OutcomeTransientFailure,
+			},
 		},
 		{
 			name:       "Delete machine event failed (reconciler)",
@@ -654,6 +707,12 @@ func TestMachineEvents(t *testing.T) {
 				actuator.Delete(context.TODO(), machine)
 			},
 			event: "Warning FailedDelete DeleteError: failed to delete machine \"azure-actuator-testing-machine\": MachineConfig vnet is missing on machine azure-actuator-testing-machine",
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationDelete,
+				Role:      actuators.Node,
+				VMSize:    "",
+				Outcome:   azuremetrics.OutcomeTransientFailure,
+			},
 		},
 		{
 			name:       "Delete machine event succeed",
@@ -663,6 +722,12 @@ func TestMachineEvents(t *testing.T) {
 				actuator.Delete(context.TODO(), machine)
 			},
 			event: fmt.Sprintf("Normal Deleted Deleted machine %q", machine.Name),
+			outcome: azuremetrics.OutcomeLabels{
+				Operation: azuremetrics.OperationDelete,
+				Role:      actuators.Node,
+				VMSize:    "Standard_B2ms",
+				Outcome:   azuremetrics.OutcomeSuccess,
+			},
 		},
 	}
 
@@ -671,6 +736,7 @@ func TestMachineEvents(t *testing.T) {
 			cs := controllerfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(tc.credSecret, infra).WithStatusSubresource(&machinev1.Machine{}).Build()
 
 			m := tc.machine.DeepCopy()
+			m.Labels[actuators.MachineRoleLabel] = actuators.Node
 			if err := cs.Create(context.TODO(), m); err != nil {
 				t.Fatal(err)
 			}
@@ -683,6 +749,7 @@ func TestMachineEvents(t *testing.T) {
 			disksSvc := mock_azure.NewMockService(mockCtrl)
 			availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
 			availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+			resourcesSkusSvc := mock_azure.NewMockService(mockCtrl)
 
 			eventsChannel := make(chan string, 1)
 
@@ -698,6 +765,7 @@ func TestMachineEvents(t *testing.T) {
 						virtualMachinesExtSvc: vmExtSvc,
 						publicIPSvc:           pipSvc,
 						disksSvc:              disksSvc,
+						resourcesSkus:         resourcesSkusSvc,
 					}
 				},
 				// use fake recorder and store an event into one item long buffer for subsequent check
@@ -720,15 +788,23 @@ func TestMachineEvents(t *testing.T) {
 					},
 				},
 			}, nil).AnyTimes()
+			vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.AssignableToTypeOf(&virtualmachines.TagsSpec{})).Return(nil).AnyTimes()
 			vmSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			disksSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			networkSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			pipSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 			availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"testzone"}, nil).AnyTimes()
 			availabilitySetsSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+			resourcesSkusSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).AnyTimes()
+
+			outcomes := reconcileOutcomes(t, tc.outcome)
 
 			tc.operation(machineActuator, m)
 
+			if got := reconcileOutcomes(t, tc.outcome); got != outcomes+1 {
+				t.Errorf("Expected %v %s outcomes, got %v", outcomes+1, tc.outcome.Outcome, got)
+			}
+
 			select {
 			case event := <-eventsChannel:
 				if event != tc.event {
@@ -741,6 +817,102 @@ func TestMachineEvents(t *testing.T) {
 	}
 }
 
+func TestExistsInvalidCredentialsSecret(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: globalInfrastuctureName,
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-ghfd",
+			PlatformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName: configv1.AzurePublicCloud,
+				},
+			},
+		},
+	}
+
+	const providerID = "azure:///subscriptions/test/resourceGroups/test/providers/Microsoft.Compute/virtualMachines/azure-actuator-testing-machine"
+	const incompleteErr = "failed to create scope: failed to update cluster: incomplete credentials secret default/azure-credentials-secret: azure client id not found (azure_client_id or environment variable AZURE_CLIENT_ID)"
+
+	cases := []struct {
+		name          string
+		providerID    *string
+		missingSecret bool
+		// secretData overrides keys of the stub secret, a nil value removes the key.
+		secretData  map[string][]byte
+		expectedErr string
+	}{
+		{
+			name:       "Malformed secret of a machine not provisioned yet",
+			secretData: map[string][]byte{"azure_use_managed_identity": []byte("yes please")},
+		},
+		{
+			name:        "Malformed secret of a provisioned machine",
+			providerID:  ptr.To[string](providerID),
+			secretData:  map[string][]byte{"azure_use_managed_identity": []byte("yes please")},
+			expectedErr: `failed to create scope: failed to update cluster: invalid credentials secret default/azure-credentials-secret: azure managed identity marker (azure_use_managed_identity) must be true or false, got "yes please"`,
+		},
+		{
+			name:        "Incomplete secret of a machine not provisioned yet",
+			secretData:  map[string][]byte{"azure_client_id": nil},
+			expectedErr: incompleteErr,
+		},
+		{
+			name:        "Incomplete secret of a provisioned machine",
+			providerID:  ptr.To[string](providerID),
+			secretData:  map[string][]byte{"azure_client_id": nil},
+			expectedErr: incompleteErr,
+		},
+		{
+			name:          "Missing secret of a machine not provisioned yet",
+			missingSecret: true,
+			expectedErr:   `failed to create scope: failed to update cluster: secrets "azure-credentials-secret" not found`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			machine, err := stubMachine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			machine.Spec.ProviderID = tc.providerID
+
+			objects := []controllerclient.Object{infra}
+			if !tc.missingSecret {
+				secret := StubAzureCredentialsSecret()
+				for key, value := range tc.secretData {
+					if value == nil {
+						delete(secret.Data, key)
+					} else {
+						secret.Data[key] = value
+					}
+				}
+				objects = append(objects, secret)
+			}
+
+			cs := controllerfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+			machineActuator := NewActuator(ActuatorParams{
+				CoreClient:    cs,
+				EventRecorder: &record.FakeRecorder{},
+			})
+
+			exists, err := machineActuator.Exists(context.TODO(), machine)
+			if exists {
+				t.Errorf("Expected the machine not to exist")
+			}
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			} else if err == nil || err.Error() != tc.expectedErr {
+				t.Errorf("Expected error %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
 func TestStatusCodeBasedCreationErrors(t *testing.T) {
 	infra := &configv1.Infrastructure{
 		ObjectMeta: metav1.ObjectMeta{
@@ -786,6 +958,12 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 			statusCode: 401,
 			requeable:  true,
 		},
+		{
+			name:       "Conflict",
+			event:      "Warning FailedCreate CreateError: failed to reconcile machine \"azure-actuator-testing-machine\"s: failed to create vm azure-actuator-testing-machine: failed to create VM: failed to create or get machine: compute.VirtualMachinesClient#CreateOrUpdate: MOCK: StatusCode=409",
+			statusCode: 409,
+			requeable:  true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -806,6 +984,7 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 			networkSvc := mock_azure.NewMockService(mockCtrl)
 			vmSvc := mock_azure.NewMockService(mockCtrl)
 			availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+			resourcesSkus := mock_azure.NewMockService(mockCtrl)
 
 			eventsChannel := make(chan string, 1)
 
@@ -817,6 +996,7 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 						networkInterfacesSvc: networkSvc,
 						virtualMachinesSvc:   vmSvc,
 						availabilityZonesSvc: availabilityZonesSvc,
+						resourcesSkus:        resourcesSkus,
 					}
 				},
 				// use fake recorder and store an event into one item long buffer for subsequent check
@@ -832,6 +1012,10 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 			vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(wrapErr).Times(1)
 			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, autorest.NewError("compute.VirtualMachinesClient", "Get", "MOCK")).Times(1)
 			availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"testzone"}, nil).Times(1)
+			resourcesSkus.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).Times(2)
+
+			createRetries := operationRetries(t, machine, azuremetrics.OperationCreate)
+			updateRetries := operationRetries(t, machine, azuremetrics.OperationUpdate)
 
 			_, ok := machineActuator.Create(context.TODO(), machine).(*machineapierrors.RequeueAfterError)
 			if ok && !tc.requeable {
@@ -841,6 +1025,17 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 				t.Error("Error is requeable but was not requeued")
 			}
 
+			expectedCreateRetries := createRetries
+			if tc.requeable {
+				expectedCreateRetries++
+			}
+			if retries := operationRetries(t, machine, azuremetrics.OperationCreate); retries != expectedCreateRetries {
+				t.Errorf("Expected %v create retries, got %v", expectedCreateRetries, retries)
+			}
+			if retries := operationRetries(t, machine, azuremetrics.OperationUpdate); retries != updateRetries {
+				t.Errorf("Expected %v update retries, got %v", updateRetries, retries)
+			}
+
 			select {
 			case event := <-eventsChannel:
 				if event != tc.event {
@@ -853,6 +1048,126 @@ func TestStatusCodeBasedCreationErrors(t *testing.T) {
 	}
 }
 
+func TestQuotaExceededCreationError(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: globalInfrastuctureName,
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-yuhg",
+			PlatformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName: configv1.AzurePublicCloud,
+				},
+			},
+		},
+	}
+
+	machine, err := stubMachine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs := controllerfake.NewClientBuilder().WithObjects(
+		StubAzureCredentialsSecret(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "azure-actuator-user-data-secret",
+				Namespace: "default",
+			},
+			Data: map[string][]byte{
+				"userData": []byte("S3CR3T"),
+			},
+		},
+		infra).Build()
+
+	mockCtrl := gomock.NewController(t)
+	networkSvc := mock_azure.NewMockService(mockCtrl)
+	vmSvc := mock_azure.NewMockService(mockCtrl)
+	availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+	resourcesSkus := mock_azure.NewMockService(mockCtrl)
+
+	eventsChannel := make(chan string, 1)
+
+	var machineScope *actuators.MachineScope
+	machineActuator := NewActuator(ActuatorParams{
+		CoreClient: cs,
+		ReconcilerBuilder: func(scope *actuators.MachineScope) *Reconciler {
+			machineScope = scope
+			return &Reconciler{
+				scope:                scope,
+				networkInterfacesSvc: networkSvc,
+				virtualMachinesSvc:   vmSvc,
+				availabilityZonesSvc: availabilityZonesSvc,
+				resourcesSkus:        resourcesSkus,
+			}
+		},
+		EventRecorder: &record.FakeRecorder{
+			Events: eventsChannel,
+		},
+	})
+
+	networkSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	azureErr := autorest.NewErrorWithError(&autorestazure.RequestError{
+		ServiceError: &autorestazure.ServiceError{
+			Code:    "OperationNotAllowed",
+			Message: "Operation could not be completed as it results in exceeding approved standardDSv3Family Cores quota.",
+		},
+	}, "compute.VirtualMachinesClient", "CreateOrUpdate", nil, "MOCK")
+	azureErr.StatusCode = 409
+	vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(fmt.Errorf("failed to create or get machine: %w", azureErr)).Times(1)
+	vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, autorest.NewError("compute.VirtualMachinesClient", "Get", "MOCK")).Times(1)
+	availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"testzone"}, nil).Times(1)
+	resourcesSkus.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).Times(2)
+
+	createRetries := operationRetries(t, machine, azuremetrics.OperationCreate)
+
+	err = machineActuator.Create(context.TODO(), machine)
+	if _, ok := err.(*machineapierrors.RequeueAfterError); ok {
+		t.Fatalf("Expected the quota exceeded error not to be requeued")
+	}
+	var machineErr *machineapierrors.MachineError
+	if !errors.As(err, &machineErr) || machineErr.Reason != machinev1.InvalidConfigurationMachineError {
+		t.Errorf("Expected an invalid machine configuration error, got %v", err)
+	}
+	if retries := operationRetries(t, machine, azuremetrics.OperationCreate); retries != createRetries {
+		t.Errorf("Expected %v create retries, got %v", createRetries, retries)
+	}
+
+	select {
+	case event := <-eventsChannel:
+		if !strings.HasPrefix(event, "Warning FailedCreate InvalidConfiguration: failed to reconcile machine \"azure-actuator-testing-machine\", Azure quota exceeded: ") {
+			t.Errorf("Expected a quota exceeded event, got %q", event)
+		}
+	default:
+		t.Errorf("Expected a quota exceeded event, got none")
+	}
+
+	condition := findCondition(machineScope.MachineStatus.Conditions, string(machinev1.MachineCreated))
+	if condition == nil {
+		t.Fatalf("Expected the %s condition to be set", machinev1.MachineCreated)
+	}
+	if condition.Status != metav1.ConditionFalse || condition.Reason != quotaExceededReason {
+		t.Errorf("Expected the %s condition to be False with reason %s, got %s with reason %s",
+			machinev1.MachineCreated, quotaExceededReason, condition.Status, condition.Reason)
+	}
+}
+
+func operationRetries(t *testing.T, machine *machinev1.Machine, operation string) float64 {
+	metric := &dto.Metric{}
+	if err := azuremetrics.OperationRetryCount.WithLabelValues(machine.Name, machine.Namespace, operation).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func reconcileOutcomes(t *testing.T, labels azuremetrics.OutcomeLabels) float64 {
+	metric := &dto.Metric{}
+	if err := azuremetrics.ReconcileOutcomeCount.WithLabelValues(labels.Operation, labels.Role, labels.VMSize, labels.Outcome).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
 func TestInvalidConfigurationCreationErrors(t *testing.T) {
 	infra := &configv1.Infrastructure{
 		ObjectMeta: metav1.ObjectMeta{
@@ -882,7 +1197,7 @@ func TestInvalidConfigurationCreationErrors(t *testing.T) {
 			mutatePC: func(s *machinev1.AzureMachineProviderSpec) {
 				s.PublicIP = true
 			},
-			expectedErr: machineapierrors.InvalidMachineConfiguration("failed to reconcile machine \"MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ\": failed to create nic MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-nic for machine MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ: unable to create Public IP: machine public IP name is longer than 63 characters"),
+			expectedErr: machineapierrors.InvalidMachineConfiguration("failed to reconcile machine \"MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ\": network interface name \"MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-nic\" is longer than 80 characters; unable to create Public IP: machine public IP name is longer than 63 characters; OS disk name \"MachineNameOverSixtyCharsabcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_OSDisk\" is longer than 80 characters"),
 		},
 		{
 			name: "Machine Config missing vnet",
@@ -961,3 +1276,89 @@ func TestInvalidConfigurationCreationErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestExistsVirtualMachineIsReusedByUpdate(t *testing.T) {
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: globalInfrastuctureName,
+		},
+		Status: configv1.InfrastructureStatus{
+			InfrastructureName: "test-ghfd",
+			PlatformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName: configv1.AzurePublicCloud,
+				},
+			},
+		},
+	}
+
+	machine, err := stubMachine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine.UID = "azure-actuator-testing-machine-uid"
+
+	cs := controllerfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(StubAzureCredentialsSecret(), infra, machine).WithStatusSubresource(&machinev1.Machine{}).Build()
+
+	fakeVMService := &FakeVMService{
+		Name:              "azure-actuator-testing-machine",
+		ID:                "azure-actuator-testing-machine-ID",
+		ProvisioningState: "Succeeded",
+	}
+	machineActuator := NewActuator(ActuatorParams{
+		CoreClient:    cs,
+		EventRecorder: record.NewFakeRecorder(10),
+		ReconcilerBuilder: func(scope *actuators.MachineScope) *Reconciler {
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = fakeVMService
+			return r
+		},
+	})
+
+	existsAndUpdate := func(expectedGetCallCount int) {
+		t.Helper()
+		exists, err := machineActuator.Exists(context.TODO(), machine)
+		if err != nil || !exists {
+			t.Fatalf("Expected the machine to exist, got %v, %v", exists, err)
+		}
+		if err := machineActuator.Update(context.TODO(), machine); err != nil {
+			t.Fatalf("Unexpected error updating the machine: %v", err)
+		}
+		if fakeVMService.GetCallCount != expectedGetCallCount {
+			t.Errorf("Expected get to be called %d times, got %d", expectedGetCallCount, fakeVMService.GetCallCount)
+		}
+	}
+
+	// The vm read by Exists is reused by the Update which follows it.
+	existsAndUpdate(1)
+
+	// The vm read by Exists is only reused by a single Update.
+	if err := machineActuator.Update(context.TODO(), machine); err != nil {
+		t.Fatalf("Unexpected error updating the machine: %v", err)
+	}
+	if fakeVMService.GetCallCount != 2 {
+		t.Errorf("Expected get to be called 2 times, got %d", fakeVMService.GetCallCount)
+	}
+
+	// The vm read by Exists is not reused once the machine was changed in between.
+	if err := cs.Get(context.TODO(), controllerclient.ObjectKeyFromObject(machine), machine); err != nil {
+		t.Fatal(err)
+	}
+	exists, err := machineActuator.Exists(context.TODO(), machine)
+	if err != nil || !exists {
+		t.Fatalf("Expected the machine to exist, got %v, %v", exists, err)
+	}
+	machine.Labels["changed"] = ""
+	if err := cs.Update(context.TODO(), machine); err != nil {
+		t.Fatal(err)
+	}
+	if err := machineActuator.Update(context.TODO(), machine); err != nil {
+		t.Fatalf("Unexpected error updating the machine: %v", err)
+	}
+	if fakeVMService.GetCallCount != 4 {
+		t.Errorf("Expected get to be called 4 times, got %d", fakeVMService.GetCallCount)
+	}
+
+	// A new reconcile reads the vm again.
+	existsAndUpdate(5)
+}
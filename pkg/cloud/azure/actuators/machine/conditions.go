@@ -1,6 +1,9 @@
 package machine
 
 import (
+	"fmt"
+	"strings"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 )
@@ -9,8 +12,140 @@ const (
 	machineCreationSucceedReason  = "MachineCreationSucceeded"
 	machineCreationSucceedMessage = "machine successfully created"
 	machineCreationFailedReason   = "MachineCreationFailed"
+	// quotaExceededReason is the reason of the MachineCreated condition when the machine can not be created
+	// because it exceeds an Azure quota, which is not retried until the machine is recreated.
+	quotaExceededReason = "QuotaExceeded"
+	// vmProvisioningFailedReason is the reason of the MachineCreated condition when the VM failed provisioning
+	// and was deleted to be recreated. The message holds the failure details reported by Azure.
+	vmProvisioningFailedReason = "VMProvisioningFailed"
+
+	// nicReadyConditionType reports the Azure provisioning state of the machine network interfaces.
+	nicReadyConditionType = "NICReady"
+	// publicIPReadyConditionType reports the Azure provisioning state of the machine public IP addresses.
+	publicIPReadyConditionType = "PublicIPReady"
+
+	resourceProvisioningSucceededReason = "ProvisioningSucceeded"
+	azureProvisioningStateSucceeded     = "Succeeded"
+
+	// securityTypeConditionType records the effective security type applied to the VM on creation in the
+	// conditions of the provider status, which has no security type field. The reason of the condition is
+	// the security type, Standard when the VM has no security type.
+	securityTypeConditionType = "SecurityType"
+	standardSecurityType      = "Standard"
+
+	// spotMaxPriceUncappedConditionType informs that a spot VM sets no max price, and so is billed
+	// up to the on-demand price of its instance type.
+	spotMaxPriceUncappedConditionType = "SpotMaxPriceUncapped"
+	spotMaxPriceUnsetReason           = "MaxPriceUnset"
+	spotMaxPriceUncappedMessage       = "spot vm has no max price set, it is billed up to the on-demand price and only evicted for capacity"
+
+	// proximityPlacementGroupDriftConditionType reports that the VM is not placed in the proximity placement
+	// group requested for the machine. The placement of a VM can not be changed, the machine has to be recreated.
+	proximityPlacementGroupDriftConditionType = "ProximityPlacementGroupDrift"
+	immutablePlacementReason                  = "ImmutablePlacement"
+
+	// networkInterfaceConfigDriftConditionType reports that the existing network interface of the machine was
+	// not overwritten on creation although its configuration differs from the machine.
+	networkInterfaceConfigDriftConditionType = "NetworkInterfaceConfigDrift"
+	existingConfigPreservedReason            = "ExistingConfigPreserved"
+
+	// networkInterfaceMissingConditionType reports network interfaces referenced by the VM which do not exist
+	// and are not recreated, as they were not created with the machine.
+	networkInterfaceMissingConditionType = "NetworkInterfaceMissing"
+	networkInterfaceNotFoundReason       = "NotFound"
+
+	// resourcesOrphanedConditionType reports the resources deleted with the machine which still exist once
+	// their deletion was requested, when the deletion of the machine is verified.
+	resourcesOrphanedConditionType = "ResourcesOrphaned"
+	resourcesNotDeletedReason      = "ResourcesNotDeleted"
+
+	// acceleratedNetworkingDriftConditionType reports that accelerated networking of the network interface of the
+	// machine differs from the machine, until it is changed while the VM is deallocated.
+	acceleratedNetworkingDriftConditionType = "AcceleratedNetworkingDrift"
+	vmNotDeallocatedReason                  = "VMNotDeallocated"
+	acceleratedNetworkingUpdateFailedReason = "UpdateFailed"
+
+	// powerStateConditionType reports the power state of the VM requested by the machine annotations against
+	// the actual one, while the VM is deallocated on request and until it is running again.
+	powerStateConditionType = "PowerState"
+	deallocatedReason       = "Deallocated"
+	deallocatingReason      = "Deallocating"
+	startingReason          = "Starting"
 )
 
+// newSecurityTypeCondition returns the condition recording the effective security type of the VM.
+func newSecurityTypeCondition(securityType string) metav1.Condition {
+	if securityType == "" {
+		securityType = standardSecurityType
+	}
+
+	return metav1.Condition{
+		Type:    securityTypeConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  securityType,
+		Message: fmt.Sprintf("vm created with security type %s", securityType),
+	}
+}
+
+// provisioningStateCondition aggregates the Azure provisioning states of the
+// dependent resources of a single kind (e.g. network interfaces) into a condition.
+type provisioningStateCondition struct {
+	conditionType string
+	resourceKind  string
+	observed      bool
+	reason        string
+	messages      []string
+}
+
+func newProvisioningStateCondition(conditionType, resourceKind string) *provisioningStateCondition {
+	return &provisioningStateCondition{
+		conditionType: conditionType,
+		resourceKind:  resourceKind,
+	}
+}
+
+// observe records the provisioning state of the named resource.
+// Resources without a provisioning state are ignored.
+func (p *provisioningStateCondition) observe(name string, provisioningState *string) {
+	if provisioningState == nil {
+		return
+	}
+	p.observed = true
+
+	if *provisioningState == azureProvisioningStateSucceeded {
+		return
+	}
+
+	// The reason reflects the state reported by Azure for the first resource that is not ready.
+	if p.reason == "" {
+		p.reason = *provisioningState
+	}
+	p.messages = append(p.messages, fmt.Sprintf("%s %q is in provisioning state %q", p.resourceKind, name, *provisioningState))
+}
+
+// apply sets the condition on the given conditions if any provisioning state was observed.
+func (p *provisioningStateCondition) apply(conditions []metav1.Condition) []metav1.Condition {
+	if !p.observed {
+		return conditions
+	}
+
+	if len(p.messages) == 0 {
+		return setCondition(conditions, metav1.Condition{
+			Type:    p.conditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  resourceProvisioningSucceededReason,
+			Message: fmt.Sprintf("all %ss are provisioned", p.resourceKind),
+		})
+	}
+
+	return setCondition(conditions, metav1.Condition{
+		Type:    p.conditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  p.reason,
+		Message: strings.Join(p.messages, "; "),
+	})
+}
+
 func shouldUpdateCondition(
 	oldCondition metav1.Condition,
 	newCondition metav1.Condition,
@@ -64,6 +199,23 @@ func setCondition(conditions []metav1.Condition, newCondition metav1.Condition)
 	return conditions
 }
 
+// removeCondition removes the condition with the specified condition type
+// and returns the new slice of conditions.
+func removeCondition(conditions []metav1.Condition, conditionType string) []metav1.Condition {
+	if findCondition(conditions, conditionType) == nil {
+		return conditions
+	}
+
+	klog.V(4).Infof("Removing provider condition %s", conditionType)
+	newConditions := make([]metav1.Condition, 0, len(conditions)-1)
+	for _, condition := range conditions {
+		if condition.Type != conditionType {
+			newConditions = append(newConditions, condition)
+		}
+	}
+	return newConditions
+}
+
 // findCondition finds in the machine the condition that has the
 // specified condition type. If none exists, then returns nil.
 func findCondition(conditions []metav1.Condition, conditionType string) *metav1.Condition {
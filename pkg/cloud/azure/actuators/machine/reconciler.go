@@ -21,11 +21,17 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
 	"github.com/Azure/go-autorest/autorest"
 	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
@@ -36,15 +42,23 @@ import (
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/decode"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/availabilitysets"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/availabilityzones"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/capacityreservations"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/diskencryptionsets"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/disks"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/images"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/interfaceloadbalancers"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/marketplace"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/networkinterfaces"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/publicips"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/subnets"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/virtualmachines"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
 	apicorev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -63,6 +77,161 @@ const (
 	// MachineInstanceStateAnnotationName as annotation name for a machine instance state
 	MachineInstanceStateAnnotationName = "machine.openshift.io/instance-state"
 
+	// MachineAdminUsernameAnnotationName as annotation name for the admin username of a machine instance,
+	// azure.DefaultUserName is used when not set
+	MachineAdminUsernameAnnotationName = "machine.openshift.io/azure-admin-username"
+
+	// MachineCanceledProvisioningRetriesAnnotationName as annotation name for the number of times
+	// the provisioning of a machine instance left in the Canceled provisioning state was retried
+	MachineCanceledProvisioningRetriesAnnotationName = "machine.openshift.io/azure-canceled-provisioning-retries"
+
+	// MachineNetworkInterfaceAnnotationName as annotation name for the name or resource ID of a
+	// pre-existing network interface the machine instance is attached to instead of a generated one
+	MachineNetworkInterfaceAnnotationName = "machine.openshift.io/azure-network-interface"
+
+	// MachineNetworkInterfaceVnetAnnotationName as annotation name for the name, in the network resource group,
+	// or the resource ID of the virtual network of the subnet of the network interface generated for a machine
+	// instance, the vnet of the provider spec is used when not set
+	MachineNetworkInterfaceVnetAnnotationName = "machine.openshift.io/azure-network-interface-vnet"
+
+	// MachineSecondaryPrivateIPsAnnotationName as annotation name for the secondary private IPs of the
+	// network interface of a machine instance, either a number of dynamically allocated IPs or a comma
+	// separated list of static IPs
+	MachineSecondaryPrivateIPsAnnotationName = "machine.openshift.io/azure-secondary-private-ips"
+
+	// MachinePrivateIPAnnotationName as annotation name for the static private IP of the network interface
+	// of a machine instance, either an IP address of the subnet or the index of an address in the subnet
+	MachinePrivateIPAnnotationName = "machine.openshift.io/azure-private-ip"
+
+	// MachinePrivateIPRangeAnnotationName as annotation name for the CIDR range of the subnet the index
+	// set by MachinePrivateIPAnnotationName is counted from, the IPv4 address space of the subnet is used
+	// when not set
+	MachinePrivateIPRangeAnnotationName = "machine.openshift.io/azure-private-ip-range"
+
+	// MachineDNSServersAnnotationName as annotation name for the comma separated list of IPs of the DNS
+	// servers of the network interface of a machine instance, the DNS servers of the virtual network are
+	// used when not set
+	MachineDNSServersAnnotationName = "machine.openshift.io/azure-dns-servers"
+
+	// MachineIPForwardingAnnotationName as annotation name for enabling IP forwarding on the network interface
+	// of a machine instance, either true or false
+	MachineIPForwardingAnnotationName = "machine.openshift.io/azure-ip-forwarding"
+
+	// MachineDataDisksFromImageAnnotationName as annotation name for the comma separated list of LUNs of
+	// the data disks of a machine instance created from the data disk of the image with the same LUN
+	// instead of empty
+	MachineDataDisksFromImageAnnotationName = "machine.openshift.io/azure-data-disks-from-image"
+
+	// MachineAttachedDataDisksAnnotationName as annotation name for the comma separated list of lun:resourceID
+	// entries of the existing, unattached managed disks attached as the data disks of a machine instance with
+	// the same LUN instead of creating them, the data disks must use the Detach deletion policy
+	MachineAttachedDataDisksAnnotationName = "machine.openshift.io/azure-attached-data-disks"
+
+	// MachineAvailabilitySetFaultDomainCountAnnotationName as annotation name for the number of fault domains
+	// of the availability set created for a machine instance, the maximum supported in the location is used
+	// when not set, it must match the count of the availability set when it already exists
+	MachineAvailabilitySetFaultDomainCountAnnotationName = "machine.openshift.io/azure-availability-set-fault-domain-count"
+
+	// MachineAvailabilitySetUpdateDomainCountAnnotationName as annotation name for the number of update domains
+	// of the availability set created for a machine instance, it must match the count of the availability set
+	// when it already exists
+	MachineAvailabilitySetUpdateDomainCountAnnotationName = "machine.openshift.io/azure-availability-set-update-domain-count"
+
+	// MachineRegionalAnnotationName as annotation name for placing a machine instance neither in a zone nor in
+	// an availability set, so that it is zone-redundant in regions with availability zones, either true or false
+	MachineRegionalAnnotationName = "machine.openshift.io/azure-regional"
+
+	// MachineSpotEvictionPolicyAnnotationName as annotation name for the eviction policy, Deallocate or Delete,
+	// of a spot machine instance, Deallocate is used when not set
+	MachineSpotEvictionPolicyAnnotationName = "machine.openshift.io/azure-spot-eviction-policy"
+
+	// MachineEphemeralOSDiskPlacementAnnotationName as annotation name for where the ephemeral OS disk of a
+	// machine instance is placed, CacheDisk or ResourceDisk, Azure chooses the placement when not set
+	MachineEphemeralOSDiskPlacementAnnotationName = "machine.openshift.io/azure-ephemeral-os-disk-placement"
+
+	// MachineOSDiskDeletionPolicyAnnotationName as annotation name for whether the OS disk of a machine instance
+	// is deleted or kept when the machine is deleted, Delete or Detach, the OS disk is deleted when not set
+	MachineOSDiskDeletionPolicyAnnotationName = "machine.openshift.io/azure-os-disk-deletion-policy"
+
+	// MachineProximityPlacementGroupAnnotationName as annotation name for the resource ID of the proximity
+	// placement group a machine instance is created in
+	MachineProximityPlacementGroupAnnotationName = "machine.openshift.io/azure-proximity-placement-group"
+
+	// MachinePlacedAvailabilitySetAnnotationName as annotation name for the resource ID of the availability
+	// set the machine instance was placed in
+	MachinePlacedAvailabilitySetAnnotationName = "machine.openshift.io/azure-placed-availability-set"
+
+	// MachinePlacedProximityPlacementGroupAnnotationName as annotation name for the resource ID of the proximity
+	// placement group the machine instance was placed in
+	MachinePlacedProximityPlacementGroupAnnotationName = "machine.openshift.io/azure-placed-proximity-placement-group"
+
+	// MachinePlacedHostAnnotationName as annotation name for the resource ID of the dedicated host the machine
+	// instance was placed on
+	MachinePlacedHostAnnotationName = "machine.openshift.io/azure-placed-host"
+
+	// MachineImageVersionAnnotationName as annotation name for the exact version of the image a machine instance was created from,
+	// which differs from the version of the provider spec when it is latest
+	MachineImageVersionAnnotationName = "machine.openshift.io/azure-image-version"
+
+	// MachinePublicIPDomainNameLabelAnnotationName as annotation name for the DNS label of the public IP
+	// of a machine instance, the lowercased public IP name is used when not set
+	MachinePublicIPDomainNameLabelAnnotationName = "machine.openshift.io/azure-public-ip-domain-name-label"
+
+	// MachinePublicIPIdleTimeoutAnnotationName as annotation name for the idle timeout in minutes, 4 to 30,
+	// of the public IP of a machine instance
+	MachinePublicIPIdleTimeoutAnnotationName = "machine.openshift.io/azure-public-ip-idle-timeout"
+
+	// MachinePublicIPSKUAnnotationName as annotation name for the SKU, Basic or Standard, of the public IP
+	// of a machine instance, Standard is used when not set. Basic is retired by Azure and only kept by
+	// machines created with it
+	MachinePublicIPSKUAnnotationName = "machine.openshift.io/azure-public-ip-sku"
+
+	// MachinePublicIPAllocationMethodAnnotationName as annotation name for the allocation method, Static or
+	// Dynamic, of the public IP of a machine instance, Static is used when not set
+	MachinePublicIPAllocationMethodAnnotationName = "machine.openshift.io/azure-public-ip-allocation-method"
+
+	// MachinePublicIPVersionAnnotationName as annotation name for the IP family, IPv4 or IPv6, of the public IP
+	// of a machine instance, IPv4 is used when not set
+	MachinePublicIPVersionAnnotationName = "machine.openshift.io/azure-public-ip-version"
+
+	// MachinePublicIPZonesAnnotationName as annotation name for the zones of the public IP of a machine instance,
+	// Zonal in the zone of the machine, ZoneRedundant in all the zones of the region or Regional in none, the
+	// public IP of a regional machine is zone-redundant and the one of other machines regional when not set
+	MachinePublicIPZonesAnnotationName = "machine.openshift.io/azure-public-ip-zones"
+
+	// MachinePowerStateAnnotationName as annotation name for the requested power state of a machine instance,
+	// Deallocated deallocates the VM and removing the annotation starts it again
+	MachinePowerStateAnnotationName = "machine.openshift.io/azure-power-state"
+
+	// MachineUltraDiskPerformanceAnnotationName as annotation name for the provisioned IOPS and throughput of ultra data disks,
+	// a comma separated list of lun:iops:mbps entries
+	MachineUltraDiskPerformanceAnnotationName = "machine.openshift.io/azure-ultra-disk-performance"
+
+	// MachineDiskBurstingAnnotationName as annotation name for the premium disks of a machine to enable on-demand bursting on,
+	// a comma separated list of data disk LUNs where os stands for the OS disk
+	MachineDiskBurstingAnnotationName = "machine.openshift.io/azure-disk-bursting"
+
+	// MachineWriteAcceleratorAnnotationName as annotation name for the disks of a machine to enable write accelerator on,
+	// a comma separated list of data disk LUNs where os stands for the OS disk
+	MachineWriteAcceleratorAnnotationName = "machine.openshift.io/azure-write-accelerator"
+
+	// MachineProvisioningStartedAnnotationName as annotation name for the time the creation of a machine instance started,
+	// removed once the provisioning duration is recorded
+	MachineProvisioningStartedAnnotationName = "machine.openshift.io/azure-provisioning-started"
+
+	// MachineUserDataModeAnnotationName as annotation name for how the payload of the user data secret is sent to a
+	// machine instance, as CustomData, as UserData, which is retrievable from the instance metadata service, or as
+	// Both, CustomData is used when not set
+	MachineUserDataModeAnnotationName = "machine.openshift.io/azure-user-data-mode"
+
+	// MachineAssignedIdentityAnnotationName as annotation name for the resource ID of the user-assigned identity
+	// assigned to a machine instance from its provider spec, the only identity removed once the spec drops it
+	MachineAssignedIdentityAnnotationName = "machine.openshift.io/azure-assigned-identity"
+
+	// MachineHibernationEnabledAnnotationName as annotation name for enabling the hibernation capability of
+	// a machine instance, either true or false, applied when the virtual machine is created
+	MachineHibernationEnabledAnnotationName = "machine.openshift.io/azure-hibernation-enabled"
+
 	// MachineInstanceTypeLabelName as annotation name for a machine instance type
 	MachineInstanceTypeLabelName = "machine.openshift.io/instance-type"
 
@@ -73,6 +242,12 @@ const (
 	azureResourceGroupsLowerKey   = "resourcegroups"
 	azureLocationsKey             = "locations"
 	azureBuiltInResourceNamespace = "Microsoft.Resources"
+	azureComputeResourceNamespace = "Microsoft.Compute"
+	azureDiskEncryptionSetsType   = "diskEncryptionSets"
+	azureDisksType                = "disks"
+
+	// annotatedOSDisk stands for the OS disk in the annotations listing disks of the machine
+	annotatedOSDisk = "os"
 )
 
 // Reconciler are list of services required by cluster actuator, easy to create a fake
@@ -82,37 +257,65 @@ type Reconciler struct {
 	interfaceLoadBalancersSvc azure.Service
 	networkInterfacesSvc      azure.Service
 	publicIPSvc               azure.Service
+	subnetsSvc                azure.Service
 	virtualMachinesSvc        azure.Service
 	virtualMachinesExtSvc     azure.Service
 	disksSvc                  azure.Service
 	availabilitySetsSvc       azure.Service
 	resourcesSkus             azure.Service
+	capacityReservationsSvc   azure.Service
+	imagesSvc                 azure.Service
+	diskEncryptionSetsSvc     azure.Service
+	marketplaceSvc            azure.Service
+
+	// vm caches the VM of the machine read by getVirtualMachine, so that it is read from Azure once per
+	// reconcile. It is handed over by the actuator from Exists to the Create or Update which follows it,
+	// and dropped whenever the VM is written.
+	vm interface{}
 }
 
-// NewReconciler populates all the services based on input scope
+// NewReconciler populates all the services based on input scope, each call to Azure is bounded by the timeouts of the scope
 func NewReconciler(scope *actuators.MachineScope) *Reconciler {
+	withTimeout := func(service azure.Service) azure.Service {
+		return azure.WithTimeout(service, scope.AzureCallTimeout, scope.AzureLongRunningCallTimeout)
+	}
 	return &Reconciler{
 		scope:                     scope,
-		availabilityZonesSvc:      availabilityzones.NewService(scope),
-		interfaceLoadBalancersSvc: interfaceloadbalancers.NewService(scope),
-		networkInterfacesSvc:      networkinterfaces.NewService(scope),
-		virtualMachinesSvc:        virtualmachines.NewService(scope),
-		publicIPSvc:               publicips.NewService(scope),
-		disksSvc:                  disks.NewService(scope),
-		availabilitySetsSvc:       availabilitysets.NewService(scope),
-		resourcesSkus:             resourceskus.NewService(scope),
+		availabilityZonesSvc:      withTimeout(availabilityzones.NewService(scope)),
+		interfaceLoadBalancersSvc: withTimeout(interfaceloadbalancers.NewService(scope)),
+		networkInterfacesSvc:      withTimeout(networkinterfaces.NewService(scope)),
+		virtualMachinesSvc:        withTimeout(virtualmachines.NewService(scope)),
+		publicIPSvc:               withTimeout(publicips.NewService(scope)),
+		subnetsSvc:                withTimeout(subnets.NewService(scope)),
+		disksSvc:                  withTimeout(disks.NewService(scope)),
+		availabilitySetsSvc:       withTimeout(availabilitysets.NewService(scope)),
+		resourcesSkus:             withTimeout(resourceskus.NewService(scope)),
+		capacityReservationsSvc:   withTimeout(capacityreservations.NewService(scope)),
+		imagesSvc:                 withTimeout(images.NewService(scope)),
+		diskEncryptionSetsSvc:     withTimeout(diskencryptionsets.NewService(scope)),
+		marketplaceSvc:            withTimeout(marketplace.NewService(scope)),
 	}
 }
 
 // Create creates machine if and only if machine exists, handled by cluster-api
 func (s *Reconciler) Create(ctx context.Context) error {
 	if err := s.CreateMachine(ctx); err != nil {
-		s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
-			Type:    string(machinev1.MachineCreated),
-			Status:  metav1.ConditionFalse,
-			Reason:  machineCreationFailedReason,
-			Message: err.Error(),
-		})
+		// A requeue means the creation is still in progress rather than failed.
+		var requeueErr *machinecontroller.RequeueAfterError
+		if !errors.As(err, &requeueErr) {
+			reason := machineCreationFailedReason
+			if azure.QuotaExceeded(err) {
+				reason = quotaExceededReason
+			} else if errors.Is(err, errVMProvisioningFailed) {
+				reason = vmProvisioningFailedReason
+			}
+			s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+				Type:    string(machinev1.MachineCreated),
+				Status:  metav1.ConditionFalse,
+				Reason:  reason,
+				Message: err.Error(),
+			})
+		}
 		return err
 	}
 	return nil
@@ -127,19 +330,44 @@ func (s *Reconciler) CreateMachine(ctx context.Context) error {
 		s.scope.Machine.Annotations = map[string]string{}
 	}
 
-	nicName := azure.GenerateNetworkInterfaceName(s.scope.Machine.Name)
-	if err := s.createNetworkInterface(ctx, nicName); err != nil {
-		return fmt.Errorf("failed to create nic %s for machine %s: %w", nicName, s.scope.Machine.Name, err)
+	// Keep the start of the first attempt so that retried creations are part of the provisioning duration.
+	if _, ok := s.scope.Machine.Annotations[MachineProvisioningStartedAnnotationName]; !ok {
+		s.scope.Machine.Annotations[MachineProvisioningStartedAnnotationName] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	// Validate the placement and the names of the resources before creating any resource for the machine.
+	if err := validateAvailabilitySetAndZone(s.scope.MachineConfig); err != nil {
+		return err
+	}
+
+	if err := s.validateGeneratedNames(); err != nil {
+		return err
+	}
+
+	nic, err := s.getNetworkInterfaceRef()
+	if err != nil {
+		return err
+	}
+
+	if nic.userManaged {
+		if err := s.validateNetworkInterfaceExists(ctx, nic); err != nil {
+			return err
+		}
+	} else if err := s.createNetworkInterface(ctx, nic.name); err != nil {
+		return fmt.Errorf("failed to create nic %s for machine %s: %w", nic.name, s.scope.Machine.Name, err)
+	} else if !s.scope.MachineConfig.AcceleratedNetworking {
+		// Only emitted when creating the machine, not when Update recreates its network interface.
+		s.recordAcceleratedNetworkingAvailable(ctx)
 	}
 
 	// Availability set will be created only if no zones were found for a machine or
 	// if availability set name was not specified in provider spec
-	asName, err := s.getOrCreateAvailabilitySet()
+	asName, err := s.getOrCreateAvailabilitySet(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to create availability set %s for machine %s: %w", asName, s.scope.Machine.Name, err)
 	}
 
-	if err := s.createVirtualMachine(ctx, nicName, asName); err != nil {
+	if err := s.createVirtualMachine(ctx, nic.name, asName); err != nil {
 		return fmt.Errorf("failed to create vm %s: %w", s.scope.Machine.Name, err)
 	}
 
@@ -155,10 +383,7 @@ func (s *Reconciler) CreateMachine(ctx context.Context) error {
 
 // Update updates machine if and only if machine exists, handled by cluster-api
 func (s *Reconciler) Update(ctx context.Context) error {
-	vmSpec := &virtualmachines.Spec{
-		Name: s.scope.Machine.Name,
-	}
-	vmInterface, err := s.virtualMachinesSvc.Get(ctx, vmSpec)
+	vmInterface, err := s.getVirtualMachine(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get vm: %+v", err)
 	}
@@ -168,16 +393,56 @@ func (s *Reconciler) Update(ctx context.Context) error {
 		return errors.New("returned incorrect vm interface")
 	}
 
-	// TODO: Uncomment after implementing tagging.
-	// Ensure that the tags are correct.
-	/*
-		_, err = a.ensureTags(computeSvc, machine, scope.MachineStatus.VMID, scope.MachineConfig.AdditionalTags)
-		if err != nil {
-			return fmt.Errorf("failed to ensure tags: %+v", err)
-		}
-	*/
+	s.reconcileVMID(vm)
+
+	// The existing VM and its resources are operated on in the resource group the VM was created in, which
+	// the provider spec may no longer match.
+	resourceGroup := s.getCreatedResourceGroup()
+	vmResourceGroup := resourceGroup
+	if vmResourceGroup == "" {
+		vmResourceGroup = s.scope.MachineConfig.ResourceGroup
+	}
+
+	switch getVMProvisioningState(vm) {
+	case "":
+		// Nothing else can be reconciled from a VM which has no properties yet.
+		return s.requeueInitializingVM()
+	case vmStateCanceled:
+		return s.retryCanceledProvisioning(ctx, vm)
+	case machinev1.VMStateSucceeded:
+		delete(s.scope.Machine.Annotations, MachineCanceledProvisioningRetriesAnnotationName)
+		s.recordProvisioningDuration()
+	}
+
+	if err := s.reconcileIdentity(ctx, vm, resourceGroup); err != nil {
+		return fmt.Errorf("failed to reconcile vm identity: %w", err)
+	}
+
+	if err := s.reconcileDataDisksDeletionPolicy(ctx, vm, resourceGroup); err != nil {
+		return fmt.Errorf("failed to reconcile data disks deletion policy: %w", err)
+	}
+
+	if err := s.reconcileUltraDiskPerformance(ctx, resourceGroup); err != nil {
+		return fmt.Errorf("failed to reconcile ultra disk performance: %w", err)
+	}
+
+	if err := s.reconcileDiskBursting(ctx, resourceGroup); err != nil {
+		return fmt.Errorf("failed to reconcile disk bursting: %w", err)
+	}
+
+	if err := s.reconcileTags(ctx, vm, resourceGroup); err != nil {
+		return fmt.Errorf("failed to ensure tags: %w", err)
+	}
 
 	networkAddresses := []apicorev1.NodeAddress{}
+	// Failures to reconcile a network interface do not stop the addresses and the status of the machine
+	// from being updated, they are returned once the update is done.
+	var nicErrs []error
+
+	// Track the provisioning state of the dependent resources so that a resource
+	// stuck in a non-succeeded state can be pinpointed from the machine conditions.
+	nicReady := newProvisioningStateCondition(nicReadyConditionType, "network interface")
+	publicIPReady := newProvisioningStateCondition(publicIPReadyConditionType, "public IP address")
 
 	// The computer name for a VM instance is the hostname of the VM
 	// TODO(jchaloup): find a way how to propagete the hostname change in case
@@ -200,22 +465,81 @@ func (s *Reconciler) Update(ctx context.Context) error {
 			return fmt.Errorf("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name)
 		}
 
+		nicRef, err := s.getNetworkInterfaceRef()
+		if err != nil {
+			return err
+		}
+
+		missingNICs := []string{}
 		for _, iface := range *vm.NetworkProfile.NetworkInterfaces {
 			// Get iface name from the ID
 			ifaceName := path.Base(*iface.ID)
-			networkIface, err := s.networkInterfacesSvc.Get(ctx, &networkinterfaces.Spec{
+			ifaceSpec := &networkinterfaces.Spec{
 				Name:     ifaceName,
 				VnetName: s.scope.MachineConfig.Vnet,
-			})
+			}
+			// Pre-existing network interfaces may live outside of the resource group of the machine.
+			if ifaceID, err := autorestazure.ParseResourceID(*iface.ID); err == nil && !strings.EqualFold(ifaceID.ResourceGroup, s.scope.MachineConfig.ResourceGroup) {
+				ifaceSpec.ResourceGroup = ifaceID.ResourceGroup
+			}
+			// Only the network interface generated for the machine can be written from the machine spec.
+			machineNIC := !nicRef.userManaged && ifaceSpec.ResourceGroup == "" && strings.EqualFold(ifaceName, nicRef.name)
+
+			niface, err := s.getNetworkInterface(ctx, ifaceSpec)
+			var detailedError autorest.DetailedError
+			if err != nil && errors.As(err, &detailedError) && detailedError.StatusCode == http.StatusNotFound {
+				// The network interface was deleted while the VM remains. The network interface generated for the
+				// machine is recreated with the resource ID referenced by the VM, any other one is only reported.
+				if !machineNIC {
+					klog.Errorf("%s: network interface %s referenced by the vm does not exist", s.scope.Machine.Name, ifaceName)
+					missingNICs = append(missingNICs, ifaceName)
+					continue
+				}
+
+				klog.Warningf("%s: network interface %s referenced by the vm does not exist, recreating it", s.scope.Machine.Name, ifaceName)
+				if err := s.createNetworkInterface(ctx, ifaceName); err != nil {
+					nicErrs = append(nicErrs, fmt.Errorf("failed to recreate missing network interface %s: %w", ifaceName, err))
+					continue
+				}
+				niface, err = s.getNetworkInterface(ctx, ifaceSpec)
+			} else if err == nil && niface.InterfacePropertiesFormat != nil && provisioningFailed(niface.ProvisioningState) {
+				// Azure does not retry the provisioning of a failed network interface, it has to be written again.
+				// The network interface generated for the machine is written from the machine spec, any other
+				// one as it is, as it was not created from the machine spec.
+				klog.Warningf("%s: network interface %s is in provisioning state Failed, recreating it", s.scope.Machine.Name, ifaceName)
+				var recreateErr error
+				if machineNIC {
+					recreateErr = s.createNetworkInterface(ctx, ifaceName)
+				} else {
+					recreateErr = s.networkInterfacesSvc.CreateOrUpdate(ctx, &networkinterfaces.ReprovisionSpec{
+						Name:          ifaceName,
+						ResourceGroup: ifaceSpec.ResourceGroup,
+					})
+				}
+				if recreateErr != nil {
+					nicErrs = append(nicErrs, fmt.Errorf("failed to recreate failed network interface %s: %w", ifaceName, recreateErr))
+				} else {
+					niface, err = s.getNetworkInterface(ctx, ifaceSpec)
+				}
+			}
 			if err != nil {
 				klog.Errorf("Unable to get %q network interface: %v", ifaceName, err)
 				continue
 			}
 
-			niface, err := decode.GetNetworkInterface(networkIface)
-			if err != nil {
-				klog.Errorf("Network interfaces get returned invalid network interface, getting %T instead", networkIface)
-				continue
+			if niface.InterfacePropertiesFormat != nil {
+				nicReady.observe(ifaceName, niface.InterfacePropertiesFormat.ProvisioningState)
+			}
+
+			// Security groups of pre-existing network interfaces are left to their owner, as are the ones of
+			// network interfaces preserved on creation because they differed from the machine.
+			preserved := findCondition(s.scope.MachineStatus.Conditions, networkInterfaceConfigDriftConditionType) != nil
+			if !nicRef.userManaged && !preserved && strings.EqualFold(ifaceName, nicRef.name) {
+				if err := s.reconcileNetworkInterfaceSecurityGroups(ctx, ifaceName, niface); err != nil {
+					nicErrs = append(nicErrs, fmt.Errorf("failed to reconcile security groups of network interface %s: %w", ifaceName, err))
+				}
+
+				s.reconcileNetworkInterfaceAcceleratedNetworking(ctx, ifaceName, niface, vm)
 			}
 
 			// Internal dns name consists of a hostname and internal dns suffix
@@ -239,18 +563,26 @@ func (s *Reconciler) Update(ctx context.Context) error {
 				}
 
 				if ipConfig.PublicIPAddress != nil && ipConfig.PublicIPAddress.ID != nil {
-					publicIPInterface, publicIPErr := s.publicIPSvc.Get(ctx, &publicips.Spec{Name: path.Base(*ipConfig.PublicIPAddress.ID)})
-					if publicIPErr != nil {
-						klog.Errorf("Unable to get %q public IP: %v", path.Base(*ipConfig.PublicIPAddress.ID), publicIPErr)
-						continue
+					publicIPName := path.Base(*ipConfig.PublicIPAddress.ID)
+					ip, err := s.getPublicIP(ctx, publicIPName, resourceGroup)
+					if err == nil && machineNIC && ip.PublicIPAddressPropertiesFormat != nil && provisioningFailed(ip.ProvisioningState) && s.isMachinePublicIP(publicIPName) {
+						// Azure does not retry the provisioning of a failed public IP address, it has to be written again.
+						klog.Warningf("%s: public IP address %s is in provisioning state Failed, recreating it", s.scope.Machine.Name, publicIPName)
+						if _, recreateErr := s.createPublicIP(ctx); recreateErr != nil {
+							nicErrs = append(nicErrs, fmt.Errorf("failed to recreate failed public IP address %s: %w", publicIPName, recreateErr))
+						} else {
+							ip, err = s.getPublicIP(ctx, publicIPName, resourceGroup)
+						}
 					}
-
-					ip, err := decode.GetPublicIPAdress(publicIPInterface)
 					if err != nil {
-						klog.Errorf("Public ip get returned invalid network interface, getting %T instead", publicIPInterface)
+						klog.Errorf("Unable to get %q public IP: %v", publicIPName, err)
 						continue
 					}
 
+					if ip.PublicIPAddressPropertiesFormat != nil {
+						publicIPReady.observe(publicIPName, ip.ProvisioningState)
+					}
+
 					if ip.IPAddress != nil {
 						networkAddresses = append(networkAddresses, apicorev1.NodeAddress{
 							Type:    apicorev1.NodeExternalIP,
@@ -268,6 +600,8 @@ func (s *Reconciler) Update(ctx context.Context) error {
 			}
 		}
 
+		s.reconcileNetworkInterfaceMissingCondition(missingNICs)
+
 		// If the internal load balancer isn't set on a control plane machine,
 		// we should attempt to populate it else if the machine is later replaced,
 		// its replacement will not get attached to the load balancer.
@@ -278,7 +612,7 @@ func (s *Reconciler) Update(ctx context.Context) error {
 
 				lbsiface, err := s.interfaceLoadBalancersSvc.Get(ctx, &interfaceloadbalancers.Spec{
 					NicName:           ifaceName,
-					ResourceGroupName: s.scope.MachineConfig.ResourceGroup,
+					ResourceGroupName: vmResourceGroup,
 				})
 				if err != nil {
 					klog.Errorf("Unable to get load balancers for interface %s: %v", ifaceName, err)
@@ -317,7 +651,7 @@ func (s *Reconciler) Update(ctx context.Context) error {
 	if vm.OsProfile != nil && vm.OsProfile.ComputerName != nil {
 		providerID := azure.GenerateMachineProviderID(
 			s.scope.SubscriptionID,
-			s.scope.MachineConfig.ResourceGroup,
+			vmResourceGroup,
 			*vm.OsProfile.ComputerName)
 		s.scope.Machine.Spec.ProviderID = &providerID
 	} else {
@@ -332,551 +666,3822 @@ func (s *Reconciler) Update(ctx context.Context) error {
 		Reason:  machineCreationSucceedReason,
 		Message: machineCreationSucceedMessage,
 	})
+	s.scope.MachineStatus.Conditions = nicReady.apply(s.scope.MachineStatus.Conditions)
+	s.scope.MachineStatus.Conditions = publicIPReady.apply(s.scope.MachineStatus.Conditions)
+	s.reconcileSpotMaxPriceUncappedCondition()
+	s.reconcileProximityPlacementGroupDriftCondition(ctx, vm)
+
+	if err := s.reconcilePowerState(ctx, vm, resourceGroup); err != nil {
+		return fmt.Errorf("failed to reconcile vm power state: %w", err)
+	}
 
 	vmState := getVMState(vm)
-	s.scope.MachineStatus.VMID = vm.ID
 	s.scope.MachineStatus.VMState = &vmState
 
 	s.setMachineCloudProviderSpecifics(vm)
 
-	return nil
+	return utilerrors.NewAggregate(nicErrs)
 }
 
-func getVMState(vm *decode.VirtualMachine) machinev1.AzureVMState {
-	if vm.VirtualMachineProperties == nil || vm.ProvisioningState == nil {
-		return ""
+// getNetworkInterface returns the decoded network interface of the spec.
+func (s *Reconciler) getNetworkInterface(ctx context.Context, nicSpec *networkinterfaces.Spec) (*decode.NetworkInterface, error) {
+	nicInterface, err := s.networkInterfacesSvc.Get(ctx, nicSpec)
+	if err != nil {
+		return nil, err
 	}
 
-	if *vm.ProvisioningState != "Succeeded" {
-		return machinev1.AzureVMState(*vm.ProvisioningState)
+	nic, err := decode.GetNetworkInterface(nicInterface)
+	if err != nil {
+		return nil, fmt.Errorf("network interfaces get returned invalid network interface, getting %T instead", nicInterface)
 	}
+	return nic, nil
+}
 
-	if vm.InstanceView == nil || vm.InstanceView.Statuses == nil {
-		return ""
+// getPublicIP returns the decoded public IP address of the given name in the given resource group, or the one
+// of the machine when empty.
+func (s *Reconciler) getPublicIP(ctx context.Context, name, resourceGroup string) (*decode.PublicIPAddress, error) {
+	publicIPInterface, err := s.publicIPSvc.Get(ctx, &publicips.Spec{Name: name, ResourceGroup: resourceGroup})
+	if err != nil {
+		return nil, err
 	}
 
-	// https://docs.microsoft.com/en-us/java/api/com.azure.resourcemanager.compute.models.powerstate
-	for _, status := range *vm.InstanceView.Statuses {
-		if status.Code == nil {
-			continue
-		}
-		switch *status.Code {
-		case "ProvisioningState/succeeded":
-			continue
-		case "PowerState/starting":
-			return machinev1.VMStateStarting
-		case "PowerState/running":
-			return machinev1.VMStateRunning
-		case "PowerState/stopping":
-			return machinev1.VMStateStopping
-		case "PowerState/stopped":
-			return machinev1.VMStateStopped
-		case "PowerState/deallocating":
-			return machinev1.VMStateDeallocating
-		case "PowerState/deallocated":
-			return machinev1.VMStateDeallocated
-		default:
-			return machinev1.VMStateUnknown
-		}
+	ip, err := decode.GetPublicIPAdress(publicIPInterface)
+	if err != nil {
+		return nil, fmt.Errorf("public ip get returned invalid public IP address, getting %T instead", publicIPInterface)
 	}
+	return ip, nil
+}
 
-	return ""
+// isMachinePublicIP returns whether the named public IP address is the one created for the machine.
+func (s *Reconciler) isMachinePublicIP(name string) bool {
+	if !s.scope.MachineConfig.PublicIP {
+		return false
+	}
+	publicIPName, err := s.getPublicIPName()
+	return err == nil && strings.EqualFold(publicIPName, name)
 }
 
-func (s *Reconciler) setMachineCloudProviderSpecifics(vm *decode.VirtualMachine) {
-	if s.scope.Machine.Labels == nil {
-		s.scope.Machine.Labels = make(map[string]string)
+// provisioningFailed returns whether the Azure provisioning state is Failed.
+func provisioningFailed(provisioningState *string) bool {
+	return strings.EqualFold(ptr.Deref(provisioningState, ""), string(network.ProvisioningStateFailed))
+}
+
+// reconcileNetworkInterfaceMissingCondition sets a condition listing the network interfaces referenced by the VM
+// which do not exist and were not recreated, and removes it once they all exist.
+func (s *Reconciler) reconcileNetworkInterfaceMissingCondition(missingNICs []string) {
+	if len(missingNICs) == 0 {
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, networkInterfaceMissingConditionType)
+		return
 	}
 
-	if s.scope.Machine.Annotations == nil {
-		s.scope.Machine.Annotations = make(map[string]string)
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    networkInterfaceMissingConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  networkInterfaceNotFoundReason,
+		Message: fmt.Sprintf("network interfaces %s referenced by the vm do not exist, the machine has no addresses from them", strings.Join(missingNICs, ", ")),
+	})
+}
+
+// reconcileSpotMaxPriceUncappedCondition sets an informational condition on spot machines which set
+// no max price, and removes it from any other machine or when the condition is suppressed.
+func (s *Reconciler) reconcileSpotMaxPriceUncappedCondition() {
+	spotVMOptions := s.scope.MachineConfig.SpotVMOptions
+	if spotVMOptions == nil || spotVMOptions.MaxPrice != nil || s.scope.SpotMaxPriceUncappedConditionSuppressed {
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, spotMaxPriceUncappedConditionType)
+		return
 	}
 
-	s.scope.Machine.Annotations[MachineInstanceStateAnnotationName] = string(getVMState(vm))
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    spotMaxPriceUncappedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  spotMaxPriceUnsetReason,
+		Message: spotMaxPriceUncappedMessage,
+	})
+}
 
-	if vm.VirtualMachineProperties != nil {
-		if vm.VirtualMachineProperties.HardwareProfile != nil {
-			s.scope.Machine.Labels[MachineInstanceTypeLabelName] = string(vm.VirtualMachineProperties.HardwareProfile.VMSize)
-		}
+// reconcileProximityPlacementGroupDriftCondition sets a condition when the VM is not placed in the proximity
+// placement group requested by the machine annotations, and removes it once they match again. When none is
+// requested, the VM is expected in the proximity placement group of its availability set, if any. The placement
+// of an existing VM is left as it is, changing it requires the machine to be recreated.
+func (s *Reconciler) reconcileProximityPlacementGroupDriftCondition(ctx context.Context, vm *decode.VirtualMachine) {
+	requestedID := s.scope.Machine.Annotations[MachineProximityPlacementGroupAnnotationName]
+	placedID := ""
+	if vm.VirtualMachineProperties != nil && vm.ProximityPlacementGroup != nil {
+		placedID = ptr.Deref(vm.ProximityPlacementGroup.ID, "")
 	}
 
-	if vm.Location != nil {
-		s.scope.Machine.Labels[MachineRegionLabelName] = *vm.Location
+	if requestedID == "" && placedID != "" && vm.AvailabilitySet != nil && vm.AvailabilitySet.ID != nil {
+		availabilitySetPPGID, err := s.getAvailabilitySetProximityPlacementGroupID(ctx, *vm.AvailabilitySet.ID)
+		if err != nil {
+			klog.Warningf("%s: unable to get the proximity placement group of availability set %s: %v", s.scope.Machine.Name, *vm.AvailabilitySet.ID, err)
+			return
+		}
+		requestedID = availabilitySetPPGID
 	}
-	if vm.Zones != nil {
-		s.scope.Machine.Labels[MachineAZLabelName] = strings.Join(*vm.Zones, ",")
+
+	if strings.EqualFold(requestedID, placedID) {
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, proximityPlacementGroupDriftConditionType)
+		return
 	}
 
-	if s.scope.MachineConfig.SpotVMOptions != nil {
-		// Label on the Machine so that an MHC can select spot instances
-		s.scope.Machine.Labels[machinecontroller.MachineInterruptibleInstanceLabelName] = ""
+	klog.Infof("%s: vm is placed in proximity placement group %q instead of %q, the machine has to be recreated to change it", s.scope.Machine.Name, placedID, requestedID)
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    proximityPlacementGroupDriftConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  immutablePlacementReason,
+		Message: fmt.Sprintf("vm is placed in proximity placement group %q instead of the requested %q, the machine has to be recreated to change it", placedID, requestedID),
+	})
+}
 
-		if s.scope.Machine.Spec.Labels == nil {
-			s.scope.Machine.Spec.Labels = make(map[string]string)
-		}
-		// Label on the Spec so that it is propogated to the Node
-		s.scope.Machine.Spec.Labels[machinecontroller.MachineInterruptibleInstanceLabelName] = ""
+// getAvailabilitySetProximityPlacementGroupID returns the resource ID of the proximity placement group of the
+// availability set with the given resource ID, empty when it is in none.
+func (s *Reconciler) getAvailabilitySetProximityPlacementGroupID(ctx context.Context, availabilitySetID string) (string, error) {
+	resourceID, err := autorestazure.ParseResourceID(availabilitySetID)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse availability set ID %q: %w", availabilitySetID, err)
 	}
-}
 
-// Exists checks if machine exists
-func (s *Reconciler) Exists(ctx context.Context) (bool, error) {
-	vmSpec := &virtualmachines.Spec{
-		Name: s.scope.Name(),
+	asInterface, err := s.availabilitySetsSvc.Get(ctx, &availabilitysets.Spec{Name: resourceID.ResourceName, ResourceGroup: resourceID.ResourceGroup})
+	if err != nil {
+		return "", err
+	}
+	as, ok := asInterface.(compute.AvailabilitySet)
+	if !ok {
+		return "", fmt.Errorf("availability set get returned invalid availability set, getting %T instead", asInterface)
 	}
-	vmInterface, err := s.virtualMachinesSvc.Get(ctx, vmSpec)
 
-	if err != nil && azure.ResourceNotFound(err) {
-		return false, nil
+	if as.AvailabilitySetProperties == nil || as.ProximityPlacementGroup == nil {
+		return "", nil
 	}
+	return ptr.Deref(as.ProximityPlacementGroup.ID, ""), nil
+}
 
+// reconcilePowerState deallocates the VM when requested by the machine annotations, and starts it again once
+// the annotation is removed. The power state condition tracks the VMs deallocated on request, so that VMs
+// stopped by other means are not started.
+func (s *Reconciler) reconcilePowerState(ctx context.Context, vm *decode.VirtualMachine, resourceGroup string) error {
+	requested, err := s.getDeallocationRequested()
 	if err != nil {
-		return false, fmt.Errorf("failed to get vm: %w", err)
+		return err
 	}
 
-	vm, err := decode.GetVirtualMachine(vmInterface)
-	if err != nil {
-		return false, fmt.Errorf("returned incorrect vm interface: %v", err)
+	vmState := getVMState(vm)
+
+	if requested {
+		switch vmState {
+		case machinev1.VMStateDeallocated:
+			s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+				Type:    powerStateConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  deallocatedReason,
+				Message: fmt.Sprintf("vm is deallocated as requested by annotation %s", MachinePowerStateAnnotationName),
+			})
+			return nil
+		case machinev1.VMStateRunning, machinev1.VMStateStarting, machinev1.VMStateStopping, machinev1.VMStateStopped:
+			klog.Infof("%s: deallocating vm as requested by annotation %s", s.scope.Machine.Name, MachinePowerStateAnnotationName)
+			if err := s.writeVirtualMachine(ctx, &virtualmachines.PowerStateSpec{
+				Name:          s.scope.Machine.Name,
+				Deallocated:   true,
+				ResourceGroup: resourceGroup,
+			}); err != nil {
+				return err
+			}
+		case machinev1.VMStateDeallocating:
+			// The deallocation is already in progress.
+		}
+
+		s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+			Type:    powerStateConditionType,
+			Status:  metav1.ConditionFalse,
+			Reason:  deallocatingReason,
+			Message: fmt.Sprintf("vm is %q, deallocation was requested by annotation %s", vmState, MachinePowerStateAnnotationName),
+		})
+		return nil
 	}
 
-	switch machinev1.AzureVMState(*vm.ProvisioningState) {
-	case machinev1.VMStateDeleting:
-		return true, fmt.Errorf("vm for machine %s has unexpected 'Deleting' provisioning state", s.scope.Machine.GetName())
-	case machinev1.VMStateFailed:
-		klog.Infof("vm for machine %s has unexpected 'Failed' provisioning state", s.scope.Machine.GetName())
-		return false, &apierrors.UnexpectedObjectError{
-			Object: s.scope.Machine,
+	if findCondition(s.scope.MachineStatus.Conditions, powerStateConditionType) == nil {
+		return nil
+	}
+
+	switch vmState {
+	case machinev1.VMStateRunning:
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, powerStateConditionType)
+		return nil
+	case machinev1.VMStateDeallocated, machinev1.VMStateStopped:
+		klog.Infof("%s: starting vm, annotation %s was removed", s.scope.Machine.Name, MachinePowerStateAnnotationName)
+		if err := s.writeVirtualMachine(ctx, &virtualmachines.PowerStateSpec{
+			Name:          s.scope.Machine.Name,
+			ResourceGroup: resourceGroup,
+		}); err != nil {
+			return err
 		}
 	}
 
-	klog.Infof("Provisioning state is '%s' for machine %s", *vm.ProvisioningState, s.scope.Machine.GetName())
-	return true, nil
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    powerStateConditionType,
+		Status:  metav1.ConditionFalse,
+		Reason:  startingReason,
+		Message: fmt.Sprintf("vm is %q, annotation %s was removed", vmState, MachinePowerStateAnnotationName),
+	})
+	return nil
 }
 
-// Delete reconciles all the services in pre determined order
-func (s *Reconciler) Delete(ctx context.Context) error {
-	vmSpec := &virtualmachines.Spec{
-		Name: s.scope.Machine.Name,
+// getDeallocationRequested returns whether the machine annotations request the VM to be deallocated.
+func (s *Reconciler) getDeallocationRequested() (bool, error) {
+	value, ok := s.scope.Machine.Annotations[MachinePowerStateAnnotationName]
+	if !ok {
+		return false, nil
 	}
 
-	// Getting a vm object does not work here so let's assume
-	// an instance is really being deleted
-	if s.scope.Machine.Annotations == nil {
-		s.scope.Machine.Annotations = make(map[string]string)
+	if !strings.EqualFold(value, string(machinev1.VMStateDeallocated)) {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s must be %s, got %q",
+			MachinePowerStateAnnotationName, machinev1.VMStateDeallocated, value)
 	}
-	s.scope.Machine.Annotations[MachineInstanceStateAnnotationName] = string(machinev1.VMStateDeleting)
-	vmStateDeleting := machinev1.VMStateDeleting
-	s.scope.MachineStatus.VMState = &vmStateDeleting
 
-	err := s.virtualMachinesSvc.Delete(ctx, vmSpec)
-	if err != nil {
-		return fmt.Errorf("failed to delete machine: %w", err)
+	// The power state of Azure Stack Hub VMs is not managed.
+	if s.scope.IsStackHub() {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachinePowerStateAnnotationName)
 	}
 
-	osDiskSpec := &disks.Spec{
-		Name: azure.GenerateOSDiskName(s.scope.Machine.Name),
+	return true, nil
+}
+
+// reconcileVMID updates the VM ID persisted in the provider status when it no longer matches the ID of
+// the live VM, e.g. after the VM was replaced out-of-band. It runs before any step of the update which
+// could fail, so that the provider status is not left stale.
+func (s *Reconciler) reconcileVMID(vm *decode.VirtualMachine) {
+	if vm.ID == nil {
+		return
 	}
-	err = s.disksSvc.Delete(ctx, osDiskSpec)
-	if err != nil {
-		metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
-			Name:      s.scope.Machine.Name,
-			Namespace: s.scope.Machine.Namespace,
-			Reason:    "failed to delete OS disk",
-		})
-		return fmt.Errorf("failed to delete OS disk: %w", err)
+
+	persistedID := s.scope.MachineStatus.VMID
+	if persistedID != nil && strings.EqualFold(*persistedID, *vm.ID) {
+		return
 	}
 
-	if s.scope.MachineConfig.Vnet == "" {
-		return fmt.Errorf("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name)
+	if persistedID != nil {
+		klog.Infof("%s: persisted vm ID %s does not match the ID %s of the live vm, updating it",
+			s.scope.Machine.Name, *persistedID, *vm.ID)
 	}
+	s.scope.MachineStatus.VMID = ptr.To(*vm.ID)
+}
 
-	networkInterfaceSpec := &networkinterfaces.Spec{
-		Name:     azure.GenerateNetworkInterfaceName(s.scope.Machine.Name),
-		VnetName: s.scope.MachineConfig.Vnet,
+// retryCanceledProvisioning resends the specification of a VM which an interrupted operation
+// left in the Canceled provisioning state, so that Azure resumes its provisioning. The number
+// of retries is tracked in an annotation and bounded by CanceledProvisioningRetries, after
+// which the machine is failed.
+func (s *Reconciler) retryCanceledProvisioning(ctx context.Context, vm *decode.VirtualMachine) error {
+	retries, _ := strconv.Atoi(s.scope.Machine.Annotations[MachineCanceledProvisioningRetriesAnnotationName])
+	if retries >= s.scope.CanceledProvisioningRetries {
+		return machinecontroller.InvalidMachineConfiguration("vm %s is in provisioning state %s after %d retries",
+			s.scope.Machine.Name, vmStateCanceled, retries)
 	}
 
-	err = s.networkInterfacesSvc.Delete(ctx, networkInterfaceSpec)
-	if err != nil {
-		metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
-			Name:      s.scope.Machine.Name,
-			Namespace: s.scope.Machine.Namespace,
-			Reason:    "failed to delete network interface",
-		})
-		return fmt.Errorf("Unable to delete network interface: %w", err)
+	retries++
+	if s.scope.Machine.Annotations == nil {
+		s.scope.Machine.Annotations = map[string]string{}
 	}
+	s.scope.Machine.Annotations[MachineCanceledProvisioningRetriesAnnotationName] = strconv.Itoa(retries)
 
-	if s.scope.MachineConfig.PublicIP {
-		publicIPName, err := azure.GenerateMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name)
-		if err != nil {
-			// Only when the generated name is longer than allowed by the Azure portal
-			// That can happen only when
-			// - machine name is changed (can't happen without creating a new CR)
-			// - cluster name is changed (could happen but then we will get different name anyway)
-			// - machine CR was created with too long public ip name (in which case no instance was created)
-			klog.Info("Generated public IP name was too long, skipping deletion of the resource")
-			return nil
-		}
+	if s.scope.EventRecorder != nil {
+		s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeWarning, "ProvisioningCanceled",
+			"Provisioning of vm %s was canceled, retrying (%d/%d)", s.scope.Machine.Name, retries, s.scope.CanceledProvisioningRetries)
+	}
 
-		err = s.publicIPSvc.Delete(ctx, &publicips.Spec{
-			Name: publicIPName,
-		})
-		if err != nil {
-			metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
-				Name:      s.scope.Machine.Name,
-				Namespace: s.scope.Machine.Namespace,
-				Reason:    "failed to delete Public IP",
-			})
-			return fmt.Errorf("unable to delete Public IP: %w", err)
-		}
+	asName := ""
+	if vm.AvailabilitySet != nil && vm.AvailabilitySet.ID != nil {
+		asName = path.Base(*vm.AvailabilitySet.ID)
 	}
 
-	// Delete the availability set with the given name if no virtual machines are attached to it.
-	if err := s.availabilitySetsSvc.Delete(ctx, &availabilitysets.Spec{
-		Name: s.getAvailabilitySetName(),
-	}); err != nil {
-		return fmt.Errorf("failed to delete availability set: %w", err)
+	nic, err := s.getNetworkInterfaceRef()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	if err := s.createOrUpdateVirtualMachine(ctx, nic.name, asName); err != nil {
+		return fmt.Errorf("failed to retry provisioning of vm %s: %w", s.scope.Machine.Name, err)
+	}
+
+	return fmt.Errorf("vm %s was in provisioning state %s, retried provisioning (%d/%d)",
+		s.scope.Machine.Name, vmStateCanceled, retries, s.scope.CanceledProvisioningRetries)
 }
 
-func (s *Reconciler) getZone(ctx context.Context) (string, error) {
-	return s.scope.MachineConfig.Zone, nil
+// reconcileIdentity records the user-assigned identity assigned to the VM from the provider spec of
+// the machine, and removes it from the VM once the managed identity is removed from the provider spec.
+// Identities assigned to the VM by other means are left alone.
+func (s *Reconciler) reconcileIdentity(ctx context.Context, vm *decode.VirtualMachine, resourceGroup string) error {
+	// Identities are not configured on Azure Stack Hub VMs.
+	if s.scope.IsStackHub() {
+		return nil
+	}
+
+	currentType := ""
+	currentUserAssignedIdentities := []string{}
+	if vm.Identity != nil {
+		currentType = vm.Identity.Type
+		for id := range vm.Identity.UserAssignedIdentities {
+			currentUserAssignedIdentities = append(currentUserAssignedIdentities, id)
+		}
+	}
+
+	if s.scope.MachineConfig.ManagedIdentity != "" {
+		managedIdentity := azure.GenerateManagedIdentityName(s.scope.SubscriptionID, s.scope.MachineConfig.ResourceGroup, s.scope.MachineConfig.ManagedIdentity)
+		for _, id := range currentUserAssignedIdentities {
+			if strings.EqualFold(id, managedIdentity) {
+				if s.scope.Machine.Annotations == nil {
+					s.scope.Machine.Annotations = make(map[string]string)
+				}
+				s.scope.Machine.Annotations[MachineAssignedIdentityAnnotationName] = id
+				break
+			}
+		}
+		return nil
+	}
+
+	assignedIdentity := s.scope.Machine.Annotations[MachineAssignedIdentityAnnotationName]
+	if assignedIdentity == "" {
+		return nil
+	}
+
+	identity := virtualmachines.GenerateUserAssignedIdentityRemoval(currentType, currentUserAssignedIdentities, assignedIdentity)
+	if identity != nil {
+		klog.Infof("%s: removing user-assigned identity %s from vm, updating identity type to %q", s.scope.Machine.Name, assignedIdentity, identity.Type)
+		if err := s.writeVirtualMachine(ctx, &virtualmachines.IdentitySpec{
+			Name:          s.scope.Machine.Name,
+			Identity:      identity,
+			ResourceGroup: resourceGroup,
+		}); err != nil {
+			return err
+		}
+	}
+
+	delete(s.scope.Machine.Annotations, MachineAssignedIdentityAnnotationName)
+	return nil
 }
 
-func (s *Reconciler) createNetworkInterface(ctx context.Context, nicName string) error {
-	if s.scope.MachineConfig.Vnet == "" {
-		return machinecontroller.InvalidMachineConfiguration("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name)
+// reconcileDataDisksDeletionPolicy updates the delete option of the data disks attached to the VM
+// whose deletion policy has been changed in the provider spec of the machine.
+func (s *Reconciler) reconcileDataDisksDeletionPolicy(ctx context.Context, vm *decode.VirtualMachine, resourceGroup string) error {
+	// The delete option of data disks is not supported on Azure Stack Hub.
+	if s.scope.IsStackHub() || vm.VirtualMachineProperties == nil || vm.StorageProfile == nil || vm.StorageProfile.DataDisks == nil {
+		return nil
 	}
-	networkInterfaceSpec := &networkinterfaces.Spec{
-		Name:     nicName,
-		VnetName: s.scope.MachineConfig.Vnet,
+
+	currentDeleteOptions := map[string]string{}
+	for _, disk := range *vm.StorageProfile.DataDisks {
+		if disk.Name != nil {
+			currentDeleteOptions[*disk.Name] = disk.DeleteOption
+		}
 	}
-	if s.scope.MachineConfig.AcceleratedNetworking {
-		skuSpec := resourceskus.Spec{
+
+	deleteOptions := map[string]compute.DiskDeleteOptionTypes{}
+	for _, disk := range s.scope.MachineConfig.DataDisks {
+		dataDiskName := azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix)
+		currentDeleteOption, attached := currentDeleteOptions[dataDiskName]
+		if !attached || disk.DeletionPolicy == "" || strings.EqualFold(currentDeleteOption, string(disk.DeletionPolicy)) {
+			continue
+		}
+		deleteOptions[dataDiskName] = compute.DiskDeleteOptionTypes(disk.DeletionPolicy)
+	}
+
+	if len(deleteOptions) == 0 {
+		return nil
+	}
+
+	klog.Infof("%s: updating deletion policy of data disks %v", s.scope.Machine.Name, deleteOptions)
+	return s.writeVirtualMachine(ctx, &virtualmachines.DataDisksDeleteOptionSpec{
+		Name:          s.scope.Machine.Name,
+		DataDisks:     computeDataDisks(*vm.StorageProfile.DataDisks),
+		DeleteOptions: deleteOptions,
+		ResourceGroup: resourceGroup,
+	})
+}
+
+// computeDataDisks returns the data disks attached to the VM as sent to Azure, so that the VM already read
+// for the machine is updated without reading it again.
+func computeDataDisks(dataDisks []decode.DataDisk) []compute.DataDisk {
+	converted := make([]compute.DataDisk, 0, len(dataDisks))
+	for _, disk := range dataDisks {
+		dataDisk := compute.DataDisk{
+			Name:                    disk.Name,
+			Lun:                     disk.Lun,
+			DeleteOption:            compute.DiskDeleteOptionTypes(disk.DeleteOption),
+			CreateOption:            compute.DiskCreateOptionTypes(disk.CreateOption),
+			Caching:                 compute.CachingTypes(disk.Caching),
+			DiskSizeGB:              disk.DiskSizeGB,
+			WriteAcceleratorEnabled: disk.WriteAcceleratorEnabled,
+		}
+		if disk.ManagedDisk != nil {
+			dataDisk.ManagedDisk = &compute.ManagedDiskParameters{
+				ID:                 disk.ManagedDisk.ID,
+				StorageAccountType: compute.StorageAccountTypes(disk.ManagedDisk.StorageAccountType),
+			}
+			if disk.ManagedDisk.DiskEncryptionSet != nil {
+				dataDisk.ManagedDisk.DiskEncryptionSet = &compute.DiskEncryptionSetParameters{ID: disk.ManagedDisk.DiskEncryptionSet.ID}
+			}
+		}
+		converted = append(converted, dataDisk)
+	}
+	return converted
+}
+
+// reconcileTags patches the tags of the VM when any tag of the machine is missing from it or has a different value.
+// Only the tags are sent so that the rest of the VM is left as it is, and tags added to the VM by other means are kept.
+func (s *Reconciler) reconcileTags(ctx context.Context, vm *decode.VirtualMachine, resourceGroup string) error {
+	tags, changed := mergeTags(vm.Tags, s.scope.Tags)
+	if !changed {
+		return nil
+	}
+
+	klog.Infof("%s: updating vm tags", s.scope.Machine.Name)
+	return s.writeVirtualMachine(ctx, &virtualmachines.TagsSpec{
+		Name:          s.scope.Machine.Name,
+		Tags:          tags,
+		ResourceGroup: resourceGroup,
+	})
+}
+
+// mergeTags returns the current tags with the desired ones added or updated, and whether any of them changed.
+// Tag keys are compared case-insensitively as Azure does, the casing of the desired key wins on update.
+func mergeTags(current, desired map[string]*string) (map[string]*string, bool) {
+	merged := make(map[string]*string, len(current)+len(desired))
+	for key, value := range current {
+		merged[key] = value
+	}
+
+	changed := false
+	for key, value := range desired {
+		found := false
+		for currentKey, currentValue := range current {
+			if !strings.EqualFold(currentKey, key) {
+				continue
+			}
+			found = true
+			if ptr.Deref(currentValue, "") != ptr.Deref(value, "") {
+				delete(merged, currentKey)
+				merged[key] = value
+				changed = true
+			}
+		}
+		if !found {
+			merged[key] = value
+			changed = true
+		}
+	}
+
+	return merged, changed
+}
+
+// reconcileNetworkInterfaceSecurityGroups attaches and detaches the network security group and the application
+// security groups of the network interface to match the ones in the provider spec of the machine.
+func (s *Reconciler) reconcileNetworkInterfaceSecurityGroups(ctx context.Context, nicName string, nic *decode.NetworkInterface) error {
+	if networkInterfaceSecurityGroupsMatch(nic, s.scope.MachineConfig.SecurityGroup, s.scope.MachineConfig.ApplicationSecurityGroups) {
+		return nil
+	}
+
+	klog.Infof("%s: updating security groups of network interface %s", s.scope.Machine.Name, nicName)
+	if err := s.networkInterfacesSvc.CreateOrUpdate(ctx, &networkinterfaces.SecurityGroupsSpec{
+		Name:                          nicName,
+		SecurityGroupName:             s.scope.MachineConfig.SecurityGroup,
+		ApplicationSecurityGroupNames: s.scope.MachineConfig.ApplicationSecurityGroups,
+	}); err != nil {
+		return err
+	}
+
+	if s.scope.EventRecorder != nil {
+		s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeNormal, "SecurityGroupsUpdated",
+			"Updated security groups of network interface %s", nicName)
+	}
+
+	return nil
+}
+
+// reconcileNetworkInterfaceAcceleratedNetworking enables or disables accelerated networking on the network
+// interface to match the provider spec of the machine. Azure only allows changing it while the VM is deallocated,
+// until then the difference is reported by a condition, as are the failures to change it.
+func (s *Reconciler) reconcileNetworkInterfaceAcceleratedNetworking(ctx context.Context, nicName string, nic *decode.NetworkInterface, vm *decode.VirtualMachine) {
+	enabled := s.scope.MachineConfig.AcceleratedNetworking
+	// Accelerated networking is not configured on Azure Stack Hub network interfaces.
+	if s.scope.IsStackHub() || nic.InterfacePropertiesFormat == nil || ptr.Deref(nic.EnableAcceleratedNetworking, false) == enabled {
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, acceleratedNetworkingDriftConditionType)
+		return
+	}
+
+	if vmState := getVMState(vm); vmState != machinev1.VMStateDeallocated {
+		s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+			Type:    acceleratedNetworkingDriftConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  vmNotDeallocatedReason,
+			Message: fmt.Sprintf("accelerated networking of network interface %s is changed to %v once the vm is deallocated, vm is %q", nicName, enabled, vmState),
+		})
+		return
+	}
+
+	if err := s.updateNetworkInterfaceAcceleratedNetworking(ctx, nicName, enabled); err != nil {
+		klog.Errorf("%s: failed to set accelerated networking of network interface %s to %v: %v", s.scope.Machine.Name, nicName, enabled, err)
+		s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+			Type:    acceleratedNetworkingDriftConditionType,
+			Status:  metav1.ConditionTrue,
+			Reason:  acceleratedNetworkingUpdateFailedReason,
+			Message: fmt.Sprintf("failed to set accelerated networking of network interface %s to %v: %v", nicName, enabled, err),
+		})
+		return
+	}
+
+	s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, acceleratedNetworkingDriftConditionType)
+}
+
+// updateNetworkInterfaceAcceleratedNetworking sets accelerated networking on the network interface, once the
+// VM size is known to support it when enabling it.
+func (s *Reconciler) updateNetworkInterfaceAcceleratedNetworking(ctx context.Context, nicName string, enabled bool) error {
+	if enabled {
+		skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
 			Name:         s.scope.MachineConfig.VMSize,
 			ResourceType: resourceskus.VirtualMachines,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", s.scope.MachineConfig.VMSize, err)
+		}
+
+		if !skuI.(resourceskus.SKU).HasCapability(resourceskus.AcceleratedNetworking) {
+			return fmt.Errorf("accelerated networking not supported on instance type: %v", s.scope.MachineConfig.VMSize)
+		}
+	}
+
+	klog.Infof("%s: setting accelerated networking of network interface %s to %v", s.scope.Machine.Name, nicName, enabled)
+	if err := s.networkInterfacesSvc.CreateOrUpdate(ctx, &networkinterfaces.AcceleratedNetworkingSpec{
+		Name:    nicName,
+		Enabled: enabled,
+	}); err != nil {
+		return err
+	}
+
+	if s.scope.EventRecorder != nil {
+		action := "Disabled"
+		if enabled {
+			action = "Enabled"
+		}
+		s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeNormal, "AcceleratedNetworkingUpdated",
+			"%s accelerated networking on network interface %s", action, nicName)
+	}
+
+	return nil
+}
+
+// networkInterfaceSecurityGroupsMatch compares, by name, the network security group of the network interface
+// and the application security groups of its primary IP configuration with the given ones.
+func networkInterfaceSecurityGroupsMatch(nic *decode.NetworkInterface, securityGroup string, applicationSecurityGroups []string) bool {
+	if nic.InterfacePropertiesFormat == nil {
+		return true
+	}
+
+	currentSecurityGroup := ""
+	if nic.NetworkSecurityGroup != nil && nic.NetworkSecurityGroup.ID != nil {
+		currentSecurityGroup = path.Base(*nic.NetworkSecurityGroup.ID)
+	}
+	if !strings.EqualFold(currentSecurityGroup, securityGroup) {
+		return false
+	}
+
+	currentApplicationSecurityGroups := sets.NewString()
+	if primaryIPConfig := primaryIPConfiguration(nic); primaryIPConfig != nil && primaryIPConfig.ApplicationSecurityGroups != nil {
+		for _, asg := range *primaryIPConfig.ApplicationSecurityGroups {
+			if asg.ID != nil {
+				currentApplicationSecurityGroups.Insert(strings.ToLower(path.Base(*asg.ID)))
+			}
+		}
+	}
+
+	expectedApplicationSecurityGroups := sets.NewString()
+	for _, name := range applicationSecurityGroups {
+		expectedApplicationSecurityGroups.Insert(strings.ToLower(name))
+	}
+
+	return currentApplicationSecurityGroups.Equal(expectedApplicationSecurityGroups)
+}
+
+// primaryIPConfiguration returns the properties of the primary IP configuration of the network interface,
+// the first one when none is flagged as primary.
+func primaryIPConfiguration(nic *decode.NetworkInterface) *decode.InterfaceIPConfigurationPropertiesFormat {
+	if nic.IPConfigurations == nil || len(*nic.IPConfigurations) == 0 {
+		return nil
+	}
+
+	for _, ipConfig := range *nic.IPConfigurations {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && ptr.Deref(ipConfig.Primary, false) {
+			return ipConfig.InterfaceIPConfigurationPropertiesFormat
+		}
+	}
+
+	return (*nic.IPConfigurations)[0].InterfaceIPConfigurationPropertiesFormat
+}
+
+// vmInitializingRequeueAfter is how long to wait before checking again on a VM without a provisioning state.
+const vmInitializingRequeueAfter = 20 * time.Second
+
+// requeueInitializingVM handles a VM returned by Azure without a provisioning state, which happens while
+// the VM is initializing. The machine is requeued until VMInitializationTimeout has passed since its creation,
+// after which the missing provisioning state is reported as an error.
+func (s *Reconciler) requeueInitializingVM() error {
+	age := time.Since(s.scope.Machine.CreationTimestamp.Time)
+	if age > s.scope.VMInitializationTimeout {
+		return fmt.Errorf("vm %s has a nil provisioning state %s after the creation of the machine, reconcile",
+			s.scope.Machine.Name, age.Round(time.Second))
+	}
+
+	klog.Infof("%s: vm has a nil provisioning state, assuming it is still initializing, requeuing in %s",
+		s.scope.Machine.Name, vmInitializingRequeueAfter)
+	return &machinecontroller.RequeueAfterError{RequeueAfter: vmInitializingRequeueAfter}
+}
+
+// recordProvisioningDuration observes the time since the creation of the machine started, the first time its VM is
+// seen in the Succeeded provisioning state, and removes the annotation so that the duration is observed only once.
+func (s *Reconciler) recordProvisioningDuration() {
+	value, ok := s.scope.Machine.Annotations[MachineProvisioningStartedAnnotationName]
+	if !ok {
+		return
+	}
+	delete(s.scope.Machine.Annotations, MachineProvisioningStartedAnnotationName)
+
+	started, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		klog.Warningf("%s: ignoring invalid annotation %s %q: %v", s.scope.Machine.Name, MachineProvisioningStartedAnnotationName, value, err)
+		return
+	}
+
+	duration := time.Since(started)
+	klog.V(2).Infof("%s: vm provisioned %s after the creation of the machine started", s.scope.Machine.Name, duration.Round(time.Second))
+	azuremetrics.ObserveProvisioningDuration(&azuremetrics.ProvisioningLabels{
+		Role:   s.scope.Role(),
+		VMSize: s.scope.MachineConfig.VMSize,
+	}, duration)
+}
+
+// vmStateCanceled is the provisioning state Azure leaves a VM in when an operation on it is interrupted.
+const vmStateCanceled = machinev1.AzureVMState("Canceled")
+
+// getVMProvisioningState returns the provisioning state of the VM, which is empty when Azure did not report it.
+func getVMProvisioningState(vm *decode.VirtualMachine) machinev1.AzureVMState {
+	if vm.VirtualMachineProperties == nil {
+		return ""
+	}
+	return machinev1.AzureVMState(ptr.Deref(vm.ProvisioningState, ""))
+}
+
+func getVMState(vm *decode.VirtualMachine) machinev1.AzureVMState {
+	if vm.VirtualMachineProperties == nil || vm.ProvisioningState == nil {
+		return ""
+	}
+
+	if *vm.ProvisioningState != "Succeeded" {
+		return machinev1.AzureVMState(*vm.ProvisioningState)
+	}
+
+	if vm.InstanceView == nil || vm.InstanceView.Statuses == nil {
+		return ""
+	}
+
+	// https://docs.microsoft.com/en-us/java/api/com.azure.resourcemanager.compute.models.powerstate
+	for _, status := range *vm.InstanceView.Statuses {
+		if status.Code == nil {
+			continue
+		}
+		switch *status.Code {
+		case "ProvisioningState/succeeded":
+			continue
+		case "PowerState/starting":
+			return machinev1.VMStateStarting
+		case "PowerState/running":
+			return machinev1.VMStateRunning
+		case "PowerState/stopping":
+			return machinev1.VMStateStopping
+		case "PowerState/stopped":
+			return machinev1.VMStateStopped
+		case "PowerState/deallocating":
+			return machinev1.VMStateDeallocating
+		case "PowerState/deallocated":
+			return machinev1.VMStateDeallocated
+		default:
+			return machinev1.VMStateUnknown
+		}
+	}
+
+	return ""
+}
+
+func (s *Reconciler) setMachineCloudProviderSpecifics(vm *decode.VirtualMachine) {
+	if s.scope.Machine.Labels == nil {
+		s.scope.Machine.Labels = make(map[string]string)
+	}
+
+	if s.scope.Machine.Annotations == nil {
+		s.scope.Machine.Annotations = make(map[string]string)
+	}
+
+	s.scope.Machine.Annotations[MachineInstanceStateAnnotationName] = string(getVMState(vm))
+
+	var availabilitySet, proximityPlacementGroup, host *decode.SubResource
+	if vm.VirtualMachineProperties != nil {
+		if vm.VirtualMachineProperties.HardwareProfile != nil {
+			s.scope.Machine.Labels[MachineInstanceTypeLabelName] = string(vm.VirtualMachineProperties.HardwareProfile.VMSize)
+		}
+
+		availabilitySet = vm.VirtualMachineProperties.AvailabilitySet
+		proximityPlacementGroup = vm.VirtualMachineProperties.ProximityPlacementGroup
+		host = vm.VirtualMachineProperties.Host
+	}
+
+	s.setPlacementAnnotation(MachinePlacedAvailabilitySetAnnotationName, availabilitySet)
+	s.setPlacementAnnotation(MachinePlacedProximityPlacementGroupAnnotationName, proximityPlacementGroup)
+	s.setPlacementAnnotation(MachinePlacedHostAnnotationName, host)
+	s.setImageVersionAnnotation(vm)
+
+	if vm.Location != nil {
+		s.scope.Machine.Labels[MachineRegionLabelName] = *vm.Location
+	}
+	if vm.Zones != nil {
+		s.scope.Machine.Labels[MachineAZLabelName] = strings.Join(*vm.Zones, ",")
+	}
+
+	if s.scope.MachineConfig.SpotVMOptions != nil {
+		// Label on the Machine so that an MHC can select spot instances
+		s.scope.Machine.Labels[machinecontroller.MachineInterruptibleInstanceLabelName] = ""
+
+		if s.scope.Machine.Spec.Labels == nil {
+			s.scope.Machine.Spec.Labels = make(map[string]string)
+		}
+		// Label on the Spec so that it is propogated to the Node
+		s.scope.Machine.Spec.Labels[machinecontroller.MachineInterruptibleInstanceLabelName] = ""
+	}
+}
+
+// setPlacementAnnotation records the resource ID of the placement the VM landed in, or removes the
+// annotation when the VM is no longer placed in one.
+func (s *Reconciler) setPlacementAnnotation(name string, placement *decode.SubResource) {
+	if placement == nil || placement.ID == nil || *placement.ID == "" {
+		delete(s.scope.Machine.Annotations, name)
+		return
+	}
+
+	s.scope.Machine.Annotations[name] = *placement.ID
+}
+
+// setImageVersionAnnotation records the exact version of the image the VM was created from, as resolved by Azure
+// when the image version is latest. The annotation is kept when Azure does not report the version, as the image
+// the VM booted from does not change.
+func (s *Reconciler) setImageVersionAnnotation(vm *decode.VirtualMachine) {
+	if vm.VirtualMachineProperties == nil || vm.StorageProfile == nil || vm.StorageProfile.ImageReference == nil {
+		return
+	}
+
+	if exactVersion := ptr.Deref(vm.StorageProfile.ImageReference.ExactVersion, ""); exactVersion != "" {
+		s.scope.Machine.Annotations[MachineImageVersionAnnotationName] = exactVersion
+	}
+}
+
+// getVirtualMachine returns the VM of the machine, which is only read from Azure when not cached yet.
+// Failed reads are not cached.
+func (s *Reconciler) getVirtualMachine(ctx context.Context) (interface{}, error) {
+	if s.vm != nil {
+		return s.vm, nil
+	}
+
+	vmInterface, err := s.virtualMachinesSvc.Get(ctx, &virtualmachines.Spec{Name: s.scope.Machine.Name, ResourceGroup: s.getCreatedResourceGroup()})
+	if err != nil {
+		return vmInterface, err
+	}
+
+	s.vm = vmInterface
+	return vmInterface, nil
+}
+
+// writeVirtualMachine creates or updates the VM of the machine and drops the cached VM, which no longer
+// reflects it.
+func (s *Reconciler) writeVirtualMachine(ctx context.Context, spec azure.Spec) error {
+	s.vm = nil
+	return s.virtualMachinesSvc.CreateOrUpdate(ctx, spec)
+}
+
+// Exists checks if machine exists
+func (s *Reconciler) Exists(ctx context.Context) (bool, error) {
+	vmInterface, err := s.getVirtualMachine(ctx)
+
+	if err != nil && azure.ResourceNotFound(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to get vm: %w", err)
+	}
+
+	vm, err := decode.GetVirtualMachine(vmInterface)
+	if err != nil {
+		return false, fmt.Errorf("returned incorrect vm interface: %v", err)
+	}
+
+	if vm.VirtualMachineProperties == nil || vm.ProvisioningState == nil {
+		klog.Infof("Provisioning state is not set for machine %s, vm is still initializing", s.scope.Machine.GetName())
+		return true, nil
+	}
+
+	switch machinev1.AzureVMState(*vm.ProvisioningState) {
+	case machinev1.VMStateDeleting:
+		return true, fmt.Errorf("vm for machine %s has unexpected 'Deleting' provisioning state", s.scope.Machine.GetName())
+	case machinev1.VMStateFailed:
+		klog.Infof("vm for machine %s has unexpected 'Failed' provisioning state", s.scope.Machine.GetName())
+		return false, &apierrors.UnexpectedObjectError{
+			Object: s.scope.Machine,
+		}
+	}
+
+	klog.Infof("Provisioning state is '%s' for machine %s", *vm.ProvisioningState, s.scope.Machine.GetName())
+	return true, nil
+}
+
+// Delete reconciles all the services in pre determined order
+func (s *Reconciler) Delete(ctx context.Context) error {
+	err := s.deleteResources(ctx, true)
+	if s.scope.DeletionVerificationEnabled {
+		s.reconcileResourcesOrphanedCondition(ctx, err == nil)
+	}
+	return err
+}
+
+// deleteResources deletes the virtual machine and the resources created with it. The OS disk is only kept
+// under the Detach deletion policy when the machine itself is deleted, a VM recreated for the machine would
+// otherwise conflict with the OS disk of the same name left behind.
+func (s *Reconciler) deleteResources(ctx context.Context, machineDeleted bool) error {
+	resourceGroup := s.getCreatedResourceGroup()
+	if resourceGroup != "" {
+		klog.Infof("Machine %s was created in resource group %s, deleting it from there instead of resource group %s",
+			s.scope.Machine.Name, resourceGroup, s.scope.MachineConfig.ResourceGroup)
+	}
+
+	vmSpec := &virtualmachines.Spec{
+		Name:          s.scope.Machine.Name,
+		ResourceGroup: resourceGroup,
+	}
+
+	// Getting a vm object does not work here so let's assume
+	// an instance is really being deleted
+	if s.scope.Machine.Annotations == nil {
+		s.scope.Machine.Annotations = make(map[string]string)
+	}
+	s.scope.Machine.Annotations[MachineInstanceStateAnnotationName] = string(machinev1.VMStateDeleting)
+	vmStateDeleting := machinev1.VMStateDeleting
+	s.scope.MachineStatus.VMState = &vmStateDeleting
+
+	s.vm = nil
+	err := s.virtualMachinesSvc.Delete(ctx, vmSpec)
+	if err != nil {
+		return fmt.Errorf("failed to delete machine: %w", err)
+	}
+
+	osDiskSpec := &disks.Spec{
+		Name:          azure.GenerateOSDiskName(s.scope.Machine.Name),
+		ResourceGroup: resourceGroup,
+	}
+	// An invalid deletion policy can not have been applied on creation, the OS disk is deleted as by default.
+	if osDiskDeletionPolicy, _ := s.getOSDiskDeletionPolicy(); machineDeleted && osDiskDeletionPolicy == machinev1.DiskDeletionPolicyTypeDetach {
+		klog.Infof("%s: keeping OS disk %s, its deletion policy is %s", s.scope.Machine.Name, osDiskSpec.Name, osDiskDeletionPolicy)
+	} else if err := s.disksSvc.Delete(ctx, osDiskSpec); err != nil {
+		metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
+			Name:      s.scope.Machine.Name,
+			Namespace: s.scope.Machine.Namespace,
+			Reason:    "failed to delete OS disk",
+		})
+		return fmt.Errorf("failed to delete OS disk: %w", err)
+	}
+
+	// Azure Stack Hub does not support the delete option of data disks, which are deleted with the
+	// virtual machine on public Azure, so the data disks with the Delete policy are deleted here.
+	if s.scope.IsStackHub() {
+		if err := s.deleteDataDisks(ctx, resourceGroup); err != nil {
+			metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
+				Name:      s.scope.Machine.Name,
+				Namespace: s.scope.Machine.Namespace,
+				Reason:    "failed to delete data disk",
+			})
+			return err
+		}
+	}
+
+	if s.scope.MachineConfig.Vnet == "" {
+		return fmt.Errorf("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name)
+	}
+
+	// The public IP is looked up before the network interface it is attached to is deleted.
+	publicIPName := ""
+	if s.scope.MachineConfig.PublicIP {
+		publicIPName = s.getAttachedPublicIPName(ctx, resourceGroup)
+	}
+
+	// Pre-existing network interfaces are managed by the user and outlive the machine.
+	if nicRef, userManaged := s.scope.Machine.Annotations[MachineNetworkInterfaceAnnotationName]; userManaged {
+		klog.Infof("Network interface %q of machine %s is user managed, skipping its deletion", nicRef, s.scope.Machine.Name)
+	} else {
+		networkInterfaceSpec := &networkinterfaces.Spec{
+			Name:          azure.GenerateNetworkInterfaceName(s.scope.Machine.Name),
+			VnetName:      s.scope.MachineConfig.Vnet,
+			ResourceGroup: resourceGroup,
+		}
+
+		err = s.networkInterfacesSvc.Delete(ctx, networkInterfaceSpec)
+		if err != nil {
+			metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
+				Name:      s.scope.Machine.Name,
+				Namespace: s.scope.Machine.Namespace,
+				Reason:    "failed to delete network interface",
+			})
+			return fmt.Errorf("Unable to delete network interface: %w", err)
+		}
+	}
+
+	if s.scope.MachineConfig.PublicIP {
+		err = s.publicIPSvc.Delete(ctx, &publicips.Spec{
+			Name:          publicIPName,
+			ResourceGroup: resourceGroup,
+		})
+		if err != nil {
+			metrics.RegisterFailedInstanceDelete(&metrics.MachineLabels{
+				Name:      s.scope.Machine.Name,
+				Namespace: s.scope.Machine.Namespace,
+				Reason:    "failed to delete Public IP",
+			})
+			return fmt.Errorf("unable to delete Public IP: %w", err)
+		}
+	}
+
+	// Delete the availability set generated for the machine if no virtual machines are attached to it.
+	// An availability set set in the machine config is managed by the user and left alone.
+	// An availability set which was already deleted, or never created, is not an error.
+	if s.scope.MachineConfig.AvailabilitySet == "" {
+		if err := s.availabilitySetsSvc.Delete(ctx, &availabilitysets.Spec{
+			Name:          s.getAvailabilitySetName(),
+			ResourceGroup: resourceGroup,
+		}); err != nil {
+			return fmt.Errorf("failed to delete availability set: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// getAttachedPublicIPName returns the name of the public IP attached to the network interface of the machine,
+// as the name generated for it depends on whether public IP name truncation was enabled when it was created.
+// When the network interface is user managed, can not be found or has no public IP, the generated name is
+// returned, truncated as names longer than 63 characters can only have been created truncated.
+func (s *Reconciler) getAttachedPublicIPName(ctx context.Context, resourceGroup string) string {
+	generatedName := azure.GenerateTruncatedMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name)
+	if _, userManaged := s.scope.Machine.Annotations[MachineNetworkInterfaceAnnotationName]; userManaged {
+		return generatedName
+	}
+
+	nicName := azure.GenerateNetworkInterfaceName(s.scope.Machine.Name)
+	nicInterface, err := s.networkInterfacesSvc.Get(ctx, &networkinterfaces.Spec{Name: nicName, ResourceGroup: resourceGroup})
+	if err != nil {
+		klog.Warningf("%s: unable to get network interface %s to look up its public IP, deleting public IP %s: %v", s.scope.Machine.Name, nicName, generatedName, err)
+		return generatedName
+	}
+	nic, err := decode.GetNetworkInterface(nicInterface)
+	if err != nil || nic.InterfacePropertiesFormat == nil {
+		return generatedName
+	}
+
+	for _, ipConfig := range ptr.Deref(nic.IPConfigurations, nil) {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && ipConfig.PublicIPAddress != nil && ipConfig.PublicIPAddress.ID != nil {
+			return path.Base(*ipConfig.PublicIPAddress.ID)
+		}
+	}
+	return generatedName
+}
+
+// machineResource is a resource of the machine checked to no longer exist once the machine is deleted.
+type machineResource struct {
+	kind string
+	name string
+	svc  azure.Service
+	spec azure.Spec
+}
+
+// getRemainingResources returns the resources deleted with the machine which still exist. Resources whose
+// existence can not be checked are logged and left out.
+func (s *Reconciler) getRemainingResources(ctx context.Context) []string {
+	resourceGroup := s.getCreatedResourceGroup()
+	resources := []machineResource{{
+		kind: "virtual machine",
+		name: s.scope.Machine.Name,
+		svc:  s.virtualMachinesSvc,
+		spec: &virtualmachines.Spec{Name: s.scope.Machine.Name, ResourceGroup: resourceGroup},
+	}}
+
+	if osDiskDeletionPolicy, _ := s.getOSDiskDeletionPolicy(); osDiskDeletionPolicy != machinev1.DiskDeletionPolicyTypeDetach {
+		osDiskName := azure.GenerateOSDiskName(s.scope.Machine.Name)
+		resources = append(resources, machineResource{kind: "OS disk", name: osDiskName, svc: s.disksSvc, spec: &disks.Spec{Name: osDiskName, ResourceGroup: resourceGroup}})
+	}
+
+	for _, disk := range s.scope.MachineConfig.DataDisks {
+		if disk.DeletionPolicy != machinev1.DiskDeletionPolicyTypeDelete {
+			continue
+		}
+		dataDiskName := azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix)
+		resources = append(resources, machineResource{kind: "data disk", name: dataDiskName, svc: s.disksSvc, spec: &disks.Spec{Name: dataDiskName, ResourceGroup: resourceGroup}})
+	}
+
+	if _, userManaged := s.scope.Machine.Annotations[MachineNetworkInterfaceAnnotationName]; !userManaged {
+		nicName := azure.GenerateNetworkInterfaceName(s.scope.Machine.Name)
+		resources = append(resources, machineResource{kind: "network interface", name: nicName, svc: s.networkInterfacesSvc, spec: &networkinterfaces.Spec{Name: nicName, ResourceGroup: resourceGroup}})
+	}
+
+	if s.scope.MachineConfig.PublicIP {
+		publicIPName := azure.GenerateTruncatedMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name)
+		resources = append(resources, machineResource{kind: "public IP", name: publicIPName, svc: s.publicIPSvc, spec: &publicips.Spec{Name: publicIPName, ResourceGroup: resourceGroup}})
+	}
+
+	var remaining []string
+	for _, resource := range resources {
+		_, err := resource.svc.Get(ctx, resource.spec)
+		if err == nil {
+			remaining = append(remaining, fmt.Sprintf("%s %q", resource.kind, resource.name))
+			continue
+		}
+
+		var detailedError autorest.DetailedError
+		if !errors.As(err, &detailedError) || detailedError.StatusCode != http.StatusNotFound {
+			klog.Warningf("%s: unable to check %s %q was deleted: %v", s.scope.Machine.Name, resource.kind, resource.name, err)
+		}
+	}
+	return remaining
+}
+
+// reconcileResourcesOrphanedCondition reports the resources deleted with the machine which still exist in a
+// condition, and in an event when the machine is deleted anyway so that they are left behind.
+func (s *Reconciler) reconcileResourcesOrphanedCondition(ctx context.Context, machineDeleted bool) {
+	remaining := s.getRemainingResources(ctx)
+	if len(remaining) == 0 {
+		s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, resourcesOrphanedConditionType)
+		return
+	}
+
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    resourcesOrphanedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  resourcesNotDeletedReason,
+		Message: fmt.Sprintf("resources of the machine remain after deleting it: %s", strings.Join(remaining, ", ")),
+	})
+
+	if machineDeleted && s.scope.EventRecorder != nil {
+		s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeWarning, "ResourcesOrphaned",
+			"Machine deleted while some of its resources remain, they have to be deleted manually: %s", strings.Join(remaining, ", "))
+	}
+}
+
+// deleteDataDisks deletes the data disks of the machine with the Delete deletion policy from the given
+// resource group, the ones with the Detach deletion policy outlive the machine.
+func (s *Reconciler) deleteDataDisks(ctx context.Context, resourceGroup string) error {
+	for _, disk := range s.scope.MachineConfig.DataDisks {
+		if disk.DeletionPolicy != machinev1.DiskDeletionPolicyTypeDelete {
+			continue
+		}
+		dataDiskName := azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix)
+		if err := s.disksSvc.Delete(ctx, &disks.Spec{Name: dataDiskName, ResourceGroup: resourceGroup}); err != nil {
+			return fmt.Errorf("failed to delete data disk %s: %w", dataDiskName, err)
+		}
+	}
+	return nil
+}
+
+// getCreatedResourceGroup returns the resource group the virtual machine of the machine was created in when
+// it is not the resource group of the provider spec, which may have changed since, or an empty string otherwise.
+// The existing virtual machine and the resources of the machine are read, updated and deleted there.
+func (s *Reconciler) getCreatedResourceGroup() string {
+	resourceGroup := resourceGroupFromProviderID(ptr.Deref(s.scope.Machine.Spec.ProviderID, ""))
+	if strings.EqualFold(resourceGroup, s.scope.MachineConfig.ResourceGroup) {
+		return ""
+	}
+	return resourceGroup
+}
+
+// resourceGroupFromProviderID returns the resource group of the virtual machine identified by a provider ID,
+// or an empty string when the provider ID is not the one of a virtual machine.
+func resourceGroupFromProviderID(providerID string) string {
+	id, err := autorestazure.ParseResourceID(strings.TrimPrefix(providerID, azureProviderIDPrefix))
+	if err != nil {
+		return ""
+	}
+	return id.ResourceGroup
+}
+
+func (s *Reconciler) getZone(ctx context.Context) (string, error) {
+	return s.scope.MachineConfig.Zone, nil
+}
+
+// networkInterfaceRef identifies the network interface of a machine.
+type networkInterfaceRef struct {
+	name string
+	// resourceGroup is empty for network interfaces in the resource group of the machine.
+	resourceGroup string
+	// userManaged is set for pre-existing network interfaces, which are neither created nor deleted with the machine.
+	userManaged bool
+}
+
+// getNetworkInterfaceRef returns the pre-existing network interface referenced, by name or by
+// resource ID, by the machine annotations, or the network interface generated for the machine.
+func (s *Reconciler) getNetworkInterfaceRef() (networkInterfaceRef, error) {
+	ref, ok := s.scope.Machine.Annotations[MachineNetworkInterfaceAnnotationName]
+	if !ok {
+		return networkInterfaceRef{name: azure.GenerateNetworkInterfaceName(s.scope.Machine.Name)}, nil
+	}
+
+	if ref == "" {
+		return networkInterfaceRef{}, machinecontroller.InvalidMachineConfiguration("annotation %s must not be empty", MachineNetworkInterfaceAnnotationName)
+	}
+
+	if !strings.HasPrefix(ref, "/") {
+		return networkInterfaceRef{name: ref, userManaged: true}, nil
+	}
+
+	id, err := autorestazure.ParseResourceID(ref)
+	if err != nil {
+		return networkInterfaceRef{}, machinecontroller.InvalidMachineConfiguration("invalid network interface %q: %v", ref, err)
+	}
+	if !strings.EqualFold(id.Provider, "Microsoft.Network") || !strings.EqualFold(id.ResourceType, "networkInterfaces") {
+		return networkInterfaceRef{}, machinecontroller.InvalidMachineConfiguration("invalid network interface %q: not the ID of a Microsoft.Network/networkInterfaces resource", ref)
+	}
+	if !strings.EqualFold(id.SubscriptionID, s.scope.SubscriptionID) {
+		return networkInterfaceRef{}, machinecontroller.InvalidMachineConfiguration("network interface %q must be in subscription %s of the machine", ref, s.scope.SubscriptionID)
+	}
+
+	return networkInterfaceRef{name: id.ResourceName, resourceGroup: id.ResourceGroup, userManaged: true}, nil
+}
+
+// getNetworkInterfaceVnet returns the name and the resource group of the virtual network of the subnet of the
+// network interface generated for the machine, the resource group is empty for the network resource group.
+func (s *Reconciler) getNetworkInterfaceVnet() (string, string, error) {
+	ref, ok := s.scope.Machine.Annotations[MachineNetworkInterfaceVnetAnnotationName]
+	if !ok {
+		return s.scope.MachineConfig.Vnet, "", nil
+	}
+
+	if _, userManaged := s.scope.Machine.Annotations[MachineNetworkInterfaceAnnotationName]; userManaged {
+		return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine with a pre-existing network interface set by annotation %s",
+			MachineNetworkInterfaceVnetAnnotationName, MachineNetworkInterfaceAnnotationName)
+	}
+
+	if ref == "" {
+		return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s must not be empty", MachineNetworkInterfaceVnetAnnotationName)
+	}
+
+	if !strings.HasPrefix(ref, "/") {
+		return ref, "", nil
+	}
+
+	id, err := autorestazure.ParseResourceID(ref)
+	if err != nil {
+		return "", "", machinecontroller.InvalidMachineConfiguration("invalid virtual network %q: %v", ref, err)
+	}
+	if !strings.EqualFold(id.Provider, "Microsoft.Network") || !strings.EqualFold(id.ResourceType, "virtualNetworks") {
+		return "", "", machinecontroller.InvalidMachineConfiguration("invalid virtual network %q: not the ID of a Microsoft.Network/virtualNetworks resource", ref)
+	}
+	if !strings.EqualFold(id.SubscriptionID, s.scope.SubscriptionID) {
+		return "", "", machinecontroller.InvalidMachineConfiguration("virtual network %q must be in subscription %s of the machine", ref, s.scope.SubscriptionID)
+	}
+
+	return id.ResourceName, id.ResourceGroup, nil
+}
+
+// getSecondaryPrivateIPs returns the number of dynamically allocated secondary private IPs, or the static
+// secondary private IPs, requested for the network interface of the machine by the machine annotations.
+func (s *Reconciler) getSecondaryPrivateIPs() (int, []string, error) {
+	value, ok := s.scope.Machine.Annotations[MachineSecondaryPrivateIPsAnnotationName]
+	if !ok {
+		return 0, nil, nil
+	}
+
+	if count, err := strconv.Atoi(value); err == nil {
+		if count < 0 {
+			return 0, nil, machinecontroller.InvalidMachineConfiguration("annotation %s must not be negative, got %d", MachineSecondaryPrivateIPsAnnotationName, count)
+		}
+		return count, nil, nil
+	}
+
+	var addresses []string
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if net.ParseIP(address) == nil {
+			return 0, nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a number or a comma separated list of IP addresses, got %q",
+				MachineSecondaryPrivateIPsAnnotationName, value)
+		}
+		addresses = append(addresses, address)
+	}
+
+	return 0, addresses, nil
+}
+
+// getDNSServers returns the DNS servers requested for the network interface of the machine by the
+// machine annotations.
+func (s *Reconciler) getDNSServers() ([]string, error) {
+	value, ok := s.scope.Machine.Annotations[MachineDNSServersAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+
+	var servers []string
+	for _, server := range strings.Split(value, ",") {
+		server = strings.TrimSpace(server)
+		if net.ParseIP(server) == nil {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of IP addresses, got %q",
+				MachineDNSServersAnnotationName, value)
+		}
+		servers = append(servers, server)
+	}
+
+	return servers, nil
+}
+
+// getIPForwarding returns whether IP forwarding is requested for the network interface of the machine by
+// the machine annotations.
+func (s *Reconciler) getIPForwarding() (bool, error) {
+	value, ok := s.scope.Machine.Annotations[MachineIPForwardingAnnotationName]
+	if !ok {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q", MachineIPForwardingAnnotationName, value)
+	}
+
+	return enabled, nil
+}
+
+// getStaticPrivateIP returns the static private IP, or the index of the static private IP and the range it
+// is counted from, requested for the network interface of the machine by the machine annotations.
+func (s *Reconciler) getStaticPrivateIP() (string, *int, string, error) {
+	value, ok := s.scope.Machine.Annotations[MachinePrivateIPAnnotationName]
+	ipRange, hasRange := s.scope.Machine.Annotations[MachinePrivateIPRangeAnnotationName]
+	if !ok {
+		if hasRange {
+			return "", nil, "", machinecontroller.InvalidMachineConfiguration("annotation %s requires annotation %s to be set to an index",
+				MachinePrivateIPRangeAnnotationName, MachinePrivateIPAnnotationName)
+		}
+		return "", nil, "", nil
+	}
+
+	if hasRange {
+		if _, _, err := net.ParseCIDR(ipRange); err != nil {
+			return "", nil, "", machinecontroller.InvalidMachineConfiguration("annotation %s must be a CIDR range, got %q",
+				MachinePrivateIPRangeAnnotationName, ipRange)
+		}
+	}
+
+	if index, err := strconv.Atoi(value); err == nil {
+		if index < 0 {
+			return "", nil, "", machinecontroller.InvalidMachineConfiguration("annotation %s must not be negative, got %d", MachinePrivateIPAnnotationName, index)
+		}
+		return "", &index, ipRange, nil
+	}
+
+	if net.ParseIP(value) == nil {
+		return "", nil, "", machinecontroller.InvalidMachineConfiguration("annotation %s must be an index or an IP address, got %q",
+			MachinePrivateIPAnnotationName, value)
+	}
+	if hasRange {
+		return "", nil, "", machinecontroller.InvalidMachineConfiguration("annotation %s requires annotation %s to be set to an index, got %q",
+			MachinePrivateIPRangeAnnotationName, MachinePrivateIPAnnotationName, value)
+	}
+
+	return value, nil, "", nil
+}
+
+// validateNetworkInterfaceExists makes sure a pre-existing network interface can be attached to the VM.
+func (s *Reconciler) validateNetworkInterfaceExists(ctx context.Context, nic networkInterfaceRef) error {
+	_, err := s.networkInterfacesSvc.Get(ctx, &networkinterfaces.Spec{
+		Name:          nic.name,
+		ResourceGroup: nic.resourceGroup,
+	})
+	if err != nil {
+		var detailedError autorest.DetailedError
+		if errors.As(err, &detailedError) && detailedError.StatusCode == http.StatusNotFound {
+			return machinecontroller.InvalidMachineConfiguration("network interface %s referenced by annotation %s not found", nic.name, MachineNetworkInterfaceAnnotationName)
+		}
+		return fmt.Errorf("failed to get network interface %s: %w", nic.name, err)
+	}
+	return nil
+}
+
+func (s *Reconciler) createNetworkInterface(ctx context.Context, nicName string) error {
+	if s.scope.MachineConfig.Vnet == "" {
+		return machinecontroller.InvalidMachineConfiguration("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name)
+	}
+	vnetName, vnetResourceGroup, err := s.getNetworkInterfaceVnet()
+	if err != nil {
+		return err
+	}
+	networkInterfaceSpec := &networkinterfaces.Spec{
+		Name:              nicName,
+		VnetName:          vnetName,
+		VnetResourceGroup: vnetResourceGroup,
+	}
+	if s.scope.MachineConfig.AcceleratedNetworking {
+		skuSpec := resourceskus.Spec{
+			Name:         s.scope.MachineConfig.VMSize,
+			ResourceType: resourceskus.VirtualMachines,
+		}
+
+		skuI, err := s.resourcesSkus.Get(ctx, skuSpec)
+		if err != nil {
+			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+				Name:      s.scope.Machine.Name,
+				Namespace: s.scope.Machine.Namespace,
+				Reason:    "failed to obtain instance type information",
+			})
+
+			if errors.Is(err, resourceskus.ErrResourceNotFound) {
+				return machinecontroller.InvalidMachineConfiguration("failed to obtain instance type information for VMSize '%s' from Azure: %s", skuSpec.Name, err)
+			} else {
+				return fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", skuSpec.Name, err)
+			}
+		}
+
+		sku := skuI.(resourceskus.SKU)
+
+		if !sku.HasCapability(resourceskus.AcceleratedNetworking) {
+			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+				Name:      s.scope.Machine.Name,
+				Namespace: s.scope.Machine.Namespace,
+				Reason:    fmt.Sprintf("accelerated networking not supported on instance type: %v", s.scope.MachineConfig.VMSize),
+			})
+			return machinecontroller.InvalidMachineConfiguration("accelerated networking not supported on instance type: %v", s.scope.MachineConfig.VMSize)
+		}
+		networkInterfaceSpec.AcceleratedNetworking = s.scope.MachineConfig.AcceleratedNetworking
+	}
+
+	if s.scope.MachineConfig.Subnet == "" {
+		return machinecontroller.InvalidMachineConfiguration("MachineConfig subnet is missing on machine %s, skipping machine creation", s.scope.Machine.Name)
+	}
+
+	networkInterfaceSpec.SubnetName = s.scope.MachineConfig.Subnet
+
+	secondaryIPCount, secondaryIPAddresses, err := s.getSecondaryPrivateIPs()
+	if err != nil {
+		return err
+	}
+	networkInterfaceSpec.SecondaryIPCount = secondaryIPCount
+	networkInterfaceSpec.SecondaryIPAddresses = secondaryIPAddresses
+
+	staticIPAddress, staticIPIndex, staticIPRange, err := s.getStaticPrivateIP()
+	if err != nil {
+		return err
+	}
+	networkInterfaceSpec.StaticIPAddress = staticIPAddress
+	networkInterfaceSpec.StaticIPIndex = staticIPIndex
+	networkInterfaceSpec.StaticIPRange = staticIPRange
+
+	dnsServers, err := s.getDNSServers()
+	if err != nil {
+		return err
+	}
+	networkInterfaceSpec.DNSServers = dnsServers
+
+	ipForwarding, err := s.getIPForwarding()
+	if err != nil {
+		return err
+	}
+	networkInterfaceSpec.IPForwarding = ipForwarding
+
+	if s.scope.MachineConfig.PublicLoadBalancer != "" {
+		networkInterfaceSpec.PublicLoadBalancerName = s.scope.MachineConfig.PublicLoadBalancer
+		if s.scope.MachineConfig.NatRule != nil {
+			networkInterfaceSpec.NatRule = s.scope.MachineConfig.NatRule
+		}
+	}
+	if s.scope.MachineConfig.InternalLoadBalancer != "" {
+		networkInterfaceSpec.InternalLoadBalancerName = s.scope.MachineConfig.InternalLoadBalancer
+	}
+
+	if s.scope.MachineConfig.SecurityGroup != "" {
+		networkInterfaceSpec.SecurityGroupName = s.scope.MachineConfig.SecurityGroup
+	}
+
+	if len(s.scope.MachineConfig.ApplicationSecurityGroups) > 0 {
+		networkInterfaceSpec.ApplicationSecurityGroupNames = s.scope.MachineConfig.ApplicationSecurityGroups
+	}
+
+	if s.scope.MachineConfig.PublicIP {
+		if err := s.validateNewPublicIPSKU(); err != nil {
+			return err
+		}
+		if err := s.validatePublicIPSubnet(ctx, networkInterfaceSpec); err != nil {
+			return err
+		}
+		publicIPName, err := s.createPublicIP(ctx)
+		if err != nil {
+			return err
+		}
+		networkInterfaceSpec.PublicIP = publicIPName
+	}
+
+	if s.scope.ExistingNetworkInterfacesPreserved {
+		preserved, err := s.preserveDriftedNetworkInterface(ctx, networkInterfaceSpec)
+		if err != nil {
+			return err
+		}
+		if preserved {
+			return nil
+		}
+	}
+
+	err = s.networkInterfacesSvc.CreateOrUpdate(ctx, networkInterfaceSpec)
+	if err != nil {
+		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+			Name:      s.scope.Machine.Name,
+			Namespace: s.scope.Machine.Namespace,
+			Reason:    "failed to create VM network interface",
+		})
+		return fmt.Errorf("unable to create VM network interface: %w", err)
+	}
+	s.scope.MachineStatus.Conditions = removeCondition(s.scope.MachineStatus.Conditions, networkInterfaceConfigDriftConditionType)
+
+	return err
+}
+
+// createPublicIP creates or updates the public IP address of the machine and returns its name.
+func (s *Reconciler) createPublicIP(ctx context.Context) (string, error) {
+	publicIPName, err := s.getPublicIPName()
+	if err != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("unable to create Public IP: %v", err)
+	}
+	domainNameLabel, idleTimeoutInMinutes, err := s.getPublicIPDNSSettings()
+	if err != nil {
+		return "", err
+	}
+	sku, allocationMethod, err := s.getPublicIPSKUAndAllocationMethod()
+	if err != nil {
+		return "", err
+	}
+	version, err := s.getPublicIPVersion(sku, allocationMethod)
+	if err != nil {
+		return "", err
+	}
+	zones, err := s.getPublicIPZones(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = s.publicIPSvc.CreateOrUpdate(ctx, &publicips.Spec{
+		Name:                 publicIPName,
+		DomainNameLabel:      domainNameLabel,
+		IdleTimeoutInMinutes: idleTimeoutInMinutes,
+		SKU:                  sku,
+		AllocationMethod:     allocationMethod,
+		Version:              version,
+		Zones:                zones,
+	})
+	if err != nil {
+		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+			Name:      s.scope.Machine.Name,
+			Namespace: s.scope.Machine.Namespace,
+			Reason:    "failed to create public IP",
+		})
+		return "", fmt.Errorf("unable to create Public IP: %w", err)
+	}
+	return publicIPName, nil
+}
+
+// validatePublicIPSubnet makes sure an IPv6 public IP can be attached to the network interface before the
+// public IP is created, as it requires the subnet of the network interface to have an IPv6 address space.
+func (s *Reconciler) validatePublicIPSubnet(ctx context.Context, nicSpec *networkinterfaces.Spec) error {
+	sku, allocationMethod, err := s.getPublicIPSKUAndAllocationMethod()
+	if err != nil {
+		return err
+	}
+	version, err := s.getPublicIPVersion(sku, allocationMethod)
+	if err != nil {
+		return err
+	}
+	if version != network.IPVersionIPv6 {
+		return nil
+	}
+
+	prefixes, err := s.getSubnetPrefixes(ctx, nicSpec)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range prefixes {
+		if ip, _, err := net.ParseCIDR(prefix); err == nil && ip.To4() == nil {
+			return nil
+		}
+	}
+	return machinecontroller.InvalidMachineConfiguration("public IP version %s requires subnet %s to have an IPv6 address space", network.IPVersionIPv6, nicSpec.SubnetName)
+}
+
+// getSubnetPrefixes returns the address prefixes of the subnet of the network interface.
+func (s *Reconciler) getSubnetPrefixes(ctx context.Context, nicSpec *networkinterfaces.Spec) ([]string, error) {
+	subnetInterface, err := s.subnetsSvc.Get(ctx, &subnets.Spec{Name: nicSpec.SubnetName, VnetName: nicSpec.VnetName, ResourceGroup: nicSpec.VnetResourceGroup})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subnet %s: %w", nicSpec.SubnetName, err)
+	}
+	subnet, err := decode.GetSubnet(subnetInterface)
+	if err != nil {
+		return nil, fmt.Errorf("subnet get returned invalid subnet, getting %T instead", subnetInterface)
+	}
+
+	var prefixes []string
+	if subnet.SubnetPropertiesFormat != nil {
+		if subnet.AddressPrefix != nil {
+			prefixes = append(prefixes, *subnet.AddressPrefix)
+		}
+		prefixes = append(prefixes, ptr.Deref(subnet.AddressPrefixes, nil)...)
+	}
+	return prefixes, nil
+}
+
+// preserveDriftedNetworkInterface checks whether the network interface already exists with a configuration
+// differing from the spec, in which case it is left as it is and a condition listing the differences is set.
+// It returns false when the network interface does not exist or matches the spec, so that it is written.
+func (s *Reconciler) preserveDriftedNetworkInterface(ctx context.Context, nicSpec *networkinterfaces.Spec) (bool, error) {
+	nicInterface, err := s.networkInterfacesSvc.Get(ctx, &networkinterfaces.Spec{Name: nicSpec.Name})
+	if err != nil {
+		var detailedError autorest.DetailedError
+		if errors.As(err, &detailedError) && detailedError.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get network interface %s: %w", nicSpec.Name, err)
+	}
+
+	nic, err := decode.GetNetworkInterface(nicInterface)
+	if err != nil {
+		return false, fmt.Errorf("network interfaces get returned invalid network interface, getting %T instead", nicInterface)
+	}
+
+	// A static private IP set by index is resolved against the subnet to be compared.
+	staticIPAddress := nicSpec.StaticIPAddress
+	if nicSpec.StaticIPIndex != nil {
+		prefixes, err := s.getSubnetPrefixes(ctx, nicSpec)
+		if err != nil {
+			return false, err
+		}
+		staticIPAddress, err = networkinterfaces.ResolveStaticIPAddress(nicSpec, prefixes)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	drift := networkInterfaceConfigDrift(nicSpec, staticIPAddress, nic)
+	if len(drift) == 0 {
+		return false, nil
+	}
+
+	klog.Warningf("%s: network interface %s differs from the machine in %s, leaving it as it is", s.scope.Machine.Name, nicSpec.Name, strings.Join(drift, ", "))
+	s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, metav1.Condition{
+		Type:    networkInterfaceConfigDriftConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  existingConfigPreservedReason,
+		Message: fmt.Sprintf("existing network interface %s was not overwritten, it differs from the machine in %s", nicSpec.Name, strings.Join(drift, ", ")),
+	})
+	return true, nil
+}
+
+// networkInterfaceConfigDrift returns the fields managed by the machine which differ between the spec, with
+// its static private IP resolved, and the existing network interface.
+func networkInterfaceConfigDrift(nicSpec *networkinterfaces.Spec, staticIPAddress string, nic *decode.NetworkInterface) []string {
+	if nic.InterfacePropertiesFormat == nil {
+		return nil
+	}
+
+	drift := []string{}
+	if nicSpec.AcceleratedNetworking != ptr.Deref(nic.EnableAcceleratedNetworking, false) {
+		drift = append(drift, "accelerated networking")
+	}
+
+	securityGroup := ""
+	if nic.NetworkSecurityGroup != nil && nic.NetworkSecurityGroup.ID != nil {
+		securityGroup = path.Base(*nic.NetworkSecurityGroup.ID)
+	}
+	if !strings.EqualFold(nicSpec.SecurityGroupName, securityGroup) {
+		drift = append(drift, "security group")
+	}
+
+	var primary *decode.InterfaceIPConfigurationPropertiesFormat
+	for _, ipConfig := range ptr.Deref(nic.IPConfigurations, nil) {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && ptr.Deref(ipConfig.Primary, false) {
+			primary = ipConfig.InterfaceIPConfigurationPropertiesFormat
+		}
+	}
+	if primary == nil {
+		return drift
+	}
+
+	if staticIPAddress != "" && staticIPAddress != ptr.Deref(primary.PrivateIPAddress, "") {
+		drift = append(drift, "private IP address")
+	}
+
+	applicationSecurityGroups := sets.New[string]()
+	for _, asg := range ptr.Deref(primary.ApplicationSecurityGroups, nil) {
+		if asg.ID != nil {
+			applicationSecurityGroups.Insert(strings.ToLower(path.Base(*asg.ID)))
+		}
+	}
+	requestedApplicationSecurityGroups := sets.New[string]()
+	for _, name := range nicSpec.ApplicationSecurityGroupNames {
+		requestedApplicationSecurityGroups.Insert(strings.ToLower(name))
+	}
+	if !applicationSecurityGroups.Equal(requestedApplicationSecurityGroups) {
+		drift = append(drift, "application security groups")
+	}
+
+	return drift
+}
+
+// Validate runs the invalid machine configuration checks performed when creating the machine,
+// without creating, updating or deleting any Azure resources. All errors found are returned
+// as an aggregate so that callers, such as webhooks, can report them at once.
+func (s *Reconciler) Validate(ctx context.Context) error {
+	var errs []error
+
+	if s.scope.MachineConfig.Vnet == "" {
+		errs = append(errs, machinecontroller.InvalidMachineConfiguration("MachineConfig vnet is missing on machine %s", s.scope.Machine.Name))
+	}
+
+	if s.scope.MachineConfig.Subnet == "" {
+		errs = append(errs, machinecontroller.InvalidMachineConfiguration("MachineConfig subnet is missing on machine %s", s.scope.Machine.Name))
+	}
+
+	if err := validateAvailabilitySetAndZone(s.scope.MachineConfig); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, err := s.getAvailabilitySetDomainCounts(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.scope.MachineConfig.PublicIP {
+		if _, err := s.getPublicIPName(); err != nil {
+			errs = append(errs, machinecontroller.InvalidMachineConfiguration("unable to create Public IP: %v", err))
+		}
+	}
+
+	if _, _, err := s.getPublicIPDNSSettings(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if sku, allocationMethod, err := s.getPublicIPSKUAndAllocationMethod(); err != nil {
+		errs = append(errs, err)
+	} else if _, err := s.getPublicIPVersion(sku, allocationMethod); err != nil {
+		errs = append(errs, err)
+	} else if err := s.validateNewPublicIPSKU(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getPublicIPZonePlacement(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getDiagnosticsConfig(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := s.validateVMSize(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := s.validateConfidentialCompute(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	ephemeralOSDiskPlacement, err := s.getEphemeralOSDiskPlacement(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getOSDiskDeletionPolicy(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateDiskEncryptionSetIDs(s.scope.MachineConfig); err != nil {
+		errs = append(errs, err)
+	} else if err := s.validateDiskEncryptionSetLocations(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := s.validateStorageAccountTypes(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Only the disks of new machines are checked against their zone, so that existing machines keep working.
+	if s.scope.Machine.Spec.ProviderID == nil {
+		if zone, err := s.getZone(ctx); err == nil {
+			if err := s.validateStorageAccountTypesForZone(ctx, zone); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if _, err := s.getNetworkInterfaceRef(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, err := s.getNetworkInterfaceVnet(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, err := s.getSecondaryPrivateIPs(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, _, err := s.getStaticPrivateIP(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getDNSServers(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getIPForwarding(); err != nil {
+		errs = append(errs, err)
+	}
+
+	dataDisksFromImage, err := s.getDataDisksFromImage(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	attachedDataDisks, err := s.getAttachedDataDisks(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getUltraDiskPerformance(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getDiskBursting(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, err := s.getWriteAcceleratedDisks(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	evictionPolicy, err := s.getSpotEvictionPolicy()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getProximityPlacementGroupID(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getRegional(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getDeallocationRequested(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := s.getHibernationEnabled(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, err := s.getVMUserData(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.scope.MachineConfig.CapacityReservationGroupID != "" {
+		if err := validateAzureCapacityReservationGroupID(s.scope.MachineConfig.CapacityReservationGroupID); err != nil {
+			errs = append(errs, machinecontroller.InvalidMachineConfiguration("invalid capacityReservationGroupID: %v", err))
+		} else if zone, err := s.getZone(ctx); err == nil {
+			if err := s.validateCapacityReservation(ctx, s.scope.MachineConfig.CapacityReservationGroupID, zone); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	vmService := &virtualmachines.Service{Scope: s.scope}
+	if err := vmService.ValidateSpec(&virtualmachines.Spec{
+		Name:                     s.scope.Machine.Name,
+		OSDisk:                   s.scope.MachineConfig.OSDisk,
+		DataDisks:                s.getDataDisks(),
+		Image:                    s.scope.MachineConfig.Image,
+		SecurityProfile:          s.scope.MachineConfig.SecurityProfile,
+		AdminUsername:            s.scope.Machine.Annotations[MachineAdminUsernameAnnotationName],
+		DataDisksFromImage:       dataDisksFromImage,
+		AttachedDataDisks:        attachedDataDisks,
+		EvictionPolicy:           evictionPolicy,
+		EphemeralOSDiskPlacement: ephemeralOSDiskPlacement,
+	}); err != nil {
+		var agg utilerrors.Aggregate
+		if errors.As(err, &agg) {
+			errs = append(errs, agg.Errors()...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// getEphemeralOSDiskPlacement returns the placement of the ephemeral OS disk requested by the machine annotations,
+// empty when not set. When the OS disk size is set, it checks the cache or resource disk of the VMSize is large
+// enough to hold the OS disk.
+func (s *Reconciler) getEphemeralOSDiskPlacement(ctx context.Context) (compute.DiffDiskPlacement, error) {
+	value, ok := s.scope.Machine.Annotations[MachineEphemeralOSDiskPlacementAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	if s.scope.MachineConfig.OSDisk.DiskSettings.EphemeralStorageLocation != "Local" {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s requires an ephemeral OS disk", MachineEphemeralOSDiskPlacementAnnotationName)
+	}
+
+	var placement compute.DiffDiskPlacement
+	for _, p := range compute.PossibleDiffDiskPlacementValues() {
+		if strings.EqualFold(value, string(p)) {
+			placement = p
+		}
+	}
+	if placement == "" {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q", MachineEphemeralOSDiskPlacementAnnotationName, compute.PossibleDiffDiskPlacementValues(), value)
+	}
+
+	diskSizeGB := int64(s.scope.MachineConfig.OSDisk.DiskSizeGB)
+	if diskSizeGB <= 0 {
+		return placement, nil
+	}
+
+	skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+		Name:         s.scope.MachineConfig.VMSize,
+		ResourceType: resourceskus.VirtualMachines,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", s.scope.MachineConfig.VMSize, err)
+	}
+
+	// The cache disk size is reported in bytes and the resource disk size in MB.
+	capability, requested := resourceskus.CachedDiskBytes, diskSizeGB*1024*1024*1024
+	if placement == compute.DiffDiskPlacementResourceDisk {
+		capability, requested = resourceskus.MaxResourceVolumeMB, diskSizeGB*1024
+	}
+
+	fits, err := skuI.(resourceskus.SKU).HasCapabilityWithCapacity(capability, requested)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain the %s of VMSize '%s': %w", capability, s.scope.MachineConfig.VMSize, err)
+	}
+	if !fits {
+		available, _ := skuI.(resourceskus.SKU).GetCapability(capability)
+		return "", machinecontroller.InvalidMachineConfiguration("OS disk of %d GB does not fit in the %s of VMSize '%s', its %s is %q",
+			diskSizeGB, placement, s.scope.MachineConfig.VMSize, capability, available)
+	}
+
+	return placement, nil
+}
+
+// validateVMSize checks that the VMSize of the machine is available in its location, so that
+// an unknown VMSize fails the machine early instead of requeueing on a generic VM create error.
+func (s *Reconciler) validateVMSize(ctx context.Context) error {
+	skuSpec := resourceskus.Spec{
+		Name:         s.scope.MachineConfig.VMSize,
+		ResourceType: resourceskus.VirtualMachines,
+	}
+
+	if _, err := s.resourcesSkus.Get(ctx, skuSpec); err != nil {
+		if errors.Is(err, resourceskus.ErrResourceNotFound) {
+			return machinecontroller.InvalidMachineConfiguration("VMSize '%s' is not available in location '%s': %s", skuSpec.Name, s.scope.Location(), err)
+		}
+		return fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", skuSpec.Name, err)
+	}
+
+	return nil
+}
+
+// registerInvalidInstanceCreate registers the failed creation of the instance of the machine with the reason
+// when the error is an invalid machine configuration. The validations record no metrics themselves, so that
+// Validate can run them without side effects.
+func (s *Reconciler) registerInvalidInstanceCreate(err error, reason string) {
+	var machineErr *machinecontroller.MachineError
+	if errors.As(err, &machineErr) && machineErr.Reason == machinev1.InvalidConfigurationMachineError {
+		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+			Name:      s.scope.Machine.Name,
+			Namespace: s.scope.Machine.Namespace,
+			Reason:    reason,
+		})
+	}
+}
+
+// validateMarketplaceImageTerms checks that the terms of the purchase plan of a marketplace image are accepted
+// for the subscription, so that the machine fails early with a hint instead of on a generic VM create error.
+func (s *Reconciler) validateMarketplaceImageTerms(ctx context.Context) error {
+	image := s.scope.MachineConfig.Image
+	// Azure Stack Hub has no marketplace ordering API.
+	if image.Type != machinev1.AzureImageTypeMarketplaceWithPlan || s.scope.IsStackHub() {
+		return nil
+	}
+	if image.Publisher == "" || image.Offer == "" || image.SKU == "" {
+		return nil
+	}
+
+	accepted, err := s.marketplaceSvc.Get(ctx, &marketplace.Spec{
+		Publisher: image.Publisher,
+		Offer:     image.Offer,
+		Plan:      image.SKU,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to validate the terms of image %s:%s:%s: %w", image.Publisher, image.Offer, image.SKU, err)
+	}
+	if accepted, ok := accepted.(bool); !ok || !accepted {
+		return machinecontroller.InvalidMachineConfiguration("the terms of image %s:%s:%s are not accepted for subscription %s, "+
+			"accept them with `az vm image terms accept --publisher %s --offer %s --plan %s --subscription %s`",
+			image.Publisher, image.Offer, image.SKU, s.scope.SubscriptionID,
+			image.Publisher, image.Offer, image.SKU, s.scope.SubscriptionID)
+	}
+	return nil
+}
+
+// validateConfidentialCompute checks that the VMSize of a confidential VM supports confidential compute.
+func (s *Reconciler) validateConfidentialCompute(ctx context.Context) error {
+	securityProfile := s.scope.MachineConfig.SecurityProfile
+	if securityProfile == nil || securityProfile.Settings.SecurityType != machinev1.SecurityTypesConfidentialVM {
+		return nil
+	}
+
+	skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+		Name:         s.scope.MachineConfig.VMSize,
+		ResourceType: resourceskus.VirtualMachines,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", s.scope.MachineConfig.VMSize, err)
+	}
+
+	if _, ok := skuI.(resourceskus.SKU).GetCapability(resourceskus.ConfidentialComputingType); !ok {
+		return machinecontroller.InvalidMachineConfiguration("VMSize '%s' does not support confidential compute, which is required by SecurityType %s",
+			s.scope.MachineConfig.VMSize, machinev1.SecurityTypesConfidentialVM)
+	}
+
+	return nil
+}
+
+// recordSpotMaxPriceZero emits a warning event when the spot VM of the machine sets a max price of 0, which is
+// below any spot price so Azure never allocates the VM, unlike -1 or no max price which cap it at the on-demand price.
+func (s *Reconciler) recordSpotMaxPriceZero() {
+	spotVMOptions := s.scope.MachineConfig.SpotVMOptions
+	if s.scope.EventRecorder == nil || spotVMOptions == nil || spotVMOptions.MaxPrice == nil || !spotVMOptions.MaxPrice.IsZero() {
+		return
+	}
+
+	s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeWarning, "SpotMaxPriceZero",
+		"Spot VM has a max price of 0 which is below any spot price, set it to -1 or leave it unset to pay up to the on-demand price")
+}
+
+// recordAcceleratedNetworkingAvailable emits an informational event when the machine's
+// instance type supports accelerated networking but it has not been enabled.
+// Failures to look up the instance type are not fatal and only logged.
+func (s *Reconciler) recordAcceleratedNetworkingAvailable(ctx context.Context) {
+	if s.scope.EventRecorder == nil || s.scope.AcceleratedNetworkingEventsSuppressed {
+		return
+	}
+
+	skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+		Name:         s.scope.MachineConfig.VMSize,
+		ResourceType: resourceskus.VirtualMachines,
+	})
+	if err != nil {
+		klog.V(3).Infof("%s: unable to check accelerated networking support for VMSize %q: %v", s.scope.Machine.Name, s.scope.MachineConfig.VMSize, err)
+		return
+	}
+
+	if sku := skuI.(resourceskus.SKU); sku.HasCapability(resourceskus.AcceleratedNetworking) {
+		s.scope.EventRecorder.Eventf(s.scope.Machine, apicorev1.EventTypeNormal, "AcceleratedNetworkingAvailable",
+			"VMSize %s supports accelerated networking but it is not enabled on machine %q", s.scope.MachineConfig.VMSize, s.scope.Machine.Name)
+	}
+}
+
+// getPublicIPName returns the public IP name of the machine. Names longer than allowed by Azure
+// are either rejected or, when enabled, truncated with a hash suffix.
+func (s *Reconciler) getPublicIPName() (string, error) {
+	if s.scope.PublicIPNameTruncationEnabled {
+		return azure.GenerateTruncatedMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name), nil
+	}
+	return azure.GenerateMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name)
+}
+
+// publicIPDomainNameLabelRegexp matches valid Azure public IP DNS labels.
+var publicIPDomainNameLabelRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// getPublicIPDNSSettings returns the DNS label and idle timeout requested for the public IP of the machine
+// by the machine annotations, empty when not set.
+func (s *Reconciler) getPublicIPDNSSettings() (string, *int32, error) {
+	label, hasLabel := s.scope.Machine.Annotations[MachinePublicIPDomainNameLabelAnnotationName]
+	idleTimeout, hasIdleTimeout := s.scope.Machine.Annotations[MachinePublicIPIdleTimeoutAnnotationName]
+	if !hasLabel && !hasIdleTimeout {
+		return "", nil, nil
+	}
+
+	if !s.scope.MachineConfig.PublicIP {
+		annotation := MachinePublicIPDomainNameLabelAnnotationName
+		if !hasLabel {
+			annotation = MachinePublicIPIdleTimeoutAnnotationName
+		}
+		return "", nil, machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", annotation)
+	}
+
+	if hasLabel && !publicIPDomainNameLabelRegexp.MatchString(label) {
+		return "", nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+			"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, label)
+	}
+
+	var idleTimeoutInMinutes *int32
+	if hasIdleTimeout {
+		minutes, err := strconv.ParseInt(idleTimeout, 10, 32)
+		if err != nil || minutes < 4 || minutes > 30 {
+			return "", nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a number of minutes between 4 and 30, got %q",
+				MachinePublicIPIdleTimeoutAnnotationName, idleTimeout)
+		}
+		idleTimeoutInMinutes = ptr.To(int32(minutes))
+	}
+
+	return label, idleTimeoutInMinutes, nil
+}
+
+// getPublicIPSKUAndAllocationMethod returns the SKU and allocation method requested for the public IP of the
+// machine by the machine annotations, empty when not set.
+func (s *Reconciler) getPublicIPSKUAndAllocationMethod() (network.PublicIPAddressSkuName, network.IPAllocationMethod, error) {
+	skuValue, hasSKU := s.scope.Machine.Annotations[MachinePublicIPSKUAnnotationName]
+	allocationMethodValue, hasAllocationMethod := s.scope.Machine.Annotations[MachinePublicIPAllocationMethodAnnotationName]
+	if !hasSKU && !hasAllocationMethod {
+		return "", "", nil
+	}
+
+	if !s.scope.MachineConfig.PublicIP {
+		annotation := MachinePublicIPSKUAnnotationName
+		if !hasSKU {
+			annotation = MachinePublicIPAllocationMethodAnnotationName
+		}
+		return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", annotation)
+	}
+
+	var sku network.PublicIPAddressSkuName
+	if hasSKU {
+		for _, v := range network.PossiblePublicIPAddressSkuNameValues() {
+			if strings.EqualFold(skuValue, string(v)) {
+				sku = v
+			}
+		}
+		if sku == "" {
+			return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPSKUAnnotationName, network.PossiblePublicIPAddressSkuNameValues(), skuValue)
+		}
+	}
+
+	var allocationMethod network.IPAllocationMethod
+	if hasAllocationMethod {
+		for _, v := range network.PossibleIPAllocationMethodValues() {
+			if strings.EqualFold(allocationMethodValue, string(v)) {
+				allocationMethod = v
+			}
+		}
+		if allocationMethod == "" {
+			return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPAllocationMethodAnnotationName, network.PossibleIPAllocationMethodValues(), allocationMethodValue)
+		}
+	}
+
+	// Standard public IPs are always statically allocated, Standard is the default SKU.
+	if sku != network.PublicIPAddressSkuNameBasic && allocationMethod == network.IPAllocationMethodDynamic {
+		return "", "", machinecontroller.InvalidMachineConfiguration("public IP SKU %s requires the %s allocation method",
+			network.PublicIPAddressSkuNameStandard, network.IPAllocationMethodStatic)
+	}
+
+	// The load balancers of the cluster are Standard, their backends can not have Basic public IPs.
+	if sku == network.PublicIPAddressSkuNameBasic && (s.scope.MachineConfig.PublicLoadBalancer != "" || s.scope.MachineConfig.InternalLoadBalancer != "") {
+		return "", "", machinecontroller.InvalidMachineConfiguration("public IP SKU %s can not be used by a machine in a load balancer backend pool",
+			network.PublicIPAddressSkuNameBasic)
+	}
+
+	return sku, allocationMethod, nil
+}
+
+// validateNewPublicIPSKU rejects the Basic public IP SKU for new machines, Azure no longer creates Basic
+// public IPs. Machines which already have a Basic public IP keep it.
+func (s *Reconciler) validateNewPublicIPSKU() error {
+	if s.scope.Machine.Spec.ProviderID != nil {
+		return nil
+	}
+
+	sku, _, err := s.getPublicIPSKUAndAllocationMethod()
+	if err != nil {
+		return err
+	}
+	if sku == network.PublicIPAddressSkuNameBasic {
+		return machinecontroller.InvalidMachineConfiguration("public IP SKU %s is retired and can not be used by new machines, use %s",
+			network.PublicIPAddressSkuNameBasic, network.PublicIPAddressSkuNameStandard)
+	}
+	return nil
+}
+
+// getPublicIPVersion returns the IP family requested for the public IP of the machine by the machine
+// annotations, empty when not set. Basic IPv6 public IPs only support the Dynamic allocation method.
+func (s *Reconciler) getPublicIPVersion(sku network.PublicIPAddressSkuName, allocationMethod network.IPAllocationMethod) (network.IPVersion, error) {
+	value, ok := s.scope.Machine.Annotations[MachinePublicIPVersionAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	if !s.scope.MachineConfig.PublicIP {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", MachinePublicIPVersionAnnotationName)
+	}
+
+	var version network.IPVersion
+	for _, v := range network.PossibleIPVersionValues() {
+		if strings.EqualFold(value, string(v)) {
+			version = v
+		}
+	}
+	if version == "" {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+			MachinePublicIPVersionAnnotationName, network.PossibleIPVersionValues(), value)
+	}
+
+	if version == network.IPVersionIPv6 && sku == network.PublicIPAddressSkuNameBasic && allocationMethod != network.IPAllocationMethodDynamic {
+		return "", machinecontroller.InvalidMachineConfiguration("public IP SKU %s requires the %s allocation method for %s",
+			network.PublicIPAddressSkuNameBasic, network.IPAllocationMethodDynamic, network.IPVersionIPv6)
+	}
+
+	return version, nil
+}
+
+// errVMProvisioningFailed is wrapped by the error returned when the VM failed provisioning and was deleted to be recreated.
+var errVMProvisioningFailed = errors.New("vm failed provisioning")
+
+// getVMProvisioningFailure returns the failure details Azure reports in the instance view of a VM
+// which failed provisioning, e.g. "ImageNotFound: The platform image is not available".
+func getVMProvisioningFailure(vm *decode.VirtualMachine) string {
+	if vm.InstanceView == nil || vm.InstanceView.Statuses == nil {
+		return "no failure details reported"
+	}
+
+	var failures []string
+	for _, status := range *vm.InstanceView.Statuses {
+		code := ptr.Deref(status.Code, "")
+		failedProvisioning := strings.HasPrefix(code, "ProvisioningState/failed")
+		if !failedProvisioning && !strings.EqualFold(ptr.Deref(status.Level, ""), string(compute.StatusLevelTypesError)) {
+			continue
+		}
+
+		// The failure code is the last segment of the status code, e.g. ProvisioningState/failed/ImageNotFound.
+		reason := ptr.Deref(status.DisplayStatus, code)
+		if i := strings.LastIndex(code, "/"); failedProvisioning && i >= 0 && code[i+1:] != "failed" {
+			reason = code[i+1:]
+		}
+		if message := ptr.Deref(status.Message, ""); message != "" {
+			reason = fmt.Sprintf("%s: %s", reason, message)
+		}
+		failures = append(failures, reason)
+	}
+
+	if len(failures) == 0 {
+		return "no failure details reported"
+	}
+	return strings.Join(failures, "; ")
+}
+
+func (s *Reconciler) createVirtualMachine(ctx context.Context, nicName, asName string) error {
+	vmInterface, err := s.getVirtualMachine(ctx)
+	if err != nil && vmInterface == nil {
+		// Only the disks of new VMs are checked against their zone, so that existing machines keep working.
+		zone, err := s.getZone(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get zone: %w", err)
+		}
+		if err := s.validateStorageAccountTypesForZone(ctx, zone); err != nil {
+			return fmt.Errorf("failed to validate disk storage account types: %w", err)
+		}
+		return s.createOrUpdateVirtualMachine(ctx, nicName, asName)
+	} else if err != nil {
+		return fmt.Errorf("failed to get vm: %w", err)
+	} else {
+		vm, err := decode.GetVirtualMachine(vmInterface)
+		if err != nil {
+			return fmt.Errorf("returned incorrect vm interface: %v", err)
+		}
+		if vm.VirtualMachineProperties == nil || vm.ProvisioningState == nil {
+			return s.requeueInitializingVM()
+		}
+
+		vmState := getVMState(vm)
+		s.scope.MachineStatus.VMID = vm.ID
+		s.scope.MachineStatus.VMState = &vmState
+
+		s.setMachineCloudProviderSpecifics(vm)
+
+		if *vm.ProvisioningState == "Failed" {
+			// Keep the failure reason, it is lost once the VM is deleted.
+			failure := getVMProvisioningFailure(vm)
+			klog.Infof("vm for machine %s failed provisioning: %s", s.scope.Machine.GetName(), failure)
+
+			// If VM failed provisioning, delete it so it can be recreated. The machine itself is not
+			// deleted, so its resources are not checked for orphans and its OS disk is deleted whatever
+			// its deletion policy.
+			err = s.deleteResources(ctx, false)
+			if err != nil {
+				return fmt.Errorf("failed to delete machine after vm failed provisioning with %s: %w", failure, err)
+			}
+			return fmt.Errorf("%w with %s, vm %s is deleted, retry creating in next reconcile", errVMProvisioningFailed, failure, s.scope.Machine.Name)
+		} else if *vm.ProvisioningState != "Succeeded" {
+			return fmt.Errorf("vm %s is still in provisioning state %s, reconcile", s.scope.Machine.Name, *vm.ProvisioningState)
+		}
+	}
+
+	return nil
+}
+
+// createOrUpdateVirtualMachine sends the full specification of the machine VM to Azure,
+// which either creates the VM or resumes the provisioning of an existing one.
+func (s *Reconciler) createOrUpdateVirtualMachine(ctx context.Context, nicName, asName string) error {
+	decoded, err := base64.StdEncoding.DecodeString(s.scope.MachineConfig.SSHPublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to decode ssh public key: %w", err)
+	}
+
+	zone, err := s.getZone(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get zone: %w", err)
+	}
+
+	diagnosticsProfile, err := s.getDiagnosticsConfig()
+	if err != nil {
+		return fmt.Errorf("failed to configure diagnostics profile: %w", err)
+	}
+
+	if err := s.validateVMSize(ctx); err != nil {
+		s.registerInvalidInstanceCreate(err, fmt.Sprintf("unknown instance type: %v", s.scope.MachineConfig.VMSize))
+		return err
+	}
+
+	if err := s.validateConfidentialCompute(ctx); err != nil {
+		s.registerInvalidInstanceCreate(err, fmt.Sprintf("confidential compute not supported on instance type: %v", s.scope.MachineConfig.VMSize))
+		return err
+	}
+
+	if err := s.validateMarketplaceImageTerms(ctx); err != nil {
+		s.registerInvalidInstanceCreate(err, "marketplace image terms not accepted")
+		return err
+	}
+
+	ephemeralOSDiskPlacement, err := s.getEphemeralOSDiskPlacement(ctx)
+	if err != nil {
+		return err
+	}
+
+	osDiskDeletionPolicy, err := s.getOSDiskDeletionPolicy()
+	if err != nil {
+		return err
+	}
+
+	if err := validateDiskEncryptionSetIDs(s.scope.MachineConfig); err != nil {
+		return fmt.Errorf("failed to validate disk encryption sets: %w", err)
+	}
+
+	if err := s.validateDiskEncryptionSetLocations(ctx); err != nil {
+		return fmt.Errorf("failed to validate disk encryption sets: %w", err)
+	}
+
+	if err := s.validateStorageAccountTypes(ctx); err != nil {
+		return fmt.Errorf("failed to validate disk storage account types: %w", err)
+	}
+
+	if s.scope.Machine.Labels == nil || s.scope.Machine.Labels[machinev1.MachineClusterIDLabel] == "" {
+		return fmt.Errorf("machine is missing %q label", machinev1.MachineClusterIDLabel)
+	}
+
+	dataDisksFromImage, err := s.getDataDisksFromImage(ctx)
+	if err != nil {
+		return err
+	}
+
+	attachedDataDisks, err := s.getAttachedDataDisks(ctx)
+	if err != nil {
+		return err
+	}
+
+	evictionPolicy, err := s.getSpotEvictionPolicy()
+	if err != nil {
+		return err
+	}
+
+	proximityPlacementGroupID, err := s.getProximityPlacementGroupID()
+	if err != nil {
+		return err
+	}
+
+	osDiskWriteAccelerated, writeAcceleratedDataDisks, err := s.getWriteAcceleratedDisks(ctx)
+	if err != nil {
+		return err
+	}
+
+	hibernationEnabled, err := s.getHibernationEnabled()
+	if err != nil {
+		return err
+	}
+
+	vmSpec := &virtualmachines.Spec{
+		Name:                s.scope.Machine.Name,
+		NICName:             nicName,
+		SSHKeyData:          string(decoded),
+		Size:                s.scope.MachineConfig.VMSize,
+		OSDisk:              s.scope.MachineConfig.OSDisk,
+		DataDisks:           s.getDataDisks(),
+		Image:               s.scope.MachineConfig.Image,
+		Zone:                zone,
+		Tags:                s.scope.Tags,
+		SecurityProfile:     s.scope.MachineConfig.SecurityProfile,
+		UltraSSDCapability:  s.scope.MachineConfig.UltraSSDCapability,
+		AvailabilitySetName: asName,
+		DiagnosticsProfile:  diagnosticsProfile,
+	}
+
+	vmSpec.DataDisksFromImage = dataDisksFromImage
+	vmSpec.AttachedDataDisks = attachedDataDisks
+	vmSpec.EvictionPolicy = evictionPolicy
+	vmSpec.ProximityPlacementGroupID = proximityPlacementGroupID
+	vmSpec.EphemeralOSDiskPlacement = ephemeralOSDiskPlacement
+	vmSpec.OSDiskDeletionPolicy = osDiskDeletionPolicy
+	vmSpec.OSDiskWriteAccelerated = osDiskWriteAccelerated
+	vmSpec.WriteAcceleratedDataDisks = writeAcceleratedDataDisks
+	vmSpec.HibernationEnabled = hibernationEnabled
+
+	nic, err := s.getNetworkInterfaceRef()
+	if err != nil {
+		return err
+	}
+	vmSpec.NICResourceGroup = nic.resourceGroup
+	vmSpec.AdminUsername = s.scope.Machine.Annotations[MachineAdminUsernameAnnotationName]
+
+	if s.scope.WindowsAdminPasswordSecretEnabled && compute.OperatingSystemTypes(s.scope.MachineConfig.OSDisk.OSType) == compute.OperatingSystemTypesWindows {
+		adminPassword, err := s.getOrCreateAdminPasswordSecret(ctx, vmSpec.AdminUsername)
+		if err != nil {
+			return fmt.Errorf("failed to store admin password: %w", err)
+		}
+		vmSpec.AdminPassword = adminPassword
+	}
+
+	if s.scope.MachineConfig.ManagedIdentity != "" {
+		vmSpec.ManagedIdentity = azure.GenerateManagedIdentityName(s.scope.SubscriptionID, s.scope.MachineConfig.ResourceGroup, s.scope.MachineConfig.ManagedIdentity)
+	}
+
+	if s.scope.MachineConfig.CapacityReservationGroupID != "" {
+		// Capacity reservations are not available on Azure Stack Hub.
+		if s.scope.IsStackHub() {
+			return machinecontroller.InvalidMachineConfiguration("capacityReservationGroupID is not supported on Azure Stack Hub")
+		}
+		if err = validateAzureCapacityReservationGroupID(s.scope.MachineConfig.CapacityReservationGroupID); err != nil {
+			return fmt.Errorf("failed to validate capacityReservationGroupID: %w", err)
+		}
+		if err = s.validateCapacityReservation(ctx, s.scope.MachineConfig.CapacityReservationGroupID, zone); err != nil {
+			return fmt.Errorf("failed to validate capacityReservationGroupID: %w", err)
+		}
+		vmSpec.CapacityReservationGroupID = s.scope.MachineConfig.CapacityReservationGroupID
+	}
+
+	customData, userData, err := s.getVMUserData()
+	if err != nil {
+		return err
+	}
+	vmSpec.CustomData = customData
+	vmSpec.UserData = userData
+
+	// If we get an AsynOpIncompleteError, this means the VM is being created and we completed the request successfully.
+	if err := s.writeVirtualMachine(ctx, vmSpec); err != nil && !errors.Is(err, autorestazure.NewAsyncOpIncompleteError("compute.VirtualMachinesCreateOrUpdateFuture")) {
+		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
+			Name:      s.scope.Machine.Name,
+			Namespace: s.scope.Machine.Namespace,
+			Reason:    "failed to create VM",
+		})
+
+		var detailedError autorest.DetailedError
+		if errors.As(err, &detailedError) && detailedError.Message == "Failure sending request" {
+			return machinecontroller.InvalidMachineConfiguration("failure sending request for machine %s: %v", s.scope.Machine.Name, err)
+		}
+
+		return fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	s.recordSpotMaxPriceZero()
+
+	// The security profile was already validated when creating the VM. The effective security type is
+	// recorded in the provider status, not in the conditions of the machine.
+	if securityType, err := virtualmachines.EffectiveSecurityType(vmSpec); err == nil {
+		s.scope.MachineStatus.Conditions = setCondition(s.scope.MachineStatus.Conditions, newSecurityTypeCondition(string(securityType)))
+	}
+
+	return nil
+}
+
+// User data modes set by MachineUserDataModeAnnotationName.
+const (
+	userDataModeCustomData = "CustomData"
+	userDataModeUserData   = "UserData"
+	userDataModeBoth       = "Both"
+)
+
+// maxUserDataSize is the maximum size in bytes Azure accepts for the base64 encoded custom data and user data of a VM.
+const maxUserDataSize = 64 * 1024
+
+// getVMUserData returns the base64 encoded payload of the user data secret to send as custom data and
+// as user data of the VM, as requested by the machine annotations.
+func (s *Reconciler) getVMUserData() (customData, userData string, err error) {
+	mode := userDataModeCustomData
+	if value, ok := s.scope.Machine.Annotations[MachineUserDataModeAnnotationName]; ok {
+		modes := []string{userDataModeCustomData, userDataModeUserData, userDataModeBoth}
+		mode = ""
+		for _, m := range modes {
+			if strings.EqualFold(value, m) {
+				mode = m
+			}
+		}
+		if mode == "" {
+			return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q", MachineUserDataModeAnnotationName, modes, value)
+		}
+	}
+
+	// Windows machines run their bootstrap script from the custom data.
+	if mode == userDataModeUserData && compute.OperatingSystemTypes(s.scope.MachineConfig.OSDisk.OSType) == compute.OperatingSystemTypesWindows {
+		return "", "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on Windows machines, which need the custom data",
+			MachineUserDataModeAnnotationName, userDataModeUserData)
+	}
+
+	data, err := s.getUserDataSecretPayload()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get custom script data: %w", err)
+	}
+	if len(data) == 0 {
+		return "", "", nil
+	}
+
+	// Azure applies the size limit to the base64 encoded payload.
+	encoded := base64.StdEncoding.EncodeToString(data)
+	if len(encoded) > maxUserDataSize {
+		return "", "", machinecontroller.InvalidMachineConfiguration("user data secret %s is %d bytes base64 encoded, more than the %d bytes Azure accepts",
+			s.scope.MachineConfig.UserDataSecret.Name, len(encoded), maxUserDataSize)
+	}
+
+	switch mode {
+	case userDataModeUserData:
+		return "", encoded, nil
+	case userDataModeBoth:
+		return encoded, encoded, nil
+	default:
+		return encoded, "", nil
+	}
+}
+
+// getUserDataSecretPayload returns the payload of the user data secret of the machine, nil when it has none.
+func (s *Reconciler) getUserDataSecretPayload() ([]byte, error) {
+	if s.scope.MachineConfig.UserDataSecret == nil {
+		return nil, nil
+	}
+	var userDataSecret apicorev1.Secret
+
+	if err := s.scope.CoreClient.Get(context.Background(), client.ObjectKey{Namespace: s.scope.Namespace(), Name: s.scope.MachineConfig.UserDataSecret.Name}, &userDataSecret); err != nil {
+		return nil, fmt.Errorf("error getting user data secret %s in namespace %s: %w", s.scope.MachineConfig.UserDataSecret.Name, s.scope.Namespace(), err)
+	}
+	data, exists := userDataSecret.Data["userData"]
+	if !exists {
+		return nil, fmt.Errorf("Secret %v/%v does not have userData field set. Thus, no user data applied when creating an instance.", s.scope.Namespace(), s.scope.MachineConfig.UserDataSecret.Name)
+	}
+
+	return data, nil
+}
+
+// adminPasswordSecretName returns the name of the secret holding the admin password of the machine.
+func adminPasswordSecretName(machineName string) string {
+	return fmt.Sprintf("%s-admin-password", machineName)
+}
+
+// getOrCreateAdminPasswordSecret returns the admin password stored in the admin password secret
+// of the machine. The secret is created with a newly generated password when it does not exist yet,
+// so that the password is generated only once, even when the VM creation has to be retried.
+func (s *Reconciler) getOrCreateAdminPasswordSecret(ctx context.Context, adminUsername string) (string, error) {
+	key := client.ObjectKey{Namespace: s.scope.Namespace(), Name: adminPasswordSecretName(s.scope.Machine.Name)}
+
+	var secret apicorev1.Secret
+	err := s.scope.CoreClient.Get(ctx, key, &secret)
+	if err == nil {
+		password, ok := secret.Data[apicorev1.BasicAuthPasswordKey]
+		if !ok || len(password) == 0 {
+			return "", fmt.Errorf("secret %v does not have %s field set", key, apicorev1.BasicAuthPasswordKey)
+		}
+		return string(password), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("error getting admin password secret %v: %w", key, err)
+	}
+
+	if adminUsername == "" {
+		adminUsername = azure.DefaultUserName
+	}
+
+	password, err := virtualmachines.GenerateRandomString(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random string: %w", err)
+	}
+
+	secret = apicorev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: machinev1.GroupVersion.String(),
+					Kind:       "Machine",
+					Name:       s.scope.Machine.Name,
+					UID:        s.scope.Machine.UID,
+				},
+			},
+		},
+		Type: apicorev1.SecretTypeBasicAuth,
+		Data: map[string][]byte{
+			apicorev1.BasicAuthUsernameKey: []byte(adminUsername),
+			apicorev1.BasicAuthPasswordKey: []byte(password),
+		},
+	}
+
+	if err := s.scope.CoreClient.Create(ctx, &secret); err != nil {
+		return "", fmt.Errorf("error creating admin password secret %v: %w", key, err)
+	}
+
+	return password, nil
+}
+
+// validateAvailabilitySetAndZone rejects machines placed both in an availability set and in a zone,
+// as an Azure VM can only be in one of them.
+func validateAvailabilitySetAndZone(config *machinev1.AzureMachineProviderSpec) error {
+	if config.AvailabilitySet != "" && config.Zone != "" {
+		return machinecontroller.InvalidMachineConfiguration("availabilitySet %q and zone %q cannot both be set, a VM can either be placed in an availability set or in a zone",
+			config.AvailabilitySet, config.Zone)
+	}
+	return nil
+}
+
+// validateGeneratedNames rejects machines for which the names of the network interface, public IP,
+// OS disk, data disks or availability set would exceed the Azure limits. All the names are checked,
+// so that they can be fixed at once instead of failing one resource after the other.
+func (s *Reconciler) validateGeneratedNames() error {
+	var problems []string
+
+	checkLength := func(kind, name string) {
+		if len(name) > azure.MaxResourceNameLength {
+			problems = append(problems, fmt.Sprintf("%s name %q is longer than %d characters", kind, name, azure.MaxResourceNameLength))
+		}
+	}
+
+	// The name of a user managed network interface is not generated, the interface must already exist.
+	if nic, err := s.getNetworkInterfaceRef(); err == nil && !nic.userManaged {
+		checkLength("network interface", nic.name)
+	}
+
+	if s.scope.MachineConfig.PublicIP {
+		if _, err := s.getPublicIPName(); err != nil {
+			problems = append(problems, fmt.Sprintf("unable to create Public IP: %v", err))
+		}
+	}
+
+	checkLength("OS disk", azure.GenerateOSDiskName(s.scope.Machine.Name))
+
+	for _, disk := range s.scope.MachineConfig.DataDisks {
+		checkLength("data disk", azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix))
+	}
+
+	checkLength("availability set", s.getPlacedAvailabilitySetName())
+
+	if len(problems) > 0 {
+		return machinecontroller.InvalidMachineConfiguration("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// getAvailabilitySetDomainCounts returns the fault and update domain counts requested for the availability set
+// of the machine by the machine annotations, nil when not set.
+func (s *Reconciler) getAvailabilitySetDomainCounts() (*int32, *int32, error) {
+	parse := func(annotation string) (*int32, error) {
+		value, ok := s.scope.Machine.Annotations[annotation]
+		if !ok {
+			return nil, nil
+		}
+		count, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || count < 1 {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a positive number, got %q", annotation, value)
+		}
+		return ptr.To(int32(count)), nil
+	}
+
+	faultDomainCount, err := parse(MachineAvailabilitySetFaultDomainCountAnnotationName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updateDomainCount, err := parse(MachineAvailabilitySetUpdateDomainCountAnnotationName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return faultDomainCount, updateDomainCount, nil
+}
+
+// getOSDiskDeletionPolicy returns the deletion policy of the OS disk requested by the machine annotations,
+// empty when not set.
+func (s *Reconciler) getOSDiskDeletionPolicy() (machinev1.DiskDeletionPolicyType, error) {
+	value, ok := s.scope.Machine.Annotations[MachineOSDiskDeletionPolicyAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	policies := []machinev1.DiskDeletionPolicyType{machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach}
+	for _, policy := range policies {
+		if !strings.EqualFold(value, string(policy)) {
+			continue
+		}
+		// Azure always deletes ephemeral OS disks with the VM.
+		if policy == machinev1.DiskDeletionPolicyTypeDetach && s.scope.MachineConfig.OSDisk.DiskSettings.EphemeralStorageLocation == "Local" {
+			return "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s for an ephemeral OS disk",
+				MachineOSDiskDeletionPolicyAnnotationName, machinev1.DiskDeletionPolicyTypeDetach)
+		}
+		return policy, nil
+	}
+	return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q", MachineOSDiskDeletionPolicyAnnotationName, policies, value)
+}
+
+// getProximityPlacementGroupID returns the resource ID of the proximity placement group requested for the VM
+// by the machine annotations, empty when not set.
+func (s *Reconciler) getProximityPlacementGroupID() (string, error) {
+	id, ok := s.scope.Machine.Annotations[MachineProximityPlacementGroupAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	resourceID, err := autorestazure.ParseResourceID(id)
+	if err != nil || !strings.EqualFold(resourceID.Provider, "Microsoft.Compute") || !strings.EqualFold(resourceID.ResourceType, "proximityPlacementGroups") {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be the resource ID of a proximity placement group, got %q", MachineProximityPlacementGroupAnnotationName, id)
+	}
+	return id, nil
+}
+
+// getSpotEvictionPolicy returns the eviction policy requested for the spot VM by the machine annotations,
+// empty when not set.
+func (s *Reconciler) getSpotEvictionPolicy() (compute.VirtualMachineEvictionPolicyTypes, error) {
+	value, ok := s.scope.Machine.Annotations[MachineSpotEvictionPolicyAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	if s.scope.MachineConfig.SpotVMOptions == nil {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s is only supported on spot machines", MachineSpotEvictionPolicyAnnotationName)
+	}
+
+	for _, evictionPolicy := range compute.PossibleVirtualMachineEvictionPolicyTypesValues() {
+		if strings.EqualFold(value, string(evictionPolicy)) {
+			return evictionPolicy, nil
+		}
+	}
+	return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q", MachineSpotEvictionPolicyAnnotationName, compute.PossibleVirtualMachineEvictionPolicyTypesValues(), value)
+}
+
+// getHibernationEnabled returns whether the hibernation capability of the VM is enabled by the machine
+// annotations, nil when not set.
+func (s *Reconciler) getHibernationEnabled() (*bool, error) {
+	value, ok := s.scope.Machine.Annotations[MachineHibernationEnabledAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q", MachineHibernationEnabledAnnotationName, value)
+	}
+
+	// Azure Stack Hub VMs have no hibernation capability.
+	if s.scope.IsStackHub() {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineHibernationEnabledAnnotationName)
+	}
+
+	return &enabled, nil
+}
+
+// getRegional returns whether the machine is requested to be regional by the machine annotations. A regional
+// machine has no zone and is never placed in an availability set, Azure places its VM in any zone of the region
+// and its public IP is zone-redundant, like the Standard load balancers the VM is a backend of.
+func (s *Reconciler) getRegional() (bool, error) {
+	value, ok := s.scope.Machine.Annotations[MachineRegionalAnnotationName]
+	if !ok {
+		return false, nil
+	}
+
+	regional, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q", MachineRegionalAnnotationName, value)
+	}
+	if !regional {
+		return false, nil
+	}
+
+	// Azure Stack Hub has no availability zones.
+	if s.scope.IsStackHub() {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineRegionalAnnotationName)
+	}
+
+	if s.scope.MachineConfig.Zone != "" {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine in zone %q",
+			MachineRegionalAnnotationName, s.scope.MachineConfig.Zone)
+	}
+
+	if s.scope.MachineConfig.AvailabilitySet != "" {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine in availability set %q",
+			MachineRegionalAnnotationName, s.scope.MachineConfig.AvailabilitySet)
+	}
+
+	// Basic public IPs can not be zone-redundant.
+	if sku, _, err := s.getPublicIPSKUAndAllocationMethod(); err == nil && sku == network.PublicIPAddressSkuNameBasic {
+		return false, machinecontroller.InvalidMachineConfiguration("annotation %s requires a %s public IP, got %s",
+			MachineRegionalAnnotationName, network.PublicIPAddressSkuNameStandard, sku)
+	}
+
+	return true, nil
+}
+
+// Public IP zone placements set by MachinePublicIPZonesAnnotationName.
+const (
+	publicIPZonePlacementZonal         = "Zonal"
+	publicIPZonePlacementZoneRedundant = "ZoneRedundant"
+	publicIPZonePlacementRegional      = "Regional"
+)
+
+// getPublicIPZonePlacement returns the zone placement requested for the public IP of the machine by the
+// machine annotations, or an empty string when the placement follows the one of the machine.
+func (s *Reconciler) getPublicIPZonePlacement() (string, error) {
+	value, ok := s.scope.Machine.Annotations[MachinePublicIPZonesAnnotationName]
+	if !ok {
+		return "", nil
+	}
+
+	if !s.scope.MachineConfig.PublicIP {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", MachinePublicIPZonesAnnotationName)
+	}
+
+	placements := []string{publicIPZonePlacementZonal, publicIPZonePlacementZoneRedundant, publicIPZonePlacementRegional}
+	var placement string
+	for _, p := range placements {
+		if strings.EqualFold(value, p) {
+			placement = p
+		}
+	}
+	if placement == "" {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q", MachinePublicIPZonesAnnotationName, placements, value)
+	}
+
+	if placement == publicIPZonePlacementRegional {
+		return placement, nil
+	}
+
+	// Azure Stack Hub has no availability zones.
+	if s.scope.IsStackHub() {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on Azure Stack Hub", MachinePublicIPZonesAnnotationName, placement)
+	}
+
+	// Basic public IPs can not be placed in zones.
+	if sku, _, err := s.getPublicIPSKUAndAllocationMethod(); err == nil && sku == network.PublicIPAddressSkuNameBasic {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on a %s public IP",
+			MachinePublicIPZonesAnnotationName, placement, network.PublicIPAddressSkuNameBasic)
+	}
+
+	if placement == publicIPZonePlacementZonal && s.scope.MachineConfig.Zone == "" {
+		return "", machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on a machine without a zone",
+			MachinePublicIPZonesAnnotationName, placement)
+	}
+
+	return placement, nil
+}
+
+// getPublicIPZones returns the zones of the public IP of the machine. Unless the machine annotations request
+// another placement, the public IP of a regional machine is in all the availability zones of the region, so that
+// it is zone-redundant, and the one of other machines is in none.
+func (s *Reconciler) getPublicIPZones(ctx context.Context) ([]string, error) {
+	placement, err := s.getPublicIPZonePlacement()
+	if err != nil {
+		return nil, err
+	}
+
+	switch placement {
+	case publicIPZonePlacementRegional:
+		return nil, nil
+	case "":
+		regional, err := s.getRegional()
+		if err != nil || !regional {
+			return nil, err
+		}
+	}
+
+	availabilityZones, err := s.availabilityZonesSvc.Get(ctx, &availabilityzones.Spec{
+		VMSize: s.scope.MachineConfig.VMSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityZonesSlice, ok := availabilityZones.([]string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", availabilityZones)
+	}
+
+	switch placement {
+	case publicIPZonePlacementZonal:
+		if !sets.New(availabilityZonesSlice...).Has(s.scope.MachineConfig.Zone) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s requires zone %q of the machine to be an availability zone of the region, available zones are %v",
+				MachinePublicIPZonesAnnotationName, s.scope.MachineConfig.Zone, availabilityZonesSlice)
+		}
+		return []string{s.scope.MachineConfig.Zone}, nil
+	case publicIPZonePlacementZoneRedundant:
+		if len(availabilityZonesSlice) == 0 {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s in a region without availability zones",
+				MachinePublicIPZonesAnnotationName, placement)
+		}
+	}
+
+	if len(availabilityZonesSlice) == 0 {
+		return nil, nil
+	}
+	return availabilityZonesSlice, nil
+}
+
+func (s *Reconciler) getOrCreateAvailabilitySet(ctx context.Context) (string, error) {
+	if s.scope.MachineConfig.AvailabilitySet != "" {
+		return s.scope.MachineConfig.AvailabilitySet, nil
+	}
+
+	regional, err := s.getRegional()
+	if err != nil {
+		return "", err
+	}
+	if regional {
+		klog.V(4).Infof("No availability set needed for %s because it is regional", s.scope.Machine.Name)
+		return "", nil
+	}
+
+	// Try to find the zone for the machine location
+	availabilityZones, err := s.availabilityZonesSvc.Get(ctx, &availabilityzones.Spec{
+		VMSize: s.scope.MachineConfig.VMSize,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	availabilityZonesSlice, ok := availabilityZones.([]string)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T", availabilityZones)
+	}
+
+	if len(availabilityZonesSlice) != 0 {
+		klog.V(4).Infof("No availability set needed for %s because availability zones were found", s.scope.Machine.Name)
+		return "", nil
+	}
+
+	// By default machines that are not part of a MachineSet are placed without an
+	// availability set. When standalone availability sets are enabled, the machine
+	// name is used to generate the availability set name instead.
+	if _, ok := s.scope.Machine.Labels[MachineSetLabelName]; !ok && !s.scope.StandaloneAvailabilitySetEnabled {
+		klog.V(4).Infof("MachineSet label name was not found for %s, skipping availability set creation", s.scope.Machine.Name)
+		return "", nil
+	}
+
+	if s.scope.MachineConfig.SpotVMOptions != nil {
+		klog.V(4).Infof("MachineSet %s uses spot instances, skipping availability set creation", s.scope.Machine.Name)
+		return "", nil
+	}
+
+	klog.V(4).Infof("No availability zones were found for %s, an availability set will be created", s.scope.Machine.Name)
+
+	faultDomainCount, updateDomainCount, err := s.getAvailabilitySetDomainCounts()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.availabilitySetsSvc.CreateOrUpdate(ctx, &availabilitysets.Spec{
+		Name:              s.getAvailabilitySetName(),
+		FaultDomainCount:  faultDomainCount,
+		UpdateDomainCount: updateDomainCount,
+	}); err != nil {
+		return "", err
+	}
+
+	return s.getAvailabilitySetName(), nil
+}
+
+// getPlacedAvailabilitySetName returns the name of the availability set the machine is placed in,
+// the one set in the machine config when set, otherwise the generated one.
+func (s *Reconciler) getPlacedAvailabilitySetName() string {
+	if s.scope.MachineConfig.AvailabilitySet != "" {
+		return s.scope.MachineConfig.AvailabilitySet
+	}
+	return s.getAvailabilitySetName()
+}
+
+// getAvailabilitySetName uses the MachineSet name and the cluster name to
+// generate an availability set name with the format
+// `<Cluster Name>_<MachineSet Name>-as`. Due to an 80 character restriction
+// on availability set names, if the MachineSet name starts with the cluster
+// name, then it will not be added a second time and the availability set name
+// will be `<MachineSet Name>-as`.
+// When the machine has no MachineSet label and standalone availability sets are
+// enabled, the machine name is used in place of the MachineSet name.
+// see https://docs.microsoft.com/en-us/azure/azure-resource-manager/management/resource-name-rules#microsoftcompute
+func (s *Reconciler) getAvailabilitySetName() string {
+	baseName, ok := s.scope.Machine.Labels[MachineSetLabelName]
+	if !ok && s.scope.StandaloneAvailabilitySetEnabled {
+		baseName = s.scope.Machine.Name
+	}
+
+	asname := ""
+	if strings.HasPrefix(baseName, s.scope.Machine.Labels[machinev1.MachineClusterIDLabel]) {
+		asname = baseName
+	} else {
+		asname = fmt.Sprintf("%s_%s",
+			s.scope.Machine.Labels[machinev1.MachineClusterIDLabel],
+			baseName)
+	}
+	// due to the 80 character name limit, if the proposed name will be 77 or more
+	// characters, we truncate the name before adding `-as`
+	if len(asname) >= 77 { // 80 char minus room for adding `-as`
+		asname = asname[:77]
+	}
+	asname = fmt.Sprintf("%s-as", asname)
+	return asname
+}
+
+// getDiagnosticsConfig sets up the diagnostics configuration for the virtual machine
+// using the storage endpoint suffix of the cloud environment of the machine.
+func (s *Reconciler) getDiagnosticsConfig() (*compute.DiagnosticsProfile, error) {
+	var storageEndpointSuffix string
+	if boot := s.scope.MachineConfig.Diagnostics.Boot; boot != nil && boot.StorageAccountType == machinev1.CustomerManagedAzureDiagnosticsStorage {
+		var err error
+		storageEndpointSuffix, err = s.scope.StorageEndpointSuffix()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return createDiagnosticsConfig(s.scope.MachineConfig, storageEndpointSuffix)
+}
+
+// createDiagnosticsConfig sets up the diagnostics configuration for the virtual machine.
+// Customer managed storage account URIs must use the storageEndpointSuffix of the cloud environment.
+func createDiagnosticsConfig(config *machinev1.AzureMachineProviderSpec, storageEndpointSuffix string) (*compute.DiagnosticsProfile, error) {
+	boot := config.Diagnostics.Boot
+	if boot == nil {
+		return nil, nil
+	}
+
+	switch boot.StorageAccountType {
+	case machinev1.AzureManagedAzureDiagnosticsStorage:
+		return &compute.DiagnosticsProfile{
+			BootDiagnostics: &compute.BootDiagnostics{
+				Enabled: ptr.To[bool](true),
+			},
+		}, nil
+	case machinev1.CustomerManagedAzureDiagnosticsStorage:
+		if boot.CustomerManaged == nil || boot.CustomerManaged.StorageAccountURI == "" {
+			return nil, machinecontroller.InvalidMachineConfiguration("missing configuration for customer managed storage account URI")
+		}
+
+		if err := validateStorageAccountURI(boot.CustomerManaged.StorageAccountURI, storageEndpointSuffix); err != nil {
+			return nil, machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", boot.CustomerManaged.StorageAccountURI, err)
+		}
+
+		return &compute.DiagnosticsProfile{
+			BootDiagnostics: &compute.BootDiagnostics{
+				Enabled:    ptr.To[bool](true),
+				StorageURI: ptr.To[string](boot.CustomerManaged.StorageAccountURI),
+			},
+		}, nil
+	default:
+		return nil, machinecontroller.InvalidMachineConfiguration(
+			"unknown storage account type for boot diagnostics: %q, supported types are %s & %s",
+			boot.StorageAccountType,
+			machinev1.AzureManagedAzureDiagnosticsStorage,
+			machinev1.CustomerManagedAzureDiagnosticsStorage,
+		)
+	}
+}
+
+// storageAccountNameRegexp matches valid Azure storage account names.
+var storageAccountNameRegexp = regexp.MustCompile(`^[a-z0-9]{3,24}$`)
+
+// validateStorageAccountURI checks that uri is the blob endpoint of a storage account,
+// i.e. https://<account>.blob.<storageEndpointSuffix>/.
+func validateStorageAccountURI(uri, storageEndpointSuffix string) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "https" {
+		return fmt.Errorf("scheme must be https")
+	}
+
+	if u.User != nil || u.Port() != "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("must be of the form https://<account>.blob.%s/", storageEndpointSuffix)
+	}
+
+	account, suffix, found := strings.Cut(strings.ToLower(u.Hostname()), ".blob.")
+	if !found || !storageAccountNameRegexp.MatchString(account) {
+		return fmt.Errorf("must be of the form https://<account>.blob.%s/", storageEndpointSuffix)
+	}
+
+	if !strings.EqualFold(suffix, storageEndpointSuffix) {
+		return fmt.Errorf("storage endpoint suffix %q does not match the suffix %q of the cloud environment", suffix, storageEndpointSuffix)
+	}
+
+	return nil
+}
+
+func validateAzureCapacityReservationGroupID(capacityReservationGroupID string) error {
+	id := strings.TrimPrefix(capacityReservationGroupID, azureProviderIDPrefix)
+	err := parseAzureResourceID(id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// diskEncryptionSetRef is a disk encryption set ID referenced by a field of the machine config.
+type diskEncryptionSetRef struct {
+	field string
+	id    string
+}
+
+// diskEncryptionSetRefs returns the disk encryption set IDs referenced by the OS and data disks.
+func diskEncryptionSetRefs(config *machinev1.AzureMachineProviderSpec) []diskEncryptionSetRef {
+	refs := []diskEncryptionSetRef{}
+	if config.OSDisk.ManagedDisk.DiskEncryptionSet != nil {
+		refs = append(refs, diskEncryptionSetRef{
+			field: "osDisk.managedDisk.diskEncryptionSet.id",
+			id:    config.OSDisk.ManagedDisk.DiskEncryptionSet.ID,
+		})
+	}
+	refs = append(refs, diskEncryptionSetRef{
+		field: "osDisk.managedDisk.securityProfile.diskEncryptionSet.id",
+		id:    config.OSDisk.ManagedDisk.SecurityProfile.DiskEncryptionSet.ID,
+	})
+	for i, disk := range config.DataDisks {
+		if disk.ManagedDisk.DiskEncryptionSet != nil {
+			refs = append(refs, diskEncryptionSetRef{
+				field: fmt.Sprintf("dataDisks[%d].managedDisk.diskEncryptionSet.id", i),
+				id:    disk.ManagedDisk.DiskEncryptionSet.ID,
+			})
+		}
+	}
+
+	return refs
+}
+
+// validateDiskEncryptionSetIDs validates every disk encryption set ID referenced by the OS and data disks.
+// Empty IDs are ignored as they leave the choice of the disk encryption set to the platform.
+func validateDiskEncryptionSetIDs(config *machinev1.AzureMachineProviderSpec) error {
+	for _, ref := range diskEncryptionSetRefs(config) {
+		if ref.id == "" {
+			continue
+		}
+		if err := validateAzureDiskEncryptionSetID(ref.id); err != nil {
+			return machinecontroller.InvalidMachineConfiguration("invalid %s: %v", ref.field, err)
+		}
+	}
+
+	return nil
+}
+
+// validateDiskEncryptionSetLocations checks that every disk encryption set referenced by the OS and data disks
+// is in the location of the machine, as Azure fails to create disks encrypted with a disk encryption set from
+// another region. Each disk encryption set is fetched once, however many disks reference it.
+func (s *Reconciler) validateDiskEncryptionSetLocations(ctx context.Context) error {
+	checked := sets.New[string]()
+	for _, ref := range diskEncryptionSetRefs(s.scope.MachineConfig) {
+		if ref.id == "" || checked.Has(strings.ToLower(ref.id)) {
+			continue
+		}
+		checked.Insert(strings.ToLower(ref.id))
+
+		diskEncryptionSetInterface, err := s.diskEncryptionSetsSvc.Get(ctx, &diskencryptionsets.Spec{ID: ref.id})
+		if err != nil {
+			if azure.ResourceNotFound(err) {
+				return machinecontroller.InvalidMachineConfiguration("invalid %s: disk encryption set %s not found", ref.field, ref.id)
+			}
+			return fmt.Errorf("failed to get disk encryption set %s: %w", ref.id, err)
+		}
+
+		diskEncryptionSet, ok := diskEncryptionSetInterface.(compute.DiskEncryptionSet)
+		if !ok {
+			return fmt.Errorf("disk encryption set get returned invalid disk encryption set, getting %T instead", diskEncryptionSetInterface)
+		}
+
+		location := ptr.Deref(diskEncryptionSet.Location, "")
+		if !strings.EqualFold(strings.ReplaceAll(location, " ", ""), strings.ReplaceAll(s.scope.MachineConfig.Location, " ", "")) {
+			return machinecontroller.InvalidMachineConfiguration("invalid %s: disk encryption set %s is in location %s, it must be in the location %s of the machine",
+				ref.field, ref.id, location, s.scope.MachineConfig.Location)
+		}
+	}
+
+	return nil
+}
+
+// validateStorageAccountTypes checks that the OS and data disks use storage account types known to Azure
+// and, for zone-redundant storage (ZRS), that the region of the machine supports it.
+// Empty storage account types are ignored as they leave the choice to the platform.
+func (s *Reconciler) validateStorageAccountTypes(ctx context.Context) error {
+	zrsSupported := map[string]bool{}
+	for _, ref := range storageAccountTypeRefs(s.scope.MachineConfig.OSDisk, s.getDataDisks()) {
+		if ref.storageAccountType == "" {
+			continue
+		}
+
+		if !virtualmachines.IsKnownStorageAccountType(ref.storageAccountType) {
+			return machinecontroller.InvalidMachineConfiguration("invalid %s: unknown storage account type %q, supported types are %v",
+				ref.field, ref.storageAccountType, compute.PossibleStorageAccountTypesValues())
+		}
+
+		if !isZoneRedundantStorageAccountType(ref.storageAccountType) {
+			continue
+		}
+
+		supported, ok := zrsSupported[ref.storageAccountType]
+		if !ok {
+			_, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+				Name:         ref.storageAccountType,
+				ResourceType: resourceskus.Disks,
+			})
+			if err != nil && !errors.Is(err, resourceskus.ErrResourceNotFound) {
+				return fmt.Errorf("failed to obtain disk type information for %q from Azure: %w", ref.storageAccountType, err)
+			}
+			supported = err == nil
+			zrsSupported[ref.storageAccountType] = supported
+		}
+
+		if !supported {
+			return machinecontroller.InvalidMachineConfiguration("invalid %s: zone-redundant storage account type %q is not supported in region %q",
+				ref.field, ref.storageAccountType, s.scope.Location())
+		}
+	}
+
+	return nil
+}
+
+// validateStorageAccountTypesForZone checks that the storage account types of the OS and data disks
+// can be used with the zone of the machine. Zone-redundant disks can be attached from any zone, while
+// locally-redundant disks are created in the zone of the machine, so their type must be available there.
+func (s *Reconciler) validateStorageAccountTypesForZone(ctx context.Context, zone string) error {
+	// Azure Stack Hub has no availability zones.
+	if zone == "" || s.scope.IsStackHub() {
+		return nil
+	}
+
+	availableInZone := map[string]bool{}
+	for _, ref := range storageAccountTypeRefs(s.scope.MachineConfig.OSDisk, s.getDataDisks()) {
+		if ref.storageAccountType == "" || isZoneRedundantStorageAccountType(ref.storageAccountType) {
+			continue
+		}
+
+		available, ok := availableInZone[ref.storageAccountType]
+		if !ok {
+			skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+				Name:         ref.storageAccountType,
+				ResourceType: resourceskus.Disks,
+			})
+			if err != nil && !errors.Is(err, resourceskus.ErrResourceNotFound) {
+				return fmt.Errorf("failed to obtain disk type information for %q from Azure: %w", ref.storageAccountType, err)
+			}
+			available = err == nil && skuI.(resourceskus.SKU).HasLocationZone(s.scope.Location(), zone)
+			availableInZone[ref.storageAccountType] = available
+		}
+
+		if !available {
+			return machinecontroller.InvalidMachineConfiguration("invalid %s: locally-redundant storage account type %q is not available in zone %q of region %q, "+
+				"use a zone-redundant storage account type or a different zone", ref.field, ref.storageAccountType, zone, s.scope.Location())
+		}
+	}
+
+	return nil
+}
+
+// storageAccountTypeRef is a storage account type referenced by the provider spec, along with its field path.
+type storageAccountTypeRef struct {
+	field              string
+	storageAccountType string
+}
+
+// storageAccountTypeRefs returns the storage account types of the OS and data disks of the provider spec.
+func storageAccountTypeRefs(osDisk machinev1.OSDisk, dataDisks []machinev1.DataDisk) []storageAccountTypeRef {
+	refs := []storageAccountTypeRef{{
+		field:              "osDisk.managedDisk.storageAccountType",
+		storageAccountType: osDisk.ManagedDisk.StorageAccountType,
+	}}
+	for i, disk := range dataDisks {
+		refs = append(refs, storageAccountTypeRef{
+			field:              fmt.Sprintf("dataDisks[%d].managedDisk.storageAccountType", i),
+			storageAccountType: string(disk.ManagedDisk.StorageAccountType),
+		})
+	}
+	return refs
+}
+
+// getDataDisks returns the data disks of the machine, with the default storage account type
+// applied to the ones which do not set one. The provider spec of the machine is left untouched.
+func (s *Reconciler) getDataDisks() []machinev1.DataDisk {
+	if s.scope.DefaultDataDiskStorageAccountType == "" {
+		return s.scope.MachineConfig.DataDisks
+	}
+
+	dataDisks := make([]machinev1.DataDisk, len(s.scope.MachineConfig.DataDisks))
+	for i, disk := range s.scope.MachineConfig.DataDisks {
+		if disk.ManagedDisk.StorageAccountType == "" {
+			disk.ManagedDisk.StorageAccountType = machinev1.StorageAccountType(s.scope.DefaultDataDiskStorageAccountType)
+		}
+		dataDisks[i] = disk
+	}
+	return dataDisks
+}
+
+// isZoneRedundantStorageAccountType returns true for zone-redundant storage account types, e.g. Premium_ZRS.
+func isZoneRedundantStorageAccountType(storageAccountType string) bool {
+	return strings.HasSuffix(strings.ToUpper(storageAccountType), "_ZRS")
+}
+
+// validateAzureDiskEncryptionSetID checks that the ID is a valid resource ID of a disk encryption set.
+func validateAzureDiskEncryptionSetID(id string) error {
+	if err := parseAzureResourceID(id); err != nil {
+		return err
+	}
+
+	parts := splitStringAndOmitEmpty(id, "/")
+	if len(parts) < 4 ||
+		!strings.EqualFold(parts[len(parts)-4], azureProvidersKey) ||
+		!strings.EqualFold(parts[len(parts)-3], azureComputeResourceNamespace) ||
+		!strings.EqualFold(parts[len(parts)-2], azureDiskEncryptionSetsType) {
+		return fmt.Errorf("invalid resource ID: %s, expected a %s/%s resource", id, azureComputeResourceNamespace, azureDiskEncryptionSetsType)
+	}
+
+	return nil
+}
+
+// getDataDisksFromImage returns the LUNs of the data disks requested by the machine annotations to be
+// created from the data disks of the image, after making sure the image has a data disk for each of them.
+func (s *Reconciler) getDataDisksFromImage(ctx context.Context) ([]int32, error) {
+	value, ok := s.scope.Machine.Annotations[MachineDataDisksFromImageAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+
+	var luns []int32
+	for _, item := range strings.Split(value, ",") {
+		lun, err := strconv.ParseInt(strings.TrimSpace(item), 10, 32)
+		if err != nil || lun < 0 || lun > 63 {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of LUNs between 0 and 63, got %q",
+				MachineDataDisksFromImageAnnotationName, value)
+		}
+		luns = append(luns, int32(lun))
+	}
+
+	// Images are looked up with the images clients of the public cloud API version.
+	if s.scope.IsStackHub() {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineDataDisksFromImageAnnotationName)
+	}
+
+	// The data disks of gallery image versions can not be looked up with the images clients.
+	switch s.scope.MachineConfig.Image.Type {
+	case virtualmachines.AzureImageTypeGallery, virtualmachines.AzureImageTypeCommunityGallery, virtualmachines.AzureImageTypeSharedGallery:
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported with images of type %s",
+			MachineDataDisksFromImageAnnotationName, s.scope.MachineConfig.Image.Type)
+	}
+
+	imageLunsInterface, err := s.imagesSvc.Get(ctx, &images.Spec{Image: s.scope.MachineConfig.Image})
+	if err != nil {
+		if azure.ResourceNotFound(err) {
+			return nil, machinecontroller.InvalidMachineConfiguration("image of the data disks referenced by annotation %s not found: %v",
+				MachineDataDisksFromImageAnnotationName, err)
+		}
+		return nil, fmt.Errorf("failed to get data disks of the image: %w", err)
+	}
+
+	imageLuns, ok := imageLunsInterface.([]int32)
+	if !ok {
+		return nil, fmt.Errorf("image get returned invalid data disk LUNs, getting %T instead", imageLunsInterface)
+	}
+
+	available := sets.New(imageLuns...)
+	for _, lun := range luns {
+		if !available.Has(lun) {
+			return nil, machinecontroller.InvalidMachineConfiguration("image has no data disk with lun %d referenced by annotation %s, available luns are %v",
+				lun, MachineDataDisksFromImageAnnotationName, sets.List(available))
+		}
+	}
+
+	return luns, nil
+}
+
+// getAttachedDataDisks returns the resource IDs of the existing managed disks requested by the machine annotations
+// to be attached as data disks, keyed by the LUN of the data disk, after making sure each of them exists, can be
+// attached in the zone of the machine and is not attached to another virtual machine.
+func (s *Reconciler) getAttachedDataDisks(ctx context.Context) (map[int32]string, error) {
+	value, ok := s.scope.Machine.Annotations[MachineAttachedDataDisksAnnotationName]
+	if !ok {
+		return nil, nil
+	}
+
+	// Existing disks are looked up with the disks client of the public cloud API version.
+	if s.scope.IsStackHub() {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineAttachedDataDisksAnnotationName)
+	}
+
+	dataDisks := map[int32]machinev1.DataDisk{}
+	for _, disk := range s.scope.MachineConfig.DataDisks {
+		dataDisks[disk.Lun] = disk
+	}
+
+	attachedDisks := map[int32]string{}
+	for _, item := range strings.Split(value, ",") {
+		lunValue, id, found := strings.Cut(strings.TrimSpace(item), ":")
+		lun, err := strconv.ParseInt(lunValue, 10, 32)
+		if !found || err != nil {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of lun:resourceID entries, got %q",
+				MachineAttachedDataDisksAnnotationName, value)
+		}
+
+		if _, exists := attachedDisks[int32(lun)]; exists {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s attaches more than one disk as the data disk with lun %d",
+				MachineAttachedDataDisksAnnotationName, lun)
+		}
+
+		disk, ok := dataDisks[int32(lun)]
+		if !ok {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineAttachedDataDisksAnnotationName, lun)
 		}
 
-		skuI, err := s.resourcesSkus.Get(ctx, skuSpec)
-		if err != nil {
-			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
-				Name:      s.scope.Machine.Name,
-				Namespace: s.scope.Machine.Namespace,
-				Reason:    "failed to obtain instance type information",
-			})
+		// Deleting the disk with the machine would destroy the data the disk was attached for.
+		if disk.DeletionPolicy != machinev1.DiskDeletionPolicyTypeDetach {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s attaches an existing disk as the data disk with lun %d, whose deletionPolicy must be %q, got %q",
+				MachineAttachedDataDisksAnnotationName, lun, machinev1.DiskDeletionPolicyTypeDetach, disk.DeletionPolicy)
+		}
 
-			if errors.Is(err, resourceskus.ErrResourceNotFound) {
-				return machinecontroller.InvalidMachineConfiguration("failed to obtain instance type information for VMSize '%s' from Azure: %s", skuSpec.Name, err)
-			} else {
-				return fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", skuSpec.Name, err)
-			}
+		resourceID, err := autorestazure.ParseResourceID(id)
+		if err != nil ||
+			!strings.EqualFold(resourceID.Provider, azureComputeResourceNamespace) ||
+			!strings.EqualFold(resourceID.ResourceType, azureDisksType) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references %q as the data disk with lun %d, which is not the resource ID of a %s/%s resource",
+				MachineAttachedDataDisksAnnotationName, id, lun, azureComputeResourceNamespace, azureDisksType)
 		}
 
-		sku := skuI.(resourceskus.SKU)
+		if !strings.EqualFold(resourceID.SubscriptionID, s.scope.SubscriptionID) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references disk %s, which is not in the subscription %s of the machine",
+				MachineAttachedDataDisksAnnotationName, id, s.scope.SubscriptionID)
+		}
 
-		if !sku.HasCapability(resourceskus.AcceleratedNetworking) {
-			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
-				Name:      s.scope.Machine.Name,
-				Namespace: s.scope.Machine.Namespace,
-				Reason:    fmt.Sprintf("accelerated networking not supported on instance type: %v", s.scope.MachineConfig.VMSize),
-			})
-			return machinecontroller.InvalidMachineConfiguration("accelerated networking not supported on instance type: %v", s.scope.MachineConfig.VMSize)
+		if err := s.validateAttachableDisk(ctx, id); err != nil {
+			return nil, err
 		}
-		networkInterfaceSpec.AcceleratedNetworking = s.scope.MachineConfig.AcceleratedNetworking
-	}
 
-	if s.scope.MachineConfig.Subnet == "" {
-		return machinecontroller.InvalidMachineConfiguration("MachineConfig subnet is missing on machine %s, skipping machine creation", s.scope.Machine.Name)
+		attachedDisks[int32(lun)] = id
 	}
 
-	networkInterfaceSpec.SubnetName = s.scope.MachineConfig.Subnet
+	return attachedDisks, nil
+}
 
-	if s.scope.MachineConfig.PublicLoadBalancer != "" {
-		networkInterfaceSpec.PublicLoadBalancerName = s.scope.MachineConfig.PublicLoadBalancer
-		if s.scope.MachineConfig.NatRule != nil {
-			networkInterfaceSpec.NatRule = s.scope.MachineConfig.NatRule
+// validateAttachableDisk makes sure the existing disk exists, can be attached in the zone of the machine, and is
+// either not attached to any virtual machine, or already attached to the virtual machine of the machine.
+func (s *Reconciler) validateAttachableDisk(ctx context.Context, id string) error {
+	diskInterface, err := s.disksSvc.Get(ctx, &disks.ExistingDiskSpec{ID: id})
+	if err != nil {
+		if azure.ResourceNotFound(err) {
+			return machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s not found: %v",
+				id, MachineAttachedDataDisksAnnotationName, err)
 		}
+		return fmt.Errorf("failed to get disk %s: %w", id, err)
 	}
-	if s.scope.MachineConfig.InternalLoadBalancer != "" {
-		networkInterfaceSpec.InternalLoadBalancerName = s.scope.MachineConfig.InternalLoadBalancer
+
+	disk, ok := diskInterface.(compute.Disk)
+	if !ok {
+		return fmt.Errorf("disk get returned invalid disk, getting %T instead", diskInterface)
 	}
 
-	if s.scope.MachineConfig.SecurityGroup != "" {
-		networkInterfaceSpec.SecurityGroupName = s.scope.MachineConfig.SecurityGroup
+	if err := validateAttachableDiskZone(id, disk, s.scope.MachineConfig.Zone); err != nil {
+		return err
 	}
 
-	if len(s.scope.MachineConfig.ApplicationSecurityGroups) > 0 {
-		networkInterfaceSpec.ApplicationSecurityGroupNames = s.scope.MachineConfig.ApplicationSecurityGroups
+	if disk.ManagedBy == nil || *disk.ManagedBy == "" {
+		return nil
 	}
 
-	if s.scope.MachineConfig.PublicIP {
-		publicIPName, err := azure.GenerateMachinePublicIPName(s.scope.ClusterName, s.scope.Machine.Name)
-		if err != nil {
-			return machinecontroller.InvalidMachineConfiguration("unable to create Public IP: %v", err)
-		}
-		err = s.publicIPSvc.CreateOrUpdate(ctx, &publicips.Spec{Name: publicIPName})
-		if err != nil {
-			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
-				Name:      s.scope.Machine.Name,
-				Namespace: s.scope.Machine.Namespace,
-				Reason:    "failed to create public IP",
-			})
-			return fmt.Errorf("unable to create Public IP: %w", err)
-		}
-		networkInterfaceSpec.PublicIP = publicIPName
+	// The disk stays attached to the virtual machine of the machine once it is created.
+	managedBy, err := autorestazure.ParseResourceID(*disk.ManagedBy)
+	if err == nil &&
+		strings.EqualFold(managedBy.ResourceGroup, s.scope.MachineConfig.ResourceGroup) &&
+		strings.EqualFold(managedBy.ResourceName, s.scope.Machine.Name) {
+		return nil
 	}
 
-	err := s.networkInterfacesSvc.CreateOrUpdate(ctx, networkInterfaceSpec)
-	if err != nil {
-		metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
-			Name:      s.scope.Machine.Name,
-			Namespace: s.scope.Machine.Namespace,
-			Reason:    "failed to create VM network interface",
-		})
-		return fmt.Errorf("unable to create VM network interface: %w", err)
+	return machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is already attached to %s",
+		id, MachineAttachedDataDisksAnnotationName, *disk.ManagedBy)
+}
+
+// validateAttachableDiskZone makes sure the existing disk can be attached to a virtual machine in the given zone.
+// A zonal disk is only attached to virtual machines in its zone. A regional disk is attached to virtual machines
+// without a zone, and to zonal virtual machines only when it is zone-redundant.
+func validateAttachableDiskZone(id string, disk compute.Disk, zone string) error {
+	diskZones := ptr.Deref(disk.Zones, nil)
+	if len(diskZones) > 0 {
+		for _, diskZone := range diskZones {
+			if diskZone == zone {
+				return nil
+			}
+		}
+		return machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is in zone %s, it can not be attached to a machine in zone %q",
+			id, MachineAttachedDataDisksAnnotationName, strings.Join(diskZones, ","), zone)
 	}
 
-	return err
+	if zone != "" && (disk.Sku == nil || !strings.HasSuffix(string(disk.Sku.Name), "_ZRS")) {
+		return machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is neither in zone %q nor zone-redundant",
+			id, MachineAttachedDataDisksAnnotationName, zone)
+	}
+	return nil
 }
 
-func (s *Reconciler) createVirtualMachine(ctx context.Context, nicName, asName string) error {
-	decoded, err := base64.StdEncoding.DecodeString(s.scope.MachineConfig.SSHPublicKey)
-	if err != nil {
-		return fmt.Errorf("failed to decode ssh public key: %w", err)
+// getUltraDiskPerformance returns the provisioned performance of the ultra data disks requested by the machine
+// annotations, after making sure each of them refers to an ultra data disk and is within the limits Azure allows
+// for the size of the disk.
+func (s *Reconciler) getUltraDiskPerformance() ([]*disks.PerformanceSpec, error) {
+	value, ok := s.scope.Machine.Annotations[MachineUltraDiskPerformanceAnnotationName]
+	if !ok {
+		return nil, nil
 	}
 
-	vmSpec := &virtualmachines.Spec{
-		Name: s.scope.Machine.Name,
+	// The provisioned performance of disks can not be set on Azure Stack Hub.
+	if s.scope.IsStackHub() {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineUltraDiskPerformanceAnnotationName)
 	}
 
-	vmInterface, err := s.virtualMachinesSvc.Get(ctx, vmSpec)
-	if err != nil && vmInterface == nil {
-		zone, err := s.getZone(ctx)
-		if err != nil {
-			return fmt.Errorf("failed to get zone: %w", err)
-		}
+	dataDisks := map[int32]machinev1.DataDisk{}
+	for _, disk := range s.getDataDisks() {
+		dataDisks[disk.Lun] = disk
+	}
 
-		diagnosticsProfile, err := createDiagnosticsConfig(s.scope.MachineConfig)
-		if err != nil {
-			return fmt.Errorf("failed to configure diagnostics profile: %w", err)
+	var specs []*disks.PerformanceSpec
+	seen := sets.New[int32]()
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 3 {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of lun:iops:mbps entries, got %q",
+				MachineUltraDiskPerformanceAnnotationName, value)
 		}
 
-		if s.scope.Machine.Labels == nil || s.scope.Machine.Labels[machinev1.MachineClusterIDLabel] == "" {
-			return fmt.Errorf("machine is missing %q label", machinev1.MachineClusterIDLabel)
+		lun, lunErr := strconv.ParseInt(parts[0], 10, 32)
+		iops, iopsErr := strconv.ParseInt(parts[1], 10, 64)
+		mbps, mbpsErr := strconv.ParseInt(parts[2], 10, 64)
+		if lunErr != nil || iopsErr != nil || mbpsErr != nil {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of lun:iops:mbps entries, got %q",
+				MachineUltraDiskPerformanceAnnotationName, value)
 		}
 
-		vmSpec = &virtualmachines.Spec{
-			Name:                s.scope.Machine.Name,
-			NICName:             nicName,
-			SSHKeyData:          string(decoded),
-			Size:                s.scope.MachineConfig.VMSize,
-			OSDisk:              s.scope.MachineConfig.OSDisk,
-			DataDisks:           s.scope.MachineConfig.DataDisks,
-			Image:               s.scope.MachineConfig.Image,
-			Zone:                zone,
-			Tags:                s.scope.Tags,
-			SecurityProfile:     s.scope.MachineConfig.SecurityProfile,
-			UltraSSDCapability:  s.scope.MachineConfig.UltraSSDCapability,
-			AvailabilitySetName: asName,
-			DiagnosticsProfile:  diagnosticsProfile,
+		if seen.Has(int32(lun)) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s sets the performance of the data disk with lun %d more than once",
+				MachineUltraDiskPerformanceAnnotationName, lun)
 		}
+		seen.Insert(int32(lun))
 
-		if s.scope.MachineConfig.ManagedIdentity != "" {
-			vmSpec.ManagedIdentity = azure.GenerateManagedIdentityName(s.scope.SubscriptionID, s.scope.MachineConfig.ResourceGroup, s.scope.MachineConfig.ManagedIdentity)
+		disk, ok := dataDisks[int32(lun)]
+		if !ok {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineUltraDiskPerformanceAnnotationName, lun)
 		}
 
-		if s.scope.MachineConfig.CapacityReservationGroupID != "" {
-			if err = validateAzureCapacityReservationGroupID(s.scope.MachineConfig.CapacityReservationGroupID); err != nil {
-				return fmt.Errorf("failed to validate capacityReservationGroupID: %w", err)
-			}
-			vmSpec.CapacityReservationGroupID = s.scope.MachineConfig.CapacityReservationGroupID
+		storageAccountType := disk.ManagedDisk.StorageAccountType
+		if storageAccountType != machinev1.StorageAccountUltraSSDLRS {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references the data disk with lun %d of storage account type %q, only %q data disks support setting IOPS and throughput",
+				MachineUltraDiskPerformanceAnnotationName, lun, storageAccountType, machinev1.StorageAccountUltraSSDLRS)
 		}
 
-		userData, userDataErr := s.getCustomUserData()
-		if userDataErr != nil {
-			return fmt.Errorf("failed to get custom script data: %w", userDataErr)
+		minIOPS, maxIOPS := ultraDiskIOPSRange(int64(disk.DiskSizeGB))
+		if iops < minIOPS || iops > maxIOPS {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s sets %d IOPS on the data disk with lun %d, a %d GiB ultra disk allows between %d and %d IOPS",
+				MachineUltraDiskPerformanceAnnotationName, iops, lun, disk.DiskSizeGB, minIOPS, maxIOPS)
 		}
 
-		if userData != "" {
-			vmSpec.CustomData = userData
+		minMBps, maxMBps := ultraDiskMBpsRange(iops)
+		if mbps < minMBps || mbps > maxMBps {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s sets %d MBps on the data disk with lun %d, an ultra disk with %d IOPS allows between %d and %d MBps",
+				MachineUltraDiskPerformanceAnnotationName, mbps, lun, iops, minMBps, maxMBps)
 		}
 
-		// If we get an AsynOpIncompleteError, this means the VM is being created and we completed the request successfully.
-		if err := s.virtualMachinesSvc.CreateOrUpdate(ctx, vmSpec); err != nil && !errors.Is(err, autorestazure.NewAsyncOpIncompleteError("compute.VirtualMachinesCreateOrUpdateFuture")) {
-			metrics.RegisterFailedInstanceCreate(&metrics.MachineLabels{
-				Name:      s.scope.Machine.Name,
-				Namespace: s.scope.Machine.Namespace,
-				Reason:    "failed to create VM",
-			})
+		specs = append(specs, &disks.PerformanceSpec{
+			Name: azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix),
+			IOPS: iops,
+			MBps: mbps,
+		})
+	}
 
-			var detailedError autorest.DetailedError
-			if errors.As(err, &detailedError) && detailedError.Message == "Failure sending request" {
-				return machinecontroller.InvalidMachineConfiguration("failure sending request for machine %s: %v", s.scope.Machine.Name, err)
-			}
+	return specs, nil
+}
 
-			return fmt.Errorf("failed to create VM: %w", err)
-		}
-	} else if err != nil {
-		return fmt.Errorf("failed to get vm: %w", err)
-	} else {
-		vm, err := decode.GetVirtualMachine(vmInterface)
-		if err != nil {
-			return fmt.Errorf("returned incorrect vm interface: %v", err)
-		}
-		if vm.ProvisioningState == nil {
-			return fmt.Errorf("vm %s is nil provisioning state, reconcile", s.scope.Machine.Name)
-		}
+// ultraDiskIOPSRange returns the IOPS Azure allows to provision on an ultra disk of the given size:
+// at least 1 IOPS per GiB with a baseline of 100 IOPS, and at most 300 IOPS per GiB up to 160000 IOPS.
+func ultraDiskIOPSRange(sizeGB int64) (int64, int64) {
+	minIOPS := sizeGB
+	if minIOPS < 100 {
+		minIOPS = 100
+	}
+	maxIOPS := 300 * sizeGB
+	if maxIOPS > 160000 {
+		maxIOPS = 160000
+	}
+	return minIOPS, maxIOPS
+}
 
-		vmState := getVMState(vm)
-		s.scope.MachineStatus.VMID = vm.ID
-		s.scope.MachineStatus.VMState = &vmState
+// ultraDiskMBpsRange returns the throughput in MBps Azure allows to provision on an ultra disk with the given IOPS:
+// at least 4 KiB/s per IOPS with a baseline of 1 MBps, and at most 0.25 MBps per IOPS up to 4000 MBps.
+func ultraDiskMBpsRange(iops int64) (int64, int64) {
+	minMBps := (iops*4*1024 + 999999) / 1000000
+	if minMBps < 1 {
+		minMBps = 1
+	}
+	maxMBps := iops / 4
+	if maxMBps > 4000 {
+		maxMBps = 4000
+	}
+	return minMBps, maxMBps
+}
 
-		s.setMachineCloudProviderSpecifics(vm)
+// reconcileUltraDiskPerformance sets the IOPS and throughput requested by the machine annotations on its ultra data disks.
+// The performance has to be set on the disks themselves as the VM API does not allow setting it on the attached data disks.
+func (s *Reconciler) reconcileUltraDiskPerformance(ctx context.Context, resourceGroup string) error {
+	specs, err := s.getUltraDiskPerformance()
+	if err != nil {
+		return err
+	}
 
-		if *vm.ProvisioningState == "Failed" {
-			// If VM failed provisioning, delete it so it can be recreated
-			err = s.Delete(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to delete machine: %w", err)
-			}
-			return fmt.Errorf("vm %s is deleted, retry creating in next reconcile", s.scope.Machine.Name)
-		} else if *vm.ProvisioningState != "Succeeded" {
-			return fmt.Errorf("vm %s is still in provisioning state %s, reconcile", s.scope.Machine.Name, *vm.ProvisioningState)
+	for _, spec := range specs {
+		spec.ResourceGroup = resourceGroup
+		if err := s.disksSvc.CreateOrUpdate(ctx, spec); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (s *Reconciler) getCustomUserData() (string, error) {
-	if s.scope.MachineConfig.UserDataSecret == nil {
-		return "", nil
+// annotatedDisk is a disk of the machine referenced by an annotation listing disks.
+type annotatedDisk struct {
+	// name is the name of the managed disk.
+	name string
+	// description identifies the disk in error messages.
+	description string
+	// lun is the LUN of a data disk, it is nil for the OS disk.
+	lun                *int32
+	storageAccountType string
+	cachingType        string
+	sizeGB             int32
+	// ephemeral is set for an ephemeral OS disk, which is not a managed disk.
+	ephemeral bool
+}
+
+// getAnnotatedDisks returns the disks of the machine referenced by the given annotation, a comma separated
+// list of data disk LUNs where annotatedOSDisk stands for the OS disk. It returns nil when the annotation is not set.
+func (s *Reconciler) getAnnotatedDisks(annotation string) ([]annotatedDisk, error) {
+	value, ok := s.scope.Machine.Annotations[annotation]
+	if !ok {
+		return nil, nil
 	}
-	var userDataSecret apicorev1.Secret
 
-	if err := s.scope.CoreClient.Get(context.Background(), client.ObjectKey{Namespace: s.scope.Namespace(), Name: s.scope.MachineConfig.UserDataSecret.Name}, &userDataSecret); err != nil {
-		return "", fmt.Errorf("error getting user data secret %s in namespace %s: %w", s.scope.MachineConfig.UserDataSecret.Name, s.scope.Namespace(), err)
+	dataDisks := map[int32]machinev1.DataDisk{}
+	for _, disk := range s.getDataDisks() {
+		dataDisks[disk.Lun] = disk
 	}
-	data, exists := userDataSecret.Data["userData"]
-	if !exists {
-		return "", fmt.Errorf("Secret %v/%v does not have userData field set. Thus, no user data applied when creating an instance.", s.scope.Namespace(), s.scope.MachineConfig.UserDataSecret.Name)
+
+	var annotatedDisks []annotatedDisk
+	seen := sets.New[string]()
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if seen.Has(item) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references disk %s more than once", annotation, item)
+		}
+		seen.Insert(item)
+
+		if item == annotatedOSDisk {
+			osDisk := s.scope.MachineConfig.OSDisk
+			annotatedDisks = append(annotatedDisks, annotatedDisk{
+				name:               azure.GenerateOSDiskName(s.scope.Machine.Name),
+				description:        "the OS disk",
+				storageAccountType: osDisk.ManagedDisk.StorageAccountType,
+				cachingType:        osDisk.CachingType,
+				sizeGB:             osDisk.DiskSizeGB,
+				ephemeral:          osDisk.DiskSettings.EphemeralStorageLocation == "Local",
+			})
+			continue
+		}
+
+		lun, err := strconv.ParseInt(item, 10, 32)
+		if err != nil {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of data disk LUNs and %s for the OS disk, got %q",
+				annotation, annotatedOSDisk, value)
+		}
+		disk, ok := dataDisks[int32(lun)]
+		if !ok {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				annotation, lun)
+		}
+
+		storageAccountType := string(disk.ManagedDisk.StorageAccountType)
+		annotatedDisks = append(annotatedDisks, annotatedDisk{
+			name:               azure.GenerateDataDiskName(s.scope.Machine.Name, disk.NameSuffix),
+			description:        fmt.Sprintf("the data disk with lun %d", lun),
+			lun:                ptr.To(disk.Lun),
+			storageAccountType: storageAccountType,
+			cachingType:        string(disk.CachingType),
+			sizeGB:             disk.DiskSizeGB,
+		})
 	}
 
-	return base64.StdEncoding.EncodeToString(data), nil
+	return annotatedDisks, nil
 }
 
-func (s *Reconciler) getOrCreateAvailabilitySet() (string, error) {
-	if s.scope.MachineConfig.AvailabilitySet != "" {
-		return s.scope.MachineConfig.AvailabilitySet, nil
+// getDiskBursting returns the disks the machine annotations request on-demand bursting to be enabled on,
+// after making sure each of them is a premium disk large enough to support it.
+func (s *Reconciler) getDiskBursting() ([]*disks.BurstingSpec, error) {
+	annotatedDisks, err := s.getAnnotatedDisks(MachineDiskBurstingAnnotationName)
+	if err != nil || annotatedDisks == nil {
+		return nil, err
 	}
 
-	// Try to find the zone for the machine location
-	availabilityZones, err := s.availabilityZonesSvc.Get(context.Background(), &availabilityzones.Spec{
-		VMSize: s.scope.MachineConfig.VMSize,
-	})
-	if err != nil {
-		return "", err
+	// On-demand bursting of disks can not be enabled on Azure Stack Hub.
+	if s.scope.IsStackHub() {
+		return nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineDiskBurstingAnnotationName)
 	}
 
-	availabilityZonesSlice, ok := availabilityZones.([]string)
-	if !ok {
-		return "", fmt.Errorf("unexpected type %T", availabilityZones)
+	var specs []*disks.BurstingSpec
+	for _, disk := range annotatedDisks {
+		if disk.ephemeral {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references the OS disk, which is an ephemeral disk that does not support bursting",
+				MachineDiskBurstingAnnotationName)
+		}
+
+		if disk.storageAccountType != string(compute.StorageAccountTypesPremiumLRS) && disk.storageAccountType != string(compute.StorageAccountTypesPremiumZRS) {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references %s of storage account type %q, only %q and %q disks support bursting",
+				MachineDiskBurstingAnnotationName, disk.description, disk.storageAccountType, compute.StorageAccountTypesPremiumLRS, compute.StorageAccountTypesPremiumZRS)
+		}
+
+		if disk.sizeGB < azure.MinDiskBurstingSizeGB {
+			return nil, machinecontroller.InvalidMachineConfiguration("annotation %s references %s of %d GiB, only disks of at least %d GiB support bursting",
+				MachineDiskBurstingAnnotationName, disk.description, disk.sizeGB, azure.MinDiskBurstingSizeGB)
+		}
+
+		specs = append(specs, &disks.BurstingSpec{
+			Name:    disk.name,
+			Enabled: true,
+		})
 	}
 
-	if len(availabilityZonesSlice) != 0 {
-		klog.V(4).Infof("No availability set needed for %s because availability zones were found", s.scope.Machine.Name)
-		return "", nil
+	return specs, nil
+}
+
+// getWriteAcceleratedDisks returns whether the machine annotations request write accelerator on the OS disk and the LUNs
+// of the data disks they request it on, after making sure the VMSize supports write accelerator on that many disks and
+// each of them is a premium managed disk without read-write caching.
+func (s *Reconciler) getWriteAcceleratedDisks(ctx context.Context) (bool, []int32, error) {
+	annotatedDisks, err := s.getAnnotatedDisks(MachineWriteAcceleratorAnnotationName)
+	if err != nil || annotatedDisks == nil {
+		return false, nil, err
 	}
 
-	if _, ok := s.scope.Machine.Labels[MachineSetLabelName]; !ok {
-		klog.V(4).Infof("MachineSet label name was not found for %s, skipping availability set creation", s.scope.Machine.Name)
-		return "", nil
+	// Write accelerator is only available on M-series VM sizes, which Azure Stack Hub does not offer.
+	if s.scope.IsStackHub() {
+		return false, nil, machinecontroller.InvalidMachineConfiguration("annotation %s is not supported on Azure Stack Hub", MachineWriteAcceleratorAnnotationName)
 	}
 
-	if s.scope.MachineConfig.SpotVMOptions != nil {
-		klog.V(4).Infof("MachineSet %s uses spot instances, skipping availability set creation", s.scope.Machine.Name)
-		return "", nil
+	osDisk := false
+	var luns []int32
+	for _, disk := range annotatedDisks {
+		if disk.ephemeral {
+			return false, nil, machinecontroller.InvalidMachineConfiguration("annotation %s references the OS disk, which is an ephemeral disk that does not support write accelerator",
+				MachineWriteAcceleratorAnnotationName)
+		}
+
+		if disk.storageAccountType != string(compute.StorageAccountTypesPremiumLRS) {
+			return false, nil, machinecontroller.InvalidMachineConfiguration("annotation %s references %s of storage account type %q, only %q disks support write accelerator",
+				MachineWriteAcceleratorAnnotationName, disk.description, disk.storageAccountType, compute.StorageAccountTypesPremiumLRS)
+		}
+
+		// Managed OS disks are cached read-write when no caching type is set.
+		cachingType := disk.cachingType
+		if cachingType == "" && disk.lun == nil {
+			cachingType = string(compute.CachingTypesReadWrite)
+		}
+		if cachingType == string(compute.CachingTypesReadWrite) {
+			return false, nil, machinecontroller.InvalidMachineConfiguration("annotation %s references %s with %q caching, write accelerator requires %q or %q caching",
+				MachineWriteAcceleratorAnnotationName, disk.description, cachingType, compute.CachingTypesNone, compute.CachingTypesReadOnly)
+		}
+
+		if disk.lun == nil {
+			osDisk = true
+		} else {
+			luns = append(luns, *disk.lun)
+		}
 	}
 
-	klog.V(4).Infof("No availability zones were found for %s, an availability set will be created", s.scope.Machine.Name)
+	skuI, err := s.resourcesSkus.Get(ctx, resourceskus.Spec{
+		Name:         s.scope.MachineConfig.VMSize,
+		ResourceType: resourceskus.VirtualMachines,
+	})
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", s.scope.MachineConfig.VMSize, err)
+	}
 
-	if err := s.availabilitySetsSvc.CreateOrUpdate(context.Background(), &availabilitysets.Spec{
-		Name: s.getAvailabilitySetName(),
-	}); err != nil {
-		return "", err
+	sku := skuI.(resourceskus.SKU)
+	if _, ok := sku.GetCapability(resourceskus.MaxWriteAcceleratorDisksAllowed); !ok {
+		return false, nil, machinecontroller.InvalidMachineConfiguration("VMSize '%s' does not support write accelerator, which is requested by annotation %s",
+			s.scope.MachineConfig.VMSize, MachineWriteAcceleratorAnnotationName)
 	}
 
-	return s.getAvailabilitySetName(), nil
+	fits, err := sku.HasCapabilityWithCapacity(resourceskus.MaxWriteAcceleratorDisksAllowed, int64(len(annotatedDisks)))
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to obtain the %s of VMSize '%s': %w", resourceskus.MaxWriteAcceleratorDisksAllowed, s.scope.MachineConfig.VMSize, err)
+	}
+	if !fits {
+		allowed, _ := sku.GetCapability(resourceskus.MaxWriteAcceleratorDisksAllowed)
+		return false, nil, machinecontroller.InvalidMachineConfiguration("annotation %s requests write accelerator on %d disks, VMSize '%s' allows it on %s disks",
+			MachineWriteAcceleratorAnnotationName, len(annotatedDisks), s.scope.MachineConfig.VMSize, allowed)
+	}
+
+	return osDisk, luns, nil
 }
 
-// getAvailabilitySetName uses the MachineSet name and the cluster name to
-// generate an availability set name with the format
-// `<Cluster Name>_<MachineSet Name>-as`. Due to an 80 character restriction
-// on availability set names, if the MachineSet name starts with the cluster
-// name, then it will not be added a second time and the availability set name
-// will be `<MachineSet Name>-as`.
-// see https://docs.microsoft.com/en-us/azure/azure-resource-manager/management/resource-name-rules#microsoftcompute
-func (s *Reconciler) getAvailabilitySetName() string {
-	asname := ""
-	if strings.HasPrefix(s.scope.Machine.Labels[MachineSetLabelName], s.scope.Machine.Labels[machinev1.MachineClusterIDLabel]) {
-		asname = s.scope.Machine.Labels[MachineSetLabelName]
-	} else {
-		asname = fmt.Sprintf("%s_%s",
-			s.scope.Machine.Labels[machinev1.MachineClusterIDLabel],
-			s.scope.Machine.Labels[MachineSetLabelName])
+// reconcileDiskBursting enables on-demand bursting on the disks requested by the machine annotations.
+// Bursting has to be enabled on the disks themselves as the VM API does not allow setting it on the attached disks.
+func (s *Reconciler) reconcileDiskBursting(ctx context.Context, resourceGroup string) error {
+	specs, err := s.getDiskBursting()
+	if err != nil {
+		return err
 	}
-	// due to the 80 character name limit, if the proposed name will be 77 or more
-	// characters, we truncate the name before adding `-as`
-	if len(asname) >= 77 { // 80 char minus room for adding `-as`
-		asname = asname[:77]
+
+	for _, spec := range specs {
+		spec.ResourceGroup = resourceGroup
+		if err := s.disksSvc.CreateOrUpdate(ctx, spec); err != nil {
+			return err
+		}
 	}
-	asname = fmt.Sprintf("%s-as", asname)
-	return asname
+
+	return nil
 }
 
-// createDiagnosticsConfig sets up the diagnostics configuration for the virtual machine.
-func createDiagnosticsConfig(config *machinev1.AzureMachineProviderSpec) (*compute.DiagnosticsProfile, error) {
-	boot := config.Diagnostics.Boot
-	if boot == nil {
-		return nil, nil
+// validateCapacityReservation checks that the capacity reservation group contains a reservation
+// matching the VMSize and zone of the machine, otherwise the VM would never use the reserved capacity.
+func (s *Reconciler) validateCapacityReservation(ctx context.Context, capacityReservationGroupID, zone string) error {
+	reservationsInterface, err := s.capacityReservationsSvc.Get(ctx, &capacityreservations.Spec{
+		GroupID: capacityReservationGroupID,
+	})
+	if err != nil {
+		if azure.ResourceNotFound(err) {
+			return machinecontroller.InvalidMachineConfiguration("capacity reservation group %s not found: %v", capacityReservationGroupID, err)
+		}
+		return fmt.Errorf("failed to get capacity reservations: %w", err)
 	}
 
-	switch boot.StorageAccountType {
-	case machinev1.AzureManagedAzureDiagnosticsStorage:
-		return &compute.DiagnosticsProfile{
-			BootDiagnostics: &compute.BootDiagnostics{
-				Enabled: ptr.To[bool](true),
-			},
-		}, nil
-	case machinev1.CustomerManagedAzureDiagnosticsStorage:
-		if boot.CustomerManaged == nil || boot.CustomerManaged.StorageAccountURI == "" {
-			return nil, machinecontroller.InvalidMachineConfiguration("missing configuration for customer managed storage account URI")
+	reservations, ok := reservationsInterface.([]compute.CapacityReservation)
+	if !ok {
+		return fmt.Errorf("capacity reservations get returned invalid capacity reservations, getting %T instead", reservationsInterface)
+	}
+
+	sizeReserved := false
+	for _, reservation := range reservations {
+		if reservation.Sku == nil || !strings.EqualFold(ptr.Deref(reservation.Sku.Name, ""), s.scope.MachineConfig.VMSize) {
+			continue
 		}
+		sizeReserved = true
 
-		return &compute.DiagnosticsProfile{
-			BootDiagnostics: &compute.BootDiagnostics{
-				Enabled:    ptr.To[bool](true),
-				StorageURI: ptr.To[string](boot.CustomerManaged.StorageAccountURI),
-			},
-		}, nil
-	default:
-		return nil, machinecontroller.InvalidMachineConfiguration(
-			"unknown storage account type for boot diagnostics: %q, supported types are %s & %s",
-			boot.StorageAccountType,
-			machinev1.AzureManagedAzureDiagnosticsStorage,
-			machinev1.CustomerManagedAzureDiagnosticsStorage,
-		)
+		reservationZones := ptr.Deref(reservation.Zones, []string{})
+		if zone == "" && len(reservationZones) == 0 {
+			return nil
+		}
+		for _, reservationZone := range reservationZones {
+			if reservationZone == zone {
+				return nil
+			}
+		}
 	}
-}
 
-func validateAzureCapacityReservationGroupID(capacityReservationGroupID string) error {
-	id := strings.TrimPrefix(capacityReservationGroupID, azureProviderIDPrefix)
-	err := parseAzureResourceID(id)
-	if err != nil {
-		return err
+	if !sizeReserved {
+		return machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s",
+			capacityReservationGroupID, s.scope.MachineConfig.VMSize)
 	}
-	return nil
+	if zone == "" {
+		return machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no non-zonal reservation for VMSize %s",
+			capacityReservationGroupID, s.scope.MachineConfig.VMSize)
+	}
+	return machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s in zone %s",
+		capacityReservationGroupID, s.scope.MachineConfig.VMSize, zone)
 }
 
 // parseAzureResourceID parses a string to an instance of ResourceID
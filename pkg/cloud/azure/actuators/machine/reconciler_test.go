@@ -2,12 +2,17 @@ package machine
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
 	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/gomega"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
@@ -16,9 +21,28 @@ import (
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/decode"
 	mock_azure "github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/mock"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/availabilitysets"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/capacityreservations"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/diskencryptionsets"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/disks"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/images"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/marketplace"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/networkinterfaces"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/publicips"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/virtualmachines"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	controllerfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 func TestExists(t *testing.T) {
@@ -304,6 +328,55 @@ func TestSetMachineCloudProviderSpecificsTable(t *testing.T) {
 				machinecontroller.MachineInterruptibleInstanceLabelName: "",
 			},
 		},
+		{
+			name:  "with a vm in an availability set, proximity placement group and dedicated host",
+			scope: func(t *testing.T) *actuators.MachineScope { return newFakeScope(t, "placed-worker") },
+			vm: decode.VirtualMachine{
+				VirtualMachineProperties: &decode.VirtualMachineProperties{
+					AvailabilitySet: &decode.SubResource{
+						ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as"),
+					},
+					ProximityPlacementGroup: &decode.SubResource{
+						ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"),
+					},
+					Host: &decode.SubResource{
+						ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hg/hosts/host"),
+					},
+				},
+			},
+			expectedLabels: map[string]string{
+				actuators.MachineRoleLabel:      "placed-worker",
+				machinev1.MachineClusterIDLabel: "clusterID",
+			},
+			expectedAnnotations: map[string]string{
+				MachineInstanceStateAnnotationName:                 "",
+				MachinePlacedAvailabilitySetAnnotationName:         "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as",
+				MachinePlacedProximityPlacementGroupAnnotationName: "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg",
+				MachinePlacedHostAnnotationName:                    "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hg/hosts/host",
+			},
+			expectedSpecLabels: nil,
+		},
+		{
+			name: "with a vm no longer in an availability set",
+			scope: func(t *testing.T) *actuators.MachineScope {
+				scope := newFakeScope(t, "unplaced-worker")
+				scope.Machine.Annotations = map[string]string{
+					MachinePlacedAvailabilitySetAnnotationName: "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as",
+				}
+				return scope
+			},
+			vm: decode.VirtualMachine{
+				VirtualMachineProperties: &decode.VirtualMachineProperties{},
+			},
+			expectedLabels: map[string]string{
+				actuators.MachineRoleLabel:      "unplaced-worker",
+				machinev1.MachineClusterIDLabel: "clusterID",
+			},
+			expectedAnnotations: map[string]string{
+				MachineInstanceStateAnnotationName: "",
+			},
+			expectedSpecLabels: nil,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -321,6 +394,90 @@ func TestSetMachineCloudProviderSpecificsTable(t *testing.T) {
 	}
 }
 
+func TestSetMachineCloudProviderSpecificsPlacementFromDecodedVM(t *testing.T) {
+	g := NewWithT(t)
+
+	vm, err := decode.GetVirtualMachine(compute.VirtualMachine{
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			AvailabilitySet: &compute.SubResource{
+				ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as"),
+			},
+			ProximityPlacementGroup: &compute.SubResource{
+				ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"),
+			},
+			Host: &compute.SubResource{
+				ID: ptr.To[string]("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hg/hosts/host"),
+			},
+		},
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	r := newFakeReconcilerWithScope(t, newFakeScope(t, actuators.Node))
+	r.setMachineCloudProviderSpecifics(vm)
+
+	g.Expect(r.scope.Machine.Annotations).To(HaveKeyWithValue(MachinePlacedAvailabilitySetAnnotationName, "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as"))
+	g.Expect(r.scope.Machine.Annotations).To(HaveKeyWithValue(MachinePlacedProximityPlacementGroupAnnotationName, "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"))
+	g.Expect(r.scope.Machine.Annotations).To(HaveKeyWithValue(MachinePlacedHostAnnotationName, "/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/hostGroups/hg/hosts/host"))
+}
+
+func TestSetMachineCloudProviderSpecificsImageVersionFromDecodedVM(t *testing.T) {
+	testCases := []struct {
+		name               string
+		imageReference     *compute.ImageReference
+		annotations        map[string]string
+		expectedAnnotation string
+	}{
+		{
+			name: "Latest image version resolved by Azure",
+			imageReference: &compute.ImageReference{
+				Publisher:    ptr.To("azureopenshift"),
+				Offer:        ptr.To("aro4"),
+				Sku:          ptr.To("aro_413"),
+				Version:      ptr.To("latest"),
+				ExactVersion: ptr.To("413.92.20230614"),
+			},
+			expectedAnnotation: "413.92.20230614",
+		},
+		{
+			name: "Image version not reported keeps the recorded one",
+			imageReference: &compute.ImageReference{
+				ID: ptr.To("/subscriptions/123/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0"),
+			},
+			annotations:        map[string]string{MachineImageVersionAnnotationName: "1.0.0"},
+			expectedAnnotation: "1.0.0",
+		},
+		{
+			name: "No image reference",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vm, err := decode.GetVirtualMachine(compute.VirtualMachine{
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					StorageProfile: &compute.StorageProfile{
+						ImageReference: tc.imageReference,
+					},
+				},
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+			r.setMachineCloudProviderSpecifics(vm)
+
+			if tc.expectedAnnotation == "" {
+				g.Expect(r.scope.Machine.Annotations).ToNot(HaveKey(MachineImageVersionAnnotationName))
+				return
+			}
+			g.Expect(r.scope.Machine.Annotations).To(HaveKeyWithValue(MachineImageVersionAnnotationName, tc.expectedAnnotation))
+		})
+	}
+}
+
 func TestCreateAvailabilitySet(t *testing.T) {
 	g := NewGomegaWithT(t)
 	mockCtrl := gomock.NewController(t)
@@ -334,6 +491,8 @@ func TestCreateAvailabilitySet(t *testing.T) {
 		availabilityZonesSvc func() *mock_azure.MockService
 		inputASName          string
 		spotVMOptions        *machinev1.SpotVMOptions
+		standaloneAS         bool
+		annotations          map[string]string
 	}{
 		{
 			name:          "Error when availability zones client fails",
@@ -415,6 +574,37 @@ func TestCreateAvailabilitySet(t *testing.T) {
 				return availabilitySetsSvc
 			},
 		},
+		{
+			name:           "Create an availability set named after the machine when MachineSet label name is missing and standalone availability sets are enabled",
+			labels:         map[string]string{machinev1.MachineClusterIDLabel: "cluster"},
+			standaloneAS:   true,
+			expectedASName: "cluster_machine-as",
+			availabilityZonesSvc: func() *mock_azure.MockService {
+				availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+				availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{}, nil).Times(1)
+				return availabilityZonesSvc
+			},
+			availabilitySetsSvc: func() *mock_azure.MockService {
+				availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+				availabilitySetsSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				return availabilitySetsSvc
+			},
+		},
+		{
+			name:           "Use the MachineSet name when standalone availability sets are enabled and the MachineSet label is present",
+			standaloneAS:   true,
+			expectedASName: "cluster_ms-as",
+			availabilityZonesSvc: func() *mock_azure.MockService {
+				availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+				availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{}, nil).Times(1)
+				return availabilityZonesSvc
+			},
+			availabilitySetsSvc: func() *mock_azure.MockService {
+				availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+				availabilitySetsSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				return availabilitySetsSvc
+			},
+		},
 		{
 			name: "Skip availability set creation when using Spot instances",
 			availabilityZonesSvc: func() *mock_azure.MockService {
@@ -449,6 +639,20 @@ func TestCreateAvailabilitySet(t *testing.T) {
 				return availabilitySetsSvc
 			},
 		},
+		{
+			name:        "Skip availability set creation for regional machines",
+			annotations: map[string]string{MachineRegionalAnnotationName: "true"},
+			availabilityZonesSvc: func() *mock_azure.MockService {
+				availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+				availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{}, nil).Times(0)
+				return availabilityZonesSvc
+			},
+			availabilitySetsSvc: func() *mock_azure.MockService {
+				availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+				availabilitySetsSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(0)
+				return availabilitySetsSvc
+			},
+		},
 		{
 			name:           "Availability set does not contain double cluster name when it is present in MachineSet name",
 			labels:         map[string]string{MachineSetLabelName: "clustername-msname", machinev1.MachineClusterIDLabel: "clustername"},
@@ -497,7 +701,9 @@ func TestCreateAvailabilitySet(t *testing.T) {
 				scope: &actuators.MachineScope{
 					Machine: &machinev1.Machine{
 						ObjectMeta: metav1.ObjectMeta{
-							Labels: labels,
+							Name:        "machine",
+							Labels:      labels,
+							Annotations: tc.annotations,
 						},
 					},
 					MachineConfig: &machinev1.AzureMachineProviderSpec{
@@ -505,10 +711,11 @@ func TestCreateAvailabilitySet(t *testing.T) {
 						AvailabilitySet: tc.inputASName,
 						SpotVMOptions:   tc.spotVMOptions,
 					},
+					Options: actuators.Options{StandaloneAvailabilitySetEnabled: tc.standaloneAS},
 				},
 			}
 
-			asName, err := r.getOrCreateAvailabilitySet()
+			asName, err := r.getOrCreateAvailabilitySet(context.TODO())
 			if tc.expectedError {
 				g.Expect(err).To(HaveOccurred())
 			} else {
@@ -520,139 +727,291 @@ func TestCreateAvailabilitySet(t *testing.T) {
 	}
 }
 
-func TestCreateDiagnosticsConfig(t *testing.T) {
+func TestGetRegional(t *testing.T) {
 	testCases := []struct {
-		name           string
-		config         *machinev1.AzureMachineProviderSpec
-		expectedConfig *compute.DiagnosticsProfile
-		expectedError  error
+		name             string
+		annotations      map[string]string
+		zone             string
+		availabilitySet  string
+		publicIP         bool
+		expectedRegional bool
+		expectedError    error
 	}{
 		{
-			name:           "with no boot configuration",
-			config:         &machinev1.AzureMachineProviderSpec{},
-			expectedConfig: nil,
-			expectedError:  nil,
+			name: "Not regional by default",
 		},
 		{
-			name: "with no storage account type",
-			config: &machinev1.AzureMachineProviderSpec{
-				Diagnostics: machinev1.AzureDiagnostics{
-					Boot: &machinev1.AzureBootDiagnostics{},
-				},
-			},
-			expectedConfig: nil,
-			expectedError:  machinecontroller.InvalidMachineConfiguration("unknown storage account type for boot diagnostics: \"\", supported types are AzureManaged & CustomerManaged"),
+			name:             "Regional",
+			annotations:      map[string]string{MachineRegionalAnnotationName: "true"},
+			expectedRegional: true,
 		},
 		{
-			name: "with an invalid storage account type",
-			config: &machinev1.AzureMachineProviderSpec{
-				Diagnostics: machinev1.AzureDiagnostics{
-					Boot: &machinev1.AzureBootDiagnostics{
-						StorageAccountType: machinev1.AzureBootDiagnosticsStorageAccountType("foo"),
-					},
-				},
-			},
-			expectedConfig: nil,
-			expectedError:  machinecontroller.InvalidMachineConfiguration("unknown storage account type for boot diagnostics: \"foo\", supported types are AzureManaged & CustomerManaged"),
+			name:        "Not regional",
+			annotations: map[string]string{MachineRegionalAnnotationName: "false"},
+			zone:        "1",
 		},
 		{
-			name: "with an Azure managed storage account",
-			config: &machinev1.AzureMachineProviderSpec{
-				Diagnostics: machinev1.AzureDiagnostics{
-					Boot: &machinev1.AzureBootDiagnostics{
-						StorageAccountType: machinev1.AzureManagedAzureDiagnosticsStorage,
-					},
-				},
-			},
-			expectedConfig: &compute.DiagnosticsProfile{
-				BootDiagnostics: &compute.BootDiagnostics{
-					Enabled: ptr.To[bool](true),
-				},
-			},
-			expectedError: nil,
+			name:        "Invalid value",
+			annotations: map[string]string{MachineRegionalAnnotationName: "yes please"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q",
+				MachineRegionalAnnotationName, "yes please"),
 		},
 		{
-			name: "with an Customer managed storage account with no account URI",
-			config: &machinev1.AzureMachineProviderSpec{
-				Diagnostics: machinev1.AzureDiagnostics{
-					Boot: &machinev1.AzureBootDiagnostics{
-						StorageAccountType: machinev1.CustomerManagedAzureDiagnosticsStorage,
-					},
-				},
+			name:        "Regional machine in a zone",
+			annotations: map[string]string{MachineRegionalAnnotationName: "true"},
+			zone:        "1",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine in zone %q",
+				MachineRegionalAnnotationName, "1"),
+		},
+		{
+			name:            "Regional machine in an availability set",
+			annotations:     map[string]string{MachineRegionalAnnotationName: "true"},
+			availabilitySet: "test-as",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine in availability set %q",
+				MachineRegionalAnnotationName, "test-as"),
+		},
+		{
+			name: "Regional machine with a basic public IP",
+			annotations: map[string]string{
+				MachineRegionalAnnotationName:    "true",
+				MachinePublicIPSKUAnnotationName: "Basic",
 			},
-			expectedConfig: nil,
-			expectedError:  machinecontroller.InvalidMachineConfiguration("missing configuration for customer managed storage account URI"),
+			publicIP: true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires a %s public IP, got %s",
+				MachineRegionalAnnotationName, network.PublicIPAddressSkuNameStandard, network.PublicIPAddressSkuNameBasic),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.Zone = tc.zone
+			scope.MachineConfig.AvailabilitySet = tc.availabilitySet
+			scope.MachineConfig.PublicIP = tc.publicIP
+			r := newFakeReconcilerWithScope(t, scope)
+
+			regional, err := r.getRegional()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(regional).To(Equal(tc.expectedRegional))
+			}
+		})
+	}
+}
+
+func TestGetPublicIPZones(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		zone              string
+		availabilitySet   string
+		availabilityZones []string
+		expectedZones     []string
+		expectedError     error
+	}{
+		{
+			name: "Zonal machine",
+			zone: "2",
 		},
 		{
-			name: "with an Customer managed storage account with a valid account URI",
-			config: &machinev1.AzureMachineProviderSpec{
-				Diagnostics: machinev1.AzureDiagnostics{
-					Boot: &machinev1.AzureBootDiagnostics{
-						StorageAccountType: machinev1.CustomerManagedAzureDiagnosticsStorage,
-						CustomerManaged: &machinev1.AzureCustomerManagedBootDiagnostics{
-							StorageAccountURI: "https://myaccount.blob.windows.net/",
-						},
-					},
-				},
+			name:            "Machine in an availability set",
+			availabilitySet: "test-as",
+		},
+		{
+			name:              "Regional machine in a region with availability zones",
+			annotations:       map[string]string{MachineRegionalAnnotationName: "true"},
+			availabilityZones: []string{"1", "2", "3"},
+			expectedZones:     []string{"1", "2", "3"},
+		},
+		{
+			name:              "Regional machine in a region without availability zones",
+			annotations:       map[string]string{MachineRegionalAnnotationName: "true"},
+			availabilityZones: []string{},
+		},
+		{
+			name:              "Zonal public IP",
+			annotations:       map[string]string{MachinePublicIPZonesAnnotationName: "zonal"},
+			zone:              "2",
+			availabilityZones: []string{"1", "2", "3"},
+			expectedZones:     []string{"2"},
+		},
+		{
+			name:              "Zone-redundant public IP of a zonal machine",
+			annotations:       map[string]string{MachinePublicIPZonesAnnotationName: "ZoneRedundant"},
+			zone:              "2",
+			availabilityZones: []string{"1", "2", "3"},
+			expectedZones:     []string{"1", "2", "3"},
+		},
+		{
+			name: "Regional public IP of a regional machine",
+			annotations: map[string]string{
+				MachineRegionalAnnotationName:      "true",
+				MachinePublicIPZonesAnnotationName: "Regional",
 			},
-			expectedConfig: &compute.DiagnosticsProfile{
-				BootDiagnostics: &compute.BootDiagnostics{
-					Enabled:    ptr.To[bool](true),
-					StorageURI: ptr.To[string]("https://myaccount.blob.windows.net/"),
-				},
+		},
+		{
+			name:        "Zonal public IP of a machine without a zone",
+			annotations: map[string]string{MachinePublicIPZonesAnnotationName: "Zonal"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on a machine without a zone",
+				MachinePublicIPZonesAnnotationName, "Zonal"),
+		},
+		{
+			name:              "Zonal public IP in a zone the region does not have",
+			annotations:       map[string]string{MachinePublicIPZonesAnnotationName: "Zonal"},
+			zone:              "4",
+			availabilityZones: []string{"1", "2", "3"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires zone %q of the machine to be an availability zone of the region, available zones are %v",
+				MachinePublicIPZonesAnnotationName, "4", []string{"1", "2", "3"}),
+		},
+		{
+			name:              "Zone-redundant public IP in a region without availability zones",
+			annotations:       map[string]string{MachinePublicIPZonesAnnotationName: "ZoneRedundant"},
+			availabilityZones: []string{},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s in a region without availability zones",
+				MachinePublicIPZonesAnnotationName, "ZoneRedundant"),
+		},
+		{
+			name: "Zone-redundant Basic public IP",
+			annotations: map[string]string{
+				MachinePublicIPZonesAnnotationName: "ZoneRedundant",
+				MachinePublicIPSKUAnnotationName:   "Basic",
 			},
-			expectedError: nil,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be %s on a %s public IP",
+				MachinePublicIPZonesAnnotationName, "ZoneRedundant", network.PublicIPAddressSkuNameBasic),
+		},
+		{
+			name:        "Invalid public IP zone placement",
+			annotations: map[string]string{MachinePublicIPZonesAnnotationName: "everywhere"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPZonesAnnotationName, []string{"Zonal", "ZoneRedundant", "Regional"}, "everywhere"),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.availabilityZones != nil {
+				availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.availabilityZones, nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.Zone = tc.zone
+			scope.MachineConfig.AvailabilitySet = tc.availabilitySet
+			scope.MachineConfig.PublicIP = true
+			r := newFakeReconcilerWithScope(t, scope)
+			r.availabilityZonesSvc = availabilityZonesSvc
 
-			config, err := createDiagnosticsConfig(tc.config)
+			zones, err := r.getPublicIPZones(context.TODO())
 			if tc.expectedError != nil {
 				g.Expect(err).To(MatchError(tc.expectedError))
 			} else {
 				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(zones).To(Equal(tc.expectedZones))
 			}
-
-			g.Expect(config).To(Equal(tc.expectedConfig))
 		})
 	}
 }
 
-func TestValidateCapacityReservationGroupID(t *testing.T) {
+func TestCreateNetworkInterfaceRegionalPublicIP(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	publicIPSvc := mock_azure.NewMockService(mockCtrl)
+	publicIPSvc.EXPECT().CreateOrUpdate(gomock.Any(), &publicips.Spec{
+		Name:  "cluster-machine-test",
+		Zones: []string{"1", "2", "3"},
+	}).Return(nil).Times(1)
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+	availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{"1", "2", "3"}, nil).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.ClusterName = "cluster"
+	scope.MachineConfig.PublicIP = true
+	scope.MachineConfig.Zone = ""
+	scope.Machine.Annotations = map[string]string{MachineRegionalAnnotationName: "true"}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.publicIPSvc = publicIPSvc
+	r.networkInterfacesSvc = nicSvc
+	r.availabilityZonesSvc = availabilityZonesSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestGetOrCreateAvailabilitySetDomainCounts(t *testing.T) {
 	testCases := []struct {
 		name          string
-		inputID       string
+		annotations   map[string]string
+		expectedSpec  *availabilitysets.Spec
 		expectedError error
 	}{
 		{
-			name:          "validation for capacityReservationGroupID should return nil error if field input is valid",
-			inputID:       "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
-			expectedError: nil,
+			name:         "Default domain counts",
+			expectedSpec: &availabilitysets.Spec{Name: "cluster_ms-as"},
 		},
 		{
-			name:          "validation for capacityReservationGroupID should return error if field input does not start with '/'",
-			inputID:       "subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
-			expectedError: errors.New("invalid resource ID: resource id 'subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup' must start with '/'"),
+			name: "Requested domain counts",
+			annotations: map[string]string{
+				MachineAvailabilitySetFaultDomainCountAnnotationName:  "2",
+				MachineAvailabilitySetUpdateDomainCountAnnotationName: "10",
+			},
+			expectedSpec: &availabilitysets.Spec{Name: "cluster_ms-as", FaultDomainCount: ptr.To[int32](2), UpdateDomainCount: ptr.To[int32](10)},
 		},
 		{
-			name:          "validation for capacityReservationGroupID should return error if field input does not have field name subscriptions",
-			inputID:       "/subscripti/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
-			expectedError: errors.New("invalid resource ID: /subscripti/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"),
+			name:        "Invalid fault domain count",
+			annotations: map[string]string{MachineAvailabilitySetFaultDomainCountAnnotationName: "0"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a positive number, got %q",
+				MachineAvailabilitySetFaultDomainCountAnnotationName, "0"),
 		},
 		{
-			name:          "validation for capacityReservationGroupID should return error if field input is empty",
-			inputID:       "",
-			expectedError: errors.New("invalid resource ID: id cannot be empty"),
+			name:        "Invalid update domain count",
+			annotations: map[string]string{MachineAvailabilitySetUpdateDomainCountAnnotationName: "five"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a positive number, got %q",
+				MachineAvailabilitySetUpdateDomainCountAnnotationName, "five"),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			g := NewWithT(t)
-			err := validateAzureCapacityReservationGroupID(tc.inputID)
+			mockCtrl := gomock.NewController(t)
+
+			availabilityZonesSvc := mock_azure.NewMockService(mockCtrl)
+			availabilityZonesSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return([]string{}, nil).Times(1)
+
+			availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectedSpec != nil {
+				availabilitySetsSvc.EXPECT().CreateOrUpdate(gomock.Any(), tc.expectedSpec).Return(nil).Times(1)
+			}
+
+			r := Reconciler{
+				availabilityZonesSvc: availabilityZonesSvc,
+				availabilitySetsSvc:  availabilitySetsSvc,
+				scope: &actuators.MachineScope{
+					Machine: &machinev1.Machine{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:        "machine",
+							Labels:      map[string]string{MachineSetLabelName: "ms", machinev1.MachineClusterIDLabel: "cluster"},
+							Annotations: tc.annotations,
+						},
+					},
+					MachineConfig: &machinev1.AzureMachineProviderSpec{
+						VMSize: "Standard_D2_v2",
+					},
+				},
+			}
+
+			_, err := r.getOrCreateAvailabilitySet(context.TODO())
 			if tc.expectedError != nil {
 				g.Expect(err).To(MatchError(tc.expectedError))
 			} else {
@@ -661,3 +1020,6236 @@ func TestValidateCapacityReservationGroupID(t *testing.T) {
 		})
 	}
 }
+
+func TestCreateMachineRejectsAvailabilitySetWithZone(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.MachineConfig.AvailabilitySet = "availability-set"
+	scope.MachineConfig.Zone = "1"
+
+	// No Azure calls are expected for the conflicting configuration, all the services are strict mocks.
+	r := &Reconciler{
+		scope:                     scope,
+		availabilityZonesSvc:      mock_azure.NewMockService(mockCtrl),
+		interfaceLoadBalancersSvc: mock_azure.NewMockService(mockCtrl),
+		networkInterfacesSvc:      mock_azure.NewMockService(mockCtrl),
+		publicIPSvc:               mock_azure.NewMockService(mockCtrl),
+		virtualMachinesSvc:        mock_azure.NewMockService(mockCtrl),
+		virtualMachinesExtSvc:     mock_azure.NewMockService(mockCtrl),
+		disksSvc:                  mock_azure.NewMockService(mockCtrl),
+		availabilitySetsSvc:       mock_azure.NewMockService(mockCtrl),
+		resourcesSkus:             mock_azure.NewMockService(mockCtrl),
+		capacityReservationsSvc:   mock_azure.NewMockService(mockCtrl),
+		imagesSvc:                 mock_azure.NewMockService(mockCtrl),
+		diskEncryptionSetsSvc:     mock_azure.NewMockService(mockCtrl),
+	}
+
+	err := r.CreateMachine(context.TODO())
+	g.Expect(err).To(MatchError(machinecontroller.InvalidMachineConfiguration(
+		"availabilitySet %q and zone %q cannot both be set, a VM can either be placed in an availability set or in a zone", "availability-set", "1")))
+}
+
+func TestCreateVirtualMachineSecurityTypeCondition(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		securityProfile      *machinev1.SecurityProfile
+		osDiskEncryptionType machinev1.SecurityEncryptionTypes
+		expectedSecurityType string
+	}{
+		{
+			name:                 "no security profile",
+			expectedSecurityType: "Standard",
+		},
+		{
+			name: "security profile without security type",
+			securityProfile: &machinev1.SecurityProfile{
+				EncryptionAtHost: ptr.To(true),
+			},
+			expectedSecurityType: "Standard",
+		},
+		{
+			name: "trusted launch",
+			securityProfile: &machinev1.SecurityProfile{
+				Settings: machinev1.SecuritySettings{
+					SecurityType: machinev1.SecurityTypesTrustedLaunch,
+					TrustedLaunch: &machinev1.TrustedLaunch{
+						UEFISettings: machinev1.UEFISettings{
+							SecureBoot: machinev1.SecureBootPolicyEnabled,
+						},
+					},
+				},
+			},
+			expectedSecurityType: "TrustedLaunch",
+		},
+		{
+			name: "confidential VM",
+			securityProfile: &machinev1.SecurityProfile{
+				Settings: machinev1.SecuritySettings{
+					SecurityType: machinev1.SecurityTypesConfidentialVM,
+					ConfidentialVM: &machinev1.ConfidentialVM{
+						UEFISettings: machinev1.UEFISettings{
+							VirtualizedTrustedPlatformModule: machinev1.VirtualizedTrustedPlatformModulePolicyEnabled,
+						},
+					},
+				},
+			},
+			osDiskEncryptionType: machinev1.SecurityEncryptionTypesVMGuestStateOnly,
+			expectedSecurityType: "ConfidentialVM",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("vm not found")).Times(1)
+			vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			skusSvc := mock_azure.NewMockService(mockCtrl)
+			skusSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{
+				Capabilities: &[]compute.ResourceSkuCapabilities{
+					{
+						Name:  ptr.To(resourceskus.ConfidentialComputingType),
+						Value: ptr.To("SNP"),
+					},
+				},
+			}, nil).AnyTimes()
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.SecurityProfile = tc.securityProfile
+			scope.MachineConfig.OSDisk.ManagedDisk.SecurityProfile.SecurityEncryptionType = tc.osDiskEncryptionType
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.resourcesSkus = skusSvc
+
+			g.Expect(r.createVirtualMachine(context.TODO(), "nic", "")).To(Succeed())
+
+			condition := findCondition(scope.MachineStatus.Conditions, securityTypeConditionType)
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			g.Expect(condition.Reason).To(Equal(tc.expectedSecurityType))
+			// The security type is recorded in the provider status only.
+			g.Expect(scope.Machine.Status.Conditions).To(BeEmpty())
+		})
+	}
+}
+
+func TestCreateVirtualMachineNilProvisioningState(t *testing.T) {
+	testCases := []struct {
+		name          string
+		machineAge    time.Duration
+		expectRequeue bool
+		expectedError string
+	}{
+		{
+			name:          "VM initializing",
+			machineAge:    time.Minute,
+			expectRequeue: true,
+		},
+		{
+			name:          "VM initialization timed out",
+			machineAge:    time.Hour,
+			expectedError: "vm machine-test has a nil provisioning state 1h0m0s after the creation of the machine, reconcile",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID:                       ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{},
+			}, nil).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.CreationTimestamp = metav1.NewTime(time.Now().Add(-tc.machineAge))
+			scope.VMInitializationTimeout = 10 * time.Minute
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			err := r.createVirtualMachine(context.TODO(), "nic", "")
+			if tc.expectRequeue {
+				g.Expect(err).To(Equal(&machinecontroller.RequeueAfterError{RequeueAfter: vmInitializingRequeueAfter}))
+			} else {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			}
+		})
+	}
+}
+
+func TestUpdateNilProvisioningState(t *testing.T) {
+	testCases := []struct {
+		name string
+		vm   compute.VirtualMachine
+	}{
+		{
+			name: "VM without properties",
+			vm:   compute.VirtualMachine{ID: ptr.To("machine-test-ID")},
+		},
+		{
+			name: "VM without provisioning state",
+			vm: compute.VirtualMachine{
+				ID:                       ptr.To("machine-test-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.vm, nil).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+			scope.VMInitializationTimeout = 10 * time.Minute
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(Equal(&machinecontroller.RequeueAfterError{RequeueAfter: vmInitializingRequeueAfter}))
+			g.Expect(scope.MachineStatus.VMID).To(Equal(ptr.To("machine-test-ID")))
+		})
+	}
+}
+
+func TestGetVMProvisioningFailure(t *testing.T) {
+	testCases := []struct {
+		name            string
+		statuses        *[]compute.InstanceViewStatus
+		expectedFailure string
+	}{
+		{
+			name:            "No instance view statuses",
+			expectedFailure: "no failure details reported",
+		},
+		{
+			name: "Failed provisioning with a failure code",
+			statuses: &[]compute.InstanceViewStatus{
+				{
+					Code:          ptr.To("ProvisioningState/failed/ImageNotFound"),
+					Level:         compute.StatusLevelTypesError,
+					DisplayStatus: ptr.To("Provisioning failed"),
+					Message:       ptr.To("The platform image 'publisher:offer:sku:1.0' is not available."),
+				},
+			},
+			expectedFailure: "ImageNotFound: The platform image 'publisher:offer:sku:1.0' is not available.",
+		},
+		{
+			name: "Failed provisioning without a failure code",
+			statuses: &[]compute.InstanceViewStatus{
+				{
+					Code:          ptr.To("ProvisioningState/failed"),
+					Level:         compute.StatusLevelTypesError,
+					DisplayStatus: ptr.To("Provisioning failed"),
+					Message:       ptr.To("Operation results in exceeding quota limits of Core."),
+				},
+				{
+					Code:  ptr.To("PowerState/stopped"),
+					Level: compute.StatusLevelTypesInfo,
+				},
+			},
+			expectedFailure: "Provisioning failed: Operation results in exceeding quota limits of Core.",
+		},
+		{
+			name: "Several error statuses",
+			statuses: &[]compute.InstanceViewStatus{
+				{
+					Code:  ptr.To("ProvisioningState/failed/OSProvisioningTimedOut"),
+					Level: compute.StatusLevelTypesError,
+				},
+				{
+					Code:          ptr.To("OSProvisioningComplete/failed"),
+					Level:         compute.StatusLevelTypesError,
+					DisplayStatus: ptr.To("OS provisioning failed"),
+					Message:       ptr.To("The VM did not report its readiness in time."),
+				},
+			},
+			expectedFailure: "OSProvisioningTimedOut; OS provisioning failed: The VM did not report its readiness in time.",
+		},
+		{
+			name: "No error statuses",
+			statuses: &[]compute.InstanceViewStatus{
+				{
+					Code:  ptr.To("PowerState/running"),
+					Level: compute.StatusLevelTypesInfo,
+				},
+			},
+			expectedFailure: "no failure details reported",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			vm, err := decode.GetVirtualMachine(compute.VirtualMachine{
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Failed"),
+					InstanceView:      &compute.VirtualMachineInstanceView{Statuses: tc.statuses},
+				},
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(getVMProvisioningFailure(vm)).To(Equal(tc.expectedFailure))
+		})
+	}
+}
+
+func TestExistsNilProvisioningState(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	vmSvc := mock_azure.NewMockService(mockCtrl)
+	vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+		ID: ptr.To("machine-ID"),
+	}, nil).Times(1)
+
+	r := newFakeReconcilerWithScope(t, newFakeScope(t, actuators.Node))
+	r.virtualMachinesSvc = vmSvc
+
+	exists, err := r.Exists(context.TODO())
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(exists).To(BeTrue())
+}
+
+func TestCreateVirtualMachineAdminPasswordSecret(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		osType               string
+		secretEnabled        bool
+		expectSecret         bool
+		expectedUsernameData string
+		annotations          map[string]string
+	}{
+		{
+			name:                 "Windows machine with the admin password secret enabled",
+			osType:               "Windows",
+			secretEnabled:        true,
+			expectSecret:         true,
+			expectedUsernameData: azure.DefaultUserName,
+		},
+		{
+			name:                 "Windows machine with a custom admin username",
+			osType:               "Windows",
+			secretEnabled:        true,
+			expectSecret:         true,
+			expectedUsernameData: "winadmin",
+			annotations:          map[string]string{MachineAdminUsernameAnnotationName: "winadmin"},
+		},
+		{
+			name:          "Windows machine with the admin password secret disabled",
+			osType:        "Windows",
+			secretEnabled: false,
+		},
+		{
+			name:          "Linux machine with the admin password secret enabled",
+			osType:        "Linux",
+			secretEnabled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			var createdSpec *virtualmachines.Spec
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("vm not found")).Times(1)
+			vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+				createdSpec = spec.(*virtualmachines.Spec)
+				return nil
+			}).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Namespace = "openshift-machine-api"
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.OSDisk.OSType = tc.osType
+			scope.WindowsAdminPasswordSecretEnabled = tc.secretEnabled
+			scope.CoreClient = controllerfake.NewClientBuilder().Build()
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.createVirtualMachine(context.TODO(), "nic", "")).To(Succeed())
+			g.Expect(createdSpec).ToNot(BeNil())
+
+			secret := &corev1.Secret{}
+			err := scope.CoreClient.Get(context.TODO(), client.ObjectKey{Namespace: "openshift-machine-api", Name: "machine-test-admin-password"}, secret)
+			if !tc.expectSecret {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue(), "expected no admin password secret, got: %v", err)
+				g.Expect(createdSpec.AdminPassword).To(BeEmpty())
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(secret.Type).To(Equal(corev1.SecretTypeBasicAuth))
+			g.Expect(string(secret.Data[corev1.BasicAuthUsernameKey])).To(Equal(tc.expectedUsernameData))
+			g.Expect(secret.Data[corev1.BasicAuthPasswordKey]).ToNot(BeEmpty())
+			g.Expect(createdSpec.AdminPassword).To(Equal(string(secret.Data[corev1.BasicAuthPasswordKey])))
+			g.Expect(secret.OwnerReferences).To(ConsistOf(metav1.OwnerReference{
+				APIVersion: machinev1.GroupVersion.String(),
+				Kind:       "Machine",
+				Name:       scope.Machine.Name,
+				UID:        scope.Machine.UID,
+			}))
+		})
+	}
+}
+
+func TestGetOrCreateAdminPasswordSecret(t *testing.T) {
+	t.Run("generates the password only once", func(t *testing.T) {
+		g := NewWithT(t)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.CoreClient = controllerfake.NewClientBuilder().Build()
+		r := newFakeReconcilerWithScope(t, scope)
+
+		password, err := r.getOrCreateAdminPasswordSecret(context.TODO(), "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(password).ToNot(BeEmpty())
+
+		again, err := r.getOrCreateAdminPasswordSecret(context.TODO(), "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(again).To(Equal(password))
+	})
+
+	t.Run("returns the password of an existing secret", func(t *testing.T) {
+		g := NewWithT(t)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.CoreClient = controllerfake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "machine-test-admin-password",
+				Namespace: scope.Namespace(),
+			},
+			Data: map[string][]byte{
+				corev1.BasicAuthUsernameKey: []byte(azure.DefaultUserName),
+				corev1.BasicAuthPasswordKey: []byte("existing-password"),
+			},
+		}).Build()
+		r := newFakeReconcilerWithScope(t, scope)
+
+		password, err := r.getOrCreateAdminPasswordSecret(context.TODO(), "")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(password).To(Equal("existing-password"))
+	})
+
+	t.Run("fails when an existing secret has no password", func(t *testing.T) {
+		g := NewWithT(t)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.CoreClient = controllerfake.NewClientBuilder().WithObjects(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "machine-test-admin-password",
+				Namespace: scope.Namespace(),
+			},
+		}).Build()
+		r := newFakeReconcilerWithScope(t, scope)
+
+		_, err := r.getOrCreateAdminPasswordSecret(context.TODO(), "")
+		g.Expect(err).To(MatchError("secret /machine-test-admin-password does not have password field set"))
+	})
+}
+
+func TestCreateDiagnosticsConfig(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         *machinev1.AzureMachineProviderSpec
+		expectedConfig *compute.DiagnosticsProfile
+		expectedError  error
+	}{
+		{
+			name:           "with no boot configuration",
+			config:         &machinev1.AzureMachineProviderSpec{},
+			expectedConfig: nil,
+			expectedError:  nil,
+		},
+		{
+			name: "with no storage account type",
+			config: &machinev1.AzureMachineProviderSpec{
+				Diagnostics: machinev1.AzureDiagnostics{
+					Boot: &machinev1.AzureBootDiagnostics{},
+				},
+			},
+			expectedConfig: nil,
+			expectedError:  machinecontroller.InvalidMachineConfiguration("unknown storage account type for boot diagnostics: \"\", supported types are AzureManaged & CustomerManaged"),
+		},
+		{
+			name: "with an invalid storage account type",
+			config: &machinev1.AzureMachineProviderSpec{
+				Diagnostics: machinev1.AzureDiagnostics{
+					Boot: &machinev1.AzureBootDiagnostics{
+						StorageAccountType: machinev1.AzureBootDiagnosticsStorageAccountType("foo"),
+					},
+				},
+			},
+			expectedConfig: nil,
+			expectedError:  machinecontroller.InvalidMachineConfiguration("unknown storage account type for boot diagnostics: \"foo\", supported types are AzureManaged & CustomerManaged"),
+		},
+		{
+			name: "with an Azure managed storage account",
+			config: &machinev1.AzureMachineProviderSpec{
+				Diagnostics: machinev1.AzureDiagnostics{
+					Boot: &machinev1.AzureBootDiagnostics{
+						StorageAccountType: machinev1.AzureManagedAzureDiagnosticsStorage,
+					},
+				},
+			},
+			expectedConfig: &compute.DiagnosticsProfile{
+				BootDiagnostics: &compute.BootDiagnostics{
+					Enabled: ptr.To[bool](true),
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "with an Customer managed storage account with no account URI",
+			config: &machinev1.AzureMachineProviderSpec{
+				Diagnostics: machinev1.AzureDiagnostics{
+					Boot: &machinev1.AzureBootDiagnostics{
+						StorageAccountType: machinev1.CustomerManagedAzureDiagnosticsStorage,
+					},
+				},
+			},
+			expectedConfig: nil,
+			expectedError:  machinecontroller.InvalidMachineConfiguration("missing configuration for customer managed storage account URI"),
+		},
+		{
+			name: "with an Customer managed storage account with a valid account URI",
+			config: &machinev1.AzureMachineProviderSpec{
+				Diagnostics: machinev1.AzureDiagnostics{
+					Boot: &machinev1.AzureBootDiagnostics{
+						StorageAccountType: machinev1.CustomerManagedAzureDiagnosticsStorage,
+						CustomerManaged: &machinev1.AzureCustomerManagedBootDiagnostics{
+							StorageAccountURI: "https://myaccount.blob.core.windows.net/",
+						},
+					},
+				},
+			},
+			expectedConfig: &compute.DiagnosticsProfile{
+				BootDiagnostics: &compute.BootDiagnostics{
+					Enabled:    ptr.To[bool](true),
+					StorageURI: ptr.To[string]("https://myaccount.blob.core.windows.net/"),
+				},
+			},
+			expectedError: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			config, err := createDiagnosticsConfig(tc.config, autorestazure.PublicCloud.StorageEndpointSuffix)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Expect(config).To(Equal(tc.expectedConfig))
+		})
+	}
+}
+
+func TestCreateDiagnosticsConfigCloudEnvironments(t *testing.T) {
+	customerManaged := func(uri string) *machinev1.AzureMachineProviderSpec {
+		return &machinev1.AzureMachineProviderSpec{
+			Diagnostics: machinev1.AzureDiagnostics{
+				Boot: &machinev1.AzureBootDiagnostics{
+					StorageAccountType: machinev1.CustomerManagedAzureDiagnosticsStorage,
+					CustomerManaged: &machinev1.AzureCustomerManagedBootDiagnostics{
+						StorageAccountURI: uri,
+					},
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		environment   autorestazure.Environment
+		uri           string
+		expectedError error
+	}{
+		{
+			name:        "public cloud URI in the public cloud",
+			environment: autorestazure.PublicCloud,
+			uri:         "https://myaccount.blob.core.windows.net/",
+		},
+		{
+			name:        "US government cloud URI in the US government cloud",
+			environment: autorestazure.USGovernmentCloud,
+			uri:         "https://myaccount.blob.core.usgovcloudapi.net",
+		},
+		{
+			name:        "China cloud URI in the China cloud",
+			environment: autorestazure.ChinaCloud,
+			uri:         "https://myaccount.blob.core.chinacloudapi.cn/",
+		},
+		{
+			name:        "public cloud URI in the US government cloud",
+			environment: autorestazure.USGovernmentCloud,
+			uri:         "https://myaccount.blob.core.windows.net/",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "https://myaccount.blob.core.windows.net/",
+				errors.New(`storage endpoint suffix "core.windows.net" does not match the suffix "core.usgovcloudapi.net" of the cloud environment`)),
+		},
+		{
+			name:        "China cloud URI in the public cloud",
+			environment: autorestazure.PublicCloud,
+			uri:         "https://myaccount.blob.core.chinacloudapi.cn/",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "https://myaccount.blob.core.chinacloudapi.cn/",
+				errors.New(`storage endpoint suffix "core.chinacloudapi.cn" does not match the suffix "core.windows.net" of the cloud environment`)),
+		},
+		{
+			name:        "http scheme",
+			environment: autorestazure.PublicCloud,
+			uri:         "http://myaccount.blob.core.windows.net/",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "http://myaccount.blob.core.windows.net/",
+				errors.New("scheme must be https")),
+		},
+		{
+			name:        "not a blob endpoint",
+			environment: autorestazure.PublicCloud,
+			uri:         "https://myaccount.file.core.windows.net/",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "https://myaccount.file.core.windows.net/",
+				errors.New("must be of the form https://<account>.blob.core.windows.net/")),
+		},
+		{
+			name:        "URI with a path",
+			environment: autorestazure.PublicCloud,
+			uri:         "https://myaccount.blob.core.windows.net/container",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "https://myaccount.blob.core.windows.net/container",
+				errors.New("must be of the form https://<account>.blob.core.windows.net/")),
+		},
+		{
+			name:        "invalid storage account name",
+			environment: autorestazure.PublicCloud,
+			uri:         "https://My_Account.blob.core.windows.net/",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid customer managed storage account URI %q: %v", "https://My_Account.blob.core.windows.net/",
+				errors.New("must be of the form https://<account>.blob.core.windows.net/")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := createDiagnosticsConfig(customerManaged(tc.uri), tc.environment.StorageEndpointSuffix)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateCapacityReservationGroupID(t *testing.T) {
+	testCases := []struct {
+		name          string
+		inputID       string
+		expectedError error
+	}{
+		{
+			name:          "validation for capacityReservationGroupID should return nil error if field input is valid",
+			inputID:       "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
+			expectedError: nil,
+		},
+		{
+			name:          "validation for capacityReservationGroupID should return error if field input does not start with '/'",
+			inputID:       "subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
+			expectedError: errors.New("invalid resource ID: resource id 'subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup' must start with '/'"),
+		},
+		{
+			name:          "validation for capacityReservationGroupID should return error if field input does not have field name subscriptions",
+			inputID:       "/subscripti/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup",
+			expectedError: errors.New("invalid resource ID: /subscripti/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"),
+		},
+		{
+			name:          "validation for capacityReservationGroupID should return error if field input is empty",
+			inputID:       "",
+			expectedError: errors.New("invalid resource ID: id cannot be empty"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := validateAzureCapacityReservationGroupID(tc.inputID)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateDiskEncryptionSetLocations(t *testing.T) {
+	const (
+		desID      = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/diskEncryptionSets/myDES"
+		otherDESID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/diskEncryptionSets/otherDES"
+	)
+
+	testCases := []struct {
+		name          string
+		dataDiskDESID string
+		locations     map[string]string
+		getErr        error
+		expectedError error
+	}{
+		{
+			name:      "Disk encryption set in the location of the machine",
+			locations: map[string]string{desID: "eastus"},
+		},
+		{
+			name:      "Disk encryption set location differing only by case and spaces",
+			locations: map[string]string{desID: "East US"},
+		},
+		{
+			name:          "Disk encryption set referenced by several disks is fetched once",
+			dataDiskDESID: desID,
+			locations:     map[string]string{desID: "eastus"},
+		},
+		{
+			name:          "Disk encryption set in another location",
+			locations:     map[string]string{desID: "westeurope"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.diskEncryptionSet.id: disk encryption set %s is in location westeurope, it must be in the location eastus of the machine", desID),
+		},
+		{
+			name:          "Data disk encryption set in another location",
+			dataDiskDESID: otherDESID,
+			locations:     map[string]string{desID: "eastus", otherDESID: "westeurope"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[0].managedDisk.diskEncryptionSet.id: disk encryption set %s is in location westeurope, it must be in the location eastus of the machine", otherDESID),
+		},
+		{
+			name:          "Disk encryption set not found",
+			getErr:        autorest.DetailedError{StatusCode: 404},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.diskEncryptionSet.id: disk encryption set %s not found", desID),
+		},
+		{
+			name:          "Disk encryption set lookup failure",
+			getErr:        errors.New("test error"),
+			expectedError: fmt.Errorf("failed to get disk encryption set %s: test error", desID),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			diskEncryptionSetsSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.getErr != nil {
+				diskEncryptionSetsSvc.EXPECT().Get(gomock.Any(), &diskencryptionsets.Spec{ID: desID}).Return(nil, tc.getErr).Times(1)
+			}
+			for id, location := range tc.locations {
+				diskEncryptionSetsSvc.EXPECT().Get(gomock.Any(), &diskencryptionsets.Spec{ID: id}).Return(compute.DiskEncryptionSet{
+					ID:       ptr.To(id),
+					Location: ptr.To(location),
+				}, nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.Location = "eastus"
+			scope.MachineConfig.OSDisk.ManagedDisk.DiskEncryptionSet = &machinev1.DiskEncryptionSetParameters{ID: desID}
+			if tc.dataDiskDESID != "" {
+				scope.MachineConfig.DataDisks = []machinev1.DataDisk{{
+					ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+						DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: tc.dataDiskDESID},
+					},
+				}}
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.diskEncryptionSetsSvc = diskEncryptionSetsSvc
+
+			err := r.validateDiskEncryptionSetLocations(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError.Error()))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestValidateDiskEncryptionSetIDs(t *testing.T) {
+	const (
+		validID    = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/diskEncryptionSets/myDES"
+		keyVaultID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.KeyVault/vaults/myVault"
+	)
+
+	testCases := []struct {
+		name          string
+		config        *machinev1.AzureMachineProviderSpec
+		expectedError error
+	}{
+		{
+			name:   "no disk encryption sets",
+			config: &machinev1.AzureMachineProviderSpec{},
+		},
+		{
+			name: "valid disk encryption sets on OS and data disks",
+			config: &machinev1.AzureMachineProviderSpec{
+				OSDisk: machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: validID},
+						SecurityProfile: machinev1.VMDiskSecurityProfile{
+							DiskEncryptionSet: machinev1.DiskEncryptionSetParameters{ID: validID},
+						},
+					},
+				},
+				DataDisks: []machinev1.DataDisk{
+					{ManagedDisk: machinev1.DataDiskManagedDiskParameters{DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: validID}}},
+				},
+			},
+		},
+		{
+			name: "empty disk encryption set ID is left to the platform",
+			config: &machinev1.AzureMachineProviderSpec{
+				OSDisk: machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{},
+					},
+				},
+			},
+		},
+		{
+			name: "malformed OS disk encryption set ID",
+			config: &machinev1.AzureMachineProviderSpec{
+				OSDisk: machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: "myDES"},
+					},
+				},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.diskEncryptionSet.id: " +
+				"invalid resource ID: resource id 'myDES' must start with '/'"),
+		},
+		{
+			name: "OS disk security profile disk encryption set ID with wrong resource type",
+			config: &machinev1.AzureMachineProviderSpec{
+				OSDisk: machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						SecurityProfile: machinev1.VMDiskSecurityProfile{
+							DiskEncryptionSet: machinev1.DiskEncryptionSetParameters{ID: keyVaultID},
+						},
+					},
+				},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.securityProfile.diskEncryptionSet.id: "+
+				"invalid resource ID: %s, expected a Microsoft.Compute/diskEncryptionSets resource", keyVaultID),
+		},
+		{
+			name: "malformed data disk encryption set ID",
+			config: &machinev1.AzureMachineProviderSpec{
+				DataDisks: []machinev1.DataDisk{
+					{ManagedDisk: machinev1.DataDiskManagedDiskParameters{DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: validID}}},
+					{ManagedDisk: machinev1.DataDiskManagedDiskParameters{DiskEncryptionSet: &machinev1.DiskEncryptionSetParameters{ID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups"}}},
+				},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[1].managedDisk.diskEncryptionSet.id: " +
+				"invalid resource ID: /subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := validateDiskEncryptionSetIDs(tc.config)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateStorageAccountTypes(t *testing.T) {
+	skuNotFoundErr := fmt.Errorf("resource SKU not found: %w", resourceskus.ErrResourceNotFound)
+
+	testCases := []struct {
+		name          string
+		osDiskType    string
+		dataDiskTypes []machinev1.StorageAccountType
+		defaultType   string
+		expectSKUs    func(skuSvc *mock_azure.MockService)
+		expectedError error
+	}{
+		{
+			name:          "known locally redundant storage account types",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{machinev1.StorageAccountStandardLRS, machinev1.StorageAccountUltraSSDLRS},
+		},
+		{
+			name:       "empty storage account type is left to the platform",
+			osDiskType: "",
+		},
+		{
+			name:       "unknown OS disk storage account type",
+			osDiskType: "Premium_XRS",
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.storageAccountType: unknown storage account type %q, supported types are %v",
+				"Premium_XRS", compute.PossibleStorageAccountTypesValues()),
+		},
+		{
+			name:          "unknown data disk storage account type",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{"Fast_LRS"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[0].managedDisk.storageAccountType: unknown storage account type %q, supported types are %v",
+				"Fast_LRS", compute.PossibleStorageAccountTypesValues()),
+		},
+		{
+			name:          "zone-redundant storage supported in the region",
+			osDiskType:    "Premium_ZRS",
+			dataDiskTypes: []machinev1.StorageAccountType{"Premium_ZRS", "StandardSSD_ZRS"},
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Premium_ZRS", ResourceType: resourceskus.Disks}).Return(resourceskus.SKU{}, nil).Times(1)
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "StandardSSD_ZRS", ResourceType: resourceskus.Disks}).Return(resourceskus.SKU{}, nil).Times(1)
+			},
+		},
+		{
+			name:          "zone-redundant storage not supported in the region",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{"StandardSSD_ZRS"},
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "StandardSSD_ZRS", ResourceType: resourceskus.Disks}).Return(nil, skuNotFoundErr).Times(1)
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[0].managedDisk.storageAccountType: zone-redundant storage account type %q is not supported in region %q",
+				"StandardSSD_ZRS", "dummyLocation"),
+		},
+		{
+			name:          "default zone-redundant storage not supported in the region",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{machinev1.StorageAccountStandardLRS, ""},
+			defaultType:   "StandardSSD_ZRS",
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "StandardSSD_ZRS", ResourceType: resourceskus.Disks}).Return(nil, skuNotFoundErr).Times(1)
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[1].managedDisk.storageAccountType: zone-redundant storage account type %q is not supported in region %q",
+				"StandardSSD_ZRS", "dummyLocation"),
+		},
+		{
+			name:       "failure to get the disk SKU is not a configuration error",
+			osDiskType: "Premium_ZRS",
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("boom")).Times(1)
+			},
+			expectedError: fmt.Errorf("failed to obtain disk type information for %q from Azure: %w", "Premium_ZRS", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			skuSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectSKUs != nil {
+				tc.expectSKUs(skuSvc)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.OSDisk.ManagedDisk.StorageAccountType = tc.osDiskType
+			scope.DefaultDataDiskStorageAccountType = tc.defaultType
+			for _, dataDiskType := range tc.dataDiskTypes {
+				scope.MachineConfig.DataDisks = append(scope.MachineConfig.DataDisks, machinev1.DataDisk{
+					ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: dataDiskType},
+				})
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skuSvc
+
+			err := r.validateStorageAccountTypes(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestGetDataDisks(t *testing.T) {
+	g := NewWithT(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.MachineConfig.DataDisks = []machinev1.DataDisk{
+		{NameSuffix: "default", Lun: 0},
+		{NameSuffix: "standard", Lun: 1, ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountStandardLRS}},
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+
+	g.Expect(r.getDataDisks()).To(Equal(scope.MachineConfig.DataDisks))
+
+	scope.DefaultDataDiskStorageAccountType = string(machinev1.StorageAccountPremiumLRS)
+	dataDisks := r.getDataDisks()
+	g.Expect(dataDisks[0].ManagedDisk.StorageAccountType).To(Equal(machinev1.StorageAccountPremiumLRS))
+	g.Expect(dataDisks[1].ManagedDisk.StorageAccountType).To(Equal(machinev1.StorageAccountStandardLRS))
+	// The provider spec of the machine is left untouched.
+	g.Expect(scope.MachineConfig.DataDisks[0].ManagedDisk.StorageAccountType).To(BeEmpty())
+}
+
+func TestValidateStorageAccountTypesForZone(t *testing.T) {
+	skuNotFoundErr := fmt.Errorf("resource SKU not found: %w", resourceskus.ErrResourceNotFound)
+	skuInZones := func(zones ...string) resourceskus.SKU {
+		return resourceskus.SKU{
+			LocationInfo: &[]compute.ResourceSkuLocationInfo{
+				{
+					Location: ptr.To("dummyLocation"),
+					Zones:    &zones,
+				},
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		zone          string
+		osDiskType    string
+		dataDiskTypes []machinev1.StorageAccountType
+		expectSKUs    func(skuSvc *mock_azure.MockService)
+		expectedError error
+	}{
+		{
+			name:          "non-zonal machine is not checked",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{machinev1.StorageAccountUltraSSDLRS},
+		},
+		{
+			name:          "zone-redundant storage with zonal placement",
+			zone:          "2",
+			osDiskType:    "Premium_ZRS",
+			dataDiskTypes: []machinev1.StorageAccountType{"StandardSSD_ZRS"},
+		},
+		{
+			name:          "locally redundant storage available in the zone of the machine",
+			zone:          "2",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{machinev1.StorageAccountPremiumLRS, "StandardSSD_ZRS"},
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Premium_LRS", ResourceType: resourceskus.Disks}).Return(skuInZones("1", "2", "3"), nil).Times(1)
+			},
+		},
+		{
+			name:          "locally redundant storage not available in the zone of the machine",
+			zone:          "3",
+			osDiskType:    "Premium_LRS",
+			dataDiskTypes: []machinev1.StorageAccountType{machinev1.StorageAccountUltraSSDLRS},
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Premium_LRS", ResourceType: resourceskus.Disks}).Return(skuInZones("1", "2", "3"), nil).Times(1)
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "UltraSSD_LRS", ResourceType: resourceskus.Disks}).Return(skuInZones("1", "2"), nil).Times(1)
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid dataDisks[0].managedDisk.storageAccountType: locally-redundant storage account type %q is not available in zone %q of region %q, "+
+				"use a zone-redundant storage account type or a different zone", "UltraSSD_LRS", "3", "dummyLocation"),
+		},
+		{
+			name:       "locally redundant storage not available in the region",
+			zone:       "1",
+			osDiskType: "Standard_LRS",
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Standard_LRS", ResourceType: resourceskus.Disks}).Return(nil, skuNotFoundErr).Times(1)
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.storageAccountType: locally-redundant storage account type %q is not available in zone %q of region %q, "+
+				"use a zone-redundant storage account type or a different zone", "Standard_LRS", "1", "dummyLocation"),
+		},
+		{
+			name:       "failure to get the disk SKU is not a configuration error",
+			zone:       "1",
+			osDiskType: "Premium_LRS",
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("boom")).Times(1)
+			},
+			expectedError: fmt.Errorf("failed to obtain disk type information for %q from Azure: %w", "Premium_LRS", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			skuSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectSKUs != nil {
+				tc.expectSKUs(skuSvc)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.OSDisk.ManagedDisk.StorageAccountType = tc.osDiskType
+			for _, dataDiskType := range tc.dataDiskTypes {
+				scope.MachineConfig.DataDisks = append(scope.MachineConfig.DataDisks, machinev1.DataDisk{
+					ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: dataDiskType},
+				})
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skuSvc
+
+			err := r.validateStorageAccountTypesForZone(context.TODO(), tc.zone)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestUpdateProvisioningStateConditions(t *testing.T) {
+	const (
+		nicID      = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/machine-nic"
+		publicIPID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/machine-pip"
+	)
+
+	testCases := []struct {
+		name                      string
+		nicProvisioningState      network.ProvisioningState
+		publicIPProvisioningState network.ProvisioningState
+		withPublicIP              bool
+		expectReprovision         bool
+		expectedNICCondition      *metav1.Condition
+		expectedPublicIPCondition *metav1.Condition
+	}{
+		{
+			name:                 "Succeeded NIC without public IP",
+			nicProvisioningState: network.ProvisioningStateSucceeded,
+			expectedNICCondition: &metav1.Condition{
+				Type:    nicReadyConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  resourceProvisioningSucceededReason,
+				Message: "all network interfaces are provisioned",
+			},
+		},
+		{
+			name:                 "Failed NIC",
+			nicProvisioningState: network.ProvisioningStateFailed,
+			expectReprovision:    true,
+			expectedNICCondition: &metav1.Condition{
+				Type:    nicReadyConditionType,
+				Status:  metav1.ConditionFalse,
+				Reason:  string(network.ProvisioningStateFailed),
+				Message: `network interface "machine-nic" is in provisioning state "Failed"`,
+			},
+		},
+		{
+			name:                      "Succeeded NIC with updating public IP",
+			nicProvisioningState:      network.ProvisioningStateSucceeded,
+			publicIPProvisioningState: network.ProvisioningStateUpdating,
+			withPublicIP:              true,
+			expectedNICCondition: &metav1.Condition{
+				Type:    nicReadyConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  resourceProvisioningSucceededReason,
+				Message: "all network interfaces are provisioned",
+			},
+			expectedPublicIPCondition: &metav1.Condition{
+				Type:    publicIPReadyConditionType,
+				Status:  metav1.ConditionFalse,
+				Reason:  string(network.ProvisioningStateUpdating),
+				Message: `public IP address "machine-pip" is in provisioning state "Updating"`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					NetworkProfile: &compute.NetworkProfile{
+						NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+					},
+				},
+			}, nil)
+
+			ipConfig := network.InterfaceIPConfiguration{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					PrivateIPAddress: ptr.To("10.0.0.4"),
+				},
+			}
+			if tc.withPublicIP {
+				ipConfig.PublicIPAddress = &network.PublicIPAddress{ID: ptr.To(publicIPID)}
+			}
+
+			// A failed network interface which remains failed once written again is still reported.
+			nicGets := 1
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectReprovision {
+				nicGets = 2
+				nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), &networkinterfaces.ReprovisionSpec{Name: "machine-nic", ResourceGroup: "rg"}).Return(nil).Times(1)
+			}
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					ProvisioningState: tc.nicProvisioningState,
+					IPConfigurations:  &[]network.InterfaceIPConfiguration{ipConfig},
+				},
+			}, nil).Times(nicGets)
+
+			publicIPSvc := mock_azure.NewMockService(mockCtrl)
+			publicIPSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.PublicIPAddress{
+				PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+					IPAddress:         ptr.To("1.2.3.4"),
+					ProvisioningState: tc.publicIPProvisioningState,
+				},
+			}, nil).AnyTimes()
+
+			scope := newFakeScope(t, actuators.Node)
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.networkInterfacesSvc = nicSvc
+			r.publicIPSvc = publicIPSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+
+			conditions := scope.MachineStatus.Conditions
+			for _, expected := range []struct {
+				conditionType string
+				condition     *metav1.Condition
+			}{
+				{conditionType: nicReadyConditionType, condition: tc.expectedNICCondition},
+				{conditionType: publicIPReadyConditionType, condition: tc.expectedPublicIPCondition},
+			} {
+				actual := findCondition(conditions, expected.conditionType)
+				if expected.condition == nil {
+					g.Expect(actual).To(BeNil())
+					continue
+				}
+				g.Expect(actual).ToNot(BeNil())
+				g.Expect(actual.Status).To(Equal(expected.condition.Status))
+				g.Expect(actual.Reason).To(Equal(expected.condition.Reason))
+				g.Expect(actual.Message).To(Equal(expected.condition.Message))
+			}
+		})
+	}
+}
+
+func TestUpdateMissingNetworkInterface(t *testing.T) {
+	const nicID = "/subscriptions/sub/resourceGroups/dummyResourceGroup/providers/Microsoft.Network/networkInterfaces/machine-test-nic"
+	notFound := fmt.Errorf("network interface machine-test-nic not found: %w", autorest.DetailedError{StatusCode: 404})
+
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		expectRecreate    bool
+		expectedAddresses []corev1.NodeAddress
+		expectedCondition *metav1.Condition
+	}{
+		{
+			name:              "Network interface of the machine is recreated",
+			expectRecreate:    true,
+			expectedAddresses: []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.4"}},
+		},
+		{
+			name:              "Pre-existing network interface is reported",
+			annotations:       map[string]string{MachineNetworkInterfaceAnnotationName: "machine-test-nic"},
+			expectedAddresses: []corev1.NodeAddress{},
+			expectedCondition: &metav1.Condition{
+				Type:    networkInterfaceMissingConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  networkInterfaceNotFoundReason,
+				Message: "network interfaces machine-test-nic referenced by the vm do not exist, the machine has no addresses from them",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					NetworkProfile: &compute.NetworkProfile{
+						NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+					},
+				},
+			}, nil)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			getNIC := nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, notFound)
+			if tc.expectRecreate {
+				recreate := nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+					nicSpec := spec.(*networkinterfaces.Spec)
+					g.Expect(nicSpec.Name).To(Equal("machine-test-nic"))
+					g.Expect(nicSpec.VnetName).To(Equal("dummyVnet"))
+					g.Expect(nicSpec.SubnetName).To(Equal("dummySubnet"))
+					return nil
+				}).After(getNIC)
+				nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Interface{
+					InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+						ProvisioningState: network.ProvisioningStateSucceeded,
+						IPConfigurations: &[]network.InterfaceIPConfiguration{{
+							InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+								PrivateIPAddress: ptr.To("10.0.0.4"),
+							},
+						}},
+					},
+				}, nil).After(recreate)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.networkInterfacesSvc = nicSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+			g.Expect(scope.Machine.Status.Addresses).To(Equal(tc.expectedAddresses))
+
+			condition := findCondition(scope.MachineStatus.Conditions, networkInterfaceMissingConditionType)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+			g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+			g.Expect(condition.Message).To(Equal(tc.expectedCondition.Message))
+		})
+	}
+}
+
+func TestUpdateFailedNetworkResources(t *testing.T) {
+	const (
+		nicID          = "/subscriptions/sub/resourceGroups/dummyResourceGroup/providers/Microsoft.Network/networkInterfaces/machine-test-nic"
+		secondaryNICID = "/subscriptions/sub/resourceGroups/dummyResourceGroup/providers/Microsoft.Network/networkInterfaces/machine-test-nic-2"
+	)
+
+	nic := func(provisioningState network.ProvisioningState, privateIP, publicIPName string) network.Interface {
+		ipConfig := network.InterfaceIPConfiguration{
+			InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+				PrivateIPAddress: ptr.To(privateIP),
+			},
+		}
+		if publicIPName != "" {
+			ipConfig.PublicIPAddress = &network.PublicIPAddress{ID: ptr.To("/subscriptions/sub/resourceGroups/dummyResourceGroup/providers/Microsoft.Network/publicIPAddresses/" + publicIPName)}
+		}
+		return network.Interface{
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				ProvisioningState: provisioningState,
+				IPConfigurations:  &[]network.InterfaceIPConfiguration{ipConfig},
+			},
+		}
+	}
+	publicIP := func(provisioningState network.ProvisioningState) network.PublicIPAddress {
+		return network.PublicIPAddress{
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				IPAddress:         ptr.To("1.2.3.4"),
+				ProvisioningState: provisioningState,
+			},
+		}
+	}
+
+	t.Run("Failed network interface of the machine is recreated", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		vmSvc := mock_azure.NewMockService(mockCtrl)
+		vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+			ID: ptr.To("machine-ID"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				NetworkProfile: &compute.NetworkProfile{
+					NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+				},
+			},
+		}, nil)
+
+		nicSvc := mock_azure.NewMockService(mockCtrl)
+		gomock.InOrder(
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nic(network.ProvisioningStateFailed, "10.0.0.4", ""), nil),
+			nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+				nicSpec := spec.(*networkinterfaces.Spec)
+				g.Expect(nicSpec.Name).To(Equal("machine-test-nic"))
+				g.Expect(nicSpec.VnetName).To(Equal("dummyVnet"))
+				g.Expect(nicSpec.SubnetName).To(Equal("dummySubnet"))
+				g.Expect(nicSpec.PublicLoadBalancerName).To(Equal("public-lb"))
+				g.Expect(nicSpec.InternalLoadBalancerName).To(Equal("internal-lb"))
+				return nil
+			}),
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nic(network.ProvisioningStateSucceeded, "10.0.0.4", ""), nil),
+		)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.MachineConfig.PublicLoadBalancer = "public-lb"
+		scope.MachineConfig.InternalLoadBalancer = "internal-lb"
+		r := newFakeReconcilerWithScope(t, scope)
+		r.virtualMachinesSvc = vmSvc
+		r.networkInterfacesSvc = nicSvc
+
+		g.Expect(r.Update(context.TODO())).To(Succeed())
+		g.Expect(scope.Machine.Status.Addresses).To(ConsistOf(corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.4"}))
+
+		condition := findCondition(scope.MachineStatus.Conditions, nicReadyConditionType)
+		g.Expect(condition).ToNot(BeNil())
+		g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	t.Run("Failed secondary network interface is written again as it is", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		vmSvc := mock_azure.NewMockService(mockCtrl)
+		vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+			ID: ptr.To("machine-ID"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				NetworkProfile: &compute.NetworkProfile{
+					NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}, {ID: ptr.To(secondaryNICID)}},
+				},
+			},
+		}, nil)
+
+		// The secondary network interface was not created from the machine spec, so it is written again as it is.
+		nicSvc := mock_azure.NewMockService(mockCtrl)
+		nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic", VnetName: "dummyVnet"}).Return(nic(network.ProvisioningStateSucceeded, "10.0.0.4", ""), nil)
+		gomock.InOrder(
+			nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic-2", VnetName: "dummyVnet"}).Return(nic(network.ProvisioningStateFailed, "10.0.1.4", ""), nil),
+			nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), &networkinterfaces.ReprovisionSpec{Name: "machine-test-nic-2"}).Return(nil),
+			nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic-2", VnetName: "dummyVnet"}).Return(nic(network.ProvisioningStateSucceeded, "10.0.1.4", ""), nil),
+		)
+
+		scope := newFakeScope(t, actuators.Node)
+		r := newFakeReconcilerWithScope(t, scope)
+		r.virtualMachinesSvc = vmSvc
+		r.networkInterfacesSvc = nicSvc
+
+		g.Expect(r.Update(context.TODO())).To(Succeed())
+		g.Expect(scope.Machine.Status.Addresses).To(ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.4"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.1.4"},
+		))
+
+		condition := findCondition(scope.MachineStatus.Conditions, nicReadyConditionType)
+		g.Expect(condition).ToNot(BeNil())
+		g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	})
+
+	t.Run("Failure to recreate a network interface does not stop the update", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		vmSvc := mock_azure.NewMockService(mockCtrl)
+		vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+			ID: ptr.To("machine-ID"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				NetworkProfile: &compute.NetworkProfile{
+					NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(secondaryNICID)}, {ID: ptr.To(nicID)}},
+				},
+			},
+		}, nil)
+
+		nicSvc := mock_azure.NewMockService(mockCtrl)
+		nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic-2", VnetName: "dummyVnet"}).Return(nic(network.ProvisioningStateFailed, "10.0.1.4", ""), nil)
+		nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), &networkinterfaces.ReprovisionSpec{Name: "machine-test-nic-2"}).Return(errors.New("test error"))
+		nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic", VnetName: "dummyVnet"}).Return(nic(network.ProvisioningStateSucceeded, "10.0.0.4", ""), nil)
+
+		scope := newFakeScope(t, actuators.Node)
+		r := newFakeReconcilerWithScope(t, scope)
+		r.virtualMachinesSvc = vmSvc
+		r.networkInterfacesSvc = nicSvc
+
+		g.Expect(r.Update(context.TODO())).To(MatchError("failed to recreate failed network interface machine-test-nic-2: test error"))
+		g.Expect(scope.Machine.Status.Addresses).To(ConsistOf(
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.1.4"},
+			corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.4"},
+		))
+
+		condition := findCondition(scope.MachineStatus.Conditions, nicReadyConditionType)
+		g.Expect(condition).ToNot(BeNil())
+		g.Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		g.Expect(condition.Message).To(Equal(`network interface "machine-test-nic-2" is in provisioning state "Failed"`))
+	})
+
+	t.Run("Failed public IP address of the machine is recreated", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.MachineConfig.PublicIP = true
+		r := newFakeReconcilerWithScope(t, scope)
+		publicIPName, err := r.getPublicIPName()
+		g.Expect(err).ToNot(HaveOccurred())
+
+		vmSvc := mock_azure.NewMockService(mockCtrl)
+		vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+			ID: ptr.To("machine-ID"),
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				NetworkProfile: &compute.NetworkProfile{
+					NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+				},
+			},
+		}, nil)
+
+		nicSvc := mock_azure.NewMockService(mockCtrl)
+		nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nic(network.ProvisioningStateSucceeded, "10.0.0.4", publicIPName), nil)
+
+		publicIPSvc := mock_azure.NewMockService(mockCtrl)
+		gomock.InOrder(
+			publicIPSvc.EXPECT().Get(gomock.Any(), &publicips.Spec{Name: publicIPName}).Return(publicIP(network.ProvisioningStateFailed), nil),
+			publicIPSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+				g.Expect(spec.(*publicips.Spec).Name).To(Equal(publicIPName))
+				return nil
+			}),
+			publicIPSvc.EXPECT().Get(gomock.Any(), &publicips.Spec{Name: publicIPName}).Return(publicIP(network.ProvisioningStateSucceeded), nil),
+		)
+
+		r.virtualMachinesSvc = vmSvc
+		r.networkInterfacesSvc = nicSvc
+		r.publicIPSvc = publicIPSvc
+
+		g.Expect(r.Update(context.TODO())).To(Succeed())
+		g.Expect(scope.Machine.Status.Addresses).To(ContainElement(corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "1.2.3.4"}))
+
+		condition := findCondition(scope.MachineStatus.Conditions, publicIPReadyConditionType)
+		g.Expect(condition).ToNot(BeNil())
+		g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+	})
+}
+
+func TestUpdateUserAssignedIdentity(t *testing.T) {
+	const (
+		subscriptionID = "00000000-0000-0000-0000-000000000000"
+		identityID     = "/subscriptions/" + subscriptionID + "/resourcegroups/dummyResourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/identity"
+		otherID        = "/subscriptions/" + subscriptionID + "/resourcegroups/dummyResourceGroup/providers/Microsoft.ManagedIdentity/userAssignedIdentities/other"
+	)
+
+	testCases := []struct {
+		name                       string
+		managedIdentity            string
+		assignedIdentity           string
+		currentIdentities          []string
+		expectedIdentity           *compute.VirtualMachineIdentity
+		expectedAssignedAnnotation string
+	}{
+		{
+			name:                       "Records the identity assigned from the provider spec",
+			managedIdentity:            "identity",
+			currentIdentities:          []string{identityID, otherID},
+			expectedAssignedAnnotation: identityID,
+		},
+		{
+			name:              "Does not record an identity the vm does not have",
+			managedIdentity:   "identity",
+			currentIdentities: []string{otherID},
+		},
+		{
+			name:                       "Keeps the assigned identity while the provider spec references it",
+			managedIdentity:            "identity",
+			assignedIdentity:           identityID,
+			currentIdentities:          []string{identityID},
+			expectedAssignedAnnotation: identityID,
+		},
+		{
+			name:              "Leaves identities alone without an assigned identity",
+			currentIdentities: []string{identityID},
+		},
+		{
+			name:              "Removes the only assigned identity",
+			assignedIdentity:  identityID,
+			currentIdentities: []string{identityID},
+			expectedIdentity: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeNone,
+			},
+		},
+		{
+			name:              "Removes the assigned identity and keeps the others",
+			assignedIdentity:  identityID,
+			currentIdentities: []string{identityID, otherID},
+			expectedIdentity: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeUserAssigned,
+				UserAssignedIdentities: map[string]*compute.VirtualMachineIdentityUserAssignedIdentitiesValue{
+					identityID: nil,
+				},
+			},
+		},
+		{
+			name:              "Forgets an assigned identity already removed from the vm",
+			assignedIdentity:  identityID,
+			currentIdentities: []string{otherID},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			userAssignedIdentities := map[string]*compute.VirtualMachineIdentityUserAssignedIdentitiesValue{}
+			for _, id := range tc.currentIdentities {
+				userAssignedIdentities[id] = &compute.VirtualMachineIdentityUserAssignedIdentitiesValue{}
+			}
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				Identity: &compute.VirtualMachineIdentity{
+					Type:                   compute.ResourceIdentityTypeUserAssigned,
+					UserAssignedIdentities: userAssignedIdentities,
+				},
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+				},
+			}, nil)
+			if tc.expectedIdentity != nil {
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), &virtualmachines.IdentitySpec{
+					Name:     "machine",
+					Identity: tc.expectedIdentity,
+				}).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Name = "machine"
+			scope.SubscriptionID = subscriptionID
+			scope.MachineConfig.ManagedIdentity = tc.managedIdentity
+			if tc.assignedIdentity != "" {
+				scope.Machine.Annotations = map[string]string{MachineAssignedIdentityAnnotationName: tc.assignedIdentity}
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+			if tc.expectedAssignedAnnotation == "" {
+				g.Expect(scope.Machine.Annotations).ToNot(HaveKey(MachineAssignedIdentityAnnotationName))
+			} else {
+				g.Expect(scope.Machine.Annotations).To(HaveKeyWithValue(MachineAssignedIdentityAnnotationName, tc.expectedAssignedAnnotation))
+			}
+		})
+	}
+}
+
+func TestUpdateDataDisksDeletionPolicy(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		currentDeleteOption  compute.DiskDeleteOptionTypes
+		deletionPolicy       machinev1.DiskDeletionPolicyType
+		expectedDeleteOption compute.DiskDeleteOptionTypes
+	}{
+		{
+			name:                 "Delete to Detach",
+			currentDeleteOption:  compute.DiskDeleteOptionTypesDelete,
+			deletionPolicy:       machinev1.DiskDeletionPolicyTypeDetach,
+			expectedDeleteOption: compute.DiskDeleteOptionTypesDetach,
+		},
+		{
+			name:                 "Detach to Delete",
+			currentDeleteOption:  compute.DiskDeleteOptionTypesDetach,
+			deletionPolicy:       machinev1.DiskDeletionPolicyTypeDelete,
+			expectedDeleteOption: compute.DiskDeleteOptionTypesDelete,
+		},
+		{
+			name:                "Unchanged deletion policy",
+			currentDeleteOption: compute.DiskDeleteOptionTypesDelete,
+			deletionPolicy:      machinev1.DiskDeletionPolicyTypeDelete,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			dataDisk := compute.DataDisk{
+				Name:         ptr.To(azure.GenerateDataDiskName("machine", "disk")),
+				Lun:          ptr.To[int32](0),
+				CreateOption: compute.DiskCreateOptionTypesEmpty,
+				Caching:      compute.CachingTypesReadOnly,
+				DiskSizeGB:   ptr.To[int32](4),
+				ManagedDisk: &compute.ManagedDiskParameters{
+					ID:                 ptr.To("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/disks/machine_disk"),
+					StorageAccountType: compute.StorageAccountTypesPremiumLRS,
+				},
+				DeleteOption: tc.currentDeleteOption,
+			}
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					StorageProfile: &compute.StorageProfile{
+						DataDisks: &[]compute.DataDisk{dataDisk},
+					},
+				},
+			}, nil).Times(1)
+			if tc.expectedDeleteOption != "" {
+				// The data disks of the VM already read are sent back, the VM is not read again.
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), &virtualmachines.DataDisksDeleteOptionSpec{
+					Name:      "machine",
+					DataDisks: []compute.DataDisk{dataDisk},
+					DeleteOptions: map[string]compute.DiskDeleteOptionTypes{
+						azure.GenerateDataDiskName("machine", "disk"): tc.expectedDeleteOption,
+					},
+				}).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Name = "machine"
+			scope.MachineConfig.DataDisks = []machinev1.DataDisk{
+				{
+					NameSuffix:     "disk",
+					DiskSizeGB:     4,
+					Lun:            0,
+					DeletionPolicy: tc.deletionPolicy,
+				},
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+		})
+	}
+}
+
+func TestUpdateCanceledProvisioning(t *testing.T) {
+	const availabilitySetID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/availabilitySets/machine-as"
+
+	canceledVM := compute.VirtualMachine{
+		ID: ptr.To("machine-ID"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: ptr.To("Canceled"),
+			AvailabilitySet:   &compute.SubResource{ID: ptr.To(availabilitySetID)},
+		},
+	}
+
+	testCases := []struct {
+		name                string
+		retries             string
+		expectRetry         bool
+		expectedError       error
+		expectedRetries     string
+		expectedEventPrefix string
+	}{
+		{
+			name:                "First retry",
+			expectRetry:         true,
+			expectedError:       errors.New("vm machine was in provisioning state Canceled, retried provisioning (1/3)"),
+			expectedRetries:     "1",
+			expectedEventPrefix: "Warning ProvisioningCanceled Provisioning of vm machine was canceled, retrying (1/3)",
+		},
+		{
+			name:                "Last retry",
+			retries:             "2",
+			expectRetry:         true,
+			expectedError:       errors.New("vm machine was in provisioning state Canceled, retried provisioning (3/3)"),
+			expectedRetries:     "3",
+			expectedEventPrefix: "Warning ProvisioningCanceled Provisioning of vm machine was canceled, retrying (3/3)",
+		},
+		{
+			name:            "Retries exhausted",
+			retries:         "3",
+			expectedError:   machinecontroller.InvalidMachineConfiguration("vm machine is in provisioning state Canceled after 3 retries"),
+			expectedRetries: "3",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			var retriedSpec *virtualmachines.Spec
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(canceledVM, nil).Times(1)
+			if tc.expectRetry {
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+					retriedSpec = spec.(*virtualmachines.Spec)
+					return nil
+				}).Times(1)
+			}
+
+			recorder := record.NewFakeRecorder(1)
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Name = "machine"
+			scope.EventRecorder = recorder
+			scope.CanceledProvisioningRetries = 3
+			if tc.retries != "" {
+				scope.Machine.Annotations = map[string]string{MachineCanceledProvisioningRetriesAnnotationName: tc.retries}
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(MatchError(tc.expectedError))
+			g.Expect(scope.Machine.Annotations).To(HaveKeyWithValue(MachineCanceledProvisioningRetriesAnnotationName, tc.expectedRetries))
+
+			if !tc.expectRetry {
+				g.Expect(recorder.Events).To(BeEmpty())
+				return
+			}
+
+			g.Expect(retriedSpec).ToNot(BeNil())
+			g.Expect(retriedSpec.Name).To(Equal("machine"))
+			g.Expect(retriedSpec.NICName).To(Equal(azure.GenerateNetworkInterfaceName("machine")))
+			g.Expect(retriedSpec.AvailabilitySetName).To(Equal("machine-as"))
+			g.Expect(recorder.Events).To(Receive(HavePrefix(tc.expectedEventPrefix)))
+		})
+	}
+}
+
+func TestUpdateSucceededProvisioningResetsCanceledRetries(t *testing.T) {
+	g := NewWithT(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineCanceledProvisioningRetriesAnnotationName: "2"}
+	r := newFakeReconcilerWithScope(t, scope)
+
+	g.Expect(r.Update(context.TODO())).To(Succeed())
+	g.Expect(scope.Machine.Annotations).ToNot(HaveKey(MachineCanceledProvisioningRetriesAnnotationName))
+}
+
+func TestUpdateNetworkInterfaceSecurityGroups(t *testing.T) {
+	const (
+		nicID   = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/machine-test-nic"
+		groupID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/"
+	)
+
+	securityGroup := func(name string) *network.SecurityGroup {
+		return &network.SecurityGroup{ID: ptr.To(groupID + "networkSecurityGroups/" + name)}
+	}
+
+	applicationSecurityGroups := func(names ...string) *[]network.ApplicationSecurityGroup {
+		groups := []network.ApplicationSecurityGroup{}
+		for _, name := range names {
+			groups = append(groups, network.ApplicationSecurityGroup{ID: ptr.To(groupID + "applicationSecurityGroups/" + name)})
+		}
+		return &groups
+	}
+
+	testCases := []struct {
+		name                      string
+		annotations               map[string]string
+		nicSecurityGroup          *network.SecurityGroup
+		nicIPConfigurations       []network.InterfaceIPConfiguration
+		securityGroup             string
+		applicationSecurityGroups []string
+		expectUpdate              bool
+	}{
+		{
+			name: "No security groups",
+		},
+		{
+			name:             "Matching security groups",
+			nicSecurityGroup: securityGroup("nsg"),
+			nicIPConfigurations: []network.InterfaceIPConfiguration{{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					ApplicationSecurityGroups: applicationSecurityGroups("asg-a", "asg-b"),
+				},
+			}},
+			securityGroup:             "NSG",
+			applicationSecurityGroups: []string{"asg-b", "ASG-A"},
+		},
+		{
+			name:             "Application security groups of secondary IP configurations are ignored",
+			nicSecurityGroup: securityGroup("nsg"),
+			nicIPConfigurations: []network.InterfaceIPConfiguration{
+				{
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary:                   ptr.To(false),
+						ApplicationSecurityGroups: applicationSecurityGroups("asg-b"),
+					},
+				},
+				{
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary:                   ptr.To(true),
+						ApplicationSecurityGroups: applicationSecurityGroups("asg-a"),
+					},
+				},
+			},
+			securityGroup:             "nsg",
+			applicationSecurityGroups: []string{"asg-a"},
+		},
+		{
+			name:          "Security group attached",
+			securityGroup: "nsg",
+			expectUpdate:  true,
+		},
+		{
+			name:             "Security group changed",
+			nicSecurityGroup: securityGroup("old-nsg"),
+			securityGroup:    "nsg",
+			expectUpdate:     true,
+		},
+		{
+			name:             "Security group detached",
+			nicSecurityGroup: securityGroup("nsg"),
+			expectUpdate:     true,
+		},
+		{
+			name:             "Application security group attached",
+			nicSecurityGroup: securityGroup("nsg"),
+			nicIPConfigurations: []network.InterfaceIPConfiguration{{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					ApplicationSecurityGroups: applicationSecurityGroups("asg-a"),
+				},
+			}},
+			securityGroup:             "nsg",
+			applicationSecurityGroups: []string{"asg-a", "asg-b"},
+			expectUpdate:              true,
+		},
+		{
+			name: "Application security group detached",
+			nicIPConfigurations: []network.InterfaceIPConfiguration{{
+				InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+					ApplicationSecurityGroups: applicationSecurityGroups("asg-a"),
+				},
+			}},
+			expectUpdate: true,
+		},
+		{
+			name:             "User managed network interface",
+			annotations:      map[string]string{MachineNetworkInterfaceAnnotationName: "machine-test-nic"},
+			nicSecurityGroup: securityGroup("old-nsg"),
+			securityGroup:    "nsg",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					NetworkProfile: &compute.NetworkProfile{
+						NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+					},
+				},
+			}, nil)
+
+			var updatedSpec *networkinterfaces.SecurityGroupsSpec
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					ProvisioningState:    network.ProvisioningStateSucceeded,
+					NetworkSecurityGroup: tc.nicSecurityGroup,
+					IPConfigurations:     &tc.nicIPConfigurations,
+				},
+			}, nil)
+			if tc.expectUpdate {
+				nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+					updatedSpec = spec.(*networkinterfaces.SecurityGroupsSpec)
+					return nil
+				}).Times(1)
+			}
+
+			recorder := record.NewFakeRecorder(1)
+			scope := newFakeScope(t, actuators.Node)
+			scope.EventRecorder = recorder
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.SecurityGroup = tc.securityGroup
+			scope.MachineConfig.ApplicationSecurityGroups = tc.applicationSecurityGroups
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.networkInterfacesSvc = nicSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+
+			if !tc.expectUpdate {
+				g.Expect(recorder.Events).To(BeEmpty())
+				return
+			}
+
+			g.Expect(updatedSpec).To(Equal(&networkinterfaces.SecurityGroupsSpec{
+				Name:                          "machine-test-nic",
+				SecurityGroupName:             tc.securityGroup,
+				ApplicationSecurityGroupNames: tc.applicationSecurityGroups,
+			}))
+			g.Expect(recorder.Events).To(Receive(Equal("Normal SecurityGroupsUpdated Updated security groups of network interface machine-test-nic")))
+		})
+	}
+}
+
+func TestUpdateNetworkInterfaceSecurityGroupsFailure(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	const nicPrefix = "/subscriptions/sub/resourceGroups/dummyResourceGroup/providers/Microsoft.Network/networkInterfaces/"
+
+	vmSvc := mock_azure.NewMockService(mockCtrl)
+	vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+		ID: ptr.To("machine-ID"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: ptr.To("Succeeded"),
+			NetworkProfile: &compute.NetworkProfile{
+				NetworkInterfaces: &[]compute.NetworkInterfaceReference{
+					{ID: ptr.To(nicPrefix + "machine-test-nic")},
+					{ID: ptr.To(nicPrefix + "secondary-nic")},
+				},
+			},
+		},
+	}, nil)
+
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) (interface{}, error) {
+		address := "10.0.0.4"
+		if spec.(*networkinterfaces.Spec).Name == "secondary-nic" {
+			address = "10.0.0.5"
+		}
+		return network.Interface{
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				ProvisioningState: network.ProvisioningStateSucceeded,
+				IPConfigurations: &[]network.InterfaceIPConfiguration{{
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						PrivateIPAddress: ptr.To(address),
+					},
+				}},
+			},
+		}, nil
+	}).Times(2)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(errors.New("test error")).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.MachineConfig.SecurityGroup = "nsg"
+	r := newFakeReconcilerWithScope(t, scope)
+	r.virtualMachinesSvc = vmSvc
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.Update(context.TODO())).To(MatchError("failed to reconcile security groups of network interface machine-test-nic: test error"))
+
+	// The addresses of every network interface and the status of the machine are still updated.
+	g.Expect(scope.Machine.Status.Addresses).To(ConsistOf(
+		corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.4"},
+		corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "10.0.0.5"},
+	))
+	g.Expect(scope.MachineStatus.VMState).ToNot(BeNil())
+	g.Expect(findCondition(scope.MachineStatus.Conditions, string(machinev1.MachineCreated))).ToNot(BeNil())
+}
+
+func TestUpdateNetworkInterfaceAcceleratedNetworking(t *testing.T) {
+	const nicID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/machine-test-nic"
+
+	capableSKU := resourceskus.SKU{
+		Capabilities: &[]compute.ResourceSkuCapabilities{
+			{
+				Name:  ptr.To[string](resourceskus.AcceleratedNetworking),
+				Value: ptr.To[string](string(resourceskus.CapabilitySupported)),
+			},
+		},
+	}
+
+	testCases := []struct {
+		name                  string
+		annotations           map[string]string
+		powerState            string
+		nicEnabled            *bool
+		acceleratedNetworking bool
+		sku                   resourceskus.SKU
+		updateError           error
+		expectedSpec          *networkinterfaces.AcceleratedNetworkingSpec
+		expectedEvent         string
+		expectedCondition     *metav1.Condition
+	}{
+		{
+			name:       "Accelerated networking disabled on both sides",
+			powerState: "PowerState/running",
+		},
+		{
+			name:                  "Accelerated networking enabled on both sides",
+			powerState:            "PowerState/running",
+			nicEnabled:            ptr.To(true),
+			acceleratedNetworking: true,
+		},
+		{
+			name:                  "Accelerated networking enabled",
+			powerState:            "PowerState/deallocated",
+			nicEnabled:            ptr.To(false),
+			acceleratedNetworking: true,
+			sku:                   capableSKU,
+			expectedSpec:          &networkinterfaces.AcceleratedNetworkingSpec{Name: "machine-test-nic", Enabled: true},
+			expectedEvent:         "Normal AcceleratedNetworkingUpdated Enabled accelerated networking on network interface machine-test-nic",
+		},
+		{
+			name:          "Accelerated networking disabled",
+			powerState:    "PowerState/deallocated",
+			nicEnabled:    ptr.To(true),
+			expectedSpec:  &networkinterfaces.AcceleratedNetworkingSpec{Name: "machine-test-nic", Enabled: false},
+			expectedEvent: "Normal AcceleratedNetworkingUpdated Disabled accelerated networking on network interface machine-test-nic",
+		},
+		{
+			name:                  "Accelerated networking left as it is while the VM is running",
+			powerState:            "PowerState/running",
+			acceleratedNetworking: true,
+			sku:                   capableSKU,
+			expectedCondition: &metav1.Condition{
+				Type:    acceleratedNetworkingDriftConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  vmNotDeallocatedReason,
+				Message: `accelerated networking of network interface machine-test-nic is changed to true once the vm is deallocated, vm is "Running"`,
+			},
+		},
+		{
+			name:                  "Accelerated networking not supported by the VM size",
+			powerState:            "PowerState/deallocated",
+			acceleratedNetworking: true,
+			expectedCondition: &metav1.Condition{
+				Type:    acceleratedNetworkingDriftConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  acceleratedNetworkingUpdateFailedReason,
+				Message: "failed to set accelerated networking of network interface machine-test-nic to true: accelerated networking not supported on instance type: Standard_D4s_v3",
+			},
+		},
+		{
+			name:         "Failed update",
+			powerState:   "PowerState/deallocated",
+			nicEnabled:   ptr.To(true),
+			updateError:  errors.New("test error"),
+			expectedSpec: &networkinterfaces.AcceleratedNetworkingSpec{Name: "machine-test-nic", Enabled: false},
+			expectedCondition: &metav1.Condition{
+				Type:    acceleratedNetworkingDriftConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  acceleratedNetworkingUpdateFailedReason,
+				Message: "failed to set accelerated networking of network interface machine-test-nic to false: test error",
+			},
+		},
+		{
+			name:                  "User managed network interface",
+			annotations:           map[string]string{MachineNetworkInterfaceAnnotationName: "machine-test-nic"},
+			powerState:            "PowerState/deallocated",
+			acceleratedNetworking: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					InstanceView: &compute.VirtualMachineInstanceView{
+						Statuses: &[]compute.InstanceViewStatus{{Code: ptr.To(tc.powerState)}},
+					},
+					NetworkProfile: &compute.NetworkProfile{
+						NetworkInterfaces: &[]compute.NetworkInterfaceReference{{ID: ptr.To(nicID)}},
+					},
+				},
+			}, nil)
+
+			var updatedSpec *networkinterfaces.AcceleratedNetworkingSpec
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					ProvisioningState:           network.ProvisioningStateSucceeded,
+					EnableAcceleratedNetworking: tc.nicEnabled,
+					IPConfigurations:            &[]network.InterfaceIPConfiguration{},
+				},
+			}, nil)
+			if tc.expectedSpec != nil {
+				nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+					updatedSpec = spec.(*networkinterfaces.AcceleratedNetworkingSpec)
+					return tc.updateError
+				}).Times(1)
+			}
+
+			recorder := record.NewFakeRecorder(1)
+			scope := newFakeScope(t, actuators.Node)
+			scope.EventRecorder = recorder
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.VMSize = "Standard_D4s_v3"
+			scope.MachineConfig.AcceleratedNetworking = tc.acceleratedNetworking
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.networkInterfacesSvc = nicSvc
+
+			resourcesSkus := mock_azure.NewMockService(mockCtrl)
+			resourcesSkus.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.sku, nil).AnyTimes()
+			r.resourcesSkus = resourcesSkus
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+
+			condition := findCondition(scope.MachineStatus.Conditions, acceleratedNetworkingDriftConditionType)
+			if tc.expectedCondition != nil {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+				g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+				g.Expect(condition.Message).To(Equal(tc.expectedCondition.Message))
+			} else {
+				g.Expect(condition).To(BeNil())
+			}
+
+			g.Expect(updatedSpec).To(Equal(tc.expectedSpec))
+			if tc.expectedEvent == "" {
+				g.Expect(recorder.Events).To(BeEmpty())
+				return
+			}
+			g.Expect(recorder.Events).To(Receive(Equal(tc.expectedEvent)))
+		})
+	}
+}
+
+func TestGetNetworkInterfaceRef(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedRef   networkInterfaceRef
+		expectedError error
+	}{
+		{
+			name:        "Generated network interface",
+			expectedRef: networkInterfaceRef{name: azure.GenerateNetworkInterfaceName("machine-test")},
+		},
+		{
+			name:        "Network interface referenced by name",
+			annotations: map[string]string{MachineNetworkInterfaceAnnotationName: "my-nic"},
+			expectedRef: networkInterfaceRef{name: "my-nic", userManaged: true},
+		},
+		{
+			name: "Network interface referenced by ID",
+			annotations: map[string]string{
+				MachineNetworkInterfaceAnnotationName: "/subscriptions/" + subscriptionID + "/resourceGroups/network-rg/providers/Microsoft.Network/networkInterfaces/my-nic",
+			},
+			expectedRef: networkInterfaceRef{name: "my-nic", resourceGroup: "network-rg", userManaged: true},
+		},
+		{
+			name:          "Empty network interface reference",
+			annotations:   map[string]string{MachineNetworkInterfaceAnnotationName: ""},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must not be empty", MachineNetworkInterfaceAnnotationName),
+		},
+		{
+			name: "ID of another resource type",
+			annotations: map[string]string{
+				MachineNetworkInterfaceAnnotationName: "/subscriptions/" + subscriptionID + "/resourceGroups/network-rg/providers/Microsoft.Network/publicIPAddresses/my-ip",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid network interface %q: not the ID of a Microsoft.Network/networkInterfaces resource",
+				"/subscriptions/"+subscriptionID+"/resourceGroups/network-rg/providers/Microsoft.Network/publicIPAddresses/my-ip"),
+		},
+		{
+			name: "ID in another subscription",
+			annotations: map[string]string{
+				MachineNetworkInterfaceAnnotationName: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/network-rg/providers/Microsoft.Network/networkInterfaces/my-nic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("network interface %q must be in subscription %s of the machine",
+				"/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/network-rg/providers/Microsoft.Network/networkInterfaces/my-nic", subscriptionID),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = subscriptionID
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			ref, err := r.getNetworkInterfaceRef()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ref).To(Equal(tc.expectedRef))
+			}
+		})
+	}
+}
+
+func TestCreateMachineUserManagedNetworkInterface(t *testing.T) {
+	const nicID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/network-rg/providers/Microsoft.Network/networkInterfaces/my-nic"
+
+	testCases := []struct {
+		name          string
+		nicGetErr     error
+		expectedError error
+	}{
+		{
+			name: "Existing network interface",
+		},
+		{
+			name:      "Missing network interface",
+			nicGetErr: fmt.Errorf("network interface my-nic not found: %w", autorest.DetailedError{StatusCode: 404}),
+			expectedError: machinecontroller.InvalidMachineConfiguration("network interface %s referenced by annotation %s not found",
+				"my-nic", MachineNetworkInterfaceAnnotationName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			// No expectation is set on CreateOrUpdate, so creating the network interface fails the test.
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "my-nic", ResourceGroup: "network-rg"}).Return(network.Interface{}, tc.nicGetErr).Times(1)
+
+			var createdSpec *virtualmachines.Spec
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectedError == nil {
+				vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("vm not found")).Times(1)
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+					createdSpec = spec.(*virtualmachines.Spec)
+					return nil
+				}).Times(1)
+				vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+					ID: ptr.To("machine-ID"),
+					VirtualMachineProperties: &compute.VirtualMachineProperties{
+						ProvisioningState: ptr.To("Succeeded"),
+					},
+				}, nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = "00000000-0000-0000-0000-000000000000"
+			scope.Machine.Annotations = map[string]string{MachineNetworkInterfaceAnnotationName: nicID}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.networkInterfacesSvc = nicSvc
+			r.virtualMachinesSvc = vmSvc
+
+			err := r.CreateMachine(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(createdSpec).ToNot(BeNil())
+			g.Expect(createdSpec.NICName).To(Equal("my-nic"))
+			g.Expect(createdSpec.NICResourceGroup).To(Equal("network-rg"))
+		})
+	}
+}
+
+func TestDeleteUserManagedNetworkInterface(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	// No expectation is set on Delete, so deleting the network interface fails the test.
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+
+	fakeSuccessSvc := &azure.FakeSuccessService{}
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineNetworkInterfaceAnnotationName: "my-nic"}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.networkInterfacesSvc = nicSvc
+	r.disksSvc = fakeSuccessSvc
+	r.availabilitySetsSvc = fakeSuccessSvc
+
+	g.Expect(r.Delete(context.TODO())).To(Succeed())
+}
+
+func TestDeletePublicIP(t *testing.T) {
+	longName := strings.Repeat("a", 63)
+	truncatedName := azure.GenerateTruncatedMachinePublicIPName("cluster", longName)
+
+	testCases := []struct {
+		name                 string
+		nic                  interface{}
+		nicErr               error
+		expectedPublicIPName string
+	}{
+		{
+			name: "Deletes the public IP attached to the network interface",
+			nic: network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					IPConfigurations: &[]network.InterfaceIPConfiguration{{
+						InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+							PublicIPAddress: &network.PublicIPAddress{
+								ID: ptr.To("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/attached-ip"),
+							},
+						},
+					}},
+				},
+			},
+			expectedPublicIPName: "attached-ip",
+		},
+		{
+			name:                 "Deletes the truncated public IP name when the network interface is not found",
+			nicErr:               autorest.DetailedError{StatusCode: 404, Message: "Not found"},
+			expectedPublicIPName: truncatedName,
+		},
+		{
+			name: "Deletes the truncated public IP name when the network interface has no public IP",
+			nic: network.Interface{
+				InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+					IPConfigurations: &[]network.InterfaceIPConfiguration{{
+						InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{},
+					}},
+				},
+			},
+			expectedPublicIPName: truncatedName,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.nic, tc.nicErr).Times(1)
+			nicSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			publicIPSvc := mock_azure.NewMockService(mockCtrl)
+			publicIPSvc.EXPECT().Delete(gomock.Any(), &publicips.Spec{Name: tc.expectedPublicIPName}).Return(nil).Times(1)
+
+			fakeSuccessSvc := &azure.FakeSuccessService{}
+			scope := newFakeScope(t, actuators.Node)
+			scope.ClusterName = "cluster"
+			scope.Machine.Name = longName
+			scope.MachineConfig.PublicIP = true
+			// Public IP name truncation is disabled, as when it was turned off after the machine was created.
+			scope.PublicIPNameTruncationEnabled = false
+			r := newFakeReconcilerWithScope(t, scope)
+			r.networkInterfacesSvc = nicSvc
+			r.publicIPSvc = publicIPSvc
+			r.disksSvc = fakeSuccessSvc
+			r.availabilitySetsSvc = fakeSuccessSvc
+
+			g.Expect(r.Delete(context.TODO())).To(Succeed())
+		})
+	}
+}
+
+func TestDeleteAvailabilitySet(t *testing.T) {
+	testCases := []struct {
+		name            string
+		availabilitySet string
+		deleteErr       error
+		expectedName    string
+		expectedError   string
+	}{
+		{
+			name:         "Deletes the generated availability set",
+			expectedName: "clusterID_machineset-test-as",
+		},
+		{
+			name:            "Leaves the availability set set in the machine config",
+			availabilitySet: "my-availability-set",
+		},
+		{
+			name:          "Fails when the availability set can not be deleted",
+			deleteErr:     errors.New("test error"),
+			expectedName:  "clusterID_machineset-test-as",
+			expectedError: "failed to delete availability set: test error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			// No expectation is set on Delete when no availability set is expected to be deleted.
+			availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectedName != "" {
+				availabilitySetsSvc.EXPECT().Delete(gomock.Any(), &availabilitysets.Spec{Name: tc.expectedName}).Return(tc.deleteErr).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Labels[MachineSetLabelName] = "machineset-test"
+			scope.Machine.Labels[machinev1.MachineClusterIDLabel] = "clusterID"
+			scope.MachineConfig.AvailabilitySet = tc.availabilitySet
+			r := newFakeReconcilerWithScope(t, scope)
+			r.disksSvc = &azure.FakeSuccessService{}
+			r.networkInterfacesSvc = &azure.FakeSuccessService{}
+			r.availabilitySetsSvc = availabilitySetsSvc
+
+			err := r.Delete(context.TODO())
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestStackHubDataDiskDeletion(t *testing.T) {
+	dataDisks := []machinev1.DataDisk{
+		{NameSuffix: "delete-a", DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete},
+		{NameSuffix: "detach", DeletionPolicy: machinev1.DiskDeletionPolicyTypeDetach},
+		{NameSuffix: "delete-b", DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete},
+	}
+
+	t.Run("Deletes the data disks with the Delete policy", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		disksSvc := mock_azure.NewMockService(mockCtrl)
+		gomock.InOrder(
+			disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: "machine-test_delete-a"}).Return(nil).Times(1),
+			disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: "machine-test_delete-b"}).Return(nil).Times(1),
+		)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.MachineConfig.DataDisks = dataDisks
+		r := newFakeReconcilerWithScope(t, scope)
+		r.disksSvc = disksSvc
+
+		g.Expect(r.deleteDataDisks(context.TODO(), "")).To(Succeed())
+	})
+
+	t.Run("Fails when a data disk can not be deleted", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		disksSvc := mock_azure.NewMockService(mockCtrl)
+		disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: "machine-test_delete-a"}).Return(errors.New("test error")).Times(1)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.MachineConfig.DataDisks = dataDisks
+		r := newFakeReconcilerWithScope(t, scope)
+		r.disksSvc = disksSvc
+
+		g.Expect(r.deleteDataDisks(context.TODO(), "")).To(MatchError("failed to delete data disk machine-test_delete-a: test error"))
+	})
+
+	t.Run("Data disks are deleted with the virtual machine on public Azure", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		// Only the OS disk is deleted.
+		disksSvc := mock_azure.NewMockService(mockCtrl)
+		disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: azure.GenerateOSDiskName("machine-test")}).Return(nil).Times(1)
+
+		scope := newFakeScope(t, actuators.Node)
+		scope.MachineConfig.DataDisks = dataDisks
+		r := newFakeReconcilerWithScope(t, scope)
+		r.disksSvc = disksSvc
+		r.availabilitySetsSvc = &azure.FakeSuccessService{}
+
+		g.Expect(r.Delete(context.TODO())).To(Succeed())
+	})
+}
+
+func TestDeleteFromCreationResourceGroup(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		resourceGroup         string
+		providerID            *string
+		expectedResourceGroup string
+	}{
+		{
+			name:          "Deletes from the resource group of the provider spec",
+			resourceGroup: "compute-rg",
+		},
+		{
+			name:                  "Deletes from the resource group the machine was created in",
+			resourceGroup:         "compute-rg",
+			providerID:            ptr.To(azure.GenerateMachineProviderID("sub", "Created-RG", "machine")),
+			expectedResourceGroup: "created-rg",
+		},
+		{
+			name:          "Deletes from the resource group of the provider spec when the machine was created in it",
+			resourceGroup: "Compute-RG",
+			providerID:    ptr.To(azure.GenerateMachineProviderID("sub", "Compute-RG", "machine")),
+		},
+		{
+			name:          "Ignores an invalid provider ID",
+			resourceGroup: "compute-rg",
+			providerID:    ptr.To("azure:///invalid"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.ResourceGroup = tc.resourceGroup
+			scope.Machine.Spec.ProviderID = tc.providerID
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Delete(gomock.Any(), &virtualmachines.Spec{Name: "machine-test", ResourceGroup: tc.expectedResourceGroup}).Return(nil).Times(1)
+			disksSvc := mock_azure.NewMockService(mockCtrl)
+			disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: azure.GenerateOSDiskName("machine-test"), ResourceGroup: tc.expectedResourceGroup}).Return(nil).Times(1)
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Delete(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic", VnetName: "dummyVnet", ResourceGroup: tc.expectedResourceGroup}).Return(nil).Times(1)
+			availabilitySetsSvc := mock_azure.NewMockService(mockCtrl)
+			availabilitySetsSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+				g.Expect(spec.(*availabilitysets.Spec).ResourceGroup).To(Equal(tc.expectedResourceGroup))
+				return nil
+			}).Times(1)
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.disksSvc = disksSvc
+			r.networkInterfacesSvc = nicSvc
+			r.availabilitySetsSvc = availabilitySetsSvc
+
+			g.Expect(r.Delete(context.TODO())).To(Succeed())
+			// The provider spec of the machine is left unchanged.
+			g.Expect(scope.MachineConfig.ResourceGroup).To(Equal(tc.resourceGroup))
+		})
+	}
+}
+
+func TestUpdateInCreationResourceGroup(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		providerID            *string
+		expectedResourceGroup string
+		expectedProviderID    string
+	}{
+		{
+			name:               "Updates in the resource group of the provider spec",
+			expectedProviderID: azure.GenerateMachineProviderID("sub", "compute-rg", "machine-test"),
+		},
+		{
+			name:                  "Updates in the resource group the machine was created in",
+			providerID:            ptr.To(azure.GenerateMachineProviderID("sub", "created-rg", "machine-test")),
+			expectedResourceGroup: "created-rg",
+			expectedProviderID:    azure.GenerateMachineProviderID("sub", "created-rg", "machine-test"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), &virtualmachines.Spec{Name: "machine-test", ResourceGroup: tc.expectedResourceGroup}).Return(compute.VirtualMachine{
+				ID: ptr.To("machine-test-ID"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+					OsProfile:         &compute.OSProfile{ComputerName: ptr.To("machine-test")},
+				},
+			}, nil).Times(1)
+			vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), &virtualmachines.TagsSpec{
+				Name:          "machine-test",
+				Tags:          map[string]*string{"env": ptr.To("prod")},
+				ResourceGroup: tc.expectedResourceGroup,
+			}).Return(nil).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = "sub"
+			scope.MachineConfig.ResourceGroup = "compute-rg"
+			scope.Machine.Spec.ProviderID = tc.providerID
+			scope.Tags = map[string]*string{"env": ptr.To("prod")}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+			g.Expect(scope.Machine.Spec.ProviderID).To(HaveValue(Equal(tc.expectedProviderID)))
+		})
+	}
+}
+
+func TestGetOSDiskDeletionPolicy(t *testing.T) {
+	testCases := []struct {
+		name           string
+		annotations    map[string]string
+		ephemeral      bool
+		expectedPolicy machinev1.DiskDeletionPolicyType
+		expectedError  string
+	}{
+		{
+			name: "No annotation",
+		},
+		{
+			name:           "Delete",
+			annotations:    map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Delete"},
+			expectedPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+		},
+		{
+			name:           "Detach in lower case",
+			annotations:    map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "detach"},
+			expectedPolicy: machinev1.DiskDeletionPolicyTypeDetach,
+		},
+		{
+			name:           "Delete for an ephemeral OS disk",
+			annotations:    map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Delete"},
+			ephemeral:      true,
+			expectedPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+		},
+		{
+			name:          "Detach for an ephemeral OS disk",
+			annotations:   map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Detach"},
+			ephemeral:     true,
+			expectedError: "annotation machine.openshift.io/azure-os-disk-deletion-policy can not be Detach for an ephemeral OS disk",
+		},
+		{
+			name:          "Invalid policy",
+			annotations:   map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Keep"},
+			expectedError: "annotation machine.openshift.io/azure-os-disk-deletion-policy must be one of [Delete Detach], got \"Keep\"",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			if tc.ephemeral {
+				scope.MachineConfig.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+
+			policy, err := r.getOSDiskDeletionPolicy()
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(policy).To(Equal(tc.expectedPolicy))
+		})
+	}
+}
+
+func TestDeleteOSDiskDeletionPolicy(t *testing.T) {
+	testCases := []struct {
+		name                string
+		annotations         map[string]string
+		expectOSDiskDeleted bool
+	}{
+		{
+			name:                "OS disk is deleted by default",
+			expectOSDiskDeleted: true,
+		},
+		{
+			name:                "OS disk is deleted with the Delete policy",
+			annotations:         map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Delete"},
+			expectOSDiskDeleted: true,
+		},
+		{
+			name:        "OS disk is kept with the Detach policy",
+			annotations: map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Detach"},
+		},
+		{
+			name:                "OS disk is deleted with an invalid policy",
+			annotations:         map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Keep"},
+			expectOSDiskDeleted: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+
+			disksSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectOSDiskDeleted {
+				disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: azure.GenerateOSDiskName(scope.Machine.Name)}).Return(nil).Times(1)
+			}
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.disksSvc = disksSvc
+			r.networkInterfacesSvc = &azure.FakeSuccessService{}
+			r.availabilitySetsSvc = &azure.FakeSuccessService{}
+
+			g.Expect(r.Delete(context.TODO())).To(Succeed())
+		})
+	}
+}
+
+func TestCreateVirtualMachineFailedProvisioning(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{
+			name: "OS disk deleted by default",
+		},
+		{
+			name:        "OS disk deleted with the Detach policy",
+			annotations: map[string]string{MachineOSDiskDeletionPolicyAnnotationName: "Detach"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID:   ptr.To("machine-test-ID"),
+				Name: ptr.To("machine-test"),
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Failed"),
+				},
+			}, nil).Times(1)
+			vmSvc.EXPECT().Delete(gomock.Any(), &virtualmachines.Spec{Name: "machine-test"}).Return(nil).Times(1)
+
+			// The recreated VM creates an OS disk of the same name, so it is deleted whatever its deletion policy.
+			disksSvc := mock_azure.NewMockService(mockCtrl)
+			disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: "machine-test_OSDisk"}).Return(nil).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.DeletionVerificationEnabled = true
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.disksSvc = disksSvc
+			r.networkInterfacesSvc = &azure.FakeSuccessService{}
+			r.availabilitySetsSvc = &azure.FakeSuccessService{}
+
+			err := r.createVirtualMachine(context.TODO(), "machine-test-nic", "")
+			g.Expect(err).To(MatchError(errVMProvisioningFailed))
+
+			// The machine is recreated rather than deleted, so its resources are not checked for orphans.
+			g.Expect(findCondition(scope.MachineStatus.Conditions, resourcesOrphanedConditionType)).To(BeNil())
+		})
+	}
+}
+
+func TestDeleteVerification(t *testing.T) {
+	notFoundErr := autorest.DetailedError{StatusCode: 404}
+
+	testCases := []struct {
+		name              string
+		nicDeleteErr      error
+		nicGetErr         error
+		osDiskGetErr      error
+		expectedError     string
+		expectedCondition *metav1.Condition
+		expectedEvent     string
+	}{
+		{
+			name:         "All resources deleted",
+			nicGetErr:    notFoundErr,
+			osDiskGetErr: notFoundErr,
+		},
+		{
+			name:          "Network interface left behind by a failed delete",
+			nicDeleteErr:  errors.New("test error"),
+			osDiskGetErr:  notFoundErr,
+			expectedError: "Unable to delete network interface: test error",
+			expectedCondition: &metav1.Condition{
+				Type:    resourcesOrphanedConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  resourcesNotDeletedReason,
+				Message: `resources of the machine remain after deleting it: network interface "machine-test-nic"`,
+			},
+		},
+		{
+			name:      "OS disk left behind by a successful delete",
+			nicGetErr: notFoundErr,
+			expectedCondition: &metav1.Condition{
+				Type:    resourcesOrphanedConditionType,
+				Status:  metav1.ConditionTrue,
+				Reason:  resourcesNotDeletedReason,
+				Message: `resources of the machine remain after deleting it: OS disk "machine-test_OSDisk"`,
+			},
+			expectedEvent: `Warning ResourcesOrphaned Machine deleted while some of its resources remain, they have to be deleted manually: OS disk "machine-test_OSDisk"`,
+		},
+		{
+			name:         "Resource which can not be checked",
+			nicGetErr:    errors.New("test error"),
+			osDiskGetErr: notFoundErr,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Delete(gomock.Any(), &virtualmachines.Spec{Name: "machine-test"}).Return(nil).Times(1)
+			vmSvc.EXPECT().Get(gomock.Any(), &virtualmachines.Spec{Name: "machine-test"}).Return(nil, notFoundErr).Times(1)
+
+			disksSvc := mock_azure.NewMockService(mockCtrl)
+			disksSvc.EXPECT().Delete(gomock.Any(), &disks.Spec{Name: "machine-test_OSDisk"}).Return(nil).Times(1)
+			disksSvc.EXPECT().Get(gomock.Any(), &disks.Spec{Name: "machine-test_OSDisk"}).Return(compute.Disk{}, tc.osDiskGetErr).Times(1)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(tc.nicDeleteErr).Times(1)
+			nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "machine-test-nic"}).
+				Return(network.Interface{}, tc.nicGetErr).Times(1)
+
+			recorder := record.NewFakeRecorder(1)
+			scope := newFakeScope(t, actuators.Node)
+			scope.EventRecorder = recorder
+			scope.DeletionVerificationEnabled = true
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+			r.disksSvc = disksSvc
+			r.networkInterfacesSvc = nicSvc
+			r.availabilitySetsSvc = &azure.FakeSuccessService{}
+
+			err := r.Delete(context.TODO())
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			condition := findCondition(scope.MachineStatus.Conditions, resourcesOrphanedConditionType)
+			if tc.expectedCondition == nil {
+				g.Expect(condition).To(BeNil())
+			} else {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(tc.expectedCondition.Status))
+				g.Expect(condition.Reason).To(Equal(tc.expectedCondition.Reason))
+				g.Expect(condition.Message).To(Equal(tc.expectedCondition.Message))
+			}
+
+			if tc.expectedEvent == "" {
+				g.Expect(recorder.Events).To(BeEmpty())
+			} else {
+				g.Expect(recorder.Events).To(Receive(Equal(tc.expectedEvent)))
+			}
+		})
+	}
+}
+
+func TestGetNetworkInterfaceVnet(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		annotations               map[string]string
+		expectedVnet              string
+		expectedVnetResourceGroup string
+		expectedError             error
+	}{
+		{
+			name:         "Vnet of the provider spec",
+			expectedVnet: "dummyVnet",
+		},
+		{
+			name:         "Vnet by name",
+			annotations:  map[string]string{MachineNetworkInterfaceVnetAnnotationName: "other-vnet"},
+			expectedVnet: "other-vnet",
+		},
+		{
+			name: "Vnet by resource ID",
+			annotations: map[string]string{
+				MachineNetworkInterfaceVnetAnnotationName: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/other-rg/providers/Microsoft.Network/virtualNetworks/other-vnet",
+			},
+			expectedVnet:              "other-vnet",
+			expectedVnetResourceGroup: "other-rg",
+		},
+		{
+			name: "Resource ID of another resource type",
+			annotations: map[string]string{
+				MachineNetworkInterfaceVnetAnnotationName: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/other-rg/providers/Microsoft.Network/networkSecurityGroups/nsg",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid virtual network %q: not the ID of a Microsoft.Network/virtualNetworks resource",
+				"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/other-rg/providers/Microsoft.Network/networkSecurityGroups/nsg"),
+		},
+		{
+			name: "Vnet in another subscription",
+			annotations: map[string]string{
+				MachineNetworkInterfaceVnetAnnotationName: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/other-rg/providers/Microsoft.Network/virtualNetworks/other-vnet",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("virtual network %q must be in subscription %s of the machine",
+				"/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/other-rg/providers/Microsoft.Network/virtualNetworks/other-vnet", "00000000-0000-0000-0000-000000000000"),
+		},
+		{
+			name:        "Empty vnet",
+			annotations: map[string]string{MachineNetworkInterfaceVnetAnnotationName: ""},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must not be empty",
+				MachineNetworkInterfaceVnetAnnotationName),
+		},
+		{
+			name: "Pre-existing network interface",
+			annotations: map[string]string{
+				MachineNetworkInterfaceVnetAnnotationName: "other-vnet",
+				MachineNetworkInterfaceAnnotationName:     "my-nic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s can not be set on a machine with a pre-existing network interface set by annotation %s",
+				MachineNetworkInterfaceVnetAnnotationName, MachineNetworkInterfaceAnnotationName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = "00000000-0000-0000-0000-000000000000"
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			vnet, vnetResourceGroup, err := r.getNetworkInterfaceVnet()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(vnet).To(Equal(tc.expectedVnet))
+				g.Expect(vnetResourceGroup).To(Equal(tc.expectedVnetResourceGroup))
+			}
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceInAnotherVnet(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+		nicSpec := spec.(*networkinterfaces.Spec)
+		g.Expect(nicSpec.SubnetName).To(Equal("dummySubnet"))
+		g.Expect(nicSpec.VnetName).To(Equal("other-vnet"))
+		g.Expect(nicSpec.VnetResourceGroup).To(Equal("other-rg"))
+		return nil
+	}).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.SubscriptionID = "00000000-0000-0000-0000-000000000000"
+	scope.Machine.Annotations = map[string]string{
+		MachineNetworkInterfaceVnetAnnotationName: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/other-rg/providers/Microsoft.Network/virtualNetworks/other-vnet",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "machine-test-nic")).To(Succeed())
+}
+
+func TestValidateGeneratedNames(t *testing.T) {
+	longName := strings.Repeat("a", 77)
+
+	testCases := []struct {
+		name                 string
+		machineName          string
+		annotations          map[string]string
+		publicIP             bool
+		truncatePublicIPName bool
+		dataDiskNameSuffix   string
+		availabilitySet      string
+		expectedError        error
+	}{
+		{
+			name:        "Accepts names within the limits",
+			machineName: "machine-test",
+		},
+		{
+			name:          "Rejects network interface and OS disk names longer than 80 characters",
+			machineName:   longName,
+			expectedError: machinecontroller.InvalidMachineConfiguration("network interface name %q is longer than 80 characters; OS disk name %q is longer than 80 characters", longName+"-nic", longName+"_OSDisk"),
+		},
+		{
+			name:        "Does not check the name of a user managed network interface",
+			machineName: longName,
+			annotations: map[string]string{
+				MachineNetworkInterfaceAnnotationName: "my-nic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("OS disk name %q is longer than 80 characters", longName+"_OSDisk"),
+		},
+		{
+			name:          "Rejects public IP names longer than 63 characters",
+			machineName:   strings.Repeat("a", 63),
+			publicIP:      true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("unable to create Public IP: machine public IP name is longer than 63 characters"),
+		},
+		{
+			name:                 "Accepts public IP names longer than 63 characters when they are truncated",
+			machineName:          strings.Repeat("a", 63),
+			publicIP:             true,
+			truncatePublicIPName: true,
+		},
+		{
+			name:               "Rejects data disk names longer than 80 characters",
+			machineName:        "machine-test",
+			dataDiskNameSuffix: strings.Repeat("d", 68),
+			expectedError:      machinecontroller.InvalidMachineConfiguration("data disk name %q is longer than 80 characters", "machine-test_"+strings.Repeat("d", 68)),
+		},
+		{
+			name:            "Rejects availability set names longer than 80 characters",
+			machineName:     "machine-test",
+			availabilitySet: strings.Repeat("s", 81),
+			expectedError:   machinecontroller.InvalidMachineConfiguration("availability set name %q is longer than 80 characters", strings.Repeat("s", 81)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Name = tc.machineName
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.PublicIP = tc.publicIP
+			scope.PublicIPNameTruncationEnabled = tc.truncatePublicIPName
+			scope.MachineConfig.AvailabilitySet = tc.availabilitySet
+			if tc.dataDiskNameSuffix != "" {
+				scope.MachineConfig.DataDisks = []machinev1.DataDisk{{NameSuffix: tc.dataDiskNameSuffix}}
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+
+			err := r.validateGeneratedNames()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestGetSecondaryPrivateIPs(t *testing.T) {
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		expectedCount     int
+		expectedAddresses []string
+		expectedError     error
+	}{
+		{
+			name: "No secondary private IPs",
+		},
+		{
+			name:          "Number of dynamic secondary private IPs",
+			annotations:   map[string]string{MachineSecondaryPrivateIPsAnnotationName: "2"},
+			expectedCount: 2,
+		},
+		{
+			name:              "Static secondary private IPs",
+			annotations:       map[string]string{MachineSecondaryPrivateIPsAnnotationName: "10.0.0.10, 10.0.0.11"},
+			expectedAddresses: []string{"10.0.0.10", "10.0.0.11"},
+		},
+		{
+			name:        "Negative number of secondary private IPs",
+			annotations: map[string]string{MachineSecondaryPrivateIPsAnnotationName: "-1"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must not be negative, got %d",
+				MachineSecondaryPrivateIPsAnnotationName, -1),
+		},
+		{
+			name:        "Invalid secondary private IP",
+			annotations: map[string]string{MachineSecondaryPrivateIPsAnnotationName: "10.0.0.10,ten"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a number or a comma separated list of IP addresses, got %q",
+				MachineSecondaryPrivateIPsAnnotationName, "10.0.0.10,ten"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			count, addresses, err := r.getSecondaryPrivateIPs()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(count).To(Equal(tc.expectedCount))
+				g.Expect(addresses).To(Equal(tc.expectedAddresses))
+			}
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceSecondaryPrivateIPs(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+		nicSpec := spec.(*networkinterfaces.Spec)
+		g.Expect(nicSpec.SecondaryIPCount).To(BeZero())
+		g.Expect(nicSpec.SecondaryIPAddresses).To(Equal([]string{"10.0.0.10", "10.0.0.11"}))
+		return nil
+	}).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineSecondaryPrivateIPsAnnotationName: "10.0.0.10,10.0.0.11"}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestGetDNSServers(t *testing.T) {
+	testCases := []struct {
+		name            string
+		annotations     map[string]string
+		expectedServers []string
+		expectedError   error
+	}{
+		{
+			name: "No DNS servers",
+		},
+		{
+			name:            "DNS servers",
+			annotations:     map[string]string{MachineDNSServersAnnotationName: "10.0.0.4, 10.0.0.5,fd00::4"},
+			expectedServers: []string{"10.0.0.4", "10.0.0.5", "fd00::4"},
+		},
+		{
+			name:        "Invalid DNS server",
+			annotations: map[string]string{MachineDNSServersAnnotationName: "10.0.0.4,dns.example.com"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of IP addresses, got %q",
+				MachineDNSServersAnnotationName, "10.0.0.4,dns.example.com"),
+		},
+		{
+			name:        "Empty DNS server",
+			annotations: map[string]string{MachineDNSServersAnnotationName: "10.0.0.4,"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of IP addresses, got %q",
+				MachineDNSServersAnnotationName, "10.0.0.4,"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			servers, err := r.getDNSServers()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(servers).To(Equal(tc.expectedServers))
+			}
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceDNSServers(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+		nicSpec := spec.(*networkinterfaces.Spec)
+		g.Expect(nicSpec.DNSServers).To(Equal([]string{"10.0.0.4", "10.0.0.5"}))
+		return nil
+	}).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineDNSServersAnnotationName: "10.0.0.4,10.0.0.5"}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestGetIPForwarding(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      bool
+		expectedError error
+	}{
+		{
+			name: "IP forwarding defaults to disabled",
+		},
+		{
+			name:        "IP forwarding enabled",
+			annotations: map[string]string{MachineIPForwardingAnnotationName: "true"},
+			expected:    true,
+		},
+		{
+			name:        "IP forwarding disabled",
+			annotations: map[string]string{MachineIPForwardingAnnotationName: "false"},
+		},
+		{
+			name:        "Invalid IP forwarding",
+			annotations: map[string]string{MachineIPForwardingAnnotationName: "enabled"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q",
+				MachineIPForwardingAnnotationName, "enabled"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			enabled, err := r.getIPForwarding()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(enabled).To(Equal(tc.expected))
+			}
+		})
+	}
+}
+
+func TestGetHibernationEnabled(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expected      *bool
+		expectedError error
+	}{
+		{
+			name: "Hibernation left unset",
+		},
+		{
+			name:        "Hibernation enabled",
+			annotations: map[string]string{MachineHibernationEnabledAnnotationName: "true"},
+			expected:    ptr.To(true),
+		},
+		{
+			name:        "Hibernation disabled",
+			annotations: map[string]string{MachineHibernationEnabledAnnotationName: "false"},
+			expected:    ptr.To(false),
+		},
+		{
+			name:        "Invalid hibernation",
+			annotations: map[string]string{MachineHibernationEnabledAnnotationName: "enabled"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be true or false, got %q",
+				MachineHibernationEnabledAnnotationName, "enabled"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			enabled, err := r.getHibernationEnabled()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(enabled).To(Equal(tc.expected))
+			}
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceIPForwarding(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name: "IP forwarding not requested",
+		},
+		{
+			name:        "IP forwarding requested",
+			annotations: map[string]string{MachineIPForwardingAnnotationName: "true"},
+			expected:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+				g.Expect(spec.(*networkinterfaces.Spec).IPForwarding).To(Equal(tc.expected))
+				return nil
+			}).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+			r.networkInterfacesSvc = nicSvc
+
+			g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+		})
+	}
+}
+
+func TestGetStaticPrivateIP(t *testing.T) {
+	testCases := []struct {
+		name            string
+		annotations     map[string]string
+		expectedAddress string
+		expectedIndex   *int
+		expectedRange   string
+		expectedError   error
+	}{
+		{
+			name: "No static private IP",
+		},
+		{
+			name:            "Static private IPv4 address",
+			annotations:     map[string]string{MachinePrivateIPAnnotationName: "10.0.0.10"},
+			expectedAddress: "10.0.0.10",
+		},
+		{
+			name:            "Static private IPv6 address",
+			annotations:     map[string]string{MachinePrivateIPAnnotationName: "fd00::10"},
+			expectedAddress: "fd00::10",
+		},
+		{
+			name:          "Static private IP index",
+			annotations:   map[string]string{MachinePrivateIPAnnotationName: "10"},
+			expectedIndex: ptr.To(10),
+		},
+		{
+			name: "Static private IP index in a range",
+			annotations: map[string]string{
+				MachinePrivateIPAnnotationName:      "10",
+				MachinePrivateIPRangeAnnotationName: "10.0.0.128/25",
+			},
+			expectedIndex: ptr.To(10),
+			expectedRange: "10.0.0.128/25",
+		},
+		{
+			name:        "Negative static private IP index",
+			annotations: map[string]string{MachinePrivateIPAnnotationName: "-1"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must not be negative, got %d",
+				MachinePrivateIPAnnotationName, -1),
+		},
+		{
+			name:        "Invalid static private IP",
+			annotations: map[string]string{MachinePrivateIPAnnotationName: "ten"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be an index or an IP address, got %q",
+				MachinePrivateIPAnnotationName, "ten"),
+		},
+		{
+			name: "Invalid static private IP range",
+			annotations: map[string]string{
+				MachinePrivateIPAnnotationName:      "10",
+				MachinePrivateIPRangeAnnotationName: "10.0.0.128",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a CIDR range, got %q",
+				MachinePrivateIPRangeAnnotationName, "10.0.0.128"),
+		},
+		{
+			name:        "Static private IP range without an index",
+			annotations: map[string]string{MachinePrivateIPRangeAnnotationName: "10.0.0.128/25"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires annotation %s to be set to an index",
+				MachinePrivateIPRangeAnnotationName, MachinePrivateIPAnnotationName),
+		},
+		{
+			name: "Static private IP range with an address",
+			annotations: map[string]string{
+				MachinePrivateIPAnnotationName:      "10.0.0.10",
+				MachinePrivateIPRangeAnnotationName: "10.0.0.128/25",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires annotation %s to be set to an index, got %q",
+				MachinePrivateIPRangeAnnotationName, MachinePrivateIPAnnotationName, "10.0.0.10"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			address, index, ipRange, err := r.getStaticPrivateIP()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(address).To(Equal(tc.expectedAddress))
+				g.Expect(index).To(Equal(tc.expectedIndex))
+				g.Expect(ipRange).To(Equal(tc.expectedRange))
+			}
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceStaticPrivateIPIndex(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) error {
+		nicSpec := spec.(*networkinterfaces.Spec)
+		g.Expect(nicSpec.StaticIPAddress).To(BeEmpty())
+		g.Expect(nicSpec.StaticIPIndex).To(Equal(ptr.To(10)))
+		g.Expect(nicSpec.StaticIPRange).To(Equal("10.0.0.128/25"))
+		return nil
+	}).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{
+		MachinePrivateIPAnnotationName:      "10",
+		MachinePrivateIPRangeAnnotationName: "10.0.0.128/25",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestCreateNetworkInterfacePublicIPNameTooLong(t *testing.T) {
+	longMachineName := strings.Repeat("0123456789", 6)
+
+	testCases := []struct {
+		name               string
+		truncationEnabled  bool
+		expectPublicIPName string
+		expectedError      error
+	}{
+		{
+			name:          "Fails with an over-length public IP name by default",
+			expectedError: machinecontroller.InvalidMachineConfiguration("unable to create Public IP: machine public IP name is longer than 63 characters"),
+		},
+		{
+			name:               "Truncates an over-length public IP name when enabled",
+			truncationEnabled:  true,
+			expectPublicIPName: azure.GenerateTruncatedMachinePublicIPName("cluster", longMachineName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			publicIPSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectPublicIPName != "" {
+				publicIPSvc.EXPECT().CreateOrUpdate(gomock.Any(), &publicips.Spec{Name: tc.expectPublicIPName}).Return(nil).Times(1)
+				nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.ClusterName = "cluster"
+			scope.Machine.Name = longMachineName
+			scope.MachineConfig.PublicIP = true
+			scope.PublicIPNameTruncationEnabled = tc.truncationEnabled
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.publicIPSvc = publicIPSvc
+			r.networkInterfacesSvc = nicSvc
+
+			err := r.createNetworkInterface(context.TODO(), "nic")
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestGetPublicIPDNSSettings(t *testing.T) {
+	testCases := []struct {
+		name                string
+		publicIP            bool
+		annotations         map[string]string
+		expectedLabel       string
+		expectedIdleTimeout *int32
+		expectedError       error
+	}{
+		{
+			name:     "Nothing is set without annotations",
+			publicIP: true,
+		},
+		{
+			name:     "Sets the DNS label and idle timeout",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: "my-machine-1",
+				MachinePublicIPIdleTimeoutAnnotationName:     "15",
+			},
+			expectedLabel:       "my-machine-1",
+			expectedIdleTimeout: ptr.To[int32](15),
+		},
+		{
+			name: "Fails without a public IP",
+			annotations: map[string]string{
+				MachinePublicIPIdleTimeoutAnnotationName: "15",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", MachinePublicIPIdleTimeoutAnnotationName),
+		},
+		{
+			name:     "Fails with a DNS label with uppercase letters",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: "My-Machine",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+				"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, "My-Machine"),
+		},
+		{
+			name:     "Fails with a DNS label starting with a number",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: "1machine",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+				"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, "1machine"),
+		},
+		{
+			name:     "Fails with a DNS label ending with a hyphen",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: "machine-",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+				"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, "machine-"),
+		},
+		{
+			name:     "Fails with a DNS label shorter than 3 characters",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: "ab",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+				"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, "ab"),
+		},
+		{
+			name:     "Fails with a DNS label longer than 63 characters",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPDomainNameLabelAnnotationName: strings.Repeat("a", 64),
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be 3 to 63 lowercase letters, numbers and hyphens, "+
+				"starting with a letter and ending with a letter or number, got %q", MachinePublicIPDomainNameLabelAnnotationName, strings.Repeat("a", 64)),
+		},
+		{
+			name:     "Fails with an idle timeout out of range",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPIdleTimeoutAnnotationName: "31",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a number of minutes between 4 and 30, got %q", MachinePublicIPIdleTimeoutAnnotationName, "31"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.PublicIP = tc.publicIP
+			r := newFakeReconcilerWithScope(t, scope)
+
+			label, idleTimeout, err := r.getPublicIPDNSSettings()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(label).To(Equal(tc.expectedLabel))
+			g.Expect(idleTimeout).To(Equal(tc.expectedIdleTimeout))
+		})
+	}
+}
+
+func TestCreateNetworkInterfacePublicIPDNSSettings(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	publicIPSvc := mock_azure.NewMockService(mockCtrl)
+	publicIPSvc.EXPECT().CreateOrUpdate(gomock.Any(), &publicips.Spec{
+		Name:                 "cluster-machine-test",
+		DomainNameLabel:      "my-machine",
+		IdleTimeoutInMinutes: ptr.To[int32](10),
+	}).Return(nil).Times(1)
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.ClusterName = "cluster"
+	scope.MachineConfig.PublicIP = true
+	scope.Machine.Annotations = map[string]string{
+		MachinePublicIPDomainNameLabelAnnotationName: "my-machine",
+		MachinePublicIPIdleTimeoutAnnotationName:     "10",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.publicIPSvc = publicIPSvc
+	r.networkInterfacesSvc = nicSvc
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestGetPublicIPSKUAndAllocationMethod(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		publicIP                 bool
+		publicLoadBalancer       string
+		annotations              map[string]string
+		expectedSKU              network.PublicIPAddressSkuName
+		expectedAllocationMethod network.IPAllocationMethod
+		expectedError            error
+	}{
+		{
+			name:     "Nothing is set without annotations",
+			publicIP: true,
+		},
+		{
+			name:     "Allows a Standard static public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName:              "standard",
+				MachinePublicIPAllocationMethodAnnotationName: "static",
+			},
+			expectedSKU:              network.PublicIPAddressSkuNameStandard,
+			expectedAllocationMethod: network.IPAllocationMethodStatic,
+		},
+		{
+			name:     "Allows a Basic dynamic public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName:              "Basic",
+				MachinePublicIPAllocationMethodAnnotationName: "Dynamic",
+			},
+			expectedSKU:              network.PublicIPAddressSkuNameBasic,
+			expectedAllocationMethod: network.IPAllocationMethodDynamic,
+		},
+		{
+			name:     "Allows a Basic static public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName: "Basic",
+			},
+			expectedSKU: network.PublicIPAddressSkuNameBasic,
+		},
+		{
+			name:     "Fails with a Standard dynamic public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName:              "Standard",
+				MachinePublicIPAllocationMethodAnnotationName: "Dynamic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("public IP SKU Standard requires the Static allocation method"),
+		},
+		{
+			name:     "Fails with a dynamic public IP of the default SKU",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPAllocationMethodAnnotationName: "Dynamic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("public IP SKU Standard requires the Static allocation method"),
+		},
+		{
+			name:               "Fails with a Basic public IP in a load balancer backend pool",
+			publicIP:           true,
+			publicLoadBalancer: "public-lb",
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName: "Basic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("public IP SKU Basic can not be used by a machine in a load balancer backend pool"),
+		},
+		{
+			name:     "Fails with an unknown SKU",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName: "Premium",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPSKUAnnotationName, network.PossiblePublicIPAddressSkuNameValues(), "Premium"),
+		},
+		{
+			name:     "Fails with an unknown allocation method",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPAllocationMethodAnnotationName: "Reserved",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPAllocationMethodAnnotationName, network.PossibleIPAllocationMethodValues(), "Reserved"),
+		},
+		{
+			name: "Fails without a public IP",
+			annotations: map[string]string{
+				MachinePublicIPSKUAnnotationName: "Basic",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", MachinePublicIPSKUAnnotationName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.PublicIP = tc.publicIP
+			scope.MachineConfig.PublicLoadBalancer = tc.publicLoadBalancer
+			r := newFakeReconcilerWithScope(t, scope)
+
+			sku, allocationMethod, err := r.getPublicIPSKUAndAllocationMethod()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(sku).To(Equal(tc.expectedSKU))
+			g.Expect(allocationMethod).To(Equal(tc.expectedAllocationMethod))
+		})
+	}
+}
+
+func TestGetPublicIPVersion(t *testing.T) {
+	testCases := []struct {
+		name             string
+		publicIP         bool
+		annotations      map[string]string
+		sku              network.PublicIPAddressSkuName
+		allocationMethod network.IPAllocationMethod
+		expectedVersion  network.IPVersion
+		expectedError    error
+	}{
+		{
+			name:     "Nothing is set without annotation",
+			publicIP: true,
+		},
+		{
+			name:     "Allows an IPv6 public IP of the default SKU",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "ipv6",
+			},
+			expectedVersion: network.IPVersionIPv6,
+		},
+		{
+			name:     "Allows a Basic dynamic IPv6 public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "IPv6",
+			},
+			sku:              network.PublicIPAddressSkuNameBasic,
+			allocationMethod: network.IPAllocationMethodDynamic,
+			expectedVersion:  network.IPVersionIPv6,
+		},
+		{
+			name:     "Allows a Basic static IPv4 public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "IPv4",
+			},
+			sku:             network.PublicIPAddressSkuNameBasic,
+			expectedVersion: network.IPVersionIPv4,
+		},
+		{
+			name:     "Fails with a Basic static IPv6 public IP",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "IPv6",
+			},
+			sku:           network.PublicIPAddressSkuNameBasic,
+			expectedError: machinecontroller.InvalidMachineConfiguration("public IP SKU Basic requires the Dynamic allocation method for IPv6"),
+		},
+		{
+			name:     "Fails with an unknown IP family",
+			publicIP: true,
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "IPv5",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of %v, got %q",
+				MachinePublicIPVersionAnnotationName, network.PossibleIPVersionValues(), "IPv5"),
+		},
+		{
+			name: "Fails without a public IP",
+			annotations: map[string]string{
+				MachinePublicIPVersionAnnotationName: "IPv6",
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires a public IP", MachinePublicIPVersionAnnotationName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.PublicIP = tc.publicIP
+			r := newFakeReconcilerWithScope(t, scope)
+
+			version, err := r.getPublicIPVersion(tc.sku, tc.allocationMethod)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(version).To(Equal(tc.expectedVersion))
+		})
+	}
+}
+
+func TestCreateNetworkInterfacePublicIPSKUAndVersion(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	publicIPSvc := mock_azure.NewMockService(mockCtrl)
+	publicIPSvc.EXPECT().CreateOrUpdate(gomock.Any(), &publicips.Spec{
+		Name:             "cluster-machine-test",
+		SKU:              network.PublicIPAddressSkuNameBasic,
+		AllocationMethod: network.IPAllocationMethodDynamic,
+		Version:          network.IPVersionIPv6,
+	}).Return(nil).Times(1)
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.ClusterName = "cluster"
+	scope.MachineConfig.PublicIP = true
+	// Basic public IPs are only kept by existing machines.
+	scope.Machine.Spec.ProviderID = ptr.To(azure.GenerateMachineProviderID("sub", "rg", "machine-test"))
+	scope.Machine.Annotations = map[string]string{
+		MachinePublicIPSKUAnnotationName:              "Basic",
+		MachinePublicIPAllocationMethodAnnotationName: "Dynamic",
+		MachinePublicIPVersionAnnotationName:          "IPv6",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.publicIPSvc = publicIPSvc
+	r.networkInterfacesSvc = nicSvc
+	r.subnetsSvc = newFakeSubnetService(mockCtrl, "10.0.0.0/24", "fd00::/64")
+
+	g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+}
+
+func TestValidateNewPublicIPSKU(t *testing.T) {
+	testCases := []struct {
+		name          string
+		sku           string
+		providerID    *string
+		expectedError error
+	}{
+		{
+			name: "Accepts the default SKU for a new machine",
+		},
+		{
+			name: "Accepts the Standard SKU for a new machine",
+			sku:  "Standard",
+		},
+		{
+			name: "Rejects the Basic SKU for a new machine",
+			sku:  "Basic",
+			expectedError: machinecontroller.InvalidMachineConfiguration("public IP SKU %s is retired and can not be used by new machines, use %s",
+				network.PublicIPAddressSkuNameBasic, network.PublicIPAddressSkuNameStandard),
+		},
+		{
+			name:       "Accepts the Basic SKU for an existing machine",
+			sku:        "Basic",
+			providerID: ptr.To(azure.GenerateMachineProviderID("sub", "rg", "machine-test")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.PublicIP = true
+			scope.Machine.Spec.ProviderID = tc.providerID
+			if tc.sku != "" {
+				scope.Machine.Annotations = map[string]string{MachinePublicIPSKUAnnotationName: tc.sku}
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+
+			err := r.validateNewPublicIPSKU()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestCreateNetworkInterfaceIPv6PublicIPWithoutIPv6Subnet(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	// Neither the public IP nor the network interface are created.
+	publicIPSvc := mock_azure.NewMockService(mockCtrl)
+	nicSvc := mock_azure.NewMockService(mockCtrl)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.ClusterName = "cluster"
+	scope.MachineConfig.PublicIP = true
+	scope.Machine.Annotations = map[string]string{
+		MachinePublicIPVersionAnnotationName: "IPv6",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.publicIPSvc = publicIPSvc
+	r.networkInterfacesSvc = nicSvc
+	r.subnetsSvc = newFakeSubnetService(mockCtrl, "10.0.0.0/24")
+
+	err := r.createNetworkInterface(context.TODO(), "nic")
+	g.Expect(err).To(MatchError(machinecontroller.InvalidMachineConfiguration("public IP version %s requires subnet %s to have an IPv6 address space",
+		network.IPVersionIPv6, scope.MachineConfig.Subnet)))
+}
+
+func newFakeSubnetService(mockCtrl *gomock.Controller, prefixes ...string) *mock_azure.MockService {
+	subnetsSvc := mock_azure.NewMockService(mockCtrl)
+	subnetsSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Subnet{
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefixes: &prefixes,
+		},
+	}, nil).Times(1)
+	return subnetsSvc
+}
+
+func TestCreateMachineAcceleratedNetworkingEvent(t *testing.T) {
+	capableSKU := resourceskus.SKU{
+		Capabilities: &[]compute.ResourceSkuCapabilities{
+			{
+				Name:  ptr.To[string](resourceskus.AcceleratedNetworking),
+				Value: ptr.To[string](string(resourceskus.CapabilitySupported)),
+			},
+		},
+	}
+
+	testCases := []struct {
+		name                  string
+		acceleratedNetworking bool
+		suppressed            bool
+		sku                   resourceskus.SKU
+		skuErr                error
+		expectEvent           bool
+	}{
+		{
+			name:        "Emits an event when the VMSize supports accelerated networking and it is disabled",
+			sku:         capableSKU,
+			expectEvent: true,
+		},
+		{
+			name:                  "Does not emit an event when accelerated networking is enabled",
+			acceleratedNetworking: true,
+			sku:                   capableSKU,
+		},
+		{
+			name: "Does not emit an event when the VMSize does not support accelerated networking",
+			sku:  resourceskus.SKU{},
+		},
+		{
+			name:       "Does not emit an event when suppressed",
+			suppressed: true,
+			sku:        capableSKU,
+		},
+		{
+			name:   "Does not emit an event or fail when the VMSize lookup fails",
+			skuErr: errors.New("failed to list SKUs"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			nicSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(network.Interface{}, nil).AnyTimes()
+			skusSvc := mock_azure.NewMockService(mockCtrl)
+			skusSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.sku, tc.skuErr).AnyTimes()
+
+			recorder := record.NewFakeRecorder(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.VMSize = "Standard_D2s_v3"
+			scope.MachineConfig.AcceleratedNetworking = tc.acceleratedNetworking
+			scope.AcceleratedNetworkingEventsSuppressed = tc.suppressed
+			scope.EventRecorder = recorder
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.networkInterfacesSvc = nicSvc
+			r.resourcesSkus = skusSvc
+
+			g.Expect(r.CreateMachine(context.TODO())).To(Succeed())
+
+			if tc.expectEvent {
+				g.Expect(recorder.Events).To(Receive(HavePrefix("Normal AcceleratedNetworkingAvailable")))
+			} else {
+				g.Expect(recorder.Events).ToNot(Receive())
+			}
+
+			// The network interface recreated by Update does not emit the event again.
+			g.Expect(r.createNetworkInterface(context.TODO(), "nic")).To(Succeed())
+			g.Expect(recorder.Events).ToNot(Receive())
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	const capacityReservationGroupID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"
+
+	testCases := []struct {
+		name                 string
+		mutateConfig         func(*machinev1.AzureMachineProviderSpec)
+		providerID           *string
+		capacityReservations []compute.CapacityReservation
+		userData             []byte
+		expectedErrors       []error
+	}{
+		{
+			name: "Valid configuration",
+		},
+		{
+			name: "Missing vnet and subnet",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.Vnet = ""
+				config.Subnet = ""
+			},
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("MachineConfig vnet is missing on machine machine-test"),
+				machinecontroller.InvalidMachineConfiguration("MachineConfig subnet is missing on machine machine-test"),
+			},
+		},
+		{
+			name: "Invalid disk encryption set, capacity reservation group and data disk",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.OSDisk.ManagedDisk.DiskEncryptionSet = &machinev1.DiskEncryptionSetParameters{ID: "invalid"}
+				config.CapacityReservationGroupID = "invalid"
+				config.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix:     "disk",
+						DiskSizeGB:     1,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+			},
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("invalid osDisk.managedDisk.diskEncryptionSet.id: %v",
+					validateAzureDiskEncryptionSetID("invalid")),
+				machinecontroller.InvalidMachineConfiguration("invalid capacityReservationGroupID: %v",
+					validateAzureCapacityReservationGroupID("invalid")),
+				machinecontroller.InvalidMachineConfiguration("failed to create Data Disk: machine-test_disk for vm machine-test. " +
+					"`diskSizeGB`: 1, is invalid, disk size must be greater or equal than 4."),
+			},
+		},
+		{
+			name: "Zone and availability set",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.Zone = "1"
+				config.AvailabilitySet = "test-as"
+			},
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("availabilitySet %q and zone %q cannot both be set, a VM can either be placed in an availability set or in a zone",
+					"test-as", "1"),
+			},
+		},
+		{
+			name: "Capacity reservation group without a reservation for the VMSize",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.CapacityReservationGroupID = capacityReservationGroupID
+			},
+			capacityReservations: []compute.CapacityReservation{
+				{Sku: &compute.Sku{Name: ptr.To("Standard_D4s_v3")}},
+			},
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s",
+					capacityReservationGroupID, "Standard_D2s_v3"),
+			},
+		},
+		{
+			name: "Locally redundant storage not available in the zone of a new machine",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.Zone = "1"
+				config.OSDisk.ManagedDisk.StorageAccountType = "Premium_LRS"
+			},
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("invalid %s: locally-redundant storage account type %q is not available in zone %q of region %q, "+
+					"use a zone-redundant storage account type or a different zone", "osDisk.managedDisk.storageAccountType", "Premium_LRS", "1", "dummyLocation"),
+			},
+		},
+		{
+			name: "Locally redundant storage not available in the zone of an existing machine",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.Zone = "1"
+				config.OSDisk.ManagedDisk.StorageAccountType = "Premium_LRS"
+			},
+			providerID: ptr.To("azure:///subscriptions/123/resourceGroups/dummyResourceGroup/providers/Microsoft.Compute/virtualMachines/machine-test"),
+		},
+		{
+			name:     "User data secret too large",
+			userData: []byte(strings.Repeat("a", maxUserDataSize)),
+			expectedErrors: []error{
+				machinecontroller.InvalidMachineConfiguration("user data secret %s is %d bytes base64 encoded, more than the %d bytes Azure accepts",
+					"userdata", 87384, maxUserDataSize),
+			},
+		},
+		{
+			name: "Capacity reservation group with a reservation for the VMSize",
+			mutateConfig: func(config *machinev1.AzureMachineProviderSpec) {
+				config.CapacityReservationGroupID = capacityReservationGroupID
+			},
+			capacityReservations: []compute.CapacityReservation{
+				{Sku: &compute.Sku{Name: ptr.To("Standard_D2s_v3")}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			// No expectations are set on CreateOrUpdate or Delete, so any call to them fails the test.
+			skusSvc := mock_azure.NewMockService(mockCtrl)
+			skusSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).AnyTimes()
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Name = "machine-test"
+			scope.MachineConfig.VMSize = "Standard_D2s_v3"
+			if tc.mutateConfig != nil {
+				tc.mutateConfig(scope.MachineConfig)
+			}
+			scope.Machine.Spec.ProviderID = tc.providerID
+			if tc.userData != nil {
+				scope.MachineConfig.UserDataSecret = &corev1.SecretReference{Name: "userdata"}
+				scope.CoreClient = controllerfake.NewClientBuilder().WithObjects(&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "userdata",
+						Namespace: scope.Namespace(),
+					},
+					Data: map[string][]byte{"userData": tc.userData},
+				}).Build()
+			}
+
+			capacityReservationsSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.capacityReservations != nil {
+				capacityReservationsSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(tc.capacityReservations, nil).Times(1)
+			}
+
+			r := &Reconciler{
+				scope:                   scope,
+				networkInterfacesSvc:    mock_azure.NewMockService(mockCtrl),
+				virtualMachinesSvc:      mock_azure.NewMockService(mockCtrl),
+				virtualMachinesExtSvc:   mock_azure.NewMockService(mockCtrl),
+				disksSvc:                mock_azure.NewMockService(mockCtrl),
+				publicIPSvc:             mock_azure.NewMockService(mockCtrl),
+				availabilityZonesSvc:    mock_azure.NewMockService(mockCtrl),
+				availabilitySetsSvc:     mock_azure.NewMockService(mockCtrl),
+				capacityReservationsSvc: capacityReservationsSvc,
+				resourcesSkus:           skusSvc,
+			}
+
+			err := r.Validate(context.TODO())
+			if len(tc.expectedErrors) == 0 {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(utilerrors.NewAggregate(tc.expectedErrors)))
+			}
+		})
+	}
+}
+
+func TestValidateConfidentialCompute(t *testing.T) {
+	confidentialSKU := resourceskus.SKU{
+		Capabilities: &[]compute.ResourceSkuCapabilities{
+			{
+				Name:  ptr.To(resourceskus.ConfidentialComputingType),
+				Value: ptr.To("SNP"),
+			},
+		},
+	}
+
+	testCases := []struct {
+		name          string
+		securityType  machinev1.SecurityTypes
+		expectSKUs    func(skuSvc *mock_azure.MockService)
+		expectedError error
+	}{
+		{
+			name:         "trusted launch VM sizes are not checked",
+			securityType: machinev1.SecurityTypesTrustedLaunch,
+		},
+		{
+			name:         "VM size supporting confidential compute",
+			securityType: machinev1.SecurityTypesConfidentialVM,
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Standard_DC2as_v5", ResourceType: resourceskus.VirtualMachines}).Return(confidentialSKU, nil).Times(1)
+			},
+		},
+		{
+			name:         "VM size not supporting confidential compute",
+			securityType: machinev1.SecurityTypesConfidentialVM,
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(resourceskus.SKU{}, nil).Times(1)
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("VMSize '%s' does not support confidential compute, which is required by SecurityType %s",
+				"Standard_DC2as_v5", machinev1.SecurityTypesConfidentialVM),
+		},
+		{
+			name:         "failure to get the VM size is not a configuration error",
+			securityType: machinev1.SecurityTypesConfidentialVM,
+			expectSKUs: func(skuSvc *mock_azure.MockService) {
+				skuSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, errors.New("boom")).Times(1)
+			},
+			expectedError: fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", "Standard_DC2as_v5", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			skuSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectSKUs != nil {
+				tc.expectSKUs(skuSvc)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.VMSize = "Standard_DC2as_v5"
+			scope.MachineConfig.SecurityProfile = &machinev1.SecurityProfile{
+				Settings: machinev1.SecuritySettings{
+					SecurityType: tc.securityType,
+				},
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skuSvc
+
+			err := r.validateConfidentialCompute(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateVMSize(t *testing.T) {
+	skuNotFoundErr := fmt.Errorf("resource SKU not found: %w", resourceskus.ErrResourceNotFound)
+
+	testCases := []struct {
+		name          string
+		skuErr        error
+		expectedError error
+	}{
+		{
+			name: "VMSize available in the location",
+		},
+		{
+			name:   "VMSize not available in the location",
+			skuErr: skuNotFoundErr,
+			expectedError: machinecontroller.InvalidMachineConfiguration("VMSize '%s' is not available in location '%s': %s",
+				"Standard_D4s_v3", "dummyLocation", skuNotFoundErr),
+		},
+		{
+			name:          "Failure to get the VMSize SKU is not a configuration error",
+			skuErr:        errors.New("boom"),
+			expectedError: fmt.Errorf("failed to obtain instance type information for VMSize '%s' from Azure: %w", "Standard_D4s_v3", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			skuSvc := mock_azure.NewMockService(mockCtrl)
+			skuSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Standard_D4s_v3", ResourceType: resourceskus.VirtualMachines}).Return(resourceskus.SKU{}, tc.skuErr).Times(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.VMSize = "Standard_D4s_v3"
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skuSvc
+
+			err := r.validateVMSize(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateMarketplaceImageTerms(t *testing.T) {
+	planImage := machinev1.Image{
+		Publisher: "publisher",
+		Offer:     "offer",
+		SKU:       "sku",
+		Version:   "latest",
+		Type:      machinev1.AzureImageTypeMarketplaceWithPlan,
+	}
+
+	testCases := []struct {
+		name          string
+		image         machinev1.Image
+		accepted      bool
+		getErr        error
+		expectGet     bool
+		expectedError error
+	}{
+		{
+			name:  "Image without a purchase plan",
+			image: machinev1.Image{Publisher: "publisher", Offer: "offer", SKU: "sku", Type: machinev1.AzureImageTypeMarketplaceNoPlan},
+		},
+		{
+			name:      "Accepted terms",
+			image:     planImage,
+			accepted:  true,
+			expectGet: true,
+		},
+		{
+			name:      "Terms not accepted",
+			image:     planImage,
+			expectGet: true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("the terms of image publisher:offer:sku are not accepted for subscription %s, "+
+				"accept them with `az vm image terms accept --publisher publisher --offer offer --plan sku --subscription %s`",
+				"00000000-0000-0000-0000-000000000000", "00000000-0000-0000-0000-000000000000"),
+		},
+		{
+			name:          "Failure to get the agreement is not a configuration error",
+			image:         planImage,
+			getErr:        errors.New("boom"),
+			expectGet:     true,
+			expectedError: fmt.Errorf("failed to validate the terms of image publisher:offer:sku: %w", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			marketplaceSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectGet {
+				marketplaceSvc.EXPECT().Get(gomock.Any(), &marketplace.Spec{Publisher: "publisher", Offer: "offer", Plan: "sku"}).Return(tc.accepted, tc.getErr).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = "00000000-0000-0000-0000-000000000000"
+			scope.MachineConfig.Image = tc.image
+			r := newFakeReconcilerWithScope(t, scope)
+			r.marketplaceSvc = marketplaceSvc
+
+			err := r.validateMarketplaceImageTerms(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateCapacityReservation(t *testing.T) {
+	const groupID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"
+
+	reservation := func(size string, zones ...string) compute.CapacityReservation {
+		r := compute.CapacityReservation{Sku: &compute.Sku{Name: ptr.To(size)}}
+		if len(zones) > 0 {
+			r.Zones = &zones
+		}
+		return r
+	}
+
+	testCases := []struct {
+		name          string
+		zone          string
+		reservations  []compute.CapacityReservation
+		getErr        error
+		expectedError error
+	}{
+		{
+			name:         "Matching zonal reservation",
+			zone:         "2",
+			reservations: []compute.CapacityReservation{reservation("Standard_D2s_v3", "1"), reservation("standard_d4s_v3", "2")},
+		},
+		{
+			name:         "Matching non-zonal reservation",
+			reservations: []compute.CapacityReservation{reservation("Standard_D4s_v3")},
+		},
+		{
+			name:         "No reservation for the VMSize",
+			zone:         "1",
+			reservations: []compute.CapacityReservation{reservation("Standard_D2s_v3", "1")},
+			expectedError: machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s",
+				groupID, "Standard_D4s_v3"),
+		},
+		{
+			name:         "No reservation for the VMSize in a non-zonal group",
+			reservations: []compute.CapacityReservation{reservation("Standard_D2s_v3"), {}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s",
+				groupID, "Standard_D4s_v3"),
+		},
+		{
+			name: "Empty reservation group",
+			zone: "1",
+			expectedError: machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s",
+				groupID, "Standard_D4s_v3"),
+		},
+		{
+			name:         "No reservation in the zone",
+			zone:         "3",
+			reservations: []compute.CapacityReservation{reservation("Standard_D4s_v3", "1")},
+			expectedError: machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no reservation for VMSize %s in zone %s",
+				groupID, "Standard_D4s_v3", "3"),
+		},
+		{
+			name:         "Zonal reservation only for a non-zonal machine",
+			reservations: []compute.CapacityReservation{reservation("Standard_D4s_v3", "1")},
+			expectedError: machinecontroller.InvalidMachineConfiguration("capacity reservation group %s has no non-zonal reservation for VMSize %s",
+				groupID, "Standard_D4s_v3"),
+		},
+		{
+			name:          "Failure to list reservations is not a configuration error",
+			getErr:        errors.New("boom"),
+			expectedError: fmt.Errorf("failed to get capacity reservations: %w", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			capacityReservationsSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.getErr != nil {
+				capacityReservationsSvc.EXPECT().Get(gomock.Any(), &capacityreservations.Spec{GroupID: groupID}).Return(nil, tc.getErr).Times(1)
+			} else {
+				capacityReservationsSvc.EXPECT().Get(gomock.Any(), &capacityreservations.Spec{GroupID: groupID}).Return(tc.reservations, nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.VMSize = "Standard_D4s_v3"
+			r := newFakeReconcilerWithScope(t, scope)
+			r.capacityReservationsSvc = capacityReservationsSvc
+
+			err := r.validateCapacityReservation(context.TODO(), groupID, tc.zone)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestGetDataDisksFromImage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		imageType     machinev1.AzureImageType
+		imageLuns     []int32
+		getErr        error
+		expectedLuns  []int32
+		expectedError error
+	}{
+		{
+			name: "No data disks from image",
+		},
+		{
+			name:        "Gallery image",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0"},
+			imageType:   virtualmachines.AzureImageTypeGallery,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s is not supported with images of type %s",
+				MachineDataDisksFromImageAnnotationName, virtualmachines.AzureImageTypeGallery),
+		},
+		{
+			name:        "Community gallery image",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0"},
+			imageType:   virtualmachines.AzureImageTypeCommunityGallery,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s is not supported with images of type %s",
+				MachineDataDisksFromImageAnnotationName, virtualmachines.AzureImageTypeCommunityGallery),
+		},
+		{
+			name:         "Data disks from image",
+			annotations:  map[string]string{MachineDataDisksFromImageAnnotationName: "0, 2"},
+			imageLuns:    []int32{0, 1, 2},
+			expectedLuns: []int32{0, 2},
+		},
+		{
+			name:        "Image without the referenced data disk",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0,3"},
+			imageLuns:   []int32{1, 0},
+			expectedError: machinecontroller.InvalidMachineConfiguration("image has no data disk with lun %d referenced by annotation %s, available luns are %v",
+				3, MachineDataDisksFromImageAnnotationName, []int32{0, 1}),
+		},
+		{
+			name:        "Image without data disks",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0"},
+			imageLuns:   []int32{},
+			expectedError: machinecontroller.InvalidMachineConfiguration("image has no data disk with lun %d referenced by annotation %s, available luns are %v",
+				0, MachineDataDisksFromImageAnnotationName, []int32{}),
+		},
+		{
+			name:        "Invalid data disk lun",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0,64"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of LUNs between 0 and 63, got %q",
+				MachineDataDisksFromImageAnnotationName, "0,64"),
+		},
+		{
+			name:        "Image not found",
+			annotations: map[string]string{MachineDataDisksFromImageAnnotationName: "0"},
+			getErr:      autorest.DetailedError{StatusCode: 404},
+			expectedError: machinecontroller.InvalidMachineConfiguration("image of the data disks referenced by annotation %s not found: %v",
+				MachineDataDisksFromImageAnnotationName, autorest.DetailedError{StatusCode: 404}),
+		},
+		{
+			name:          "Failure to get the image is not a configuration error",
+			annotations:   map[string]string{MachineDataDisksFromImageAnnotationName: "0"},
+			getErr:        errors.New("boom"),
+			expectedError: fmt.Errorf("failed to get data disks of the image: %w", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.Image.Type = tc.imageType
+
+			imagesSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.getErr != nil {
+				imagesSvc.EXPECT().Get(gomock.Any(), &images.Spec{Image: scope.MachineConfig.Image}).Return(nil, tc.getErr).Times(1)
+			} else if tc.imageLuns != nil {
+				imagesSvc.EXPECT().Get(gomock.Any(), &images.Spec{Image: scope.MachineConfig.Image}).Return(tc.imageLuns, nil).Times(1)
+			}
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.imagesSvc = imagesSvc
+
+			luns, err := r.getDataDisksFromImage(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(luns).To(Equal(tc.expectedLuns))
+			}
+		})
+	}
+}
+
+func TestGetAttachedDataDisks(t *testing.T) {
+	const (
+		subscriptionID = "00000000-0000-0000-0000-000000000000"
+		diskID         = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/disks-rg/providers/Microsoft.Compute/disks/persistent-disk"
+	)
+
+	dataDisks := []machinev1.DataDisk{
+		{NameSuffix: "empty", DiskSizeGB: 64, Lun: 0, DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete},
+		{NameSuffix: "attached", DiskSizeGB: 64, Lun: 1, DeletionPolicy: machinev1.DiskDeletionPolicyTypeDetach},
+	}
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		zone          string
+		disk          *compute.Disk
+		getErr        error
+		expectedDisks map[int32]string
+		expectedError error
+	}{
+		{
+			name: "No attached data disks",
+		},
+		{
+			name:          "Unattached disk",
+			annotations:   map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			disk:          &compute.Disk{},
+			expectedDisks: map[int32]string{1: diskID},
+		},
+		{
+			name:        "Disk already attached to the machine",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			disk: &compute.Disk{
+				ManagedBy: ptr.To("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/dummyResourceGroup/providers/Microsoft.Compute/virtualMachines/machine-test"),
+			},
+			expectedDisks: map[int32]string{1: diskID},
+		},
+		{
+			name:          "Disk in the zone of the machine",
+			annotations:   map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			zone:          "2",
+			disk:          &compute.Disk{Zones: &[]string{"2"}},
+			expectedDisks: map[int32]string{1: diskID},
+		},
+		{
+			name:        "Disk in another zone than the machine",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			zone:        "2",
+			disk:        &compute.Disk{Zones: &[]string{"1"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is in zone %s, it can not be attached to a machine in zone %q",
+				diskID, MachineAttachedDataDisksAnnotationName, "1", "2"),
+		},
+		{
+			name:        "Zonal disk attached to a machine without a zone",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			disk:        &compute.Disk{Zones: &[]string{"1"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is in zone %s, it can not be attached to a machine in zone %q",
+				diskID, MachineAttachedDataDisksAnnotationName, "1", ""),
+		},
+		{
+			name:          "Zone-redundant disk attached to a machine in a zone",
+			annotations:   map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			zone:          "2",
+			disk:          &compute.Disk{Sku: &compute.DiskSku{Name: compute.DiskStorageAccountTypesPremiumZRS}},
+			expectedDisks: map[int32]string{1: diskID},
+		},
+		{
+			name:        "Locally redundant regional disk attached to a machine in a zone",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			zone:        "2",
+			disk:        &compute.Disk{Sku: &compute.DiskSku{Name: compute.DiskStorageAccountTypesPremiumLRS}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is neither in zone %q nor zone-redundant",
+				diskID, MachineAttachedDataDisksAnnotationName, "2"),
+		},
+		{
+			name:        "Disk attached to another virtual machine",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			disk: &compute.Disk{
+				ManagedBy: ptr.To("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/dummyResourceGroup/providers/Microsoft.Compute/virtualMachines/other"),
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s is already attached to %s",
+				diskID, MachineAttachedDataDisksAnnotationName, "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/dummyResourceGroup/providers/Microsoft.Compute/virtualMachines/other"),
+		},
+		{
+			name:        "Disk not found",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			getErr:      autorest.DetailedError{StatusCode: 404},
+			expectedError: machinecontroller.InvalidMachineConfiguration("disk %s referenced by annotation %s not found: %v",
+				diskID, MachineAttachedDataDisksAnnotationName, autorest.DetailedError{StatusCode: 404}),
+		},
+		{
+			name:          "Failure to get the disk is not a configuration error",
+			annotations:   map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID},
+			getErr:        errors.New("boom"),
+			expectedError: fmt.Errorf("failed to get disk %s: %w", diskID, errors.New("boom")),
+		},
+		{
+			name:        "Data disk deleted with the machine",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "0:" + diskID},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s attaches an existing disk as the data disk with lun %d, whose deletionPolicy must be %q, got %q",
+				MachineAttachedDataDisksAnnotationName, 0, machinev1.DiskDeletionPolicyTypeDetach, machinev1.DiskDeletionPolicyTypeDelete),
+		},
+		{
+			name:        "Unknown data disk lun",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "2:" + diskID},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineAttachedDataDisksAnnotationName, 2),
+		},
+		{
+			name:        "Data disk lun attached twice",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:" + diskID + ", 1:" + diskID},
+			disk:        &compute.Disk{},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s attaches more than one disk as the data disk with lun %d",
+				MachineAttachedDataDisksAnnotationName, 1),
+		},
+		{
+			name:        "Invalid entry",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: diskID},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of lun:resourceID entries, got %q",
+				MachineAttachedDataDisksAnnotationName, diskID),
+		},
+		{
+			name:        "Not the resource ID of a disk",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/disks-rg/providers/Microsoft.Compute/snapshots/snapshot"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %q as the data disk with lun %d, which is not the resource ID of a %s/%s resource",
+				MachineAttachedDataDisksAnnotationName, "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/disks-rg/providers/Microsoft.Compute/snapshots/snapshot", 1, "Microsoft.Compute", "disks"),
+		},
+		{
+			name:        "Disk in another subscription",
+			annotations: map[string]string{MachineAttachedDataDisksAnnotationName: "1:/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/disks-rg/providers/Microsoft.Compute/disks/persistent-disk"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references disk %s, which is not in the subscription %s of the machine",
+				MachineAttachedDataDisksAnnotationName, "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/disks-rg/providers/Microsoft.Compute/disks/persistent-disk", subscriptionID),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.SubscriptionID = subscriptionID
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.DataDisks = dataDisks
+			scope.MachineConfig.Zone = tc.zone
+
+			disksSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.getErr != nil {
+				disksSvc.EXPECT().Get(gomock.Any(), &disks.ExistingDiskSpec{ID: diskID}).Return(nil, tc.getErr).Times(1)
+			} else if tc.disk != nil {
+				disksSvc.EXPECT().Get(gomock.Any(), &disks.ExistingDiskSpec{ID: diskID}).Return(*tc.disk, nil).MinTimes(1)
+			}
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.disksSvc = disksSvc
+
+			attachedDisks, err := r.getAttachedDataDisks(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(attachedDisks).To(Equal(tc.expectedDisks))
+			}
+		})
+	}
+}
+
+func TestGetUltraDiskPerformance(t *testing.T) {
+	dataDisks := []machinev1.DataDisk{
+		{
+			NameSuffix:  "ultra",
+			DiskSizeGB:  100,
+			Lun:         0,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountUltraSSDLRS},
+		},
+		{
+			NameSuffix:  "premium",
+			DiskSizeGB:  100,
+			Lun:         1,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix: "default",
+			DiskSizeGB: 1024,
+			Lun:        2,
+		},
+	}
+
+	testCases := []struct {
+		name                              string
+		annotation                        string
+		defaultDataDiskStorageAccountType string
+		expectedSpecs                     []*disks.PerformanceSpec
+		expectedError                     error
+	}{
+		{
+			name: "No ultra disk performance",
+		},
+		{
+			name:       "Performance within the limits of the disk size",
+			annotation: "0:5000:200",
+			expectedSpecs: []*disks.PerformanceSpec{
+				{Name: "machine-test_ultra", IOPS: 5000, MBps: 200},
+			},
+		},
+		{
+			name:                              "Lowest and highest performance of ultra disks",
+			annotation:                        "0:100:1,2:160000:4000",
+			defaultDataDiskStorageAccountType: string(machinev1.StorageAccountUltraSSDLRS),
+			expectedSpecs: []*disks.PerformanceSpec{
+				{Name: "machine-test_ultra", IOPS: 100, MBps: 1},
+				{Name: "machine-test_default", IOPS: 160000, MBps: 4000},
+			},
+		},
+		{
+			name:       "Too many IOPS for the disk size",
+			annotation: "0:30001:200",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s sets %d IOPS on the data disk with lun %d, a %d GiB ultra disk allows between %d and %d IOPS",
+				MachineUltraDiskPerformanceAnnotationName, 30001, 0, 100, 100, 30000),
+		},
+		{
+			name:                              "Too few IOPS for the disk size",
+			annotation:                        "2:1000:100",
+			defaultDataDiskStorageAccountType: string(machinev1.StorageAccountUltraSSDLRS),
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s sets %d IOPS on the data disk with lun %d, a %d GiB ultra disk allows between %d and %d IOPS",
+				MachineUltraDiskPerformanceAnnotationName, 1000, 2, 1024, 1024, 160000),
+		},
+		{
+			name:       "Too much throughput for the IOPS",
+			annotation: "0:5000:1251",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s sets %d MBps on the data disk with lun %d, an ultra disk with %d IOPS allows between %d and %d MBps",
+				MachineUltraDiskPerformanceAnnotationName, 1251, 0, 5000, 21, 1250),
+		},
+		{
+			name:       "Too little throughput for the IOPS",
+			annotation: "0:5000:20",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s sets %d MBps on the data disk with lun %d, an ultra disk with %d IOPS allows between %d and %d MBps",
+				MachineUltraDiskPerformanceAnnotationName, 20, 0, 5000, 21, 1250),
+		},
+		{
+			name:       "Non ultra disk",
+			annotation: "1:5000:200",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references the data disk with lun %d of storage account type %q, only %q data disks support setting IOPS and throughput",
+				MachineUltraDiskPerformanceAnnotationName, 1, machinev1.StorageAccountPremiumLRS, machinev1.StorageAccountUltraSSDLRS),
+		},
+		{
+			name:       "Data disk defaulting to a non ultra disk",
+			annotation: "2:5000:200",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references the data disk with lun %d of storage account type %q, only %q data disks support setting IOPS and throughput",
+				MachineUltraDiskPerformanceAnnotationName, 2, "", machinev1.StorageAccountUltraSSDLRS),
+		},
+		{
+			name:       "Unknown data disk",
+			annotation: "3:5000:200",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineUltraDiskPerformanceAnnotationName, 3),
+		},
+		{
+			name:       "Same data disk more than once",
+			annotation: "0:5000:200,0:6000:200",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s sets the performance of the data disk with lun %d more than once",
+				MachineUltraDiskPerformanceAnnotationName, 0),
+		},
+		{
+			name:       "Malformed entry",
+			annotation: "0:5000",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of lun:iops:mbps entries, got %q",
+				MachineUltraDiskPerformanceAnnotationName, "0:5000"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			if tc.annotation != "" {
+				scope.Machine.Annotations = map[string]string{MachineUltraDiskPerformanceAnnotationName: tc.annotation}
+			}
+			scope.MachineConfig.DataDisks = dataDisks
+			scope.DefaultDataDiskStorageAccountType = tc.defaultDataDiskStorageAccountType
+			r := newFakeReconcilerWithScope(t, scope)
+
+			specs, err := r.getUltraDiskPerformance()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(specs).To(Equal(tc.expectedSpecs))
+			}
+		})
+	}
+}
+
+func TestReconcileUltraDiskPerformance(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineUltraDiskPerformanceAnnotationName: "0:5000:200"}
+	scope.MachineConfig.DataDisks = []machinev1.DataDisk{{
+		NameSuffix:  "ultra",
+		DiskSizeGB:  100,
+		ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountUltraSSDLRS},
+	}}
+
+	disksSvc := mock_azure.NewMockService(mockCtrl)
+	disksSvc.EXPECT().CreateOrUpdate(gomock.Any(), &disks.PerformanceSpec{Name: "machine-test_ultra", IOPS: 5000, MBps: 200}).Return(nil).Times(1)
+
+	r := newFakeReconcilerWithScope(t, scope)
+	r.disksSvc = disksSvc
+
+	g.Expect(r.reconcileUltraDiskPerformance(context.TODO(), "")).To(Succeed())
+}
+
+func TestGetDiskBursting(t *testing.T) {
+	premiumOSDisk := machinev1.OSDisk{
+		DiskSizeGB:  1024,
+		ManagedDisk: machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+	}
+	dataDisks := []machinev1.DataDisk{
+		{
+			NameSuffix:  "premium",
+			DiskSizeGB:  513,
+			Lun:         0,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix:  "small",
+			DiskSizeGB:  512,
+			Lun:         1,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix:  "standard",
+			DiskSizeGB:  1024,
+			Lun:         2,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountStandardLRS},
+		},
+		{
+			NameSuffix: "default",
+			DiskSizeGB: 1024,
+			Lun:        3,
+		},
+	}
+
+	testCases := []struct {
+		name                              string
+		annotation                        string
+		osDisk                            machinev1.OSDisk
+		defaultDataDiskStorageAccountType string
+		expectedSpecs                     []*disks.BurstingSpec
+		expectedError                     error
+	}{
+		{
+			name: "No disk bursting",
+		},
+		{
+			name:       "Premium OS and data disks of at least P30 size",
+			annotation: "os, 0",
+			osDisk:     premiumOSDisk,
+			expectedSpecs: []*disks.BurstingSpec{
+				{Name: "machine-test_OSDisk", Enabled: true},
+				{Name: "machine-test_premium", Enabled: true},
+			},
+		},
+		{
+			name:                              "Data disk defaulting to a premium disk",
+			annotation:                        "3",
+			defaultDataDiskStorageAccountType: string(compute.StorageAccountTypesPremiumZRS),
+			expectedSpecs: []*disks.BurstingSpec{
+				{Name: "machine-test_default", Enabled: true},
+			},
+		},
+		{
+			name:       "Data disk smaller than P30",
+			annotation: "1",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s of %d GiB, only disks of at least %d GiB support bursting",
+				MachineDiskBurstingAnnotationName, "the data disk with lun 1", 512, azure.MinDiskBurstingSizeGB),
+		},
+		{
+			name:       "Standard data disk",
+			annotation: "2",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s of storage account type %q, only %q and %q disks support bursting",
+				MachineDiskBurstingAnnotationName, "the data disk with lun 2", machinev1.StorageAccountStandardLRS, compute.StorageAccountTypesPremiumLRS, compute.StorageAccountTypesPremiumZRS),
+		},
+		{
+			name:       "Standard OS disk",
+			annotation: "os",
+			osDisk: machinev1.OSDisk{
+				DiskSizeGB:  1024,
+				ManagedDisk: machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountStandardLRS)},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s of storage account type %q, only %q and %q disks support bursting",
+				MachineDiskBurstingAnnotationName, "the OS disk", machinev1.StorageAccountStandardLRS, compute.StorageAccountTypesPremiumLRS, compute.StorageAccountTypesPremiumZRS),
+		},
+		{
+			name:       "Ephemeral OS disk",
+			annotation: "os",
+			osDisk: machinev1.OSDisk{
+				DiskSizeGB:   1024,
+				ManagedDisk:  machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+				DiskSettings: machinev1.DiskSettings{EphemeralStorageLocation: "Local"},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references the OS disk, which is an ephemeral disk that does not support bursting",
+				MachineDiskBurstingAnnotationName),
+		},
+		{
+			name:       "Unknown data disk",
+			annotation: "4",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineDiskBurstingAnnotationName, 4),
+		},
+		{
+			name:       "Same disk more than once",
+			annotation: "0,0",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references disk %s more than once",
+				MachineDiskBurstingAnnotationName, "0"),
+		},
+		{
+			name:       "Invalid disk",
+			annotation: "data",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be a comma separated list of data disk LUNs and %s for the OS disk, got %q",
+				MachineDiskBurstingAnnotationName, annotatedOSDisk, "data"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			if tc.annotation != "" {
+				scope.Machine.Annotations = map[string]string{MachineDiskBurstingAnnotationName: tc.annotation}
+			}
+			scope.MachineConfig.OSDisk = tc.osDisk
+			scope.MachineConfig.DataDisks = dataDisks
+			scope.DefaultDataDiskStorageAccountType = tc.defaultDataDiskStorageAccountType
+			r := newFakeReconcilerWithScope(t, scope)
+
+			specs, err := r.getDiskBursting()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(specs).To(Equal(tc.expectedSpecs))
+			}
+		})
+	}
+}
+
+func TestReconcileDiskBursting(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{MachineDiskBurstingAnnotationName: "os"}
+	scope.MachineConfig.OSDisk = machinev1.OSDisk{
+		DiskSizeGB:  1024,
+		ManagedDisk: machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+	}
+
+	disksSvc := mock_azure.NewMockService(mockCtrl)
+	disksSvc.EXPECT().CreateOrUpdate(gomock.Any(), &disks.BurstingSpec{Name: "machine-test_OSDisk", Enabled: true}).Return(nil).Times(1)
+
+	r := newFakeReconcilerWithScope(t, scope)
+	r.disksSvc = disksSvc
+
+	g.Expect(r.reconcileDiskBursting(context.TODO(), "")).To(Succeed())
+}
+
+func TestMergeTags(t *testing.T) {
+	testCases := []struct {
+		name            string
+		current         map[string]*string
+		desired         map[string]*string
+		expectedTags    map[string]*string
+		expectedChanged bool
+	}{
+		{
+			name:         "No tags",
+			expectedTags: map[string]*string{},
+		},
+		{
+			name:         "Tags up to date",
+			current:      map[string]*string{"env": ptr.To("prod"), "owner": ptr.To("team")},
+			desired:      map[string]*string{"env": ptr.To("prod")},
+			expectedTags: map[string]*string{"env": ptr.To("prod"), "owner": ptr.To("team")},
+		},
+		{
+			name:         "Tag keys differing only by case are up to date",
+			current:      map[string]*string{"Env": ptr.To("prod")},
+			desired:      map[string]*string{"env": ptr.To("prod")},
+			expectedTags: map[string]*string{"Env": ptr.To("prod")},
+		},
+		{
+			name:            "Missing tag is added and other tags are kept",
+			current:         map[string]*string{"owner": ptr.To("team")},
+			desired:         map[string]*string{"env": ptr.To("prod")},
+			expectedTags:    map[string]*string{"env": ptr.To("prod"), "owner": ptr.To("team")},
+			expectedChanged: true,
+		},
+		{
+			name:            "Tag with a different value is updated with the desired key",
+			current:         map[string]*string{"Env": ptr.To("dev")},
+			desired:         map[string]*string{"env": ptr.To("prod")},
+			expectedTags:    map[string]*string{"env": ptr.To("prod")},
+			expectedChanged: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tags, changed := mergeTags(tc.current, tc.desired)
+			g.Expect(changed).To(Equal(tc.expectedChanged))
+			g.Expect(tags).To(Equal(tc.expectedTags))
+		})
+	}
+}
+
+func TestUpdatePatchesOnlyTags(t *testing.T) {
+	testCases := []struct {
+		name          string
+		vmTags        map[string]*string
+		expectedPatch *virtualmachines.TagsSpec
+	}{
+		{
+			name:   "VM tags up to date",
+			vmTags: map[string]*string{"env": ptr.To("prod")},
+		},
+		{
+			name:   "VM tag with a different value",
+			vmTags: map[string]*string{"env": ptr.To("dev"), "owner": ptr.To("team")},
+			expectedPatch: &virtualmachines.TagsSpec{
+				Name: "machine-test",
+				Tags: map[string]*string{"env": ptr.To("prod"), "owner": ptr.To("team")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+				ID:   ptr.To("machine-test-ID"),
+				Tags: tc.vmTags,
+				VirtualMachineProperties: &compute.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Succeeded"),
+				},
+			}, nil).Times(1)
+			// Only the tags are patched, the VM is never sent as a whole.
+			if tc.expectedPatch != nil {
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), tc.expectedPatch).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Tags = map[string]*string{"env": ptr.To("prod")}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+		})
+	}
+}
+
+func TestGetWriteAcceleratedDisks(t *testing.T) {
+	mSeriesSKU := resourceskus.SKU{
+		Capabilities: &[]compute.ResourceSkuCapabilities{
+			{Name: ptr.To(resourceskus.MaxWriteAcceleratorDisksAllowed), Value: ptr.To("2")},
+		},
+	}
+	premiumOSDisk := machinev1.OSDisk{
+		DiskSizeGB:  128,
+		CachingType: string(compute.CachingTypesReadOnly),
+		ManagedDisk: machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+	}
+	dataDisks := []machinev1.DataDisk{
+		{
+			NameSuffix:  "log",
+			DiskSizeGB:  256,
+			Lun:         0,
+			CachingType: machinev1.CachingTypeNone,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix:  "data",
+			DiskSizeGB:  256,
+			Lun:         1,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix:  "cached",
+			DiskSizeGB:  256,
+			Lun:         2,
+			CachingType: machinev1.CachingTypeReadWrite,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountPremiumLRS},
+		},
+		{
+			NameSuffix:  "standard",
+			DiskSizeGB:  256,
+			Lun:         3,
+			ManagedDisk: machinev1.DataDiskManagedDiskParameters{StorageAccountType: machinev1.StorageAccountStandardLRS},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		annotation      string
+		osDisk          machinev1.OSDisk
+		sku             resourceskus.SKU
+		expectedOSDisk  bool
+		expectedLuns    []int32
+		expectedError   error
+		expectedSKUCall bool
+	}{
+		{
+			name: "No write accelerator",
+		},
+		{
+			name:            "Premium OS and data disks on an M-series VMSize",
+			annotation:      "os,0",
+			osDisk:          premiumOSDisk,
+			sku:             mSeriesSKU,
+			expectedOSDisk:  true,
+			expectedLuns:    []int32{0},
+			expectedSKUCall: true,
+		},
+		{
+			name:            "Data disk without caching type",
+			annotation:      "1",
+			sku:             mSeriesSKU,
+			expectedLuns:    []int32{1},
+			expectedSKUCall: true,
+		},
+		{
+			name:            "VMSize without write accelerator",
+			annotation:      "0",
+			sku:             resourceskus.SKU{},
+			expectedSKUCall: true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("VMSize '%s' does not support write accelerator, which is requested by annotation %s",
+				"Standard_M8ms", MachineWriteAcceleratorAnnotationName),
+		},
+		{
+			name:            "More disks than the VMSize allows",
+			annotation:      "os,0,1",
+			osDisk:          premiumOSDisk,
+			sku:             mSeriesSKU,
+			expectedSKUCall: true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requests write accelerator on %d disks, VMSize '%s' allows it on %s disks",
+				MachineWriteAcceleratorAnnotationName, 3, "Standard_M8ms", "2"),
+		},
+		{
+			name:       "Data disk with read-write caching",
+			annotation: "2",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s with %q caching, write accelerator requires %q or %q caching",
+				MachineWriteAcceleratorAnnotationName, "the data disk with lun 2", compute.CachingTypesReadWrite, compute.CachingTypesNone, compute.CachingTypesReadOnly),
+		},
+		{
+			name:       "OS disk defaulting to read-write caching",
+			annotation: "os",
+			osDisk: machinev1.OSDisk{
+				DiskSizeGB:  128,
+				ManagedDisk: machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s with %q caching, write accelerator requires %q or %q caching",
+				MachineWriteAcceleratorAnnotationName, "the OS disk", compute.CachingTypesReadWrite, compute.CachingTypesNone, compute.CachingTypesReadOnly),
+		},
+		{
+			name:       "Standard data disk",
+			annotation: "3",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references %s of storage account type %q, only %q disks support write accelerator",
+				MachineWriteAcceleratorAnnotationName, "the data disk with lun 3", machinev1.StorageAccountStandardLRS, compute.StorageAccountTypesPremiumLRS),
+		},
+		{
+			name:       "Ephemeral OS disk",
+			annotation: "os",
+			osDisk: machinev1.OSDisk{
+				DiskSizeGB:   128,
+				CachingType:  string(compute.CachingTypesReadOnly),
+				ManagedDisk:  machinev1.OSDiskManagedDiskParameters{StorageAccountType: string(machinev1.StorageAccountPremiumLRS)},
+				DiskSettings: machinev1.DiskSettings{EphemeralStorageLocation: "Local"},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references the OS disk, which is an ephemeral disk that does not support write accelerator",
+				MachineWriteAcceleratorAnnotationName),
+		},
+		{
+			name:       "Unknown data disk",
+			annotation: "4",
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s references lun %d, which is not a data disk of the machine",
+				MachineWriteAcceleratorAnnotationName, 4),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			skusSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectedSKUCall {
+				skusSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Standard_M8ms", ResourceType: resourceskus.VirtualMachines}).Return(tc.sku, nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			if tc.annotation != "" {
+				scope.Machine.Annotations = map[string]string{MachineWriteAcceleratorAnnotationName: tc.annotation}
+			}
+			scope.MachineConfig.VMSize = "Standard_M8ms"
+			scope.MachineConfig.OSDisk = tc.osDisk
+			scope.MachineConfig.DataDisks = dataDisks
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skusSvc
+
+			osDisk, luns, err := r.getWriteAcceleratedDisks(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(osDisk).To(Equal(tc.expectedOSDisk))
+			g.Expect(luns).To(Equal(tc.expectedLuns))
+		})
+	}
+}
+
+func TestUpdateReconcilesStaleVMID(t *testing.T) {
+	testCases := []struct {
+		name       string
+		persisted  *string
+		expectedID string
+	}{
+		{
+			name:       "VM ID not persisted yet",
+			expectedID: "machine-test-ID",
+		},
+		{
+			name:       "Persisted VM ID differing from the live VM",
+			persisted:  ptr.To("machine-test-old-ID"),
+			expectedID: "machine-test-ID",
+		},
+		{
+			name:       "Persisted VM ID differing only by case is kept",
+			persisted:  ptr.To("MACHINE-TEST-ID"),
+			expectedID: "MACHINE-TEST-ID",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineStatus.VMID = tc.persisted
+			r := newFakeReconcilerWithScope(t, scope)
+
+			g.Expect(r.Update(context.TODO())).To(Succeed())
+			g.Expect(scope.MachineStatus.VMID).To(Equal(ptr.To(tc.expectedID)))
+		})
+	}
+}
+
+func TestUpdateRecordsProvisioningDurationOnce(t *testing.T) {
+	g := NewWithT(t)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.MachineConfig.VMSize = "Standard_D4s_v3"
+	scope.Machine.Annotations = map[string]string{
+		MachineProvisioningStartedAnnotationName: time.Now().Add(-5 * time.Minute).UTC().Format(time.RFC3339),
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+
+	observations := func() uint64 {
+		metric := &dto.Metric{}
+		histogram := azuremetrics.ProvisioningDuration.WithLabelValues(actuators.Node, "Standard_D4s_v3").(prometheus.Histogram)
+		g.Expect(histogram.Write(metric)).To(Succeed())
+		return metric.GetHistogram().GetSampleCount()
+	}
+	before := observations()
+
+	g.Expect(r.Update(context.TODO())).To(Succeed())
+	g.Expect(observations()).To(Equal(before + 1))
+	g.Expect(scope.Machine.Annotations).ToNot(HaveKey(MachineProvisioningStartedAnnotationName))
+
+	g.Expect(r.Update(context.TODO())).To(Succeed())
+	g.Expect(observations()).To(Equal(before + 1))
+}
+
+func TestReconcileVMIDBeforeFailingUpdate(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	// A VM left in the Canceled provisioning state after all the retries stops the update early.
+	vmSvc := mock_azure.NewMockService(mockCtrl)
+	vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+		ID: ptr.To("machine-test-new-ID"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: ptr.To("Canceled"),
+		},
+	}, nil)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.MachineStatus.VMID = ptr.To("machine-test-old-ID")
+	r := newFakeReconcilerWithScope(t, scope)
+	r.virtualMachinesSvc = vmSvc
+
+	g.Expect(r.Update(context.TODO())).ToNot(Succeed())
+	g.Expect(scope.MachineStatus.VMID).To(Equal(ptr.To("machine-test-new-ID")))
+}
+
+func TestReconcileSpotMaxPriceUncappedCondition(t *testing.T) {
+	maxPrice := resource.MustParse("0.5")
+	uncappedCondition := metav1.Condition{
+		Type:    spotMaxPriceUncappedConditionType,
+		Status:  metav1.ConditionTrue,
+		Reason:  spotMaxPriceUnsetReason,
+		Message: spotMaxPriceUncappedMessage,
+	}
+
+	testCases := []struct {
+		name              string
+		spotVMOptions     *machinev1.SpotVMOptions
+		suppressed        bool
+		conditions        []metav1.Condition
+		expectedCondition bool
+	}{
+		{
+			name:              "Sets the condition on spot machines without a max price",
+			spotVMOptions:     &machinev1.SpotVMOptions{},
+			expectedCondition: true,
+		},
+		{
+			name:          "Does not set the condition on spot machines with a max price",
+			spotVMOptions: &machinev1.SpotVMOptions{MaxPrice: &maxPrice},
+		},
+		{
+			name: "Does not set the condition on machines which are not spot",
+		},
+		{
+			name:          "Does not set the condition when suppressed",
+			spotVMOptions: &machinev1.SpotVMOptions{},
+			suppressed:    true,
+		},
+		{
+			name:          "Removes the condition once a max price is set",
+			spotVMOptions: &machinev1.SpotVMOptions{MaxPrice: &maxPrice},
+			conditions:    []metav1.Condition{uncappedCondition},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.SpotVMOptions = tc.spotVMOptions
+			scope.SpotMaxPriceUncappedConditionSuppressed = tc.suppressed
+			scope.MachineStatus.Conditions = tc.conditions
+
+			r := newFakeReconcilerWithScope(t, scope)
+			r.reconcileSpotMaxPriceUncappedCondition()
+
+			condition := findCondition(scope.MachineStatus.Conditions, spotMaxPriceUncappedConditionType)
+			if tc.expectedCondition {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(condition.Reason).To(Equal(spotMaxPriceUnsetReason))
+			} else {
+				g.Expect(condition).To(BeNil())
+			}
+		})
+	}
+}
+
+func TestGetSpotEvictionPolicy(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		annotations            map[string]string
+		spotVMOptions          *machinev1.SpotVMOptions
+		expectedEvictionPolicy compute.VirtualMachineEvictionPolicyTypes
+		expectedError          error
+	}{
+		{
+			name:          "Returns no eviction policy without the annotation",
+			spotVMOptions: &machinev1.SpotVMOptions{},
+		},
+		{
+			name:                   "Returns the Delete eviction policy",
+			annotations:            map[string]string{MachineSpotEvictionPolicyAnnotationName: "Delete"},
+			spotVMOptions:          &machinev1.SpotVMOptions{},
+			expectedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDelete,
+		},
+		{
+			name:                   "Returns the Deallocate eviction policy regardless of case",
+			annotations:            map[string]string{MachineSpotEvictionPolicyAnnotationName: "deallocate"},
+			spotVMOptions:          &machinev1.SpotVMOptions{},
+			expectedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDeallocate,
+		},
+		{
+			name:          "Fails on an unknown eviction policy",
+			annotations:   map[string]string{MachineSpotEvictionPolicyAnnotationName: "Hibernate"},
+			spotVMOptions: &machinev1.SpotVMOptions{},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of [Deallocate Delete], got \"Hibernate\"", MachineSpotEvictionPolicyAnnotationName),
+		},
+		{
+			name:          "Fails on machines which are not spot",
+			annotations:   map[string]string{MachineSpotEvictionPolicyAnnotationName: "Delete"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s is only supported on spot machines", MachineSpotEvictionPolicyAnnotationName),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.SpotVMOptions = tc.spotVMOptions
+			r := newFakeReconcilerWithScope(t, scope)
+
+			evictionPolicy, err := r.getSpotEvictionPolicy()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(evictionPolicy).To(Equal(tc.expectedEvictionPolicy))
+		})
+	}
+}
+
+func TestReconcileProximityPlacementGroupDriftCondition(t *testing.T) {
+	const (
+		ppgID      = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"
+		otherPPGID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/other-ppg"
+		asID       = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/as-rg/providers/Microsoft.Compute/availabilitySets/as"
+	)
+
+	driftCondition := metav1.Condition{
+		Type:   proximityPlacementGroupDriftConditionType,
+		Status: metav1.ConditionTrue,
+		Reason: immutablePlacementReason,
+	}
+
+	testCases := []struct {
+		name              string
+		requestedID       string
+		placedID          *string
+		availabilitySet   *compute.AvailabilitySet
+		conditions        []metav1.Condition
+		expectedCondition bool
+	}{
+		{
+			name: "No condition without a proximity placement group",
+		},
+		{
+			name:        "No condition when the vm is placed in the requested proximity placement group",
+			requestedID: ppgID,
+			placedID:    ptr.To(strings.ToUpper(ppgID)),
+		},
+		{
+			name:              "Sets the condition when the vm is placed in another proximity placement group",
+			requestedID:       otherPPGID,
+			placedID:          ptr.To(ppgID),
+			expectedCondition: true,
+		},
+		{
+			name:              "Sets the condition when the vm is not placed in the requested proximity placement group",
+			requestedID:       ppgID,
+			expectedCondition: true,
+		},
+		{
+			name:              "Sets the condition when the proximity placement group is no longer requested",
+			placedID:          ptr.To(ppgID),
+			expectedCondition: true,
+		},
+		{
+			name:     "No condition when the vm is placed in the proximity placement group of its availability set",
+			placedID: ptr.To(ppgID),
+			availabilitySet: &compute.AvailabilitySet{
+				AvailabilitySetProperties: &compute.AvailabilitySetProperties{
+					ProximityPlacementGroup: &compute.SubResource{ID: ptr.To(ppgID)},
+				},
+			},
+		},
+		{
+			name:     "Sets the condition when the vm is placed in another proximity placement group than its availability set",
+			placedID: ptr.To(otherPPGID),
+			availabilitySet: &compute.AvailabilitySet{
+				AvailabilitySetProperties: &compute.AvailabilitySetProperties{
+					ProximityPlacementGroup: &compute.SubResource{ID: ptr.To(ppgID)},
+				},
+			},
+			expectedCondition: true,
+		},
+		{
+			name:     "Sets the condition when the availability set of the vm is in no proximity placement group",
+			placedID: ptr.To(ppgID),
+			availabilitySet: &compute.AvailabilitySet{
+				AvailabilitySetProperties: &compute.AvailabilitySetProperties{},
+			},
+			expectedCondition: true,
+		},
+		{
+			name:        "Removes the condition once the placement matches",
+			requestedID: ppgID,
+			placedID:    ptr.To(ppgID),
+			conditions:  []metav1.Condition{driftCondition},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			if tc.requestedID != "" {
+				scope.Machine.Annotations = map[string]string{MachineProximityPlacementGroupAnnotationName: tc.requestedID}
+			}
+			scope.MachineStatus.Conditions = tc.conditions
+			r := newFakeReconcilerWithScope(t, scope)
+
+			vm := &decode.VirtualMachine{VirtualMachineProperties: &decode.VirtualMachineProperties{}}
+			if tc.placedID != nil {
+				vm.ProximityPlacementGroup = &decode.SubResource{ID: tc.placedID}
+			}
+			if tc.availabilitySet != nil {
+				vm.AvailabilitySet = &decode.SubResource{ID: ptr.To(asID)}
+				availabilitySetsSvc := mock_azure.NewMockService(gomock.NewController(t))
+				availabilitySetsSvc.EXPECT().Get(gomock.Any(), &availabilitysets.Spec{Name: "as", ResourceGroup: "as-rg"}).Return(*tc.availabilitySet, nil).Times(1)
+				r.availabilitySetsSvc = availabilitySetsSvc
+			}
+			r.reconcileProximityPlacementGroupDriftCondition(context.TODO(), vm)
+
+			condition := findCondition(scope.MachineStatus.Conditions, proximityPlacementGroupDriftConditionType)
+			if tc.expectedCondition {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+				g.Expect(condition.Reason).To(Equal(immutablePlacementReason))
+			} else {
+				g.Expect(condition).To(BeNil())
+			}
+		})
+	}
+}
+
+func TestReconcilePowerState(t *testing.T) {
+	vmInState := func(powerState string) *decode.VirtualMachine {
+		return &decode.VirtualMachine{
+			VirtualMachineProperties: &decode.VirtualMachineProperties{
+				ProvisioningState: ptr.To("Succeeded"),
+				InstanceView: &decode.VirtualMachineInstanceView{
+					Statuses: &[]decode.InstanceViewStatus{{Code: ptr.To("PowerState/" + powerState)}},
+				},
+			},
+		}
+	}
+
+	powerStateCondition := metav1.Condition{
+		Type:   powerStateConditionType,
+		Status: metav1.ConditionTrue,
+		Reason: deallocatedReason,
+	}
+
+	testCases := []struct {
+		name           string
+		annotation     string
+		conditions     []metav1.Condition
+		vm             *decode.VirtualMachine
+		expectedSpec   *virtualmachines.PowerStateSpec
+		expectedReason string
+		expectedError  error
+	}{
+		{
+			name: "Leaves a running vm as it is without annotation",
+			vm:   vmInState("running"),
+		},
+		{
+			name: "Does not start a vm deallocated by other means",
+			vm:   vmInState("deallocated"),
+		},
+		{
+			name:           "Deallocates a running vm",
+			annotation:     "Deallocated",
+			vm:             vmInState("running"),
+			expectedSpec:   &virtualmachines.PowerStateSpec{Name: "machine-test", Deallocated: true},
+			expectedReason: deallocatingReason,
+		},
+		{
+			name:           "Deallocates a stopped vm",
+			annotation:     "deallocated",
+			vm:             vmInState("stopped"),
+			expectedSpec:   &virtualmachines.PowerStateSpec{Name: "machine-test", Deallocated: true},
+			expectedReason: deallocatingReason,
+		},
+		{
+			name:           "Waits for a deallocating vm",
+			annotation:     "Deallocated",
+			vm:             vmInState("deallocating"),
+			expectedReason: deallocatingReason,
+		},
+		{
+			name:       "Waits for a vm updating while it is deallocated",
+			annotation: "Deallocated",
+			vm: &decode.VirtualMachine{
+				VirtualMachineProperties: &decode.VirtualMachineProperties{
+					ProvisioningState: ptr.To("Updating"),
+					InstanceView: &decode.VirtualMachineInstanceView{
+						Statuses: &[]decode.InstanceViewStatus{
+							{Code: ptr.To("ProvisioningState/updating")},
+							{Code: ptr.To("PowerState/deallocating")},
+						},
+					},
+				},
+			},
+			expectedReason: deallocatingReason,
+		},
+		{
+			name:           "Reports a deallocated vm",
+			annotation:     "Deallocated",
+			vm:             vmInState("deallocated"),
+			expectedReason: deallocatedReason,
+		},
+		{
+			name:           "Starts a vm deallocated on request once the annotation is removed",
+			conditions:     []metav1.Condition{powerStateCondition},
+			vm:             vmInState("deallocated"),
+			expectedSpec:   &virtualmachines.PowerStateSpec{Name: "machine-test"},
+			expectedReason: startingReason,
+		},
+		{
+			name:           "Waits for a starting vm",
+			conditions:     []metav1.Condition{powerStateCondition},
+			vm:             vmInState("starting"),
+			expectedReason: startingReason,
+		},
+		{
+			name:       "Removes the condition once the vm is running",
+			conditions: []metav1.Condition{powerStateCondition},
+			vm:         vmInState("running"),
+		},
+		{
+			name:       "Fails with an unsupported power state",
+			annotation: "Running",
+			vm:         vmInState("running"),
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be Deallocated, got %q",
+				MachinePowerStateAnnotationName, "Running"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			vmSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.expectedSpec != nil {
+				vmSvc.EXPECT().CreateOrUpdate(gomock.Any(), tc.expectedSpec).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			if tc.annotation != "" {
+				scope.Machine.Annotations = map[string]string{MachinePowerStateAnnotationName: tc.annotation}
+			}
+			scope.MachineStatus.Conditions = tc.conditions
+			r := newFakeReconcilerWithScope(t, scope)
+			r.virtualMachinesSvc = vmSvc
+
+			err := r.reconcilePowerState(context.TODO(), tc.vm, "")
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			condition := findCondition(scope.MachineStatus.Conditions, powerStateConditionType)
+			if tc.expectedReason == "" {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).ToNot(BeNil())
+			g.Expect(condition.Reason).To(Equal(tc.expectedReason))
+		})
+	}
+}
+
+func TestUpdateProximityPlacementGroupDriftOnlySetsCondition(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	// Only Get is expected, so updating or deleting the vm fails the test.
+	vmSvc := mock_azure.NewMockService(mockCtrl)
+	vmSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(compute.VirtualMachine{
+		ID: ptr.To("machine-test-ID"),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			ProvisioningState: ptr.To("Succeeded"),
+			ProximityPlacementGroup: &compute.SubResource{
+				ID: ptr.To("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"),
+			},
+		},
+	}, nil).Times(1)
+
+	scope := newFakeScope(t, actuators.Node)
+	scope.Machine.Annotations = map[string]string{
+		MachineProximityPlacementGroupAnnotationName: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/other-ppg",
+	}
+	r := newFakeReconcilerWithScope(t, scope)
+	r.virtualMachinesSvc = vmSvc
+
+	g.Expect(r.Update(context.TODO())).To(Succeed())
+	g.Expect(findCondition(scope.MachineStatus.Conditions, proximityPlacementGroupDriftConditionType)).ToNot(BeNil())
+}
+
+func TestGetProximityPlacementGroupID(t *testing.T) {
+	const ppgID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/proximityPlacementGroups/ppg"
+
+	testCases := []struct {
+		name          string
+		annotations   map[string]string
+		expectedID    string
+		expectedError error
+	}{
+		{
+			name: "Returns no ID without the annotation",
+		},
+		{
+			name:        "Returns the ID of the proximity placement group",
+			annotations: map[string]string{MachineProximityPlacementGroupAnnotationName: ppgID},
+			expectedID:  ppgID,
+		},
+		{
+			name:          "Fails on the ID of another resource type",
+			annotations:   map[string]string{MachineProximityPlacementGroupAnnotationName: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be the resource ID of a proximity placement group, got %q", MachineProximityPlacementGroupAnnotationName, "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Compute/availabilitySets/as"),
+		},
+		{
+			name:          "Fails on a name",
+			annotations:   map[string]string{MachineProximityPlacementGroupAnnotationName: "ppg"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be the resource ID of a proximity placement group, got %q", MachineProximityPlacementGroupAnnotationName, "ppg"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			r := newFakeReconcilerWithScope(t, scope)
+
+			id, err := r.getProximityPlacementGroupID()
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(id).To(Equal(tc.expectedID))
+		})
+	}
+}
+
+func TestRecordSpotMaxPriceZero(t *testing.T) {
+	testCases := []struct {
+		name          string
+		spotVMOptions *machinev1.SpotVMOptions
+		expectEvent   bool
+	}{
+		{
+			name:          "Emits an event for a max price of 0",
+			spotVMOptions: &machinev1.SpotVMOptions{MaxPrice: ptr.To(resource.MustParse("0"))},
+			expectEvent:   true,
+		},
+		{
+			name:          "Does not emit an event for a max price of -1",
+			spotVMOptions: &machinev1.SpotVMOptions{MaxPrice: ptr.To(resource.MustParse("-1"))},
+		},
+		{
+			name:          "Does not emit an event for a small positive max price",
+			spotVMOptions: &machinev1.SpotVMOptions{MaxPrice: ptr.To(resource.MustParse("0.00001"))},
+		},
+		{
+			name:          "Does not emit an event without a max price",
+			spotVMOptions: &machinev1.SpotVMOptions{},
+		},
+		{
+			name: "Does not emit an event for machines which are not spot",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			recorder := record.NewFakeRecorder(1)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.MachineConfig.SpotVMOptions = tc.spotVMOptions
+			scope.EventRecorder = recorder
+			r := newFakeReconcilerWithScope(t, scope)
+
+			r.recordSpotMaxPriceZero()
+
+			if tc.expectEvent {
+				g.Expect(recorder.Events).To(Receive(HavePrefix("Warning SpotMaxPriceZero")))
+			} else {
+				g.Expect(recorder.Events).ToNot(Receive())
+			}
+		})
+	}
+}
+
+func TestGetEphemeralOSDiskPlacement(t *testing.T) {
+	// 64 GiB of cache disk and 32 GiB of resource disk.
+	sku := resourceskus.SKU{
+		Capabilities: &[]compute.ResourceSkuCapabilities{
+			{Name: ptr.To(resourceskus.CachedDiskBytes), Value: ptr.To("68719476736")},
+			{Name: ptr.To(resourceskus.MaxResourceVolumeMB), Value: ptr.To("32768")},
+		},
+	}
+
+	testCases := []struct {
+		name              string
+		annotations       map[string]string
+		ephemeral         bool
+		diskSizeGB        int32
+		skuErr            error
+		expectedPlacement compute.DiffDiskPlacement
+		expectedError     error
+	}{
+		{
+			name:      "Returns no placement without the annotation",
+			ephemeral: true,
+		},
+		{
+			name:              "Returns the CacheDisk placement when the OS disk fits in the cache disk",
+			annotations:       map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "CacheDisk"},
+			ephemeral:         true,
+			diskSizeGB:        64,
+			expectedPlacement: compute.DiffDiskPlacementCacheDisk,
+		},
+		{
+			name:              "Returns the ResourceDisk placement when the OS disk fits in the resource disk",
+			annotations:       map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "resourcedisk"},
+			ephemeral:         true,
+			diskSizeGB:        32,
+			expectedPlacement: compute.DiffDiskPlacementResourceDisk,
+		},
+		{
+			name:              "Returns the placement without a size check when the OS disk size is not set",
+			annotations:       map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "ResourceDisk"},
+			ephemeral:         true,
+			expectedPlacement: compute.DiffDiskPlacementResourceDisk,
+		},
+		{
+			name:          "Fails when the OS disk does not fit in the cache disk",
+			annotations:   map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "CacheDisk"},
+			ephemeral:     true,
+			diskSizeGB:    128,
+			expectedError: machinecontroller.InvalidMachineConfiguration("OS disk of 128 GB does not fit in the CacheDisk of VMSize 'Standard_D2s_v3', its CachedDiskBytes is \"68719476736\""),
+		},
+		{
+			name:          "Fails when the OS disk does not fit in the resource disk",
+			annotations:   map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "ResourceDisk"},
+			ephemeral:     true,
+			diskSizeGB:    64,
+			expectedError: machinecontroller.InvalidMachineConfiguration("OS disk of 64 GB does not fit in the ResourceDisk of VMSize 'Standard_D2s_v3', its MaxResourceVolumeMB is \"32768\""),
+		},
+		{
+			name:          "Fails on an unknown placement",
+			annotations:   map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "NvmeDisk"},
+			ephemeral:     true,
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s must be one of [CacheDisk ResourceDisk], got \"NvmeDisk\"", MachineEphemeralOSDiskPlacementAnnotationName),
+		},
+		{
+			name:          "Fails without an ephemeral OS disk",
+			annotations:   map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "CacheDisk"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("annotation %s requires an ephemeral OS disk", MachineEphemeralOSDiskPlacementAnnotationName),
+		},
+		{
+			name:          "Fails when the VMSize lookup fails",
+			annotations:   map[string]string{MachineEphemeralOSDiskPlacementAnnotationName: "CacheDisk"},
+			ephemeral:     true,
+			diskSizeGB:    64,
+			skuErr:        errors.New("test error"),
+			expectedError: errors.New("failed to obtain instance type information for VMSize 'Standard_D2s_v3' from Azure: test error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			skusSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.diskSizeGB > 0 {
+				skusSvc.EXPECT().Get(gomock.Any(), resourceskus.Spec{Name: "Standard_D2s_v3", ResourceType: resourceskus.VirtualMachines}).Return(sku, tc.skuErr).AnyTimes()
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.VMSize = "Standard_D2s_v3"
+			scope.MachineConfig.OSDisk.DiskSizeGB = tc.diskSizeGB
+			if tc.ephemeral {
+				scope.MachineConfig.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+			}
+			r := newFakeReconcilerWithScope(t, scope)
+			r.resourcesSkus = skusSvc
+
+			placement, err := r.getEphemeralOSDiskPlacement(context.TODO())
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError.Error()))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(placement).To(Equal(tc.expectedPlacement))
+		})
+	}
+}
+
+func TestCreateNetworkInterfacePreservesDriftedNetworkInterface(t *testing.T) {
+	nic := func(securityGroupID *string) network.Interface {
+		nic := network.Interface{
+			InterfacePropertiesFormat: &network.InterfacePropertiesFormat{
+				EnableAcceleratedNetworking: ptr.To(false),
+				IPConfigurations: &[]network.InterfaceIPConfiguration{{
+					InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+						Primary:          ptr.To(true),
+						PrivateIPAddress: ptr.To("10.0.0.4"),
+					},
+				}},
+			},
+		}
+		if securityGroupID != nil {
+			nic.NetworkSecurityGroup = &network.SecurityGroup{ID: securityGroupID}
+		}
+		return nic
+	}
+
+	testCases := []struct {
+		name          string
+		preserved     bool
+		existing      *network.Interface
+		staticIPIndex string
+		getErr        error
+		expectWrite   bool
+		expectedDrift string
+		expectedError string
+	}{
+		{
+			name:        "Overwrites the network interface by default",
+			expectWrite: true,
+		},
+		{
+			name:        "Creates the network interface when it does not exist",
+			preserved:   true,
+			getErr:      fmt.Errorf("network interface nic not found: %w", autorest.DetailedError{StatusCode: 404}),
+			expectWrite: true,
+		},
+		{
+			name:        "Writes the network interface when it matches the machine",
+			preserved:   true,
+			existing:    ptr.To(nic(nil)),
+			expectWrite: true,
+		},
+		{
+			name:          "Preserves the network interface when it differs from the machine",
+			preserved:     true,
+			existing:      ptr.To(nic(ptr.To("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityGroups/custom-nsg"))),
+			expectedDrift: "security group",
+		},
+		{
+			name:          "Writes the network interface when its private IP is the one at the static private IP index",
+			preserved:     true,
+			existing:      ptr.To(nic(nil)),
+			staticIPIndex: "4",
+			expectWrite:   true,
+		},
+		{
+			name:          "Preserves the network interface when its private IP is not the one at the static private IP index",
+			preserved:     true,
+			existing:      ptr.To(nic(nil)),
+			staticIPIndex: "5",
+			expectedDrift: "private IP address",
+		},
+		{
+			name:          "Fails when the network interface lookup fails",
+			preserved:     true,
+			getErr:        errors.New("test error"),
+			expectedError: "failed to get network interface nic: test error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			nicSvc := mock_azure.NewMockService(mockCtrl)
+			if tc.existing != nil {
+				nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "nic"}).Return(*tc.existing, nil).Times(1)
+			} else if tc.getErr != nil {
+				nicSvc.EXPECT().Get(gomock.Any(), &networkinterfaces.Spec{Name: "nic"}).Return(nil, tc.getErr).Times(1)
+			}
+			if tc.expectWrite {
+				nicSvc.EXPECT().CreateOrUpdate(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			}
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.ExistingNetworkInterfacesPreserved = tc.preserved
+			r := newFakeReconcilerWithScope(t, scope)
+			r.networkInterfacesSvc = nicSvc
+			if tc.staticIPIndex != "" {
+				scope.Machine.Annotations = map[string]string{MachinePrivateIPAnnotationName: tc.staticIPIndex}
+				r.subnetsSvc = newFakeSubnetService(mockCtrl, "10.0.0.0/24")
+			}
+
+			err := r.createNetworkInterface(context.TODO(), "nic")
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			condition := findCondition(scope.MachineStatus.Conditions, networkInterfaceConfigDriftConditionType)
+			if tc.expectedDrift != "" {
+				g.Expect(condition).ToNot(BeNil())
+				g.Expect(condition.Reason).To(Equal(existingConfigPreservedReason))
+				g.Expect(condition.Message).To(ContainSubstring(tc.expectedDrift))
+			} else {
+				g.Expect(condition).To(BeNil())
+			}
+		})
+	}
+}
+
+func TestGetVirtualMachineDoesNotCacheFailures(t *testing.T) {
+	g := NewWithT(t)
+
+	fakeVMService := &FakeBrokenVmService{ErrorToReturn: errors.New("test error")}
+	r := newFakeReconciler(t)
+	r.virtualMachinesSvc = fakeVMService
+
+	_, err := r.getVirtualMachine(context.TODO())
+	g.Expect(err).To(MatchError("test error"))
+	_, err = r.getVirtualMachine(context.TODO())
+	g.Expect(err).To(MatchError("test error"))
+	g.Expect(fakeVMService.GetCallCount).To(Equal(2))
+}
+
+func TestGetVMUserData(t *testing.T) {
+	payload := []byte("#!/bin/bash\necho hello")
+	encoded := base64.StdEncoding.EncodeToString(payload)
+
+	testCases := []struct {
+		name               string
+		annotations        map[string]string
+		osType             string
+		data               []byte
+		expectedCustomData string
+		expectedUserData   string
+		expectedError      string
+	}{
+		{
+			name:               "Custom data by default",
+			data:               payload,
+			expectedCustomData: encoded,
+		},
+		{
+			name:             "User data only",
+			annotations:      map[string]string{MachineUserDataModeAnnotationName: "UserData"},
+			data:             payload,
+			expectedUserData: encoded,
+		},
+		{
+			name:               "Both custom data and user data",
+			annotations:        map[string]string{MachineUserDataModeAnnotationName: "both"},
+			data:               payload,
+			expectedCustomData: encoded,
+			expectedUserData:   encoded,
+		},
+		{
+			name:          "Invalid mode",
+			annotations:   map[string]string{MachineUserDataModeAnnotationName: "Cloud-Init"},
+			data:          payload,
+			expectedError: "annotation machine.openshift.io/azure-user-data-mode must be one of [CustomData UserData Both], got \"Cloud-Init\"",
+		},
+		{
+			name:          "User data only on Windows",
+			annotations:   map[string]string{MachineUserDataModeAnnotationName: "UserData"},
+			osType:        "Windows",
+			data:          payload,
+			expectedError: "annotation machine.openshift.io/azure-user-data-mode can not be UserData on Windows machines, which need the custom data",
+		},
+		{
+			name:               "Payload at the limit once encoded",
+			data:               []byte(strings.Repeat("a", maxUserDataSize/4*3)),
+			expectedCustomData: base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", maxUserDataSize/4*3))),
+		},
+		{
+			name:          "Payload too large once encoded",
+			data:          []byte(strings.Repeat("a", maxUserDataSize/4*3+1)),
+			expectedError: "user data secret userdata is 65540 bytes base64 encoded, more than the 65536 bytes Azure accepts",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			scope := newFakeScope(t, actuators.Node)
+			scope.Machine.Annotations = tc.annotations
+			scope.MachineConfig.OSDisk.OSType = tc.osType
+			scope.MachineConfig.UserDataSecret = &corev1.SecretReference{Name: "userdata"}
+			scope.CoreClient = controllerfake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "userdata",
+					Namespace: scope.Namespace(),
+				},
+				Data: map[string][]byte{"userData": tc.data},
+			}).Build()
+			r := newFakeReconcilerWithScope(t, scope)
+
+			customData, userData, err := r.getVMUserData()
+			if tc.expectedError != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tc.expectedError)))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(customData).To(Equal(tc.expectedCustomData))
+			g.Expect(userData).To(Equal(tc.expectedUserData))
+		})
+	}
+}
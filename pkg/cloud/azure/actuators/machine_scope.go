@@ -18,9 +18,14 @@ package actuators
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
@@ -31,10 +36,12 @@ import (
 	configv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
 	apicorev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	controllerclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
@@ -57,6 +64,8 @@ const (
 	AzureResourcePrefix = "azure_resource_prefix"
 	// AzureFederatedTokenFileKey path for federated identity token
 	AzureFederatedTokenFileKey = "azure_federated_token_file"
+	// AzureCredsUseManagedIdentityKey whether to authenticate as the user-assigned managed identity of the client ID
+	AzureCredsUseManagedIdentityKey = "azure_use_managed_identity"
 
 	// AzureCredsTenantIDEnvironmentVar tenant ID (environment variable)
 	AzureCredsTenantIDEnvironmentVar = "AZURE_TENANT_ID"
@@ -67,8 +76,17 @@ const (
 	// AzureFederatedTokenFileEnvironmentVar path for federated identity token (environment variable)
 	AzureFederatedTokenFileEnvironmentVar = "AZURE_FEDERATED_TOKEN_FILE"
 
+	// defaultFederatedTokenFile is the path of the projected service account token used as federated token
+	defaultFederatedTokenFile = "/var/run/secrets/openshift/serviceaccount/token"
+
 	globalInfrastuctureName = "cluster"
 
+	// maxTagKeyLength and maxTagValueLength are the limits Azure puts on the length of tags
+	maxTagKeyLength   = 512
+	maxTagValueLength = 256
+	// invalidTagKeyCharacters are the characters Azure does not allow in tag keys
+	invalidTagKeyCharacters = `<>%&\?/`
+
 	// ControlPlane machine label
 	ControlPlane string = "master"
 	// Node machine label
@@ -77,12 +95,18 @@ const (
 	MachineRoleLabel = "machine.openshift.io/cluster-api-machine-role"
 )
 
+// logCloudEnvironmentOnce makes sure the resolved cloud environment is logged once at startup
+// rather than for every machine scope.
+var logCloudEnvironmentOnce sync.Once
+
 // MachineScopeParams defines the input parameters used to create a new MachineScope.
 type MachineScopeParams struct {
 	AzureClients
 	Machine                      *machinev1.Machine
 	CoreClient                   controllerclient.Client
+	EventRecorder                record.EventRecorder
 	AzureWorkloadIdentityEnabled bool
+	Options                      Options
 }
 
 // NewMachineScope creates a new MachineScope from the supplied parameters.
@@ -118,6 +142,7 @@ func NewMachineScope(params MachineScopeParams) (*MachineScope, error) {
 	}
 
 	cloudEnv, armEndpoint := GetCloudEnvironment(infra)
+	recordCloudEnvironment(cloudEnv, armEndpoint)
 
 	machineScope := &MachineScope{
 		Context:      context.Background(),
@@ -141,6 +166,10 @@ func NewMachineScope(params MachineScopeParams) (*MachineScope, error) {
 		azureResourceGroup: resourceGroup,
 
 		azureWorkloadIdentityEnabled: params.AzureWorkloadIdentityEnabled,
+
+		Options: params.Options,
+
+		EventRecorder: params.EventRecorder,
 	}
 
 	if err = updateFromSecret(params.CoreClient, machineScope); err != nil {
@@ -185,6 +214,13 @@ type MachineScope struct {
 
 	// azureWorkloadIdentityEnabled for if the cluster has opted in to azure workload identity
 	azureWorkloadIdentityEnabled bool
+
+	// EventRecorder is used to record informational events against the machine.
+	// May be nil.
+	EventRecorder record.EventRecorder
+
+	// Options are the settings of the machine controller applied to the machine
+	Options
 }
 
 // Name returns the machine name.
@@ -207,6 +243,16 @@ func (m *MachineScope) Location() string {
 	return m.MachineConfig.Location
 }
 
+// Logger returns a logger identifying the machine, and the subscription and resource group it is reconciled in,
+// so that the log lines of the Azure services called for the machine can be traced back to it.
+func (m *MachineScope) Logger() klog.Logger {
+	return klog.Background().WithValues(
+		"machine", klog.KObj(m.Machine),
+		"subscriptionID", m.SubscriptionID,
+		"resourceGroup", m.MachineConfig.ResourceGroup,
+	)
+}
+
 func (m *MachineScope) setMachineSpec() error {
 	ext, err := RawExtensionFromProviderSpec(m.MachineConfig)
 	if err != nil {
@@ -291,6 +337,16 @@ func (m *MachineScope) IsStackHub() bool {
 	return strings.EqualFold(m.cloudEnv, string(configv1.AzureStackCloud))
 }
 
+// StorageEndpointSuffix returns the storage endpoint suffix of the cloud environment, e.g. core.windows.net.
+func (m *MachineScope) StorageEndpointSuffix() (string, error) {
+	env, err := getEnvironment(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to get cloud environment: %w", err)
+	}
+
+	return env.StorageEndpointSuffix, nil
+}
+
 func GetInfrastructure(client controllerclient.Client) (*configv1.Infrastructure, error) {
 	infra := &configv1.Infrastructure{}
 	infraName := controllerclient.ObjectKey{Name: globalInfrastuctureName}
@@ -302,6 +358,15 @@ func GetInfrastructure(client controllerclient.Client) (*configv1.Infrastructure
 	return infra, nil
 }
 
+// recordCloudEnvironment exposes the resolved cloud environment as a metric,
+// and logs it the first time a machine scope is created.
+func recordCloudEnvironment(cloudEnv, armEndpoint string) {
+	logCloudEnvironmentOnce.Do(func() {
+		klog.Infof("Resolved Azure cloud environment %q with ARM endpoint %q", cloudEnv, armEndpoint)
+	})
+	azuremetrics.RecordCloudEnvironment(cloudEnv, armEndpoint)
+}
+
 func GetCloudEnvironment(infra *configv1.Infrastructure) (string, string) {
 	// When cloud environment is missing default to Azure Public Cloud
 	if infra.Status.PlatformStatus == nil || infra.Status.PlatformStatus.Azure == nil || infra.Status.PlatformStatus.Azure.CloudName == "" {
@@ -355,25 +420,25 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 		return err
 	}
 
+	// All the problems with the secret are reported at once, so that it can be fixed in one go. Missing keys
+	// may still be added, e.g. while the credentials are rotated, malformed values are an invalid configuration.
+	var problems []string
+	malformed := false
+
 	subscriptionID, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsSubscriptionIDKey, "")
 	if !ok {
-		return fmt.Errorf("azure subscription id not found in secret %v (%v)",
-			secretType.String(), AzureCredsSubscriptionIDKey)
+		problems = append(problems, fmt.Sprintf("azure subscription id not found (%v)", AzureCredsSubscriptionIDKey))
 	}
 	clientID, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsClientIDKey, AzureCredsClientIDEnvironmentVar)
 	if !ok {
-		return fmt.Errorf("azure client id not found in secret %v (%v) or environment variable %v",
-			secretType.String(), AzureCredsClientIDKey, AzureCredsClientIDEnvironmentVar)
-	}
-	clientSecret, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsClientSecretKey, AzureCredsClientSecretEnvironmentVar)
-	if !ok {
-		klog.V(4).Infof("azure client secret not found in secret %v (%v) or environment variable %v: attempting to use Azure Workload Identity",
-			secretType.String(), AzureCredsClientSecretKey, AzureCredsClientSecretEnvironmentVar)
+		problems = append(problems, fmt.Sprintf("azure client id not found (%v or environment variable %v)",
+			AzureCredsClientIDKey, AzureCredsClientIDEnvironmentVar))
 	}
+	clientSecret, hasClientSecret := getValueFromSecretOrEnvironment(secret.Data, AzureCredsClientSecretKey, AzureCredsClientSecretEnvironmentVar)
 	tenantID, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsTenantIDKey, AzureCredsTenantIDEnvironmentVar)
 	if !ok {
-		return fmt.Errorf("azure tenant id not found in secret %v (%v) or environment variable %v",
-			secretType.String(), AzureCredsTenantIDKey, AzureCredsTenantIDEnvironmentVar)
+		problems = append(problems, fmt.Sprintf("azure tenant id not found (%v or environment variable %v)",
+			AzureCredsTenantIDKey, AzureCredsTenantIDEnvironmentVar))
 	}
 	resourceGroup, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsResourceGroupKey, "")
 	if !ok {
@@ -383,14 +448,31 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 	}
 	region, ok := getValueFromSecretOrEnvironment(secret.Data, AzureCredsRegionKey, "")
 	if !ok {
-		return fmt.Errorf("azure region not found in secret %v (%v)",
-			secretType.String(), AzureCredsRegionKey)
+		problems = append(problems, fmt.Sprintf("azure region not found (%v)", AzureCredsRegionKey))
 	}
-	federatedTokenFile, ok := getValueFromSecretOrEnvironment(secret.Data, AzureFederatedTokenFileKey, AzureFederatedTokenFileEnvironmentVar)
-	if !ok {
+	federatedTokenFile, hasFederatedTokenFile := getValueFromSecretOrEnvironment(secret.Data, AzureFederatedTokenFileKey, AzureFederatedTokenFileEnvironmentVar)
+
+	var credType credentialType
+	useManagedIdentity, err := getUseManagedIdentity(secret.Data)
+	if err != nil {
+		problems = append(problems, err.Error())
+		malformed = true
+	} else if credType, err = getCredentialType(scope.azureWorkloadIdentityEnabled, hasClientSecret, hasFederatedTokenFile, useManagedIdentity); err != nil {
+		problems = append(problems, fmt.Sprintf("%v: azure client secret not found (%v or environment variable %v)",
+			err, AzureCredsClientSecretKey, AzureCredsClientSecretEnvironmentVar))
+	}
+
+	if malformed {
+		return apierrors.InvalidMachineConfiguration("invalid credentials secret %v: %s", secretType.String(), strings.Join(problems, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("incomplete credentials secret %v: %s", secretType.String(), strings.Join(problems, ", "))
+	}
+
+	if credType == workloadIdentityCredentialType && !hasFederatedTokenFile {
 		klog.V(4).Infof("azure federated token file not found in secret %v (%v) or environment variable %v: falling back to default value",
 			secretType.String(), AzureFederatedTokenFileKey, AzureFederatedTokenFileEnvironmentVar)
-		federatedTokenFile = "/var/run/secrets/openshift/serviceaccount/token"
+		federatedTokenFile = defaultFederatedTokenFile
 	}
 
 	env, err := getEnvironment(scope)
@@ -401,7 +483,19 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 	var cred azcore.TokenCredential
 	cloudConfig := getCloudConfig(env)
 
-	if scope.azureWorkloadIdentityEnabled && strings.TrimSpace(clientSecret) == "" {
+	switch credType {
+	case managedIdentityCredentialType:
+		options := azidentity.ManagedIdentityCredentialOptions{
+			ClientOptions: azcore.ClientOptions{
+				Cloud: cloudConfig,
+			},
+			ID: azidentity.ClientID(clientID),
+		}
+		cred, err = azidentity.NewManagedIdentityCredential(&options)
+		if err != nil {
+			return fmt.Errorf("failed to create NewManagedIdentityCredential: %w", err)
+		}
+	case workloadIdentityCredentialType:
 		options := azidentity.WorkloadIdentityCredentialOptions{
 			ClientOptions: azcore.ClientOptions{
 				Cloud: cloudConfig,
@@ -410,11 +504,14 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 			TenantID:      tenantID,
 			TokenFilePath: federatedTokenFile,
 		}
-		cred, err = azidentity.NewWorkloadIdentityCredential(&options)
+		// The federated token expires and is rotated, refresh the credential when it fails to get a token.
+		cred, err = newRefreshingCredential(func() (azcore.TokenCredential, error) {
+			return azidentity.NewWorkloadIdentityCredential(&options)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create NewWorkloadIdentityCredential: %w", err)
 		}
-	} else {
+	default:
 		options := azidentity.ClientSecretCredentialOptions{
 			ClientOptions: azcore.ClientOptions{
 				Cloud: cloudConfig,
@@ -438,8 +535,15 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 	// https://azure.github.io/azure-sdk/releases/latest/index.html#go
 	authorizer := azidext.NewTokenCredentialAdapter(cred, []string{endpointScope})
 
+	// Machines are created in the resource group of the provider spec when set, which may differ from the
+	// resource group of the credentials, itself defaulting to the resource group of the cluster infrastructure.
+	// The network resource group defaults to the resource group of the credentials, not to the one machines
+	// are created in, as the virtual network is shared by the machines of all resource groups.
 	if scope.MachineConfig.ResourceGroup == "" {
 		scope.MachineConfig.ResourceGroup = resourceGroup
+	} else if !strings.EqualFold(scope.MachineConfig.ResourceGroup, resourceGroup) {
+		klog.V(4).Infof("Using resource group %s of the provider spec instead of resource group %s of the credentials",
+			scope.MachineConfig.ResourceGroup, resourceGroup)
 	}
 
 	if scope.MachineConfig.NetworkResourceGroup == "" {
@@ -457,6 +561,44 @@ func updateFromSecret(coreClient controllerclient.Client, scope *MachineScope) e
 	return nil
 }
 
+// getUseManagedIdentity returns whether the secret says to authenticate as a user-assigned managed identity.
+func getUseManagedIdentity(secretData map[string][]byte) (bool, error) {
+	value, ok := getValueFromSecretOrEnvironment(secretData, AzureCredsUseManagedIdentityKey, "")
+	if !ok {
+		return false, nil
+	}
+
+	useManagedIdentity, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("azure managed identity marker (%v) must be true or false, got %q", AzureCredsUseManagedIdentityKey, value)
+	}
+	return useManagedIdentity, nil
+}
+
+// getCredentialType selects the type of credential to authenticate to Azure with from the credentials found in
+// the secret or the environment. The user-assigned managed identity of the client ID is used when the secret
+// says so. Otherwise a client secret takes precedence over a federated token file, which is only used with
+// Azure Workload Identity enabled. Azure Workload Identity falls back to the default federated token file when
+// none is set.
+func getCredentialType(workloadIdentityEnabled, hasClientSecret, hasFederatedTokenFile, useManagedIdentity bool) (credentialType, error) {
+	switch {
+	case useManagedIdentity:
+		if hasClientSecret {
+			klog.V(2).Info("Both a client secret and the use of a managed identity are set, using the managed identity")
+		}
+		return managedIdentityCredentialType, nil
+	case hasClientSecret:
+		if workloadIdentityEnabled && hasFederatedTokenFile {
+			klog.V(2).Info("Both a client secret and a federated token file are set, using the client secret")
+		}
+		return clientSecretCredentialType, nil
+	case workloadIdentityEnabled:
+		return workloadIdentityCredentialType, nil
+	default:
+		return "", errors.New("azure client secret required when Azure Workload Identity is disabled")
+	}
+}
+
 // getValueFromSecretOrEnvironment attempts to pull the string value from the given map and the OS
 // environment. The returned boolean value indicates whether the value was found ("ok")
 func getValueFromSecretOrEnvironment(secretData map[string][]byte, dataKey string, environmentKey string) (string, bool) {
@@ -509,6 +651,12 @@ func getTagList(ocpTags, infraStatusTags, machineSpecTags map[string]string) (ma
 		return nil, fmt.Errorf("Machine.Spec.ProviderSpec.Tags validation failed: %w", err)
 	}
 
+	// Reject tags Azure would refuse when creating the resources
+	// rather than failing deep in the Azure API.
+	if err := validateTagFormat(machineSpecTags); err != nil {
+		return nil, fmt.Errorf("Machine.Spec.ProviderSpec.Tags validation failed: %w", err)
+	}
+
 	tags := make(map[string]*string)
 	// copy user defined tags in Infrastructure.Status.
 	for k, v := range infraStatusTags {
@@ -592,6 +740,32 @@ func findDuplicateTagKeys(tagSet map[string]string) error {
 	return nil
 }
 
+// validateTagFormat checks the tags against the format Azure
+// requires: keys of up to 512 characters not containing any of
+// <>%&\?/, and values of up to 256 characters.
+func validateTagFormat(tagSet map[string]string) error {
+	keys := make([]string, 0, len(tagSet))
+	for k := range tagSet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch {
+		case k == "":
+			return fmt.Errorf("tag key must not be empty")
+		case utf8.RuneCountInString(k) > maxTagKeyLength:
+			return fmt.Errorf("tag key %q must not be longer than %d characters", k, maxTagKeyLength)
+		case strings.ContainsAny(k, invalidTagKeyCharacters):
+			return fmt.Errorf("tag key %q must not contain any of the characters %s", k, invalidTagKeyCharacters)
+		case utf8.RuneCountInString(tagSet[k]) > maxTagValueLength:
+			return fmt.Errorf("value of tag key %q must not be longer than %d characters", k, maxTagValueLength)
+		}
+	}
+
+	return nil
+}
+
 func getCloudConfig(env *azure.Environment) cloud.Configuration {
 	var cloudConfig cloud.Configuration
 	switch env.Name {
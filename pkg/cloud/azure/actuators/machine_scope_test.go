@@ -18,12 +18,19 @@ package actuators
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/Azure/go-autorest/autorest/to"
 	configv1 "github.com/openshift/api/config/v1"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	azuremetrics "github.com/openshift/machine-api-provider-azure/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -173,6 +180,289 @@ func TestCredentialsSecretFailures(t *testing.T) {
 	}
 }
 
+func TestCredentialsSecretMissingKeys(t *testing.T) {
+	t.Setenv(AzureCredsClientIDEnvironmentVar, "")
+	t.Setenv(AzureCredsClientSecretEnvironmentVar, "")
+	t.Setenv(AzureCredsTenantIDEnvironmentVar, "")
+
+	credentialsSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "testCredentials",
+			Namespace: "dummyNamespace",
+		},
+		Data: map[string][]byte{
+			AzureCredsClientIDKey:      []byte("dummyClientID"),
+			AzureCredsResourceGroupKey: []byte("dummyResourceGroup"),
+		},
+	}
+
+	err := testCredentialFields(credentialsSecret)
+	if err == nil {
+		t.Fatalf("Expected New credentials secrets to fail")
+	}
+
+	// Missing keys may still be added to the secret, so they are not an invalid configuration.
+	var machineError *apierrors.MachineError
+	if errors.As(err, &machineError) {
+		t.Errorf("Expected an error which is retried, got %v", err)
+	}
+
+	expectedErr := "incomplete credentials secret dummyNamespace/testCredentials: " +
+		"azure subscription id not found (azure_subscription_id), " +
+		"azure tenant id not found (azure_tenant_id or environment variable AZURE_TENANT_ID), " +
+		"azure region not found (azure_region), " +
+		"azure client secret required when Azure Workload Identity is disabled: azure client secret not found (azure_client_secret or environment variable AZURE_CLIENT_SECRET)"
+	if err.Error() != expectedErr {
+		t.Errorf("Expected error %q, got %q", expectedErr, err.Error())
+	}
+}
+
+func TestGetCredentialType(t *testing.T) {
+	testCases := []struct {
+		name                    string
+		workloadIdentityEnabled bool
+		hasClientSecret         bool
+		hasFederatedTokenFile   bool
+		useManagedIdentity      bool
+		expectedType            credentialType
+		expectedErr             string
+	}{
+		{
+			name:            "Client secret",
+			hasClientSecret: true,
+			expectedType:    clientSecretCredentialType,
+		},
+		{
+			name:                    "Client secret with Azure Workload Identity enabled",
+			workloadIdentityEnabled: true,
+			hasClientSecret:         true,
+			expectedType:            clientSecretCredentialType,
+		},
+		{
+			name:                    "Federated token file",
+			workloadIdentityEnabled: true,
+			hasFederatedTokenFile:   true,
+			expectedType:            workloadIdentityCredentialType,
+		},
+		{
+			name:                    "Default federated token file",
+			workloadIdentityEnabled: true,
+			expectedType:            workloadIdentityCredentialType,
+		},
+		{
+			name:                    "Both client secret and federated token file",
+			workloadIdentityEnabled: true,
+			hasClientSecret:         true,
+			hasFederatedTokenFile:   true,
+			expectedType:            clientSecretCredentialType,
+		},
+		{
+			name:                  "Federated token file with Azure Workload Identity disabled",
+			hasFederatedTokenFile: true,
+			expectedErr:           "azure client secret required when Azure Workload Identity is disabled",
+		},
+		{
+			name:               "Managed identity",
+			useManagedIdentity: true,
+			expectedType:       managedIdentityCredentialType,
+		},
+		{
+			name:               "Both client secret and managed identity",
+			hasClientSecret:    true,
+			useManagedIdentity: true,
+			expectedType:       managedIdentityCredentialType,
+		},
+		{
+			name:                    "Managed identity with Azure Workload Identity enabled",
+			workloadIdentityEnabled: true,
+			hasFederatedTokenFile:   true,
+			useManagedIdentity:      true,
+			expectedType:            managedIdentityCredentialType,
+		},
+		{
+			name:        "No credentials",
+			expectedErr: "azure client secret required when Azure Workload Identity is disabled",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credType, err := getCredentialType(tc.workloadIdentityEnabled, tc.hasClientSecret, tc.hasFederatedTokenFile, tc.useManagedIdentity)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if credType != tc.expectedType {
+				t.Errorf("Expected credential type %q, got %q", tc.expectedType, credType)
+			}
+		})
+	}
+}
+
+func TestCredentialsSecretWorkloadIdentity(t *testing.T) {
+	t.Setenv(AzureCredsClientSecretEnvironmentVar, "")
+	t.Setenv(AzureFederatedTokenFileEnvironmentVar, "")
+
+	testCases := []struct {
+		name                    string
+		workloadIdentityEnabled bool
+		data                    map[string][]byte
+		expectedErr             string
+	}{
+		{
+			name: "Client secret",
+			data: map[string][]byte{
+				AzureCredsClientSecretKey: []byte("dummyClientSecret"),
+			},
+		},
+		{
+			name:                    "Federated token file",
+			workloadIdentityEnabled: true,
+			data: map[string][]byte{
+				AzureFederatedTokenFileKey: []byte("/var/run/secrets/token"),
+			},
+		},
+		{
+			name:                    "Both client secret and federated token file",
+			workloadIdentityEnabled: true,
+			data: map[string][]byte{
+				AzureCredsClientSecretKey:  []byte("dummyClientSecret"),
+				AzureFederatedTokenFileKey: []byte("/var/run/secrets/token"),
+			},
+		},
+		{
+			name: "Federated token file with Azure Workload Identity disabled",
+			data: map[string][]byte{
+				AzureFederatedTokenFileKey: []byte("/var/run/secrets/token"),
+			},
+			expectedErr: "incomplete credentials secret dummyNamespace/testCredentials: azure client secret required when Azure Workload Identity is disabled: azure client secret not found (azure_client_secret or environment variable AZURE_CLIENT_SECRET)",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credentialsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "testCredentials",
+					Namespace: "dummyNamespace",
+				},
+				Data: map[string][]byte{
+					AzureCredsSubscriptionIDKey: []byte("dummySubID"),
+					AzureCredsClientIDKey:       []byte("dummyClientID"),
+					AzureCredsTenantIDKey:       []byte("dummyTenantID"),
+					AzureCredsRegionKey:         []byte("dummyRegion"),
+				},
+			}
+			for key, value := range tc.data {
+				credentialsSecret.Data[key] = value
+			}
+
+			fakeclient := controllerfake.NewClientBuilder().WithObjects(credentialsSecret).Build()
+			scope := &MachineScope{
+				MachineConfig: &machinev1.AzureMachineProviderSpec{
+					CredentialsSecret: &corev1.SecretReference{Name: "testCredentials", Namespace: "dummyNamespace"},
+				},
+				CoreClient:                   fakeclient,
+				cloudEnv:                     string(configv1.AzurePublicCloud),
+				azureWorkloadIdentityEnabled: tc.workloadIdentityEnabled,
+			}
+
+			err := updateFromSecret(fakeclient, scope)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if scope.Authorizer == nil {
+				t.Errorf("Expected an authorizer to be set")
+			}
+		})
+	}
+}
+
+func TestCredentialsSecretManagedIdentity(t *testing.T) {
+	t.Setenv(AzureCredsClientSecretEnvironmentVar, "")
+
+	testCases := []struct {
+		name        string
+		data        map[string][]byte
+		expectedErr string
+	}{
+		{
+			name: "Managed identity",
+			data: map[string][]byte{
+				AzureCredsUseManagedIdentityKey: []byte("true"),
+			},
+		},
+		{
+			name: "Managed identity disabled",
+			data: map[string][]byte{
+				AzureCredsUseManagedIdentityKey: []byte("false"),
+			},
+			expectedErr: "incomplete credentials secret dummyNamespace/testCredentials: azure client secret required when Azure Workload Identity is disabled: azure client secret not found (azure_client_secret or environment variable AZURE_CLIENT_SECRET)",
+		},
+		{
+			name: "Invalid managed identity marker",
+			data: map[string][]byte{
+				AzureCredsUseManagedIdentityKey: []byte("yes please"),
+			},
+			expectedErr: `invalid credentials secret dummyNamespace/testCredentials: azure managed identity marker (azure_use_managed_identity) must be true or false, got "yes please"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			credentialsSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "testCredentials",
+					Namespace: "dummyNamespace",
+				},
+				Data: map[string][]byte{
+					AzureCredsSubscriptionIDKey: []byte("dummySubID"),
+					AzureCredsClientIDKey:       []byte("dummyClientID"),
+					AzureCredsTenantIDKey:       []byte("dummyTenantID"),
+					AzureCredsRegionKey:         []byte("dummyRegion"),
+				},
+			}
+			for key, value := range tc.data {
+				credentialsSecret.Data[key] = value
+			}
+
+			fakeclient := controllerfake.NewClientBuilder().WithObjects(credentialsSecret).Build()
+			scope := &MachineScope{
+				MachineConfig: &machinev1.AzureMachineProviderSpec{
+					CredentialsSecret: &corev1.SecretReference{Name: "testCredentials", Namespace: "dummyNamespace"},
+				},
+				CoreClient: fakeclient,
+				cloudEnv:   string(configv1.AzurePublicCloud),
+			}
+
+			err := updateFromSecret(fakeclient, scope)
+			if tc.expectedErr != "" {
+				if err == nil || err.Error() != tc.expectedErr {
+					t.Errorf("Expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if scope.Authorizer == nil {
+				t.Errorf("Expected an authorizer to be set")
+			}
+		})
+	}
+}
+
 func testCredentialSecret() *corev1.Secret {
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
@@ -403,6 +693,92 @@ func TestNewMachineScope(t *testing.T) {
 	}
 }
 
+func TestNewMachineScopeResourceGroups(t *testing.T) {
+	testCases := []struct {
+		name                         string
+		resourceGroup                string
+		networkResourceGroup         string
+		credentialsResourceGroup     string
+		infraResourceGroup           string
+		expectedResourceGroup        string
+		expectedNetworkResourceGroup string
+	}{
+		{
+			name:                         "Resource group of the provider spec takes precedence over the credentials",
+			resourceGroup:                "compute-rg",
+			credentialsResourceGroup:     "credentials-rg",
+			infraResourceGroup:           "infra-rg",
+			expectedResourceGroup:        "compute-rg",
+			expectedNetworkResourceGroup: "credentials-rg",
+		},
+		{
+			name:                         "Resource groups of the provider spec",
+			resourceGroup:                "compute-rg",
+			networkResourceGroup:         "network-rg",
+			credentialsResourceGroup:     "credentials-rg",
+			expectedResourceGroup:        "compute-rg",
+			expectedNetworkResourceGroup: "network-rg",
+		},
+		{
+			name:                         "Resource group of the credentials takes precedence over the infrastructure",
+			credentialsResourceGroup:     "credentials-rg",
+			infraResourceGroup:           "infra-rg",
+			expectedResourceGroup:        "credentials-rg",
+			expectedNetworkResourceGroup: "credentials-rg",
+		},
+		{
+			name:                         "Resource group of the infrastructure",
+			infraResourceGroup:           "infra-rg",
+			expectedResourceGroup:        "infra-rg",
+			expectedNetworkResourceGroup: "infra-rg",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			secret := testCredentialSecret()
+			delete(secret.Data, AzureCredsResourceGroupKey)
+			if tc.credentialsResourceGroup != "" {
+				secret.Data[AzureCredsResourceGroupKey] = []byte(tc.credentialsResourceGroup)
+			}
+
+			infra := &configv1.Infrastructure{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: globalInfrastuctureName,
+				},
+				Status: configv1.InfrastructureStatus{
+					InfrastructureName: "test-shfj",
+					PlatformStatus: &configv1.PlatformStatus{
+						Azure: &configv1.AzurePlatformStatus{
+							CloudName:         configv1.AzurePublicCloud,
+							ResourceGroupName: tc.infraResourceGroup,
+						},
+					},
+				},
+			}
+
+			providerSpec := testProviderSpec()
+			providerSpec.ResourceGroup = tc.resourceGroup
+			providerSpec.NetworkResourceGroup = tc.networkResourceGroup
+
+			scope, err := NewMachineScope(MachineScopeParams{
+				Machine:    testMachineWithProviderSpec(t, providerSpec),
+				CoreClient: controllerfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret, infra).Build(),
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+
+			if scope.MachineConfig.ResourceGroup != tc.expectedResourceGroup {
+				t.Errorf("Expected resource group %v, got: %v", tc.expectedResourceGroup, scope.MachineConfig.ResourceGroup)
+			}
+			if scope.MachineConfig.NetworkResourceGroup != tc.expectedNetworkResourceGroup {
+				t.Errorf("Expected network resource group %v, got: %v", tc.expectedNetworkResourceGroup, scope.MachineConfig.NetworkResourceGroup)
+			}
+		})
+	}
+}
+
 func TestGetCloudEnvironment(t *testing.T) {
 	testCases := []struct {
 		name                string
@@ -512,6 +888,119 @@ func TestGetCloudEnvironment(t *testing.T) {
 	}
 }
 
+func TestRecordCloudEnvironment(t *testing.T) {
+	testCases := []struct {
+		name                string
+		platformStatus      *configv1.PlatformStatus
+		expectedCloud       string
+		expectedARMEndpoint string
+	}{
+		{
+			name: "Azure Public Cloud",
+			platformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName: configv1.AzurePublicCloud,
+				},
+			},
+			expectedCloud: string(configv1.AzurePublicCloud),
+		},
+		{
+			name: "Azure Stack Hub",
+			platformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName:   configv1.AzureStackCloud,
+					ARMEndpoint: "https://management.local.azurestack.external",
+				},
+			},
+			expectedCloud:       string(configv1.AzureStackCloud),
+			expectedARMEndpoint: "https://management.local.azurestack.external",
+		},
+		{
+			name: "Azure Stack Hub recorded again",
+			platformStatus: &configv1.PlatformStatus{
+				Azure: &configv1.AzurePlatformStatus{
+					CloudName:   configv1.AzureStackCloud,
+					ARMEndpoint: "https://management.local.azurestack.external",
+				},
+			},
+			expectedCloud:       string(configv1.AzureStackCloud),
+			expectedARMEndpoint: "https://management.local.azurestack.external",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			infra := &configv1.Infrastructure{
+				Status: configv1.InfrastructureStatus{
+					PlatformStatus: tc.platformStatus,
+				},
+			}
+			recordCloudEnvironment(GetCloudEnvironment(infra))
+
+			metrics := make(chan prometheus.Metric, 2)
+			azuremetrics.CloudEnvironmentInfo.Collect(metrics)
+			close(metrics)
+
+			if len(metrics) != 1 {
+				t.Fatalf("expected a single cloud environment series, got: %d", len(metrics))
+			}
+
+			metric := &dto.Metric{}
+			if err := (<-metrics).Write(metric); err != nil {
+				t.Fatal(err)
+			}
+
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["cloud"] != tc.expectedCloud {
+				t.Errorf("expected cloud label %s, got: %s", tc.expectedCloud, labels["cloud"])
+			}
+			if labels["arm_endpoint"] != tc.expectedARMEndpoint {
+				t.Errorf("expected arm_endpoint label %s, got: %s", tc.expectedARMEndpoint, labels["arm_endpoint"])
+			}
+			if value := metric.GetGauge().GetValue(); value != 1 {
+				t.Errorf("expected cloud environment value 1, got: %v", value)
+			}
+		})
+	}
+}
+
+func TestStorageEndpointSuffix(t *testing.T) {
+	testCases := []struct {
+		cloudEnv       configv1.AzureCloudEnvironment
+		expectedSuffix string
+	}{
+		{
+			cloudEnv:       configv1.AzurePublicCloud,
+			expectedSuffix: "core.windows.net",
+		},
+		{
+			cloudEnv:       configv1.AzureUSGovernmentCloud,
+			expectedSuffix: "core.usgovcloudapi.net",
+		},
+		{
+			cloudEnv:       configv1.AzureChinaCloud,
+			expectedSuffix: "core.chinacloudapi.cn",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.cloudEnv), func(t *testing.T) {
+			scope := &MachineScope{cloudEnv: string(tc.cloudEnv)}
+
+			suffix, err := scope.StorageEndpointSuffix()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if suffix != tc.expectedSuffix {
+				t.Errorf("expected storage endpoint suffix %q, got %q", tc.expectedSuffix, suffix)
+			}
+		})
+	}
+}
+
 func TestGetTagList(t *testing.T) {
 	ocpDefaultTags := map[string]string{
 		"kubernetes.io_cluster.test-fhbv": "owned",
@@ -687,6 +1176,39 @@ func TestGetTagList(t *testing.T) {
 			expectedTags: nil,
 			wantErr:      true,
 		},
+		{
+			name:            "MachineSpecTags has a too long key",
+			ocpTags:         ocpDefaultTags,
+			machineSpecTags: map[string]string{strings.Repeat("k", 513): "test"},
+			expectedTags:    nil,
+			wantErr:         true,
+		},
+		{
+			name:            "MachineSpecTags has a too long value",
+			ocpTags:         ocpDefaultTags,
+			machineSpecTags: map[string]string{"environment": strings.Repeat("v", 257)},
+			expectedTags:    nil,
+			wantErr:         true,
+		},
+		{
+			name:            "MachineSpecTags has a key with an illegal character",
+			ocpTags:         ocpDefaultTags,
+			machineSpecTags: map[string]string{"cost/center": "test"},
+			expectedTags:    nil,
+			wantErr:         true,
+		},
+		{
+			name:    "MachineSpecTags has the longest allowed key and value",
+			ocpTags: ocpDefaultTags,
+			machineSpecTags: map[string]string{
+				strings.Repeat("k", 512): strings.Repeat("v", 256),
+			},
+			expectedTags: map[string]*string{
+				"kubernetes.io_cluster.test-fhbv": to.StringPtr("owned"),
+				strings.Repeat("k", 512):          to.StringPtr(strings.Repeat("v", 256)),
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -705,6 +1227,59 @@ func TestGetTagList(t *testing.T) {
 	}
 }
 
+func TestValidateTagFormat(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tags          map[string]string
+		expectedError string
+	}{
+		{
+			name: "Valid tags",
+			tags: map[string]string{"environment": "test", "cost-center": "a<b"},
+		},
+		{
+			name:          "Empty key",
+			tags:          map[string]string{"": "test"},
+			expectedError: "tag key must not be empty",
+		},
+		{
+			name:          "Too long key",
+			tags:          map[string]string{strings.Repeat("k", 513): "test"},
+			expectedError: fmt.Sprintf("tag key %q must not be longer than 512 characters", strings.Repeat("k", 513)),
+		},
+		{
+			name:          "Too long value",
+			tags:          map[string]string{"environment": strings.Repeat("v", 257)},
+			expectedError: `value of tag key "environment" must not be longer than 256 characters`,
+		},
+		{
+			name:          "Illegal character in key",
+			tags:          map[string]string{"environment": "test", "cost%center": "test"},
+			expectedError: `tag key "cost%center" must not contain any of the characters <>%&\?/`,
+		},
+		{
+			name:          "Backslash in key",
+			tags:          map[string]string{`cost\center`: "test"},
+			expectedError: `tag key "cost\\center" must not contain any of the characters <>%&\?/`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTagFormat(tc.tags)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, Got: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error %q, Got: %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
 func TestGetOCPTagList(t *testing.T) {
 
 	testCases := []struct {
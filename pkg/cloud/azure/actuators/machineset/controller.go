@@ -18,7 +18,10 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
@@ -26,6 +29,7 @@ import (
 	"github.com/openshift/machine-api-operator/pkg/util"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -50,18 +54,35 @@ const (
 	// This exposes compute information based on the providerSpec input.
 	// This is needed by the autoscaler to foresee upcoming capacity when scaling from zero.
 	// https://github.com/openshift/enhancements/pull/186
-	cpuKey    = "machine.openshift.io/vCPU"
-	memoryKey = "machine.openshift.io/memoryMb"
-	gpuKey    = "machine.openshift.io/GPU"
-	labelsKey = "capacity.cluster-autoscaler.kubernetes.io/labels"
+	cpuKey          = "machine.openshift.io/vCPU"
+	memoryKey       = "machine.openshift.io/memoryMb"
+	gpuKey          = "machine.openshift.io/GPU"
+	instanceTypeKey = "machine.openshift.io/instanceType"
+	diskKey         = "capacity.cluster-autoscaler.kubernetes.io/ephemeral-disk"
+	labelsKey       = "capacity.cluster-autoscaler.kubernetes.io/labels"
+
+	// acceleratorLabel is the node label the autoscaler uses to identify the GPU type of a node.
+	acceleratorLabel = "cluster-api/accelerator"
+	// AcceleratorNvidia is the accelerator label value for machine types with NVIDIA GPUs.
+	AcceleratorNvidia = "nvidia"
+	// AcceleratorAMD is the accelerator label value for machine types with AMD GPUs.
+	AcceleratorAMD = "amd"
 )
 
+// amdGPUMachineTypes matches the machine types with AMD GPUs, e.g. Standard_NV4as_v4,
+// Standard_NG8ads_V620_v1 or Standard_ND96isr_MI300X_v5. The other machine types with GPUs have NVIDIA GPUs.
+var amdGPUMachineTypes = regexp.MustCompile(`(?i)^Standard_(NV\d+as_v4|NG\d+.*|ND\d+.*_MI\d+.*)$`)
+
 // Reconciler reconciles machineSets.
 type Reconciler struct {
 	Client                     client.Client
 	Log                        logr.Logger
 	ResourceSkusServiceBuilder resourceskus.ResourceSkusServiceBuilderFuncType
 
+	// ResourceSkusRateLimiter limits the rate of the resource SKUs requests to Azure shared by
+	// the concurrent reconciles, the requests are not limited when nil.
+	ResourceSkusRateLimiter *rate.Limiter
+
 	AzureWorkloadIdentityEnabled bool
 
 	recorder record.EventRecorder
@@ -107,7 +128,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	}
 	originalMachineSetToPatch := client.MergeFrom(machineSet.DeepCopy())
 
-	result, err := r.reconcile(machineSet)
+	result, err := r.reconcile(ctx, machineSet)
 	if err != nil {
 		logger.Error(err, "Failed to reconcile MachineSet")
 		r.recorder.Eventf(machineSet, corev1.EventTypeWarning, "ReconcileError", "%v", err)
@@ -137,9 +158,9 @@ func isInvalidConfigurationError(err error) bool {
 	return false
 }
 
-func (r *Reconciler) reconcile(machineSet *machinev1.MachineSet) (ctrl.Result, error) {
+func (r *Reconciler) reconcile(ctx context.Context, machineSet *machinev1.MachineSet) (ctrl.Result, error) {
 	klog.Infof("%v: Reconciling MachineSet", machineSet.Name)
-	stockKeepUnit, err := getStockKeepUnit(r, machineSet)
+	stockKeepUnit, err := getStockKeepUnit(ctx, r, machineSet)
 	if err != nil {
 		if errors.Is(err, resourceskus.ErrResourceNotFound) {
 			// Print different error message when there is no failure, but SKU is not available.
@@ -158,13 +179,15 @@ func (r *Reconciler) reconcile(machineSet *machinev1.MachineSet) (ctrl.Result, e
 		return ctrl.Result{}, fmt.Errorf("failed to reconcile machineSet: %w", err)
 	}
 
-	updateMachineSetAnnotations(machineSet, stockKeepUnit)
+	if err := updateMachineSetAnnotations(machineSet, stockKeepUnit); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to set scale from zero annotations: %w", err)
+	}
 
 	return ctrl.Result{}, nil
 }
 
 // getStockKeepUnit returns the stock keep unit (SKU) containing information from Azure API about the machine type.
-func getStockKeepUnit(r *Reconciler, machineSet *machinev1.MachineSet) (resourceskus.SKU, error) {
+func getStockKeepUnit(ctx context.Context, r *Reconciler, machineSet *machinev1.MachineSet) (resourceskus.SKU, error) {
 	providerConfig, err := getproviderConfig(machineSet)
 	if err != nil {
 		return resourceskus.SKU{}, mapierrors.InvalidMachineConfiguration("failed to get providerConfig: %v", err)
@@ -174,13 +197,18 @@ func getStockKeepUnit(r *Reconciler, machineSet *machinev1.MachineSet) (resource
 	if err != nil {
 		return resourceskus.SKU{}, fmt.Errorf("failed to create machineScope: %w", err)
 	}
+
+	// The lookup waits for the rate limiter only when the resource SKUs of the location are listed from Azure.
+	if r.ResourceSkusRateLimiter != nil {
+		ctx = resourceskus.WithRateLimiter(ctx, r.ResourceSkusRateLimiter)
+	}
 	resourceSkusService := r.ResourceSkusServiceBuilder(machineScope)
 
 	skuSpec := resourceskus.Spec{
 		Name:         providerConfig.VMSize,
 		ResourceType: resourceskus.VirtualMachines,
 	}
-	skuI, err := resourceSkusService.Get(context.Background(), skuSpec)
+	skuI, err := resourceSkusService.Get(ctx, skuSpec)
 	if err != nil {
 		if errors.Is(err, resourceskus.ErrResourceNotFound) {
 			return resourceskus.SKU{}, mapierrors.InvalidMachineConfiguration("failed to obtain instance type information for VMSize '%s' from Azure: %s", skuSpec.Name, err)
@@ -214,7 +242,7 @@ func createMachineScope(r *Reconciler, machineSet *machinev1.MachineSet) (*actua
 	return machineScope, nil
 }
 
-// updateMachineSetAnnotations updates the machineSet annotations with CPU, memory, and GPU capabilities of the template machine type.
+// updateMachineSetAnnotations updates the machineSet annotations with the instance type and the CPU, memory, and GPU capabilities of the template machine type.
 func updateMachineSetAnnotations(machineSet *machinev1.MachineSet, sku resourceskus.SKU) error {
 	if machineSet.Annotations == nil {
 		machineSet.Annotations = make(map[string]string)
@@ -247,20 +275,61 @@ func updateMachineSetAnnotations(machineSet *machinev1.MachineSet, sku resources
 		machineSet.Annotations[gpuKey] = gpuCap
 	}
 
+	// Ephemeral disk
+	if resourceVolumeMB, ok := sku.GetCapability(resourceskus.MaxResourceVolumeMB); ok && resourceVolumeMB != "0" {
+		if _, err := strconv.ParseInt(resourceVolumeMB, 10, 64); err != nil {
+			return fmt.Errorf("could not parse resource volume size %q: %w", resourceVolumeMB, err)
+		}
+		// The resource volume size reported by Azure is in MiB.
+		machineSet.Annotations[diskKey] = resourceVolumeMB + "Mi"
+	} else {
+		delete(machineSet.Annotations, diskKey)
+	}
+
+	// Instance type
+	if sku.Name != nil {
+		machineSet.Annotations[instanceTypeKey] = *sku.Name
+	}
+
 	// Architecture
 	architecture, ok := sku.GetCapability(resourceskus.CPUArchitectureType)
 	if !ok {
 		klog.V(2).Infof("SKU '%s' does not have the CPUArchitecture capability. Defaulting to amd64", *sku.Name)
 	}
+	labels := []string{fmt.Sprintf("kubernetes.io/arch=%s", normalizedArchitecture(architecture))}
+
+	// Accelerator
+	if gpuVendor := gpuVendor(sku, gpuCap); gpuVendor != "" {
+		labels = append(labels, fmt.Sprintf("%s=%s", acceleratorLabel, gpuVendor))
+	}
+
 	// We guarantee that any existing labels provided via the capacity annotations are preserved.
 	// See https://github.com/kubernetes/autoscaler/pull/5382 and https://github.com/kubernetes/autoscaler/pull/5697
-	machineSet.Annotations[labelsKey] = util.MergeCommaSeparatedKeyValuePairs(
-		fmt.Sprintf("kubernetes.io/arch=%s", normalizedArchitecture(architecture)),
-		machineSet.Annotations[labelsKey])
+	// The merged labels are sorted so that the annotation does not change between reconciles.
+	mergedLabels := strings.Split(util.MergeCommaSeparatedKeyValuePairs(
+		strings.Join(labels, ","),
+		machineSet.Annotations[labelsKey]), ",")
+	sort.Strings(mergedLabels)
+	machineSet.Annotations[labelsKey] = strings.Join(mergedLabels, ",")
 
 	return nil
 }
 
+// gpuVendor returns the accelerator family of the GPUs of the machine type derived from its name,
+// or an empty string when the machine type has no GPUs.
+func gpuVendor(sku resourceskus.SKU, gpus string) string {
+	if sku.Name == nil {
+		return ""
+	}
+	if count, err := strconv.Atoi(gpus); err != nil || count == 0 {
+		return ""
+	}
+	if amdGPUMachineTypes.MatchString(*sku.Name) {
+		return AcceleratorAMD
+	}
+	return AcceleratorNvidia
+}
+
 // memoryGiBtoMiB converts string representing memory size in GiB to string representing memory size in MiB
 func memoryGiBtoMiB(memoryGiB string) (string, error) {
 	memoryFloatGiB, err := strconv.ParseFloat(memoryGiB, 64)
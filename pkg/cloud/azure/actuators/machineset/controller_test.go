@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
@@ -28,6 +29,7 @@ import (
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -251,10 +253,11 @@ var _ = Describe("Reconciler", func() {
 			vmSize:              "Standard_D4s_v3",
 			existingAnnotations: make(map[string]string),
 			expectedAnnotations: map[string]string{
-				cpuKey:    "4",
-				memoryKey: "16384",
-				gpuKey:    "0",
-				labelsKey: "kubernetes.io/arch=amd64",
+				cpuKey:          "4",
+				memoryKey:       "16384",
+				gpuKey:          "0",
+				instanceTypeKey: "Standard_D4s_v3",
+				labelsKey:       "kubernetes.io/arch=amd64",
 			},
 			expectedEvents: []string{},
 		}),
@@ -262,10 +265,11 @@ var _ = Describe("Reconciler", func() {
 			vmSize:              "Standard_NC24",
 			existingAnnotations: make(map[string]string),
 			expectedAnnotations: map[string]string{
-				cpuKey:    "24",
-				memoryKey: "229376",
-				gpuKey:    "4",
-				labelsKey: "kubernetes.io/arch=amd64",
+				cpuKey:          "24",
+				memoryKey:       "229376",
+				gpuKey:          "4",
+				instanceTypeKey: "Standard_NC24",
+				labelsKey:       "cluster-api/accelerator=nvidia,kubernetes.io/arch=amd64",
 			},
 			expectedEvents: []string{},
 		}),
@@ -276,12 +280,13 @@ var _ = Describe("Reconciler", func() {
 				"annother": "existingAnnotation",
 			},
 			expectedAnnotations: map[string]string{
-				"existing": "annotation",
-				"annother": "existingAnnotation",
-				cpuKey:     "24",
-				memoryKey:  "229376",
-				gpuKey:     "4",
-				labelsKey:  "kubernetes.io/arch=amd64",
+				"existing":      "annotation",
+				"annother":      "existingAnnotation",
+				cpuKey:          "24",
+				memoryKey:       "229376",
+				gpuKey:          "4",
+				instanceTypeKey: "Standard_NC24",
+				labelsKey:       "cluster-api/accelerator=nvidia,kubernetes.io/arch=amd64",
 			},
 			expectedEvents: []string{},
 		}),
@@ -301,10 +306,11 @@ var _ = Describe("Reconciler", func() {
 			vmSize:              "Standard_D4ps_v5",
 			existingAnnotations: make(map[string]string),
 			expectedAnnotations: map[string]string{
-				cpuKey:    "4",
-				memoryKey: "16384",
-				gpuKey:    "0",
-				labelsKey: "kubernetes.io/arch=arm64",
+				cpuKey:          "4",
+				memoryKey:       "16384",
+				gpuKey:          "0",
+				instanceTypeKey: "Standard_D4ps_v5",
+				labelsKey:       "kubernetes.io/arch=arm64",
 			},
 			expectedEvents: []string{},
 		}),
@@ -312,10 +318,11 @@ var _ = Describe("Reconciler", func() {
 			vmSize:              "Standard_D4s_v3_missing-arch",
 			existingAnnotations: make(map[string]string),
 			expectedAnnotations: map[string]string{
-				cpuKey:    "4",
-				memoryKey: "16384",
-				gpuKey:    "0",
-				labelsKey: "kubernetes.io/arch=amd64",
+				cpuKey:          "4",
+				memoryKey:       "16384",
+				gpuKey:          "0",
+				instanceTypeKey: "Standard_D4s_v3_missing-arch",
+				labelsKey:       "kubernetes.io/arch=amd64",
 			},
 			expectedEvents: []string{},
 		}),
@@ -323,16 +330,174 @@ var _ = Describe("Reconciler", func() {
 			vmSize:              "Standard_D4s_v3_wrong-arch",
 			existingAnnotations: make(map[string]string),
 			expectedAnnotations: map[string]string{
-				cpuKey:    "4",
-				memoryKey: "16384",
-				gpuKey:    "0",
-				labelsKey: "kubernetes.io/arch=amd64",
+				cpuKey:          "4",
+				memoryKey:       "16384",
+				gpuKey:          "0",
+				instanceTypeKey: "Standard_D4s_v3_wrong-arch",
+				labelsKey:       "kubernetes.io/arch=amd64",
 			},
 			expectedEvents: []string{},
 		}),
 	)
 })
 
+var _ = Describe("getStockKeepUnit", func() {
+	It("does not wait for the resource SKUs rate limiter when the SKUs are cached", func() {
+		limiter := rate.NewLimiter(rate.Every(time.Hour), 2)
+		fakeResourceSkusService := NewFakeResourceSkusService([]compute.ResourceSku{
+			{
+				Name:         to.StringPtr("Standard_D4s_v3"),
+				ResourceType: to.StringPtr("virtualMachines"),
+			},
+		}, "centralus")
+		r := &Reconciler{
+			Client: k8sClient,
+			Log:    log.Log,
+			ResourceSkusServiceBuilder: func(scope *actuators.MachineScope) azure.Service {
+				return fakeResourceSkusService
+			},
+			ResourceSkusRateLimiter: limiter,
+		}
+
+		machineSet, err := newTestMachineSet("default", "Standard_D4s_v3", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		sku, err := getStockKeepUnit(ctx, r, machineSet)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sku.Name).To(Equal(to.StringPtr("Standard_D4s_v3")))
+		Expect(limiter.Tokens()).To(BeNumerically("~", 2, 0.01))
+	})
+})
+
+var _ = Describe("updateMachineSetAnnotations", func() {
+	It("sets the scale from zero annotations from the SKU capabilities", func() {
+		sku := resourceskus.SKU{
+			Name:         to.StringPtr("Standard_NC6s_v3"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{
+					Name:  to.StringPtr(resourceskus.VCPUs),
+					Value: to.StringPtr("6"),
+				},
+				{
+					Name:  to.StringPtr(resourceskus.MemoryGB),
+					Value: to.StringPtr("112"),
+				},
+				{
+					Name:  to.StringPtr(resourceskus.GPUs),
+					Value: to.StringPtr("1"),
+				},
+			},
+		}
+		machineSet := &machinev1.MachineSet{}
+
+		Expect(updateMachineSetAnnotations(machineSet, sku)).To(Succeed())
+		Expect(machineSet.Annotations).To(Equal(map[string]string{
+			cpuKey:          "6",
+			memoryKey:       "114688",
+			gpuKey:          "1",
+			instanceTypeKey: "Standard_NC6s_v3",
+			labelsKey:       "cluster-api/accelerator=nvidia,kubernetes.io/arch=amd64",
+		}))
+	})
+
+	DescribeTable("sets the accelerator label from the machine type",
+		func(name, gpus string, existingLabels string, expectedLabels string) {
+			capabilities := []compute.ResourceSkuCapabilities{
+				{
+					Name:  to.StringPtr(resourceskus.VCPUs),
+					Value: to.StringPtr("4"),
+				},
+				{
+					Name:  to.StringPtr(resourceskus.MemoryGB),
+					Value: to.StringPtr("16"),
+				},
+			}
+			if gpus != "" {
+				capabilities = append(capabilities, compute.ResourceSkuCapabilities{
+					Name:  to.StringPtr(resourceskus.GPUs),
+					Value: to.StringPtr(gpus),
+				})
+			}
+			sku := resourceskus.SKU{
+				Name:         to.StringPtr(name),
+				ResourceType: to.StringPtr("virtualMachines"),
+				Capabilities: &capabilities,
+			}
+			machineSet := &machinev1.MachineSet{}
+			if existingLabels != "" {
+				machineSet.Annotations = map[string]string{labelsKey: existingLabels}
+			}
+
+			Expect(updateMachineSetAnnotations(machineSet, sku)).To(Succeed())
+			Expect(machineSet.Annotations[labelsKey]).To(Equal(expectedLabels))
+		},
+		Entry("without GPUs", "Standard_D4s_v3", "", "", "kubernetes.io/arch=amd64"),
+		Entry("with zero GPUs", "Standard_D4s_v3", "0", "", "kubernetes.io/arch=amd64"),
+		Entry("with NVIDIA GPUs", "Standard_NC4as_T4_v3", "1", "", "cluster-api/accelerator=nvidia,kubernetes.io/arch=amd64"),
+		Entry("with AMD Radeon Instinct GPUs", "Standard_NV4as_v4", "1", "", "cluster-api/accelerator=amd,kubernetes.io/arch=amd64"),
+		Entry("with AMD Radeon Pro GPUs", "Standard_NG8ads_V620_v1", "1", "", "cluster-api/accelerator=amd,kubernetes.io/arch=amd64"),
+		Entry("with AMD Instinct GPUs", "Standard_ND96isr_MI300X_v5", "8", "", "cluster-api/accelerator=amd,kubernetes.io/arch=amd64"),
+		Entry("with an existing accelerator label", "Standard_NC4as_T4_v3", "1", "cluster-api/accelerator=nvidia-t4", "cluster-api/accelerator=nvidia-t4,kubernetes.io/arch=amd64"),
+	)
+
+	DescribeTable("sets the ephemeral disk annotation from the resource volume size",
+		func(resourceVolumeMB string, expectedDisk string) {
+			capabilities := []compute.ResourceSkuCapabilities{
+				{
+					Name:  to.StringPtr(resourceskus.VCPUs),
+					Value: to.StringPtr("4"),
+				},
+				{
+					Name:  to.StringPtr(resourceskus.MemoryGB),
+					Value: to.StringPtr("16"),
+				},
+			}
+			if resourceVolumeMB != "" {
+				capabilities = append(capabilities, compute.ResourceSkuCapabilities{
+					Name:  to.StringPtr(resourceskus.MaxResourceVolumeMB),
+					Value: to.StringPtr(resourceVolumeMB),
+				})
+			}
+			sku := resourceskus.SKU{
+				Name:         to.StringPtr("Standard_D4s_v3"),
+				ResourceType: to.StringPtr("virtualMachines"),
+				Capabilities: &capabilities,
+			}
+			machineSet := &machinev1.MachineSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{diskKey: "1Gi"},
+				},
+			}
+
+			Expect(updateMachineSetAnnotations(machineSet, sku)).To(Succeed())
+			if expectedDisk == "" {
+				Expect(machineSet.Annotations).ToNot(HaveKey(diskKey))
+			} else {
+				Expect(machineSet.Annotations).To(HaveKeyWithValue(diskKey, expectedDisk))
+			}
+		},
+		Entry("with a resource volume", "32768", "32768Mi"),
+		Entry("without the resource volume capability", "", ""),
+		Entry("without a resource volume", "0", ""),
+	)
+
+	It("fails with an invalid resource volume size", func() {
+		sku := resourceskus.SKU{
+			Name:         to.StringPtr("Standard_D4s_v3"),
+			ResourceType: to.StringPtr("virtualMachines"),
+			Capabilities: &[]compute.ResourceSkuCapabilities{
+				{
+					Name:  to.StringPtr(resourceskus.MaxResourceVolumeMB),
+					Value: to.StringPtr("large"),
+				},
+			},
+		}
+
+		Expect(updateMachineSetAnnotations(&machinev1.MachineSet{}, sku)).To(MatchError(ContainSubstring("could not parse resource volume size")))
+	})
+})
+
 func deleteMachineSets(c client.Client, namespaceName string) error {
 	machineSets := &machinev1.MachineSetList{}
 	err := c.List(ctx, machineSets, client.InNamespace(namespaceName))
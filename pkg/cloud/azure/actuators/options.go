@@ -0,0 +1,75 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package actuators
+
+import "time"
+
+// Options holds the settings of the machine controller, set from its flags, which apply to every machine it reconciles.
+type Options struct {
+	// StandaloneAvailabilitySetEnabled makes the actuator create an availability set,
+	// named after the machine, for machines without a MachineSet label in regions
+	// without availability zones. Disabled by default.
+	StandaloneAvailabilitySetEnabled bool
+
+	// PublicIPNameTruncationEnabled makes the actuator truncate public IP names longer
+	// than 63 characters and suffix them with a hash, instead of failing the machine.
+	PublicIPNameTruncationEnabled bool
+
+	// AcceleratedNetworkingEventsSuppressed stops the actuator from emitting an event when
+	// a machine is created without accelerated networking on an instance type that supports it.
+	AcceleratedNetworkingEventsSuppressed bool
+
+	// SpotMaxPriceUncappedConditionSuppressed stops the actuator from setting a condition on
+	// spot machines which set no max price, and so are billed up to the on-demand price.
+	SpotMaxPriceUncappedConditionSuppressed bool
+
+	// DefaultDataDiskStorageAccountType is the storage account type applied to data disks
+	// which leave it empty. No default is applied when empty.
+	DefaultDataDiskStorageAccountType string
+
+	// WindowsAdminPasswordSecretEnabled makes the actuator store the admin password generated
+	// for Windows machines in a secret in the namespace of the machine. Disabled by default.
+	WindowsAdminPasswordSecretEnabled bool
+
+	// CanceledProvisioningRetries is how many times the actuator resends the specification
+	// of a VM left in the Canceled provisioning state before failing the machine.
+	CanceledProvisioningRetries int
+
+	// AllowedImagePublishers restricts the publishers of the marketplace images machines can
+	// be created from. Any publisher is allowed when empty.
+	AllowedImagePublishers []string
+
+	// VMInitializationTimeout is how long after the creation of a machine its VM is considered
+	// to be initializing while Azure reports no provisioning state for it.
+	VMInitializationTimeout time.Duration
+
+	// ExistingNetworkInterfacesPreserved stops the actuator from overwriting an existing network
+	// interface whose configuration differs from the machine, a condition is set instead.
+	ExistingNetworkInterfacesPreserved bool
+
+	// AzureCallTimeout bounds each call the actuator makes to Azure to read a resource, a call exceeding
+	// it is aborted and the machine is requeued. No timeout is applied when zero.
+	AzureCallTimeout time.Duration
+
+	// AzureLongRunningCallTimeout bounds each call the actuator makes to Azure to create, update or delete
+	// a resource, which may wait for a long-running operation to complete. No timeout is applied when zero.
+	AzureLongRunningCallTimeout time.Duration
+
+	// DeletionVerificationEnabled makes the actuator check that the resources of a deleted machine
+	// no longer exist, and report the remaining ones. Disabled by default.
+	DeletionVerificationEnabled bool
+}
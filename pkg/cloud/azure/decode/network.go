@@ -9,8 +9,11 @@ type NetworkInterface struct {
 }
 
 type InterfacePropertiesFormat struct {
-	DNSSettings      *InterfaceDNSSettings       `json:"dnsSettings,omitempty"`
-	IPConfigurations *[]InterfaceIPConfiguration `json:"ipConfigurations,omitempty"`
+	DNSSettings                 *InterfaceDNSSettings       `json:"dnsSettings,omitempty"`
+	IPConfigurations            *[]InterfaceIPConfiguration `json:"ipConfigurations,omitempty"`
+	ProvisioningState           *string                     `json:"provisioningState,omitempty"`
+	NetworkSecurityGroup        *SubResource                `json:"networkSecurityGroup,omitempty"`
+	EnableAcceleratedNetworking *bool                       `json:"enableAcceleratedNetworking,omitempty"`
 }
 
 type InterfaceDNSSettings struct {
@@ -22,8 +25,10 @@ type InterfaceIPConfiguration struct {
 }
 
 type InterfaceIPConfigurationPropertiesFormat struct {
-	PrivateIPAddress *string          `json:"privateIPAddress,omitempty"`
-	PublicIPAddress  *PublicIPAddress `json:"publicIPAddress,omitempty"`
+	PrivateIPAddress          *string          `json:"privateIPAddress,omitempty"`
+	PublicIPAddress           *PublicIPAddress `json:"publicIPAddress,omitempty"`
+	Primary                   *bool            `json:"primary,omitempty"`
+	ApplicationSecurityGroups *[]SubResource   `json:"applicationSecurityGroups,omitempty"`
 }
 
 type PublicIPAddress struct {
@@ -32,8 +37,9 @@ type PublicIPAddress struct {
 }
 
 type PublicIPAddressPropertiesFormat struct {
-	IPAddress   *string                     `json:"ipAddress,omitempty"`
-	DNSSettings *PublicIPAddressDNSSettings `json:"dnsSettings,omitempty"`
+	IPAddress         *string                     `json:"ipAddress,omitempty"`
+	DNSSettings       *PublicIPAddressDNSSettings `json:"dnsSettings,omitempty"`
+	ProvisioningState *string                     `json:"provisioningState,omitempty"`
 }
 
 type PublicIPAddressDNSSettings struct {
@@ -64,6 +70,17 @@ type FrontendIPConfigurationPropertiesFormat struct {
 	PrivateIPAddress *string `json:"privateIPAddress,omitempty"`
 }
 
+// Subnet in a virtual network resource.
+type Subnet struct {
+	*SubnetPropertiesFormat `json:"properties,omitempty"`
+}
+
+// SubnetPropertiesFormat properties of the subnet.
+type SubnetPropertiesFormat struct {
+	AddressPrefix   *string   `json:"addressPrefix,omitempty"`
+	AddressPrefixes *[]string `json:"addressPrefixes,omitempty"`
+}
+
 func GetNetworkInterface(nic interface{}) (*NetworkInterface, error) {
 	decodedNic := &NetworkInterface{}
 	err := mapstructure.Decode(nic, &decodedNic)
@@ -94,3 +111,13 @@ func GetLoadBalancers(lbs interface{}) ([]LoadBalancer, error) {
 
 	return decodedLBs, nil
 }
+
+func GetSubnet(subnet interface{}) (*Subnet, error) {
+	decodedSubnet := &Subnet{}
+	err := mapstructure.Decode(subnet, &decodedSubnet)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodedSubnet, nil
+}
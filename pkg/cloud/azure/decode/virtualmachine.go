@@ -6,17 +6,59 @@ import (
 
 type VirtualMachine struct {
 	*VirtualMachineProperties `json:"properties,omitempty"`
-	ID                        *string   `json:"id,omitempty"`
-	Zones                     *[]string `json:"zones,omitempty"`
-	Location                  *string   `json:"location,omitempty"`
+	ID                        *string                 `json:"id,omitempty"`
+	Zones                     *[]string               `json:"zones,omitempty"`
+	Location                  *string                 `json:"location,omitempty"`
+	Identity                  *VirtualMachineIdentity `json:"identity,omitempty"`
+	Tags                      map[string]*string      `json:"tags,omitempty"`
+}
+
+type VirtualMachineIdentity struct {
+	Type                   string                 `json:"type,omitempty"`
+	UserAssignedIdentities map[string]interface{} `json:"userAssignedIdentities,omitempty"`
 }
 
 type VirtualMachineProperties struct {
-	OsProfile         *OSProfile                  `json:"osProfile,omitempty"`
-	NetworkProfile    *NetworkProfile             `json:"networkProfile,omitempty"`
-	ProvisioningState *string                     `json:"provisioningState,omitempty"`
-	InstanceView      *VirtualMachineInstanceView `json:"instanceView,omitempty"`
-	HardwareProfile   *HardwareProfile            `json:"hardwareProfile,omitempty"`
+	OsProfile               *OSProfile                  `json:"osProfile,omitempty"`
+	NetworkProfile          *NetworkProfile             `json:"networkProfile,omitempty"`
+	ProvisioningState       *string                     `json:"provisioningState,omitempty"`
+	InstanceView            *VirtualMachineInstanceView `json:"instanceView,omitempty"`
+	HardwareProfile         *HardwareProfile            `json:"hardwareProfile,omitempty"`
+	StorageProfile          *StorageProfile             `json:"storageProfile,omitempty"`
+	AvailabilitySet         *SubResource                `json:"availabilitySet,omitempty"`
+	ProximityPlacementGroup *SubResource                `json:"proximityPlacementGroup,omitempty"`
+	Host                    *SubResource                `json:"host,omitempty"`
+}
+
+type SubResource struct {
+	ID *string `json:"id,omitempty"`
+}
+
+type StorageProfile struct {
+	ImageReference *ImageReference `json:"imageReference,omitempty"`
+	DataDisks      *[]DataDisk     `json:"dataDisks,omitempty"`
+}
+
+type ImageReference struct {
+	Version      *string `json:"version,omitempty"`
+	ExactVersion *string `json:"exactVersion,omitempty"`
+}
+
+type DataDisk struct {
+	Name                    *string                `json:"name,omitempty"`
+	Lun                     *int32                 `json:"lun,omitempty"`
+	DeleteOption            string                 `json:"deleteOption,omitempty"`
+	CreateOption            string                 `json:"createOption,omitempty"`
+	Caching                 string                 `json:"caching,omitempty"`
+	DiskSizeGB              *int32                 `json:"diskSizeGB,omitempty"`
+	WriteAcceleratorEnabled *bool                  `json:"writeAcceleratorEnabled,omitempty"`
+	ManagedDisk             *ManagedDiskParameters `json:"managedDisk,omitempty"`
+}
+
+type ManagedDiskParameters struct {
+	ID                 *string      `json:"id,omitempty"`
+	StorageAccountType string       `json:"storageAccountType,omitempty"`
+	DiskEncryptionSet  *SubResource `json:"diskEncryptionSet,omitempty"`
 }
 
 type HardwareProfile struct {
@@ -28,7 +70,10 @@ type VirtualMachineInstanceView struct {
 }
 
 type InstanceViewStatus struct {
-	Code *string `json:"code,omitempty"`
+	Code          *string `json:"code,omitempty"`
+	Level         *string `json:"level,omitempty"`
+	DisplayStatus *string `json:"displayStatus,omitempty"`
+	Message       *string `json:"message,omitempty"`
 }
 
 type OSProfile struct {
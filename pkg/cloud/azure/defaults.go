@@ -17,6 +17,8 @@ limitations under the License.
 package azure
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
@@ -35,6 +37,17 @@ const (
 	DefaultInternalLBIPAddress = "10.0.0.100"
 	// DefaultAzureDNSZone is the default provided azure dns zone
 	DefaultAzureDNSZone = "cloudapp.azure.com"
+	// OSDiskNameSuffix is the suffix appended to the machine name to build the OS disk name
+	OSDiskNameSuffix = "OSDisk"
+
+	// MaxResourceNameLength is the maximum length of the network interface, disk and availability set names
+	MaxResourceNameLength = 80
+
+	// MinDiskBurstingSizeGB is the minimum size of a premium disk supporting on-demand bursting, the size of a P30 disk
+	MinDiskBurstingSizeGB = 513
+
+	// publicIPNameHashLength is the length of the hash suffix of truncated public IP names
+	publicIPNameHashLength = 8
 )
 
 // GenerateVnetName generates a virtual network name, based on the cluster name.
@@ -92,6 +105,21 @@ func GenerateMachinePublicIPName(clusterName, machineName string) (string, error
 	return "", errors.New("machine public IP name is longer than 63 characters")
 }
 
+// GenerateTruncatedMachinePublicIPName generates a public IP name for a machine like GenerateMachinePublicIPName,
+// but names longer than 63 characters are truncated and suffixed with a hash of the full name to keep them unique.
+func GenerateTruncatedMachinePublicIPName(clusterName, machineName string) string {
+	name := GeneratePublicIPName(clusterName, machineName)
+	if len(name) < 64 {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:publicIPNameHashLength]
+	prefix := strings.TrimRight(name[:63-len(suffix)-1], "-.")
+
+	return fmt.Sprintf("%s-%s", prefix, suffix)
+}
+
 // GenerateFQDN generates a fully qualified domain name, based on the public IP name and cluster location.
 func GenerateFQDN(publicIPName, location string) string {
 	return fmt.Sprintf("%s.%s.%s", publicIPName, location, DefaultAzureDNSZone)
@@ -121,7 +149,7 @@ func GenerateMachineProviderID(subscriptionID, resourceGroupName, machineName st
 
 // GenerateOSDiskName generates OS disk name used by VM
 func GenerateOSDiskName(machineName string) string {
-	return fmt.Sprintf("%s_OSDisk", machineName)
+	return fmt.Sprintf("%s_%s", machineName, OSDiskNameSuffix)
 }
 
 // GenerateDataDiskName generates Data disks names used by VM
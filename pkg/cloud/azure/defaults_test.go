@@ -40,6 +40,52 @@ func TestGenerateMachinePublicIPName(t *testing.T) {
 	}
 }
 
+func TestGenerateTruncatedMachinePublicIPName(t *testing.T) {
+	longMachineName := strings.Repeat("0123456789", 6)
+
+	tests := []struct {
+		name        string
+		clusterName string
+		machineName string
+		expected    string
+	}{
+		{
+			name:        "Public IP name length less than 64 is not truncated",
+			clusterName: "clusterName",
+			machineName: "machine",
+			expected:    "clusterName-machine",
+		},
+		{
+			name:        "Public IP name length with at least 64 is truncated with a hash",
+			clusterName: "clusterName",
+			machineName: longMachineName,
+			expected:    "clusterName-" + longMachineName[:42] + "-c7d95dda",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := GenerateTruncatedMachinePublicIPName(test.clusterName, test.machineName)
+			if len(name) > 63 {
+				t.Errorf("generated public IP name is longer than 63 chars (%v)", len(name))
+			}
+			if test.expected != "" && name != test.expected {
+				t.Errorf("Expected name: %s, got: %s", test.expected, name)
+			}
+			if again := GenerateTruncatedMachinePublicIPName(test.clusterName, test.machineName); again != name {
+				t.Errorf("Expected deterministic name %s, got: %s", name, again)
+			}
+		})
+	}
+
+	// Names only differing past the truncation point must not collide.
+	a := GenerateTruncatedMachinePublicIPName("clusterName", longMachineName+"-a")
+	b := GenerateTruncatedMachinePublicIPName("clusterName", longMachineName+"-b")
+	if a == b {
+		t.Errorf("Expected truncated names to differ, got %s for both", a)
+	}
+}
+
 func TestGenerateMachineProviderID(t *testing.T) {
 	testCases := []struct {
 		name              string
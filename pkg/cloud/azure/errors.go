@@ -17,9 +17,23 @@ limitations under the License.
 package azure
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+)
+
+const (
+	// quotaExceededErrorCode is the code of the error returned by Azure when a request exceeds a quota
+	quotaExceededErrorCode = "QuotaExceeded"
+	// operationNotAllowedErrorCode is the code of the error returned by Azure when a request is refused,
+	// which is the case for requests exceeding the core quota of a subscription
+	operationNotAllowedErrorCode = "OperationNotAllowed"
 )
 
 // ResourceNotFound parses the error to check if its a resource not found
@@ -30,11 +44,86 @@ func ResourceNotFound(err error) bool {
 	return false
 }
 
-// InvalidCredentials parses the error to check if its an invalid credentials error
+// InvalidCredentials parses the error to check if its an invalid credentials error, either
+// a request refused as unauthorized or a failure to get a token for the credentials
 func InvalidCredentials(err error) bool {
 	detailedError := autorest.DetailedError{}
 	if errors.As(err, &detailedError) && detailedError.StatusCode == 401 {
 		return true
 	}
+	var authenticationFailedError *azidentity.AuthenticationFailedError
+	return errors.As(err, &authenticationFailedError)
+}
+
+// CallTimedOut parses the error to check if it is a call to Azure which ran out of time
+func CallTimedOut(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// ClassifyError tells whether the error returned by a call to Azure is terminal, so that retrying the
+// same request can not succeed, or transient. For transient errors it returns how long Azure asked to
+// wait before retrying, or zero when it did not ask for a delay.
+//
+//   - exceeded quotas are terminal
+//   - invalid credentials, including failures to get a token, are transient, as they are refreshed
+//     while the credentials or the federated tokens are rotated
+//   - conflicts are transient, as they are caused by operations on the resource still in progress
+//   - throttled requests are transient, and retried after the delay Azure asked for
+//   - any other client error, including authorization failures and resources not found, is terminal
+//   - server errors, timed out calls and errors without a status code are transient
+func ClassifyError(err error) (bool, time.Duration) {
+	var detailedError autorest.DetailedError
+	if err == nil || CallTimedOut(err) || InvalidCredentials(err) || !errors.As(err, &detailedError) {
+		return false, 0
+	}
+
+	if QuotaExceeded(err) {
+		return true, 0
+	}
+
+	statusCode, ok := detailedError.StatusCode.(int)
+	if !ok {
+		return false, 0
+	}
+
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusConflict:
+		return false, 0
+	case statusCode == http.StatusTooManyRequests:
+		if detailedError.Response == nil {
+			return false, 0
+		}
+		return false, autorest.GetRetryAfter(detailedError.Response, 0)
+	case statusCode >= 400 && statusCode < 500:
+		return true, 0
+	default:
+		return false, 0
+	}
+}
+
+// QuotaExceeded parses the error to check if it is a request refused because it exceeds a quota
+func QuotaExceeded(err error) bool {
+	code, message := serviceError(err)
+	switch code {
+	case quotaExceededErrorCode:
+		return true
+	case operationNotAllowedErrorCode:
+		return strings.Contains(strings.ToLower(message), "quota")
+	}
 	return false
 }
+
+// serviceError returns the code and message of the error returned by the Azure service, if any.
+func serviceError(err error) (string, string) {
+	var requestError *autorestazure.RequestError
+	if errors.As(err, &requestError) && requestError.ServiceError != nil {
+		return requestError.ServiceError.Code, requestError.ServiceError.Message
+	}
+
+	var serviceError *autorestazure.ServiceError
+	if errors.As(err, &serviceError) {
+		return serviceError.Code, serviceError.Message
+	}
+
+	return "", ""
+}
@@ -0,0 +1,127 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+)
+
+// responseError returns an error like the ones returned by the Azure clients for a response with the status code,
+// the service error and headers.
+func responseError(statusCode int, serviceError *autorestazure.ServiceError, header http.Header) error {
+	requestError := &autorestazure.RequestError{ServiceError: serviceError}
+	return autorest.DetailedError{
+		Original:    requestError,
+		PackageType: "compute.VirtualMachinesClient",
+		Method:      "CreateOrUpdate",
+		StatusCode:  statusCode,
+		Message:     "Failure responding to request",
+		Response:    &http.Response{StatusCode: statusCode, Header: header},
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name               string
+		err                error
+		expectedTerminal   bool
+		expectedRetryAfter time.Duration
+	}{
+		{
+			name: "No error",
+		},
+		{
+			name: "Error without a status code",
+			err:  errors.New("connection reset by peer"),
+		},
+		{
+			name: "Timed out call",
+			err:  fmt.Errorf("failed to get VM: %w", context.DeadlineExceeded),
+		},
+		{
+			name:             "Bad request",
+			err:              fmt.Errorf("failed to create VM: %w", responseError(http.StatusBadRequest, &autorestazure.ServiceError{Code: "InvalidParameter"}, nil)),
+			expectedTerminal: true,
+		},
+		{
+			name:             "Exceeded quota",
+			err:              responseError(http.StatusBadRequest, &autorestazure.ServiceError{Code: "QuotaExceeded"}, nil),
+			expectedTerminal: true,
+		},
+		{
+			name: "Exceeded core quota",
+			err: responseError(http.StatusConflict, &autorestazure.ServiceError{
+				Code:    "OperationNotAllowed",
+				Message: "Operation could not be completed as it results in exceeding approved standardDSv3Family Cores quota.",
+			}, nil),
+			expectedTerminal: true,
+		},
+		{
+			name:             "Exceeded quota of a long running operation",
+			err:              autorest.DetailedError{Original: &autorestazure.ServiceError{Code: "QuotaExceeded"}, StatusCode: http.StatusOK},
+			expectedTerminal: true,
+		},
+		{
+			name: "Invalid credentials",
+			err:  responseError(http.StatusUnauthorized, &autorestazure.ServiceError{Code: "InvalidAuthenticationToken"}, nil),
+		},
+		{
+			name: "Failed to get a token",
+			err: autorest.DetailedError{
+				Original:   &azidentity.AuthenticationFailedError{},
+				StatusCode: http.StatusBadRequest,
+				Message:    "Failure preparing request",
+			},
+		},
+		{
+			name:             "Authorization failed",
+			err:              responseError(http.StatusForbidden, &autorestazure.ServiceError{Code: "AuthorizationFailed"}, nil),
+			expectedTerminal: true,
+		},
+		{
+			name:             "Resource not found",
+			err:              responseError(http.StatusNotFound, &autorestazure.ServiceError{Code: "ResourceNotFound"}, nil),
+			expectedTerminal: true,
+		},
+		{
+			name: "Conflict",
+			err:  responseError(http.StatusConflict, &autorestazure.ServiceError{Code: "OperationNotAllowed", Message: "Another operation is in progress."}, nil),
+		},
+		{
+			name:               "Throttled request",
+			err:                responseError(http.StatusTooManyRequests, nil, http.Header{"Retry-After": []string{"30"}}),
+			expectedRetryAfter: 30 * time.Second,
+		},
+		{
+			name: "Throttled request without a delay",
+			err:  responseError(http.StatusTooManyRequests, nil, nil),
+		},
+		{
+			name: "Server error",
+			err:  responseError(http.StatusInternalServerError, nil, nil),
+		},
+		{
+			name: "Redirection",
+			err:  autorest.DetailedError{StatusCode: http.StatusMultipleChoices},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			terminal, retryAfter := ClassifyError(test.err)
+			if terminal != test.expectedTerminal {
+				t.Errorf("Expected terminal to be %v, got %v", test.expectedTerminal, terminal)
+			}
+			if retryAfter != test.expectedRetryAfter {
+				t.Errorf("Expected retry after %v, got %v", test.expectedRetryAfter, retryAfter)
+			}
+		})
+	}
+}
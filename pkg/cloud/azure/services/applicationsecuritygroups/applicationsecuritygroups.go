@@ -49,12 +49,13 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	asgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid application security groups specification")
 	}
 
-	klog.V(2).Infof("creating application security group %s", asgSpec.Name)
+	log.V(2).Info("creating application security group", "name", asgSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -77,17 +78,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("created application security group %s", asgSpec.Name)
+	log.V(2).Info("created application security group", "name", asgSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	asgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid application security groups specification")
 	}
-	klog.V(2).Infof("deleting application security group %s", asgSpec.Name)
+	log.V(2).Info("deleting application security group", "name", asgSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, asgSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -107,6 +109,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("deleted application security group %s", asgSpec.Name)
+	log.V(2).Info("deleted application security group", "name", asgSpec.Name)
 	return err
 }
@@ -44,12 +44,13 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a route table.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	asgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid application security groups specification")
 	}
 
-	klog.V(2).Infof("creating application security group %s", asgSpec.Name)
+	log.V(2).Info("creating application security group", "name", asgSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -71,17 +72,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("created application security group %s", asgSpec.Name)
+	log.V(2).Info("created application security group", "name", asgSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	asgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid application security groups specification")
 	}
-	klog.V(2).Infof("deleting application security group %s", asgSpec.Name)
+	log.V(2).Info("deleting application security group", "name", asgSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, asgSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -101,6 +103,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("deleted application security group %s", asgSpec.Name)
+	log.V(2).Info("deleted application security group", "name", asgSpec.Name)
 	return err
 }
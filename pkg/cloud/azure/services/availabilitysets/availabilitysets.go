@@ -8,13 +8,31 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus"
 )
 
+const (
+	// defaultUpdateDomainCount is the number of update domains of an availability set when none is requested.
+	defaultUpdateDomainCount = 5
+	// maximumUpdateDomainCount is the largest number of update domains Azure supports for an availability set.
+	maximumUpdateDomainCount = 20
+)
+
 // Spec input specification for Get/CreateOrUpdate/Delete calls
 type Spec struct {
 	Name string
+	// FaultDomainCount is the number of platform fault domains of the availability set,
+	// the maximum supported in the location is used when nil. It must match the count of
+	// the availability set when it already exists.
+	FaultDomainCount *int32
+	// UpdateDomainCount is the number of platform update domains of the availability set,
+	// defaultUpdateDomainCount is used when nil. It must match the count of the availability
+	// set when it already exists.
+	UpdateDomainCount *int32
+	// ResourceGroup of the availability set to get or delete, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
 // CreateOrUpdate creates or updates the availability set with the given name.
@@ -23,9 +41,28 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if !ok {
 		return errors.New("invalid availability set specification")
 	}
-	faultDomainCount, err := s.getMaximumFaultDomainCount(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get fault domain count: %w", err)
+
+	var faultDomainCount, updateDomainCount int32
+	existing, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, availabilitysetsSpec.Name)
+	switch {
+	case err == nil:
+		// The domain counts of an availability set can not be changed once it is created.
+		faultDomainCount, updateDomainCount, err = existingDomainCounts(availabilitysetsSpec, existing)
+		if err != nil {
+			return err
+		}
+	case azure.ResourceNotFound(err):
+		maximumFaultDomainCount, err := s.getMaximumFaultDomainCount(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get fault domain count: %w", err)
+		}
+
+		faultDomainCount, updateDomainCount, err = platformDomainCounts(availabilitysetsSpec, maximumFaultDomainCount, s.Scope.Location())
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("failed to get availability set %s: %w", availabilitysetsSpec.Name, err)
 	}
 
 	asParams := compute.AvailabilitySet{
@@ -35,8 +72,8 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		},
 		Location: to.StringPtr(s.Scope.Location()),
 		AvailabilitySetProperties: &compute.AvailabilitySetProperties{
-			PlatformFaultDomainCount:  to.Int32Ptr(int32(faultDomainCount)),
-			PlatformUpdateDomainCount: to.Int32Ptr(int32(5)),
+			PlatformFaultDomainCount:  to.Int32Ptr(faultDomainCount),
+			PlatformUpdateDomainCount: to.Int32Ptr(updateDomainCount),
 		},
 		Tags: s.Scope.Tags,
 	}
@@ -55,8 +92,12 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return nil, errors.New("invalid availability set specification")
 	}
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if availabilitysetsSpec.ResourceGroup != "" {
+		resourceGroup = availabilitysetsSpec.ResourceGroup
+	}
 
-	as, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, availabilitysetsSpec.Name)
+	as, err := s.Client.Get(ctx, resourceGroup, availabilitysetsSpec.Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get availability set %s: %w", availabilitysetsSpec.Name, err)
 	}
@@ -70,8 +111,12 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if !ok {
 		return errors.New("invalid availability set specification")
 	}
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if availabilitysetsSpec.ResourceGroup != "" {
+		resourceGroup = availabilitysetsSpec.ResourceGroup
+	}
 
-	as, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, availabilitysetsSpec.Name)
+	as, err := s.Client.Get(ctx, resourceGroup, availabilitysetsSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
@@ -86,7 +131,7 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 		return nil
 	}
 
-	_, err = s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, availabilitysetsSpec.Name)
+	_, err = s.Client.Delete(ctx, resourceGroup, availabilitysetsSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
@@ -99,6 +144,52 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	return nil
 }
 
+// platformDomainCounts returns the fault and update domain counts of the availability set,
+// making sure the requested ones are supported in the location.
+func platformDomainCounts(spec *Spec, maximumFaultDomainCount int, location string) (int32, int32, error) {
+	faultDomainCount := int32(maximumFaultDomainCount)
+	if spec.FaultDomainCount != nil {
+		faultDomainCount = *spec.FaultDomainCount
+		if faultDomainCount < 1 || int(faultDomainCount) > maximumFaultDomainCount {
+			return 0, 0, machinecontroller.InvalidMachineConfiguration("availability set fault domain count %d is not supported in location %s, "+
+				"it must be between 1 and %d", faultDomainCount, location, maximumFaultDomainCount)
+		}
+	}
+
+	updateDomainCount := int32(defaultUpdateDomainCount)
+	if spec.UpdateDomainCount != nil {
+		updateDomainCount = *spec.UpdateDomainCount
+		if updateDomainCount < 1 || updateDomainCount > maximumUpdateDomainCount {
+			return 0, 0, machinecontroller.InvalidMachineConfiguration("availability set update domain count %d is not supported, "+
+				"it must be between 1 and %d", updateDomainCount, maximumUpdateDomainCount)
+		}
+	}
+
+	return faultDomainCount, updateDomainCount, nil
+}
+
+// existingDomainCounts returns the fault and update domain counts of the existing availability set,
+// making sure the requested ones match them.
+func existingDomainCounts(spec *Spec, as compute.AvailabilitySet) (int32, int32, error) {
+	var faultDomainCount, updateDomainCount int32
+	if as.AvailabilitySetProperties != nil {
+		faultDomainCount = to.Int32(as.PlatformFaultDomainCount)
+		updateDomainCount = to.Int32(as.PlatformUpdateDomainCount)
+	}
+
+	if spec.FaultDomainCount != nil && *spec.FaultDomainCount != faultDomainCount {
+		return 0, 0, machinecontroller.InvalidMachineConfiguration("availability set %s already exists with fault domain count %d, "+
+			"it can not be changed to %d", spec.Name, faultDomainCount, *spec.FaultDomainCount)
+	}
+
+	if spec.UpdateDomainCount != nil && *spec.UpdateDomainCount != updateDomainCount {
+		return 0, 0, machinecontroller.InvalidMachineConfiguration("availability set %s already exists with update domain count %d, "+
+			"it can not be changed to %d", spec.Name, updateDomainCount, *spec.UpdateDomainCount)
+	}
+
+	return faultDomainCount, updateDomainCount, nil
+}
+
 // getMaximumFaultDomainCount retrieves the MaximumPlatformFaultDomainCount from the SKU service.
 func (s *Service) getMaximumFaultDomainCount(ctx context.Context) (int, error) {
 	skuService := resourceskus.NewService(s.Scope)
@@ -0,0 +1,136 @@
+package availabilitysets
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	. "github.com/onsi/gomega"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"k8s.io/utils/ptr"
+)
+
+func TestPlatformDomainCounts(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		spec                      *Spec
+		maximumFaultDomainCount   int
+		expectedFaultDomainCount  int32
+		expectedUpdateDomainCount int32
+		expectedError             error
+	}{
+		{
+			name:                      "Defaults to the maximum fault domain count of the location",
+			spec:                      &Spec{},
+			maximumFaultDomainCount:   3,
+			expectedFaultDomainCount:  3,
+			expectedUpdateDomainCount: defaultUpdateDomainCount,
+		},
+		{
+			name:                      "Requested domain counts",
+			spec:                      &Spec{FaultDomainCount: ptr.To[int32](2), UpdateDomainCount: ptr.To[int32](10)},
+			maximumFaultDomainCount:   3,
+			expectedFaultDomainCount:  2,
+			expectedUpdateDomainCount: 10,
+		},
+		{
+			name:                      "Requested fault domain count matching the maximum of the location",
+			spec:                      &Spec{FaultDomainCount: ptr.To[int32](2)},
+			maximumFaultDomainCount:   2,
+			expectedFaultDomainCount:  2,
+			expectedUpdateDomainCount: defaultUpdateDomainCount,
+		},
+		{
+			name:                    "Fault domain count exceeding the maximum of the location",
+			spec:                    &Spec{FaultDomainCount: ptr.To[int32](3)},
+			maximumFaultDomainCount: 2,
+			expectedError: machinecontroller.InvalidMachineConfiguration("availability set fault domain count 3 is not supported in location westus, " +
+				"it must be between 1 and 2"),
+		},
+		{
+			name:                    "Zero fault domain count",
+			spec:                    &Spec{FaultDomainCount: ptr.To[int32](0)},
+			maximumFaultDomainCount: 2,
+			expectedError: machinecontroller.InvalidMachineConfiguration("availability set fault domain count 0 is not supported in location westus, " +
+				"it must be between 1 and 2"),
+		},
+		{
+			name:                    "Update domain count exceeding the maximum",
+			spec:                    &Spec{UpdateDomainCount: ptr.To[int32](21)},
+			maximumFaultDomainCount: 3,
+			expectedError: machinecontroller.InvalidMachineConfiguration("availability set update domain count 21 is not supported, " +
+				"it must be between 1 and 20"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			faultDomainCount, updateDomainCount, err := platformDomainCounts(tc.spec, tc.maximumFaultDomainCount, "westus")
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(faultDomainCount).To(Equal(tc.expectedFaultDomainCount))
+				g.Expect(updateDomainCount).To(Equal(tc.expectedUpdateDomainCount))
+			}
+		})
+	}
+}
+
+func TestExistingDomainCounts(t *testing.T) {
+	existing := compute.AvailabilitySet{
+		AvailabilitySetProperties: &compute.AvailabilitySetProperties{
+			PlatformFaultDomainCount:  ptr.To[int32](2),
+			PlatformUpdateDomainCount: ptr.To[int32](5),
+		},
+	}
+
+	testCases := []struct {
+		name                      string
+		spec                      *Spec
+		expectedFaultDomainCount  int32
+		expectedUpdateDomainCount int32
+		expectedError             error
+	}{
+		{
+			name:                      "Keeps the domain counts of the existing set",
+			spec:                      &Spec{Name: "as"},
+			expectedFaultDomainCount:  2,
+			expectedUpdateDomainCount: 5,
+		},
+		{
+			name:                      "Requested domain counts matching the existing set",
+			spec:                      &Spec{Name: "as", FaultDomainCount: ptr.To[int32](2), UpdateDomainCount: ptr.To[int32](5)},
+			expectedFaultDomainCount:  2,
+			expectedUpdateDomainCount: 5,
+		},
+		{
+			name: "Fault domain count differing from the existing set",
+			spec: &Spec{Name: "as", FaultDomainCount: ptr.To[int32](3)},
+			expectedError: machinecontroller.InvalidMachineConfiguration("availability set as already exists with fault domain count 2, " +
+				"it can not be changed to 3"),
+		},
+		{
+			name: "Update domain count differing from the existing set",
+			spec: &Spec{Name: "as", UpdateDomainCount: ptr.To[int32](10)},
+			expectedError: machinecontroller.InvalidMachineConfiguration("availability set as already exists with update domain count 5, " +
+				"it can not be changed to 10"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			faultDomainCount, updateDomainCount, err := existingDomainCounts(tc.spec, existing)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(faultDomainCount).To(Equal(tc.expectedFaultDomainCount))
+				g.Expect(updateDomainCount).To(Equal(tc.expectedUpdateDomainCount))
+			}
+		})
+	}
+}
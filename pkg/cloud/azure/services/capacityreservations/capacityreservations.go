@@ -0,0 +1,74 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityreservations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+)
+
+// Spec input specification for Get calls
+type Spec struct {
+	// GroupID is the resource ID of the capacity reservation group.
+	GroupID string
+}
+
+// Get returns the capacity reservations of the capacity reservation group as a []compute.CapacityReservation.
+func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
+	capacityReservationsSpec, ok := spec.(*Spec)
+	if !ok {
+		return nil, errors.New("invalid capacity reservation specification")
+	}
+
+	group, err := autorestazure.ParseResourceID(capacityReservationsSpec.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse capacity reservation group ID %s: %w", capacityReservationsSpec.GroupID, err)
+	}
+
+	client := getCapacityReservationsClient(s.Scope.ResourceManagerEndpoint, group.SubscriptionID, s.Scope.Authorizer)
+	iter, err := client.ListByCapacityReservationGroupComplete(ctx, group.ResourceGroup, group.ResourceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capacity reservations of group %s: %w", capacityReservationsSpec.GroupID, err)
+	}
+
+	reservations := []compute.CapacityReservation{}
+	for iter.NotDone() {
+		reservations = append(reservations, iter.Value())
+		if err := iter.NextWithContext(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list capacity reservations of group %s: %w", capacityReservationsSpec.GroupID, err)
+		}
+	}
+
+	return reservations, nil
+}
+
+// CreateOrUpdate no-op.
+func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since capacity reservations are managed by the user
+	return nil
+}
+
+// Delete no-op.
+func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since capacity reservations are managed by the user
+	return nil
+}
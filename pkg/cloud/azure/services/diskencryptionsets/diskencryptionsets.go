@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskencryptionsets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+)
+
+// Spec input specification for Get calls
+type Spec struct {
+	// ID is the resource ID of the disk encryption set.
+	ID string
+}
+
+// Get returns the disk encryption set as a compute.DiskEncryptionSet.
+func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
+	diskEncryptionSetSpec, ok := spec.(*Spec)
+	if !ok {
+		return nil, errors.New("invalid disk encryption set specification")
+	}
+
+	id, err := autorestazure.ParseResourceID(diskEncryptionSetSpec.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse disk encryption set ID %s: %w", diskEncryptionSetSpec.ID, err)
+	}
+
+	client := getDiskEncryptionSetsClient(s.Scope.ResourceManagerEndpoint, id.SubscriptionID, s.Scope.Authorizer)
+	diskEncryptionSet, err := client.Get(ctx, id.ResourceGroup, id.ResourceName)
+	if err != nil && azure.ResourceNotFound(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get disk encryption set %s: %w", diskEncryptionSetSpec.ID, err)
+	}
+
+	return diskEncryptionSet, nil
+}
+
+// CreateOrUpdate no-op.
+func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since disk encryption sets are managed by the user
+	return nil
+}
+
+// Delete no-op.
+func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since disk encryption sets are managed by the user
+	return nil
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package diskencryptionsets
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+)
+
+// Service provides operations on disk encryption sets
+type Service struct {
+	Scope *actuators.MachineScope
+}
+
+// getDiskEncryptionSetsClient creates a new disk encryption sets client from subscriptionid.
+// Disk encryption sets can live in another subscription, so the client is created
+// for the subscription of the disk encryption set rather than the one of the machine.
+func getDiskEncryptionSetsClient(resourceManagerEndpoint, subscriptionID string, authorizer autorest.Authorizer) compute.DiskEncryptionSetsClient {
+	diskEncryptionSetsClient := compute.NewDiskEncryptionSetsClientWithBaseURI(resourceManagerEndpoint, subscriptionID)
+	diskEncryptionSetsClient.Authorizer = authorizer
+	diskEncryptionSetsClient.AddToUserAgent(azure.UserAgent)
+	return diskEncryptionSetsClient
+}
+
+// NewService creates a new disk encryption sets service.
+func NewService(scope *actuators.MachineScope) azure.Service {
+	return &Service{
+		Scope: scope,
+	}
+}
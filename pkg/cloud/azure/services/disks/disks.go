@@ -22,6 +22,8 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"k8s.io/klog/v2"
 )
@@ -29,32 +31,148 @@ import (
 // Spec specification for disk
 type Spec struct {
 	Name string
+	// ResourceGroup of the disk to get or delete, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
-// Get on disk is currently no-op. OS disks should only be deleted and will create with the VM automatically.
+// ExistingDiskSpec specification for getting an existing disk, which is attached to a VM instead of created with it.
+type ExistingDiskSpec struct {
+	// ID is the resource ID of the disk.
+	ID string
+}
+
+// PerformanceSpec specification for the provisioned performance of an ultra disk.
+type PerformanceSpec struct {
+	Name string
+	IOPS int64
+	MBps int64
+	// ResourceGroup of the disk, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// BurstingSpec specification for the on-demand bursting of a premium disk.
+type BurstingSpec struct {
+	Name    string
+	Enabled bool
+	// ResourceGroup of the disk, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// Get returns the disk as a compute.Disk, from the resource group of the machine for a Spec and by resource ID
+// for an ExistingDiskSpec. It is a no-op for other specs, as disks are created with the VM automatically.
 func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
-	return compute.Disk{}, nil
+	if diskSpec, ok := spec.(*Spec); ok {
+		resourceGroup := s.Scope.MachineConfig.ResourceGroup
+		if diskSpec.ResourceGroup != "" {
+			resourceGroup = diskSpec.ResourceGroup
+		}
+		disk, err := s.Client.Get(ctx, resourceGroup, diskSpec.Name)
+		if err != nil && azure.ResourceNotFound(err) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get disk %s in resource group %s: %w", diskSpec.Name, resourceGroup, err)
+		}
+		return disk, nil
+	}
+
+	existingDiskSpec, ok := spec.(*ExistingDiskSpec)
+	if !ok {
+		return compute.Disk{}, nil
+	}
+
+	id, err := autorestazure.ParseResourceID(existingDiskSpec.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse disk ID %s: %w", existingDiskSpec.ID, err)
+	}
+
+	disk, err := s.Client.Get(ctx, id.ResourceGroup, id.ResourceName)
+	if err != nil && azure.ResourceNotFound(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get disk %s: %w", existingDiskSpec.ID, err)
+	}
+
+	return disk, nil
 }
 
-// CreateOrUpdate on disk is currently no-op. OS disks should only be deleted and will create with the VM automatically.
+// CreateOrUpdate on disk is a no-op unless the spec is a PerformanceSpec or a BurstingSpec, as disks are created
+// with the VM automatically. A disk is updated only when it differs from the requested spec,
+// and disks which do not exist yet are skipped until the VM creates them.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	switch diskSpec := spec.(type) {
+	case *PerformanceSpec:
+		return s.update(ctx, diskSpec.Name, diskSpec.ResourceGroup, func(properties *compute.DiskProperties) bool {
+			return to.Int64(properties.DiskIOPSReadWrite) == diskSpec.IOPS && to.Int64(properties.DiskMBpsReadWrite) == diskSpec.MBps
+		}, &compute.DiskUpdateProperties{
+			DiskIOPSReadWrite: to.Int64Ptr(diskSpec.IOPS),
+			DiskMBpsReadWrite: to.Int64Ptr(diskSpec.MBps),
+		})
+	case *BurstingSpec:
+		return s.update(ctx, diskSpec.Name, diskSpec.ResourceGroup, func(properties *compute.DiskProperties) bool {
+			return to.Bool(properties.BurstingEnabled) == diskSpec.Enabled
+		}, &compute.DiskUpdateProperties{
+			BurstingEnabled: to.BoolPtr(diskSpec.Enabled),
+		})
+	}
+	return nil
+}
+
+// update updates the disk with the given properties unless it is already up to date. The disk is looked up
+// in the resource group of the machine when the resource group is empty.
+func (s *Service) update(ctx context.Context, name, resourceGroup string, upToDate func(*compute.DiskProperties) bool, properties *compute.DiskUpdateProperties) error {
+	log := klog.FromContext(ctx)
+	if resourceGroup == "" {
+		resourceGroup = s.Scope.MachineConfig.ResourceGroup
+	}
+	disk, err := s.Client.Get(ctx, resourceGroup, name)
+	if err != nil && azure.ResourceNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get disk %s in resource group %s: %w", name, resourceGroup, err)
+	}
+
+	if disk.DiskProperties != nil && upToDate(disk.DiskProperties) {
+		return nil
+	}
+
+	log.V(2).Info("updating disk", "name", name)
+	future, err := s.Client.Update(ctx, resourceGroup, name, compute.DiskUpdate{
+		DiskUpdateProperties: properties,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update disk %s in resource group %s: %w", name, resourceGroup, err)
+	}
+
+	// Do not wait until the operation completes. Just check the result
+	// so the call to Update actuator operation is async.
+	_, err = future.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	log.V(2).Info("successfully updated disk", "name", name)
 	return nil
 }
 
 // Delete deletes the disk associated with a VM.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	diskSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid disk specification")
 	}
-	klog.V(2).Infof("deleting disk %s", diskSpec.Name)
-	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, diskSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if diskSpec.ResourceGroup != "" {
+		resourceGroup = diskSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting disk", "name", diskSpec.Name)
+	future, err := s.Client.Delete(ctx, resourceGroup, diskSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete disk %s in resource group %s: %w", diskSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete disk %s in resource group %s: %w", diskSpec.Name, resourceGroup, err)
 	}
 
 	// Do not wait until the operation completes. Just check the result
@@ -63,6 +181,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted disk %s", diskSpec.Name)
+	log.V(2).Info("successfully deleted disk", "name", diskSpec.Name)
 	return err
 }
@@ -26,9 +26,25 @@ import (
 	"k8s.io/klog/v2"
 )
 
-// Get on disk is currently no-op. OS disks should only be deleted and will create with the VM automatically.
+// Get returns the disk of a Spec from the resource group of the machine as a compute.Disk. It is a no-op
+// for other specs, as disks are created with the VM automatically.
 func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
-	return compute.Disk{}, nil
+	diskSpec, ok := spec.(*Spec)
+	if !ok {
+		return compute.Disk{}, nil
+	}
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if diskSpec.ResourceGroup != "" {
+		resourceGroup = diskSpec.ResourceGroup
+	}
+
+	disk, err := s.Client.Get(ctx, resourceGroup, diskSpec.Name)
+	if err != nil && azure.ResourceNotFound(err) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get disk %s in resource group %s: %w", diskSpec.Name, resourceGroup, err)
+	}
+	return disk, nil
 }
 
 // CreateOrUpdate on disk is currently no-op. OS disks should only be deleted and will create with the VM automatically.
@@ -38,18 +54,23 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 
 // Delete deletes the disk associated with a VM.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	diskSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid disk specification")
 	}
-	klog.V(2).Infof("deleting disk %s", diskSpec.Name)
-	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, diskSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if diskSpec.ResourceGroup != "" {
+		resourceGroup = diskSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting disk", "name", diskSpec.Name)
+	future, err := s.Client.Delete(ctx, resourceGroup, diskSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete disk %s in resource group %s: %w", diskSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete disk %s in resource group %s: %w", diskSpec.Name, resourceGroup, err)
 	}
 
 	// Do not wait until the operation completes. Just check the result
@@ -58,6 +79,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted disk %s", diskSpec.Name)
+	log.V(2).Info("successfully deleted disk", "name", diskSpec.Name)
 	return err
 }
@@ -36,16 +36,18 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a resource group.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
-	klog.V(2).Infof("creating resource group %s", s.Scope.MachineConfig.ResourceGroup)
+	log := klog.FromContext(ctx)
+	log.V(2).Info("creating resource group", "name", s.Scope.MachineConfig.ResourceGroup)
 	_, err := s.Client.CreateOrUpdate(ctx, s.Scope.MachineConfig.ResourceGroup, resources.Group{
 		Location: to.StringPtr(s.Scope.MachineConfig.Location), Tags: s.Scope.Tags})
-	klog.V(2).Infof("successfully created resource group %s", s.Scope.MachineConfig.ResourceGroup)
+	log.V(2).Info("successfully created resource group", "name", s.Scope.MachineConfig.ResourceGroup)
 	return err
 }
 
 // Delete deletes the resource group with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
-	klog.V(2).Infof("deleting resource group %s", s.Scope.MachineConfig.ResourceGroup)
+	log := klog.FromContext(ctx)
+	log.V(2).Info("deleting resource group", "name", s.Scope.MachineConfig.ResourceGroup)
 	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, MicroSoftComputeVirtualMachines)
 	if err != nil {
 		return fmt.Errorf("failed to delete resource group %s: %w", s.Scope.MachineConfig.ResourceGroup, err)
@@ -58,6 +60,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 
 	_, err = future.Result(s.Client)
 
-	klog.V(2).Infof("successfully deleted resource group %s", s.Scope.MachineConfig.ResourceGroup)
+	log.V(2).Info("successfully deleted resource group", "name", s.Scope.MachineConfig.ResourceGroup)
 	return err
 }
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	latestImageVersion = "latest"
+	managedImageType   = "Microsoft.Compute/images"
+)
+
+// Spec input specification for Get calls
+type Spec struct {
+	// Image is either a marketplace image or a managed image referenced by its resource ID.
+	Image machinev1.Image
+}
+
+// Get returns the logical unit numbers of the data disks of the image as a []int32.
+func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
+	imageSpec, ok := spec.(*Spec)
+	if !ok {
+		return nil, errors.New("invalid image specification")
+	}
+
+	if imageSpec.Image.ResourceID != "" {
+		return s.getManagedImageDataDiskLuns(ctx, imageSpec.Image.ResourceID)
+	}
+	return s.getMarketplaceImageDataDiskLuns(ctx, imageSpec.Image)
+}
+
+// getMarketplaceImageDataDiskLuns returns the data disk LUNs of a marketplace image,
+// resolving the latest version of the image when no specific version is requested.
+func (s *Service) getMarketplaceImageDataDiskLuns(ctx context.Context, image machinev1.Image) ([]int32, error) {
+	client := getVirtualMachineImagesClient(s.Scope.ResourceManagerEndpoint, s.Scope.SubscriptionID, s.Scope.Authorizer)
+	location := s.Scope.MachineConfig.Location
+
+	version := image.Version
+	if version == "" || strings.EqualFold(version, latestImageVersion) {
+		versions, err := client.List(ctx, location, image.Publisher, image.Offer, image.SKU, "", ptr.To[int32](1), "name desc")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of image %s:%s:%s: %w", image.Publisher, image.Offer, image.SKU, err)
+		}
+		if versions.Value == nil || len(*versions.Value) == 0 {
+			return nil, machinecontroller.InvalidMachineConfiguration("image %s:%s:%s has no version in location %s", image.Publisher, image.Offer, image.SKU, location)
+		}
+		version = ptr.Deref((*versions.Value)[0].Name, "")
+	}
+
+	vmImage, err := client.Get(ctx, location, image.Publisher, image.Offer, image.SKU, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image %s:%s:%s:%s: %w", image.Publisher, image.Offer, image.SKU, version, err)
+	}
+
+	luns := []int32{}
+	if vmImage.VirtualMachineImageProperties != nil && vmImage.DataDiskImages != nil {
+		for _, disk := range *vmImage.DataDiskImages {
+			if disk.Lun != nil {
+				luns = append(luns, *disk.Lun)
+			}
+		}
+	}
+	return luns, nil
+}
+
+// getManagedImageDataDiskLuns returns the data disk LUNs of a managed image.
+func (s *Service) getManagedImageDataDiskLuns(ctx context.Context, resourceID string) ([]int32, error) {
+	id, err := autorestazure.ParseResourceID(fullResourceID(s.Scope.SubscriptionID, resourceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image ID %s: %w", resourceID, err)
+	}
+	if !strings.EqualFold(id.Provider+"/"+id.ResourceType, managedImageType) {
+		return nil, machinecontroller.InvalidMachineConfiguration("image %s is not a marketplace or managed image, its data disks can not be looked up", resourceID)
+	}
+
+	client := getImagesClient(s.Scope.ResourceManagerEndpoint, id.SubscriptionID, s.Scope.Authorizer)
+	image, err := client.Get(ctx, id.ResourceGroup, id.ResourceName, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image %s: %w", resourceID, err)
+	}
+
+	luns := []int32{}
+	if image.ImageProperties != nil && image.StorageProfile != nil && image.StorageProfile.DataDisks != nil {
+		for _, disk := range *image.StorageProfile.DataDisks {
+			if disk.Lun != nil {
+				luns = append(luns, *disk.Lun)
+			}
+		}
+	}
+	return luns, nil
+}
+
+// fullResourceID prefixes the subscription to image IDs given relative to it,
+// the same way as the image reference of the virtual machine is generated.
+func fullResourceID(subscriptionID, resourceID string) string {
+	if strings.HasPrefix(strings.ToLower(resourceID), "/subscriptions/") {
+		return resourceID
+	}
+	return fmt.Sprintf("/subscriptions/%s%s", subscriptionID, resourceID)
+}
+
+// CreateOrUpdate no-op.
+func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since images are managed by the user
+	return nil
+}
+
+// Delete no-op.
+func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since images are managed by the user
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFullResourceID(t *testing.T) {
+	const subscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	testCases := []struct {
+		name       string
+		resourceID string
+		expectedID string
+	}{
+		{
+			name:       "Full resource ID",
+			resourceID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+			expectedID: "/subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+		},
+		{
+			name:       "Resource ID relative to the subscription",
+			resourceID: "/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+			expectedID: "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+		},
+		{
+			name:       "Resource ID with upper case prefix",
+			resourceID: "/Subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+			expectedID: "/Subscriptions/11111111-1111-1111-1111-111111111111/resourceGroups/images-rg/providers/Microsoft.Compute/images/image",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(fullResourceID(subscriptionID, tc.resourceID)).To(Equal(tc.expectedID))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+)
+
+// Service provides operations on marketplace and managed images
+type Service struct {
+	Scope *actuators.MachineScope
+}
+
+// getVirtualMachineImagesClient creates a new marketplace images client from subscriptionid.
+func getVirtualMachineImagesClient(resourceManagerEndpoint, subscriptionID string, authorizer autorest.Authorizer) compute.VirtualMachineImagesClient {
+	imagesClient := compute.NewVirtualMachineImagesClientWithBaseURI(resourceManagerEndpoint, subscriptionID)
+	imagesClient.Authorizer = authorizer
+	imagesClient.AddToUserAgent(azure.UserAgent)
+	return imagesClient
+}
+
+// getImagesClient creates a new managed images client from subscriptionid.
+// Managed images can live in another subscription, so the client is created
+// for the subscription of the image rather than the one of the machine.
+func getImagesClient(resourceManagerEndpoint, subscriptionID string, authorizer autorest.Authorizer) compute.ImagesClient {
+	imagesClient := compute.NewImagesClientWithBaseURI(resourceManagerEndpoint, subscriptionID)
+	imagesClient.Authorizer = authorizer
+	imagesClient.AddToUserAgent(azure.UserAgent)
+	return imagesClient
+}
+
+// NewService creates a new images service.
+func NewService(scope *actuators.MachineScope) azure.Service {
+	return &Service{
+		Scope: scope,
+	}
+}
@@ -34,6 +34,8 @@ type Spec struct {
 	SubnetName string
 	VnetName   string
 	IPAddress  string
+	// ResourceGroup of the load balancer, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
 // Get provides information about a route table.
@@ -43,7 +45,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 		return network.LoadBalancer{}, errors.New("invalid internal load balancer specification")
 	}
 	//lbName := fmt.Sprintf("%s-api-internallb", s.Scope.Cluster.Name)
-	lb, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, internalLBSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if internalLBSpec.ResourceGroup != "" {
+		resourceGroup = internalLBSpec.ResourceGroup
+	}
+	lb, err := s.Client.Get(ctx, resourceGroup, internalLBSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("load balancer %s not found: %w", internalLBSpec.Name, err)
 	} else if err != nil {
@@ -54,18 +60,19 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	internalLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid internal load balancer specification")
 	}
-	klog.V(2).Infof("creating internal load balancer %s", internalLBSpec.Name)
+	log.V(2).Info("creating internal load balancer", "name", internalLBSpec.Name)
 	probeName := "tcpHTTPSProbe"
 	frontEndIPConfigName := "controlplane-internal-lbFrontEnd"
 	backEndAddressPoolName := "controlplane-internal-backEndPool"
 	idPrefix := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers", s.Scope.SubscriptionID, s.Scope.MachineConfig.ResourceGroup)
 	lbName := internalLBSpec.Name
 
-	klog.V(2).Infof("getting subnet %s", internalLBSpec.SubnetName)
+	log.V(2).Info("getting subnet", "name", internalLBSpec.SubnetName)
 	subnetInterface, err := subnets.NewService(s.Scope).Get(ctx, &subnets.Spec{Name: internalLBSpec.SubnetName, VnetName: internalLBSpec.VnetName})
 	if err != nil {
 		return err
@@ -75,7 +82,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if !ok {
 		return errors.New("subnet Get returned invalid interface")
 	}
-	klog.V(2).Infof("successfully got subnet %s", internalLBSpec.SubnetName)
+	log.V(2).Info("successfully got subnet", "name", internalLBSpec.SubnetName)
 
 	// https://docs.microsoft.com/en-us/azure/load-balancer/load-balancer-standard-availability-zones#zone-redundant-by-default
 	future, err := s.Client.CreateOrUpdate(ctx,
@@ -147,17 +154,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	}
 
 	_, err = future.Result(s.Client)
-	klog.V(2).Infof("successfully created internal load balancer %s", internalLBSpec.Name)
+	log.V(2).Info("successfully created internal load balancer", "name", internalLBSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	internalLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid internal load balancer specification")
 	}
-	klog.V(2).Infof("deleting internal load balancer %s", internalLBSpec.Name)
+	log.V(2).Info("deleting internal load balancer", "name", internalLBSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, internalLBSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -176,6 +184,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted internal load balancer %s", internalLBSpec.Name)
+	log.V(2).Info("successfully deleted internal load balancer", "name", internalLBSpec.Name)
 	return err
 }
@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marketplace
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+)
+
+// agreementsAPIVersion is the version of the marketplace ordering API used to get agreements.
+const agreementsAPIVersion = "2021-01-01"
+
+// agreement is the agreement of the subscription to the terms of a marketplace image plan.
+type agreement struct {
+	Properties agreementProperties `json:"properties"`
+}
+
+// agreementProperties are the properties of an agreement.
+type agreementProperties struct {
+	// Accepted is set when the terms of the plan are accepted for the subscription.
+	Accepted bool `json:"accepted"`
+}
+
+// Client gets the agreements of the subscription to the terms of marketplace image plans.
+type Client interface {
+	TermsAccepted(ctx context.Context, publisher, offer, plan string) (bool, error)
+}
+
+// AzureClient gets agreements from the marketplace ordering API, which the vendored Azure SDK has no client for.
+type AzureClient struct {
+	client         autorest.Client
+	baseURI        string
+	subscriptionID string
+}
+
+var _ Client = &AzureClient{}
+
+// NewClient creates a new marketplace agreements client from subscription ID.
+func NewClient(azureClients actuators.AzureClients) *AzureClient {
+	client := autorest.NewClientWithUserAgent(azure.UserAgent)
+	client.Authorizer = azureClients.Authorizer
+	return &AzureClient{
+		client:         client,
+		baseURI:        azureClients.ResourceManagerEndpoint,
+		subscriptionID: azureClients.SubscriptionID,
+	}
+}
+
+// TermsAccepted returns whether the terms of a marketplace image plan are accepted for the subscription.
+func (ac *AzureClient) TermsAccepted(ctx context.Context, publisher, offer, plan string) (bool, error) {
+	result := agreement{}
+	pathParameters := map[string]interface{}{
+		"offerId":        autorest.Encode("path", offer),
+		"planId":         autorest.Encode("path", plan),
+		"publisherId":    autorest.Encode("path", publisher),
+		"subscriptionId": autorest.Encode("path", ac.subscriptionID),
+	}
+	queryParameters := map[string]interface{}{
+		"api-version": agreementsAPIVersion,
+	}
+
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(ac.baseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/providers/Microsoft.MarketplaceOrdering/offerTypes/virtualmachine/publishers/{publisherId}/offers/{offerId}/plans/{planId}/agreements/current", pathParameters),
+		autorest.WithQueryParameters(queryParameters))
+	if err != nil {
+		return false, autorest.NewErrorWithError(err, "marketplace.AzureClient", "TermsAccepted", nil, "Failure preparing request")
+	}
+
+	resp, err := ac.client.Send(req, autorestazure.DoRetryWithRegistration(ac.client))
+	if err != nil {
+		return false, autorest.NewErrorWithError(err, "marketplace.AzureClient", "TermsAccepted", resp, "Failure sending request")
+	}
+
+	err = autorest.Respond(resp,
+		autorestazure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&result),
+		autorest.ByClosing())
+	if err != nil {
+		return false, autorest.NewErrorWithError(err, "marketplace.AzureClient", "TermsAccepted", resp, "Failure responding to request")
+	}
+	return result.Properties.Accepted, nil
+}
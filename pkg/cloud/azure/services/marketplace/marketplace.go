@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+)
+
+// Spec input specification for Get calls.
+type Spec struct {
+	Publisher string
+	Offer     string
+	Plan      string
+}
+
+// Get returns whether the terms of the marketplace image plan of the spec are accepted for the subscription as a bool.
+func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error) {
+	planSpec, ok := spec.(*Spec)
+	if !ok {
+		return nil, errors.New("invalid marketplace specification")
+	}
+
+	accepted, err := s.Client.TermsAccepted(ctx, planSpec.Publisher, planSpec.Offer, planSpec.Plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the agreement to the terms of plan %s:%s:%s: %w", planSpec.Publisher, planSpec.Offer, planSpec.Plan, err)
+	}
+	return accepted, nil
+}
+
+// CreateOrUpdate no-op.
+func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since the terms are accepted by the user
+	return nil
+}
+
+// Delete no-op.
+func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	// Not implemented since the terms are accepted by the user
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	. "github.com/onsi/gomega"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/marketplace/mock_marketplace"
+	"go.uber.org/mock/gomock"
+)
+
+func TestGet(t *testing.T) {
+	testCases := []struct {
+		name          string
+		accepted      bool
+		agreementErr  error
+		expected      bool
+		expectedError error
+	}{
+		{
+			name:     "Accepted terms",
+			accepted: true,
+			expected: true,
+		},
+		{
+			name:     "Terms not accepted",
+			accepted: false,
+			expected: false,
+		},
+		{
+			name:          "Failure to get the agreement",
+			agreementErr:  errors.New("boom"),
+			expectedError: fmt.Errorf("failed to get the agreement to the terms of plan publisher:offer:plan: %w", errors.New("boom")),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+			client := mock_marketplace.NewMockClient(mockCtrl)
+			client.EXPECT().TermsAccepted(gomock.Any(), "publisher", "offer", "plan").Return(tc.accepted, tc.agreementErr).Times(1)
+
+			s := &Service{Client: client}
+			accepted, err := s.Get(context.TODO(), &Spec{Publisher: "publisher", Offer: "offer", Plan: "plan"})
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(accepted).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestTermsAccepted(t *testing.T) {
+	const agreementPath = "/subscriptions/sub/providers/Microsoft.MarketplaceOrdering/offerTypes/virtualmachine/publishers/publisher/offers/offer/plans/plan/agreements/current"
+
+	testCases := []struct {
+		name               string
+		statusCode         int
+		body               string
+		expectedAccepted   bool
+		expectedStatusCode int
+	}{
+		{
+			name:             "Accepted terms",
+			statusCode:       http.StatusOK,
+			body:             `{"name":"plan","properties":{"publisher":"publisher","product":"offer","plan":"plan","accepted":true}}`,
+			expectedAccepted: true,
+		},
+		{
+			name:             "Terms not accepted",
+			statusCode:       http.StatusOK,
+			body:             `{"name":"plan","properties":{"publisher":"publisher","product":"offer","plan":"plan","accepted":false}}`,
+			expectedAccepted: false,
+		},
+		{
+			name:               "Unknown plan",
+			statusCode:         http.StatusNotFound,
+			body:               `{"error":{"code":"ResourceNotFound","message":"plan not found"}}`,
+			expectedStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				g.Expect(r.Method).To(Equal(http.MethodGet))
+				g.Expect(r.URL.Path).To(Equal(agreementPath))
+				g.Expect(r.URL.Query().Get("api-version")).To(Equal(agreementsAPIVersion))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.statusCode)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(actuators.AzureClients{
+				SubscriptionID:          "sub",
+				ResourceManagerEndpoint: server.URL,
+				Authorizer:              autorest.NullAuthorizer{},
+			})
+			accepted, err := client.TermsAccepted(context.TODO(), "publisher", "offer", "plan")
+			if tc.expectedStatusCode != 0 {
+				detailedErr := autorest.DetailedError{}
+				g.Expect(errors.As(err, &detailedErr)).To(BeTrue())
+				g.Expect(detailedErr.StatusCode).To(Equal(tc.expectedStatusCode))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(accepted).To(Equal(tc.expectedAccepted))
+		})
+	}
+}
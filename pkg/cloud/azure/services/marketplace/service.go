@@ -0,0 +1,36 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package marketplace
+
+import (
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+)
+
+// Service provides operations on the agreements to the terms of marketplace image plans.
+type Service struct {
+	Client Client
+	Scope  *actuators.MachineScope
+}
+
+// NewService creates a new marketplace service.
+func NewService(scope *actuators.MachineScope) azure.Service {
+	return &Service{
+		Client: NewClient(scope.AzureClients),
+		Scope:  scope,
+	}
+}
@@ -20,11 +20,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest"
 	"github.com/Azure/go-autorest/autorest/to"
 	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/applicationsecuritygroups"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/internalloadbalancers"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/publicips"
@@ -38,9 +44,12 @@ import (
 
 // Spec specification for networkinterface
 type Spec struct {
-	Name                          string
-	SubnetName                    string
-	VnetName                      string
+	Name       string
+	SubnetName string
+	VnetName   string
+	// VnetResourceGroup is the resource group of the virtual network of the subnet, the network resource group
+	// of the machine is used when empty.
+	VnetResourceGroup             string
 	StaticIPAddress               string
 	PublicLoadBalancerName        string
 	InternalLoadBalancerName      string
@@ -49,6 +58,44 @@ type Spec struct {
 	SecurityGroupName             string
 	ApplicationSecurityGroupNames []string
 	AcceleratedNetworking         bool
+	// SecondaryIPCount is the number of secondary IPv4 configurations with a dynamically allocated private IP.
+	SecondaryIPCount int
+	// SecondaryIPAddresses are the private IPv4 addresses of secondary IP configurations with a static allocation.
+	SecondaryIPAddresses []string
+	// ResourceGroup of the network interface, the resource group of the machine is used when empty.
+	ResourceGroup string
+	// StaticIPIndex selects the static private IP of the primary IP configuration by its index in
+	// StaticIPRange, or in the IPv4 address space of the subnet when StaticIPRange is empty.
+	StaticIPIndex *int
+	// StaticIPRange is a CIDR range within the subnet StaticIPIndex is counted from.
+	StaticIPRange string
+	// DNSServers are the IP addresses of the DNS servers of the network interface, the DNS servers of
+	// the virtual network are used when empty.
+	DNSServers []string
+	// IPForwarding enables IP forwarding on the network interface.
+	IPForwarding bool
+}
+
+// SecurityGroupsSpec specification for the security groups of an existing network interface.
+// The network security group is detached from the network interface when SecurityGroupName is empty.
+type SecurityGroupsSpec struct {
+	Name                          string
+	SecurityGroupName             string
+	ApplicationSecurityGroupNames []string
+}
+
+// AcceleratedNetworkingSpec specification for the accelerated networking of an existing network interface.
+type AcceleratedNetworkingSpec struct {
+	Name    string
+	Enabled bool
+}
+
+// ReprovisionSpec specification to write an existing network interface again as it is, which makes Azure
+// retry its provisioning.
+type ReprovisionSpec struct {
+	Name string
+	// ResourceGroup of the network interface, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
 // Get provides information about a network interface.
@@ -57,7 +104,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return network.Interface{}, errors.New("invalid network interface specification")
 	}
-	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, nicSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nicSpec.ResourceGroup != "" {
+		resourceGroup = nicSpec.ResourceGroup
+	}
+	nic, err := s.Client.Get(ctx, resourceGroup, nicSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("network interface %s not found: %w", nicSpec.Name, err)
 	} else if err != nil {
@@ -68,23 +119,53 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a network interface.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
+	if sgSpec, ok := spec.(*SecurityGroupsSpec); ok {
+		return s.updateSecurityGroups(ctx, sgSpec)
+	}
+
+	if anSpec, ok := spec.(*AcceleratedNetworkingSpec); ok {
+		return s.updateAcceleratedNetworking(ctx, anSpec)
+	}
+
+	if rpSpec, ok := spec.(*ReprovisionSpec); ok {
+		return s.reprovision(ctx, rpSpec)
+	}
+
 	nicSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid network interface specification")
 	}
 
-	subnetInterface, err := subnets.NewService(s.Scope).Get(ctx, &subnets.Spec{Name: nicSpec.SubnetName, VnetName: nicSpec.VnetName})
+	subnet, err := s.getSubnet(ctx, nicSpec)
 	if err != nil {
 		return err
 	}
+	nicHasIPv6 := subnetHasIPv6(subnet)
 
-	subnet, ok := subnetInterface.(network.Subnet)
-	if !ok {
-		return errors.New("subnet get returned invalid network interface")
+	staticIPAddress, err := ResolveStaticIPAddress(nicSpec, subnetPrefixes(subnet))
+	if err != nil {
+		return err
+	}
+	if staticIPAddress != nicSpec.StaticIPAddress {
+		// Secondary private IPs are checked against the resolved address, work on a copy of the spec.
+		resolvedSpec := *nicSpec
+		resolvedSpec.StaticIPAddress = staticIPAddress
+		nicSpec = &resolvedSpec
+	}
+
+	secondaryIPConfigs, err := generateSecondaryIPConfigurations(nicSpec, subnet)
+	if err != nil {
+		return err
 	}
-	nicHasIPv6 := subnetHasIPv6(subnet)
 
 	nicProp := network.InterfacePropertiesFormat{}
+	if len(nicSpec.DNSServers) > 0 {
+		nicProp.DNSSettings = &network.InterfaceDNSSettings{DNSServers: to.StringSlicePtr(nicSpec.DNSServers)}
+	}
+	if nicSpec.IPForwarding {
+		nicProp.EnableIPForwarding = to.BoolPtr(true)
+	}
 
 	skuService := resourceskus.NewService(s.Scope)
 	skuSpec := resourceskus.Spec{
@@ -107,7 +188,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		if !sku.HasCapability(resourceskus.AcceleratedNetworking) {
 			return errors.New("accelerated networking not supported on instance type " + s.Scope.MachineConfig.VMSize)
 		}
-		klog.V(4).Infof("setting EnableAcceleratedNetworking to %v", s.Scope.MachineConfig.AcceleratedNetworking)
+		log.V(4).Info("setting EnableAcceleratedNetworking", "enabled", s.Scope.MachineConfig.AcceleratedNetworking)
 		nicProp.EnableAcceleratedNetworking = to.BoolPtr(s.Scope.MachineConfig.AcceleratedNetworking)
 	}
 	nicConfig := &network.InterfaceIPConfigurationPropertiesFormat{}
@@ -117,7 +198,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	nicConfig.PrivateIPAllocationMethod = network.IPAllocationMethodDynamic
 	nicConfig.LoadBalancerInboundNatRules = &[]network.InboundNatRule{}
 	if nicHasIPv6 {
-		klog.V(2).Infof("Found IPv6 address space. Adding IPv6 configuration to nic: %s", nicSpec.Name)
+		log.V(2).Info("found IPv6 address space, adding IPv6 configuration to nic", "name", nicSpec.Name)
 		nicConfigV6.Subnet = &network.Subnet{ID: subnet.ID}
 		nicConfigV6.PrivateIPAllocationMethod = network.IPAllocationMethodDynamic
 		nicConfigV6.PrivateIPAddressVersion = network.IPVersionIPv6
@@ -148,10 +229,8 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 			return errors.New("public ip get returned invalid network interface")
 		}
 
-		if ip.PublicIPAddressPropertiesFormat.PublicIPAddressVersion == network.IPVersionIPv6 {
-			nicConfigV6.PublicIPAddress = &ip
-		} else {
-			nicConfig.PublicIPAddress = &ip
+		if err := attachPublicIP(ip, nicConfig, nicConfigV6, nicHasIPv6); err != nil {
+			return err
 		}
 	}
 
@@ -159,7 +238,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	backendAddressPools := []network.BackendAddressPool{}
 	backendAddressPoolsV6 := []network.BackendAddressPool{}
 	if nicSpec.PublicLoadBalancerName != "" {
-		lbInterface, lberr := publicloadbalancers.NewService(s.Scope).Get(ctx, &publicloadbalancers.Spec{Name: nicSpec.PublicLoadBalancerName})
+		lbInterface, lberr := getNetworkResource(ctx, s.Scope, s.publicLoadBalancersSvc, func(resourceGroup string) azure.Spec {
+			return &publicloadbalancers.Spec{Name: nicSpec.PublicLoadBalancerName, ResourceGroup: resourceGroup}
+		})
 		if lberr != nil {
 			return lberr
 		}
@@ -168,6 +249,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		if !ok {
 			return errors.New("public load balancer get returned invalid network interface")
 		}
+		if err := validateLoadBalancerVnet(nicSpec.PublicLoadBalancerName, to.String(subnet.ID), loadBalancerNetworkIDs(lb)); err != nil {
+			return err
+		}
 
 		loadBalancerInboundNatRules := []network.InboundNatRule{}
 		loadBalancerInboundNatRulesV6 := []network.InboundNatRule{}
@@ -207,7 +291,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 
 	}
 	if nicSpec.InternalLoadBalancerName != "" {
-		internallbInterface, ilberr := internalloadbalancers.NewService(s.Scope).Get(ctx, &internalloadbalancers.Spec{Name: nicSpec.InternalLoadBalancerName})
+		internallbInterface, ilberr := getNetworkResource(ctx, s.Scope, s.internalLoadBalancersSvc, func(resourceGroup string) azure.Spec {
+			return &internalloadbalancers.Spec{Name: nicSpec.InternalLoadBalancerName, ResourceGroup: resourceGroup}
+		})
 		if ilberr != nil {
 			return ilberr
 		}
@@ -216,6 +302,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		if !ok {
 			return errors.New("internal load balancer get returned invalid network interface")
 		}
+		if err := validateLoadBalancerVnet(nicSpec.InternalLoadBalancerName, to.String(subnet.ID), loadBalancerNetworkIDs(internallb)); err != nil {
+			return err
+		}
 		// loadbalancers can have multiple frontends and backends with different IP families
 		for i, ipConfig := range *internallb.FrontendIPConfigurations {
 			// iterate only for the frontends that have backends configured
@@ -241,35 +330,16 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	}
 
 	// security groups
-	if nicSpec.SecurityGroupName != "" {
-		securityGroupInterface, sgerr := securitygroups.NewService(s.Scope).Get(ctx, &securitygroups.Spec{Name: nicSpec.SecurityGroupName})
-		if sgerr != nil {
-			return sgerr
-		}
-
-		sg, ok := securityGroupInterface.(network.SecurityGroup)
-		if !ok {
-			return errors.New("security group get returned invalid network interface")
-		}
-		nicProp.NetworkSecurityGroup = &network.SecurityGroup{ID: sg.ID}
+	securityGroup, err := s.getSecurityGroup(ctx, nicSpec.SecurityGroupName)
+	if err != nil {
+		return err
 	}
+	nicProp.NetworkSecurityGroup = securityGroup
 
 	if len(nicSpec.ApplicationSecurityGroupNames) > 0 {
-		asgSvc := applicationsecuritygroups.NewService(s.Scope)
-
-		var groups []network.ApplicationSecurityGroup
-		for _, asgName := range nicSpec.ApplicationSecurityGroupNames {
-			asgInterface, asgerr := asgSvc.Get(ctx, &applicationsecuritygroups.Spec{Name: asgName})
-			if err != nil {
-				return asgerr
-			}
-			asg, ok := asgInterface.(network.ApplicationSecurityGroup)
-			if !ok {
-				return errors.New("application security group get returned invalid network interface")
-			}
-			groups = append(groups, network.ApplicationSecurityGroup{
-				ID: asg.ID,
-			})
+		groups, err := s.getApplicationSecurityGroups(ctx, nicSpec.ApplicationSecurityGroupNames)
+		if err != nil {
+			return err
 		}
 		nicConfig.ApplicationSecurityGroups = &groups
 	}
@@ -293,6 +363,13 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		nicProp.IPConfigurations = &ipConfigs
 	}
 
+	if len(secondaryIPConfigs) > 0 {
+		log.V(2).Info("adding secondary IP configurations to nic", "name", nicSpec.Name, "count", len(secondaryIPConfigs))
+		nicConfig.Primary = to.BoolPtr(true)
+		ipConfigs := append(*nicProp.IPConfigurations, secondaryIPConfigs...)
+		nicProp.IPConfigurations = &ipConfigs
+	}
+
 	f, err := s.Client.CreateOrUpdate(ctx,
 		s.Scope.MachineConfig.ResourceGroup,
 		nicSpec.Name,
@@ -315,24 +392,272 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created network interface %s", nicSpec.Name)
+	log.V(2).Info("successfully created network interface", "name", nicSpec.Name)
 	return err
 }
 
+// updateSecurityGroups attaches the network security group and the application security groups
+// of the spec to an existing network interface, detaching any other one.
+func (s *Service) updateSecurityGroups(ctx context.Context, sgSpec *SecurityGroupsSpec) error {
+	log := klog.FromContext(ctx)
+	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, sgSpec.Name, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s: %w", sgSpec.Name, err)
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil || len(*nic.IPConfigurations) == 0 {
+		return fmt.Errorf("network interface %s has no IP configurations", sgSpec.Name)
+	}
+
+	securityGroup, err := s.getSecurityGroup(ctx, sgSpec.SecurityGroupName)
+	if err != nil {
+		return err
+	}
+
+	groups, err := s.getApplicationSecurityGroups(ctx, sgSpec.ApplicationSecurityGroupNames)
+	if err != nil {
+		return err
+	}
+
+	nic.NetworkSecurityGroup = securityGroup
+	ipConfig := &(*nic.IPConfigurations)[primaryIPConfigurationIndex(*nic.IPConfigurations)]
+	if ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+		ipConfig.InterfaceIPConfigurationPropertiesFormat = &network.InterfaceIPConfigurationPropertiesFormat{}
+	}
+	ipConfig.ApplicationSecurityGroups = &groups
+
+	f, err := s.Client.CreateOrUpdate(ctx, s.Scope.MachineConfig.ResourceGroup, sgSpec.Name, nic)
+	if err != nil {
+		return fmt.Errorf("failed to update network interface %s in resource group %s: %w", sgSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+	}
+
+	err = f.WaitForCompletionRef(ctx, s.Client.Client)
+	if err != nil {
+		return fmt.Errorf("cannot update, future response: %w", err)
+	}
+
+	_, err = f.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	log.V(2).Info("successfully updated security groups of network interface", "name", sgSpec.Name)
+	return nil
+}
+
+// updateAcceleratedNetworking enables or disables accelerated networking on an existing network interface.
+func (s *Service) updateAcceleratedNetworking(ctx context.Context, anSpec *AcceleratedNetworkingSpec) error {
+	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, anSpec.Name, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s: %w", anSpec.Name, err)
+	}
+	if nic.InterfacePropertiesFormat == nil {
+		return fmt.Errorf("network interface %s has no properties", anSpec.Name)
+	}
+
+	nic.EnableAcceleratedNetworking = to.BoolPtr(anSpec.Enabled)
+
+	f, err := s.Client.CreateOrUpdate(ctx, s.Scope.MachineConfig.ResourceGroup, anSpec.Name, nic)
+	if err != nil {
+		return fmt.Errorf("failed to update network interface %s in resource group %s: %w", anSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+	}
+
+	err = f.WaitForCompletionRef(ctx, s.Client.Client)
+	if err != nil {
+		return fmt.Errorf("cannot update, future response: %w", err)
+	}
+
+	_, err = f.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	klog.FromContext(ctx).V(2).Info("successfully set accelerated networking of network interface", "name", anSpec.Name, "enabled", anSpec.Enabled)
+	return nil
+}
+
+// reprovision writes an existing network interface again as it is.
+func (s *Service) reprovision(ctx context.Context, rpSpec *ReprovisionSpec) error {
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if rpSpec.ResourceGroup != "" {
+		resourceGroup = rpSpec.ResourceGroup
+	}
+
+	nic, err := s.Client.Get(ctx, resourceGroup, rpSpec.Name, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s: %w", rpSpec.Name, err)
+	}
+
+	f, err := s.Client.CreateOrUpdate(ctx, resourceGroup, rpSpec.Name, nic)
+	if err != nil {
+		return fmt.Errorf("failed to update network interface %s in resource group %s: %w", rpSpec.Name, resourceGroup, err)
+	}
+
+	err = f.WaitForCompletionRef(ctx, s.Client.Client)
+	if err != nil {
+		return fmt.Errorf("cannot update, future response: %w", err)
+	}
+
+	_, err = f.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	klog.FromContext(ctx).V(2).Info("successfully reprovisioned network interface", "name", rpSpec.Name)
+	return nil
+}
+
+// getSubnet returns the subnet of the network interface from its virtual network.
+func (s *Service) getSubnet(ctx context.Context, nicSpec *Spec) (network.Subnet, error) {
+	subnetInterface, err := s.subnetsSvc.Get(ctx, &subnets.Spec{Name: nicSpec.SubnetName, VnetName: nicSpec.VnetName, ResourceGroup: nicSpec.VnetResourceGroup})
+	if err != nil {
+		return network.Subnet{}, err
+	}
+
+	subnet, ok := subnetInterface.(network.Subnet)
+	if !ok {
+		return network.Subnet{}, errors.New("subnet get returned invalid network interface")
+	}
+	return subnet, nil
+}
+
+// validateLoadBalancerVnet makes sure the load balancer with the given name is in the virtual network of the subnet
+// of the network interface, Azure requires the members of the backend pools of a load balancer to share its virtual
+// network. The network IDs are the resource IDs of the subnets and virtual networks referenced by the load balancer,
+// a load balancer referencing none, such as a public load balancer with empty backend pools, is accepted.
+func validateLoadBalancerVnet(name, subnetID string, networkIDs []string) error {
+	vnetID := vnetIDOf(subnetID)
+	for _, id := range networkIDs {
+		if lbVnetID := vnetIDOf(id); lbVnetID != vnetID {
+			return machinecontroller.InvalidMachineConfiguration("load balancer %s is in virtual network %q, not in virtual network %q of the network interface",
+				name, lbVnetID, vnetID)
+		}
+	}
+	return nil
+}
+
+// vnetIDOf returns the lower case resource ID of the virtual network of the given subnet or virtual network resource ID.
+func vnetIDOf(id string) string {
+	id = strings.ToLower(strings.TrimSuffix(id, "/"))
+	if i := strings.Index(id, "/subnets/"); i >= 0 {
+		return id[:i]
+	}
+	return id
+}
+
+// loadBalancerNetworkIDs returns the resource IDs of the subnets of the frontends of the load balancer, and of
+// the subnets and virtual networks of the addresses of its backend pools.
+func loadBalancerNetworkIDs(lb network.LoadBalancer) []string {
+	var ids []string
+	if lb.LoadBalancerPropertiesFormat == nil {
+		return ids
+	}
+	if lb.FrontendIPConfigurations != nil {
+		for _, frontend := range *lb.FrontendIPConfigurations {
+			if frontend.FrontendIPConfigurationPropertiesFormat != nil && frontend.Subnet != nil && frontend.Subnet.ID != nil {
+				ids = append(ids, *frontend.Subnet.ID)
+			}
+		}
+	}
+	if lb.BackendAddressPools == nil {
+		return ids
+	}
+	for _, pool := range *lb.BackendAddressPools {
+		if pool.BackendAddressPoolPropertiesFormat == nil || pool.LoadBalancerBackendAddresses == nil {
+			continue
+		}
+		for _, address := range *pool.LoadBalancerBackendAddresses {
+			if address.LoadBalancerBackendAddressPropertiesFormat == nil {
+				continue
+			}
+			if address.VirtualNetwork != nil && address.VirtualNetwork.ID != nil {
+				ids = append(ids, *address.VirtualNetwork.ID)
+			}
+			if address.Subnet != nil && address.Subnet.ID != nil {
+				ids = append(ids, *address.Subnet.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// getNetworkResource gets a network resource referenced by the machine from the resource group of the machine,
+// falling back to the network resource group when the resource is not found there. The spec function returns the
+// specification of the resource in the provided resource group, the resource group of the machine when empty.
+func getNetworkResource(ctx context.Context, scope *actuators.MachineScope, svc azure.Service, spec func(resourceGroup string) azure.Spec) (interface{}, error) {
+	resource, err := svc.Get(ctx, spec(""))
+	if err == nil {
+		return resource, nil
+	}
+
+	networkResourceGroup := scope.MachineConfig.NetworkResourceGroup
+	if networkResourceGroup == "" || strings.EqualFold(networkResourceGroup, scope.MachineConfig.ResourceGroup) {
+		return resource, err
+	}
+	detailedErr := autorest.DetailedError{}
+	if !errors.As(err, &detailedErr) || detailedErr.StatusCode != http.StatusNotFound {
+		return resource, err
+	}
+
+	klog.FromContext(ctx).V(4).Info("looking up network resource in the network resource group", "networkResourceGroup", networkResourceGroup, "err", err)
+	return svc.Get(ctx, spec(networkResourceGroup))
+}
+
+// getSecurityGroup returns a reference to the network security group with the provided name,
+// or nil when the name is empty.
+func (s *Service) getSecurityGroup(ctx context.Context, name string) (*network.SecurityGroup, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	securityGroupInterface, err := getNetworkResource(ctx, s.Scope, s.securityGroupsSvc, func(resourceGroup string) azure.Spec {
+		return &securitygroups.Spec{Name: name, ResourceGroup: resourceGroup}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sg, ok := securityGroupInterface.(network.SecurityGroup)
+	if !ok {
+		return nil, errors.New("security group get returned invalid network interface")
+	}
+	return &network.SecurityGroup{ID: sg.ID}, nil
+}
+
+// getApplicationSecurityGroups returns references to the application security groups with the provided names.
+func (s *Service) getApplicationSecurityGroups(ctx context.Context, names []string) ([]network.ApplicationSecurityGroup, error) {
+	groups := []network.ApplicationSecurityGroup{}
+	for _, asgName := range names {
+		asgInterface, err := s.applicationSecurityGroupsSvc.Get(ctx, &applicationsecuritygroups.Spec{Name: asgName})
+		if err != nil {
+			return nil, err
+		}
+		asg, ok := asgInterface.(network.ApplicationSecurityGroup)
+		if !ok {
+			return nil, errors.New("application security group get returned invalid network interface")
+		}
+		groups = append(groups, network.ApplicationSecurityGroup{
+			ID: asg.ID,
+		})
+	}
+	return groups, nil
+}
+
 // Delete deletes the network interface with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nicSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid network interface Specification")
 	}
-	klog.V(2).Infof("deleting nic %s", nicSpec.Name)
-	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, nicSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nicSpec.ResourceGroup != "" {
+		resourceGroup = nicSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting nic", "name", nicSpec.Name)
+	f, err := s.Client.Delete(ctx, resourceGroup, nicSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete network interface %s in resource group %s: %w", nicSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete network interface %s in resource group %s: %w", nicSpec.Name, resourceGroup, err)
 	}
 
 	err = f.WaitForCompletionRef(ctx, s.Client.Client)
@@ -344,11 +669,183 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted nic %s", nicSpec.Name)
+	log.V(2).Info("successfully deleted nic", "name", nicSpec.Name)
 	return err
 }
 
-func subnetHasIPv6(subnet network.Subnet) bool {
+// generateSecondaryIPConfigurations returns the secondary IPv4 configurations of the network interface,
+// the ones with a static private IP first, followed by the ones with a dynamically allocated private IP.
+func generateSecondaryIPConfigurations(nicSpec *Spec, subnet network.Subnet) ([]network.InterfaceIPConfiguration, error) {
+	if nicSpec.SecondaryIPCount < 0 {
+		return nil, machinecontroller.InvalidMachineConfiguration("invalid number of secondary IP configurations: %d", nicSpec.SecondaryIPCount)
+	}
+
+	if err := validateSecondaryIPAddresses(nicSpec, subnet); err != nil {
+		return nil, err
+	}
+
+	ipConfigs := []network.InterfaceIPConfiguration{}
+	newIPConfig := func(allocationMethod network.IPAllocationMethod, address *string) {
+		ipConfigs = append(ipConfigs, network.InterfaceIPConfiguration{
+			Name: to.StringPtr(fmt.Sprintf("pipConfig-secondary-%d", len(ipConfigs)+1)),
+			InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+				Subnet:                    &network.Subnet{ID: subnet.ID},
+				Primary:                   to.BoolPtr(false),
+				PrivateIPAddressVersion:   network.IPVersionIPv4,
+				PrivateIPAllocationMethod: allocationMethod,
+				PrivateIPAddress:          address,
+			},
+		})
+	}
+
+	for _, address := range nicSpec.SecondaryIPAddresses {
+		newIPConfig(network.IPAllocationMethodStatic, to.StringPtr(address))
+	}
+	for i := 0; i < nicSpec.SecondaryIPCount; i++ {
+		newIPConfig(network.IPAllocationMethodDynamic, nil)
+	}
+
+	return ipConfigs, nil
+}
+
+// validateSecondaryIPAddresses makes sure the static secondary private IPs are IPv4 addresses
+// of the subnet, distinct from each other and from the static primary private IP.
+func validateSecondaryIPAddresses(nicSpec *Spec, subnet network.Subnet) error {
+	if len(nicSpec.SecondaryIPAddresses) == 0 {
+		return nil
+	}
+
+	var subnetCIDRs []*net.IPNet
+	for _, prefix := range subnetPrefixes(subnet) {
+		if _, cidr, err := net.ParseCIDR(prefix); err == nil && utilnet.IsIPv4CIDR(cidr) {
+			subnetCIDRs = append(subnetCIDRs, cidr)
+		}
+	}
+
+	seen := map[string]bool{}
+	if nicSpec.StaticIPAddress != "" {
+		seen[net.ParseIP(nicSpec.StaticIPAddress).String()] = true
+	}
+
+	for _, address := range nicSpec.SecondaryIPAddresses {
+		ip := net.ParseIP(address)
+		if ip == nil || !utilnet.IsIPv4(ip) {
+			return machinecontroller.InvalidMachineConfiguration("secondary private IP %q is not an IPv4 address", address)
+		}
+
+		inSubnet := false
+		for _, cidr := range subnetCIDRs {
+			if cidr.Contains(ip) {
+				inSubnet = true
+				break
+			}
+		}
+		if !inSubnet {
+			return machinecontroller.InvalidMachineConfiguration("secondary private IP %s is not within subnet %s", address, nicSpec.SubnetName)
+		}
+
+		if seen[ip.String()] {
+			return machinecontroller.InvalidMachineConfiguration("secondary private IP %s is assigned more than once", address)
+		}
+		seen[ip.String()] = true
+	}
+
+	return nil
+}
+
+// ResolveStaticIPAddress returns the static private IP of the primary IP configuration, either the
+// address set explicitly or the one at StaticIPIndex, after making sure it is a usable address of the
+// subnet address prefixes. An empty address is returned when the private IP is dynamically allocated.
+func ResolveStaticIPAddress(nicSpec *Spec, prefixes []string) (string, error) {
+	if nicSpec.StaticIPAddress == "" && nicSpec.StaticIPIndex == nil {
+		if nicSpec.StaticIPRange != "" {
+			return "", machinecontroller.InvalidMachineConfiguration("static private IP range %s requires an index", nicSpec.StaticIPRange)
+		}
+		return "", nil
+	}
+
+	if nicSpec.StaticIPAddress != "" && nicSpec.StaticIPIndex != nil {
+		return "", machinecontroller.InvalidMachineConfiguration("static private IP %s and static private IP index %d are mutually exclusive",
+			nicSpec.StaticIPAddress, *nicSpec.StaticIPIndex)
+	}
+
+	var subnetCIDRs []*net.IPNet
+	for _, prefix := range prefixes {
+		if _, cidr, err := net.ParseCIDR(prefix); err == nil {
+			subnetCIDRs = append(subnetCIDRs, cidr)
+		}
+	}
+	subnetCIDRFor := func(ip net.IP) *net.IPNet {
+		for _, cidr := range subnetCIDRs {
+			if cidr.Contains(ip) {
+				return cidr
+			}
+		}
+		return nil
+	}
+
+	var ip net.IP
+	if nicSpec.StaticIPAddress != "" {
+		ip = net.ParseIP(nicSpec.StaticIPAddress)
+		if ip == nil {
+			return "", machinecontroller.InvalidMachineConfiguration("static private IP %q is not a valid IP address", nicSpec.StaticIPAddress)
+		}
+	} else {
+		var ipRange *net.IPNet
+		if nicSpec.StaticIPRange != "" {
+			_, cidr, err := net.ParseCIDR(nicSpec.StaticIPRange)
+			if err != nil {
+				return "", machinecontroller.InvalidMachineConfiguration("invalid static private IP range %q: %v", nicSpec.StaticIPRange, err)
+			}
+			subnetCIDR := subnetCIDRFor(cidr.IP)
+			rangeOnes, rangeBits := cidr.Mask.Size()
+			subnetOnes, subnetBits := 0, 0
+			if subnetCIDR != nil {
+				subnetOnes, subnetBits = subnetCIDR.Mask.Size()
+			}
+			if subnetCIDR == nil || rangeBits != subnetBits || rangeOnes < subnetOnes {
+				return "", machinecontroller.InvalidMachineConfiguration("static private IP range %s is not within subnet %s", cidr, nicSpec.SubnetName)
+			}
+			ipRange = cidr
+		} else {
+			for _, cidr := range subnetCIDRs {
+				if utilnet.IsIPv4CIDR(cidr) {
+					ipRange = cidr
+					break
+				}
+			}
+			if ipRange == nil {
+				return "", machinecontroller.InvalidMachineConfiguration("subnet %s has no IPv4 address space to select static private IP index %d from",
+					nicSpec.SubnetName, *nicSpec.StaticIPIndex)
+			}
+		}
+
+		index := *nicSpec.StaticIPIndex
+		if index < 0 {
+			return "", machinecontroller.InvalidMachineConfiguration("static private IP index must not be negative, got %d", index)
+		}
+		indexedIP, err := utilnet.GetIndexedIP(ipRange, index)
+		if err != nil {
+			return "", machinecontroller.InvalidMachineConfiguration("static private IP index %d is out of range %s", index, ipRange)
+		}
+		ip = indexedIP
+	}
+
+	subnetCIDR := subnetCIDRFor(ip)
+	if subnetCIDR == nil {
+		return "", machinecontroller.InvalidMachineConfiguration("static private IP %s is not within subnet %s", ip, nicSpec.SubnetName)
+	}
+
+	// Azure reserves the first four addresses of each subnet prefix, and the broadcast address of IPv4 ones.
+	offset := new(big.Int).Sub(utilnet.BigForIP(ip), utilnet.BigForIP(subnetCIDR.IP))
+	if offset.Cmp(big.NewInt(4)) < 0 || (utilnet.IsIPv4(ip) && offset.Int64() == utilnet.RangeSize(subnetCIDR)-1) {
+		return "", machinecontroller.InvalidMachineConfiguration("static private IP %s is reserved by Azure in subnet %s", ip, nicSpec.SubnetName)
+	}
+
+	return ip.String(), nil
+}
+
+func subnetPrefixes(subnet network.Subnet) []string {
 	var prefixes []string
 
 	if subnet.AddressPrefix != nil {
@@ -359,10 +856,40 @@ func subnetHasIPv6(subnet network.Subnet) bool {
 		prefixes = append(prefixes, *subnet.AddressPrefixes...)
 	}
 
-	for _, prefix := range prefixes {
+	return prefixes
+}
+
+// attachPublicIP attaches the public IP to the IP configuration of its IP family. An IPv6 public IP
+// requires the IPv6 IP configuration, which only exists when the subnet has an IPv6 address space.
+func attachPublicIP(ip network.PublicIPAddress, nicConfig, nicConfigV6 *network.InterfaceIPConfigurationPropertiesFormat, nicHasIPv6 bool) error {
+	if ip.PublicIPAddressPropertiesFormat == nil || ip.PublicIPAddressVersion != network.IPVersionIPv6 {
+		nicConfig.PublicIPAddress = &ip
+		return nil
+	}
+
+	if !nicHasIPv6 {
+		return machinecontroller.InvalidMachineConfiguration("public ip %s is an IPv6 address but the subnet has no IPv6 address space", to.String(ip.Name))
+	}
+	nicConfigV6.PublicIPAddress = &ip
+	return nil
+}
+
+func subnetHasIPv6(subnet network.Subnet) bool {
+	for _, prefix := range subnetPrefixes(subnet) {
 		if utilnet.IsIPv6CIDRString(prefix) {
 			return true
 		}
 	}
 	return false
 }
+
+// primaryIPConfigurationIndex returns the index of the primary IP configuration,
+// the first one when none is flagged as primary.
+func primaryIPConfigurationIndex(ipConfigs []network.InterfaceIPConfiguration) int {
+	for i, ipConfig := range ipConfigs {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && to.Bool(ipConfig.Primary) {
+			return i
+		}
+	}
+	return 0
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/network/mgmt/network"
 	"github.com/Azure/go-autorest/autorest/to"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/applicationsecuritygroups"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/internalloadbalancers"
@@ -40,7 +41,11 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return network.Interface{}, errors.New("invalid network interface specification")
 	}
-	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, nicSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nicSpec.ResourceGroup != "" {
+		resourceGroup = nicSpec.ResourceGroup
+	}
+	nic, err := s.Client.Get(ctx, resourceGroup, nicSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("network interface %s not found: %w", nicSpec.Name, err)
 	} else if err != nil {
@@ -51,12 +56,21 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a network interface.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
+	if sgSpec, ok := spec.(*SecurityGroupsSpec); ok {
+		return s.updateSecurityGroups(ctx, sgSpec)
+	}
+
+	if rpSpec, ok := spec.(*ReprovisionSpec); ok {
+		return s.reprovision(ctx, rpSpec)
+	}
+
 	nicSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid network interface specification")
 	}
 
-	subnetInterface, err := subnets.NewService(s.Scope).Get(ctx, &subnets.Spec{Name: nicSpec.SubnetName, VnetName: nicSpec.VnetName})
+	subnetInterface, err := subnets.NewService(s.Scope).Get(ctx, &subnets.Spec{Name: nicSpec.SubnetName, VnetName: nicSpec.VnetName, ResourceGroup: nicSpec.VnetResourceGroup})
 	if err != nil {
 		return err
 	}
@@ -67,7 +81,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	}
 	nicHasIPv6 := subnetHasIPv6StackHub(subnet)
 
+	staticIPAddress, err := ResolveStaticIPAddress(nicSpec, subnetPrefixesStackHub(subnet))
+	if err != nil {
+		return err
+	}
+
 	nicProp := network.InterfacePropertiesFormat{}
+	if len(nicSpec.DNSServers) > 0 {
+		nicProp.DNSSettings = &network.InterfaceDNSSettings{DNSServers: to.StringSlicePtr(nicSpec.DNSServers)}
+	}
+	if nicSpec.IPForwarding {
+		nicProp.EnableIPForwarding = to.BoolPtr(true)
+	}
 	nicConfig := &network.InterfaceIPConfigurationPropertiesFormat{}
 	nicConfigV6 := &network.InterfaceIPConfigurationPropertiesFormat{}
 
@@ -75,7 +100,7 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	nicConfig.PrivateIPAllocationMethod = network.Dynamic
 	nicConfig.LoadBalancerInboundNatRules = &[]network.InboundNatRule{}
 	if nicHasIPv6 {
-		klog.V(2).Infof("Found IPv6 address space. Adding IPv6 configuration to nic: %s", nicSpec.Name)
+		log.V(2).Info("found IPv6 address space, adding IPv6 configuration to nic", "name", nicSpec.Name)
 		nicConfigV6.Subnet = &network.Subnet{ID: subnet.ID}
 		nicConfigV6.PrivateIPAllocationMethod = network.Dynamic
 		nicConfigV6.PrivateIPAddressVersion = network.IPv6
@@ -84,13 +109,13 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	}
 
 	// IP address allocation
-	if nicSpec.StaticIPAddress != "" {
-		if utilnet.IsIPv6String(nicSpec.StaticIPAddress) {
+	if staticIPAddress != "" {
+		if utilnet.IsIPv6String(staticIPAddress) {
 			nicConfigV6.PrivateIPAllocationMethod = network.Static
-			nicConfigV6.PrivateIPAddress = to.StringPtr(nicSpec.StaticIPAddress)
+			nicConfigV6.PrivateIPAddress = to.StringPtr(staticIPAddress)
 		} else {
 			nicConfig.PrivateIPAllocationMethod = network.Static
-			nicConfig.PrivateIPAddress = to.StringPtr(nicSpec.StaticIPAddress)
+			nicConfig.PrivateIPAddress = to.StringPtr(staticIPAddress)
 		}
 	}
 
@@ -107,6 +132,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		}
 
 		if ip.PublicIPAddressPropertiesFormat.PublicIPAddressVersion == network.IPv6 {
+			if !nicHasIPv6 {
+				return machinecontroller.InvalidMachineConfiguration("public ip %s is an IPv6 address but the subnet has no IPv6 address space", to.String(ip.Name))
+			}
 			nicConfigV6.PublicIPAddress = &ip
 		} else {
 			nicConfig.PublicIPAddress = &ip
@@ -117,7 +145,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	backendAddressPools := []network.BackendAddressPool{}
 	backendAddressPoolsV6 := []network.BackendAddressPool{}
 	if nicSpec.PublicLoadBalancerName != "" {
-		lbInterface, lberr := publicloadbalancers.NewService(s.Scope).Get(ctx, &publicloadbalancers.Spec{Name: nicSpec.PublicLoadBalancerName})
+		lbInterface, lberr := getNetworkResource(ctx, s.Scope, s.publicLoadBalancersSvc, func(resourceGroup string) azure.Spec {
+			return &publicloadbalancers.Spec{Name: nicSpec.PublicLoadBalancerName, ResourceGroup: resourceGroup}
+		})
 		if lberr != nil {
 			return lberr
 		}
@@ -126,6 +156,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		if !ok {
 			return errors.New("public load balancer get returned invalid network interface")
 		}
+		if err := validateLoadBalancerVnet(nicSpec.PublicLoadBalancerName, to.String(subnet.ID), loadBalancerNetworkIDsStackHub(lb)); err != nil {
+			return err
+		}
 
 		loadBalancerInboundNatRules := []network.InboundNatRule{}
 		loadBalancerInboundNatRulesV6 := []network.InboundNatRule{}
@@ -155,7 +188,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 
 	}
 	if nicSpec.InternalLoadBalancerName != "" {
-		internallbInterface, ilberr := internalloadbalancers.NewService(s.Scope).Get(ctx, &internalloadbalancers.Spec{Name: nicSpec.InternalLoadBalancerName})
+		internallbInterface, ilberr := getNetworkResource(ctx, s.Scope, s.internalLoadBalancersSvc, func(resourceGroup string) azure.Spec {
+			return &internalloadbalancers.Spec{Name: nicSpec.InternalLoadBalancerName, ResourceGroup: resourceGroup}
+		})
 		if ilberr != nil {
 			return ilberr
 		}
@@ -164,6 +199,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		if !ok {
 			return errors.New("internal load balancer get returned invalid network interface")
 		}
+		if err := validateLoadBalancerVnet(nicSpec.InternalLoadBalancerName, to.String(subnet.ID), loadBalancerNetworkIDsStackHub(internallb)); err != nil {
+			return err
+		}
 		// loadbalancers can have multiple frontends and backends with different IP families
 		// TODO: this logic is different in public azure, check that no functionality is broken by this
 		for i, _ := range *internallb.FrontendIPConfigurations {
@@ -184,35 +222,16 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	}
 
 	// security groups
-	if nicSpec.SecurityGroupName != "" {
-		securityGroupInterface, sgerr := securitygroups.NewService(s.Scope).Get(ctx, &securitygroups.Spec{Name: nicSpec.SecurityGroupName})
-		if sgerr != nil {
-			return sgerr
-		}
-
-		sg, ok := securityGroupInterface.(network.SecurityGroup)
-		if !ok {
-			return errors.New("security group get returned invalid network interface")
-		}
-		nicProp.NetworkSecurityGroup = &network.SecurityGroup{ID: sg.ID}
+	securityGroup, err := s.getSecurityGroup(ctx, nicSpec.SecurityGroupName)
+	if err != nil {
+		return err
 	}
+	nicProp.NetworkSecurityGroup = securityGroup
 
 	if len(nicSpec.ApplicationSecurityGroupNames) > 0 {
-		asgSvc := applicationsecuritygroups.NewService(s.Scope)
-
-		var groups []network.ApplicationSecurityGroup
-		for _, asgName := range nicSpec.ApplicationSecurityGroupNames {
-			asgInterface, asgerr := asgSvc.Get(ctx, &applicationsecuritygroups.Spec{Name: asgName})
-			if err != nil {
-				return asgerr
-			}
-			asg, ok := asgInterface.(network.ApplicationSecurityGroup)
-			if !ok {
-				return errors.New("application security group get returned invalid network interface")
-			}
-			groups = append(groups, network.ApplicationSecurityGroup{
-				ID: asg.ID,
-			})
+		groups, err := s.getApplicationSecurityGroups(ctx, nicSpec.ApplicationSecurityGroupNames)
+		if err != nil {
+			return err
 		}
 		nicConfig.ApplicationSecurityGroups = &groups
 	}
@@ -257,24 +276,141 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created network interface %s", nicSpec.Name)
+	log.V(2).Info("successfully created network interface", "name", nicSpec.Name)
 	return err
 }
 
+// updateSecurityGroups attaches the network security group and the application security groups
+// of the spec to an existing network interface, detaching any other one.
+func (s *StackHubService) updateSecurityGroups(ctx context.Context, sgSpec *SecurityGroupsSpec) error {
+	log := klog.FromContext(ctx)
+	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, sgSpec.Name, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s: %w", sgSpec.Name, err)
+	}
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil || len(*nic.IPConfigurations) == 0 {
+		return fmt.Errorf("network interface %s has no IP configurations", sgSpec.Name)
+	}
+
+	securityGroup, err := s.getSecurityGroup(ctx, sgSpec.SecurityGroupName)
+	if err != nil {
+		return err
+	}
+
+	groups, err := s.getApplicationSecurityGroups(ctx, sgSpec.ApplicationSecurityGroupNames)
+	if err != nil {
+		return err
+	}
+
+	nic.NetworkSecurityGroup = securityGroup
+	ipConfig := &(*nic.IPConfigurations)[primaryIPConfigurationIndexStackHub(*nic.IPConfigurations)]
+	if ipConfig.InterfaceIPConfigurationPropertiesFormat == nil {
+		ipConfig.InterfaceIPConfigurationPropertiesFormat = &network.InterfaceIPConfigurationPropertiesFormat{}
+	}
+	ipConfig.ApplicationSecurityGroups = &groups
+
+	f, err := s.Client.CreateOrUpdate(ctx, s.Scope.MachineConfig.ResourceGroup, sgSpec.Name, nic)
+	if err != nil {
+		return fmt.Errorf("failed to update network interface %s in resource group %s: %w", sgSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+	}
+
+	err = f.WaitForCompletionRef(ctx, s.Client.Client)
+	if err != nil {
+		return fmt.Errorf("cannot update, future response: %w", err)
+	}
+
+	_, err = f.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	log.V(2).Info("successfully updated security groups of network interface", "name", sgSpec.Name)
+	return nil
+}
+
+// reprovision writes an existing network interface of the resource group of the machine again as it is.
+func (s *StackHubService) reprovision(ctx context.Context, rpSpec *ReprovisionSpec) error {
+	nic, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, rpSpec.Name, "")
+	if err != nil {
+		return fmt.Errorf("failed to get network interface %s: %w", rpSpec.Name, err)
+	}
+
+	f, err := s.Client.CreateOrUpdate(ctx, s.Scope.MachineConfig.ResourceGroup, rpSpec.Name, nic)
+	if err != nil {
+		return fmt.Errorf("failed to update network interface %s in resource group %s: %w", rpSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+	}
+
+	err = f.WaitForCompletionRef(ctx, s.Client.Client)
+	if err != nil {
+		return fmt.Errorf("cannot update, future response: %w", err)
+	}
+
+	_, err = f.Result(s.Client)
+	if err != nil {
+		return fmt.Errorf("result error: %w", err)
+	}
+	klog.FromContext(ctx).V(2).Info("successfully reprovisioned network interface", "name", rpSpec.Name)
+	return nil
+}
+
+// getSecurityGroup returns a reference to the network security group with the provided name,
+// or nil when the name is empty.
+func (s *StackHubService) getSecurityGroup(ctx context.Context, name string) (*network.SecurityGroup, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	securityGroupInterface, err := getNetworkResource(ctx, s.Scope, s.securityGroupsSvc, func(resourceGroup string) azure.Spec {
+		return &securitygroups.Spec{Name: name, ResourceGroup: resourceGroup}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sg, ok := securityGroupInterface.(network.SecurityGroup)
+	if !ok {
+		return nil, errors.New("security group get returned invalid network interface")
+	}
+	return &network.SecurityGroup{ID: sg.ID}, nil
+}
+
+// getApplicationSecurityGroups returns references to the application security groups with the provided names.
+func (s *StackHubService) getApplicationSecurityGroups(ctx context.Context, names []string) ([]network.ApplicationSecurityGroup, error) {
+	groups := []network.ApplicationSecurityGroup{}
+	for _, asgName := range names {
+		asgInterface, err := s.applicationSecurityGroupsSvc.Get(ctx, &applicationsecuritygroups.Spec{Name: asgName})
+		if err != nil {
+			return nil, err
+		}
+		asg, ok := asgInterface.(network.ApplicationSecurityGroup)
+		if !ok {
+			return nil, errors.New("application security group get returned invalid network interface")
+		}
+		groups = append(groups, network.ApplicationSecurityGroup{
+			ID: asg.ID,
+		})
+	}
+	return groups, nil
+}
+
 // Delete deletes the network interface with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nicSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid network interface Specification")
 	}
-	klog.V(2).Infof("deleting nic %s", nicSpec.Name)
-	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, nicSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nicSpec.ResourceGroup != "" {
+		resourceGroup = nicSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting nic", "name", nicSpec.Name)
+	f, err := s.Client.Delete(ctx, resourceGroup, nicSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete network interface %s in resource group %s: %w", nicSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete network interface %s in resource group %s: %w", nicSpec.Name, resourceGroup, err)
 	}
 
 	err = f.WaitForCompletionRef(ctx, s.Client.Client)
@@ -286,11 +422,11 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted nic %s", nicSpec.Name)
+	log.V(2).Info("successfully deleted nic", "name", nicSpec.Name)
 	return err
 }
 
-func subnetHasIPv6StackHub(subnet network.Subnet) bool {
+func subnetPrefixesStackHub(subnet network.Subnet) []string {
 	var prefixes []string
 
 	// TODO: this logic is different in public azure, check that no functionality is broken by this
@@ -298,10 +434,39 @@ func subnetHasIPv6StackHub(subnet network.Subnet) bool {
 		prefixes = append(prefixes, *subnet.AddressPrefix)
 	}
 
-	for _, prefix := range prefixes {
+	return prefixes
+}
+
+// loadBalancerNetworkIDsStackHub returns the resource IDs of the subnets of the frontends of the load balancer.
+func loadBalancerNetworkIDsStackHub(lb network.LoadBalancer) []string {
+	var ids []string
+	if lb.LoadBalancerPropertiesFormat == nil || lb.FrontendIPConfigurations == nil {
+		return ids
+	}
+	for _, frontend := range *lb.FrontendIPConfigurations {
+		if frontend.FrontendIPConfigurationPropertiesFormat != nil && frontend.Subnet != nil && frontend.Subnet.ID != nil {
+			ids = append(ids, *frontend.Subnet.ID)
+		}
+	}
+	return ids
+}
+
+func subnetHasIPv6StackHub(subnet network.Subnet) bool {
+	for _, prefix := range subnetPrefixesStackHub(subnet) {
 		if utilnet.IsIPv6CIDRString(prefix) {
 			return true
 		}
 	}
 	return false
 }
+
+// primaryIPConfigurationIndexStackHub returns the index of the primary IP configuration,
+// the first one when none is flagged as primary.
+func primaryIPConfigurationIndexStackHub(ipConfigs []network.InterfaceIPConfiguration) int {
+	for i, ipConfig := range ipConfigs {
+		if ipConfig.InterfaceIPConfigurationPropertiesFormat != nil && to.Bool(ipConfig.Primary) {
+			return i
+		}
+	}
+	return 0
+}
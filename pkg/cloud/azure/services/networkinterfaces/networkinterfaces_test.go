@@ -0,0 +1,650 @@
+package networkinterfaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/go-logr/logr/funcr"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/gomega"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	machinecontroller "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	mock_azure "github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/mock"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/applicationsecuritygroups"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/securitygroups"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/subnets"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+func TestGenerateSecondaryIPConfigurations(t *testing.T) {
+	subnet := network.Subnet{
+		ID: to.StringPtr("subnet-ID"),
+		SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+			AddressPrefixes: &[]string{"10.0.0.0/24", "fd00::/64"},
+		},
+	}
+
+	ipConfig := func(name string, allocationMethod network.IPAllocationMethod, address *string) network.InterfaceIPConfiguration {
+		return network.InterfaceIPConfiguration{
+			Name: to.StringPtr(name),
+			InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+				Subnet:                    &network.Subnet{ID: subnet.ID},
+				Primary:                   to.BoolPtr(false),
+				PrivateIPAddressVersion:   network.IPVersionIPv4,
+				PrivateIPAllocationMethod: allocationMethod,
+				PrivateIPAddress:          address,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name              string
+		spec              *Spec
+		expectedIPConfigs []network.InterfaceIPConfiguration
+		expectedError     error
+	}{
+		{
+			name:              "No secondary IP configurations",
+			spec:              &Spec{},
+			expectedIPConfigs: []network.InterfaceIPConfiguration{},
+		},
+		{
+			name: "Dynamic secondary IP configurations",
+			spec: &Spec{SecondaryIPCount: 2},
+			expectedIPConfigs: []network.InterfaceIPConfiguration{
+				ipConfig("pipConfig-secondary-1", network.IPAllocationMethodDynamic, nil),
+				ipConfig("pipConfig-secondary-2", network.IPAllocationMethodDynamic, nil),
+			},
+		},
+		{
+			name: "Static and dynamic secondary IP configurations",
+			spec: &Spec{
+				StaticIPAddress:      "10.0.0.4",
+				SecondaryIPAddresses: []string{"10.0.0.10", "10.0.0.11"},
+				SecondaryIPCount:     1,
+			},
+			expectedIPConfigs: []network.InterfaceIPConfiguration{
+				ipConfig("pipConfig-secondary-1", network.IPAllocationMethodStatic, to.StringPtr("10.0.0.10")),
+				ipConfig("pipConfig-secondary-2", network.IPAllocationMethodStatic, to.StringPtr("10.0.0.11")),
+				ipConfig("pipConfig-secondary-3", network.IPAllocationMethodDynamic, nil),
+			},
+		},
+		{
+			name:          "Negative number of secondary IP configurations",
+			spec:          &Spec{SecondaryIPCount: -1},
+			expectedError: machinecontroller.InvalidMachineConfiguration("invalid number of secondary IP configurations: -1"),
+		},
+		{
+			name:          "Secondary IP outside of the subnet",
+			spec:          &Spec{SubnetName: "subnet", SecondaryIPAddresses: []string{"10.0.1.10"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("secondary private IP 10.0.1.10 is not within subnet subnet"),
+		},
+		{
+			name:          "IPv6 secondary IP",
+			spec:          &Spec{SecondaryIPAddresses: []string{"fd00::10"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("secondary private IP \"fd00::10\" is not an IPv4 address"),
+		},
+		{
+			name:          "Duplicated secondary IP",
+			spec:          &Spec{SecondaryIPAddresses: []string{"10.0.0.10", "10.0.0.10"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("secondary private IP 10.0.0.10 is assigned more than once"),
+		},
+		{
+			name:          "Secondary IP colliding with the primary IP",
+			spec:          &Spec{StaticIPAddress: "10.0.0.4", SecondaryIPAddresses: []string{"10.0.0.4"}},
+			expectedError: machinecontroller.InvalidMachineConfiguration("secondary private IP 10.0.0.4 is assigned more than once"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ipConfigs, err := generateSecondaryIPConfigurations(tc.spec, subnet)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(ipConfigs).To(Equal(tc.expectedIPConfigs))
+			}
+		})
+	}
+}
+
+func TestResolveStaticIPAddress(t *testing.T) {
+	prefixes := []string{"10.0.0.0/24", "fd00::/64"}
+
+	testCases := []struct {
+		name            string
+		spec            *Spec
+		prefixes        []string
+		expectedAddress string
+		expectedError   error
+	}{
+		{
+			name: "Dynamic private IP",
+			spec: &Spec{},
+		},
+		{
+			name:            "Static private IPv4 address",
+			spec:            &Spec{StaticIPAddress: "10.0.0.10"},
+			expectedAddress: "10.0.0.10",
+		},
+		{
+			name:            "Static private IPv6 address",
+			spec:            &Spec{StaticIPAddress: "FD00::10"},
+			expectedAddress: "fd00::10",
+		},
+		{
+			name:            "Static private IP index in the IPv4 address space of the subnet",
+			spec:            &Spec{StaticIPIndex: to.IntPtr(10)},
+			expectedAddress: "10.0.0.10",
+		},
+		{
+			name:            "Static private IP index in an IPv4 range",
+			spec:            &Spec{StaticIPIndex: to.IntPtr(10), StaticIPRange: "10.0.0.128/25"},
+			expectedAddress: "10.0.0.138",
+		},
+		{
+			name:            "Static private IP index in an IPv6 range",
+			spec:            &Spec{StaticIPIndex: to.IntPtr(16), StaticIPRange: "fd00::100/120"},
+			expectedAddress: "fd00::110",
+		},
+		{
+			name:          "Static private IPv4 address outside of the subnet",
+			spec:          &Spec{SubnetName: "subnet", StaticIPAddress: "10.0.1.10"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP 10.0.1.10 is not within subnet subnet"),
+		},
+		{
+			name:          "Static private IPv6 address outside of the subnet",
+			spec:          &Spec{SubnetName: "subnet", StaticIPAddress: "fd01::10"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP fd01::10 is not within subnet subnet"),
+		},
+		{
+			name:          "Static private IP range outside of the subnet",
+			spec:          &Spec{SubnetName: "subnet", StaticIPIndex: to.IntPtr(10), StaticIPRange: "10.0.0.0/16"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP range 10.0.0.0/16 is not within subnet subnet"),
+		},
+		{
+			name:          "Static private IP index out of the range",
+			spec:          &Spec{StaticIPIndex: to.IntPtr(128), StaticIPRange: "10.0.0.128/25"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP index 128 is out of range 10.0.0.128/25"),
+		},
+		{
+			name:          "Static private IP index without IPv4 address space",
+			spec:          &Spec{SubnetName: "subnet", StaticIPIndex: to.IntPtr(10)},
+			prefixes:      []string{"fd00::/64"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("subnet subnet has no IPv4 address space to select static private IP index 10 from"),
+		},
+		{
+			name:          "Static private IP range without an index",
+			spec:          &Spec{StaticIPRange: "10.0.0.128/25"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP range 10.0.0.128/25 requires an index"),
+		},
+		{
+			name:          "Static private IP address and index",
+			spec:          &Spec{StaticIPAddress: "10.0.0.10", StaticIPIndex: to.IntPtr(10)},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP 10.0.0.10 and static private IP index 10 are mutually exclusive"),
+		},
+		{
+			name:          "Reserved IPv4 network address",
+			spec:          &Spec{SubnetName: "subnet", StaticIPIndex: to.IntPtr(3)},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP 10.0.0.3 is reserved by Azure in subnet subnet"),
+		},
+		{
+			name:          "Reserved IPv4 broadcast address",
+			spec:          &Spec{SubnetName: "subnet", StaticIPAddress: "10.0.0.255"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP 10.0.0.255 is reserved by Azure in subnet subnet"),
+		},
+		{
+			name:          "Reserved IPv6 address",
+			spec:          &Spec{SubnetName: "subnet", StaticIPAddress: "fd00::1"},
+			expectedError: machinecontroller.InvalidMachineConfiguration("static private IP fd00::1 is reserved by Azure in subnet subnet"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			subnetPrefixes := prefixes
+			if tc.prefixes != nil {
+				subnetPrefixes = tc.prefixes
+			}
+
+			address, err := ResolveStaticIPAddress(tc.spec, subnetPrefixes)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+				g.Expect(address).To(Equal(tc.expectedAddress))
+			}
+		})
+	}
+}
+
+func TestPrimaryIPConfigurationIndex(t *testing.T) {
+	ipConfig := func(primary *bool) network.InterfaceIPConfiguration {
+		return network.InterfaceIPConfiguration{
+			InterfaceIPConfigurationPropertiesFormat: &network.InterfaceIPConfigurationPropertiesFormat{
+				Primary: primary,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		ipConfigs     []network.InterfaceIPConfiguration
+		expectedIndex int
+	}{
+		{
+			name:          "No primary IP configuration",
+			ipConfigs:     []network.InterfaceIPConfiguration{ipConfig(nil), ipConfig(to.BoolPtr(false))},
+			expectedIndex: 0,
+		},
+		{
+			name:          "Primary IP configuration",
+			ipConfigs:     []network.InterfaceIPConfiguration{ipConfig(to.BoolPtr(false)), ipConfig(to.BoolPtr(true))},
+			expectedIndex: 1,
+		},
+		{
+			name:          "IP configuration without properties",
+			ipConfigs:     []network.InterfaceIPConfiguration{{}, ipConfig(to.BoolPtr(true))},
+			expectedIndex: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(primaryIPConfigurationIndex(tc.ipConfigs)).To(Equal(tc.expectedIndex))
+		})
+	}
+}
+
+func TestGetApplicationSecurityGroups(t *testing.T) {
+	asgID := func(name string) *string {
+		return to.StringPtr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/applicationSecurityGroups/" + name)
+	}
+
+	t.Run("Application security groups are returned", func(t *testing.T) {
+		g := NewWithT(t)
+		mockCtrl := gomock.NewController(t)
+
+		asgSvc := mock_azure.NewMockService(mockCtrl)
+		asgSvc.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) (interface{}, error) {
+			name := spec.(*applicationsecuritygroups.Spec).Name
+			return network.ApplicationSecurityGroup{ID: asgID(name), Name: to.StringPtr(name)}, nil
+		}).Times(2)
+
+		s := &Service{applicationSecurityGroupsSvc: asgSvc}
+		groups, err := s.getApplicationSecurityGroups(context.TODO(), []string{"asg-a", "asg-b"})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(groups).To(Equal([]network.ApplicationSecurityGroup{{ID: asgID("asg-a")}, {ID: asgID("asg-b")}}))
+	})
+
+	for _, stackHub := range []bool{false, true} {
+		name := "Application security group lookup failure is returned"
+		if stackHub {
+			name += " on Azure Stack Hub"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			asgErr := errors.New("application security group asg-b not found")
+			asgSvc := mock_azure.NewMockService(mockCtrl)
+			asgSvc.EXPECT().Get(gomock.Any(), gomock.Any()).Return(nil, asgErr).Times(1)
+
+			var err error
+			if stackHub {
+				s := &StackHubService{applicationSecurityGroupsSvc: asgSvc}
+				_, err = s.getApplicationSecurityGroups(context.TODO(), []string{"asg-b", "asg-a"})
+			} else {
+				s := &Service{applicationSecurityGroupsSvc: asgSvc}
+				_, err = s.getApplicationSecurityGroups(context.TODO(), []string{"asg-b", "asg-a"})
+			}
+			g.Expect(err).To(MatchError(asgErr))
+		})
+	}
+}
+
+func TestAttachPublicIP(t *testing.T) {
+	publicIP := func(version network.IPVersion) network.PublicIPAddress {
+		return network.PublicIPAddress{
+			Name: to.StringPtr("pip"),
+			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
+				PublicIPAddressVersion: version,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		ip            network.PublicIPAddress
+		nicHasIPv6    bool
+		expectV4      bool
+		expectV6      bool
+		expectedError error
+	}{
+		{
+			name:     "IPv4 public IP is attached to the IPv4 configuration",
+			ip:       publicIP(network.IPVersionIPv4),
+			expectV4: true,
+		},
+		{
+			name:     "Public IP without properties is attached to the IPv4 configuration",
+			ip:       network.PublicIPAddress{Name: to.StringPtr("pip")},
+			expectV4: true,
+		},
+		{
+			name:       "IPv6 public IP is attached to the IPv6 configuration",
+			ip:         publicIP(network.IPVersionIPv6),
+			nicHasIPv6: true,
+			expectV6:   true,
+		},
+		{
+			name:          "IPv6 public IP is rejected without an IPv6 subnet",
+			ip:            publicIP(network.IPVersionIPv6),
+			expectedError: machinecontroller.InvalidMachineConfiguration("public ip pip is an IPv6 address but the subnet has no IPv6 address space"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			nicConfig := &network.InterfaceIPConfigurationPropertiesFormat{}
+			nicConfigV6 := &network.InterfaceIPConfigurationPropertiesFormat{}
+
+			err := attachPublicIP(tc.ip, nicConfig, nicConfigV6, tc.nicHasIPv6)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			if tc.expectV4 {
+				g.Expect(nicConfig.PublicIPAddress).To(Equal(&tc.ip))
+			} else {
+				g.Expect(nicConfig.PublicIPAddress).To(BeNil())
+			}
+			if tc.expectV6 {
+				g.Expect(nicConfigV6.PublicIPAddress).To(Equal(&tc.ip))
+			} else {
+				g.Expect(nicConfigV6.PublicIPAddress).To(BeNil())
+			}
+		})
+	}
+}
+
+func TestGetSecurityGroupFromNetworkResourceGroup(t *testing.T) {
+	nsgID := func(resourceGroup string) *string {
+		return to.StringPtr("/subscriptions/sub/resourceGroups/" + resourceGroup + "/providers/Microsoft.Network/networkSecurityGroups/nsg")
+	}
+	notFoundErr := fmt.Errorf("security group nsg not found: %w", autorest.DetailedError{StatusCode: http.StatusNotFound})
+
+	testCases := []struct {
+		name                   string
+		networkResourceGroup   string
+		machineGroupErr        error
+		expectedResourceGroups []string
+		expectedID             *string
+		expectedErr            error
+	}{
+		{
+			name:                   "Security group in the resource group of the machine",
+			networkResourceGroup:   "network-rg",
+			expectedResourceGroups: []string{""},
+			expectedID:             nsgID("machine-rg"),
+		},
+		{
+			name:                   "Security group in the network resource group",
+			networkResourceGroup:   "network-rg",
+			machineGroupErr:        notFoundErr,
+			expectedResourceGroups: []string{"", "network-rg"},
+			expectedID:             nsgID("network-rg"),
+		},
+		{
+			name:                   "Network resource group is the resource group of the machine",
+			networkResourceGroup:   "Machine-RG",
+			machineGroupErr:        notFoundErr,
+			expectedResourceGroups: []string{""},
+			expectedErr:            notFoundErr,
+		},
+		{
+			name:                   "Lookup failure other than not found is returned",
+			networkResourceGroup:   "network-rg",
+			machineGroupErr:        autorest.DetailedError{StatusCode: http.StatusForbidden},
+			expectedResourceGroups: []string{""},
+			expectedErr:            autorest.DetailedError{StatusCode: http.StatusForbidden},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			resourceGroups := []string{}
+			sgSvc := mock_azure.NewMockService(mockCtrl)
+			sgSvc.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) (interface{}, error) {
+				sgSpec := spec.(*securitygroups.Spec)
+				g.Expect(sgSpec.Name).To(Equal("nsg"))
+				resourceGroups = append(resourceGroups, sgSpec.ResourceGroup)
+				if sgSpec.ResourceGroup == "" {
+					if tc.machineGroupErr != nil {
+						return nil, tc.machineGroupErr
+					}
+					return network.SecurityGroup{ID: nsgID("machine-rg")}, nil
+				}
+				return network.SecurityGroup{ID: nsgID(sgSpec.ResourceGroup)}, nil
+			}).AnyTimes()
+
+			s := &Service{
+				Scope: &actuators.MachineScope{
+					MachineConfig: &machinev1.AzureMachineProviderSpec{
+						ResourceGroup:        "machine-rg",
+						NetworkResourceGroup: tc.networkResourceGroup,
+					},
+				},
+				securityGroupsSvc: sgSvc,
+			}
+			sg, err := s.getSecurityGroup(context.TODO(), "nsg")
+			g.Expect(resourceGroups).To(Equal(tc.expectedResourceGroups))
+			if tc.expectedErr != nil {
+				g.Expect(err).To(MatchError(tc.expectedErr))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(sg).To(Equal(&network.SecurityGroup{ID: tc.expectedID}))
+		})
+	}
+}
+
+func TestGetNetworkResourceLogContext(t *testing.T) {
+	g := NewWithT(t)
+	mockCtrl := gomock.NewController(t)
+
+	var lines []string
+	klog.SetLoggerWithOptions(funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{Verbosity: 4}), klog.ContextualLogger(true))
+	defer klog.ClearLogger()
+
+	sgSvc := mock_azure.NewMockService(mockCtrl)
+	sgSvc.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, spec azure.Spec) (interface{}, error) {
+		if spec.(*securitygroups.Spec).ResourceGroup == "" {
+			return nil, autorest.DetailedError{StatusCode: http.StatusNotFound}
+		}
+		return network.SecurityGroup{}, nil
+	}).Times(2)
+
+	scope := &actuators.MachineScope{
+		AzureClients: actuators.AzureClients{SubscriptionID: "sub"},
+		Machine: &machinev1.Machine{
+			ObjectMeta: metav1.ObjectMeta{Name: "machine", Namespace: "openshift-machine-api"},
+		},
+		MachineConfig: &machinev1.AzureMachineProviderSpec{
+			ResourceGroup:        "machine-rg",
+			NetworkResourceGroup: "network-rg",
+		},
+	}
+	s := &Service{Scope: scope, securityGroupsSvc: sgSvc}
+
+	_, err := s.getSecurityGroup(klog.NewContext(context.TODO(), scope.Logger()), "nsg")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(lines).To(HaveLen(1))
+	for _, keyValue := range []string{
+		`"msg"="looking up network resource in the network resource group"`,
+		`"machine"={"name"="machine" "namespace"="openshift-machine-api"}`,
+		`"subscriptionID"="sub"`,
+		`"resourceGroup"="machine-rg"`,
+		`"networkResourceGroup"="network-rg"`,
+	} {
+		g.Expect(strings.Contains(lines[0], keyValue)).To(BeTrue(), "expected %s in log line %s", keyValue, lines[0])
+	}
+}
+
+func TestGetSubnet(t *testing.T) {
+	subnetID := func(resourceGroup, vnet, subnet string) *string {
+		return to.StringPtr(fmt.Sprintf("/subscriptions/sub/resourceGroups/%s/providers/Microsoft.Network/virtualNetworks/%s/subnets/%s", resourceGroup, vnet, subnet))
+	}
+
+	testCases := []struct {
+		name         string
+		nicSpec      *Spec
+		expectedSpec *subnets.Spec
+		subnetID     *string
+	}{
+		{
+			name:         "Subnet in the vnet of the network resource group",
+			nicSpec:      &Spec{SubnetName: "subnet", VnetName: "vnet"},
+			expectedSpec: &subnets.Spec{Name: "subnet", VnetName: "vnet"},
+			subnetID:     subnetID("network-rg", "vnet", "subnet"),
+		},
+		{
+			name:         "Subnet in a vnet of another resource group",
+			nicSpec:      &Spec{SubnetName: "subnet", VnetName: "other-vnet", VnetResourceGroup: "other-rg"},
+			expectedSpec: &subnets.Spec{Name: "subnet", VnetName: "other-vnet", ResourceGroup: "other-rg"},
+			subnetID:     subnetID("Other-RG", "Other-Vnet", "subnet"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			mockCtrl := gomock.NewController(t)
+
+			subnetsSvc := mock_azure.NewMockService(mockCtrl)
+			subnetsSvc.EXPECT().Get(gomock.Any(), tc.expectedSpec).Return(network.Subnet{ID: tc.subnetID}, nil).Times(1)
+
+			scope := &actuators.MachineScope{
+				MachineConfig: &machinev1.AzureMachineProviderSpec{
+					ResourceGroup:        "machine-rg",
+					NetworkResourceGroup: "network-rg",
+				},
+			}
+			s := &Service{Scope: scope, subnetsSvc: subnetsSvc}
+
+			subnet, err := s.getSubnet(context.TODO(), tc.nicSpec)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(subnet.ID).To(Equal(tc.subnetID))
+		})
+	}
+}
+
+func TestValidateLoadBalancerVnet(t *testing.T) {
+	const (
+		vnetID      = "/subscriptions/sub/resourceGroups/network-rg/providers/Microsoft.Network/virtualNetworks/vnet"
+		otherVnetID = "/subscriptions/sub/resourceGroups/network-rg/providers/Microsoft.Network/virtualNetworks/other-vnet"
+		subnetID    = vnetID + "/subnets/subnet"
+	)
+
+	testCases := []struct {
+		name          string
+		lb            network.LoadBalancer
+		expectedError error
+	}{
+		{
+			name: "Load balancer referencing no virtual network",
+			lb: network.LoadBalancer{
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{},
+					}},
+				},
+			},
+		},
+		{
+			name: "Internal load balancer in another subnet of the virtual network",
+			lb: network.LoadBalancer{
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							Subnet: &network.Subnet{ID: to.StringPtr(strings.ToUpper(vnetID) + "/subnets/lb-subnet")},
+						},
+					}},
+				},
+			},
+		},
+		{
+			name: "Internal load balancer in another virtual network",
+			lb: network.LoadBalancer{
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					FrontendIPConfigurations: &[]network.FrontendIPConfiguration{{
+						FrontendIPConfigurationPropertiesFormat: &network.FrontendIPConfigurationPropertiesFormat{
+							Subnet: &network.Subnet{ID: to.StringPtr(otherVnetID + "/subnets/lb-subnet")},
+						},
+					}},
+				},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("load balancer %s is in virtual network %q, not in virtual network %q of the network interface",
+				"lb", strings.ToLower(otherVnetID), strings.ToLower(vnetID)),
+		},
+		{
+			name: "Load balancer with backend addresses in another virtual network",
+			lb: network.LoadBalancer{
+				LoadBalancerPropertiesFormat: &network.LoadBalancerPropertiesFormat{
+					BackendAddressPools: &[]network.BackendAddressPool{{
+						BackendAddressPoolPropertiesFormat: &network.BackendAddressPoolPropertiesFormat{
+							LoadBalancerBackendAddresses: &[]network.LoadBalancerBackendAddress{{
+								LoadBalancerBackendAddressPropertiesFormat: &network.LoadBalancerBackendAddressPropertiesFormat{
+									VirtualNetwork: &network.SubResource{ID: to.StringPtr(otherVnetID)},
+								},
+							}},
+						},
+					}},
+				},
+			},
+			expectedError: machinecontroller.InvalidMachineConfiguration("load balancer %s is in virtual network %q, not in virtual network %q of the network interface",
+				"lb", strings.ToLower(otherVnetID), strings.ToLower(vnetID)),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateLoadBalancerVnet("lb", subnetID, loadBalancerNetworkIDs(tc.lb))
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
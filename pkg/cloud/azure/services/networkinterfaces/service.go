@@ -21,12 +21,23 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/applicationsecuritygroups"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/internalloadbalancers"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/publicloadbalancers"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/securitygroups"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/subnets"
 )
 
 // Service provides operations on resource groups
 type Service struct {
 	Client network.InterfacesClient
 	Scope  *actuators.MachineScope
+
+	applicationSecurityGroupsSvc azure.Service
+	securityGroupsSvc            azure.Service
+	publicLoadBalancersSvc       azure.Service
+	internalLoadBalancersSvc     azure.Service
+	subnetsSvc                   azure.Service
 }
 
 // getGroupsClient creates a new groups client from subscriptionid.
@@ -44,7 +55,12 @@ func NewService(scope *actuators.MachineScope) azure.Service {
 	}
 
 	return &Service{
-		Client: getNetworkInterfacesClient(scope.ResourceManagerEndpoint, scope.SubscriptionID, scope.Authorizer),
-		Scope:  scope,
+		Client:                       getNetworkInterfacesClient(scope.ResourceManagerEndpoint, scope.SubscriptionID, scope.Authorizer),
+		Scope:                        scope,
+		applicationSecurityGroupsSvc: applicationsecuritygroups.NewService(scope),
+		securityGroupsSvc:            securitygroups.NewService(scope),
+		publicLoadBalancersSvc:       publicloadbalancers.NewService(scope),
+		internalLoadBalancersSvc:     internalloadbalancers.NewService(scope),
+		subnetsSvc:                   subnets.NewService(scope),
 	}
 }
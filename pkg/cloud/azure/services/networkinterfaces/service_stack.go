@@ -21,12 +21,21 @@ import (
 	"github.com/Azure/go-autorest/autorest"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/applicationsecuritygroups"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/internalloadbalancers"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/publicloadbalancers"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/securitygroups"
 )
 
 // StackHubService provides operations on resource groups
 type StackHubService struct {
 	Client network.InterfacesClient
 	Scope  *actuators.MachineScope
+
+	applicationSecurityGroupsSvc azure.Service
+	securityGroupsSvc            azure.Service
+	publicLoadBalancersSvc       azure.Service
+	internalLoadBalancersSvc     azure.Service
 }
 
 // getNetworkInterfacesClientStackHub creates a new groups client from subscriptionid.
@@ -40,7 +49,11 @@ func getNetworkInterfacesClientStackHub(resourceManagerEndpoint, subscriptionID
 // NewStackHubService creates a new groups service.
 func NewStackHubService(scope *actuators.MachineScope) azure.Service {
 	return &StackHubService{
-		Client: getNetworkInterfacesClientStackHub(scope.ResourceManagerEndpoint, scope.SubscriptionID, scope.Authorizer),
-		Scope:  scope,
+		Client:                       getNetworkInterfacesClientStackHub(scope.ResourceManagerEndpoint, scope.SubscriptionID, scope.Authorizer),
+		Scope:                        scope,
+		applicationSecurityGroupsSvc: applicationsecuritygroups.NewService(scope),
+		securityGroupsSvc:            securitygroups.NewService(scope),
+		publicLoadBalancersSvc:       publicloadbalancers.NewService(scope),
+		internalLoadBalancersSvc:     internalloadbalancers.NewService(scope),
 	}
 }
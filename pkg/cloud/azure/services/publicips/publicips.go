@@ -31,6 +31,53 @@ import (
 // Spec specification for public ip
 type Spec struct {
 	Name string
+	// DomainNameLabel is the DNS label of the public ip, the lowercased name is used when not set.
+	DomainNameLabel string
+	// IdleTimeoutInMinutes is the idle timeout of the public ip, Azure defaults it when not set.
+	IdleTimeoutInMinutes *int32
+	// SKU of the public ip, Standard when not set.
+	SKU network.PublicIPAddressSkuName
+	// AllocationMethod of the public ip, Static when not set.
+	AllocationMethod network.IPAllocationMethod
+	// Version is the IP family of the public ip, IPv4 when not set.
+	Version network.IPVersion
+	// Zones of the public ip, a public ip in all the zones of the region is zone-redundant. The public ip
+	// has no zone when not set.
+	Zones []string
+	// ResourceGroup of the public ip to get or delete, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// sku returns the SKU of the public ip.
+func (s *Spec) sku() network.PublicIPAddressSkuName {
+	if s.SKU != "" {
+		return s.SKU
+	}
+	return network.PublicIPAddressSkuNameStandard
+}
+
+// allocationMethod returns the allocation method of the public ip.
+func (s *Spec) allocationMethod() network.IPAllocationMethod {
+	if s.AllocationMethod != "" {
+		return s.AllocationMethod
+	}
+	return network.IPAllocationMethodStatic
+}
+
+// domainNameLabel returns the DNS label of the public ip.
+func (s *Spec) domainNameLabel() string {
+	if s.DomainNameLabel != "" {
+		return s.DomainNameLabel
+	}
+	return strings.ToLower(s.Name)
+}
+
+// version returns the IP family of the public ip.
+func (s *Spec) version() network.IPVersion {
+	if s.Version != "" {
+		return s.Version
+	}
+	return network.IPVersionIPv4
 }
 
 // Get provides information about a route table.
@@ -39,7 +86,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return network.PublicIPAddress{}, errors.New("Invalid PublicIP Specification")
 	}
-	publicIP, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, publicIPSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicIPSpec.ResourceGroup != "" {
+		resourceGroup = publicIPSpec.ResourceGroup
+	}
+	publicIP, err := s.Client.Get(ctx, resourceGroup, publicIPSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("publicip %s not found: %w", publicIPSpec.Name, err)
 	} else if err != nil {
@@ -50,12 +101,18 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a public ip
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicIPSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid PublicIP Specification")
 	}
 	ipName := publicIPSpec.Name
-	klog.V(2).Infof("creating public ip %s", ipName)
+	log.V(2).Info("creating public ip", "name", ipName)
+
+	var zones *[]string
+	if len(publicIPSpec.Zones) > 0 {
+		zones = to.StringSlicePtr(publicIPSpec.Zones)
+	}
 
 	// https://docs.microsoft.com/en-us/azure/load-balancer/load-balancer-standard-availability-zones#zone-redundant-by-default
 	f, err := s.Client.CreateOrUpdate(
@@ -63,14 +120,16 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		s.Scope.MachineConfig.ResourceGroup,
 		ipName,
 		network.PublicIPAddress{
-			Sku:      &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameStandard},
+			Sku:      &network.PublicIPAddressSku{Name: publicIPSpec.sku()},
 			Name:     to.StringPtr(ipName),
 			Location: to.StringPtr(s.Scope.MachineConfig.Location),
+			Zones:    zones,
 			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-				PublicIPAddressVersion:   network.IPVersionIPv4,
-				PublicIPAllocationMethod: network.IPAllocationMethodStatic,
+				PublicIPAddressVersion:   publicIPSpec.version(),
+				PublicIPAllocationMethod: publicIPSpec.allocationMethod(),
+				IdleTimeoutInMinutes:     publicIPSpec.IdleTimeoutInMinutes,
 				DNSSettings: &network.PublicIPAddressDNSSettings{
-					DomainNameLabel: to.StringPtr(strings.ToLower(ipName)),
+					DomainNameLabel: to.StringPtr(publicIPSpec.domainNameLabel()),
 				},
 			},
 			Tags: s.Scope.Tags,
@@ -90,24 +149,29 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created public ip %s", ipName)
+	log.V(2).Info("successfully created public ip", "name", ipName)
 	return err
 }
 
 // Delete deletes the public ip with the provided scope.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicIPSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid PublicIP Specification")
 	}
-	klog.V(2).Infof("deleting public ip %s", publicIPSpec.Name)
-	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, publicIPSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicIPSpec.ResourceGroup != "" {
+		resourceGroup = publicIPSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting public ip", "name", publicIPSpec.Name)
+	f, err := s.Client.Delete(ctx, resourceGroup, publicIPSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete public ip %s in resource group %s: %w", publicIPSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete public ip %s in resource group %s: %w", publicIPSpec.Name, resourceGroup, err)
 	}
 
 	err = f.WaitForCompletionRef(ctx, s.Client.Client)
@@ -119,6 +183,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("deleted public ip %s", publicIPSpec.Name)
+	log.V(2).Info("deleted public ip", "name", publicIPSpec.Name)
 	return err
 }
@@ -20,7 +20,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/network/mgmt/network"
 	"github.com/Azure/go-autorest/autorest/to"
@@ -34,7 +33,11 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return network.PublicIPAddress{}, errors.New("Invalid PublicIP Specification")
 	}
-	publicIP, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, publicIPSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicIPSpec.ResourceGroup != "" {
+		resourceGroup = publicIPSpec.ResourceGroup
+	}
+	publicIP, err := s.Client.Get(ctx, resourceGroup, publicIPSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("publicip %s not found: %w", publicIPSpec.Name, err)
 	} else if err != nil {
@@ -45,12 +48,13 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a public ip
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicIPSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid PublicIP Specification")
 	}
 	ipName := publicIPSpec.Name
-	klog.V(2).Infof("creating public ip %s", ipName)
+	log.V(2).Info("creating public ip", "name", ipName)
 
 	// https://docs.microsoft.com/en-us/azure/load-balancer/load-balancer-standard-availability-zones#zone-redundant-by-default
 	f, err := s.Client.CreateOrUpdate(
@@ -58,14 +62,15 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		s.Scope.MachineConfig.ResourceGroup,
 		ipName,
 		network.PublicIPAddress{
-			Sku:      &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuNameStandard},
+			Sku:      &network.PublicIPAddressSku{Name: network.PublicIPAddressSkuName(publicIPSpec.sku())},
 			Name:     to.StringPtr(ipName),
 			Location: to.StringPtr(s.Scope.MachineConfig.Location),
 			PublicIPAddressPropertiesFormat: &network.PublicIPAddressPropertiesFormat{
-				PublicIPAddressVersion:   network.IPv4,
-				PublicIPAllocationMethod: network.Static,
+				PublicIPAddressVersion:   network.IPVersion(publicIPSpec.version()),
+				PublicIPAllocationMethod: network.IPAllocationMethod(publicIPSpec.allocationMethod()),
+				IdleTimeoutInMinutes:     publicIPSpec.IdleTimeoutInMinutes,
 				DNSSettings: &network.PublicIPAddressDNSSettings{
-					DomainNameLabel: to.StringPtr(strings.ToLower(ipName)),
+					DomainNameLabel: to.StringPtr(publicIPSpec.domainNameLabel()),
 				},
 			},
 		},
@@ -84,24 +89,29 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created public ip %s", ipName)
+	log.V(2).Info("successfully created public ip", "name", ipName)
 	return err
 }
 
 // Delete deletes the public ip with the provided scope.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicIPSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid PublicIP Specification")
 	}
-	klog.V(2).Infof("deleting public ip %s", publicIPSpec.Name)
-	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, publicIPSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicIPSpec.ResourceGroup != "" {
+		resourceGroup = publicIPSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting public ip", "name", publicIPSpec.Name)
+	f, err := s.Client.Delete(ctx, resourceGroup, publicIPSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete public ip %s in resource group %s: %w", publicIPSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete public ip %s in resource group %s: %w", publicIPSpec.Name, resourceGroup, err)
 	}
 
 	err = f.WaitForCompletionRef(ctx, s.Client.Client)
@@ -113,6 +123,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("deleted public ip %s", publicIPSpec.Name)
+	log.V(2).Info("deleted public ip", "name", publicIPSpec.Name)
 	return err
 }
@@ -32,6 +32,8 @@ import (
 type Spec struct {
 	Name         string
 	PublicIPName string
+	// ResourceGroup of the load balancer, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
 // Get provides information about a route table.
@@ -40,7 +42,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return network.LoadBalancer{}, errors.New("invalid public loadbalancer specification")
 	}
-	lb, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, publicLBSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicLBSpec.ResourceGroup != "" {
+		resourceGroup = publicLBSpec.ResourceGroup
+	}
+	lb, err := s.Client.Get(ctx, resourceGroup, publicLBSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("load balancer %s not found: %w", publicLBSpec.Name, err)
 	} else if err != nil {
@@ -51,6 +57,7 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid public loadbalancer specification")
@@ -60,9 +67,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	backEndAddressPoolName := "controlplane-backEndPool"
 	idPrefix := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers", s.Scope.SubscriptionID, s.Scope.MachineConfig.ResourceGroup)
 	lbName := publicLBSpec.Name
-	klog.V(2).Infof("creating public load balancer %s", lbName)
+	log.V(2).Info("creating public load balancer", "name", lbName)
 
-	klog.V(2).Infof("getting public ip %s", publicLBSpec.PublicIPName)
+	log.V(2).Info("getting public ip", "name", publicLBSpec.PublicIPName)
 	pipInterface, err := publicips.NewService(s.Scope).Get(ctx, &publicips.Spec{Name: publicLBSpec.PublicIPName})
 	if err != nil {
 		return err
@@ -72,7 +79,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		return errors.New("got invalid public ip")
 	}
 
-	klog.V(2).Infof("successfully got public ip %s", publicLBSpec.PublicIPName)
+	log.V(2).Info("successfully got public ip", "name", publicLBSpec.PublicIPName)
 
 	// https://docs.microsoft.com/en-us/azure/load-balancer/load-balancer-standard-availability-zones#zone-redundant-by-default
 	f, err := s.Client.CreateOrUpdate(ctx,
@@ -184,17 +191,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	}
 
 	_, err = f.Result(s.Client)
-	klog.V(2).Infof("successfully created public load balancer %s", lbName)
+	log.V(2).Info("successfully created public load balancer", "name", lbName)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid public loadbalancer specification")
 	}
-	klog.V(2).Infof("deleting public load balancer %s", publicLBSpec.Name)
+	log.V(2).Info("deleting public load balancer", "name", publicLBSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, publicLBSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -213,6 +221,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("deleted public load balancer %s", publicLBSpec.Name)
+	log.V(2).Info("deleted public load balancer", "name", publicLBSpec.Name)
 	return err
 }
@@ -34,7 +34,11 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return network.LoadBalancer{}, errors.New("invalid public loadbalancer specification")
 	}
-	lb, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, publicLBSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if publicLBSpec.ResourceGroup != "" {
+		resourceGroup = publicLBSpec.ResourceGroup
+	}
+	lb, err := s.Client.Get(ctx, resourceGroup, publicLBSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("load balancer %s not found: %w", publicLBSpec.Name, err)
 	} else if err != nil {
@@ -45,6 +49,7 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a route table.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid public loadbalancer specification")
@@ -54,9 +59,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	backEndAddressPoolName := "controlplane-backEndPool"
 	idPrefix := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/loadBalancers", s.Scope.SubscriptionID, s.Scope.MachineConfig.ResourceGroup)
 	lbName := publicLBSpec.Name
-	klog.V(2).Infof("creating public load balancer %s", lbName)
+	log.V(2).Info("creating public load balancer", "name", lbName)
 
-	klog.V(2).Infof("getting public ip %s", publicLBSpec.PublicIPName)
+	log.V(2).Info("getting public ip", "name", publicLBSpec.PublicIPName)
 	pipInterface, err := publicips.NewService(s.Scope).Get(ctx, &publicips.Spec{Name: publicLBSpec.PublicIPName})
 	if err != nil {
 		return err
@@ -66,7 +71,7 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		return errors.New("got invalid public ip")
 	}
 
-	klog.V(2).Infof("successfully got public ip %s", publicLBSpec.PublicIPName)
+	log.V(2).Info("successfully got public ip", "name", publicLBSpec.PublicIPName)
 
 	// https://docs.microsoft.com/en-us/azure/load-balancer/load-balancer-standard-availability-zones#zone-redundant-by-default
 	f, err := s.Client.CreateOrUpdate(ctx,
@@ -177,17 +182,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	}
 
 	_, err = f.Result(s.Client)
-	klog.V(2).Infof("successfully created public load balancer %s", lbName)
+	log.V(2).Info("successfully created public load balancer", "name", lbName)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	publicLBSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid public loadbalancer specification")
 	}
-	klog.V(2).Infof("deleting public load balancer %s", publicLBSpec.Name)
+	log.V(2).Info("deleting public load balancer", "name", publicLBSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, publicLBSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -206,6 +212,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("deleted public load balancer %s", publicLBSpec.Name)
+	log.V(2).Info("deleted public load balancer", "name", publicLBSpec.Name)
 	return err
 }
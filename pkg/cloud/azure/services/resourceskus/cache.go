@@ -26,6 +26,7 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
 	"k8s.io/utils/ptr"
 
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
@@ -37,10 +38,18 @@ var (
 	ErrResourceNotFound = errors.New("resource not found")
 )
 
+// DefaultCacheTTL is the time resource SKUs are cached for before they are listed again.
+const DefaultCacheTTL = 24 * time.Hour
+
+// notFoundRefreshInterval is how long after the resource SKUs were listed a lookup of a SKU missing from
+// them lists them again, so that repeated lookups of an unknown SKU do not list them from Azure every time.
+const notFoundRefreshInterval = 5 * time.Minute
+
 // Cache loads resource SKUs at the beginning of reconcile to expose
 // features available on compute resources. It exposes convenience
-// functionality for trawling Azure SKU capabilities. It may be adapted
-// to periodically refresh data in the background.
+// functionality for trawling Azure SKU capabilities. The SKUs are
+// shared by the reconciles of a location and listed again once they
+// are older than the TTL of the cache.
 type Cache struct {
 	client Client
 
@@ -48,9 +57,20 @@ type Cache struct {
 	// we do lookup once per reconcile for the given cluster/location.
 	location string
 
+	// ttl is how long the data is used before it is refreshed, it never expires when 0.
+	ttl time.Duration
+
+	// mu synchronizes the access to the data by concurrent reconciles.
+	mu sync.Mutex
+
+	// refreshMu serializes the listing of the data from Azure, which is done without holding mu.
+	refreshMu sync.Mutex
+
 	// data is the cached sku information from Azure.
-	// synchronization required if data is cached across reconcile calls, (i.e., refreshed in background as Runnable via mgr.Add(...))
 	data []compute.ResourceSku
+
+	// refreshed is when the data was last listed from Azure.
+	refreshed time.Time
 }
 
 // Cacher describes the ability to get and to add items to cache.
@@ -66,13 +86,22 @@ var (
 	_           Client = &AzureClient{}
 	doOnce      sync.Once
 	clientCache Cacher
+
+	cacheTTL = DefaultCacheTTL
 )
 
+// SetCacheTTL sets how long the resource SKUs of the caches returned by GetCache are used
+// before they are listed again. It must be called before the first call to GetCache.
+func SetCacheTTL(ttl time.Duration) {
+	cacheTTL = ttl
+}
+
 // newCache instantiates a cache and initializes its contents.
 func newCache(azureClients actuators.AzureClients, location string) *Cache {
 	return &Cache{
 		client:   NewClient(azureClients),
 		location: location,
+		ttl:      cacheTTL,
 	}
 }
 
@@ -106,37 +135,104 @@ func NewStaticCache(data []compute.ResourceSku, location string) *Cache {
 	}
 }
 
+// rateLimiterKey is the context key of the rate limiter of the resource SKUs listed from Azure.
+type rateLimiterKey struct{}
+
+// WithRateLimiter returns a copy of the context in which the resource SKUs are listed from Azure only once
+// the rate limiter allows it. The lookups answered from the cache do not wait for the rate limiter.
+func WithRateLimiter(ctx context.Context, limiter *rate.Limiter) context.Context {
+	return context.WithValue(ctx, rateLimiterKey{}, limiter)
+}
+
 func (c *Cache) refresh(ctx context.Context, location string) error {
+	if limiter, ok := ctx.Value(rateLimiterKey{}).(*rate.Limiter); ok && limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return errors.Wrap(err, "failed to wait for the resource sku rate limiter")
+		}
+	}
+
 	data, err := c.client.List(ctx, fmt.Sprintf("location eq '%s'", location))
 	if err != nil {
 		return errors.Wrap(err, "failed to refresh resource sku cache")
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.data = data
+	c.refreshed = time.Now()
 
 	return nil
 }
 
+// cachedData returns the cached resource SKUs, or nil when they were never listed,
+// invalidated or are older than the TTL.
+func (c *Cache) cachedData() []compute.ResourceSku {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl > 0 && time.Since(c.refreshed) > c.ttl {
+		return nil
+	}
+	return c.data
+}
+
+// getData returns the cached resource SKUs, listed again from Azure when
+// they were never listed, invalidated or are older than the TTL.
+func (c *Cache) getData(ctx context.Context) ([]compute.ResourceSku, error) {
+	if data := c.cachedData(); data != nil {
+		return data, nil
+	}
+
+	// Lookups waiting on a refresh use the SKUs it listed rather than listing them again.
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if data := c.cachedData(); data != nil {
+		return data, nil
+	}
+
+	if err := c.refresh(ctx, c.location); err != nil {
+		return nil, err
+	}
+
+	return c.cachedData(), nil
+}
+
+// invalidateNotFound drops the cached resource SKUs after the lookup of a SKU missing from them, so that they
+// are listed again from Azure on the next lookup, unless they were listed less than notFoundRefreshInterval
+// ago. Static caches can not be refreshed and are kept.
+func (c *Cache) invalidateNotFound() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.client != nil && time.Since(c.refreshed) > notFoundRefreshInterval {
+		c.data = nil
+	}
+}
+
 // Get returns a resource SKU with the provided name and category. It
 // returns an error if we could not find a match. We should consider
 // enhancing this function to handle restrictions (e.g. SKU not
 // supported in region), which is why it returns an error and not a
 // boolean.
 func (c *Cache) Get(ctx context.Context, name string, kind ResourceType) (SKU, error) {
-	if c.data == nil {
-		if err := c.refresh(ctx, c.location); err != nil {
-			return SKU{}, err
-		}
+	data, err := c.getData(ctx)
+	if err != nil {
+		return SKU{}, err
 	}
 
-	for _, sku := range c.data {
+	for _, sku := range data {
 		if sku.Name != nil && strings.EqualFold(*sku.Name, name) {
 			return SKU(sku), nil
 		}
 	}
 
+	// The SKU may have been made available since the SKUs were listed.
+	c.invalidateNotFound()
+
 	availableInRegion := []string{}
-	for _, sku := range c.data {
+	for _, sku := range data {
 		if ptr.Deref[string](sku.ResourceType, "") == string(kind) {
 			availableInRegion = append(availableInRegion, ptr.Deref[string](sku.Name, ""))
 		}
@@ -147,14 +243,13 @@ func (c *Cache) Get(ctx context.Context, name string, kind ResourceType) (SKU, e
 
 // Map invokes a function over all cached values.
 func (c *Cache) Map(ctx context.Context, mapFn func(sku SKU)) error {
-	if c.data == nil {
-		if err := c.refresh(ctx, c.location); err != nil {
-			return err
-		}
+	data, err := c.getData(ctx)
+	if err != nil {
+		return err
 	}
 
-	for i := range c.data {
-		val := SKU(c.data[i])
+	for i := range data {
+		val := SKU(data[i])
 		mapFn(val)
 	}
 
@@ -18,12 +18,19 @@ package resourceskus
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"go.uber.org/mock/gomock"
+	"golang.org/x/time/rate"
+
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/resourceskus/mock_resourceskus"
 )
 
 func TestCacheGet(t *testing.T) {
@@ -107,6 +114,151 @@ func TestCacheGet(t *testing.T) {
 	}
 }
 
+func TestCacheGetListsOnceWithinTTL(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+	client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+		{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+	}, nil).Times(1)
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(context.Background(), "foo", "bar"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
+
+func TestCacheGetRefreshesExpiredSKUs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+	client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+		{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+	}, nil).Times(2)
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+	if _, err := cache.Get(context.Background(), "foo", "bar"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cache.refreshed = time.Now().Add(-2 * time.Hour)
+	if _, err := cache.Get(context.Background(), "foo", "bar"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCacheGetRefreshesAfterNotFound(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+	gomock.InOrder(
+		client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+			{Name: to.StringPtr("other"), ResourceType: to.StringPtr("bar")},
+		}, nil).Times(1),
+		client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+			{Name: to.StringPtr("other"), ResourceType: to.StringPtr("bar")},
+			{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+		}, nil).Times(1),
+	)
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+	if _, err := cache.Get(context.Background(), "foo", "bar"); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("Expected %v, got %v", ErrResourceNotFound, err)
+	}
+
+	// The SKUs listed less than notFoundRefreshInterval ago are not listed again.
+	if _, err := cache.Get(context.Background(), "foo", "bar"); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("Expected %v, got %v", ErrResourceNotFound, err)
+	}
+
+	cache.refreshed = time.Now().Add(-2 * notFoundRefreshInterval)
+	if _, err := cache.Get(context.Background(), "foo", "bar"); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("Expected %v, got %v", ErrResourceNotFound, err)
+	}
+
+	sku, err := cache.Get(context.Background(), "foo", "bar")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if *sku.Name != "foo" {
+		t.Errorf("Expected SKU foo, got %s", *sku.Name)
+	}
+
+	// The SKUs are cached again once found.
+	if _, err := cache.Get(context.Background(), "other", "bar"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestCacheGetListsOnceConcurrently(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+	client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+		{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+	}, nil).Times(1)
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get(context.Background(), "foo", "bar"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCacheGetWaitsForTheRateLimiterBeforeListing(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+	client.EXPECT().List(gomock.Any(), "location eq 'test'").Return([]compute.ResourceSku{
+		{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+	}, nil).Times(1)
+
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 2)
+	ctx := WithRateLimiter(context.Background(), limiter)
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(ctx, "foo", "bar"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Only the lookup listing the SKUs from Azure waits for the rate limiter.
+	if tokens := limiter.Tokens(); tokens < 0.99 || tokens > 1.01 {
+		t.Errorf("Expected 1 token left, got %v", tokens)
+	}
+}
+
+func TestCacheGetFailsWhenTheRateLimiterCanNotWait(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	client := mock_resourceskus.NewMockClient(mockCtrl)
+
+	ctx := WithRateLimiter(context.Background(), rate.NewLimiter(rate.Every(time.Hour), 0))
+
+	cache := &Cache{client: client, location: "test", ttl: time.Hour}
+	if _, err := cache.Get(ctx, "foo", "bar"); err == nil {
+		t.Fatal("Expected an error waiting for the rate limiter")
+	}
+}
+
+func TestStaticCacheIsNotInvalidated(t *testing.T) {
+	cache := NewStaticCache([]compute.ResourceSku{
+		{Name: to.StringPtr("foo"), ResourceType: to.StringPtr("bar")},
+	}, "test")
+
+	if _, err := cache.Get(context.Background(), "missing", "bar"); !errors.Is(err, ErrResourceNotFound) {
+		t.Fatalf("Expected %v, got %v", ErrResourceNotFound, err)
+	}
+	if _, err := cache.Get(context.Background(), "foo", "bar"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
 func TestCacheGetZones(t *testing.T) {
 	cases := map[string]struct {
 		have []compute.ResourceSku
@@ -22,7 +22,6 @@ import (
 
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
-	"k8s.io/klog/v2"
 )
 
 type ResourceSkusServiceBuilderFuncType func(*actuators.MachineScope) azure.Service
@@ -42,7 +41,7 @@ func NewService(scope *actuators.MachineScope) azure.Service {
 	cache, err := GetCache(azureClients, scope.Location())
 	if err != nil {
 		// Can't return error here, because ot he interface constraint. Nil cache is checked in the get function.
-		klog.Errorf("Could not create resourceSKUs service: %v", err)
+		scope.Logger().Error(err, "could not create resourceSKUs service")
 	}
 	return &Service{
 		cache: cache,
@@ -70,6 +70,16 @@ const (
 	MaximumPlatformFaultDomainCount = "MaximumPlatformFaultDomainCount"
 	// UltraSSDAvailable identifies the capability for the support of UltraSSD data disks.
 	UltraSSDAvailable = "UltraSSDAvailable"
+	// CachedDiskBytes identifies the capability for the size of the cache disk in bytes.
+	CachedDiskBytes = "CachedDiskBytes"
+	// MaxResourceVolumeMB identifies the capability for the size of the resource (temp) disk in MB.
+	MaxResourceVolumeMB = "MaxResourceVolumeMB"
+	// ConfidentialComputingType identifies the capability for confidential compute, e.g. "SNP".
+	// It is only reported for VM sizes supporting confidential VMs.
+	ConfidentialComputingType = "ConfidentialComputingType"
+	// MaxWriteAcceleratorDisksAllowed identifies the capability for the number of disks with write accelerator
+	// enabled a VM size supports. It is only reported for VM sizes supporting write accelerator.
+	MaxWriteAcceleratorDisksAllowed = "MaxWriteAcceleratorDisksAllowed"
 	// CPUArchitectureType identifies the capability for the CPU architecture.
 	CPUArchitectureType = "CpuArchitectureType"
 	// X64 and Arm64 are the possible values for CPUArchitectureType, in the Azure APIs. We will adapt them in the controller
@@ -139,6 +149,26 @@ func (s SKU) GetCapability(name string) (string, bool) {
 	return "", false
 }
 
+// HasLocationZone returns true if the provided resource is available in the given zone of the location.
+func (s SKU) HasLocationZone(location, zone string) bool {
+	if s.LocationInfo == nil {
+		return false
+	}
+
+	for _, info := range *s.LocationInfo {
+		if info.Location == nil || !strings.EqualFold(*info.Location, location) || info.Zones == nil {
+			continue
+		}
+
+		for _, name := range *info.Zones {
+			if name == zone {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // HasLocationCapability returns true if the provided resource supports the location capability.
 func (s SKU) HasLocationCapability(capabilityName, location, zone string) bool {
 	if s.LocationInfo == nil {
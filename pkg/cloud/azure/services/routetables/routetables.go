@@ -50,11 +50,12 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	routeTableSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Route Table Specification")
 	}
-	klog.V(2).Infof("creating route table %s", routeTableSpec.Name)
+	log.V(2).Info("creating route table", "name", routeTableSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -78,17 +79,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created route table %s", routeTableSpec.Name)
+	log.V(2).Info("successfully created route table", "name", routeTableSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	routeTableSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Route Table Specification")
 	}
-	klog.V(2).Infof("deleting route table %s", routeTableSpec.Name)
+	log.V(2).Info("deleting route table", "name", routeTableSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, routeTableSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -107,6 +109,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted route table %s", routeTableSpec.Name)
+	log.V(2).Info("successfully deleted route table", "name", routeTableSpec.Name)
 	return err
 }
@@ -44,11 +44,12 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a route table.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	routeTableSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Route Table Specification")
 	}
-	klog.V(2).Infof("creating route table %s", routeTableSpec.Name)
+	log.V(2).Info("creating route table", "name", routeTableSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -71,17 +72,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created route table %s", routeTableSpec.Name)
+	log.V(2).Info("successfully created route table", "name", routeTableSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	routeTableSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Route Table Specification")
 	}
-	klog.V(2).Infof("deleting route table %s", routeTableSpec.Name)
+	log.V(2).Info("deleting route table", "name", routeTableSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, routeTableSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -100,6 +102,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted route table %s", routeTableSpec.Name)
+	log.V(2).Info("successfully deleted route table", "name", routeTableSpec.Name)
 	return err
 }
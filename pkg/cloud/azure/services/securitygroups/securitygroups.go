@@ -31,6 +31,8 @@ import (
 type Spec struct {
 	Name           string
 	IsControlPlane bool
+	// ResourceGroup of the security group, the resource group of the machine is used when empty.
+	ResourceGroup string
 }
 
 // Get provides information about a route table.
@@ -39,7 +41,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return network.SecurityGroup{}, errors.New("invalid security groups specification")
 	}
-	securityGroup, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, nsgSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nsgSpec.ResourceGroup != "" {
+		resourceGroup = nsgSpec.ResourceGroup
+	}
+	securityGroup, err := s.Client.Get(ctx, resourceGroup, nsgSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("security group %s not found: %w", nsgSpec.Name, err)
 	} else if err != nil {
@@ -50,6 +56,7 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nsgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid security groups specification")
@@ -58,7 +65,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	securityRules := &[]network.SecurityRule{}
 
 	if nsgSpec.IsControlPlane {
-		klog.V(2).Infof("using additional rules for control plane %s", nsgSpec.Name)
+		log.V(2).Info("using additional rules for control plane", "name", nsgSpec.Name)
 		securityRules = &[]network.SecurityRule{
 			{
 				Name: to.StringPtr("allow_ssh"),
@@ -89,7 +96,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		}
 	}
 
-	klog.V(2).Infof("creating security group %s", nsgSpec.Name)
+	log.V(2).Info("creating security group", "name", nsgSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -115,17 +122,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("created security group %s", nsgSpec.Name)
+	log.V(2).Info("created security group", "name", nsgSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nsgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid security groups specification")
 	}
-	klog.V(2).Infof("deleting security group %s", nsgSpec.Name)
+	log.V(2).Info("deleting security group", "name", nsgSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, nsgSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -145,6 +153,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("deleted security group %s", nsgSpec.Name)
+	log.V(2).Info("deleted security group", "name", nsgSpec.Name)
 	return err
 }
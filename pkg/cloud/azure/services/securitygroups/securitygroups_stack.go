@@ -33,7 +33,11 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return network.SecurityGroup{}, errors.New("invalid security groups specification")
 	}
-	securityGroup, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, nsgSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if nsgSpec.ResourceGroup != "" {
+		resourceGroup = nsgSpec.ResourceGroup
+	}
+	securityGroup, err := s.Client.Get(ctx, resourceGroup, nsgSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("security group %s not found: %w", nsgSpec.Name, err)
 	} else if err != nil {
@@ -44,6 +48,7 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a route table.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nsgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid security groups specification")
@@ -52,7 +57,7 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	securityRules := &[]network.SecurityRule{}
 
 	if nsgSpec.IsControlPlane {
-		klog.V(2).Infof("using additional rules for control plane %s", nsgSpec.Name)
+		log.V(2).Info("using additional rules for control plane", "name", nsgSpec.Name)
 		securityRules = &[]network.SecurityRule{
 			{
 				Name: to.StringPtr("allow_ssh"),
@@ -83,7 +88,7 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		}
 	}
 
-	klog.V(2).Infof("creating security group %s", nsgSpec.Name)
+	log.V(2).Info("creating security group", "name", nsgSpec.Name)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.ResourceGroup,
@@ -108,17 +113,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("created security group %s", nsgSpec.Name)
+	log.V(2).Info("created security group", "name", nsgSpec.Name)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	nsgSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid security groups specification")
 	}
-	klog.V(2).Infof("deleting security group %s", nsgSpec.Name)
+	log.V(2).Info("deleting security group", "name", nsgSpec.Name)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, nsgSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -138,6 +144,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("deleted security group %s", nsgSpec.Name)
+	log.V(2).Info("deleted security group", "name", nsgSpec.Name)
 	return err
 }
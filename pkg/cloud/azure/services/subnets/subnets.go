@@ -31,9 +31,11 @@ import (
 
 // Spec input specification for Get/CreateOrUpdate/Delete calls
 type Spec struct {
-	Name              string
-	CIDR              string
-	VnetName          string
+	Name     string
+	CIDR     string
+	VnetName string
+	// ResourceGroup of the virtual network, the network resource group of the machine is used when empty.
+	ResourceGroup     string
 	RouteTableName    string
 	SecurityGroupName string
 }
@@ -44,7 +46,11 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return network.Subnet{}, errors.New("Invalid Subnet Specification")
 	}
-	subnet, err := s.Client.Get(ctx, s.Scope.MachineConfig.NetworkResourceGroup, subnetSpec.VnetName, subnetSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.NetworkResourceGroup
+	if subnetSpec.ResourceGroup != "" {
+		resourceGroup = subnetSpec.ResourceGroup
+	}
+	subnet, err := s.Client.Get(ctx, resourceGroup, subnetSpec.VnetName, subnetSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("subnet %s not found: %w", subnetSpec.Name, err)
 	} else if err != nil {
@@ -55,6 +61,7 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a route table.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	subnetSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Subnet Specification")
@@ -63,7 +70,7 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		AddressPrefix: to.StringPtr(subnetSpec.CIDR),
 	}
 	if subnetSpec.RouteTableName != "" {
-		klog.V(2).Infof("getting route table %s", subnetSpec.RouteTableName)
+		log.V(2).Info("getting route table", "name", subnetSpec.RouteTableName)
 		rtInterface, err := routetables.NewService(s.Scope).Get(ctx, &routetables.Spec{Name: subnetSpec.RouteTableName})
 		if err != nil {
 			return err
@@ -72,11 +79,11 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		if !rOk {
 			return errors.New("error getting route table")
 		}
-		klog.V(2).Infof("sucessfully got route table %s", subnetSpec.RouteTableName)
+		log.V(2).Info("sucessfully got route table", "name", subnetSpec.RouteTableName)
 		subnetProperties.RouteTable = &rt
 	}
 
-	klog.V(2).Infof("getting nsg %s", subnetSpec.SecurityGroupName)
+	log.V(2).Info("getting nsg", "name", subnetSpec.SecurityGroupName)
 	nsgInterface, err := securitygroups.NewService(s.Scope).Get(ctx, &securitygroups.Spec{Name: subnetSpec.SecurityGroupName})
 	if err != nil {
 		return err
@@ -85,10 +92,10 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if !ok {
 		return errors.New("error getting network security group")
 	}
-	klog.V(2).Infof("got nsg %s", subnetSpec.SecurityGroupName)
+	log.V(2).Info("got nsg", "name", subnetSpec.SecurityGroupName)
 	subnetProperties.NetworkSecurityGroup = &nsg
 
-	klog.V(2).Infof("creating subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("creating subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.NetworkResourceGroup,
@@ -112,17 +119,18 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("successfully created subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	subnetSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Subnet Specification")
 	}
-	klog.V(2).Infof("deleting subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("deleting subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.NetworkResourceGroup, subnetSpec.VnetName, subnetSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -141,6 +149,6 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("successfully deleted subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	return err
 }
@@ -35,7 +35,11 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return network.Subnet{}, errors.New("Invalid Subnet Specification")
 	}
-	subnet, err := s.Client.Get(ctx, s.Scope.MachineConfig.NetworkResourceGroup, subnetSpec.VnetName, subnetSpec.Name, "")
+	resourceGroup := s.Scope.MachineConfig.NetworkResourceGroup
+	if subnetSpec.ResourceGroup != "" {
+		resourceGroup = subnetSpec.ResourceGroup
+	}
+	subnet, err := s.Client.Get(ctx, resourceGroup, subnetSpec.VnetName, subnetSpec.Name, "")
 	if err != nil && azure.ResourceNotFound(err) {
 		return nil, fmt.Errorf("subnet %s not found: %w", subnetSpec.Name, err)
 	} else if err != nil {
@@ -46,6 +50,7 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a route table.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	subnetSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Subnet Specification")
@@ -54,7 +59,7 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		AddressPrefix: to.StringPtr(subnetSpec.CIDR),
 	}
 	if subnetSpec.RouteTableName != "" {
-		klog.V(2).Infof("getting route table %s", subnetSpec.RouteTableName)
+		log.V(2).Info("getting route table", "name", subnetSpec.RouteTableName)
 		rtInterface, err := routetables.NewService(s.Scope).Get(ctx, &routetables.Spec{Name: subnetSpec.RouteTableName})
 		if err != nil {
 			return err
@@ -63,11 +68,11 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		if !rOk {
 			return errors.New("error getting route table")
 		}
-		klog.V(2).Infof("sucessfully got route table %s", subnetSpec.RouteTableName)
+		log.V(2).Info("sucessfully got route table", "name", subnetSpec.RouteTableName)
 		subnetProperties.RouteTable = &rt
 	}
 
-	klog.V(2).Infof("getting nsg %s", subnetSpec.SecurityGroupName)
+	log.V(2).Info("getting nsg", "name", subnetSpec.SecurityGroupName)
 	nsgInterface, err := securitygroups.NewService(s.Scope).Get(ctx, &securitygroups.Spec{Name: subnetSpec.SecurityGroupName})
 	if err != nil {
 		return err
@@ -76,10 +81,10 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if !ok {
 		return errors.New("error getting network security group1")
 	}
-	klog.V(2).Infof("got nsg %s", subnetSpec.SecurityGroupName)
+	log.V(2).Info("got nsg", "name", subnetSpec.SecurityGroupName)
 	subnetProperties.NetworkSecurityGroup = &nsg
 
-	klog.V(2).Infof("creating subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("creating subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	f, err := s.Client.CreateOrUpdate(
 		ctx,
 		s.Scope.MachineConfig.NetworkResourceGroup,
@@ -103,17 +108,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully created subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("successfully created subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	return err
 }
 
 // Delete deletes the route table with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	subnetSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid Subnet Specification")
 	}
-	klog.V(2).Infof("deleting subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("deleting subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	f, err := s.Client.Delete(ctx, s.Scope.MachineConfig.NetworkResourceGroup, subnetSpec.VnetName, subnetSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -132,6 +138,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 	if err != nil {
 		return fmt.Errorf("result error: %w", err)
 	}
-	klog.V(2).Infof("successfully deleted subnet %s in vnet %s", subnetSpec.Name, subnetSpec.VnetName)
+	log.V(2).Info("successfully deleted subnet in vnet", "name", subnetSpec.Name, "vnet", subnetSpec.VnetName)
 	return err
 }
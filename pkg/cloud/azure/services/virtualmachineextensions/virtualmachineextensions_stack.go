@@ -44,12 +44,13 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a virtual network.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	vmExtSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid vm specification")
 	}
 
-	klog.V(2).Infof("creating vm extension %s ", vmExtSpec.Name)
+	log.V(2).Info("creating vm extension", "name", vmExtSpec.Name)
 
 	future, err := s.Client.CreateOrUpdate(
 		ctx,
@@ -87,17 +88,18 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	// 	s.Delete(ctx, vmExtSpec)
 	// }
 
-	klog.V(2).Infof("successfully created vm extension %s ", vmExtSpec.Name)
+	log.V(2).Info("successfully created vm extension", "name", vmExtSpec.Name)
 	return err
 }
 
 // Delete deletes the virtual network with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	vmExtSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("Invalid VNET Specification")
 	}
-	klog.V(2).Infof("deleting vm extension %s ", vmExtSpec.Name)
+	log.V(2).Info("deleting vm extension", "name", vmExtSpec.Name)
 	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, vmExtSpec.VMName, vmExtSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
@@ -114,6 +116,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 
 	_, err = future.Result(s.Client)
 
-	klog.V(2).Infof("successfully deleted vm %s ", vmExtSpec.Name)
+	log.V(2).Info("successfully deleted vm", "name", vmExtSpec.Name)
 	return err
 }
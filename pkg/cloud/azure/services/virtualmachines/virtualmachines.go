@@ -25,9 +25,11 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/to"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
@@ -35,6 +37,8 @@ import (
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/networkinterfaces"
 
 	"golang.org/x/crypto/ssh"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/ptr"
 )
@@ -67,27 +71,118 @@ const (
 		</FirstLogonCommands>`
 )
 
+const (
+	// AzureImageTypeGallery is used for images stored in an Azure Compute Gallery (Shared Image Gallery).
+	// The image ResourceID must reference a gallery image definition or image version.
+	AzureImageTypeGallery machinev1.AzureImageType = "Gallery"
+	// AzureImageTypeCommunityGallery is used for images published to an Azure community gallery.
+	// The image ResourceID must be the community gallery image ID, e.g.
+	// /CommunityGalleries/<publicGalleryName>/Images/<image>[/Versions/<version>].
+	AzureImageTypeCommunityGallery machinev1.AzureImageType = "CommunityGallery"
+	// AzureImageTypeSharedGallery is used for images directly shared with the subscription or tenant.
+	// The image ResourceID must be the shared gallery image ID, e.g.
+	// /SharedGalleries/<galleryUniqueName>/Images/<image>[/Versions/<version>].
+	AzureImageTypeSharedGallery machinev1.AzureImageType = "SharedGallery"
+)
+
 // Spec input specification for Get/CreateOrUpdate/Delete calls
 type Spec struct {
-	Name                       string
-	NICName                    string
-	SSHKeyData                 string
-	Size                       string
-	Zone                       string
-	Image                      machinev1.Image
-	OSDisk                     machinev1.OSDisk
-	DataDisks                  []machinev1.DataDisk
-	CustomData                 string
-	ManagedIdentity            string
-	Tags                       map[string]*string
-	Priority                   compute.VirtualMachinePriorityTypes
-	EvictionPolicy             compute.VirtualMachineEvictionPolicyTypes
-	BillingProfile             *compute.BillingProfile
-	SecurityProfile            *machinev1.SecurityProfile
-	DiagnosticsProfile         *compute.DiagnosticsProfile
-	UltraSSDCapability         machinev1.AzureUltraSSDCapabilityState
+	Name               string
+	NICName            string
+	SSHKeyData         string
+	Size               string
+	Zone               string
+	Image              machinev1.Image
+	OSDisk             machinev1.OSDisk
+	DataDisks          []machinev1.DataDisk
+	CustomData         string
+	ManagedIdentity    string
+	Tags               map[string]*string
+	Priority           compute.VirtualMachinePriorityTypes
+	EvictionPolicy     compute.VirtualMachineEvictionPolicyTypes
+	BillingProfile     *compute.BillingProfile
+	SecurityProfile    *machinev1.SecurityProfile
+	DiagnosticsProfile *compute.DiagnosticsProfile
+	UltraSSDCapability machinev1.AzureUltraSSDCapabilityState
+	// HibernationEnabled toggles the hibernation capability of the VM, it is left unset when nil.
+	HibernationEnabled         *bool
 	AvailabilitySetName        string
 	CapacityReservationGroupID string
+	// AdminUsername is the name of the administrator account of the VM, azure.DefaultUserName is used when empty.
+	AdminUsername string
+	// AdminPassword is the password of the administrator account of the VM, a random one is generated when empty.
+	AdminPassword string
+	// NICResourceGroup is the resource group of the network interface, the resource group of the machine is used when empty.
+	NICResourceGroup string
+	// DataDisksFromImage are the LUNs of the data disks created from the data disk of the image with the same LUN,
+	// the other data disks are created empty.
+	DataDisksFromImage []int32
+	// EphemeralOSDiskPlacement is where the ephemeral OS disk of the VM is placed, it is left for Azure to choose
+	// when empty.
+	EphemeralOSDiskPlacement compute.DiffDiskPlacement
+	// ProximityPlacementGroupID is the resource ID of the proximity placement group of the VM, the VM is not
+	// placed in a proximity placement group when empty.
+	ProximityPlacementGroupID string
+	// OSDiskWriteAccelerated enables write accelerator on the OS disk.
+	OSDiskWriteAccelerated bool
+	// WriteAcceleratedDataDisks are the LUNs of the data disks to enable write accelerator on.
+	WriteAcceleratedDataDisks []int32
+	// UserData is the base64 encoded user data of the VM, which is retrievable from the instance metadata service.
+	UserData string
+	// OSDiskDeletionPolicy is whether the OS disk is deleted or detached when the VM is deleted, Azure detaches it when empty.
+	OSDiskDeletionPolicy machinev1.DiskDeletionPolicyType
+	// AttachedDataDisks maps the LUNs of the data disks attached from existing managed disks to the resource IDs
+	// of the disks, the other data disks are created with the VM.
+	AttachedDataDisks map[int32]string
+	// ResourceGroup of the VM to get or delete, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// IdentitySpec input specification for updating the identity of an existing VM.
+type IdentitySpec struct {
+	Name     string
+	Identity *compute.VirtualMachineIdentity
+	// ResourceGroup of the VM, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// DataDisksDeleteOptionSpec input specification for updating the delete option
+// of data disks attached to an existing VM.
+type DataDisksDeleteOptionSpec struct {
+	Name string
+	// DataDisks are the data disks currently attached to the VM, which are all sent back as the
+	// update replaces the data disks of the VM.
+	DataDisks []compute.DataDisk
+	// DeleteOptions maps the names of the data disks to update to their new delete option.
+	DeleteOptions map[string]compute.DiskDeleteOptionTypes
+	// ResourceGroup of the VM, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// PowerStateSpec input specification for deallocating or starting an existing VM.
+type PowerStateSpec struct {
+	Name string
+	// Deallocated deallocates the VM when true, and starts it when false.
+	Deallocated bool
+	// ResourceGroup of the VM, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// TagsSpec input specification for updating the tags of an existing VM.
+type TagsSpec struct {
+	Name string
+	// Tags replaces the tags of the VM as a whole.
+	Tags map[string]*string
+	// ResourceGroup of the VM, the resource group of the machine is used when empty.
+	ResourceGroup string
+}
+
+// getResourceGroup returns the resource group of a VM spec, which defaults to the resource group of the machine.
+func (s *Service) getResourceGroup(resourceGroup string) string {
+	if resourceGroup != "" {
+		return resourceGroup
+	}
+	return s.Scope.MachineConfig.ResourceGroup
 }
 
 // Get provides information about a virtual network.
@@ -96,9 +191,10 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 	if !ok {
 		return compute.VirtualMachine{}, errors.New("invalid vm specification")
 	}
-	vm, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, vmSpec.Name, compute.InstanceViewTypesInstanceView)
+	resourceGroup := s.getResourceGroup(vmSpec.ResourceGroup)
+	vm, err := s.Client.Get(ctx, resourceGroup, vmSpec.Name, compute.InstanceViewTypesInstanceView)
 	if err != nil && azure.ResourceNotFound(err) {
-		klog.Warningf("vm %s not found: %v", vmSpec.Name, err)
+		klog.FromContext(ctx).Info("vm not found", "name", vmSpec.Name, "err", err)
 		return nil, err
 	} else if err != nil {
 		return vm, err
@@ -108,13 +204,30 @@ func (s *Service) Get(ctx context.Context, spec azure.Spec) (interface{}, error)
 
 // CreateOrUpdate creates or updates a virtual network.
 func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
+	if identitySpec, ok := spec.(*IdentitySpec); ok {
+		return s.updateIdentity(ctx, identitySpec)
+	}
+
+	if deleteOptionSpec, ok := spec.(*DataDisksDeleteOptionSpec); ok {
+		return s.updateDataDisksDeleteOption(ctx, deleteOptionSpec)
+	}
+
+	if powerStateSpec, ok := spec.(*PowerStateSpec); ok {
+		return s.updatePowerState(ctx, powerStateSpec)
+	}
+
+	if tagsSpec, ok := spec.(*TagsSpec); ok {
+		return s.updateTags(ctx, tagsSpec)
+	}
+
 	vmSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid vm specification")
 	}
 
-	klog.V(2).Infof("getting nic %s", vmSpec.NICName)
-	nicInterface, err := networkinterfaces.NewService(s.Scope).Get(ctx, &networkinterfaces.Spec{Name: vmSpec.NICName})
+	log.V(2).Info("getting nic", "name", vmSpec.NICName)
+	nicInterface, err := networkinterfaces.NewService(s.Scope).Get(ctx, &networkinterfaces.Spec{Name: vmSpec.NICName, ResourceGroup: vmSpec.NICResourceGroup})
 	if err != nil {
 		return err
 	}
@@ -123,9 +236,9 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 	if !ok {
 		return errors.New("error getting network security group")
 	}
-	klog.V(2).Infof("got nic %s", vmSpec.NICName)
+	log.V(2).Info("got nic", "name", vmSpec.NICName)
 
-	klog.V(2).Infof("creating vm %s ", vmSpec.Name)
+	log.V(2).Info("creating vm", "name", vmSpec.Name)
 
 	virtualMachine, err := s.deriveVirtualMachineParameters(vmSpec, nic)
 	if err != nil {
@@ -148,11 +261,229 @@ func (s *Service) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("successfully created vm %s ", vmSpec.Name)
+	log.V(2).Info("successfully created vm", "name", vmSpec.Name)
 	return err
 }
 
+// updateIdentity patches the identity of an existing VM.
+func (s *Service) updateIdentity(ctx context.Context, identitySpec *IdentitySpec) error {
+	log := klog.FromContext(ctx)
+	log.V(2).Info("updating identity of vm", "name", identitySpec.Name, "type", identitySpec.Identity.Type)
+	future, err := s.Client.Update(
+		ctx,
+		s.getResourceGroup(identitySpec.ResourceGroup),
+		identitySpec.Name,
+		compute.VirtualMachineUpdate{Identity: identitySpec.Identity})
+	if err != nil {
+		return fmt.Errorf("cannot update vm identity: %w", err)
+	}
+
+	// Do not wait until the operation completes. Just check the result
+	// so the call to Update actuator operation is async.
+	_, err = future.Result(s.Client)
+	if err != nil {
+		return err
+	}
+
+	log.V(2).Info("successfully updated identity of vm", "name", identitySpec.Name)
+	return nil
+}
+
+// updateTags patches the tags of an existing VM, leaving the rest of the VM as it is.
+func (s *Service) updateTags(ctx context.Context, tagsSpec *TagsSpec) error {
+	log := klog.FromContext(ctx)
+	log.V(2).Info("updating tags of vm", "name", tagsSpec.Name)
+	future, err := s.Client.Update(
+		ctx,
+		s.getResourceGroup(tagsSpec.ResourceGroup),
+		tagsSpec.Name,
+		compute.VirtualMachineUpdate{Tags: tagsSpec.Tags})
+	if err != nil {
+		return fmt.Errorf("cannot update vm tags: %w", err)
+	}
+
+	// Do not wait until the operation completes. Just check the result
+	// so the call to Update actuator operation is async.
+	_, err = future.Result(s.Client)
+	if err != nil {
+		return err
+	}
+
+	log.V(2).Info("successfully updated tags of vm", "name", tagsSpec.Name)
+	return nil
+}
+
+// updatePowerState deallocates or starts an existing VM. The operation is not waited for, the power
+// state of the VM is observed again on the next update of the machine.
+func (s *Service) updatePowerState(ctx context.Context, powerStateSpec *PowerStateSpec) error {
+	log := klog.FromContext(ctx)
+	if powerStateSpec.Deallocated {
+		log.V(2).Info("deallocating vm", "name", powerStateSpec.Name)
+		if _, err := s.Client.Deallocate(ctx, s.getResourceGroup(powerStateSpec.ResourceGroup), powerStateSpec.Name, nil); err != nil {
+			return fmt.Errorf("cannot deallocate vm: %w", err)
+		}
+		return nil
+	}
+
+	log.V(2).Info("starting vm", "name", powerStateSpec.Name)
+	if _, err := s.Client.Start(ctx, s.getResourceGroup(powerStateSpec.ResourceGroup), powerStateSpec.Name); err != nil {
+		return fmt.Errorf("cannot start vm: %w", err)
+	}
+	return nil
+}
+
+// updateDataDisksDeleteOption patches the delete option of the data disks attached to an existing VM.
+// The data disks of a VM are replaced as a whole on update, so the attached disks are read first
+// and patched back with only their delete option changed.
+func (s *Service) updateDataDisksDeleteOption(ctx context.Context, deleteOptionSpec *DataDisksDeleteOptionSpec) error {
+	log := klog.FromContext(ctx)
+	if len(deleteOptionSpec.DataDisks) == 0 {
+		return fmt.Errorf("vm %s has no data disks", deleteOptionSpec.Name)
+	}
+
+	dataDisks := applyDataDisksDeleteOption(deleteOptionSpec.DataDisks, deleteOptionSpec.DeleteOptions)
+
+	log.V(2).Info("updating data disks delete option of vm", "name", deleteOptionSpec.Name)
+	future, err := s.Client.Update(
+		ctx,
+		s.getResourceGroup(deleteOptionSpec.ResourceGroup),
+		deleteOptionSpec.Name,
+		compute.VirtualMachineUpdate{
+			VirtualMachineProperties: &compute.VirtualMachineProperties{
+				StorageProfile: &compute.StorageProfile{
+					DataDisks: &dataDisks,
+				},
+			},
+		})
+	if err != nil {
+		return fmt.Errorf("cannot update vm data disks: %w", err)
+	}
+
+	// Do not wait until the operation completes. Just check the result
+	// so the call to Update actuator operation is async.
+	_, err = future.Result(s.Client)
+	if err != nil {
+		return err
+	}
+
+	log.V(2).Info("successfully updated data disks delete option of vm", "name", deleteOptionSpec.Name)
+	return nil
+}
+
+// applyDataDisksDeleteOption returns a copy of the data disks with the delete option of
+// the disks named in deleteOptions replaced.
+func applyDataDisksDeleteOption(dataDisks []compute.DataDisk, deleteOptions map[string]compute.DiskDeleteOptionTypes) []compute.DataDisk {
+	updated := make([]compute.DataDisk, len(dataDisks))
+	for i, disk := range dataDisks {
+		updated[i] = disk
+		if disk.Name == nil {
+			continue
+		}
+		if deleteOption, ok := deleteOptions[*disk.Name]; ok {
+			updated[i].DeleteOption = deleteOption
+		}
+	}
+	return updated
+}
+
+// GenerateUserAssignedIdentityRemoval returns the identity to patch onto an existing VM to remove
+// the given user-assigned identity, or nil if the VM does not have it.
+// The other identities of the VM, system-assigned or user-assigned, are preserved.
+func GenerateUserAssignedIdentityRemoval(currentType string, currentUserAssignedIdentities []string, removedIdentity string) *compute.VirtualMachineIdentity {
+	var removed string
+	for _, id := range currentUserAssignedIdentities {
+		if strings.EqualFold(id, removedIdentity) {
+			removed = id
+			break
+		}
+	}
+	if removed == "" {
+		return nil
+	}
+
+	if len(currentUserAssignedIdentities) > 1 {
+		// A user-assigned identity set to null is removed from the VM by the PATCH.
+		return &compute.VirtualMachineIdentity{
+			Type: compute.ResourceIdentityType(currentType),
+			UserAssignedIdentities: map[string]*compute.VirtualMachineIdentityUserAssignedIdentitiesValue{
+				removed: nil,
+			},
+		}
+	}
+
+	// Azure rejects a UserAssigned identity type without any user-assigned identity,
+	// so removing the last one requires changing the identity type as well.
+	if strings.EqualFold(currentType, string(compute.ResourceIdentityTypeSystemAssigned)) ||
+		strings.EqualFold(currentType, string(compute.ResourceIdentityTypeSystemAssignedUserAssigned)) {
+		return &compute.VirtualMachineIdentity{
+			Type: compute.ResourceIdentityTypeSystemAssigned,
+		}
+	}
+
+	return &compute.VirtualMachineIdentity{
+		Type: compute.ResourceIdentityTypeNone,
+	}
+}
+
+// reservedAdminUsernames are the names Azure refuses as the administrator account of a VM.
+var reservedAdminUsernames = sets.NewString(
+	"1", "123", "a", "actuser", "adm", "admin", "admin1", "admin2", "administrator", "aspnet",
+	"backup", "console", "david", "guest", "john", "owner", "root", "server", "sql", "support",
+	"support_388945a0", "sys", "test", "test1", "test2", "test3", "user", "user1", "user2",
+	"user3", "user4", "user5",
+)
+
+const (
+	linuxAdminUsernameMaxLength   = 64
+	windowsAdminUsernameMaxLength = 20
+	windowsAdminUsernameInvalid   = `\/"[]:|<>+=;,?*@`
+)
+
+// linuxAdminUsernameRegexp matches the user names accepted by Azure for Linux VMs.
+var linuxAdminUsernameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+func getAdminUsername(vmSpec *Spec) string {
+	if vmSpec.AdminUsername == "" {
+		return azure.DefaultUserName
+	}
+	return vmSpec.AdminUsername
+}
+
+func validateAdminUsername(username string, osType string) error {
+	if reservedAdminUsernames.Has(strings.ToLower(username)) {
+		return apierrors.InvalidMachineConfiguration("admin username %q is reserved by Azure", username)
+	}
+
+	if strings.HasSuffix(username, ".") {
+		return apierrors.InvalidMachineConfiguration("admin username %q must not end with \".\"", username)
+	}
+
+	if compute.OperatingSystemTypes(osType) == compute.OperatingSystemTypesWindows {
+		if len(username) > windowsAdminUsernameMaxLength {
+			return apierrors.InvalidMachineConfiguration("admin username %q must be at most %d characters long", username, windowsAdminUsernameMaxLength)
+		}
+		if strings.ContainsAny(username, windowsAdminUsernameInvalid) {
+			return apierrors.InvalidMachineConfiguration("admin username %q must not contain any of the characters %s", username, windowsAdminUsernameInvalid)
+		}
+		return nil
+	}
+
+	if len(username) > linuxAdminUsernameMaxLength {
+		return apierrors.InvalidMachineConfiguration("admin username %q must be at most %d characters long", username, linuxAdminUsernameMaxLength)
+	}
+	if !linuxAdminUsernameRegexp.MatchString(username) {
+		return apierrors.InvalidMachineConfiguration("admin username %q must only contain letters, numbers, hyphens and underscores and must not start with a number or a hyphen", username)
+	}
+
+	return nil
+}
+
 func generateOSProfile(vmSpec *Spec) (*compute.OSProfile, error) {
+	adminUsername := getAdminUsername(vmSpec)
+	if err := validateAdminUsername(adminUsername, vmSpec.OSDisk.OSType); err != nil {
+		return nil, err
+	}
+
 	sshKeyData := vmSpec.SSHKeyData
 	if sshKeyData == "" && compute.OperatingSystemTypes(vmSpec.OSDisk.OSType) != compute.OperatingSystemTypesWindows {
 		privateKey, perr := rsa.GenerateKey(rand.Reader, 2048)
@@ -167,15 +498,19 @@ func generateOSProfile(vmSpec *Spec) (*compute.OSProfile, error) {
 		sshKeyData = string(ssh.MarshalAuthorizedKey(publicRsaKey))
 	}
 
-	randomPassword, err := GenerateRandomString(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate random string: %w", err)
+	adminPassword := vmSpec.AdminPassword
+	if adminPassword == "" {
+		randomPassword, err := GenerateRandomString(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random string: %w", err)
+		}
+		adminPassword = randomPassword
 	}
 
 	osProfile := &compute.OSProfile{
 		ComputerName:  to.StringPtr(vmSpec.Name),
-		AdminUsername: to.StringPtr(azure.DefaultUserName),
-		AdminPassword: to.StringPtr(randomPassword),
+		AdminUsername: to.StringPtr(adminUsername),
+		AdminPassword: to.StringPtr(adminPassword),
 	}
 
 	if compute.OperatingSystemTypes(vmSpec.OSDisk.OSType) == compute.OperatingSystemTypesWindows {
@@ -201,7 +536,7 @@ func generateOSProfile(vmSpec *Spec) (*compute.OSProfile, error) {
 			SSH: &compute.SSHConfiguration{
 				PublicKeys: &[]compute.SSHPublicKey{
 					{
-						Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", azure.DefaultUserName)),
+						Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", adminUsername)),
 						KeyData: to.StringPtr(sshKeyData),
 					},
 				},
@@ -216,6 +551,39 @@ func generateOSProfile(vmSpec *Spec) (*compute.OSProfile, error) {
 	return osProfile, nil
 }
 
+// ValidateSpec checks the image, OS disk security profile and data disks of the virtual machine
+// specification for the configuration errors CreateOrUpdate would fail with, without calling Azure.
+// All errors found are returned as an aggregate.
+func (s *Service) ValidateSpec(vmSpec *Spec) error {
+	var errs []error
+
+	if _, err := s.generateImageReference(vmSpec); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := generateSecurityProfile(vmSpec, generateOSDisk(vmSpec)); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateOSDiskCachingType(vmSpec.OSDisk); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := generateDataDisks(vmSpec); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateAdminUsername(getAdminUsername(vmSpec), vmSpec.OSDisk.OSType); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, _, _, err := getSpotVMOptions(s.Scope.MachineConfig.SpotVMOptions, vmSpec.EvictionPolicy, vmSpec.OSDisk); err != nil {
+		errs = append(errs, err)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
 // Derive virtual machine parameters for CreateOrUpdate API call based
 // on the provided virtual machine specification, resource location,
 // subscription ID, and the network interface.
@@ -225,16 +593,13 @@ func (s *Service) deriveVirtualMachineParameters(vmSpec *Spec, nic network.Inter
 		return nil, err
 	}
 
-	imageReference := &compute.ImageReference{
-		Publisher: to.StringPtr(vmSpec.Image.Publisher),
-		Offer:     to.StringPtr(vmSpec.Image.Offer),
-		Sku:       to.StringPtr(vmSpec.Image.SKU),
-		Version:   to.StringPtr(vmSpec.Image.Version),
+	imageReference, err := s.generateImageReference(vmSpec)
+	if err != nil {
+		return nil, err
 	}
-	if vmSpec.Image.ResourceID != "" {
-		imageReference = &compute.ImageReference{
-			ID: to.StringPtr(fmt.Sprintf("/subscriptions/%s%s", s.Scope.SubscriptionID, vmSpec.Image.ResourceID)),
-		}
+
+	if err := validateOSDiskCachingType(vmSpec.OSDisk); err != nil {
+		return nil, err
 	}
 
 	osDisk := generateOSDisk(vmSpec)
@@ -244,7 +609,7 @@ func (s *Service) deriveVirtualMachineParameters(vmSpec *Spec, nic network.Inter
 		return nil, err
 	}
 
-	priority, evictionPolicy, billingProfile, err := getSpotVMOptions(s.Scope.MachineConfig.SpotVMOptions)
+	priority, evictionPolicy, billingProfile, err := getSpotVMOptions(s.Scope.MachineConfig.SpotVMOptions, vmSpec.EvictionPolicy, vmSpec.OSDisk)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get Spot VM options %w", err)
 	}
@@ -287,35 +652,14 @@ func (s *Service) deriveVirtualMachineParameters(vmSpec *Spec, nic network.Inter
 	}
 
 	// Ephemeral storage related options
-	if vmSpec.OSDisk.CachingType != "" {
-		virtualMachine.VirtualMachineProperties.StorageProfile.OsDisk.Caching = compute.CachingTypes(vmSpec.OSDisk.CachingType)
-	}
 	if vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation == "Local" {
 		virtualMachine.VirtualMachineProperties.StorageProfile.OsDisk.DiffDiskSettings = &compute.DiffDiskSettings{
-			Option: compute.DiffDiskOptions(vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation),
+			Option:    compute.DiffDiskOptions(vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation),
+			Placement: vmSpec.EphemeralOSDiskPlacement,
 		}
 	}
 
-	// Enable/Disable UltraSSD Additional capabilities based on UltraSSDCapability
-	// If UltraSSDCapability is unset the presence of Ultra Disks as Data Disks will pilot the toggling
-	var ultraSSDEnabled *bool
-	switch vmSpec.UltraSSDCapability {
-	case machinev1.AzureUltraSSDCapabilityDisabled:
-		ultraSSDEnabled = to.BoolPtr(false)
-	case machinev1.AzureUltraSSDCapabilityEnabled:
-		ultraSSDEnabled = to.BoolPtr(true)
-	default:
-		for _, dataDisk := range vmSpec.DataDisks {
-			if dataDisk.ManagedDisk.StorageAccountType == machinev1.StorageAccountUltraSSDLRS &&
-				vmSpec.UltraSSDCapability != machinev1.AzureUltraSSDCapabilityDisabled {
-				ultraSSDEnabled = to.BoolPtr(true)
-			}
-		}
-	}
-
-	virtualMachine.VirtualMachineProperties.AdditionalCapabilities = &compute.AdditionalCapabilities{
-		UltraSSDEnabled: ultraSSDEnabled,
-	}
+	virtualMachine.VirtualMachineProperties.AdditionalCapabilities = generateAdditionalCapabilities(vmSpec)
 
 	if vmSpec.ManagedIdentity != "" {
 		virtualMachine.Identity = &compute.VirtualMachineIdentity{
@@ -337,6 +681,12 @@ func (s *Service) deriveVirtualMachineParameters(vmSpec *Spec, nic network.Inter
 		}
 	}
 
+	if vmSpec.ProximityPlacementGroupID != "" {
+		virtualMachine.ProximityPlacementGroup = &compute.SubResource{
+			ID: to.StringPtr(vmSpec.ProximityPlacementGroupID),
+		}
+	}
+
 	// configure capacity reservation ID
 	if vmSpec.CapacityReservationGroupID != "" {
 		virtualMachine.VirtualMachineProperties.CapacityReservation = &compute.CapacityReservationProfile{
@@ -346,23 +696,57 @@ func (s *Service) deriveVirtualMachineParameters(vmSpec *Spec, nic network.Inter
 		}
 	}
 
+	if vmSpec.UserData != "" {
+		virtualMachine.VirtualMachineProperties.UserData = to.StringPtr(vmSpec.UserData)
+	}
+
 	return virtualMachine, nil
 }
 
+// generateAdditionalCapabilities composes all the additional capabilities of the VM
+// into a single struct, so that enabling one capability never overwrites another.
+func generateAdditionalCapabilities(vmSpec *Spec) *compute.AdditionalCapabilities {
+	return &compute.AdditionalCapabilities{
+		UltraSSDEnabled:    getUltraSSDEnabled(vmSpec),
+		HibernationEnabled: vmSpec.HibernationEnabled,
+	}
+}
+
+// getUltraSSDEnabled enables/disables the UltraSSD capability based on UltraSSDCapability.
+// If UltraSSDCapability is unset the presence of Ultra Disks as Data Disks will pilot the toggling.
+func getUltraSSDEnabled(vmSpec *Spec) *bool {
+	switch vmSpec.UltraSSDCapability {
+	case machinev1.AzureUltraSSDCapabilityDisabled:
+		return to.BoolPtr(false)
+	case machinev1.AzureUltraSSDCapabilityEnabled:
+		return to.BoolPtr(true)
+	}
+
+	for _, dataDisk := range vmSpec.DataDisks {
+		if dataDisk.ManagedDisk.StorageAccountType == machinev1.StorageAccountUltraSSDLRS {
+			return to.BoolPtr(true)
+		}
+	}
+
+	return nil
+}
+
 // Delete deletes the virtual network with the provided name.
 func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	vmSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid vm Specification")
 	}
-	klog.V(2).Infof("deleting vm %s ", vmSpec.Name)
-	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, vmSpec.Name, nil)
+	resourceGroup := s.getResourceGroup(vmSpec.ResourceGroup)
+	log.V(2).Info("deleting vm", "name", vmSpec.Name)
+	future, err := s.Client.Delete(ctx, resourceGroup, vmSpec.Name, nil)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete vm %s in resource group %s: %w", vmSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete vm %s in resource group %s: %w", vmSpec.Name, resourceGroup, err)
 	}
 
 	// Do not wait until the operation completes. Just check the result
@@ -372,7 +756,7 @@ func (s *Service) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("successfully deleted vm %s ", vmSpec.Name)
+	log.V(2).Info("successfully deleted vm", "name", vmSpec.Name)
 	return err
 }
 
@@ -395,25 +779,200 @@ func availabilitySetID(subscriptionID, resourceGroup, availabilitySetName string
 	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/availabilitySets/%s", subscriptionID, resourceGroup, availabilitySetName)
 }
 
-func getSpotVMOptions(spotVMOptions *machinev1.SpotVMOptions) (compute.VirtualMachinePriorityTypes, compute.VirtualMachineEvictionPolicyTypes, *compute.BillingProfile, error) {
+// getSpotVMOptions returns the priority, eviction policy and billing profile of the VM. The eviction policy
+// defaults to Deallocate when empty.
+func getSpotVMOptions(spotVMOptions *machinev1.SpotVMOptions, evictionPolicy compute.VirtualMachineEvictionPolicyTypes, osDisk machinev1.OSDisk) (compute.VirtualMachinePriorityTypes, compute.VirtualMachineEvictionPolicyTypes, *compute.BillingProfile, error) {
 	// Spot VM not requested, return zero values to apply defaults
 	if spotVMOptions == nil {
 		return compute.VirtualMachinePriorityTypes(""), compute.VirtualMachineEvictionPolicyTypes(""), nil, nil
 	}
+
+	// We use the deallocate eviction policy by default, it was the only supported eviction policy for Single Instance Spot VMs
+	// https://github.com/openshift/enhancements/blob/master/enhancements/machine-api/spot-instances.md#eviction-policies
+	switch evictionPolicy {
+	case "":
+		evictionPolicy = compute.VirtualMachineEvictionPolicyTypesDeallocate
+	case compute.VirtualMachineEvictionPolicyTypesDeallocate, compute.VirtualMachineEvictionPolicyTypesDelete:
+	default:
+		return compute.VirtualMachinePriorityTypes(""), compute.VirtualMachineEvictionPolicyTypes(""), nil,
+			apierrors.InvalidMachineConfiguration("Invalid value EvictionPolicy: %q. Valid values are %v.", evictionPolicy, compute.PossibleVirtualMachineEvictionPolicyTypesValues())
+	}
+
+	// The OS disk of a deallocated VM is lost when it is ephemeral, so Azure only allows ephemeral OS disks
+	// on Spot VMs which are deleted on eviction.
+	if evictionPolicy == compute.VirtualMachineEvictionPolicyTypesDeallocate && osDisk.DiskSettings.EphemeralStorageLocation == "Local" {
+		return compute.VirtualMachinePriorityTypes(""), compute.VirtualMachineEvictionPolicyTypes(""), nil,
+			apierrors.InvalidMachineConfiguration("Spot VMs with an ephemeral OS disk must use the %s eviction policy, got %s.", compute.VirtualMachineEvictionPolicyTypesDelete, evictionPolicy)
+	}
+
 	var billingProfile *compute.BillingProfile
 	if spotVMOptions.MaxPrice != nil && spotVMOptions.MaxPrice.AsDec().String() != "" {
 		maxPrice, err := strconv.ParseFloat(spotVMOptions.MaxPrice.AsDec().String(), 64)
 		if err != nil {
 			return compute.VirtualMachinePriorityTypes(""), compute.VirtualMachineEvictionPolicyTypes(""), nil, err
 		}
+		// -1 is the only negative max price accepted by Azure, it caps the price at the on-demand price.
+		if maxPrice < 0 && maxPrice != -1 {
+			return compute.VirtualMachinePriorityTypes(""), compute.VirtualMachineEvictionPolicyTypes(""), nil,
+				apierrors.InvalidMachineConfiguration("Invalid value MaxPrice: %g. Valid values are -1 or a price not lower than 0.", maxPrice)
+		}
 		billingProfile = &compute.BillingProfile{
 			MaxPrice: &maxPrice,
 		}
 	}
 
-	// We should use deallocate eviction policy it's - "the only supported eviction policy for Single Instance Spot VMs"
-	// https://github.com/openshift/enhancements/blob/master/enhancements/machine-api/spot-instances.md#eviction-policies
-	return compute.VirtualMachinePriorityTypesSpot, compute.VirtualMachineEvictionPolicyTypesDeallocate, billingProfile, nil
+	return compute.VirtualMachinePriorityTypesSpot, evictionPolicy, billingProfile, nil
+}
+
+// generateImageReference returns the image reference for the VM based on the image type.
+func (s *Service) generateImageReference(vmSpec *Spec) (*compute.ImageReference, error) {
+	if vmSpec.Image.Type == AzureImageTypeGallery {
+		galleryImageID := vmSpec.Image.ResourceID
+		if !strings.HasPrefix(strings.ToLower(galleryImageID), "/subscriptions/") {
+			galleryImageID = fmt.Sprintf("/subscriptions/%s%s", s.Scope.SubscriptionID, galleryImageID)
+		}
+
+		if err := validateGalleryImageID(galleryImageID); err != nil {
+			return nil, apierrors.InvalidMachineConfiguration("failed to create VM %s: %v", vmSpec.Name, err)
+		}
+
+		return &compute.ImageReference{
+			ID: to.StringPtr(galleryImageID),
+		}, nil
+	}
+
+	if vmSpec.Image.Type == AzureImageTypeCommunityGallery {
+		if err := validateCommunityGalleryImageID(vmSpec.Image.ResourceID); err != nil {
+			return nil, apierrors.InvalidMachineConfiguration("failed to create VM %s: %v", vmSpec.Name, err)
+		}
+
+		return &compute.ImageReference{
+			CommunityGalleryImageID: to.StringPtr(vmSpec.Image.ResourceID),
+		}, nil
+	}
+
+	if vmSpec.Image.Type == AzureImageTypeSharedGallery {
+		if err := validateSharedGalleryImageID(vmSpec.Image.ResourceID); err != nil {
+			return nil, apierrors.InvalidMachineConfiguration("failed to create VM %s: %v", vmSpec.Name, err)
+		}
+
+		return &compute.ImageReference{
+			SharedGalleryImageID: to.StringPtr(vmSpec.Image.ResourceID),
+		}, nil
+	}
+
+	if vmSpec.Image.ResourceID != "" {
+		return &compute.ImageReference{
+			ID: to.StringPtr(fmt.Sprintf("/subscriptions/%s%s", s.Scope.SubscriptionID, vmSpec.Image.ResourceID)),
+		}, nil
+	}
+
+	if err := validateImagePublisher(vmSpec, s.Scope.AllowedImagePublishers); err != nil {
+		return nil, err
+	}
+
+	if err := validateImageVersion(vmSpec.Image.Version, vmSpec.Image.Type); err != nil {
+		return nil, apierrors.InvalidMachineConfiguration("failed to create VM %s: %v", vmSpec.Name, err)
+	}
+
+	return &compute.ImageReference{
+		Publisher: to.StringPtr(vmSpec.Image.Publisher),
+		Offer:     to.StringPtr(vmSpec.Image.Offer),
+		Sku:       to.StringPtr(vmSpec.Image.SKU),
+		Version:   to.StringPtr(vmSpec.Image.Version),
+	}, nil
+}
+
+// validateImagePublisher rejects marketplace images of publishers missing from a non-empty allow-list.
+func validateImagePublisher(vmSpec *Spec, allowedPublishers []string) error {
+	if len(allowedPublishers) == 0 {
+		return nil
+	}
+
+	for _, publisher := range allowedPublishers {
+		if strings.EqualFold(publisher, vmSpec.Image.Publisher) {
+			return nil
+		}
+	}
+
+	return apierrors.InvalidMachineConfiguration("failed to create VM %s: image publisher %q is not allowed, allowed publishers are %v",
+		vmSpec.Name, vmSpec.Image.Publisher, allowedPublishers)
+}
+
+var (
+	galleryImageIDRegexp          = regexp.MustCompile(`(?i)^/subscriptions/[^/]+/resourceGroups/[^/]+/providers/Microsoft\.Compute/galleries/[^/]+/images/[^/]+(?:/versions/([^/]+))?$`)
+	communityGalleryImageIDRegexp = regexp.MustCompile(`(?i)^/CommunityGalleries/[^/]+/Images/[^/]+(?:/Versions/([^/]+))?$`)
+	sharedGalleryImageIDRegexp    = regexp.MustCompile(`(?i)^/SharedGalleries/[^/]+/Images/[^/]+(?:/Versions/([^/]+))?$`)
+)
+
+// validateGalleryImageID checks the shape of an Azure Compute Gallery image or image version resource ID.
+// Azure uses the latest image version when the ID refers to the image definition.
+func validateGalleryImageID(id string) error {
+	match := galleryImageIDRegexp.FindStringSubmatch(id)
+	if match == nil {
+		return fmt.Errorf("invalid gallery image ID %q, expected format "+
+			"/subscriptions/<subscriptionID>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/galleries/<gallery>/images/<image>[/versions/<version>]", id)
+	}
+	return validateImageVersion(match[1], AzureImageTypeGallery)
+}
+
+// validateCommunityGalleryImageID checks the shape of a community gallery image or image version ID.
+func validateCommunityGalleryImageID(id string) error {
+	match := communityGalleryImageIDRegexp.FindStringSubmatch(id)
+	if match == nil {
+		return fmt.Errorf("invalid community gallery image ID %q, expected format "+
+			"/CommunityGalleries/<publicGalleryName>/Images/<image>[/Versions/<version>]", id)
+	}
+	return validateImageVersion(match[1], AzureImageTypeCommunityGallery)
+}
+
+// validateSharedGalleryImageID checks the shape of a directly shared gallery image or image version ID.
+func validateSharedGalleryImageID(id string) error {
+	match := sharedGalleryImageIDRegexp.FindStringSubmatch(id)
+	if match == nil {
+		return fmt.Errorf("invalid shared gallery image ID %q, expected format "+
+			"/SharedGalleries/<galleryUniqueName>/Images/<image>[/Versions/<version>]", id)
+	}
+	return validateImageVersion(match[1], AzureImageTypeSharedGallery)
+}
+
+// latestImageVersion selects the most recent version of an image.
+const latestImageVersion = "latest"
+
+var (
+	// Gallery image versions are in the MajorVersion.MinorVersion.Patch format.
+	galleryImageVersionRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+	// Marketplace image versions are in the Major.Minor.Build format, optionally followed by a revision.
+	marketplaceImageVersionRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+(?:\.\d+)?$`)
+)
+
+// validateImageVersion checks that an image version is either latest or follows
+// the version format of the image type. An empty version is left to Azure.
+func validateImageVersion(version string, imageType machinev1.AzureImageType) error {
+	if version == "" || version == latestImageVersion {
+		return nil
+	}
+
+	if isGalleryImageType(imageType) {
+		if !galleryImageVersionRegexp.MatchString(version) {
+			return fmt.Errorf("invalid image version %q, expected %s or a version in the X.Y.Z format", version, latestImageVersion)
+		}
+		return nil
+	}
+
+	if !marketplaceImageVersionRegexp.MatchString(version) {
+		return fmt.Errorf("invalid image version %q, expected %s or a version in the X.Y.Z or X.Y.Z.W format", version, latestImageVersion)
+	}
+	return nil
+}
+
+// isGalleryImageType returns true if the image type references an Azure Compute Gallery image.
+func isGalleryImageType(imageType machinev1.AzureImageType) bool {
+	switch imageType {
+	case AzureImageTypeGallery, AzureImageTypeCommunityGallery, AzureImageTypeSharedGallery:
+		return true
+	}
+	return false
 }
 
 func generateImagePlan(image machinev1.Image) *compute.Plan {
@@ -422,6 +981,11 @@ func generateImagePlan(image machinev1.Image) *compute.Plan {
 		return nil
 	}
 
+	// Gallery images carry their purchase plan on the image definition.
+	if isGalleryImageType(image.Type) {
+		return nil
+	}
+
 	if image.Publisher == "" || image.SKU == "" || image.Offer == "" {
 		return nil
 	}
@@ -435,11 +999,20 @@ func generateImagePlan(image machinev1.Image) *compute.Plan {
 
 func generateOSDisk(vmSpec *Spec) *compute.OSDisk {
 	osDisk := &compute.OSDisk{
-		Name:         to.StringPtr(fmt.Sprintf("%s_OSDisk", vmSpec.Name)),
+		Name:         to.StringPtr(azure.GenerateOSDiskName(vmSpec.Name)),
 		OsType:       compute.OperatingSystemTypes(vmSpec.OSDisk.OSType),
 		CreateOption: compute.DiskCreateOptionTypesFromImage,
 		ManagedDisk:  &compute.ManagedDiskParameters{},
 		DiskSizeGB:   to.Int32Ptr(vmSpec.OSDisk.DiskSizeGB),
+		Caching:      getOSDiskCachingType(vmSpec.OSDisk),
+	}
+
+	if vmSpec.OSDiskWriteAccelerated {
+		osDisk.WriteAcceleratorEnabled = to.BoolPtr(true)
+	}
+
+	if vmSpec.OSDiskDeletionPolicy != "" {
+		osDisk.DeleteOption = compute.DiskDeleteOptionTypes(vmSpec.OSDiskDeletionPolicy)
 	}
 
 	if vmSpec.OSDisk.ManagedDisk.StorageAccountType != "" {
@@ -461,6 +1034,42 @@ func generateOSDisk(vmSpec *Spec) *compute.OSDisk {
 	return osDisk
 }
 
+// getOSDiskCachingType returns the caching type of the OS disk. When it is not set, ephemeral OS disks are
+// cached read-only, which is the only caching they support, and managed OS disks are cached read-write.
+func getOSDiskCachingType(osDisk machinev1.OSDisk) compute.CachingTypes {
+	if osDisk.CachingType != "" {
+		return compute.CachingTypes(osDisk.CachingType)
+	}
+
+	if osDisk.DiskSettings.EphemeralStorageLocation == "Local" {
+		return compute.CachingTypesReadOnly
+	}
+
+	return compute.CachingTypesReadWrite
+}
+
+// validateOSDiskCachingType makes sure an ephemeral OS disk is not requested without caching,
+// as ephemeral OS disks are stored on the local storage of the VM host through its cache.
+func validateOSDiskCachingType(osDisk machinev1.OSDisk) error {
+	if osDisk.DiskSettings.EphemeralStorageLocation == "Local" && compute.CachingTypes(osDisk.CachingType) == compute.CachingTypesNone {
+		return apierrors.InvalidMachineConfiguration("Invalid value OSDisk CachingType: %q. Ephemeral OS disks must use %q caching.",
+			osDisk.CachingType, compute.CachingTypesReadOnly)
+	}
+
+	return nil
+}
+
+// EffectiveSecurityType returns the security type applied to the VM created from the specification.
+// It is empty for standard VMs without a security type.
+func EffectiveSecurityType(vmSpec *Spec) (compute.SecurityTypes, error) {
+	securityProfile, err := generateSecurityProfile(vmSpec, generateOSDisk(vmSpec))
+	if err != nil || securityProfile == nil {
+		return "", err
+	}
+
+	return securityProfile.SecurityType, nil
+}
+
 func generateSecurityProfile(vmSpec *Spec, osDisk *compute.OSDisk) (*compute.SecurityProfile, error) {
 	if vmSpec.SecurityProfile == nil {
 		return nil, nil
@@ -480,6 +1089,12 @@ func generateSecurityProfile(vmSpec *Spec, osDisk *compute.OSDisk) (*compute.Sec
 				vmSpec.Name, compute.SecurityTypesConfidentialVM)
 		}
 
+		if !isKnownSecurityEncryptionType(osDisk.ManagedDisk.SecurityProfile.SecurityEncryptionType) {
+			return nil, apierrors.InvalidMachineConfiguration("failed to generate security profile for vm %s. "+
+				"Invalid value SecurityEncryptionType: %q. Valid values are %v.",
+				vmSpec.Name, osDisk.ManagedDisk.SecurityProfile.SecurityEncryptionType, compute.PossibleSecurityEncryptionTypesValues())
+		}
+
 		if vmSpec.SecurityProfile.Settings.ConfidentialVM == nil {
 			return nil, apierrors.InvalidMachineConfiguration("failed to generate security profile for vm %s. "+
 				"UEFISettings should be set when SecurityEncryptionType is defined.", vmSpec.Name)
@@ -517,6 +1132,12 @@ func generateSecurityProfile(vmSpec *Spec, osDisk *compute.OSDisk) (*compute.Sec
 		return securityProfile, nil
 	}
 
+	if vmSpec.SecurityProfile.Settings.SecurityType == machinev1.SecurityTypesConfidentialVM {
+		return nil, apierrors.InvalidMachineConfiguration("failed to generate security profile for vm %s. "+
+			"SecurityEncryptionType should be defined on the OS disk when SecurityType is set to %s.",
+			vmSpec.Name, compute.SecurityTypesConfidentialVM)
+	}
+
 	if vmSpec.SecurityProfile.Settings.SecurityType == machinev1.SecurityTypesTrustedLaunch && vmSpec.SecurityProfile.Settings.TrustedLaunch == nil {
 		return nil, apierrors.InvalidMachineConfiguration("failed to generate security profile for vm %s. "+
 			"UEFISettings should be set when SecurityType is set to %s.",
@@ -559,69 +1180,108 @@ func generateDataDisks(vmSpec *Spec) ([]compute.DataDisk, error) {
 	// and can only contain letters, numbers, underscores, periods or hyphens.
 	reg := regexp.MustCompile(`^[a-zA-Z0-9](?:[\w\.-]*[a-zA-Z0-9])?$`)
 	dataDisks := make([]compute.DataDisk, len(vmSpec.DataDisks))
+	fromImageLuns := sets.New(vmSpec.DataDisksFromImage...)
+	writeAcceleratedLuns := sets.New(vmSpec.WriteAcceleratedDataDisks...)
+	// All the problems found across the data disks are collected, so that they can be fixed at once.
+	var problems []string
 
 	for i, disk := range vmSpec.DataDisks {
 		dataDiskName := azure.GenerateDataDiskName(vmSpec.Name, disk.NameSuffix)
 
+		if disk.ManagedDisk.StorageAccountType != "" && !IsKnownStorageAccountType(string(disk.ManagedDisk.StorageAccountType)) {
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
+				"Invalid value `storageAccountType`: \"%s\". Valid values are %v.",
+				dataDiskName, vmSpec.Name, disk.ManagedDisk.StorageAccountType, compute.PossibleStorageAccountTypesValues()))
+		}
+
 		if len(dataDiskName) > 80 {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"The overall disk name name must not exceed 80 chars in length. Check your `nameSuffix`.",
-				dataDiskName, vmSpec.Name)
+				dataDiskName, vmSpec.Name))
 		}
 
 		if matched := reg.MatchString(disk.NameSuffix); !matched {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"The nameSuffix can only contain letters, numbers, "+
 				"underscores, periods or hyphens. Check your `nameSuffix`.",
-				dataDiskName, vmSpec.Name)
+				dataDiskName, vmSpec.Name))
+		}
+
+		if isReservedDataDiskNameSuffix(disk.NameSuffix) {
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
+				"The nameSuffix must not be %q or end with %q, as it would collide with the OS disk naming. Check your `nameSuffix`.",
+				dataDiskName, vmSpec.Name, azure.OSDiskNameSuffix, "_"+azure.OSDiskNameSuffix))
 		}
 
 		if disk.DiskSizeGB < 4 {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"`diskSizeGB`: %d, is invalid, disk size must be greater or equal than 4.",
-				dataDiskName, vmSpec.Name, disk.DiskSizeGB)
+				dataDiskName, vmSpec.Name, disk.DiskSizeGB))
 		}
 
 		if _, exists := seenDataDiskNames[disk.NameSuffix]; exists {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"A Data Disk with `nameSuffix`: %s, already exists. `nameSuffix` must be unique.",
-				dataDiskName, vmSpec.Name, disk.NameSuffix)
+				dataDiskName, vmSpec.Name, disk.NameSuffix))
 		}
 
 		if (disk.ManagedDisk.StorageAccountType == machinev1.StorageAccountUltraSSDLRS) &&
 			(disk.CachingType != machinev1.CachingTypeNone && disk.CachingType != "") {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"`cachingType`: %s, is not supported for Data Disk of `storageAccountType`: \"%s\". "+
 				"Use `storageAccountType`: \"%s\" instead.",
-				dataDiskName, vmSpec.Name, disk.CachingType, machinev1.StorageAccountUltraSSDLRS, machinev1.CachingTypeNone)
+				dataDiskName, vmSpec.Name, disk.CachingType, machinev1.StorageAccountUltraSSDLRS, machinev1.CachingTypeNone))
 		}
 
 		if disk.Lun < 0 || disk.Lun > 63 {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"Invalid value `lun`: %d. `lun` cannot be lower than 0 or higher than 63.",
-				dataDiskName, vmSpec.Name, disk.Lun)
+				dataDiskName, vmSpec.Name, disk.Lun))
 		}
 
 		if _, exists := seenDataDiskLuns[disk.Lun]; exists {
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"A Data Disk with `lun`: %d, already exists. `lun` must be unique.",
-				dataDiskName, vmSpec.Name, disk.Lun)
+				dataDiskName, vmSpec.Name, disk.Lun))
 		}
 
 		switch disk.DeletionPolicy {
 		case machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach:
 			// valid
 		default:
-			return nil, apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk: %s for vm %s. "+
 				"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
-				dataDiskName, vmSpec.Name, disk.DeletionPolicy, machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)
+				dataDiskName, vmSpec.Name, disk.DeletionPolicy, machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach))
 		}
 
 		seenDataDiskNames[disk.NameSuffix] = struct{}{}
 		seenDataDiskLuns[disk.Lun] = struct{}{}
 
+		if attachedDiskID, ok := vmSpec.AttachedDataDisks[disk.Lun]; ok {
+			attachedDisk, err := generateAttachedDataDisk(vmSpec, disk, attachedDiskID)
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			if fromImageLuns.Has(disk.Lun) {
+				problems = append(problems, fmt.Sprintf("failed to attach Data Disk: %s for vm %s. "+
+					"A Data Disk with `lun`: %d, can not be both attached from an existing disk and created from the image.",
+					attachedDiskID, vmSpec.Name, disk.Lun))
+			}
+			if writeAcceleratedLuns.Has(disk.Lun) {
+				attachedDisk.WriteAcceleratorEnabled = to.BoolPtr(true)
+			}
+			dataDisks[i] = attachedDisk
+			continue
+		}
+
+		createOption := compute.DiskCreateOptionTypesEmpty
+		if fromImageLuns.Has(disk.Lun) {
+			createOption = compute.DiskCreateOptionTypesFromImage
+		}
+
 		dataDisks[i] = compute.DataDisk{
-			CreateOption: compute.DiskCreateOptionTypesEmpty,
+			CreateOption: createOption,
 			DiskSizeGB:   to.Int32Ptr(disk.DiskSizeGB),
 			Lun:          to.Int32Ptr(disk.Lun),
 			Name:         to.StringPtr(dataDiskName),
@@ -629,6 +1289,10 @@ func generateDataDisks(vmSpec *Spec) ([]compute.DataDisk, error) {
 			DeleteOption: compute.DiskDeleteOptionTypes(disk.DeletionPolicy),
 		}
 
+		if writeAcceleratedLuns.Has(disk.Lun) {
+			dataDisks[i].WriteAcceleratorEnabled = to.BoolPtr(true)
+		}
+
 		dataDisks[i].ManagedDisk = &compute.ManagedDiskParameters{
 			StorageAccountType: compute.StorageAccountTypes(disk.ManagedDisk.StorageAccountType),
 		}
@@ -640,5 +1304,82 @@ func generateDataDisks(vmSpec *Spec) ([]compute.DataDisk, error) {
 		}
 	}
 
+	for _, lun := range sets.List(fromImageLuns) {
+		if _, exists := seenDataDiskLuns[lun]; !exists {
+			problems = append(problems, fmt.Sprintf("failed to create Data Disk from image for vm %s. "+
+				"No Data Disk with `lun`: %d, is defined.",
+				vmSpec.Name, lun))
+		}
+	}
+
+	for _, lun := range sets.List(sets.KeySet(vmSpec.AttachedDataDisks)) {
+		if _, exists := seenDataDiskLuns[lun]; !exists {
+			problems = append(problems, fmt.Sprintf("failed to attach Data Disk: %s for vm %s. "+
+				"No Data Disk with `lun`: %d, is defined.",
+				vmSpec.AttachedDataDisks[lun], vmSpec.Name, lun))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, apierrors.InvalidMachineConfiguration("%s", strings.Join(problems, "; "))
+	}
+
 	return dataDisks, nil
 }
+
+// generateAttachedDataDisk returns the data disk attaching the existing managed disk with the given resource ID.
+// The size and the storage account type of the existing disk are kept, and the disk is always detached when
+// the VM is deleted, so that the data on it outlives the machine.
+func generateAttachedDataDisk(vmSpec *Spec, disk machinev1.DataDisk, id string) (compute.DataDisk, error) {
+	resourceID, err := autorestazure.ParseResourceID(id)
+	if err != nil {
+		return compute.DataDisk{}, fmt.Errorf("failed to attach Data Disk: %s for vm %s. "+
+			"The resource ID of the disk is invalid: %v", id, vmSpec.Name, err)
+	}
+
+	if disk.DeletionPolicy != machinev1.DiskDeletionPolicyTypeDetach {
+		return compute.DataDisk{}, fmt.Errorf("failed to attach Data Disk: %s for vm %s. "+
+			"Invalid value `deletionPolicy`: \"%s\". Attached Data Disks must use \"%s\", so that they are not deleted with the vm.",
+			id, vmSpec.Name, disk.DeletionPolicy, machinev1.DiskDeletionPolicyTypeDetach)
+	}
+
+	return compute.DataDisk{
+		CreateOption: compute.DiskCreateOptionTypesAttach,
+		Lun:          to.Int32Ptr(disk.Lun),
+		Name:         to.StringPtr(resourceID.ResourceName),
+		Caching:      compute.CachingTypes(disk.CachingType),
+		DeleteOption: compute.DiskDeleteOptionTypesDetach,
+		ManagedDisk: &compute.ManagedDiskParameters{
+			ID: to.StringPtr(id),
+		},
+	}, nil
+}
+
+// isKnownSecurityEncryptionType reports whether the given OS disk security encryption type is supported by Azure.
+func isKnownSecurityEncryptionType(securityEncryptionType compute.SecurityEncryptionTypes) bool {
+	for _, known := range compute.PossibleSecurityEncryptionTypesValues() {
+		if securityEncryptionType == known {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKnownStorageAccountType reports whether the given storage account type is supported by Azure.
+func IsKnownStorageAccountType(storageAccountType string) bool {
+	for _, known := range compute.PossibleStorageAccountTypesValues() {
+		if strings.EqualFold(storageAccountType, string(known)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReservedDataDiskNameSuffix reports whether the given data disk nameSuffix
+// would produce a name following the OS disk naming pattern. Azure resource names
+// are case-insensitive, so the comparison is done case-insensitively.
+func isReservedDataDiskNameSuffix(nameSuffix string) bool {
+	suffix := strings.ToLower(nameSuffix)
+	reserved := strings.ToLower(azure.OSDiskNameSuffix)
+	return suffix == reserved || strings.HasSuffix(suffix, "_"+reserved)
+}
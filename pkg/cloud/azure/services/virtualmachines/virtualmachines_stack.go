@@ -22,10 +22,13 @@ import (
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/compute/mgmt/compute"
 	"github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/network/mgmt/network"
 	"github.com/Azure/go-autorest/autorest/to"
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/networkinterfaces"
 	"golang.org/x/crypto/ssh"
@@ -38,9 +41,13 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 	if !ok {
 		return compute.VirtualMachine{}, errors.New("invalid vm specification")
 	}
-	vm, err := s.Client.Get(ctx, s.Scope.MachineConfig.ResourceGroup, vmSpec.Name, compute.InstanceView)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if vmSpec.ResourceGroup != "" {
+		resourceGroup = vmSpec.ResourceGroup
+	}
+	vm, err := s.Client.Get(ctx, resourceGroup, vmSpec.Name, compute.InstanceView)
 	if err != nil && azure.ResourceNotFound(err) {
-		klog.Warningf("vm %s not found: %v", vmSpec.Name, err)
+		klog.FromContext(ctx).Info("vm not found", "name", vmSpec.Name, "err", err)
 		return nil, err
 	} else if err != nil {
 		return vm, err
@@ -50,13 +57,18 @@ func (s *StackHubService) Get(ctx context.Context, spec azure.Spec) (interface{}
 
 // CreateOrUpdate creates or updates a virtual network.
 func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
+	if tagsSpec, ok := spec.(*TagsSpec); ok {
+		return s.updateTags(ctx, tagsSpec)
+	}
+
 	vmSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid vm specification")
 	}
 
-	klog.V(2).Infof("getting nic %s", vmSpec.NICName)
-	nicInterface, err := networkinterfaces.NewService(s.Scope).Get(ctx, &networkinterfaces.Spec{Name: vmSpec.NICName})
+	log.V(2).Info("getting nic", "name", vmSpec.NICName)
+	nicInterface, err := networkinterfaces.NewService(s.Scope).Get(ctx, &networkinterfaces.Spec{Name: vmSpec.NICName, ResourceGroup: vmSpec.NICResourceGroup})
 	if err != nil {
 		return err
 	}
@@ -64,9 +76,9 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 	if !ok {
 		return errors.New("error getting network security group3")
 	}
-	klog.V(2).Infof("got nic %s", vmSpec.NICName)
+	log.V(2).Info("got nic", "name", vmSpec.NICName)
 
-	klog.V(2).Infof("creating vm %s ", vmSpec.Name)
+	log.V(2).Info("creating vm", "name", vmSpec.Name)
 
 	virtualMachine, err := s.deriveVirtualMachineParametersStackHub(vmSpec, nic)
 	if err != nil {
@@ -89,11 +101,40 @@ func (s *StackHubService) CreateOrUpdate(ctx context.Context, spec azure.Spec) e
 		return err
 	}
 
-	klog.V(2).Infof("successfully created vm %s ", vmSpec.Name)
+	log.V(2).Info("successfully created vm", "name", vmSpec.Name)
 	return err
 }
 
+// updateTags patches the tags of an existing VM, leaving the rest of the VM as it is.
+func (s *StackHubService) updateTags(ctx context.Context, tagsSpec *TagsSpec) error {
+	log := klog.FromContext(ctx)
+	log.V(2).Info("updating tags of vm", "name", tagsSpec.Name)
+	future, err := s.Client.Update(
+		ctx,
+		s.Scope.MachineConfig.ResourceGroup,
+		tagsSpec.Name,
+		compute.VirtualMachineUpdate{Tags: tagsSpec.Tags})
+	if err != nil {
+		return fmt.Errorf("cannot update vm tags: %w", err)
+	}
+
+	// Do not wait until the operation completes. Just check the result
+	// so the call to Update actuator operation is async.
+	_, err = future.Result(s.Client)
+	if err != nil {
+		return err
+	}
+
+	log.V(2).Info("successfully updated tags of vm", "name", tagsSpec.Name)
+	return nil
+}
+
 func generateOSProfileStackHub(vmSpec *Spec) (*compute.OSProfile, error) {
+	adminUsername := getAdminUsername(vmSpec)
+	if err := validateAdminUsername(adminUsername, vmSpec.OSDisk.OSType); err != nil {
+		return nil, err
+	}
+
 	sshKeyData := vmSpec.SSHKeyData
 	if sshKeyData == "" && compute.OperatingSystemTypes(vmSpec.OSDisk.OSType) != compute.Windows {
 		privateKey, perr := rsa.GenerateKey(rand.Reader, 2048)
@@ -108,15 +149,19 @@ func generateOSProfileStackHub(vmSpec *Spec) (*compute.OSProfile, error) {
 		sshKeyData = string(ssh.MarshalAuthorizedKey(publicRsaKey))
 	}
 
-	randomPassword, err := GenerateRandomString(32)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate random string: %w", err)
+	adminPassword := vmSpec.AdminPassword
+	if adminPassword == "" {
+		randomPassword, err := GenerateRandomString(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate random string: %w", err)
+		}
+		adminPassword = randomPassword
 	}
 
 	osProfile := &compute.OSProfile{
 		ComputerName:  to.StringPtr(vmSpec.Name),
-		AdminUsername: to.StringPtr(azure.DefaultUserName),
-		AdminPassword: to.StringPtr(randomPassword),
+		AdminUsername: to.StringPtr(adminUsername),
+		AdminPassword: to.StringPtr(adminPassword),
 	}
 
 	if compute.OperatingSystemTypes(vmSpec.OSDisk.OSType) == compute.Windows {
@@ -142,7 +187,7 @@ func generateOSProfileStackHub(vmSpec *Spec) (*compute.OSProfile, error) {
 			SSH: &compute.SSHConfiguration{
 				PublicKeys: &[]compute.SSHPublicKey{
 					{
-						Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", azure.DefaultUserName)),
+						Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", adminUsername)),
 						KeyData: to.StringPtr(sshKeyData),
 					},
 				},
@@ -157,10 +202,46 @@ func generateOSProfileStackHub(vmSpec *Spec) (*compute.OSProfile, error) {
 	return osProfile, nil
 }
 
+// validateStackHubSpec returns an error listing the features requested for the virtual machine which
+// Azure Stack Hub does not support, instead of creating a virtual machine without them.
+func (s *StackHubService) validateStackHubSpec(vmSpec *Spec) error {
+	var unsupported []string
+	if vmSpec.UltraSSDCapability == machinev1.AzureUltraSSDCapabilityEnabled {
+		unsupported = append(unsupported, "ultraSSDCapability")
+	}
+	if vmSpec.SecurityProfile != nil {
+		if to.Bool(vmSpec.SecurityProfile.EncryptionAtHost) {
+			unsupported = append(unsupported, "securityProfile.encryptionAtHost")
+		}
+		if vmSpec.SecurityProfile.Settings.SecurityType != "" {
+			unsupported = append(unsupported, "securityProfile.settings.securityType")
+		}
+	}
+	if vmSpec.CapacityReservationGroupID != "" {
+		unsupported = append(unsupported, "capacityReservationGroupID")
+	}
+	if s.Scope.MachineConfig.SpotVMOptions != nil {
+		unsupported = append(unsupported, "spotVMOptions")
+	}
+	if vmSpec.UserData != "" {
+		unsupported = append(unsupported, "userData")
+	}
+
+	if len(unsupported) > 0 {
+		return apierrors.InvalidMachineConfiguration("failed to create VM %s: %s not supported on Azure Stack Hub",
+			vmSpec.Name, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
 // Derive virtual machine parameters for CreateOrUpdate API call based
 // on the provided virtual machine specification, resource location,
 // subscription ID, and the network interface.
 func (s *StackHubService) deriveVirtualMachineParametersStackHub(vmSpec *Spec, nic network.Interface) (*compute.VirtualMachine, error) {
+	if err := s.validateStackHubSpec(vmSpec); err != nil {
+		return nil, err
+	}
+
 	osProfile, err := generateOSProfileStackHub(vmSpec)
 	if err != nil {
 		return nil, err
@@ -176,6 +257,10 @@ func (s *StackHubService) deriveVirtualMachineParametersStackHub(vmSpec *Spec, n
 		imageReference = &compute.ImageReference{
 			ID: to.StringPtr(fmt.Sprintf("/subscriptions/%s%s", s.Scope.SubscriptionID, vmSpec.Image.ResourceID)),
 		}
+	} else if err := validateImagePublisher(vmSpec, s.Scope.AllowedImagePublishers); err != nil {
+		return nil, err
+	} else if err := validateImageVersion(vmSpec.Image.Version, vmSpec.Image.Type); err != nil {
+		return nil, apierrors.InvalidMachineConfiguration("failed to create VM %s: %v", vmSpec.Name, err)
 	}
 
 	virtualMachine := &compute.VirtualMachine{
@@ -227,18 +312,23 @@ func (s *StackHubService) deriveVirtualMachineParametersStackHub(vmSpec *Spec, n
 
 // Delete deletes the virtual network with the provided name.
 func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
+	log := klog.FromContext(ctx)
 	vmSpec, ok := spec.(*Spec)
 	if !ok {
 		return errors.New("invalid vm Specification")
 	}
-	klog.V(2).Infof("deleting vm %s ", vmSpec.Name)
-	future, err := s.Client.Delete(ctx, s.Scope.MachineConfig.ResourceGroup, vmSpec.Name)
+	resourceGroup := s.Scope.MachineConfig.ResourceGroup
+	if vmSpec.ResourceGroup != "" {
+		resourceGroup = vmSpec.ResourceGroup
+	}
+	log.V(2).Info("deleting vm", "name", vmSpec.Name)
+	future, err := s.Client.Delete(ctx, resourceGroup, vmSpec.Name)
 	if err != nil && azure.ResourceNotFound(err) {
 		// already deleted
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to delete vm %s in resource group %s: %w", vmSpec.Name, s.Scope.MachineConfig.ResourceGroup, err)
+		return fmt.Errorf("failed to delete vm %s in resource group %s: %w", vmSpec.Name, resourceGroup, err)
 	}
 
 	// Do not wait until the operation completes. Just check the result
@@ -248,6 +338,6 @@ func (s *StackHubService) Delete(ctx context.Context, spec azure.Spec) error {
 		return err
 	}
 
-	klog.V(2).Infof("successfully deleted vm %s ", vmSpec.Name)
+	log.V(2).Info("successfully deleted vm", "name", vmSpec.Name)
 	return err
 }
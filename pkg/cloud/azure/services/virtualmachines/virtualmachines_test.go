@@ -3,14 +3,17 @@ package virtualmachines
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
+	stacknetwork "github.com/Azure/azure-sdk-for-go/profiles/2019-03-01/network/mgmt/network"
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2021-11-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2021-02-01/network"
 	"github.com/Azure/go-autorest/autorest/to"
 	. "github.com/onsi/gomega"
 	machinev1 "github.com/openshift/api/machine/v1beta1"
 	apierrors "github.com/openshift/machine-api-operator/pkg/controller/machine"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure"
 	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/utils/ptr"
@@ -18,10 +21,11 @@ import (
 
 func TestDeriveVirtualMachineParameters(t *testing.T) {
 	testCases := []struct {
-		name          string
-		updateSpec    func(*Spec)
-		validate      func(*WithT, *compute.VirtualMachine)
-		expectedError error
+		name                   string
+		updateSpec             func(*Spec)
+		allowedImagePublishers []string
+		validate               func(*WithT, *compute.VirtualMachine)
+		expectedError          error
 	}{
 		{
 			name:       "Unspecified security profile",
@@ -160,6 +164,77 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 				"SecurityType should be set to %s when SecurityEncryptionType is defined.",
 				machinev1.SecurityTypesConfidentialVM),
 		},
+		{
+			name: "Error when security type is ConfidentialVM and security encryption type is not set",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{
+					Settings: machinev1.SecuritySettings{
+						SecurityType: machinev1.SecurityTypesConfidentialVM,
+						ConfidentialVM: &machinev1.ConfidentialVM{
+							UEFISettings: machinev1.UEFISettings{
+								VirtualizedTrustedPlatformModule: machinev1.VirtualizedTrustedPlatformModulePolicyEnabled,
+							},
+						},
+					},
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to generate security profile for vm testvm. "+
+				"SecurityEncryptionType should be defined on the OS disk when SecurityType is set to %s.",
+				machinev1.SecurityTypesConfidentialVM),
+		},
+		{
+			name: "Error when security type is ConfidentialVM and the OS disk only sets a confidential disk encryption set",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.OSDisk = machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						SecurityProfile: machinev1.VMDiskSecurityProfile{
+							DiskEncryptionSet: machinev1.DiskEncryptionSetParameters{ID: "des-id"},
+						},
+					},
+				}
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{
+					Settings: machinev1.SecuritySettings{
+						SecurityType: machinev1.SecurityTypesConfidentialVM,
+						ConfidentialVM: &machinev1.ConfidentialVM{
+							UEFISettings: machinev1.UEFISettings{
+								VirtualizedTrustedPlatformModule: machinev1.VirtualizedTrustedPlatformModulePolicyEnabled,
+							},
+						},
+					},
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to generate security profile for vm testvm. "+
+				"SecurityEncryptionType should be defined on the OS disk when SecurityType is set to %s.",
+				machinev1.SecurityTypesConfidentialVM),
+		},
+		{
+			name: "Error when security type is ConfidentialVM and security encryption type is invalid",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.OSDisk = machinev1.OSDisk{
+					ManagedDisk: machinev1.OSDiskManagedDiskParameters{
+						SecurityProfile: machinev1.VMDiskSecurityProfile{
+							SecurityEncryptionType: "DiskOnly",
+						},
+					},
+				}
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{
+					Settings: machinev1.SecuritySettings{
+						SecurityType: machinev1.SecurityTypesConfidentialVM,
+						ConfidentialVM: &machinev1.ConfidentialVM{
+							UEFISettings: machinev1.UEFISettings{
+								VirtualizedTrustedPlatformModule: machinev1.VirtualizedTrustedPlatformModulePolicyEnabled,
+							},
+						},
+					},
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to generate security profile for vm testvm. "+
+				"Invalid value SecurityEncryptionType: %q. Valid values are %v.",
+				"DiskOnly", compute.PossibleSecurityEncryptionTypesValues()),
+		},
 		{
 			name: "Error when security profile with security encryption type is set and UEFISettings is not set",
 			updateSpec: func(vmSpec *Spec) {
@@ -292,6 +367,47 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 				"SecurityType should be set to %s when UEFISettings are defined.",
 				machinev1.SecurityTypesTrustedLaunch),
 		},
+		{
+			name:       "OS disk deletion policy unset",
+			updateSpec: nil,
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DeleteOption).To(BeEmpty())
+			},
+		},
+		{
+			name: "OS disk deletion policy Detach",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDiskDeletionPolicy = machinev1.DiskDeletionPolicyTypeDetach
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DeleteOption).To(Equal(compute.DiskDeleteOptionTypesDetach))
+			},
+		},
+		{
+			name: "OS disk deletion policy Delete",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDiskDeletionPolicy = machinev1.DiskDeletionPolicyTypeDelete
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DeleteOption).To(Equal(compute.DiskDeleteOptionTypesDelete))
+			},
+		},
+		{
+			name:       "No user data",
+			updateSpec: nil,
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.UserData).To(BeNil())
+			},
+		},
+		{
+			name: "User data",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.UserData = "dXNlci1kYXRh"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.UserData).To(Equal(to.StringPtr("dXNlci1kYXRh")))
+			},
+		},
 		{
 			name:       "Non-ThirdParty Marketplace Image",
 			updateSpec: nil,
@@ -309,6 +425,108 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 
 			},
 		},
+		{
+			name: "Gallery Image with full resource ID",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeGallery,
+					ResourceID: "/subscriptions/226e02ba-43d1-43d3-a02a-19e584a4ef67/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/rhcos/versions/1.0.0",
+					Publisher:  "Red Hat Inc",
+					Offer:      "ubi",
+					SKU:        "ubi7",
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Plan).To(BeNil())
+				g.Expect(vm.StorageProfile.ImageReference).To(Equal(&compute.ImageReference{
+					ID: to.StringPtr("/subscriptions/226e02ba-43d1-43d3-a02a-19e584a4ef67/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/rhcos/versions/1.0.0"),
+				}))
+			},
+		},
+		{
+			name: "Gallery Image with resource ID relative to the subscription",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeGallery,
+					ResourceID: "/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/rhcos",
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Plan).To(BeNil())
+				g.Expect(vm.StorageProfile.ImageReference).To(Equal(&compute.ImageReference{
+					ID: to.StringPtr("/subscriptions/226e02ba-43d1-43d3-a02a-19e584a4ef67/resourceGroups/images/providers/Microsoft.Compute/galleries/gallery/images/rhcos"),
+				}))
+			},
+		},
+		{
+			name: "Error when Gallery Image resource ID is not a gallery image",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeGallery,
+					ResourceID: "/resourceGroups/images/providers/Microsoft.Compute/images/rhcos",
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM testvm: invalid gallery image ID %q, expected format "+
+				"/subscriptions/<subscriptionID>/resourceGroups/<resourceGroup>/providers/Microsoft.Compute/galleries/<gallery>/images/<image>[/versions/<version>]",
+				"/subscriptions/226e02ba-43d1-43d3-a02a-19e584a4ef67/resourceGroups/images/providers/Microsoft.Compute/images/rhcos"),
+		},
+		{
+			name: "Community Gallery Image",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeCommunityGallery,
+					ResourceID: "/CommunityGalleries/rhcos-1234/Images/rhcos/Versions/latest",
+					Publisher:  "Red Hat Inc",
+					Offer:      "ubi",
+					SKU:        "ubi7",
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Plan).To(BeNil())
+				g.Expect(vm.StorageProfile.ImageReference).To(Equal(&compute.ImageReference{
+					CommunityGalleryImageID: to.StringPtr("/CommunityGalleries/rhcos-1234/Images/rhcos/Versions/latest"),
+				}))
+			},
+		},
+		{
+			name: "Error when Community Gallery Image ID is invalid",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeCommunityGallery,
+					ResourceID: "/SharedGalleries/rhcos-1234/Images/rhcos",
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM testvm: invalid community gallery image ID %q, expected format "+
+				"/CommunityGalleries/<publicGalleryName>/Images/<image>[/Versions/<version>]", "/SharedGalleries/rhcos-1234/Images/rhcos"),
+		},
+		{
+			name: "Shared Gallery Image",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					Type:       AzureImageTypeSharedGallery,
+					ResourceID: "/SharedGalleries/1234-rhcos/Images/rhcos",
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Plan).To(BeNil())
+				g.Expect(vm.StorageProfile.ImageReference).To(Equal(&compute.ImageReference{
+					SharedGalleryImageID: to.StringPtr("/SharedGalleries/1234-rhcos/Images/rhcos"),
+				}))
+			},
+		},
+		{
+			name: "Error when Shared Gallery Image ID is invalid",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.Image = machinev1.Image{
+					Type: AzureImageTypeSharedGallery,
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM testvm: invalid shared gallery image ID %q, expected format "+
+				"/SharedGalleries/<galleryUniqueName>/Images/<image>[/Versions/<version>]", ""),
+		},
 		{
 			name: "AdditionalCapabilities.UltraSSDEnabled to true with an Ultra Disk Data Disk",
 			updateSpec: func(vmSpec *Spec) {
@@ -385,6 +603,49 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 				g.Expect(*vm.AdditionalCapabilities.UltraSSDEnabled).To(BeFalse())
 			},
 		},
+		{
+			name: "AdditionalCapabilities.HibernationEnabled to true",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.HibernationEnabled = to.BoolPtr(true)
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.AdditionalCapabilities.UltraSSDEnabled).To(BeNil())
+				g.Expect(*vm.AdditionalCapabilities.HibernationEnabled).To(BeTrue())
+			},
+		},
+		{
+			name: "AdditionalCapabilities with both UltraSSDEnabled and HibernationEnabled",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.UltraSSDCapability = machinev1.AzureUltraSSDCapabilityEnabled
+				vmSpec.HibernationEnabled = to.BoolPtr(true)
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(*vm.AdditionalCapabilities.UltraSSDEnabled).To(BeTrue())
+				g.Expect(*vm.AdditionalCapabilities.HibernationEnabled).To(BeTrue())
+			},
+		},
+		{
+			name: "AdditionalCapabilities with Ultra Disks and HibernationEnabled disabled",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.HibernationEnabled = to.BoolPtr(false)
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "test",
+						DiskSizeGB: 4,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+						},
+						CachingType:    machinev1.CachingTypeNone,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(*vm.AdditionalCapabilities.UltraSSDEnabled).To(BeTrue())
+				g.Expect(*vm.AdditionalCapabilities.HibernationEnabled).To(BeFalse())
+			},
+		},
 		{
 			name: "AdditionalCapabilities.UltraSSDEnabled to nil with a non Ultra Disk Data Disk",
 			updateSpec: func(vmSpec *Spec) {
@@ -594,130 +855,366 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 					"testvm"+"_"+"qwkuid031j3x3fxktj9saez28zoo2843jkl35w3ner90i9wvwkqphau1l5y7j7k3750960btqljnlthoq", "testvm")),
 		},
 		{
-			name: "Error when Data Disk is Ultra Disk and cachingType not None",
+			name: "Error when Data Disk nameSuffix collides with the OS disk name",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
 				vmSpec.DataDisks = []machinev1.DataDisk{
 					{
-						NameSuffix: "datadisk-test",
+						NameSuffix: "osdisk",
 						DiskSizeGB: 4,
 						Lun:        0,
 						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
-							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+							StorageAccountType: machinev1.StorageAccountPremiumLRS,
 						},
-						CachingType:    machinev1.CachingTypeReadOnly,
 						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
 					},
 				}
 			},
 			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
 				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
-					"`cachingType`: %s, is not supported for Data Disk of `storageAccountType`: \"%s\". "+
-					"Use `storageAccountType`: \"%s\" instead.",
-					"testvm"+"_"+"datadisk-test", "testvm",
-					machinev1.CachingTypeReadOnly, machinev1.StorageAccountUltraSSDLRS, machinev1.CachingTypeNone)),
+					"The nameSuffix must not be %q or end with %q, as it would collide with the OS disk naming. Check your `nameSuffix`.",
+					"testvm"+"_"+"osdisk", "testvm", "OSDisk", "_OSDisk")),
 		},
 		{
-			name: "Error when Data Disk is smaller than 4GB",
+			name: "Error when Data Disk nameSuffix produces an OSDisk-like name",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
 				vmSpec.DataDisks = []machinev1.DataDisk{
 					{
-						NameSuffix: "datadisk-test",
-						DiskSizeGB: 3,
+						NameSuffix: "data_OSDisk",
+						DiskSizeGB: 4,
 						Lun:        0,
 						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
-							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+							StorageAccountType: machinev1.StorageAccountPremiumLRS,
 						},
-						CachingType:    machinev1.CachingTypeReadOnly,
 						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
 					},
 				}
 			},
 			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
 				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
-					"`diskSizeGB`: %d, is invalid, disk size must be greater or equal than 4.",
-					"testvm"+"_"+"datadisk-test", "testvm", 3)),
+					"The nameSuffix must not be %q or end with %q, as it would collide with the OS disk naming. Check your `nameSuffix`.",
+					"testvm"+"_"+"data_OSDisk", "testvm", "OSDisk", "_OSDisk")),
 		},
 		{
-			name: "Error when Data Disk deletionPolicy is invalid",
+			name: "Data Disk nameSuffix containing OSDisk in the middle is allowed",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
 				vmSpec.DataDisks = []machinev1.DataDisk{
 					{
-						NameSuffix: "datadisk-test",
+						NameSuffix: "OSDisk-data",
 						DiskSizeGB: 4,
 						Lun:        0,
 						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
-							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+							StorageAccountType: machinev1.StorageAccountPremiumLRS,
 						},
-						DeletionPolicy: "bla",
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
 					},
 				}
 			},
-			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
-				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
-					"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
-					"testvm"+"_"+"datadisk-test", "testvm",
-					"bla", machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(*vm.StorageProfile.DataDisks).To(HaveLen(1))
+				g.Expect(*(*vm.StorageProfile.DataDisks)[0].Name).To(Equal("testvm_OSDisk-data"))
+			},
 		},
 		{
-			name: "Error when Data Disk deletionPolicy is empty",
+			name: "Data Disk created from the image data disk",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
 				vmSpec.DataDisks = []machinev1.DataDisk{
 					{
-						NameSuffix: "datadisk-test",
-						DiskSizeGB: 4,
-						Lun:        0,
-						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
-							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
-						},
-						DeletionPolicy: "",
+						NameSuffix:     "empty",
+						DiskSizeGB:     4,
+						Lun:            0,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+					{
+						NameSuffix:     "fromimage",
+						DiskSizeGB:     64,
+						Lun:            1,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
 					},
 				}
+				vmSpec.DataDisksFromImage = []int32{1}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(*vm.StorageProfile.DataDisks).To(HaveLen(2))
+				g.Expect((*vm.StorageProfile.DataDisks)[0].CreateOption).To(Equal(compute.DiskCreateOptionTypesEmpty))
+				g.Expect((*vm.StorageProfile.DataDisks)[1].CreateOption).To(Equal(compute.DiskCreateOptionTypesFromImage))
+				g.Expect(*(*vm.StorageProfile.DataDisks)[1].Lun).To(BeEquivalentTo(1))
 			},
-			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
-				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
-					"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
-					"testvm"+"_"+"datadisk-test", "testvm",
-					"", machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
 		},
 		{
-			name: "user-tags not configured",
+			name: "Error when a Data Disk from image has no matching Data Disk lun",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
-				vmSpec.Tags = map[string]*string{
-					"kubernetes.io_cluster.test": to.StringPtr("owned"),
-				}
-			},
-			validate: func(g *WithT, vm *compute.VirtualMachine) {
-				g.Expect(vm.Tags).Should(Equal(map[string]*string{"kubernetes.io_cluster.test": to.StringPtr("owned")}))
+				vmSpec.DataDisksFromImage = []int32{2}
 			},
-			expectedError: nil,
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk from image for vm %s. "+
+					"No Data Disk with `lun`: %d, is defined.",
+					"testvm", 2)),
 		},
 		{
-			name: "user-tags configured",
+			name: "Data Disk attached from an existing disk",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
-				vmSpec.Tags = map[string]*string{
-					"kubernetes.io_cluster.test": to.StringPtr("owned"),
-					"created-by":                 to.StringPtr("ocp"),
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix:     "empty",
+						DiskSizeGB:     4,
+						Lun:            0,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+					{
+						NameSuffix:     "attached",
+						DiskSizeGB:     64,
+						Lun:            1,
+						CachingType:    machinev1.CachingTypeReadOnly,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDetach,
+					},
+				}
+				vmSpec.AttachedDataDisks = map[int32]string{
+					1: "/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk",
 				}
 			},
 			validate: func(g *WithT, vm *compute.VirtualMachine) {
-				g.Expect(vm.Tags).Should(Equal(map[string]*string{
-					"kubernetes.io_cluster.test": to.StringPtr("owned"),
-					"created-by":                 to.StringPtr("ocp"),
+				g.Expect(*vm.StorageProfile.DataDisks).To(HaveLen(2))
+				g.Expect((*vm.StorageProfile.DataDisks)[0].CreateOption).To(Equal(compute.DiskCreateOptionTypesEmpty))
+				g.Expect(*(*vm.StorageProfile.DataDisks)[0].Name).To(Equal("testvm_empty"))
+				g.Expect((*vm.StorageProfile.DataDisks)[1]).To(Equal(compute.DataDisk{
+					CreateOption: compute.DiskCreateOptionTypesAttach,
+					Lun:          to.Int32Ptr(1),
+					Name:         to.StringPtr("persistent-disk"),
+					Caching:      compute.CachingTypesReadOnly,
+					DeleteOption: compute.DiskDeleteOptionTypesDetach,
+					ManagedDisk: &compute.ManagedDiskParameters{
+						ID: to.StringPtr("/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk"),
+					},
 				}))
 			},
-			expectedError: nil,
 		},
 		{
-			name: "capacity reservation group ID should be configured if the string is non empty",
+			name: "Error when an attached Data Disk is deleted with the vm",
 			updateSpec: func(vmSpec *Spec) {
 				vmSpec.Name = "testvm"
-				vmSpec.CapacityReservationGroupID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix:     "attached",
+						DiskSizeGB:     64,
+						Lun:            0,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+				vmSpec.AttachedDataDisks = map[int32]string{
+					0: "/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk",
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to attach Data Disk: %s for vm %s. "+
+					"Invalid value `deletionPolicy`: \"%s\". Attached Data Disks must use \"%s\", so that they are not deleted with the vm.",
+					"/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk", "testvm",
+					machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
+		},
+		{
+			name: "Error when an attached Data Disk has no matching Data Disk lun",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.AttachedDataDisks = map[int32]string{
+					2: "/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk",
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to attach Data Disk: %s for vm %s. "+
+					"No Data Disk with `lun`: %d, is defined.",
+					"/subscriptions/123/resourceGroups/test-rg/providers/Microsoft.Compute/disks/persistent-disk", "testvm", 2)),
+		},
+		{
+			name: "Error when Data Disk is Ultra Disk and cachingType not None",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+						},
+						CachingType:    machinev1.CachingTypeReadOnly,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"`cachingType`: %s, is not supported for Data Disk of `storageAccountType`: \"%s\". "+
+					"Use `storageAccountType`: \"%s\" instead.",
+					"testvm"+"_"+"datadisk-test", "testvm",
+					machinev1.CachingTypeReadOnly, machinev1.StorageAccountUltraSSDLRS, machinev1.CachingTypeNone)),
+		},
+		{
+			name: "Error when Data Disk is smaller than 4GB",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 3,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+						},
+						CachingType:    machinev1.CachingTypeReadOnly,
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"`diskSizeGB`: %d, is invalid, disk size must be greater or equal than 4.; "+
+					"failed to create Data Disk: %s for vm %s. "+
+					"`cachingType`: %s, is not supported for Data Disk of `storageAccountType`: \"%s\". "+
+					"Use `storageAccountType`: \"%s\" instead.",
+					"testvm"+"_"+"datadisk-test", "testvm", 3,
+					"testvm"+"_"+"datadisk-test", "testvm", machinev1.CachingTypeReadOnly, machinev1.StorageAccountUltraSSDLRS, machinev1.CachingTypeNone)),
+		},
+		{
+			name: "Error when Data Disk storageAccountType is unknown",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: "Unknown_LRS",
+						},
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"Invalid value `storageAccountType`: \"%s\". Valid values are %v.",
+					"testvm"+"_"+"datadisk-test", "testvm", "Unknown_LRS", compute.PossibleStorageAccountTypesValues())),
+		},
+		{
+			name: "Error lists the problems of all Data Disks at once",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        64,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountPremiumLRS,
+						},
+						DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete,
+					},
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        1,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountPremiumLRS,
+						},
+						DeletionPolicy: "Invalid",
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"Invalid value `lun`: %d. `lun` cannot be lower than 0 or higher than 63.; "+
+					"failed to create Data Disk: %s for vm %s. "+
+					"A Data Disk with `nameSuffix`: %s, already exists. `nameSuffix` must be unique.; "+
+					"failed to create Data Disk: %s for vm %s. "+
+					"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
+					"testvm"+"_"+"datadisk-test", "testvm", 64,
+					"testvm"+"_"+"datadisk-test", "testvm", "datadisk-test",
+					"testvm"+"_"+"datadisk-test", "testvm", "Invalid", machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
+		},
+		{
+			name: "Error when Data Disk deletionPolicy is invalid",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+						},
+						DeletionPolicy: "bla",
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
+					"testvm"+"_"+"datadisk-test", "testvm",
+					"bla", machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
+		},
+		{
+			name: "Error when Data Disk deletionPolicy is empty",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.DataDisks = []machinev1.DataDisk{
+					{
+						NameSuffix: "datadisk-test",
+						DiskSizeGB: 4,
+						Lun:        0,
+						ManagedDisk: machinev1.DataDiskManagedDiskParameters{
+							StorageAccountType: machinev1.StorageAccountUltraSSDLRS,
+						},
+						DeletionPolicy: "",
+					},
+				}
+			},
+			expectedError: fmt.Errorf("failed to generate data disk spec: %w",
+				apierrors.InvalidMachineConfiguration("failed to create Data Disk: %s for vm %s. "+
+					"Invalid value `deletionPolicy`: \"%s\". Valid values are \"%s\",\"%s\".",
+					"testvm"+"_"+"datadisk-test", "testvm",
+					"", machinev1.DiskDeletionPolicyTypeDelete, machinev1.DiskDeletionPolicyTypeDetach)),
+		},
+		{
+			name: "user-tags not configured",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.Tags = map[string]*string{
+					"kubernetes.io_cluster.test": to.StringPtr("owned"),
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Tags).Should(Equal(map[string]*string{"kubernetes.io_cluster.test": to.StringPtr("owned")}))
+			},
+			expectedError: nil,
+		},
+		{
+			name: "user-tags configured",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.Tags = map[string]*string{
+					"kubernetes.io_cluster.test": to.StringPtr("owned"),
+					"created-by":                 to.StringPtr("ocp"),
+				}
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.Tags).Should(Equal(map[string]*string{
+					"kubernetes.io_cluster.test": to.StringPtr("owned"),
+					"created-by":                 to.StringPtr("ocp"),
+				}))
+			},
+			expectedError: nil,
+		},
+		{
+			name: "capacity reservation group ID should be configured if the string is non empty",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Name = "testvm"
+				vmSpec.CapacityReservationGroupID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"
 			},
 			validate: func(g *WithT, vm *compute.VirtualMachine) {
 				g.Expect(*vm.VirtualMachineProperties.CapacityReservation.CapacityReservationGroup.ID).Should(Equal("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/capacityReservationGroups/myCapacityReservationGroup"))
@@ -733,7 +1230,231 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 			validate: func(g *WithT, vm *compute.VirtualMachine) {
 				g.Expect(vm.VirtualMachineProperties.CapacityReservation).To(BeNil())
 			},
-			expectedError: nil,
+			expectedError: nil,
+		},
+		{
+			name: "Ephemeral OS disk placed on the resource disk",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+				vmSpec.EphemeralOSDiskPlacement = compute.DiffDiskPlacementResourceDisk
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DiffDiskSettings).To(Equal(&compute.DiffDiskSettings{
+					Option:    compute.DiffDiskOptionsLocal,
+					Placement: compute.DiffDiskPlacementResourceDisk,
+				}))
+			},
+		},
+		{
+			name: "Ephemeral OS disk placed on the cache disk",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+				vmSpec.EphemeralOSDiskPlacement = compute.DiffDiskPlacementCacheDisk
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DiffDiskSettings).To(Equal(&compute.DiffDiskSettings{
+					Option:    compute.DiffDiskOptionsLocal,
+					Placement: compute.DiffDiskPlacementCacheDisk,
+				}))
+			},
+		},
+		{
+			name: "Ephemeral OS disk placement left for Azure to choose",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.DiffDiskSettings).To(Equal(&compute.DiffDiskSettings{
+					Option: compute.DiffDiskOptionsLocal,
+				}))
+			},
+		},
+		{
+			name: "Managed OS disk cached read-write by default",
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.Caching).To(Equal(compute.CachingTypesReadWrite))
+			},
+		},
+		{
+			name: "Ephemeral OS disk cached read-only by default",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.Caching).To(Equal(compute.CachingTypesReadOnly))
+			},
+		},
+		{
+			name: "OS disk caching type set in the spec",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.CachingType = "None"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.OsDisk.Caching).To(Equal(compute.CachingTypesNone))
+			},
+		},
+		{
+			name: "Error when an ephemeral OS disk is not cached",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.DiskSettings.EphemeralStorageLocation = "Local"
+				vmSpec.OSDisk.CachingType = "None"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("Invalid value OSDisk CachingType: %q. Ephemeral OS disks must use %q caching.",
+				"None", compute.CachingTypesReadOnly),
+		},
+		{
+			name: "Proximity placement group ID should be configured if the string is non empty",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.ProximityPlacementGroupID = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/proximityPlacementGroups/myProximityPlacementGroup"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.VirtualMachineProperties.ProximityPlacementGroup).ToNot(BeNil())
+				g.Expect(*vm.VirtualMachineProperties.ProximityPlacementGroup.ID).To(Equal("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myResourceGroupName/providers/Microsoft.Compute/proximityPlacementGroups/myProximityPlacementGroup"))
+			},
+		},
+		{
+			name:       "Proximity placement group should be nil if the string is empty",
+			updateSpec: nil,
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.VirtualMachineProperties.ProximityPlacementGroup).To(BeNil())
+			},
+		},
+		{
+			name:       "Default admin username",
+			updateSpec: nil,
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.OsProfile.AdminUsername).To(Equal(to.StringPtr(azure.DefaultUserName)))
+				g.Expect((*vm.OsProfile.LinuxConfiguration.SSH.PublicKeys)[0].Path).To(Equal(to.StringPtr("/home/capi/.ssh/authorized_keys")))
+			},
+		},
+		{
+			name: "Custom admin username",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.AdminUsername = "core"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.OsProfile.AdminUsername).To(Equal(to.StringPtr("core")))
+				g.Expect((*vm.OsProfile.LinuxConfiguration.SSH.PublicKeys)[0].Path).To(Equal(to.StringPtr("/home/core/.ssh/authorized_keys")))
+			},
+		},
+		{
+			name: "Custom admin username on Windows",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.OSType = "Windows"
+				vmSpec.AdminUsername = "winadmin"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.OsProfile.AdminUsername).To(Equal(to.StringPtr("winadmin")))
+				g.Expect(vm.OsProfile.WindowsConfiguration).ToNot(BeNil())
+			},
+		},
+		{
+			name: "Admin password on Windows",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.OSType = "Windows"
+				vmSpec.AdminPassword = "stored-password"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.OsProfile.AdminPassword).To(Equal(to.StringPtr("stored-password")))
+				g.Expect(*(*vm.OsProfile.WindowsConfiguration.AdditionalUnattendContent)[0].Content).To(ContainSubstring("stored-password"))
+			},
+		},
+		{
+			name:                   "Marketplace image of an allowed publisher",
+			allowedImagePublishers: []string{"RedHat", "red hat inc"},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.ImageReference.Publisher).To(Equal(to.StringPtr("Red Hat Inc")))
+			},
+		},
+		{
+			name:                   "Marketplace image of a denied publisher",
+			allowedImagePublishers: []string{"RedHat"},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM %s: image publisher %q is not allowed, allowed publishers are %v",
+				"my-awesome-machine", "Red Hat Inc", []string{"RedHat"}),
+		},
+		{
+			name: "Gallery image is not subject to the publisher allow-list",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					ResourceID: "/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0",
+					Type:       AzureImageTypeGallery,
+				}
+			},
+			allowedImagePublishers: []string{"RedHat"},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.ImageReference.ID).ToNot(BeNil())
+				g.Expect(vm.StorageProfile.ImageReference.Publisher).To(BeNil())
+			},
+		},
+		{
+			name: "Image resource ID is not subject to the publisher allow-list",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					ResourceID: "/resourceGroups/rg/providers/Microsoft.Compute/images/image",
+				}
+			},
+			allowedImagePublishers: []string{"RedHat"},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.ImageReference.ID).ToNot(BeNil())
+			},
+		},
+		{
+			name: "Marketplace image with a version",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image.Version = "413.92.2023101700"
+			},
+			validate: func(g *WithT, vm *compute.VirtualMachine) {
+				g.Expect(vm.StorageProfile.ImageReference.Version).To(Equal(to.StringPtr("413.92.2023101700")))
+			},
+		},
+		{
+			name: "Marketplace image with a malformed version",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image.Version = "1.2"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: invalid image version \"1.2\", expected latest or a version in the X.Y.Z or X.Y.Z.W format"),
+		},
+		{
+			name: "Gallery image with a malformed version",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					ResourceID: "/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0.1",
+					Type:       AzureImageTypeGallery,
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: invalid image version \"1.0.0.1\", expected latest or a version in the X.Y.Z format"),
+		},
+		{
+			name: "Community gallery image with a malformed version",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.Image = machinev1.Image{
+					ResourceID: "/CommunityGalleries/rhcos-1234/Images/rhcos/Versions/v1",
+					Type:       AzureImageTypeCommunityGallery,
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: invalid image version \"v1\", expected latest or a version in the X.Y.Z format"),
+		},
+		{
+			name: "Reserved admin username",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.AdminUsername = "Administrator"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("admin username \"Administrator\" is reserved by Azure"),
+		},
+		{
+			name: "Admin username with invalid characters on Linux",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.AdminUsername = "1core"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("admin username \"1core\" must only contain letters, numbers, hyphens and underscores and must not start with a number or a hyphen"),
+		},
+		{
+			name: "Admin username too long on Windows",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.OSDisk.OSType = "Windows"
+				vmSpec.AdminUsername = "averyveryverylongusername"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("admin username \"averyveryverylongusername\" must be at most 20 characters long"),
 		},
 	}
 
@@ -755,6 +1476,7 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 						Location:      location,
 						ResourceGroup: resourcegroup,
 					},
+					Options: actuators.Options{AllowedImagePublishers: tc.allowedImagePublishers},
 				},
 			}
 
@@ -770,6 +1492,96 @@ func TestDeriveVirtualMachineParameters(t *testing.T) {
 	}
 }
 
+func TestDeriveVirtualMachineParametersStackHub(t *testing.T) {
+	testCases := []struct {
+		name          string
+		updateSpec    func(*Spec)
+		spotVMOptions *machinev1.SpotVMOptions
+		expectedError error
+	}{
+		{
+			name: "Supported features",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.UltraSSDCapability = machinev1.AzureUltraSSDCapabilityDisabled
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{EncryptionAtHost: to.BoolPtr(false)}
+			},
+		},
+		{
+			name: "Ultra SSD capability",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.UltraSSDCapability = machinev1.AzureUltraSSDCapabilityEnabled
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: ultraSSDCapability not supported on Azure Stack Hub"),
+		},
+		{
+			name: "Encryption at host",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{EncryptionAtHost: to.BoolPtr(true)}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: securityProfile.encryptionAtHost not supported on Azure Stack Hub"),
+		},
+		{
+			name: "Trusted launch",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.SecurityProfile = &machinev1.SecurityProfile{
+					Settings: machinev1.SecuritySettings{SecurityType: machinev1.SecurityTypesTrustedLaunch},
+				}
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: securityProfile.settings.securityType not supported on Azure Stack Hub"),
+		},
+		{
+			name: "Capacity reservation and spot VM",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.CapacityReservationGroupID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/capacityReservationGroups/crg"
+			},
+			spotVMOptions: &machinev1.SpotVMOptions{},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: capacityReservationGroupID, spotVMOptions not supported on Azure Stack Hub"),
+		},
+		{
+			name: "User data",
+			updateSpec: func(vmSpec *Spec) {
+				vmSpec.UserData = "dXNlci1kYXRh"
+			},
+			expectedError: apierrors.InvalidMachineConfiguration("failed to create VM my-awesome-machine: userData not supported on Azure Stack Hub"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGomegaWithT(t)
+			vmSpec := getTestVMSpec(tc.updateSpec)
+			subscription := "226e02ba-43d1-43d3-a02a-19e584a4ef67"
+			resourcegroup := "foobar"
+			location := "eastus"
+			nic := stacknetwork.Interface{
+				ID: to.StringPtr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/networkInterfaces/%s", subscription, resourcegroup, vmSpec.NICName)),
+			}
+
+			s := StackHubService{
+				Scope: &actuators.MachineScope{
+					AzureClients: actuators.AzureClients{
+						SubscriptionID: subscription,
+					},
+					MachineConfig: &machinev1.AzureMachineProviderSpec{
+						Location:      location,
+						ResourceGroup: resourcegroup,
+						SpotVMOptions: tc.spotVMOptions,
+					},
+				},
+			}
+
+			vm, err := s.deriveVirtualMachineParametersStackHub(vmSpec, nic)
+			if tc.expectedError != nil {
+				g.Expect(err).To(MatchError(tc.expectedError))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(vm.Location).To(Equal(to.StringPtr(location)))
+			g.Expect(vm.StorageProfile.OsDisk.Name).To(Equal(to.StringPtr("my-awesome-machine_OSDisk")))
+		})
+	}
+}
+
 func getTestNic(vmSpec *Spec, subscription, resourcegroup, location string) network.Interface {
 	return network.Interface{
 		Etag:     to.StringPtr("foobar"),
@@ -829,12 +1641,19 @@ func TestGetSpotVMOptions(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	ephemeralOSDisk := machinev1.OSDisk{
+		DiskSettings: machinev1.DiskSettings{EphemeralStorageLocation: "Local"},
+	}
+
 	testCases := []struct {
-		name           string
-		spotVMOptions  *machinev1.SpotVMOptions
-		priority       compute.VirtualMachinePriorityTypes
-		evictionPolicy compute.VirtualMachineEvictionPolicyTypes
-		billingProfile *compute.BillingProfile
+		name                    string
+		spotVMOptions           *machinev1.SpotVMOptions
+		requestedEvictionPolicy compute.VirtualMachineEvictionPolicyTypes
+		osDisk                  machinev1.OSDisk
+		priority                compute.VirtualMachinePriorityTypes
+		evictionPolicy          compute.VirtualMachineEvictionPolicyTypes
+		billingProfile          *compute.BillingProfile
+		expectedError           string
 	}{
 		{
 			name: "get spot vm option succefully",
@@ -874,11 +1693,95 @@ func TestGetSpotVMOptions(t *testing.T) {
 				MaxPrice: nil,
 			},
 		},
+		{
+			name: "accept the -1 max price capping the price at the on-demand price",
+			spotVMOptions: &machinev1.SpotVMOptions{
+				MaxPrice: ptr.To(resource.MustParse("-1")),
+			},
+			priority:       compute.VirtualMachinePriorityTypesSpot,
+			evictionPolicy: compute.VirtualMachineEvictionPolicyTypesDeallocate,
+			billingProfile: &compute.BillingProfile{
+				MaxPrice: ptr.To(float64(-1)),
+			},
+		},
+		{
+			name: "accept a max price of 0",
+			spotVMOptions: &machinev1.SpotVMOptions{
+				MaxPrice: ptr.To(resource.MustParse("0")),
+			},
+			priority:       compute.VirtualMachinePriorityTypesSpot,
+			evictionPolicy: compute.VirtualMachineEvictionPolicyTypesDeallocate,
+			billingProfile: &compute.BillingProfile{
+				MaxPrice: ptr.To(float64(0)),
+			},
+		},
+		{
+			name: "return an error for a negative max price other than -1",
+			spotVMOptions: &machinev1.SpotVMOptions{
+				MaxPrice: ptr.To(resource.MustParse("-0.5")),
+			},
+			expectedError: "Invalid value MaxPrice: -0.5. Valid values are -1 or a price not lower than 0.",
+		},
+		{
+			name:                    "use the requested Delete eviction policy",
+			spotVMOptions:           &machinev1.SpotVMOptions{},
+			requestedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDelete,
+			priority:                compute.VirtualMachinePriorityTypesSpot,
+			evictionPolicy:          compute.VirtualMachineEvictionPolicyTypesDelete,
+			billingProfile:          &compute.BillingProfile{},
+		},
+		{
+			name:                    "use the requested Deallocate eviction policy",
+			spotVMOptions:           &machinev1.SpotVMOptions{},
+			requestedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDeallocate,
+			priority:                compute.VirtualMachinePriorityTypesSpot,
+			evictionPolicy:          compute.VirtualMachineEvictionPolicyTypesDeallocate,
+			billingProfile:          &compute.BillingProfile{},
+		},
+		{
+			name:                    "allow an ephemeral OS disk with the Delete eviction policy",
+			spotVMOptions:           &machinev1.SpotVMOptions{},
+			requestedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDelete,
+			osDisk:                  ephemeralOSDisk,
+			priority:                compute.VirtualMachinePriorityTypesSpot,
+			evictionPolicy:          compute.VirtualMachineEvictionPolicyTypesDelete,
+			billingProfile:          &compute.BillingProfile{},
+		},
+		{
+			name:          "return an error for an ephemeral OS disk with the default Deallocate eviction policy",
+			spotVMOptions: &machinev1.SpotVMOptions{},
+			osDisk:        ephemeralOSDisk,
+			expectedError: "Spot VMs with an ephemeral OS disk must use the Delete eviction policy, got Deallocate.",
+		},
+		{
+			name:                    "return an error for an ephemeral OS disk with the Deallocate eviction policy",
+			spotVMOptions:           &machinev1.SpotVMOptions{},
+			requestedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDeallocate,
+			osDisk:                  ephemeralOSDisk,
+			expectedError:           "Spot VMs with an ephemeral OS disk must use the Delete eviction policy, got Deallocate.",
+		},
+		{
+			name:                    "return an error for an unknown eviction policy",
+			spotVMOptions:           &machinev1.SpotVMOptions{},
+			requestedEvictionPolicy: "Hibernate",
+			expectedError:           "Invalid value EvictionPolicy: \"Hibernate\". Valid values are [Deallocate Delete].",
+		},
+		{
+			name:                    "ignore the eviction policy of machines which are not spot",
+			requestedEvictionPolicy: compute.VirtualMachineEvictionPolicyTypesDelete,
+			osDisk:                  ephemeralOSDisk,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			priority, evictionPolicy, billingProfile, err := getSpotVMOptions(tc.spotVMOptions)
+			priority, evictionPolicy, billingProfile, err := getSpotVMOptions(tc.spotVMOptions, tc.requestedEvictionPolicy, tc.osDisk)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("Expected error %q, got: %v", tc.expectedError, err)
+				}
+				return
+			}
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -908,3 +1811,335 @@ func TestGetSpotVMOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateGalleryImageID(t *testing.T) {
+	testCases := []struct {
+		name          string
+		id            string
+		expectedError bool
+	}{
+		{
+			name: "Image version",
+			id:   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.2.3",
+		},
+		{
+			name: "Image definition without version",
+			id:   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image",
+		},
+		{
+			name: "Case insensitive segments",
+			id:   "/SUBSCRIPTIONS/sub/resourcegroups/rg/providers/microsoft.compute/Galleries/gallery/Images/image",
+		},
+		{
+			name:          "Invalid image version",
+			id:            "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.2",
+			expectedError: true,
+		},
+		{
+			name:          "Managed image",
+			id:            "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/images/image",
+			expectedError: true,
+		},
+		{
+			name:          "Missing image name",
+			id:            "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/",
+			expectedError: true,
+		},
+		{
+			name:          "Trailing segments",
+			id:            "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image/versions/1.0.0/extra",
+			expectedError: true,
+		},
+		{
+			name:          "Empty",
+			id:            "",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			err := validateGalleryImageID(tc.id)
+			if tc.expectedError {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestValidateCommunityAndSharedGalleryImageIDs(t *testing.T) {
+	testCases := []struct {
+		name           string
+		id             string
+		communityValid bool
+		sharedValid    bool
+	}{
+		{
+			name:           "Community gallery image version",
+			id:             "/CommunityGalleries/gallery-1234/Images/image/Versions/1.0.0",
+			communityValid: true,
+		},
+		{
+			name:           "Community gallery image without version",
+			id:             "/communityGalleries/gallery-1234/images/image",
+			communityValid: true,
+		},
+		{
+			name:        "Shared gallery image version",
+			id:          "/SharedGalleries/1234-gallery/Images/image/Versions/latest",
+			sharedValid: true,
+		},
+		{
+			name:        "Shared gallery image without version",
+			id:          "/sharedGalleries/1234-gallery/images/image",
+			sharedValid: true,
+		},
+		{
+			name: "Gallery resource ID",
+			id:   "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/galleries/gallery/images/image",
+		},
+		{
+			name: "Missing image",
+			id:   "/CommunityGalleries/gallery-1234/Images/",
+		},
+		{
+			name: "Trailing segments",
+			id:   "/SharedGalleries/1234-gallery/Images/image/Versions/latest/extra",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			if tc.communityValid {
+				g.Expect(validateCommunityGalleryImageID(tc.id)).To(Succeed())
+			} else {
+				g.Expect(validateCommunityGalleryImageID(tc.id)).ToNot(Succeed())
+			}
+			if tc.sharedValid {
+				g.Expect(validateSharedGalleryImageID(tc.id)).To(Succeed())
+			} else {
+				g.Expect(validateSharedGalleryImageID(tc.id)).ToNot(Succeed())
+			}
+		})
+	}
+}
+
+func TestValidateImageVersion(t *testing.T) {
+	testCases := []struct {
+		name      string
+		version   string
+		imageType machinev1.AzureImageType
+		valid     bool
+	}{
+		{
+			name:  "Empty version",
+			valid: true,
+		},
+		{
+			name:    "Latest marketplace image version",
+			version: "latest",
+			valid:   true,
+		},
+		{
+			name:    "Marketplace image version",
+			version: "8.6.2022052401",
+			valid:   true,
+		},
+		{
+			name:    "Marketplace image version with a revision",
+			version: "1.2.3.4",
+			valid:   true,
+		},
+		{
+			name:    "Marketplace image version missing the build",
+			version: "1.2",
+		},
+		{
+			name:    "Marketplace image version with letters",
+			version: "1.2.3-beta",
+		},
+		{
+			name:    "Capitalized latest",
+			version: "Latest",
+		},
+		{
+			name:      "Latest gallery image version",
+			version:   "latest",
+			imageType: AzureImageTypeSharedGallery,
+			valid:     true,
+		},
+		{
+			name:      "Gallery image version",
+			version:   "1.0.0",
+			imageType: AzureImageTypeGallery,
+			valid:     true,
+		},
+		{
+			name:      "Gallery image version with a revision",
+			version:   "1.0.0.1",
+			imageType: AzureImageTypeCommunityGallery,
+		},
+		{
+			name:      "Gallery image version missing the patch",
+			version:   "1.0",
+			imageType: AzureImageTypeGallery,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			if tc.valid {
+				g.Expect(validateImageVersion(tc.version, tc.imageType)).To(Succeed())
+			} else {
+				g.Expect(validateImageVersion(tc.version, tc.imageType)).ToNot(Succeed())
+			}
+		})
+	}
+}
+
+func TestGenerateUserAssignedIdentityRemoval(t *testing.T) {
+	const (
+		identityA = "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/a"
+		identityB = "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.ManagedIdentity/userAssignedIdentities/b"
+	)
+
+	testCases := []struct {
+		name                          string
+		currentType                   string
+		currentUserAssignedIdentities []string
+		removedIdentity               string
+		expected                      *compute.VirtualMachineIdentity
+	}{
+		{
+			name:            "No identity",
+			removedIdentity: identityA,
+		},
+		{
+			name:            "System-assigned identity only is left alone",
+			currentType:     string(compute.ResourceIdentityTypeSystemAssigned),
+			removedIdentity: identityA,
+		},
+		{
+			name:                          "Other user-assigned identity is left alone",
+			currentType:                   string(compute.ResourceIdentityTypeUserAssigned),
+			currentUserAssignedIdentities: []string{identityB},
+			removedIdentity:               identityA,
+		},
+		{
+			name:                          "Removing the only user-assigned identity sets type None",
+			currentType:                   string(compute.ResourceIdentityTypeUserAssigned),
+			currentUserAssignedIdentities: []string{identityA},
+			removedIdentity:               identityA,
+			expected: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeNone,
+			},
+		},
+		{
+			name:                          "Removing the only user-assigned identity matches its ID case-insensitively",
+			currentType:                   string(compute.ResourceIdentityTypeUserAssigned),
+			currentUserAssignedIdentities: []string{strings.ToUpper(identityA)},
+			removedIdentity:               identityA,
+			expected: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeNone,
+			},
+		},
+		{
+			name:                          "Removing one of several user-assigned identities keeps the others",
+			currentType:                   string(compute.ResourceIdentityTypeUserAssigned),
+			currentUserAssignedIdentities: []string{identityA, identityB},
+			removedIdentity:               identityA,
+			expected: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeUserAssigned,
+				UserAssignedIdentities: map[string]*compute.VirtualMachineIdentityUserAssignedIdentitiesValue{
+					identityA: nil,
+				},
+			},
+		},
+		{
+			name:                          "Removing the only user-assigned identity keeps the system-assigned identity",
+			currentType:                   string(compute.ResourceIdentityTypeSystemAssignedUserAssigned),
+			currentUserAssignedIdentities: []string{identityA},
+			removedIdentity:               identityA,
+			expected: &compute.VirtualMachineIdentity{
+				Type: compute.ResourceIdentityTypeSystemAssigned,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+			identity := GenerateUserAssignedIdentityRemoval(tc.currentType, tc.currentUserAssignedIdentities, tc.removedIdentity)
+			if tc.expected == nil {
+				g.Expect(identity).To(BeNil())
+				return
+			}
+			g.Expect(identity).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestApplyDataDisksDeleteOption(t *testing.T) {
+	g := NewWithT(t)
+
+	dataDisks := []compute.DataDisk{
+		{
+			Name:         ptr.To("vm_disk1"),
+			Lun:          ptr.To[int32](0),
+			DeleteOption: compute.DiskDeleteOptionTypesDelete,
+		},
+		{
+			Name:         ptr.To("vm_disk2"),
+			Lun:          ptr.To[int32](1),
+			DeleteOption: compute.DiskDeleteOptionTypesDetach,
+		},
+	}
+
+	updated := applyDataDisksDeleteOption(dataDisks, map[string]compute.DiskDeleteOptionTypes{
+		"vm_disk1": compute.DiskDeleteOptionTypesDetach,
+	})
+
+	g.Expect(updated).To(Equal([]compute.DataDisk{
+		{
+			Name:         ptr.To("vm_disk1"),
+			Lun:          ptr.To[int32](0),
+			DeleteOption: compute.DiskDeleteOptionTypesDetach,
+		},
+		{
+			Name:         ptr.To("vm_disk2"),
+			Lun:          ptr.To[int32](1),
+			DeleteOption: compute.DiskDeleteOptionTypesDetach,
+		},
+	}))
+	// The original data disks are left untouched.
+	g.Expect(dataDisks[0].DeleteOption).To(Equal(compute.DiskDeleteOptionTypesDelete))
+}
+
+func TestGenerateWriteAcceleratedDisks(t *testing.T) {
+	g := NewWithT(t)
+
+	vmSpec := &Spec{
+		Name: "vm",
+		OSDisk: machinev1.OSDisk{
+			DiskSizeGB: 128,
+		},
+		DataDisks: []machinev1.DataDisk{
+			{NameSuffix: "log", DiskSizeGB: 256, Lun: 0, DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete},
+			{NameSuffix: "data", DiskSizeGB: 256, Lun: 1, DeletionPolicy: machinev1.DiskDeletionPolicyTypeDelete},
+		},
+		OSDiskWriteAccelerated:    true,
+		WriteAcceleratedDataDisks: []int32{0},
+	}
+
+	g.Expect(generateOSDisk(vmSpec).WriteAcceleratorEnabled).To(Equal(ptr.To(true)))
+
+	dataDisks, err := generateDataDisks(vmSpec)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(dataDisks[0].WriteAcceleratorEnabled).To(Equal(ptr.To(true)))
+	g.Expect(dataDisks[1].WriteAcceleratorEnabled).To(BeNil())
+}
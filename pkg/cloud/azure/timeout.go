@@ -0,0 +1,84 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// timeoutService bounds each call to the wrapped service with a timeout.
+type timeoutService struct {
+	service Service
+	// timeout bounds the Get calls, no timeout is applied when zero.
+	timeout time.Duration
+	// longRunningTimeout bounds the CreateOrUpdate and Delete calls, which may wait for a
+	// long-running operation to complete, no timeout is applied when zero.
+	longRunningTimeout time.Duration
+}
+
+// WithTimeout returns a service aborting the Get calls to the given service which take longer than the timeout,
+// and the CreateOrUpdate and Delete calls which take longer than the long-running timeout. The service is
+// returned as it is when both timeouts are zero.
+func WithTimeout(service Service, timeout, longRunningTimeout time.Duration) Service {
+	if timeout <= 0 && longRunningTimeout <= 0 {
+		return service
+	}
+	return &timeoutService{service: service, timeout: timeout, longRunningTimeout: longRunningTimeout}
+}
+
+// Get calls Get on the wrapped service with the timeout.
+func (s *timeoutService) Get(ctx context.Context, spec Spec) (interface{}, error) {
+	ctx, cancel := withTimeout(ctx, s.timeout)
+	defer cancel()
+
+	result, err := s.service.Get(ctx, spec)
+	return result, timeoutError(ctx, err, s.timeout)
+}
+
+// CreateOrUpdate calls CreateOrUpdate on the wrapped service with the long-running timeout.
+func (s *timeoutService) CreateOrUpdate(ctx context.Context, spec Spec) error {
+	ctx, cancel := withTimeout(ctx, s.longRunningTimeout)
+	defer cancel()
+
+	return timeoutError(ctx, s.service.CreateOrUpdate(ctx, spec), s.longRunningTimeout)
+}
+
+// Delete calls Delete on the wrapped service with the long-running timeout.
+func (s *timeoutService) Delete(ctx context.Context, spec Spec) error {
+	ctx, cancel := withTimeout(ctx, s.longRunningTimeout)
+	defer cancel()
+
+	return timeoutError(ctx, s.service.Delete(ctx, spec), s.longRunningTimeout)
+}
+
+// withTimeout returns a copy of the context cancelled after the timeout, or a cancellable copy when it is zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timeoutError makes the error of a call which ran out of time identifiable with CallTimedOut.
+func timeoutError(ctx context.Context, err error, timeout time.Duration) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded || CallTimedOut(err) {
+		return err
+	}
+	return fmt.Errorf("%w after %s: %v", context.DeadlineExceeded, timeout, err)
+}
@@ -0,0 +1,92 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingService blocks every call until the context of the call is done.
+type blockingService struct{}
+
+func (s *blockingService) Get(ctx context.Context, spec Spec) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *blockingService) CreateOrUpdate(ctx context.Context, spec Spec) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *blockingService) Delete(ctx context.Context, spec Spec) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithTimeout(t *testing.T) {
+	calls := map[string]func(Service, context.Context) error{
+		"Get": func(s Service, ctx context.Context) error {
+			_, err := s.Get(ctx, nil)
+			return err
+		},
+		"CreateOrUpdate": func(s Service, ctx context.Context) error {
+			return s.CreateOrUpdate(ctx, nil)
+		},
+		"Delete": func(s Service, ctx context.Context) error {
+			return s.Delete(ctx, nil)
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name+" times out", func(t *testing.T) {
+			err := call(WithTimeout(&blockingService{}, 10*time.Millisecond, 10*time.Millisecond), context.Background())
+			if !CallTimedOut(err) {
+				t.Errorf("Expected a timed out call, got %v", err)
+			}
+		})
+
+		t.Run(name+" is aborted by a cancelled context", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := call(WithTimeout(&blockingService{}, time.Hour, time.Hour), ctx)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected a cancelled call, got %v", err)
+			}
+			if CallTimedOut(err) {
+				t.Errorf("Expected a cancelled call not to be reported as timed out, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Long-running calls are bounded by the long-running timeout", func(t *testing.T) {
+		service := WithTimeout(&blockingService{}, 10*time.Millisecond, time.Hour)
+
+		if _, err := service.Get(context.Background(), nil); !CallTimedOut(err) {
+			t.Errorf("Expected a timed out Get, got %v", err)
+		}
+
+		// The call outlives the timeout of Get until its context is cancelled.
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(50*time.Millisecond, cancel)
+		if err := service.CreateOrUpdate(ctx, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected CreateOrUpdate not to be bounded by the timeout of Get, got %v", err)
+		}
+	})
+
+	t.Run("No timeout leaves the service as it is", func(t *testing.T) {
+		service := &FakeSuccessService{}
+		if WithTimeout(service, 0, 0) != Service(service) {
+			t.Errorf("Expected the service to be returned as it is without a timeout")
+		}
+	})
+
+	t.Run("Errors of calls in time are returned as they are", func(t *testing.T) {
+		err := WithTimeout(&FakeFailureService{}, time.Hour, time.Hour).CreateOrUpdate(context.Background(), nil)
+		if err == nil || CallTimedOut(err) {
+			t.Errorf("Expected the error of the service, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+/*
+Copyright The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	machinev1 "github.com/openshift/api/machine/v1beta1"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/actuators"
+	"github.com/openshift/machine-api-provider-azure/pkg/cloud/azure/services/groups"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// probeTimeout is how long a single probe of Azure may take.
+const probeTimeout = 30 * time.Second
+
+// errNotProbed is reported until Azure is probed for the first time.
+var errNotProbed = errors.New("azure has not been probed yet")
+
+// ProbeFunc makes a lightweight call to Azure and returns an error when it fails.
+type ProbeFunc func(ctx context.Context) error
+
+// AzureChecker is a readiness checker reporting whether Azure is reachable with valid credentials.
+// Azure is probed in the background once per interval, the checker reports the result of the last probe
+// so that readiness requests never wait on Azure.
+type AzureChecker struct {
+	probe    ProbeFunc
+	interval time.Duration
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewAzureChecker returns a checker probing Azure once per interval once started.
+func NewAzureChecker(probe ProbeFunc, interval time.Duration) *AzureChecker {
+	return &AzureChecker{
+		probe:    probe,
+		interval: interval,
+		err:      errNotProbed,
+	}
+}
+
+// Start probes Azure once per interval until the context is done. It implements manager.Runnable.
+func (c *AzureChecker) Start(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.runProbe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, every replica reports its readiness.
+func (c *AzureChecker) NeedLeaderElection() bool {
+	return false
+}
+
+// runProbe probes Azure and records the result for Check.
+func (c *AzureChecker) runProbe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	err := c.probe(ctx)
+	if err != nil {
+		klog.Errorf("Azure readiness probe failed: %v", err)
+		err = fmt.Errorf("azure is not reachable: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Check implements healthz.Checker.
+func (c *AzureChecker) Check(_ *http.Request) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// NewCredentialsProbe returns a probe getting the resource group of the cluster with the credentials
+// of the given secret, the credentials of the cluster.
+func NewCredentialsProbe(coreClient client.Client, credentialsSecret corev1.SecretReference, azureWorkloadIdentityEnabled bool) (ProbeFunc, error) {
+	providerSpec, err := actuators.RawExtensionFromProviderSpec(&machinev1.AzureMachineProviderSpec{
+		CredentialsSecret: &credentialsSecret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode provider spec: %w", err)
+	}
+
+	// The scope is only used for its Azure clients, which are created from the credentials secret.
+	machine := &machinev1.Machine{
+		Spec: machinev1.MachineSpec{
+			ProviderSpec: machinev1.ProviderSpec{Value: providerSpec},
+		},
+	}
+
+	return func(ctx context.Context) error {
+		scope, err := actuators.NewMachineScope(actuators.MachineScopeParams{
+			Machine:    machine,
+			CoreClient: coreClient,
+
+			AzureWorkloadIdentityEnabled: azureWorkloadIdentityEnabled,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create scope for credentials secret %s/%s: %w", credentialsSecret.Namespace, credentialsSecret.Name, err)
+		}
+
+		if _, err := groups.NewService(scope).Get(ctx, nil); err != nil {
+			return fmt.Errorf("failed to get resource group %q: %w", scope.MachineConfig.ResourceGroup, err)
+		}
+
+		return nil
+	}, nil
+}
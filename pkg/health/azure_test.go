@@ -0,0 +1,116 @@
+/*
+Copyright The Kubernetes Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	configv1 "github.com/openshift/api/config/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	controllerfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAzureCheckerCheck(t *testing.T) {
+	testCases := []struct {
+		name        string
+		probeErr    error
+		expectedErr string
+	}{
+		{
+			name: "Azure is reachable",
+		},
+		{
+			name:        "Azure is not reachable",
+			probeErr:    errors.New("dial tcp: i/o timeout"),
+			expectedErr: "azure is not reachable: dial tcp: i/o timeout",
+		},
+		{
+			name:        "Credentials are invalid",
+			probeErr:    errors.New("AADSTS7000222: The provided client secret keys are expired"),
+			expectedErr: "azure is not reachable: AADSTS7000222: The provided client secret keys are expired",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			checker := NewAzureChecker(func(ctx context.Context) error {
+				return tc.probeErr
+			}, time.Minute)
+			checker.runProbe(context.Background())
+
+			err := checker.Check(httptest.NewRequest("GET", "/readyz", nil))
+			if tc.expectedErr == "" {
+				g.Expect(err).ToNot(HaveOccurred())
+			} else {
+				g.Expect(err).To(MatchError(tc.expectedErr))
+			}
+		})
+	}
+}
+
+func TestAzureCheckerStart(t *testing.T) {
+	g := NewWithT(t)
+
+	probes := make(chan struct{})
+	checker := NewAzureChecker(func(ctx context.Context) error {
+		select {
+		case probes <- struct{}{}:
+		default:
+		}
+		return nil
+	}, time.Millisecond)
+	req := httptest.NewRequest("GET", "/readyz", nil)
+
+	// Azure is reported unreachable until it is probed.
+	g.Expect(checker.Check(req)).To(MatchError(errNotProbed))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- checker.Start(ctx)
+	}()
+
+	// Azure is probed again once the interval has passed.
+	<-probes
+	<-probes
+	g.Eventually(func() error { return checker.Check(req) }).Should(Succeed())
+
+	cancel()
+	g.Eventually(done).Should(Receive(BeNil()))
+}
+
+func TestCredentialsProbeMissingSecret(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(configv1.AddToScheme(scheme.Scheme)).To(Succeed())
+
+	infra := &configv1.Infrastructure{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cluster",
+		},
+	}
+	coreClient := controllerfake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(infra).Build()
+	probe, err := NewCredentialsProbe(coreClient, corev1.SecretReference{Namespace: "openshift-machine-api", Name: "azure-cloud-credentials"}, false)
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(probe(context.Background())).To(MatchError(ContainSubstring("failed to create scope for credentials secret openshift-machine-api/azure-cloud-credentials")))
+}
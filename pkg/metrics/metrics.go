@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	// OperationCreate is the operation label value for machine creation.
+	OperationCreate = "create"
+	// OperationUpdate is the operation label value for machine updates.
+	OperationUpdate = "update"
+	// OperationDelete is the operation label value for machine deletion.
+	OperationDelete = "delete"
+
+	// OutcomeSuccess is the outcome label value for operations which succeeded.
+	OutcomeSuccess = "success"
+	// OutcomeInvalidConfiguration is the outcome label value for operations which failed
+	// because of an invalid machine configuration, and are not retried.
+	OutcomeInvalidConfiguration = "invalid_configuration"
+	// OutcomeTransientFailure is the outcome label value for operations which failed
+	// and are retried.
+	OutcomeTransientFailure = "transient_failure"
+)
+
+var (
+	// OperationRetryCount counts the number of times an instance operation
+	// has been requeued to be retried by the actuator.
+	OperationRetryCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_azure_instance_operation_retries_total",
+			Help: "Number of times a provider instance operation has been requeued for a retry.",
+		}, []string{"name", "namespace", "operation"},
+	)
+
+	// CloudEnvironmentInfo reports the cloud environment and ARM endpoint resolved
+	// by the controller. It has a single series whose value is always 1.
+	CloudEnvironmentInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mapi_azure_cloud_environment_info",
+			Help: "Cloud environment and ARM endpoint resolved by the machine controller, the value is always 1.",
+		}, []string{"cloud", "arm_endpoint"},
+	)
+
+	// ReconcileOutcomeCount counts the outcomes of the instance operations of the
+	// actuator by machine role and VMSize.
+	ReconcileOutcomeCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapi_azure_instance_operation_outcomes_total",
+			Help: "Number of provider instance operations by outcome, machine role and VMSize.",
+		}, []string{"operation", "role", "vm_size", "outcome"},
+	)
+
+	// ProvisioningDuration observes the time from the start of the creation of a
+	// machine to its VM first reaching the Succeeded provisioning state, by machine role and VMSize.
+	ProvisioningDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mapi_azure_instance_provisioning_duration_seconds",
+			Help:    "Time from the start of the creation of a machine to its VM first reaching the Succeeded provisioning state.",
+			Buckets: prometheus.ExponentialBuckets(30, 2, 8),
+		}, []string{"role", "vm_size"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(OperationRetryCount, CloudEnvironmentInfo, ReconcileOutcomeCount, ProvisioningDuration)
+}
+
+// RetryLabels identifies the machine and operation of a retry.
+type RetryLabels struct {
+	Name      string
+	Namespace string
+	Operation string
+}
+
+// RegisterOperationRetry increments the retry counter for the given machine operation.
+func RegisterOperationRetry(labels *RetryLabels) {
+	OperationRetryCount.With(prometheus.Labels{
+		"name":      labels.Name,
+		"namespace": labels.Namespace,
+		"operation": labels.Operation,
+	}).Inc()
+}
+
+// OutcomeLabels identifies the operation, machine role and VMSize of an outcome.
+type OutcomeLabels struct {
+	Operation string
+	Role      string
+	VMSize    string
+	Outcome   string
+}
+
+// RegisterReconcileOutcome increments the outcome counter for the given operation.
+func RegisterReconcileOutcome(labels *OutcomeLabels) {
+	ReconcileOutcomeCount.With(prometheus.Labels{
+		"operation": labels.Operation,
+		"role":      labels.Role,
+		"vm_size":   labels.VMSize,
+		"outcome":   labels.Outcome,
+	}).Inc()
+}
+
+// ProvisioningLabels identifies the machine role and VMSize of a provisioning duration.
+type ProvisioningLabels struct {
+	Role   string
+	VMSize string
+}
+
+// ObserveProvisioningDuration records the provisioning duration of a machine.
+func ObserveProvisioningDuration(labels *ProvisioningLabels, duration time.Duration) {
+	ProvisioningDuration.With(prometheus.Labels{
+		"role":    labels.Role,
+		"vm_size": labels.VMSize,
+	}).Observe(duration.Seconds())
+}
+
+var (
+	cloudEnvironmentLock   sync.Mutex
+	cloudEnvironmentLabels prometheus.Labels
+)
+
+// RecordCloudEnvironment replaces the series of the cloud environment gauge with the given cloud environment and ARM endpoint.
+// It is called every time a machine scope is built, so only the series previously recorded is deleted, and only when it
+// changed, for the gauge to never be seen empty by a scrape.
+func RecordCloudEnvironment(cloud, armEndpoint string) {
+	cloudEnvironmentLock.Lock()
+	defer cloudEnvironmentLock.Unlock()
+
+	labels := prometheus.Labels{
+		"cloud":        cloud,
+		"arm_endpoint": armEndpoint,
+	}
+	CloudEnvironmentInfo.With(labels).Set(1)
+	if cloudEnvironmentLabels != nil && (cloudEnvironmentLabels["cloud"] != cloud || cloudEnvironmentLabels["arm_endpoint"] != armEndpoint) {
+		CloudEnvironmentInfo.Delete(cloudEnvironmentLabels)
+	}
+	cloudEnvironmentLabels = labels
+}
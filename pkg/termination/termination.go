@@ -1,6 +1,7 @@
 package termination
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,9 +14,13 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -25,6 +30,9 @@ const (
 	azureTerminationEndpointURL                          = "http://169.254.169.254/metadata/scheduledevents?api-version=2019-08-01"
 	terminatingConditionType    corev1.NodeConditionType = "Terminating"
 	terminationRequestedReason                           = "TerminationRequested"
+
+	// maxPollErrorBackoff is the longest interval between polls after poll errors.
+	maxPollErrorBackoff = 2 * time.Minute
 )
 
 // Handler represents a handler that will run to check the termination
@@ -33,8 +41,12 @@ type Handler interface {
 	Run(stop <-chan struct{}) error
 }
 
-// NewHandler constructs a new Handler
-func NewHandler(logger logr.Logger, cfg *rest.Config, pollInterval time.Duration, namespace, nodeName string) (Handler, error) {
+// NewHandler constructs a new Handler.
+// The poll interval is jittered by up to pollJitterFactor times the interval, and the handler
+// backs off on up to maxPollErrors consecutive poll errors before returning an error.
+// When acknowledgeEvents is set, the scheduled events terminating the instance are acknowledged
+// once the node is marked for deletion so that Azure starts them sooner.
+func NewHandler(logger logr.Logger, cfg *rest.Config, pollInterval time.Duration, pollJitterFactor float64, maxPollErrors int, acknowledgeEvents bool, namespace, nodeName string) (Handler, error) {
 	c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	if err != nil {
 		return nil, fmt.Errorf("error creating client: %v", err)
@@ -46,15 +58,29 @@ func NewHandler(logger logr.Logger, cfg *rest.Config, pollInterval time.Duration
 		panic(err)
 	}
 
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating clientset: %v", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "machine-api-termination-handler", Host: nodeName})
+
 	logger = logger.WithValues("node", nodeName, "namespace", namespace)
 
 	return &handler{
-		client:       c,
-		pollURL:      pollURL,
-		pollInterval: pollInterval,
-		nodeName:     nodeName,
-		namespace:    namespace,
-		log:          logger,
+		client:            c,
+		recorder:          recorder,
+		pollURL:           pollURL,
+		pollInterval:      pollInterval,
+		pollJitterFactor:  pollJitterFactor,
+		maxPollErrors:     maxPollErrors,
+		acknowledgeEvents: acknowledgeEvents,
+		nodeName:          nodeName,
+		namespace:         namespace,
+		log:               logger,
+		recordedEvents:    make(map[string]bool),
 	}, nil
 }
 
@@ -62,11 +88,24 @@ func NewHandler(logger logr.Logger, cfg *rest.Config, pollInterval time.Duration
 // machine associated with the node
 type handler struct {
 	client       client.Client
+	recorder     record.EventRecorder
 	pollURL      *url.URL
 	pollInterval time.Duration
 	nodeName     string
 	namespace    string
 	log          logr.Logger
+
+	// pollJitterFactor is the maximum fraction of the poll interval added to it.
+	pollJitterFactor float64
+	// maxPollErrors is the number of consecutive poll errors the handler backs off on.
+	maxPollErrors int
+	// acknowledgeEvents enables acknowledging the scheduled events terminating the instance
+	// once the node is marked for deletion.
+	acknowledgeEvents bool
+
+	// recordedEvents holds the IDs of the scheduled events already recorded on the node
+	// so that they are recorded once while they are pending.
+	recordedEvents map[string]bool
 }
 
 // Run starts the handler and runs the termination logic
@@ -98,45 +137,30 @@ func (h *handler) run(ctx context.Context) error {
 	logger := h.log.WithValues("node", h.nodeName)
 	logger.V(1).Info("Monitoring node termination")
 
-	if err := wait.PollUntilContextCancel(ctx, h.pollInterval, true, func(ctx context.Context) (bool, error) {
-		req, err := http.NewRequest("GET", h.pollURL.String(), nil)
+	var terminatingEvents []events
+	pollErrors := 0
+	for {
+		var err error
+		terminatingEvents, err = h.poll(logger)
 		if err != nil {
-			return false, fmt.Errorf("could not create request %q: %w", h.pollURL.String(), err)
-		}
-
-		req.Header.Add("Metadata", "true")
-
-		resp, err := http.DefaultClient.Do(req)
-		if resp != nil {
-			defer resp.Body.Close()
-		}
-		if err != nil {
-			return false, fmt.Errorf("could not get URL %q: %w", h.pollURL.String(), err)
+			pollErrors++
+			if pollErrors > h.maxPollErrors {
+				return fmt.Errorf("error polling termination endpoint: %w", err)
+			}
+			logger.Error(err, "Error polling termination endpoint, backing off", "errors", pollErrors)
+		} else {
+			pollErrors = 0
 		}
 
-		bodyBytes, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return false, fmt.Errorf("failed to read responce body: %w", err)
+		if len(terminatingEvents) > 0 {
+			break
 		}
 
-		s := scheduledEvents{}
-		err = json.Unmarshal(bodyBytes, &s)
-		if err != nil {
-			return false, fmt.Errorf("failed to unmarshal responce body: %w", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(h.nextPollInterval(pollErrors)):
 		}
-
-		for _, event := range s.Events {
-			if event.EventType == preemptEventType {
-				// Instance marked for termination
-				return true, nil
-			}
-		}
-
-		// Instance not terminated yet
-		logger.V(2).Info("Instance not marked for termination")
-		return false, nil
-	}); err != nil {
-		return fmt.Errorf("error polling termination endpoint: %w", err)
 	}
 
 	// Will only get here if the termination endpoint returned FALSE
@@ -145,9 +169,139 @@ func (h *handler) run(ctx context.Context) error {
 		return fmt.Errorf("error marking node: %v", err)
 	}
 
+	if h.acknowledgeEvents {
+		logger.V(1).Info("Acknowledging scheduled events terminating the instance")
+		if err := h.acknowledge(terminatingEvents); err != nil {
+			return fmt.Errorf("error acknowledging scheduled events: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// acknowledge approves the scheduled events so that Azure starts them without waiting for their NotBefore time.
+// See https://learn.microsoft.com/en-us/azure/virtual-machines/linux/scheduled-events#start-an-event
+func (h *handler) acknowledge(scheduled []events) error {
+	startRequests := startRequests{}
+	for _, event := range scheduled {
+		startRequests.StartRequests = append(startRequests.StartRequests, startRequest{EventID: event.EventID})
+	}
+
+	body, err := json.Marshal(startRequests)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", h.pollURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request %q: %w", h.pollURL.String(), err)
+	}
+
+	req.Header.Add("Metadata", "true")
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("could not post to URL %q: %w", h.pollURL.String(), err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %q acknowledging scheduled events", resp.Status)
+	}
+
 	return nil
 }
 
+// poll returns the scheduled events of the termination endpoint terminating the instance.
+func (h *handler) poll(logger logr.Logger) ([]events, error) {
+	req, err := http.NewRequest("GET", h.pollURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request %q: %w", h.pollURL.String(), err)
+	}
+
+	req.Header.Add("Metadata", "true")
+
+	resp, err := http.DefaultClient.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get URL %q: %w", h.pollURL.String(), err)
+	}
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read responce body: %w", err)
+	}
+
+	s := scheduledEvents{}
+	err = json.Unmarshal(bodyBytes, &s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal responce body: %w", err)
+	}
+
+	if terminatingEvents := h.handleEvents(s.Events); len(terminatingEvents) > 0 {
+		// Instance marked for termination
+		return terminatingEvents, nil
+	}
+
+	// Instance not terminated yet
+	logger.V(2).Info("Instance not marked for termination")
+	return nil, nil
+}
+
+// nextPollInterval returns the interval before the next poll of the termination endpoint.
+// The poll interval is doubled for each consecutive poll error, up to maxPollErrorBackoff,
+// and jittered so that the handlers of different nodes do not poll in lockstep.
+func (h *handler) nextPollInterval(pollErrors int) time.Duration {
+	interval := h.pollInterval
+	for i := 0; i < pollErrors && interval < maxPollErrorBackoff; i++ {
+		interval = min(2*interval, maxPollErrorBackoff)
+	}
+	if h.pollJitterFactor <= 0 {
+		// wait.Jitter defaults to a factor of 1 otherwise.
+		return interval
+	}
+	return wait.Jitter(interval, h.pollJitterFactor)
+}
+
+// handleEvents returns the scheduled events terminating the instance.
+// The events which do not terminate the instance are recorded on the node.
+func (h *handler) handleEvents(scheduled []events) []events {
+	var terminatingEvents []events
+	for _, event := range scheduled {
+		switch event.EventType {
+		case preemptEventType, terminateEventType:
+			terminatingEvents = append(terminatingEvents, event)
+		case rebootEventType, redeployEventType, freezeEventType:
+			if h.recordedEvents[event.EventID] {
+				continue
+			}
+			h.recordedEvents[event.EventID] = true
+
+			h.log.V(1).Info("Instance has a scheduled event", "eventType", event.EventType, "eventID", event.EventID, "notBefore", event.NotBefore)
+			h.recorder.Eventf(h.nodeReference(), corev1.EventTypeWarning, event.EventType,
+				"The cloud provider has scheduled a %s event for this instance not before %q: %s", event.EventType, event.NotBefore, event.Description)
+		default:
+			h.log.V(2).Info("Ignoring unknown scheduled event", "eventType", event.EventType, "eventID", event.EventID)
+		}
+	}
+	return terminatingEvents
+}
+
+// nodeReference returns a reference to the node to record events on.
+// Like the kubelet, the node name is used as the UID of the node.
+func (h *handler) nodeReference() *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: h.nodeName,
+		UID:  types.UID(h.nodeName),
+	}
+}
+
 func (h *handler) markNodeForDeletion(ctx context.Context) error {
 	node := &corev1.Node{}
 	if err := h.client.Get(ctx, client.ObjectKey{Name: h.nodeName}, node); err != nil {
@@ -214,7 +368,18 @@ func addNodeTerminationCondition(node *corev1.Node) {
 	node.Status.Conditions = conditions
 }
 
-const preemptEventType = "Preempt"
+const (
+	// preemptEventType is scheduled when a spot instance is evicted.
+	preemptEventType = "Preempt"
+	// terminateEventType is scheduled when the instance is deleted.
+	terminateEventType = "Terminate"
+	// rebootEventType is scheduled when the instance is rebooted.
+	rebootEventType = "Reboot"
+	// redeployEventType is scheduled when the instance is moved to another host.
+	redeployEventType = "Redeploy"
+	// freezeEventType is scheduled when the instance is paused for a few seconds.
+	freezeEventType = "Freeze"
+)
 
 // scheduledEvents represents metadata response, more detailed info can be found here:
 // https://docs.microsoft.com/en-us/azure/virtual-machines/linux/scheduled-events#use-the-api
@@ -222,8 +387,20 @@ type scheduledEvents struct {
 	Events []events `json:"Events"`
 }
 
+// startRequests represents the metadata request acknowledging scheduled events.
+type startRequests struct {
+	StartRequests []startRequest `json:"StartRequests"`
+}
+
+type startRequest struct {
+	EventID string `json:"EventId"`
+}
+
 type events struct {
-	EventType string `json:"EventType"`
+	EventID     string `json:"EventId"`
+	EventType   string `json:"EventType"`
+	Description string `json:"Description"`
+	NotBefore   string `json:"NotBefore"`
 }
 
 // notFoundMachineForNode this error is returned when no machine for node is found in a list of machines
@@ -16,6 +16,7 @@ package termination
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -26,6 +27,7 @@ import (
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2/klogr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -79,7 +81,7 @@ var _ = Describe("Handler Suite", func() {
 
 		// use NewHandler() instead of manual construction in order to test NewHandler() logic
 		// like checking that machine api is added to scheme
-		handlerInterface, err := NewHandler(klogr.New(), cfg, 100*time.Millisecond, "", nodeName)
+		handlerInterface, err := NewHandler(klogr.New(), cfg, 100*time.Millisecond, 0, 0, false, "", nodeName)
 		Expect(err).ToNot(HaveOccurred())
 
 		h = handlerInterface.(*handler)
@@ -173,6 +175,19 @@ var _ = Describe("Handler Suite", func() {
 			})
 		})
 
+		Context("and the instance is scheduled for a reboot", func() {
+			BeforeEach(func() {
+				httpHandler = newMockHTTPHandler(func(rw http.ResponseWriter, req *http.Request) {
+					atomic.AddInt32(&counter, 1)
+					rw.Write([]byte(`{"DocumentIncarnation":1,"Events":[{"EventId":"A123BC45-1234-5678-AB90-ABCDEF123456","EventType":"Reboot","ResourceType":"VirtualMachine"}]}`))
+				})
+			})
+
+			It("should not mark the node for deletion", func() {
+				Consistently(nodeMarkedForDeletion(testNode.Name)).Should(BeFalse())
+			})
+		})
+
 		Context("and the instance termination notice is not fulfilled", func() {
 			BeforeEach(func() {
 				httpHandler = newMockHTTPHandler(func(rw http.ResponseWriter, req *http.Request) {
@@ -201,6 +216,161 @@ var _ = Describe("Handler Suite", func() {
 				Consistently(nodeMarkedForDeletion(testNode.Name)).Should(BeFalse())
 			})
 		})
+
+		Context("and the handler backs off on errors", func() {
+			var counter int32
+
+			BeforeEach(func() {
+				counter = 0
+				h.maxPollErrors = 2
+
+				httpHandler = newMockHTTPHandler(func(rw http.ResponseWriter, req *http.Request) {
+					if atomic.AddInt32(&counter, 1) <= 2 {
+						rw.Write([]byte(`invalid`))
+					} else {
+						rw.Write([]byte(`{"DocumentIncarnation":0,"Events":[{"EventType":"Preempt", "ResourceType": "VirtualMachine"}]}`))
+					}
+				})
+			})
+
+			It("should mark the node for deletion once polling succeeds", func() {
+				Eventually(nodeMarkedForDeletion(testNode.Name), 2*time.Second).Should(BeTrue())
+				Expect(errs).ToNot(Receive())
+			})
+		})
+
+		Context("and the errors exceed the maximum poll errors", func() {
+			BeforeEach(func() {
+				h.maxPollErrors = 1
+				httpHandler = newMockHTTPHandler(func(rw http.ResponseWriter, req *http.Request) {
+					rw.Write([]byte(`invalid`))
+				})
+			})
+
+			It("should return an error", func() {
+				Eventually(errs).Should(Receive(MatchError(ContainSubstring("error polling termination endpoint: failed to unmarshal responce body"))))
+			})
+		})
+	})
+
+	Context("when the instance is preempted", func() {
+		var acknowledgements chan string
+		var nodeMarkedOnAcknowledgement chan bool
+
+		BeforeEach(func() {
+			acknowledgements = make(chan string, 10)
+			nodeMarkedOnAcknowledgement = make(chan bool, 10)
+
+			httpHandler = newMockHTTPHandler(func(rw http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodPost {
+					// The handler runs outside of the spec goroutine, errors fail the expectations below.
+					marked, _ := nodeMarkedForDeletion(testNode.Name)()
+					nodeMarkedOnAcknowledgement <- marked
+
+					body, _ := io.ReadAll(req.Body)
+					acknowledgements <- string(body)
+					return
+				}
+				rw.Write([]byte(`{"DocumentIncarnation":1,"Events":[{"EventId":"A123BC45-1234-5678-AB90-ABCDEF123456","EventType":"Preempt","ResourceType":"VirtualMachine"}]}`))
+			})
+		})
+
+		Context("and acknowledging events is disabled", func() {
+			It("should not acknowledge the event", func() {
+				Eventually(nodeMarkedForDeletion(testNode.Name)).Should(BeTrue())
+				Eventually(errs).Should(Receive(BeNil()))
+				Expect(acknowledgements).ToNot(Receive())
+			})
+		})
+
+		Context("and acknowledging events is enabled", func() {
+			BeforeEach(func() {
+				h.acknowledgeEvents = true
+			})
+
+			It("should acknowledge the event after marking the node for deletion", func() {
+				Eventually(acknowledgements).Should(Receive(MatchJSON(`{"StartRequests":[{"EventId":"A123BC45-1234-5678-AB90-ABCDEF123456"}]}`)))
+				Expect(nodeMarkedOnAcknowledgement).To(Receive(BeTrue()))
+				Eventually(errs).Should(Receive(BeNil()))
+			})
+		})
+	})
+
+	Context("nextPollInterval", func() {
+		BeforeEach(func() {
+			h.pollInterval = 10 * time.Second
+			h.pollJitterFactor = 0.5
+		})
+
+		It("should jitter the poll interval within the jitter factor", func() {
+			intervals := map[time.Duration]bool{}
+			for i := 0; i < 100; i++ {
+				interval := h.nextPollInterval(0)
+				Expect(interval).To(BeNumerically(">=", 10*time.Second))
+				Expect(interval).To(BeNumerically("<", 15*time.Second))
+				intervals[interval] = true
+			}
+			Expect(len(intervals)).To(BeNumerically(">", 1))
+		})
+
+		It("should not jitter the poll interval without a jitter factor", func() {
+			h.pollJitterFactor = 0
+			Expect(h.nextPollInterval(0)).To(Equal(10 * time.Second))
+		})
+
+		DescribeTable("should back off on consecutive poll errors",
+			func(pollErrors int, expectedInterval time.Duration) {
+				interval := h.nextPollInterval(pollErrors)
+				Expect(interval).To(BeNumerically(">=", expectedInterval))
+				Expect(interval).To(BeNumerically("<", expectedInterval+expectedInterval/2))
+			},
+			Entry("with one error", 1, 20*time.Second),
+			Entry("with two errors", 2, 40*time.Second),
+			Entry("with three errors", 3, 80*time.Second),
+			Entry("with many errors", 10, maxPollErrorBackoff),
+		)
+	})
+
+	Context("handleEvents", func() {
+		var fakeRecorder *record.FakeRecorder
+
+		BeforeEach(func() {
+			fakeRecorder = record.NewFakeRecorder(10)
+			h.recorder = fakeRecorder
+		})
+
+		DescribeTable("should only terminate the instance on Preempt and Terminate events",
+			func(eventType string, expectedTerminating int, expectedEvents []string) {
+				Expect(h.handleEvents([]events{{EventID: "1", EventType: eventType}})).To(HaveLen(expectedTerminating))
+
+				Expect(fakeRecorder.Events).To(HaveLen(len(expectedEvents)))
+				for _, expectedEvent := range expectedEvents {
+					Expect(<-fakeRecorder.Events).To(HavePrefix(expectedEvent))
+				}
+			},
+			Entry("with a Preempt event", preemptEventType, 1, nil),
+			Entry("with a Terminate event", terminateEventType, 1, nil),
+			Entry("with a Reboot event", rebootEventType, 0, []string{"Warning Reboot"}),
+			Entry("with a Redeploy event", redeployEventType, 0, []string{"Warning Redeploy"}),
+			Entry("with a Freeze event", freezeEventType, 0, []string{"Warning Freeze"}),
+			Entry("with an unknown event", "Unknown", 0, nil),
+		)
+
+		It("should terminate the instance when one of the events terminates it", func() {
+			Expect(h.handleEvents([]events{
+				{EventID: "1", EventType: freezeEventType},
+				{EventID: "2", EventType: preemptEventType},
+			})).To(ConsistOf(events{EventID: "2", EventType: preemptEventType}))
+		})
+
+		It("should record each event once", func() {
+			scheduled := []events{{EventID: "1", EventType: rebootEventType}}
+			Expect(h.handleEvents(scheduled)).To(BeEmpty())
+			Expect(h.handleEvents(scheduled)).To(BeEmpty())
+			Expect(h.handleEvents([]events{{EventID: "2", EventType: rebootEventType}})).To(BeEmpty())
+
+			Expect(fakeRecorder.Events).To(HaveLen(2))
+		})
 	})
 
 	Context("addNodeTerminationCondition", func() {